@@ -1,13 +1,25 @@
 package main
 
 import (
+	"NodePassDash/internal/anomaly"
+	"NodePassDash/internal/api"
 	"NodePassDash/internal/auth"
 	"NodePassDash/internal/dashboard"
 	dbPkg "NodePassDash/internal/db"
 	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/endpointinfo"
+	"NodePassDash/internal/exporter"
+	"NodePassDash/internal/failover"
+	"NodePassDash/internal/forecast"
+	"NodePassDash/internal/healing"
+	"NodePassDash/internal/logalert"
+	"NodePassDash/internal/logsink"
+	"NodePassDash/internal/metricpush"
 	// "NodePassDash/internal/lifecycle"
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/report"
+	"NodePassDash/internal/rollup"
 	"NodePassDash/internal/router"
 	"NodePassDash/internal/sse"
 	"NodePassDash/internal/tunnel"
@@ -120,6 +132,14 @@ func serveStaticFile(c *gin.Context, fsys fs.FS, fileName, contentType string) {
 	c.DataFromReader(200, stat.Size(), contentType, fileData, nil)
 }
 
+// Prometheus 指标导出配置，由 parseFlags 填充
+var (
+	metricsToken  string // /metrics 访问令牌，设置后主端口开放 /metrics
+	metricsListen string // 独立的指标监听地址，如 127.0.0.1:9100
+	metricsTags   string // 作为指标标签输出的隧道标签键，逗号分隔
+	grafanaToken  string // Grafana 数据源访问令牌，可替代登录 JWT
+)
+
 // parseFlags 解析命令行参数并处理基础配置
 func parseFlags() (resetPwd bool, port, certFile, keyFile string, showVersion, disableLogin, sseDebugLog, disableSSELog, demoMode bool) {
 	// 命令行参数处理
@@ -139,6 +159,12 @@ func parseFlags() (resetPwd bool, port, certFile, keyFile string, showVersion, d
 	disableSSELogFlag := flag.Bool("disable-sse-log", false, "禁用 SSE 日志记录到文件")
 	// Demo 模式参数
 	demoModeFlag := flag.Bool("demo", false, "启用演示模式（默认密码为 Np123456. 并每天自动重置）")
+	// Prometheus 指标参数
+	metricsTokenFlag := flag.String("metrics-token", "", "/metrics 访问令牌，设置后在主端口开放 /metrics")
+	metricsListenFlag := flag.String("metrics-listen", "", "独立的 /metrics 监听地址，如 127.0.0.1:9100；绑定非回环地址时必须同时设置 --metrics-token")
+	metricsTagsFlag := flag.String("metrics-tags", "", "作为指标标签输出的隧道标签键，逗号分隔")
+	// Grafana 数据源参数
+	grafanaTokenFlag := flag.String("grafana-token", "", "Grafana 数据源 /api/grafana 访问令牌")
 
 	flag.Parse()
 
@@ -209,6 +235,25 @@ func parseFlags() (resetPwd bool, port, certFile, keyFile string, showVersion, d
 		}
 	}
 
+	// 设置 Prometheus 指标配置
+	// 优先级：命令行参数 > 环境变量
+	metricsToken = *metricsTokenFlag
+	if metricsToken == "" {
+		metricsToken = os.Getenv("METRICS_TOKEN")
+	}
+	metricsListen = *metricsListenFlag
+	if metricsListen == "" {
+		metricsListen = os.Getenv("METRICS_LISTEN")
+	}
+	metricsTags = *metricsTagsFlag
+	if metricsTags == "" {
+		metricsTags = os.Getenv("METRICS_TAGS")
+	}
+	grafanaToken = *grafanaTokenFlag
+	if grafanaToken == "" {
+		grafanaToken = os.Getenv("GRAFANA_TOKEN")
+	}
+
 	return *resetPwdCmd, port, certFile, keyFile, *versionFlag || *vFlag, disableLogin, sseDebugLog, disableSSELog, demoMode
 }
 
@@ -360,6 +405,25 @@ func startHTTPServer(ginRouter *gin.Engine, port, certFile, keyFile string) *htt
 	return server
 }
 
+// startMetricsServer 在独立地址上提供 /metrics
+func startMetricsServer(metricsExporter *exporter.Exporter, addr, token string) *http.Server {
+	metricsRouter := gin.New()
+	metricsRouter.Use(gin.Recovery())
+	api.SetupMetricsExporterRoutes(metricsRouter, metricsExporter, token)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: metricsRouter,
+	}
+	go func() {
+		log.Infof("Prometheus 指标监听在 http://%s/metrics", addr)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Errorf("指标服务器错误: %v", err)
+		}
+	}()
+	return server
+}
+
 // startBackgroundServices 启动后台服务
 func startBackgroundServices(gormDB *gorm.DB, sseService *sse.Service, sseManager *sse.Manager, wsService *websocket.Service) *dashboard.TrafficScheduler {
 	// 启动流量调度器（用于优化流量数据查询性能）
@@ -458,6 +522,12 @@ func main() {
 		return
 	}
 
+	// 未设置令牌的独立指标监听只允许绑定回环地址，否则拒绝启动
+	if err := api.CheckMetricsListen(metricsListen, metricsToken); err != nil {
+		log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
 	// 检查数据库配置状态。若 driver 字段尚未提供(.env 未写、env 未注入),进入 Setup 模式。
 	// 此时不打开数据库、不启动业务服务,只提供 /api/setup/* 路由给前端向导。
 	dbCfg := dbPkg.GetDBConfig("db")
@@ -484,6 +554,65 @@ func main() {
 		}
 	}()
 
+	// 隧道自愈：监听 SSE 状态变化，异常隧道按策略自动重启
+	healingService := healing.NewService(gormDB)
+	healingService.SetNotifier(sseService.PushTunnelEvent)
+	sseService.SetStatusListener(healingService)
+	defer healingService.Close()
+
+	// 服务故障转移：定期检查 server 端健康状况，不健康时切到备用主控
+	failoverService := failover.NewService(gormDB, tunnelService)
+	failoverService.Start()
+	defer failoverService.Close()
+
+	// 日志告警：按规则匹配 SSE 推送的隧道日志，达到阈值时记录告警并推送
+	logAlertService := logalert.NewService(gormDB)
+	logAlertService.SetNotifier(sseService.PushTunnelEvent)
+	sseService.AddLogListener(logAlertService)
+
+	// 日志外发：将隧道日志附加标签后推送到 syslog、Loki 或 HTTP 收集端
+	logSinkService := logsink.NewService(gormDB)
+	logSinkService.Start()
+	sseService.AddLogListener(logSinkService)
+	defer logSinkService.Close()
+
+	// 指标推送：定期将 service_history 数据以 OTLP 或 InfluxDB 行协议推送到外部
+	metricPushService := metricpush.NewService(gormDB)
+	metricPushService.Start()
+	defer metricPushService.Close()
+
+	// 历史数据降采样：将分钟数据汇总为 5 分钟、1 小时、1 天层级，供长时间范围的趋势查询
+	rollupService := rollup.NewService(gormDB)
+	rollupService.Start()
+	defer rollupService.Close()
+
+	// 流量异常检测：按周内小时学习各隧道的流量基线，偏离时记录异常并推送
+	anomalyService := anomaly.NewService(gormDB)
+	anomalyService.SetNotifier(sseService.PushTunnelEvent)
+	anomalyService.Start()
+	defer anomalyService.Close()
+
+	// 用量报表：按需汇总整小时流量，并在每月初预生成上月报表
+	reportService := report.NewService(gormDB)
+	reportService.Start()
+	defer reportService.Close()
+
+	// 主控系统信息轮询：容量预测与 Prometheus 指标共用同一份缓存
+	endpointInfoPoller := endpointinfo.NewPoller(gormDB, nil)
+	endpointInfoPoller.Start()
+	defer endpointInfoPoller.Close()
+
+	// 容量预测：定期采样主控系统指标，按趋势预测月底流量及越过容量阈值的时间
+	forecastService := forecast.NewService(gormDB, endpointInfoPoller)
+	forecastService.Start()
+	defer forecastService.Close()
+
+	// Prometheus 指标：配置了访问令牌或独立监听地址时启用
+	var metricsExporter *exporter.Exporter
+	if metricsToken != "" || metricsListen != "" {
+		metricsExporter = exporter.NewExporter(gormDB, sseManager, endpointInfoPoller, exporter.Config{TagKeys: strings.Split(metricsTags, ",")})
+	}
+
 	// 延迟启动SSE组件和流量调度器
 	var trafficScheduler *dashboard.TrafficScheduler
 
@@ -491,7 +620,7 @@ func main() {
 	log.Info("使用 Gin 路由器 (标准架构)")
 	gin.SetMode(gin.ReleaseMode) // 设置为生产模式
 
-	ginRouter := router.SetupRouter(gormDB, sseService, sseManager, wsService, Version)
+	ginRouter := router.SetupRouter(gormDB, sseService, sseManager, wsService, healingService, failoverService, logAlertService, logSinkService, metricPushService, rollupService, anomalyService, reportService, forecastService, metricsExporter, metricsToken, grafanaToken, Version)
 
 	// 配置静态文件服务
 	if err := setupStaticFiles(ginRouter); err != nil {
@@ -531,6 +660,13 @@ func main() {
 	// 启动HTTP/HTTPS服务器
 	server := startHTTPServer(ginRouter, port, certFile, keyFile)
 
+	// 启动独立的指标监听
+	var metricsServer *http.Server
+	if metricsExporter != nil && metricsListen != "" {
+		metricsServer = startMetricsServer(metricsExporter, metricsListen, metricsToken)
+		defer metricsServer.Close()
+	}
+
 	// 等待服务器启动完成，然后启动后台服务
 	time.Sleep(2 * time.Second)
 
@@ -0,0 +1,126 @@
+package anomaly
+
+import (
+	"NodePassDash/internal/models"
+	"math"
+	"time"
+)
+
+const (
+	minLogStd     = 0.1 // log 空间标准差下限，约等于 ±10%，避免流量稳定时微小波动被放大
+	ewmaWarmup    = 12  // 短期基线的最少样本数（小时）
+	anomalyWeight = 0.25
+	maxFactor     = 3.0 // 误报反馈调整阈值倍数的上限
+	factorStep    = 1.1
+)
+
+// stats log1p(字节数) 的指数加权均值与方差
+type stats struct {
+	mean     float64
+	variance float64
+	samples  int
+}
+
+// observe 以权重 alpha 更新均值与方差
+func (s *stats) observe(x, alpha float64) {
+	if s.samples == 0 {
+		s.mean, s.variance, s.samples = x, 0, 1
+		return
+	}
+	diff := x - s.mean
+	incr := alpha * diff
+	s.mean += incr
+	s.variance = (1 - alpha) * (s.variance + diff*incr)
+	s.samples++
+}
+
+func (s stats) std() float64 {
+	return math.Max(math.Sqrt(s.variance), minLogStd)
+}
+
+func toLog(bytes float64) float64 {
+	return math.Log1p(math.Max(bytes, 0))
+}
+
+func fromLog(v float64) float64 {
+	return math.Max(math.Expm1(v), 0)
+}
+
+// hourOfWeek 返回本地时区的周内小时（周日 0 点为 0）
+func hourOfWeek(t time.Time) int {
+	t = t.Local()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// verdict 单次检测结果
+type verdict struct {
+	kind      models.TrafficAnomalyKind
+	severity  models.TrafficAnomalySeverity
+	score     float64
+	threshold float64
+	expected  float64
+	lower     float64
+	upper     float64
+	basis     string // seasonal 或 ewma
+	samples   int
+}
+
+// evaluate 将观测值（字节/小时）与基线比较：季节性基线样本足够时优先使用，否则使用短期基线
+// 返回 ok=false 表示基线仍在学习或未偏离
+func evaluate(observed float64, seasonal, ewma stats, cfg Config, spikeFactor, dropFactor float64) (verdict, bool) {
+	base, basis := seasonal, "seasonal"
+	if seasonal.samples < cfg.MinSamples {
+		if ewma.samples < ewmaWarmup {
+			return verdict{}, false
+		}
+		base, basis = ewma, "ewma"
+	}
+
+	std := base.std()
+	v := verdict{
+		score:    (toLog(observed) - base.mean) / std,
+		expected: fromLog(base.mean),
+		basis:    basis,
+		samples:  base.samples,
+	}
+	switch {
+	case v.score > 0 && observed >= float64(cfg.MinTrafficBytes):
+		v.kind, v.threshold = models.TrafficAnomalySpike, cfg.Sensitivity*spikeFactor
+	case v.score < 0 && v.expected >= float64(cfg.MinTrafficBytes):
+		v.kind, v.threshold = models.TrafficAnomalyDrop, cfg.Sensitivity*dropFactor
+	default:
+		return v, false
+	}
+	v.lower = fromLog(base.mean - v.threshold*std)
+	v.upper = fromLog(base.mean + v.threshold*std)
+
+	ratio := math.Abs(v.score) / v.threshold
+	switch {
+	case ratio < 1:
+		return v, false
+	case ratio >= 2:
+		v.severity = models.TrafficAnomalyCritical
+	case ratio >= 1.5:
+		v.severity = models.TrafficAnomalyWarning
+	default:
+		v.severity = models.TrafficAnomalyInfo
+	}
+	return v, true
+}
+
+// tune 误报反馈：放宽对应类型的阈值倍数
+func tune(state *models.TrafficAnomalyState, kind models.TrafficAnomalyKind) {
+	state.FalsePositives++
+	if kind == models.TrafficAnomalySpike {
+		state.SpikeFactor = math.Min(normalizeFactor(state.SpikeFactor)*factorStep, maxFactor)
+	} else {
+		state.DropFactor = math.Min(normalizeFactor(state.DropFactor)*factorStep, maxFactor)
+	}
+}
+
+func normalizeFactor(f float64) float64 {
+	if f < 1 {
+		return 1
+	}
+	return f
+}
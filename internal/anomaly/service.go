@@ -0,0 +1,609 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/periodic"
+	"NodePassDash/internal/sysconfig"
+	"NodePassDash/internal/timezone"
+
+	"gorm.io/gorm"
+)
+
+const (
+	configKey       = "traffic_anomaly_config"
+	runInterval     = 5 * time.Minute
+	backfillWindow  = 28 * 24 * time.Hour // 首次运行时用于学习基线的历史范围
+	activeWindow    = 48 * time.Hour      // 检测进度在该范围内的隧道才参与计算读取起点
+	emitWindow      = 6 * time.Hour       // 只为最近的整小时产生异常事件，历史数据仅用于学习
+	minuteCooldown  = time.Hour           // 分钟级检测对同一隧道同类异常的冷却时间
+	slotsPerWeek    = 7 * 24
+	defaultPageSize = 50
+)
+
+// ErrInvalidConfig 异常检测配置不合法
+var ErrInvalidConfig = errors.New("无效的异常检测配置")
+
+// Config 异常检测配置，保存在 system_configs 中
+type Config struct {
+	Enabled         bool    `json:"enabled"`
+	Sensitivity     float64 `json:"sensitivity"`     // 偏离多少个标准差视为异常，越小越灵敏
+	Alpha           float64 `json:"alpha"`           // EWMA 平滑系数，越大越偏重近期数据
+	MinSamples      int     `json:"minSamples"`      // 季节性基线（同一周内小时）生效所需的最少样本数
+	MinTrafficBytes int64   `json:"minTrafficBytes"` // 每小时流量低于该值时不判定突增/骤降，过滤低流量噪声
+	MinuteWindow    int     `json:"minuteWindow"`    // 基于 service_history 的快速检测窗口（分钟），0 表示关闭
+	RetentionDays   int     `json:"retentionDays"`   // 异常事件保留天数
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:         true,
+		Sensitivity:     3,
+		Alpha:           0.2,
+		MinSamples:      3,
+		MinTrafficBytes: 10 * 1024 * 1024,
+		MinuteWindow:    15,
+		RetentionDays:   90,
+	}
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Sensitivity < 1 || c.Sensitivity > 10:
+		return fmt.Errorf("%w: 灵敏度需在 1~10 之间", ErrInvalidConfig)
+	case c.Alpha <= 0 || c.Alpha > 1:
+		return fmt.Errorf("%w: 平滑系数需在 (0, 1] 之间", ErrInvalidConfig)
+	case c.MinSamples < 1 || c.MinSamples > 52:
+		return fmt.Errorf("%w: 最少样本数需在 1~52 之间", ErrInvalidConfig)
+	case c.MinTrafficBytes < 0:
+		return fmt.Errorf("%w: 最小流量不能为负数", ErrInvalidConfig)
+	case c.MinuteWindow < 0 || c.MinuteWindow > 60:
+		return fmt.Errorf("%w: 快速检测窗口需在 0~60 分钟之间", ErrInvalidConfig)
+	case c.RetentionDays < 1:
+		return fmt.Errorf("%w: 保留天数需大于 0", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// EventNotifier 异常事件推送回调（通常接到 SSE 隧道订阅推送）
+type EventNotifier func(instanceID string, data interface{})
+
+// Event 推送给前端的流量异常事件
+type Event struct {
+	Type    string                 `json:"type"` // 固定为 traffic_anomaly
+	Anomaly *models.TrafficAnomaly `json:"anomaly"`
+}
+
+// AnomalyFilter 异常事件查询条件
+type AnomalyFilter struct {
+	EndpointID    int64
+	InstanceID    string
+	TunnelID      int64
+	Kind          models.TrafficAnomalyKind
+	Severity      models.TrafficAnomalySeverity
+	FalsePositive *bool
+	Page          int
+	PageSize      int
+}
+
+// SlotBaseline 单个周内小时的基线
+type SlotBaseline struct {
+	Slot     int     `json:"slot"`
+	Weekday  int     `json:"weekday"`
+	Hour     int     `json:"hour"`
+	Expected float64 `json:"expected"` // 字节/小时
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+	Samples  int     `json:"samples"`
+}
+
+// BaselineView 隧道的基线概览
+type BaselineView struct {
+	State *models.TrafficAnomalyState `json:"state"`
+	Slots []SlotBaseline              `json:"slots"`
+}
+
+// Service 流量异常检测服务
+// 按隧道维护周内小时的季节性 EWMA 基线，定期用 traffic_hourly_summary 的整小时增量
+// 与 service_history 的最近若干分钟流量与基线比较，偏离超过灵敏度时记录异常事件并推送
+type Service struct {
+	*periodic.Task
+	db  *gorm.DB
+	cfg *sysconfig.Store[Config]
+
+	mu       sync.Mutex
+	notifier EventNotifier
+	runMu    sync.Mutex
+
+	now func() time.Time
+}
+
+// NewService 创建流量异常检测服务
+func NewService(db *gorm.DB) *Service {
+	s := &Service{
+		db:  db,
+		cfg: sysconfig.NewStore(db, configKey, DefaultConfig(), Config.validate),
+		now: time.Now,
+	}
+	s.Task = periodic.New("流量异常检测", runInterval, s.RunOnce)
+	return s
+}
+
+// SetNotifier 设置事件推送回调
+func (s *Service) SetNotifier(notifier EventNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// Config 返回当前配置
+func (s *Service) Config() Config {
+	return s.cfg.Get()
+}
+
+// SetConfig 校验并保存配置
+func (s *Service) SetConfig(cfg Config) error {
+	return s.cfg.Set(cfg)
+}
+
+// RunOnce 执行一次整小时检测与分钟级快速检测，并清理过期事件
+func (s *Service) RunOnce() error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	cfg := s.Config()
+	if !cfg.Enabled {
+		return nil
+	}
+	now := s.now()
+	if err := s.detectHourly(cfg, now); err != nil {
+		return fmt.Errorf("整小时检测失败: %w", err)
+	}
+	if cfg.MinuteWindow > 0 {
+		if err := s.detectMinute(cfg, now); err != nil {
+			return fmt.Errorf("分钟级检测失败: %w", err)
+		}
+	}
+	cutoff := now.AddDate(0, 0, -cfg.RetentionDays)
+	return s.db.Where("created_at < ?", cutoff).Delete(&models.TrafficAnomaly{}).Error
+}
+
+func instanceKey(endpointID int64, instanceID string) string {
+	return strconv.FormatInt(endpointID, 10) + ":" + instanceID
+}
+
+func slotKey(endpointID int64, instanceID string, slot int) string {
+	return instanceKey(endpointID, instanceID) + ":" + strconv.Itoa(slot)
+}
+
+// model 一次检测所需的基线与状态，记录被修改的行以便保存
+type model struct {
+	states    map[string]*models.TrafficAnomalyState
+	baselines map[string]*models.TrafficBaseline
+	dirty     map[interface{}]bool
+}
+
+func (s *Service) loadModel(instances []string) (*model, error) {
+	m := &model{
+		states:    make(map[string]*models.TrafficAnomalyState),
+		baselines: make(map[string]*models.TrafficBaseline),
+		dirty:     make(map[interface{}]bool),
+	}
+	var states []models.TrafficAnomalyState
+	if err := s.db.Find(&states).Error; err != nil {
+		return nil, err
+	}
+	for i := range states {
+		m.states[instanceKey(states[i].EndpointID, states[i].InstanceID)] = &states[i]
+	}
+	if len(instances) == 0 {
+		return m, nil
+	}
+	var baselines []models.TrafficBaseline
+	if err := s.db.Where("instance_id IN ?", instances).Find(&baselines).Error; err != nil {
+		return nil, err
+	}
+	for i := range baselines {
+		b := &baselines[i]
+		m.baselines[slotKey(b.EndpointID, b.InstanceID, b.Slot)] = b
+	}
+	return m, nil
+}
+
+func (m *model) state(endpointID int64, instanceID string) *models.TrafficAnomalyState {
+	key := instanceKey(endpointID, instanceID)
+	st, ok := m.states[key]
+	if !ok {
+		st = &models.TrafficAnomalyState{EndpointID: endpointID, InstanceID: instanceID, SpikeFactor: 1, DropFactor: 1}
+		m.states[key] = st
+	}
+	return st
+}
+
+func (m *model) baseline(endpointID int64, instanceID string, slot int) *models.TrafficBaseline {
+	key := slotKey(endpointID, instanceID, slot)
+	b, ok := m.baselines[key]
+	if !ok {
+		b = &models.TrafficBaseline{EndpointID: endpointID, InstanceID: instanceID, Slot: slot}
+		m.baselines[key] = b
+	}
+	return b
+}
+
+// learn 用观测值更新季节性基线与短期基线；异常值以较低权重计入，避免污染基线
+func (m *model) learn(st *models.TrafficAnomalyState, b *models.TrafficBaseline, observed, alpha float64) {
+	x := toLog(observed)
+	seasonal := stats{mean: b.Mean, variance: b.Variance, samples: b.Samples}
+	seasonal.observe(x, alpha)
+	b.Mean, b.Variance, b.Samples = seasonal.mean, seasonal.variance, seasonal.samples
+
+	ewma := stats{mean: st.Mean, variance: st.Variance, samples: st.Samples}
+	ewma.observe(x, alpha)
+	st.Mean, st.Variance, st.Samples = ewma.mean, ewma.variance, ewma.samples
+	m.dirty[b] = true
+	m.dirty[st] = true
+}
+
+func (s *Service) saveModel(m *model) error {
+	if len(m.dirty) == 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for row := range m.dirty {
+			if err := tx.Save(row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// detectHourly 对尚未检测的整小时增量逐条检测并学习
+func (s *Service) detectHourly(cfg Config, now time.Time) error {
+	// 与 traffic_hourly_summary 写入时一致按本地整点划分，只检测已结束的小时
+	currentHour := timezone.StartOfHour(now, time.Local)
+	from := now.Add(-backfillWindow)
+
+	var states []models.TrafficAnomalyState
+	if err := s.db.Where("last_hour >= ?", now.Add(-activeWindow)).Find(&states).Error; err != nil {
+		return err
+	}
+	if len(states) > 0 {
+		from = states[0].LastHour.Time
+		for _, st := range states[1:] {
+			if st.LastHour.Time.Before(from) {
+				from = st.LastHour.Time
+			}
+		}
+	}
+
+	var rows []models.TrafficHourlySummary
+	if err := s.db.Where("hour_time >= ? AND hour_time < ? AND instance_id <> ''", from, currentHour).
+		Order("hour_time ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	instances := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		if !seen[r.InstanceID] {
+			seen[r.InstanceID] = true
+			instances = append(instances, r.InstanceID)
+		}
+	}
+	m, err := s.loadModel(instances)
+	if err != nil {
+		return err
+	}
+
+	var anomalies []*models.TrafficAnomaly
+	for i := range rows {
+		r := &rows[i]
+		st := m.state(r.EndpointID, r.InstanceID)
+		if st.LastHour.Valid && !r.HourTime.After(st.LastHour.Time) {
+			continue
+		}
+		observed := float64(r.GetTotalIncrement())
+		b := m.baseline(r.EndpointID, r.InstanceID, hourOfWeek(r.HourTime))
+
+		alpha := cfg.Alpha
+		v, anomalous := evaluate(observed, stats{mean: b.Mean, variance: b.Variance, samples: b.Samples},
+			stats{mean: st.Mean, variance: st.Variance, samples: st.Samples}, cfg, st.SpikeFactor, st.DropFactor)
+		if anomalous {
+			alpha *= anomalyWeight
+			if !r.HourTime.Before(now.Add(-emitWindow)) {
+				anomalies = append(anomalies, newAnomaly(r.EndpointID, r.InstanceID, models.TrafficAnomalyHourly,
+					r.HourTime, r.HourTime.Add(time.Hour), observed, v))
+			}
+		}
+		m.learn(st, b, observed, alpha)
+		st.LastHour = models.NullTime{Time: r.HourTime, Valid: true}
+	}
+
+	if err := s.saveModel(m); err != nil {
+		return err
+	}
+	s.emit(anomalies)
+	return nil
+}
+
+// detectMinute 用 service_history 最近若干分钟的流量折算为小时量，与当前时段基线比较
+// 只产生事件、不更新基线，同一隧道同类异常在冷却期内不重复产生
+func (s *Service) detectMinute(cfg Config, now time.Time) error {
+	end := now.Truncate(time.Minute)
+	start := end.Add(-time.Duration(cfg.MinuteWindow) * time.Minute)
+
+	var rows []models.ServiceHistory
+	if err := s.db.Select("endpoint_id", "instance_id", "record_time", "delta_tcp_in", "delta_tcp_out", "delta_udp_in", "delta_udp_out").
+		Where("record_time >= ? AND record_time < ? AND instance_id <> ''", start, end).
+		Order("record_time ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// 按实例计算窗口内的增量（累计值回退视为计数器重置）
+	type window struct {
+		endpointID  int64
+		instanceID  string
+		first, last time.Time
+		prev        int64
+		bytes       int64
+	}
+	windows := make(map[string]*window)
+	order := make([]string, 0)
+	for _, r := range rows {
+		total := r.DeltaTCPIn + r.DeltaTCPOut + r.DeltaUDPIn + r.DeltaUDPOut
+		key := instanceKey(r.EndpointID, r.InstanceID)
+		w, ok := windows[key]
+		if !ok {
+			windows[key] = &window{endpointID: r.EndpointID, instanceID: r.InstanceID, first: r.RecordTime, last: r.RecordTime, prev: total}
+			order = append(order, key)
+			continue
+		}
+		if d := total - w.prev; d >= 0 {
+			w.bytes += d
+		} else {
+			w.bytes += total
+		}
+		w.prev, w.last = total, r.RecordTime
+	}
+
+	instances := make([]string, 0, len(order))
+	for _, key := range order {
+		instances = append(instances, windows[key].instanceID)
+	}
+	m, err := s.loadModel(instances)
+	if err != nil {
+		return err
+	}
+
+	minSpan := time.Duration(cfg.MinuteWindow) * time.Minute / 2
+	var anomalies []*models.TrafficAnomaly
+	for _, key := range order {
+		w := windows[key]
+		span := w.last.Sub(w.first)
+		if span < minSpan || span <= 0 {
+			continue
+		}
+		st, ok := m.states[key]
+		if !ok {
+			continue // 基线尚未建立
+		}
+		observed := float64(w.bytes) * float64(time.Hour) / float64(span)
+		b := m.baseline(w.endpointID, w.instanceID, hourOfWeek(w.last))
+		v, anomalous := evaluate(observed, stats{mean: b.Mean, variance: b.Variance, samples: b.Samples},
+			stats{mean: st.Mean, variance: st.Variance, samples: st.Samples}, cfg, st.SpikeFactor, st.DropFactor)
+		if !anomalous {
+			continue
+		}
+		var recent int64
+		if err := s.db.Model(&models.TrafficAnomaly{}).
+			Where("endpoint_id = ? AND instance_id = ? AND kind = ? AND created_at >= ?", w.endpointID, w.instanceID, v.kind, now.Add(-minuteCooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			continue
+		}
+		a := newAnomaly(w.endpointID, w.instanceID, models.TrafficAnomalyMinute, w.first, w.last, observed, v)
+		a.Context["windowBytes"] = w.bytes
+		anomalies = append(anomalies, a)
+	}
+	s.emit(anomalies)
+	return nil
+}
+
+func newAnomaly(endpointID int64, instanceID string, source models.TrafficAnomalySource, start, end time.Time, observed float64, v verdict) *models.TrafficAnomaly {
+	slot := hourOfWeek(start)
+	ratio := 0.0
+	if v.expected > 0 {
+		ratio = observed / v.expected
+	}
+	return &models.TrafficAnomaly{
+		EndpointID:  endpointID,
+		InstanceID:  instanceID,
+		Kind:        v.kind,
+		Severity:    v.severity,
+		Source:      source,
+		WindowStart: start,
+		WindowEnd:   end,
+		Observed:    observed,
+		Expected:    v.expected,
+		Score:       v.score,
+		Threshold:   v.threshold,
+		Context: map[string]interface{}{
+			"basis":    v.basis,
+			"samples":  v.samples,
+			"slot":     slot,
+			"weekday":  slot / 24,
+			"hour":     slot % 24,
+			"lower":    v.lower,
+			"upper":    v.upper,
+			"ratio":    ratio,
+			"deviated": math.Abs(v.score) / v.threshold,
+		},
+	}
+}
+
+// emit 补全隧道信息后保存异常事件并推送
+func (s *Service) emit(anomalies []*models.TrafficAnomaly) {
+	if len(anomalies) == 0 {
+		return
+	}
+	s.mu.Lock()
+	notifier := s.notifier
+	s.mu.Unlock()
+
+	for _, a := range anomalies {
+		var tunnels []models.Tunnel
+		if err := s.db.Select("id", "name").Where("endpoint_id = ? AND instance_id = ?", a.EndpointID, a.InstanceID).
+			Limit(1).Find(&tunnels).Error; err == nil && len(tunnels) > 0 {
+			a.TunnelID, a.TunnelName = tunnels[0].ID, tunnels[0].Name
+		}
+		a.CreatedAt = s.now()
+		if err := s.db.Create(a).Error; err != nil {
+			log.Errorf("[Anomaly]保存流量异常失败: %v", err)
+			continue
+		}
+		log.Warnf("[Anomaly]检测到流量%s: 隧道 %s (%s) 观测 %.0f 期望 %.0f 偏离 %.1fσ",
+			a.Kind, a.TunnelName, a.InstanceID, a.Observed, a.Expected, a.Score)
+		if notifier != nil {
+			notifier(a.InstanceID, Event{Type: "traffic_anomaly", Anomaly: a})
+		}
+	}
+}
+
+// ListAnomalies 分页查询异常事件，按时间倒序
+func (s *Service) ListAnomalies(filter AnomalyFilter) ([]models.TrafficAnomaly, int64, error) {
+	query := s.db.Model(&models.TrafficAnomaly{})
+	if filter.EndpointID > 0 {
+		query = query.Where("endpoint_id = ?", filter.EndpointID)
+	}
+	if filter.InstanceID != "" {
+		query = query.Where("instance_id = ?", filter.InstanceID)
+	}
+	if filter.TunnelID > 0 {
+		query = query.Where("tunnel_id = ?", filter.TunnelID)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.FalsePositive != nil {
+		query = query.Where("false_positive = ?", *filter.FalsePositive)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 500 {
+		filter.PageSize = defaultPageSize
+	}
+	anomalies := []models.TrafficAnomaly{}
+	err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&anomalies).Error
+	return anomalies, total, err
+}
+
+// MarkFalsePositive 将异常标记为误报：观测值按正常数据计入基线，并放宽该隧道对应类型的阈值
+func (s *Service) MarkFalsePositive(id int64) (*models.TrafficAnomaly, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	var anomaly models.TrafficAnomaly
+	if err := s.db.First(&anomaly, id).Error; err != nil {
+		return nil, err
+	}
+	if anomaly.FalsePositive {
+		return &anomaly, nil
+	}
+
+	cfg := s.Config()
+	m, err := s.loadModel([]string{anomaly.InstanceID})
+	if err != nil {
+		return nil, err
+	}
+	st := m.state(anomaly.EndpointID, anomaly.InstanceID)
+	b := m.baseline(anomaly.EndpointID, anomaly.InstanceID, hourOfWeek(anomaly.WindowStart))
+	tune(st, anomaly.Kind)
+	m.learn(st, b, anomaly.Observed, cfg.Alpha)
+
+	anomaly.FalsePositive = true
+	anomaly.FeedbackAt = models.NullTime{Time: s.now(), Valid: true}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&anomaly).Updates(map[string]interface{}{
+			"false_positive": true,
+			"feedback_at":    anomaly.FeedbackAt,
+		}).Error; err != nil {
+			return err
+		}
+		for row := range m.dirty {
+			if err := tx.Save(row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &anomaly, nil
+}
+
+// Baseline 返回隧道的检测状态与 168 个周内小时的基线区间
+func (s *Service) Baseline(endpointID int64, instanceID string) (*BaselineView, error) {
+	cfg := s.Config()
+	var states []models.TrafficAnomalyState
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).Limit(1).Find(&states).Error; err != nil {
+		return nil, err
+	}
+	var baselines []models.TrafficBaseline
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).Find(&baselines).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(baselines, func(i, j int) bool { return baselines[i].Slot < baselines[j].Slot })
+
+	view := &BaselineView{Slots: make([]SlotBaseline, 0, len(baselines))}
+	spike, drop := 1.0, 1.0
+	if len(states) > 0 {
+		view.State = &states[0]
+		spike, drop = normalizeFactor(states[0].SpikeFactor), normalizeFactor(states[0].DropFactor)
+	}
+	for _, b := range baselines {
+		if b.Slot < 0 || b.Slot >= slotsPerWeek {
+			continue
+		}
+		st := stats{mean: b.Mean, variance: b.Variance, samples: b.Samples}
+		view.Slots = append(view.Slots, SlotBaseline{
+			Slot:     b.Slot,
+			Weekday:  b.Slot / 24,
+			Hour:     b.Slot % 24,
+			Expected: fromLog(b.Mean),
+			Lower:    fromLog(b.Mean - cfg.Sensitivity*drop*st.std()),
+			Upper:    fromLog(b.Mean + cfg.Sensitivity*spike*st.std()),
+			Samples:  b.Samples,
+		})
+	}
+	return view, nil
+}
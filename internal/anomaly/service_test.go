@@ -0,0 +1,81 @@
+package anomaly
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/testdb"
+	"NodePassDash/internal/timezone"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHourlyDetectionAndFeedback(t *testing.T) {
+	db := testdb.Open(t, &models.Tunnel{}, &models.TrafficHourlySummary{}, &models.ServiceHistory{}, &models.SystemConfig{},
+		&models.TrafficBaseline{}, &models.TrafficAnomalyState{}, &models.TrafficAnomaly{})
+
+	db.Create(&models.Tunnel{Name: "web", EndpointID: 1, InstanceID: strPtr("abc")})
+
+	// 四周的整小时数据：白天 1GB、夜间 100MB，最后一个小时突增 10 倍
+	now := time.Date(2024, 3, 4, 15, 40, 0, 0, time.Local)
+	last := timezone.StartOfHour(now, time.Local).Add(-time.Hour)
+	for h := last.Add(-28*24*time.Hour + time.Hour); !h.After(last); h = h.Add(time.Hour) {
+		bytes := int64(100 << 20)
+		if h.Hour() >= 8 && h.Hour() < 20 {
+			bytes = 1 << 30
+		}
+		if h.Equal(last) {
+			bytes *= 10
+		}
+		db.Create(&models.TrafficHourlySummary{HourTime: h, EndpointID: 1, InstanceID: "abc", TCPRxIncrement: bytes})
+	}
+	// 尚未结束的当前小时只有部分流量，不应参与检测
+	db.Create(&models.TrafficHourlySummary{HourTime: last.Add(time.Hour), EndpointID: 1, InstanceID: "abc", TCPRxIncrement: 1})
+
+	s := NewService(db)
+	s.now = func() time.Time { return now }
+	if err := s.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	var anomalies []models.TrafficAnomaly
+	db.Find(&anomalies)
+	if len(anomalies) != 1 {
+		t.Fatalf("anomalies = %d, want 1", len(anomalies))
+	}
+	a := anomalies[0]
+	if a.Kind != models.TrafficAnomalySpike || a.Severity != models.TrafficAnomalyCritical ||
+		!a.WindowStart.Equal(last) || math.Abs(a.Expected-(1<<30)) > 1 || a.TunnelName != "web" || a.Context["basis"] != "seasonal" {
+		t.Errorf("anomaly = %+v", a)
+	}
+
+	// 再次运行不应重复检测已处理的小时
+	if err := s.RunOnce(); err != nil {
+		t.Fatalf("second RunOnce: %v", err)
+	}
+	var count int64
+	db.Model(&models.TrafficAnomaly{}).Count(&count)
+	if count != 1 {
+		t.Errorf("anomalies after rerun = %d, want 1", count)
+	}
+
+	// 误报反馈放宽突增阈值，并把观测值计入基线
+	marked, err := s.MarkFalsePositive(a.ID)
+	if err != nil || !marked.FalsePositive {
+		t.Fatalf("MarkFalsePositive: %+v, %v", marked, err)
+	}
+	view, err := s.Baseline(1, "abc")
+	if err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+	if view.State.SpikeFactor != factorStep || view.State.DropFactor != 1 || view.State.FalsePositives != 1 {
+		t.Errorf("state = %+v", view.State)
+	}
+	if len(view.Slots) != slotsPerWeek {
+		t.Errorf("slots = %d, want %d", len(view.Slots), slotsPerWeek)
+	}
+	if slot := view.Slots[hourOfWeek(last)]; slot.Expected <= 1<<30 {
+		t.Errorf("slot expected = %v, want above 1GB after feedback", slot.Expected)
+	}
+}
+
+func strPtr(s string) *string { return &s }
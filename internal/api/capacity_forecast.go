@@ -0,0 +1,144 @@
+package api
+
+import (
+	"NodePassDash/internal/forecast"
+	"NodePassDash/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CapacityForecastHandler 容量预测处理器
+type CapacityForecastHandler struct {
+	forecastService *forecast.Service
+}
+
+// NewCapacityForecastHandler 创建容量预测处理器
+func NewCapacityForecastHandler(forecastService *forecast.Service) *CapacityForecastHandler {
+	return &CapacityForecastHandler{forecastService: forecastService}
+}
+
+// SetupCapacityForecastRoutes 设置容量预测相关路由
+func SetupCapacityForecastRoutes(rg *gin.RouterGroup, forecastService *forecast.Service) {
+	capacityForecastHandler := NewCapacityForecastHandler(forecastService)
+
+	rg.GET("/forecast/overview", capacityForecastHandler.HandleOverview)
+	rg.GET("/forecast/tunnels/:id", capacityForecastHandler.HandleTunnelForecast)
+	rg.GET("/forecast/endpoints/:id", capacityForecastHandler.HandleEndpointForecast)
+	rg.GET("/forecast/thresholds", capacityForecastHandler.HandleListThresholds)
+	rg.PUT("/forecast/thresholds", capacityForecastHandler.HandleSaveThreshold)
+	rg.DELETE("/forecast/thresholds/:id", capacityForecastHandler.HandleDeleteThreshold)
+}
+
+// HandleOverview 获取全部隧道或主控的预计月底用量及越过阈值的时间 (GET /api/forecast/overview?scope=tunnel|endpoint)
+func (h *CapacityForecastHandler) HandleOverview(c *gin.Context) {
+	switch models.CapacityScope(c.DefaultQuery("scope", string(models.CapacityScopeTunnel))) {
+	case models.CapacityScopeTunnel:
+		items, err := h.forecastService.TunnelOverview()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "items": items})
+	case models.CapacityScopeEndpoint:
+		items, err := h.forecastService.EndpointOverview()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "items": items})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope 仅支持 tunnel、endpoint"})
+	}
+}
+
+// HandleTunnelForecast 获取单个隧道的本月流量预测（含每日历史与预测明细）
+func (h *CapacityForecastHandler) HandleTunnelForecast(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隧道ID"})
+		return
+	}
+
+	result, err := h.forecastService.TunnelForecast(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "隧道不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "forecast": result})
+}
+
+// HandleEndpointForecast 获取单个主控的流量、CPU、内存预测（含每日历史与预测明细）
+func (h *CapacityForecastHandler) HandleEndpointForecast(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的主控ID"})
+		return
+	}
+
+	result, err := h.forecastService.EndpointForecast(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "主控不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "forecast": result})
+}
+
+// HandleListThresholds 列出容量阈值
+func (h *CapacityForecastHandler) HandleListThresholds(c *gin.Context) {
+	thresholds, err := h.forecastService.ListThresholds()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "thresholds": thresholds})
+}
+
+// HandleSaveThreshold 新增或更新容量阈值，targetId 为 0 时作为默认阈值
+func (h *CapacityForecastHandler) HandleSaveThreshold(c *gin.Context) {
+	var threshold models.CapacityThreshold
+	if err := c.ShouldBindJSON(&threshold); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.forecastService.SaveThreshold(&threshold); err != nil {
+		if errors.Is(err, forecast.ErrInvalidThreshold) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "容量阈值已保存", "threshold": threshold})
+}
+
+// HandleDeleteThreshold 删除容量阈值
+func (h *CapacityForecastHandler) HandleDeleteThreshold(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的阈值ID"})
+		return
+	}
+
+	if err := h.forecastService.DeleteThreshold(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "阈值不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "容量阈值已删除"})
+}
@@ -2,6 +2,10 @@ package api
 
 import (
 	"NodePassDash/internal/dashboard"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/timezone"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,19 +15,23 @@ import (
 // DashboardHandler 仪表盘相关的处理器
 type DashboardHandler struct {
 	dashboardService *dashboard.Service
+	sseService       *sse.Service
+	timezoneService  *timezone.Service
 }
 
 // NewDashboardHandler 创建仪表盘处理器实例
-func NewDashboardHandler(dashboardService *dashboard.Service) *DashboardHandler {
+func NewDashboardHandler(dashboardService *dashboard.Service, sseService *sse.Service, timezoneService *timezone.Service) *DashboardHandler {
 	return &DashboardHandler{
 		dashboardService: dashboardService,
+		sseService:       sseService,
+		timezoneService:  timezoneService,
 	}
 }
 
 // setupDashboardRoutes 设置仪表盘相关路由
-func SetupDashboardRoutes(rg *gin.RouterGroup, dashboardService *dashboard.Service) {
+func SetupDashboardRoutes(rg *gin.RouterGroup, dashboardService *dashboard.Service, sseService *sse.Service, timezoneService *timezone.Service) {
 	// 创建DashboardHandler实例
-	dashboardHandler := NewDashboardHandler(dashboardService)
+	dashboardHandler := NewDashboardHandler(dashboardService, sseService, timezoneService)
 
 	// 仪表盘流量趋势
 	rg.GET("/dashboard/traffic-trend", dashboardHandler.HandleTrafficTrend)
@@ -38,6 +46,9 @@ func SetupDashboardRoutes(rg *gin.RouterGroup, dashboardService *dashboard.Servi
 	// 每周流量统计
 	rg.GET("/dashboard/weekly-stats", dashboardHandler.HandleWeeklyStats)
 
+	// 排行榜（按流量、速率、连接数或延迟）
+	rg.GET("/dashboard/top", dashboardHandler.HandleGetTop)
+
 	//rg.GET("/dashboard/overall-stats", dashboardHandler.HandleGetOverallStats)
 }
 
@@ -121,8 +132,13 @@ func (h *DashboardHandler) HandleGetStats(c *gin.Context) {
 		return
 	}
 
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
 	// 获取统计数据
-	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange))
+	stats, err := h.dashboardService.GetStats(dashboard.TimeRange(timeRange), loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get dashboard data: " + err.Error(),
@@ -134,7 +150,7 @@ func (h *DashboardHandler) HandleGetStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// HandleTrafficTrend GET /api/dashboard/traffic-trend
+// HandleTrafficTrend GET /api/dashboard/traffic-trend?hours=24&tz=Asia/Shanghai
 func (h *DashboardHandler) HandleTrafficTrend(c *gin.Context) {
 
 	// hours 参数可选
@@ -146,7 +162,12 @@ func (h *DashboardHandler) HandleTrafficTrend(c *gin.Context) {
 		}
 	}
 
-	trend, err := h.dashboardService.GetTrafficTrend(hours)
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
+	trend, err := h.dashboardService.GetTrafficTrend(hours, loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -156,13 +177,18 @@ func (h *DashboardHandler) HandleTrafficTrend(c *gin.Context) {
 		trend = make([]dashboard.TrafficTrendItem, 0)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": trend, "count": len(trend)})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": trend, "count": len(trend), "timezone": loc.String()})
 }
 
-// HandleTodayTraffic GET /api/dashboard/today-traffic
-// 返回本地零点起、所有实例合计的当日流量增量。
+// HandleTodayTraffic GET /api/dashboard/today-traffic?tz=
+// 返回显示时区零点起、所有实例合计的当日流量增量。
 func (h *DashboardHandler) HandleTodayTraffic(c *gin.Context) {
-	today, err := h.dashboardService.GetTodayTraffic()
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
+	today, err := h.dashboardService.GetTodayTraffic(loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -176,6 +202,7 @@ func (h *DashboardHandler) HandleTodayTraffic(c *gin.Context) {
 			"udpOut": today.UDPTx,
 			"total":  today.Total(),
 		},
+		"timezone": loc.String(),
 	})
 }
 
@@ -239,9 +266,14 @@ func (h *DashboardHandler) HandleGetTunnelStats(c *gin.Context) {
 	})
 }
 
-// HandleWeeklyStats GET /api/dashboard/weekly-stats
+// HandleWeeklyStats GET /api/dashboard/weekly-stats?tz=
 func (h *DashboardHandler) HandleWeeklyStats(c *gin.Context) {
-	weeklyStats, err := h.dashboardService.GetWeeklyStats()
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
+	weeklyStats, err := h.dashboardService.GetWeeklyStats(loc)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -256,8 +288,35 @@ func (h *DashboardHandler) HandleWeeklyStats(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    weeklyStats,
-		"count":   len(weeklyStats),
+		"success":  true,
+		"data":     weeklyStats,
+		"count":    len(weeklyStats),
+		"timezone": loc.String(),
 	})
 }
+
+// HandleGetTop GET /api/dashboard/top?by=tunnel|endpoint|group|service&metric=traffic|rate|connections|latency&hours=24&limit=10
+func (h *DashboardHandler) HandleGetTop(c *gin.Context) {
+	query := dashboard.TopQuery{
+		Dimension: models.UsageReportGroupBy(c.DefaultQuery("by", string(models.UsageGroupByTunnel))),
+		Metric:    dashboard.TopMetric(c.DefaultQuery("metric", string(dashboard.TopMetricTraffic))),
+	}
+	query.Hours, _ = strconv.Atoi(c.Query("hours"))
+	query.Limit, _ = strconv.Atoi(c.Query("limit"))
+
+	var live []sse.LiveSnapshot
+	if h.sseService != nil {
+		live = h.sseService.LiveSnapshots(dashboard.LiveMaxAge)
+	}
+	top, err := h.dashboardService.GetTop(query, live)
+	if err != nil {
+		if errors.Is(err, dashboard.ErrInvalidTopQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": top})
+}
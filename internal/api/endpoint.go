@@ -58,6 +58,7 @@ func SetupEndpointRoutes(rg *gin.RouterGroup, endpointService *endpoint.Service,
 	rg.GET("/endpoints/:id/file-logs", endpointHandler.HandleEndpointFileLogs)
 	rg.DELETE("/endpoints/:id/file-logs/clear", endpointHandler.HandleClearEndpointFileLogs)
 	rg.GET("/endpoints/:id/file-logs/dates", endpointHandler.HandleGetAvailableLogDates)
+	rg.GET("/endpoints/:id/logs/search", endpointHandler.HandleSearchEndpointLogs)
 	rg.GET("/endpoints/:id/stats", endpointHandler.HandleEndpointStats)
 	rg.POST("/endpoints/:id/tcping", endpointHandler.HandleTCPing)
 	rg.POST("/endpoints/:id/network-debug", endpointHandler.HandleNetworkDebug)
@@ -572,12 +573,25 @@ func (h *EndpointHandler) HandleEndpointLogs(c *gin.Context) {
 }
 
 // HandleSearchEndpointLogs GET /api/endpoints/{id}/logs/search
-// 支持查询条件: level, instanceId, start, end, page, size
-// DEPRECATED: EndpointSSE 模型已移除 Logs 字段
+// 在该端点的文件日志中检索，支持查询条件: q, regex, caseSensitive, level, instanceId, start, end, page, size, context
 func (h *EndpointHandler) HandleSearchEndpointLogs(c *gin.Context) {
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"error": "This feature is deprecated, EndpointSSE model no longer supports Logs field",
-	})
+	endpointID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的端点ID"})
+		return
+	}
+	if h.sseManager == nil || h.sseManager.GetFileLogger() == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "文件日志管理器未初始化"})
+		return
+	}
+
+	q, err := parseLogSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.EndpointIDs = []int64{endpointID}
+	searchLogs(c, h.sseManager.GetFileLogger(), q)
 }
 
 // HandleRecycleList 获取指定端点回收站隧道 (GET /api/endpoints/{id}/recycle)
@@ -1202,7 +1216,7 @@ func (h *EndpointHandler) calculateDirStats(dirPath string) (int, int64) {
 			return nil // 忽略错误，继续处理
 		}
 
-		if !info.IsDir() && filepath.Ext(path) == ".log" {
+		if !info.IsDir() && log.IsLogFileName(info.Name()) {
 			fileCount++
 			totalSize += info.Size()
 		}
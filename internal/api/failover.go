@@ -0,0 +1,105 @@
+package api
+
+import (
+	"NodePassDash/internal/failover"
+	"NodePassDash/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FailoverHandler 服务故障转移处理器
+type FailoverHandler struct {
+	failoverService *failover.Service
+}
+
+// NewFailoverHandler 创建服务故障转移处理器
+func NewFailoverHandler(failoverService *failover.Service) *FailoverHandler {
+	return &FailoverHandler{failoverService: failoverService}
+}
+
+// SetupFailoverRoutes 设置服务故障转移相关路由
+func SetupFailoverRoutes(rg *gin.RouterGroup, failoverService *failover.Service) {
+	failoverHandler := NewFailoverHandler(failoverService)
+
+	rg.GET("/services/:sid/failover", failoverHandler.HandleGetFailover)
+	rg.PUT("/services/:sid/failover", failoverHandler.HandleSaveFailover)
+	rg.DELETE("/services/:sid/failover", failoverHandler.HandleDeleteFailover)
+	rg.POST("/services/:sid/failover/switch", failoverHandler.HandleSwitchFailover)
+	rg.GET("/failover/events", failoverHandler.HandleListFailoverEvents)
+}
+
+// HandleGetFailover 获取服务的故障转移策略与最近切换记录
+func (h *FailoverHandler) HandleGetFailover(c *gin.Context) {
+	sid := c.Param("sid")
+
+	policy, err := h.failoverService.GetPolicy(sid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := h.failoverService.ListEvents(sid, 20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "policy": policy, "events": events})
+}
+
+// HandleSaveFailover 创建或更新服务的故障转移策略
+func (h *FailoverHandler) HandleSaveFailover(c *gin.Context) {
+	var policy models.ServiceFailoverPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	policy.Sid = c.Param("sid")
+
+	if err := h.failoverService.SavePolicy(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "故障转移策略已保存", "policy": policy})
+}
+
+// HandleDeleteFailover 删除服务的故障转移策略
+func (h *FailoverHandler) HandleDeleteFailover(c *gin.Context) {
+	if err := h.failoverService.DeletePolicy(c.Param("sid")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "故障转移策略已删除"})
+}
+
+// HandleSwitchFailover 手动将服务的 server 端切换到指定主控
+func (h *FailoverHandler) HandleSwitchFailover(c *gin.Context) {
+	var req struct {
+		EndpointID int64 `json:"endpointId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.failoverService.Switch(c.Param("sid"), req.EndpointID, models.FailoverKindManual, "手动切换"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已切换到目标主控"})
+}
+
+// HandleListFailoverEvents 获取切换记录，可按 sid 筛选
+func (h *FailoverHandler) HandleListFailoverEvents(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	events, err := h.failoverService.ListEvents(c.Query("sid"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "events": events})
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"NodePassDash/internal/auth"
+	"NodePassDash/internal/grafana"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GrafanaHandler Grafana JSON 数据源处理器
+type GrafanaHandler struct {
+	grafanaService *grafana.Service
+}
+
+// NewGrafanaHandler 创建 Grafana 数据源处理器
+func NewGrafanaHandler(grafanaService *grafana.Service) *GrafanaHandler {
+	return &GrafanaHandler{grafanaService: grafanaService}
+}
+
+// SetupGrafanaRoutes 设置 Grafana JSON 数据源路由
+// 数据源 URL 填写 <面板地址>/api/grafana，认证见 grafanaAuthMiddleware
+func SetupGrafanaRoutes(rg *gin.RouterGroup, grafanaService *grafana.Service, authService *auth.Service, token string) {
+	grafanaHandler := NewGrafanaHandler(grafanaService)
+
+	grafanaGroup := rg.Group("/grafana")
+	grafanaGroup.Use(grafanaAuthMiddleware(authService, token))
+	{
+		grafanaGroup.GET("", grafanaHandler.HandleTestConnection)
+		grafanaGroup.POST("/search", grafanaHandler.HandleSearch)
+		grafanaGroup.POST("/query", grafanaHandler.HandleQuery)
+		grafanaGroup.POST("/annotations", grafanaHandler.HandleAnnotations)
+		grafanaGroup.POST("/tag-keys", grafanaHandler.HandleTagKeys)
+		grafanaGroup.POST("/tag-values", grafanaHandler.HandleTagValues)
+	}
+}
+
+// grafanaAuthMiddleware Grafana 数据源认证
+// 登录令牌会互相踢出，因此额外支持独立的数据源令牌：
+// 可作为 Bearer 令牌或 Basic 认证密码传入；未配置或不匹配时按登录 JWT 校验
+func grafanaAuthMiddleware(authService *auth.Service, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if _, password, ok := c.Request.BasicAuth(); ok {
+			credential = password
+		}
+		if credential == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization header"})
+			c.Abort()
+			return
+		}
+
+		if token != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(token)) == 1 {
+			c.Next()
+			return
+		}
+		username, err := authService.ValidateToken(credential)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Set("username", username)
+		c.Next()
+	}
+}
+
+// HandleTestConnection 数据源连通性测试
+func (h *GrafanaHandler) HandleTestConnection(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// HandleSearch 返回可用指标列表
+func (h *GrafanaHandler) HandleSearch(c *gin.Context) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	// 请求体可为空
+	_ = c.ShouldBindJSON(&req)
+	c.JSON(http.StatusOK, h.grafanaService.Search(req.Target))
+}
+
+// HandleQuery 查询时间序列
+func (h *GrafanaHandler) HandleQuery(c *gin.Context) {
+	var req grafana.QueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	series, err := h.grafanaService.Query(req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+// HandleAnnotations 查询隧道操作与主控状态变化注释
+func (h *GrafanaHandler) HandleAnnotations(c *gin.Context) {
+	var req grafana.AnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	annotations, err := h.grafanaService.Annotations(req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, annotations)
+}
+
+// HandleTagKeys 返回 ad-hoc 过滤键
+func (h *GrafanaHandler) HandleTagKeys(c *gin.Context) {
+	keys := make([]gin.H, 0, len(grafana.TagKeys))
+	for _, key := range grafana.TagKeys {
+		keys = append(keys, gin.H{"type": "string", "text": key})
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// HandleTagValues 返回过滤键的可选值
+func (h *GrafanaHandler) HandleTagValues(c *gin.Context) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	values, err := h.grafanaService.TagValues(req.Key)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	result := make([]gin.H, 0, len(values))
+	for _, v := range values {
+		result = append(result, gin.H{"text": v})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *GrafanaHandler) writeError(c *gin.Context, err error) {
+	if errors.Is(err, grafana.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
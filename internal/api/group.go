@@ -25,6 +25,10 @@ func SetupGroupRoutes(rg *gin.RouterGroup, groupService *group.Service) {
 
 	// 分组相关路由
 	rg.GET("/groups", groupHandler.GetGroups)
+	rg.GET("/groups/tree", groupHandler.GetGroupTree)
+	rg.GET("/groups/stats", groupHandler.GetGroupStats)
+	rg.GET("/groups/:id/dashboard", groupHandler.GetGroupDashboard)
+	rg.POST("/groups/:id/actions", groupHandler.RunGroupAction)
 	rg.POST("/groups", groupHandler.CreateGroup)
 	rg.PUT("/groups/:id", groupHandler.UpdateGroup)
 	rg.DELETE("/groups/:id", groupHandler.DeleteGroup)
@@ -170,20 +174,23 @@ func (h *GroupHandler) GetTunnelGroup(c *gin.Context) {
 		return
 	}
 
-	groupObj, err := h.groupService.GetTunnelGroup(tunnelID)
-	if err != nil {
+	groups, err := h.groupService.GetTunnelGroups(tunnelID)
+	if err != nil || len(groups) == 0 {
 		// 如果没有分组，返回空
 		response := group.GroupResponse{
 			Success: true,
 			Group:   nil,
+			Groups:  []*group.Group{},
 		}
 		c.JSON(http.StatusOK, response)
 		return
 	}
 
+	// group 保留第一个分组以兼容单分组调用方，groups 为全部分组
 	response := group.GroupResponse{
 		Success: true,
-		Group:   groupObj,
+		Group:   groups[0],
+		Groups:  groups,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -230,3 +237,79 @@ func (h *GroupHandler) BatchAssignTunnelsToGroup(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, response)
 }
+
+// GetGroupTree 获取分组树
+func (h *GroupHandler) GetGroupTree(c *gin.Context) {
+	tree, err := h.groupService.GetGroupTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := group.GroupResponse{
+		Success: true,
+		Groups:  tree,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetGroupStats 获取全部分组的统计（包含子分组中的隧道）
+func (h *GroupHandler) GetGroupStats(c *gin.Context) {
+	stats, err := h.groupService.GetAllGroupStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"stats":   stats,
+	})
+}
+
+// GetGroupDashboard 获取单个分组的仪表盘数据 (GET /api/groups/{id}/dashboard)
+func (h *GroupHandler) GetGroupDashboard(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分组ID"})
+		return
+	}
+
+	dashboard, err := h.groupService.GetGroupDashboard(groupID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"dashboard": dashboard,
+	})
+}
+
+// RunGroupAction 对分组内全部隧道执行启动/停止/重启 (POST /api/groups/{id}/actions)
+func (h *GroupHandler) RunGroupAction(c *gin.Context) {
+	groupID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分组ID"})
+		return
+	}
+
+	var req group.GroupActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	result, err := h.groupService.RunGroupAction(groupID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": result.FailCount == 0,
+		"result":  result,
+	})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"NodePassDash/internal/healing"
+	"NodePassDash/internal/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealingHandler 隧道自愈处理器
+type HealingHandler struct {
+	healingService *healing.Service
+}
+
+// NewHealingHandler 创建隧道自愈处理器
+func NewHealingHandler(healingService *healing.Service) *HealingHandler {
+	return &HealingHandler{healingService: healingService}
+}
+
+// SetupHealingRoutes 设置隧道自愈相关路由
+func SetupHealingRoutes(rg *gin.RouterGroup, healingService *healing.Service) {
+	healingHandler := NewHealingHandler(healingService)
+
+	rg.GET("/healing/policies", healingHandler.HandleListPolicies)
+	rg.PUT("/healing/policies", healingHandler.HandleSavePolicy)
+	rg.DELETE("/healing/policies/:id", healingHandler.HandleDeletePolicy)
+	rg.GET("/healing/states", healingHandler.HandleListStates)
+	rg.GET("/tunnels/:id/healing", healingHandler.HandleGetTunnelHealing)
+	rg.POST("/tunnels/:id/healing/reset", healingHandler.HandleResetTunnelHealing)
+}
+
+// HandleListPolicies 获取全部自愈策略
+func (h *HealingHandler) HandleListPolicies(c *gin.Context) {
+	policies, err := h.healingService.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "policies": policies})
+}
+
+// HandleSavePolicy 创建或更新自愈策略（按 scope + targetId 唯一）
+func (h *HealingHandler) HandleSavePolicy(c *gin.Context) {
+	var policy models.HealingPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.healingService.SavePolicy(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "自愈策略已保存", "policy": policy})
+}
+
+// HandleDeletePolicy 删除自愈策略
+func (h *HealingHandler) HandleDeletePolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return
+	}
+
+	if err := h.healingService.DeletePolicy(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "自愈策略已删除"})
+}
+
+// HandleListStates 获取隧道自愈状态列表，可按 state 筛选（如 gave_up）
+func (h *HealingHandler) HandleListStates(c *gin.Context) {
+	states, err := h.healingService.ListStates(c.Query("state"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "states": states})
+}
+
+// HandleGetTunnelHealing 获取单个隧道的自愈状态、生效策略与最近尝试记录
+func (h *HealingHandler) HandleGetTunnelHealing(c *gin.Context) {
+	tunnelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隧道ID"})
+		return
+	}
+
+	limit := 20
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+
+	state, policy, attempts, err := h.healingService.GetTunnelHealing(tunnelID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"state":    state,
+		"policy":   policy,
+		"attempts": attempts,
+	})
+}
+
+// HandleResetTunnelHealing 清除隧道自愈状态，允许重新开始计数
+func (h *HealingHandler) HandleResetTunnelHealing(c *gin.Context) {
+	tunnelID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的隧道ID"})
+		return
+	}
+
+	if err := h.healingService.Reset(tunnelID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "自愈状态已重置"})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"NodePassDash/internal/rollup"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HistoryRollupHandler 历史数据降采样处理器
+type HistoryRollupHandler struct {
+	rollupService *rollup.Service
+}
+
+// NewHistoryRollupHandler 创建历史数据降采样处理器
+func NewHistoryRollupHandler(rollupService *rollup.Service) *HistoryRollupHandler {
+	return &HistoryRollupHandler{rollupService: rollupService}
+}
+
+// SetupHistoryRollupRoutes 设置历史数据降采样相关路由
+func SetupHistoryRollupRoutes(rg *gin.RouterGroup, rollupService *rollup.Service) {
+	historyRollupHandler := NewHistoryRollupHandler(rollupService)
+
+	rg.GET("/history-rollup/config", historyRollupHandler.HandleGetConfig)
+	rg.PUT("/history-rollup/config", historyRollupHandler.HandleUpdateConfig)
+	rg.POST("/history-rollup/run", historyRollupHandler.HandleRun)
+}
+
+// HandleGetConfig 获取降采样配置
+func (h *HistoryRollupHandler) HandleGetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":          true,
+		"config":           h.rollupService.Config(),
+		"rawRetentionDays": int(rollup.RawRetention.Hours() / 24),
+	})
+}
+
+// HandleUpdateConfig 更新各层级保留天数
+func (h *HistoryRollupHandler) HandleUpdateConfig(c *gin.Context) {
+	cfg := h.rollupService.Config()
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.rollupService.SetConfig(cfg); err != nil {
+		if errors.Is(err, rollup.ErrInvalidConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "降采样配置已更新", "config": cfg})
+}
+
+// HandleRun 立即执行一次降采样与过期清理
+func (h *HistoryRollupHandler) HandleRun(c *gin.Context) {
+	if err := h.rollupService.RunOnce(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "降采样已完成"})
+}
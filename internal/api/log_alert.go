@@ -0,0 +1,161 @@
+package api
+
+import (
+	"NodePassDash/internal/logalert"
+	"NodePassDash/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LogAlertHandler 日志告警处理器
+type LogAlertHandler struct {
+	logAlertService *logalert.Service
+}
+
+// NewLogAlertHandler 创建日志告警处理器
+func NewLogAlertHandler(logAlertService *logalert.Service) *LogAlertHandler {
+	return &LogAlertHandler{logAlertService: logAlertService}
+}
+
+// SetupLogAlertRoutes 设置日志告警相关路由
+func SetupLogAlertRoutes(rg *gin.RouterGroup, logAlertService *logalert.Service) {
+	logAlertHandler := NewLogAlertHandler(logAlertService)
+
+	rg.GET("/log-alerts/rules", logAlertHandler.HandleListRules)
+	rg.POST("/log-alerts/rules", logAlertHandler.HandleCreateRule)
+	rg.PUT("/log-alerts/rules/:id", logAlertHandler.HandleUpdateRule)
+	rg.DELETE("/log-alerts/rules/:id", logAlertHandler.HandleDeleteRule)
+	rg.GET("/log-alerts", logAlertHandler.HandleListAlerts)
+	rg.POST("/log-alerts/ack", logAlertHandler.HandleAcknowledgeAlerts)
+	rg.POST("/log-alerts/:id/ack", logAlertHandler.HandleAcknowledgeAlert)
+}
+
+// HandleListRules 获取全部日志告警规则
+func (h *LogAlertHandler) HandleListRules(c *gin.Context) {
+	rules, err := h.logAlertService.ListRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "rules": rules})
+}
+
+// HandleCreateRule 创建日志告警规则
+func (h *LogAlertHandler) HandleCreateRule(c *gin.Context) {
+	var rule models.LogAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.logAlertService.CreateRule(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "告警规则已创建", "rule": rule})
+}
+
+// HandleUpdateRule 更新日志告警规则
+func (h *LogAlertHandler) HandleUpdateRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的规则ID"})
+		return
+	}
+	var rule models.LogAlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	rule.ID = id
+
+	if err := h.logAlertService.UpdateRule(&rule); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "告警规则不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "告警规则已更新", "rule": rule})
+}
+
+// HandleDeleteRule 删除日志告警规则
+func (h *LogAlertHandler) HandleDeleteRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的规则ID"})
+		return
+	}
+
+	if err := h.logAlertService.DeleteRule(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "告警规则不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "告警规则已删除"})
+}
+
+// HandleListAlerts 分页查询告警记录，可按 ruleId、tunnelId、endpointId、acknowledged 筛选
+func (h *LogAlertHandler) HandleListAlerts(c *gin.Context) {
+	filter := logalert.AlertFilter{}
+	filter.RuleID, _ = strconv.ParseInt(c.Query("ruleId"), 10, 64)
+	filter.TunnelID, _ = strconv.ParseInt(c.Query("tunnelId"), 10, 64)
+	filter.EndpointID, _ = strconv.ParseInt(c.Query("endpointId"), 10, 64)
+	filter.Page, _ = strconv.Atoi(c.Query("page"))
+	filter.PageSize, _ = strconv.Atoi(c.Query("pageSize"))
+	if v := c.Query("acknowledged"); v != "" {
+		ack := v == "true"
+		filter.Acknowledged = &ack
+	}
+
+	alerts, total, err := h.logAlertService.ListAlerts(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "alerts": alerts, "total": total})
+}
+
+// HandleAcknowledgeAlert 确认单条告警
+func (h *LogAlertHandler) HandleAcknowledgeAlert(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
+		return
+	}
+
+	count, err := h.logAlertService.Acknowledge([]int64{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "acknowledged": count})
+}
+
+// HandleAcknowledgeAlerts 批量确认告警，ids 为空时确认全部未确认告警
+func (h *LogAlertHandler) HandleAcknowledgeAlerts(c *gin.Context) {
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+			return
+		}
+	}
+
+	count, err := h.logAlertService.Acknowledge(req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "acknowledged": count})
+}
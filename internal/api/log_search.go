@@ -0,0 +1,189 @@
+package api
+
+import (
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/sse"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogSearchHandler 文件日志检索处理器
+type LogSearchHandler struct {
+	sseManager *sse.Manager
+}
+
+// NewLogSearchHandler 创建文件日志检索处理器
+func NewLogSearchHandler(sseManager *sse.Manager) *LogSearchHandler {
+	return &LogSearchHandler{sseManager: sseManager}
+}
+
+// SetupLogSearchRoutes 设置文件日志检索相关路由
+func SetupLogSearchRoutes(rg *gin.RouterGroup, sseManager *sse.Manager) {
+	logSearchHandler := NewLogSearchHandler(sseManager)
+
+	rg.GET("/logs/search", logSearchHandler.HandleSearchLogs)
+	rg.GET("/logs/search/stream", logSearchHandler.HandleStreamSearchLogs)
+}
+
+// parseLogSearchQuery 解析检索参数:
+// q, regex, caseSensitive, level(逗号分隔), endpointId(逗号分隔), instanceId(逗号分隔),
+// start, end(YYYY-MM-DD), page(从 1 开始), size, context
+func parseLogSearchQuery(c *gin.Context) (log.SearchQuery, error) {
+	q := log.SearchQuery{
+		Text:          c.Query("q"),
+		Regex:         c.Query("regex") == "true",
+		CaseSensitive: c.Query("caseSensitive") == "true",
+	}
+
+	splitList := func(v string) []string {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	q.Levels = splitList(c.Query("level"))
+	q.InstanceIDs = splitList(c.Query("instanceId"))
+	for _, v := range splitList(c.Query("endpointId")) {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("无效的端点ID: %s", v)
+		}
+		q.EndpointIDs = append(q.EndpointIDs, id)
+	}
+
+	for _, p := range []struct {
+		name   string
+		target *time.Time
+	}{{"start", &q.From}, {"end", &q.To}} {
+		if v := c.Query(p.name); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("%s 日期格式应为 YYYY-MM-DD", p.name)
+			}
+			*p.target = t
+		}
+	}
+
+	intParam := func(name string, def int) (int, error) {
+		v := c.Query(name)
+		if v == "" {
+			return def, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的 %s 参数", name)
+		}
+		return n, nil
+	}
+	var err error
+	if q.Context, err = intParam("context", 0); err != nil {
+		return q, err
+	}
+	if q.Limit, err = intParam("size", 50); err != nil {
+		return q, err
+	}
+	page, err := intParam("page", 1)
+	if err != nil {
+		return q, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	q.Offset = (page - 1) * q.Limit
+	return q, nil
+}
+
+// fileLogger 获取文件日志管理器
+func (h *LogSearchHandler) fileLogger() *log.FileLogger {
+	if h.sseManager == nil {
+		return nil
+	}
+	return h.sseManager.GetFileLogger()
+}
+
+// HandleSearchLogs 分页检索文件日志 (GET /api/logs/search)
+func (h *LogSearchHandler) HandleSearchLogs(c *gin.Context) {
+	fileLogger := h.fileLogger()
+	if fileLogger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "文件日志管理器未初始化"})
+		return
+	}
+
+	q, err := parseLogSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	searchLogs(c, fileLogger, q)
+}
+
+// searchLogs 执行分页检索并返回结果
+func searchLogs(c *gin.Context, fileLogger *log.FileLogger, q log.SearchQuery) {
+	result, err := fileLogger.Search(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// HandleStreamSearchLogs 流式检索文件日志 (GET /api/logs/search/stream)
+// 以 NDJSON 逐行返回命中，最后一行为 {"done":true,"count":N}；size 为最大返回数，0 表示不限
+func (h *LogSearchHandler) HandleStreamSearchLogs(c *gin.Context) {
+	fileLogger := h.fileLogger()
+	if fileLogger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "文件日志管理器未初始化"})
+		return
+	}
+
+	q, err := parseLogSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("size") == "" {
+		q.Limit = 0
+	}
+	q.Offset = 0
+
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	count, err := fileLogger.SearchStream(q, func(hit log.SearchHit) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := enc.Encode(hit); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	if errors.Is(err, ctx.Err()) && ctx.Err() != nil {
+		return // 客户端已断开
+	}
+	tail := gin.H{"done": true, "count": count}
+	if err != nil {
+		tail["error"] = err.Error()
+	}
+	enc.Encode(tail)
+	c.Writer.Flush()
+}
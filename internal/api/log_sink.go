@@ -0,0 +1,109 @@
+package api
+
+import (
+	"NodePassDash/internal/logsink"
+	"NodePassDash/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LogSinkHandler 日志外发处理器
+type LogSinkHandler struct {
+	logSinkService *logsink.Service
+}
+
+// NewLogSinkHandler 创建日志外发处理器
+func NewLogSinkHandler(logSinkService *logsink.Service) *LogSinkHandler {
+	return &LogSinkHandler{logSinkService: logSinkService}
+}
+
+// SetupLogSinkRoutes 设置日志外发相关路由
+func SetupLogSinkRoutes(rg *gin.RouterGroup, logSinkService *logsink.Service) {
+	logSinkHandler := NewLogSinkHandler(logSinkService)
+
+	rg.GET("/log-sinks", logSinkHandler.HandleListSinks)
+	rg.GET("/log-sinks/stats", logSinkHandler.HandleSinkStats)
+	rg.POST("/log-sinks", logSinkHandler.HandleCreateSink)
+	rg.PUT("/log-sinks/:id", logSinkHandler.HandleUpdateSink)
+	rg.DELETE("/log-sinks/:id", logSinkHandler.HandleDeleteSink)
+}
+
+// HandleListSinks 获取全部外发目标及推送统计
+func (h *LogSinkHandler) HandleListSinks(c *gin.Context) {
+	sinks, err := h.logSinkService.ListSinks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "sinks": sinks})
+}
+
+// HandleSinkStats 获取运行中外发目标的推送统计
+func (h *LogSinkHandler) HandleSinkStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "stats": h.logSinkService.Stats()})
+}
+
+// HandleCreateSink 创建外发目标
+func (h *LogSinkHandler) HandleCreateSink(c *gin.Context) {
+	var sink models.LogSink
+	if err := c.ShouldBindJSON(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.logSinkService.CreateSink(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sink.Headers = logsink.MaskHeaders(sink.Headers)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "日志外发目标已创建", "sink": sink})
+}
+
+// HandleUpdateSink 更新外发目标
+func (h *LogSinkHandler) HandleUpdateSink(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的外发目标ID"})
+		return
+	}
+	var sink models.LogSink
+	if err := c.ShouldBindJSON(&sink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	sink.ID = id
+
+	if err := h.logSinkService.UpdateSink(&sink); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "日志外发目标不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sink.Headers = logsink.MaskHeaders(sink.Headers)
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "日志外发目标已更新", "sink": sink})
+}
+
+// HandleDeleteSink 删除外发目标
+func (h *LogSinkHandler) HandleDeleteSink(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的外发目标ID"})
+		return
+	}
+
+	if err := h.logSinkService.DeleteSink(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "日志外发目标不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "日志外发目标已删除"})
+}
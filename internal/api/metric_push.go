@@ -0,0 +1,153 @@
+package api
+
+import (
+	"NodePassDash/internal/metricpush"
+	"NodePassDash/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MetricPushHandler 指标推送处理器
+type MetricPushHandler struct {
+	metricPushService *metricpush.Service
+}
+
+// NewMetricPushHandler 创建指标推送处理器
+func NewMetricPushHandler(metricPushService *metricpush.Service) *MetricPushHandler {
+	return &MetricPushHandler{metricPushService: metricPushService}
+}
+
+// SetupMetricPushRoutes 设置指标推送相关路由
+func SetupMetricPushRoutes(rg *gin.RouterGroup, metricPushService *metricpush.Service) {
+	metricPushHandler := NewMetricPushHandler(metricPushService)
+
+	rg.GET("/metric-push/targets", metricPushHandler.HandleListTargets)
+	rg.GET("/metric-push/stats", metricPushHandler.HandleTargetStats)
+	rg.POST("/metric-push/targets", metricPushHandler.HandleCreateTarget)
+	rg.PUT("/metric-push/targets/:id", metricPushHandler.HandleUpdateTarget)
+	rg.DELETE("/metric-push/targets/:id", metricPushHandler.HandleDeleteTarget)
+	rg.POST("/metric-push/targets/:id/test", metricPushHandler.HandleTestTarget)
+	rg.POST("/metric-push/test", metricPushHandler.HandleTestSend)
+}
+
+// HandleListTargets 获取全部推送目标及运行统计
+func (h *MetricPushHandler) HandleListTargets(c *gin.Context) {
+	targets, err := h.metricPushService.ListTargets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "targets": targets})
+}
+
+// HandleTargetStats 获取运行中推送目标的统计
+func (h *MetricPushHandler) HandleTargetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "stats": h.metricPushService.Stats()})
+}
+
+// HandleCreateTarget 创建推送目标
+func (h *MetricPushHandler) HandleCreateTarget(c *gin.Context) {
+	var target models.MetricPushTarget
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.metricPushService.CreateTarget(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "指标推送目标已创建", "target": target})
+}
+
+// HandleUpdateTarget 更新推送目标
+func (h *MetricPushHandler) HandleUpdateTarget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的推送目标ID"})
+		return
+	}
+	var target models.MetricPushTarget
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	target.ID = id
+
+	if err := h.metricPushService.UpdateTarget(&target); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指标推送目标不存在"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "指标推送目标已更新", "target": target})
+}
+
+// HandleDeleteTarget 删除推送目标
+func (h *MetricPushHandler) HandleDeleteTarget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的推送目标ID"})
+		return
+	}
+
+	if err := h.metricPushService.DeleteTarget(id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指标推送目标不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "指标推送目标已删除"})
+}
+
+// HandleTestTarget 对已保存的推送目标发送测试推送
+func (h *MetricPushHandler) HandleTestTarget(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的推送目标ID"})
+		return
+	}
+
+	points, err := h.metricPushService.TestTarget(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "指标推送目标不存在"})
+			return
+		}
+		if errors.Is(err, metricpush.ErrInvalidTarget) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "测试推送成功", "points": points})
+}
+
+// HandleTestSend 使用请求中的配置发送测试推送，不保存配置
+func (h *MetricPushHandler) HandleTestSend(c *gin.Context) {
+	var target models.MetricPushTarget
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	points, err := h.metricPushService.TestSend(&target)
+	if err != nil {
+		if errors.Is(err, metricpush.ErrInvalidTarget) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "测试推送成功", "points": points})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"NodePassDash/internal/exporter"
+	log "NodePassDash/internal/log"
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsExporterHandler Prometheus 指标处理器
+type MetricsExporterHandler struct {
+	exporter *exporter.Exporter
+	token    string
+}
+
+// NewMetricsExporterHandler 创建指标处理器，token 为空时不校验（仅用于回环地址上的独立监听）
+func NewMetricsExporterHandler(exporter *exporter.Exporter, token string) *MetricsExporterHandler {
+	return &MetricsExporterHandler{exporter: exporter, token: token}
+}
+
+// SetupMetricsExporterRoutes 设置 /metrics 路由
+func SetupMetricsExporterRoutes(r gin.IRoutes, exporter *exporter.Exporter, token string) {
+	metricsHandler := NewMetricsExporterHandler(exporter, token)
+
+	r.GET("/metrics", metricsHandler.HandleMetrics)
+}
+
+// CheckMetricsListen 校验独立指标监听地址：未设置令牌时只允许绑定回环地址，
+// 否则 /metrics 会在未认证的情况下暴露到外部网络
+func CheckMetricsListen(addr, token string) error {
+	if addr == "" || token != "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("无效的指标监听地址 %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("指标监听地址 %s 不是回环地址，必须同时设置 --metrics-token", addr)
+}
+
+// HandleMetrics 输出 Prometheus 文本格式指标
+// 令牌可通过 Authorization: Bearer <token> 或 ?token= 传入
+func (h *MetricsExporterHandler) HandleMetrics(c *gin.Context) {
+	if h.token != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = c.Query("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的指标访问令牌"})
+			return
+		}
+	}
+
+	// 先完整渲染到缓冲区，避免输出中途出错时已经写出 200 状态码
+	var buf bytes.Buffer
+	if err := h.exporter.Write(&buf); err != nil {
+		log.Errorf("[Exporter]输出指标失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,23 @@
+package api
+
+import "testing"
+
+func TestCheckMetricsListen(t *testing.T) {
+	for _, c := range []struct {
+		addr, token string
+		ok          bool
+	}{
+		{"", "", true},
+		{"127.0.0.1:9100", "", true},
+		{"[::1]:9100", "", true},
+		{"localhost:9100", "", true},
+		{"0.0.0.0:9100", "secret", true},
+		{"0.0.0.0:9100", "", false},
+		{":9100", "", false},
+		{"10.0.0.5:9100", "", false},
+	} {
+		if err := CheckMetricsListen(c.addr, c.token); (err == nil) != c.ok {
+			t.Errorf("CheckMetricsListen(%q, %q) = %v, want ok=%v", c.addr, c.token, err, c.ok)
+		}
+	}
+}
@@ -3,9 +3,12 @@ package api
 import (
 	"NodePassDash/internal/services"
 	"NodePassDash/internal/tunnel"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ServicesHandler 服务处理器
@@ -34,6 +37,8 @@ func SetupServicesRoutes(rg *gin.RouterGroup, servicesService *services.ServiceI
 	rg.GET("/services/available-instances", servicesHandler.GetAvailableInstances)
 	rg.POST("/services/assemble", servicesHandler.AssembleService)
 	rg.POST("/services/sorts", servicesHandler.UpdateServicesSorts)
+	rg.GET("/services/health-config", servicesHandler.GetHealthConfig)
+	rg.PUT("/services/health-config", servicesHandler.UpdateHealthConfig)
 
 	// 服务操作路由
 	rg.POST("/services/:sid/start", servicesHandler.StartService)
@@ -43,11 +48,17 @@ func SetupServicesRoutes(rg *gin.RouterGroup, servicesService *services.ServiceI
 	rg.PUT("/services/:sid/rename", servicesHandler.RenameService)
 	rg.POST("/services/:sid/dissolve", servicesHandler.DissolveService)
 	rg.POST("/services/:sid/sync", servicesHandler.SyncService)
+	rg.POST("/services/:sid/clone", servicesHandler.CloneService)
+	rg.GET("/services/:sid/hops", servicesHandler.GetServiceHops)
+	rg.POST("/services/:sid/staged-update", servicesHandler.StartStagedUpdate)
+	rg.GET("/services/:sid/trend", servicesHandler.GetServiceTrend)
+	rg.GET("/services/:sid/health", servicesHandler.GetServiceHealth)
+	rg.GET("/services/:sid/staged-update", servicesHandler.GetStagedUpdate)
 }
 
 // GetServices 获取所有服务
 func (h *ServicesHandler) GetServices(c *gin.Context) {
-	serviceList, err := h.servicesService.GetServices()
+	serviceList, err := h.servicesService.GetServicesWithHealth()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -226,6 +237,175 @@ func (h *ServicesHandler) SyncService(c *gin.Context) {
 	})
 }
 
+// CloneService 克隆服务到其他主控，新服务使用新的 SID
+func (h *ServicesHandler) CloneService(c *gin.Context) {
+	sid := c.Param("sid")
+
+	var req services.CloneServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters: " + err.Error()})
+		return
+	}
+
+	results, err := h.servicesService.CloneService(sid, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to clone service: " + err.Error()})
+		return
+	}
+
+	successCount := 0
+	for _, r := range results {
+		if r.Success {
+			successCount++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":      successCount > 0,
+		"successCount": successCount,
+		"failCount":    len(results) - successCount,
+		"results":      results,
+	})
+}
+
+// GetServiceHops 获取多跳链路服务每一跳的健康状态
+func (h *ServicesHandler) GetServiceHops(c *gin.Context) {
+	sid := c.Param("sid")
+
+	hops, err := h.servicesService.GetChainHops(sid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to get service hops: " + err.Error()})
+		return
+	}
+
+	healthy := true
+	for _, hop := range hops {
+		if !hop.Healthy {
+			healthy = false
+			break
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"healthy": healthy,
+		"hops":    hops,
+	})
+}
+
+// StartStagedUpdate 启动服务的分阶段（蓝绿）更新
+func (h *ServicesHandler) StartStagedUpdate(c *gin.Context) {
+	sid := c.Param("sid")
+
+	var req services.StagedUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters: " + err.Error()})
+		return
+	}
+
+	job, err := h.servicesService.StartStagedUpdate(sid, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to start staged update: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// GetStagedUpdate 获取服务最近一次分阶段更新的进度
+func (h *ServicesHandler) GetStagedUpdate(c *gin.Context) {
+	job := h.servicesService.GetStagedUpdate(c.Param("sid"))
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No staged update for this service"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"job":     job,
+	})
+}
+
+// GetServiceTrend 获取服务流量趋势（聚合全部成员实例），hours 默认 24，最多 168
+func (h *ServicesHandler) GetServiceTrend(c *gin.Context) {
+	sid := c.Param("sid")
+
+	hours := 24
+	if v := c.Query("hours"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 || parsed > 168 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be between 1 and 168"})
+			return
+		}
+		hours = parsed
+	}
+
+	trend, err := h.servicesService.GetServiceTrend(sid, hours)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service trend: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"trend":   trend,
+	})
+}
+
+// GetServiceHealth 获取服务综合健康状态
+func (h *ServicesHandler) GetServiceHealth(c *gin.Context) {
+	sid := c.Param("sid")
+
+	health, err := h.servicesService.GetServiceHealth(sid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get service health: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"health":  health,
+	})
+}
+
+// GetHealthConfig 获取服务健康判定配置
+func (h *ServicesHandler) GetHealthConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"config":  h.servicesService.HealthConfig(),
+	})
+}
+
+// UpdateHealthConfig 更新服务健康判定配置
+func (h *ServicesHandler) UpdateHealthConfig(c *gin.Context) {
+	var cfg services.HealthConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters: " + err.Error()})
+		return
+	}
+	if err := h.servicesService.SetHealthConfig(cfg); err != nil {
+		if errors.Is(err, services.ErrInvalidHealthConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health config: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"config":  cfg,
+	})
+}
+
 // UpdateServicesSorts 批量更新服务排序
 func (h *ServicesHandler) UpdateServicesSorts(c *gin.Context) {
 	var req services.UpdateServicesSortsRequest
@@ -4,9 +4,10 @@ import (
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/services"
 	"database/sql"
+	"errors"
 	"fmt"
-	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -33,11 +34,15 @@ type ServiceCreateRequest struct {
 	CertPath            string          `json:"cert_path,omitempty"`
 	KeyPath             string          `json:"key_path,omitempty"`
 	TunnelName          string          `json:"tunnel_name,omitempty"`
-	ServiceType         int             `json:"service_type"`          // 服务类型 0-7
+	ServiceType         int             `json:"service_type"`          // 服务类型 0-8
 	ListenType          string          `json:"listen_type,omitempty"` // 监听类型 TCP/UDP/ALL
 	ExtendTargetAddress []string        `json:"extend_target_address"` // 扩展目标地址（负载均衡）
 	Inbounds            *EndpointConfig `json:"inbounds,omitempty"`
 	Outbounds           *EndpointConfig `json:"outbounds,omitempty"`
+	Chain               []int64         `json:"chain,omitempty"`       // 多跳链路按顺序排列的主控ID
+	TunnelPort          int             `json:"tunnel_port,omitempty"` // 多跳链路各跳 server 端隧道端口
+	RelayPort           int             `json:"relay_port,omitempty"`  // 多跳链路中间主控的本地中转端口
+	Password            string          `json:"password,omitempty"`    // 多跳链路共用密码，为空时自动生成
 }
 
 // CreateService 处理服务创建请求（对接 service-create-modal.tsx）
@@ -61,6 +66,8 @@ func (h *ServicesHandler) CreateService(c *gin.Context) {
 		h.handleBothwayMode(c, &req)
 	case "intranet":
 		h.handleIntranetMode(c, &req)
+	case "chain":
+		h.handleChainMode(c, &req)
 	default:
 		c.JSON(400, gin.H{
 			"success": false,
@@ -103,44 +110,26 @@ func (h *ServicesHandler) handleSingleMode(c *gin.Context, req *ServiceCreateReq
 	}
 
 	// 构建单端转发的URL，支持listen_host
-	var listenAddr string
-	if req.ListenHost != "" {
-		listenAddr = fmt.Sprintf("%s:%d", req.ListenHost, req.ListenPort)
-	} else {
-		listenAddr = fmt.Sprintf(":%d", req.ListenPort)
+	tunnelURL, errs := buildServiceURL(nodepass.TunnelConfig{
+		Type:                  "client",
+		TunnelAddress:         req.ListenHost,
+		TunnelPort:            strconv.Itoa(req.ListenPort),
+		TargetAddress:         req.Inbounds.TargetHost,
+		TargetPort:            strconv.Itoa(req.Inbounds.TargetPort),
+		ExtendTargetAddresses: req.ExtendTargetAddress,
+		ListenType:            req.ListenType,
+		LogLevel:              req.Log,
+		Mode:                  "1",
+	})
+	if errs != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   errs.Error(),
+			"errors":  errs,
+		})
+		return
 	}
 
-	tunnelURL := fmt.Sprintf("client://%s/%s:%d",
-		listenAddr,
-		req.Inbounds.TargetHost,
-		req.Inbounds.TargetPort,
-	)
-
-	// 添加扩展地址（逗号分隔）
-	if req.ExtendTargetAddress != nil && len(req.ExtendTargetAddress) > 0 {
-		for _, addr := range req.ExtendTargetAddress {
-			tunnelURL += "," + addr
-		}
-	}
-	tunnelURL += fmt.Sprintf("?log=%s&mode=1", req.Log)
-	// 根据listenType生成notcp和noudp参数
-	if req.ListenType != "" {
-		switch req.ListenType {
-		case "TCP":
-			tunnelURL += "&notcp=0"
-			tunnelURL += "&noudp=1"
-		case "UDP":
-			tunnelURL += "&notcp=1"
-			tunnelURL += "&noudp=0"
-		case "ALL":
-			tunnelURL += "&notcp=0"
-			tunnelURL += "&noudp=0"
-		}
-	}
-	// 添加扩展目标地址（负载均衡）
-	if len(req.ExtendTargetAddress) > 0 {
-		tunnelURL += "&extend_target_address=" + url.QueryEscape(strings.Join(req.ExtendTargetAddress, ","))
-	}
 	// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
 	var tunnelName string
 	if req.TunnelName != "" {
@@ -288,59 +277,48 @@ func (h *ServicesHandler) handleBothwayMode(c *gin.Context, req *ServiceCreateRe
 		}
 	}
 
-	// 双端转发：server端监听listen_port，转发到outbounds的target
-	serverURL := fmt.Sprintf("server://:%d/%s:%d",
-		req.ListenPort,
-		serverConfig.TargetHost,
-		serverConfig.TargetPort,
-	)
-	// 添加扩展地址（逗号分隔）
-	if req.ExtendTargetAddress != nil && len(req.ExtendTargetAddress) > 0 {
-		for _, addr := range req.ExtendTargetAddress {
-			serverURL += "," + addr
-		}
-	}
-	if req.TLS > 0 {
-		serverURL += fmt.Sprintf("?tls=%d&log=%s&mode=2", req.TLS, req.Log)
-		// 如果是TLS 2且提供了证书路径，添加证书参数
-		if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-			serverURL += fmt.Sprintf("&cert=%s&key=%s", url.QueryEscape(req.CertPath), url.QueryEscape(req.KeyPath))
-		}
-	} else {
-		serverURL += fmt.Sprintf("?log=%s&&mode=2", req.Log)
+	// 双端转发：server端监听listen_port，转发到outbounds的target，扩展地址用于负载均衡
+	serverURL, errs := buildServiceURL(nodepass.TunnelConfig{
+		Type:                  "server",
+		TunnelPort:            strconv.Itoa(req.ListenPort),
+		TargetAddress:         serverConfig.TargetHost,
+		TargetPort:            strconv.Itoa(serverConfig.TargetPort),
+		ExtendTargetAddresses: req.ExtendTargetAddress,
+		ListenType:            req.ListenType,
+		LogLevel:              req.Log,
+		TLSMode:               tlsParam(req.TLS),
+		CertPath:              req.CertPath,
+		KeyPath:               req.KeyPath,
+		Mode:                  "2",
+	})
+	if errs != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "server端" + errs.Error(),
+			"errors":  errs,
+		})
+		return
 	}
 	// 双端转发：client端连接到server的IP:listen_port，转发到inbounds的target
-	clientURL := fmt.Sprintf("client://%s:%d/%s:%d?log=%s&mode=2",
-		serverIP,
-		req.ListenPort,
-		clientConfig.TargetHost,
-		clientConfig.TargetPort,
-		req.Log,
-	)
-	// 根据listenType生成notcp和noudp参数
-	if req.ListenType != "" {
-		switch req.ListenType {
-		case "TCP":
-			serverURL += "&notcp=0"
-			serverURL += "&noudp=1"
-			clientURL += "&notcp=0"
-			clientURL += "&noudp=1"
-		case "UDP":
-			serverURL += "&notcp=1"
-			serverURL += "&noudp=0"
-			clientURL += "&notcp=1"
-			clientURL += "&noudp=0"
-		case "ALL":
-			serverURL += "&notcp=0"
-			serverURL += "&noudp=0"
-			clientURL += "&notcp=0"
-			clientURL += "&noudp=0"
-		}
-	}
-	// 添加扩展目标地址（负载均衡）到server端URL
-	if len(req.ExtendTargetAddress) > 0 {
-		serverURL += "&extend_target_address=" + url.QueryEscape(strings.Join(req.ExtendTargetAddress, ","))
+	clientURL, errs := buildServiceURL(nodepass.TunnelConfig{
+		Type:          "client",
+		TunnelAddress: serverIP,
+		TunnelPort:    strconv.Itoa(req.ListenPort),
+		TargetAddress: clientConfig.TargetHost,
+		TargetPort:    strconv.Itoa(clientConfig.TargetPort),
+		ListenType:    req.ListenType,
+		LogLevel:      req.Log,
+		Mode:          "2",
+	})
+	if errs != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "client端" + errs.Error(),
+			"errors":  errs,
+		})
+		return
 	}
+
 	// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
 	var serverTunnelName, clientTunnelName string
 	if req.TunnelName != "" {
@@ -526,59 +504,45 @@ func (h *ServicesHandler) handleIntranetMode(c *gin.Context, req *ServiceCreateR
 	}
 
 	// 内网穿透：server端监听listen_port，目标是用户要访问的地址
-	serverURL := fmt.Sprintf("server://:%d/%s:%d",
-		req.ListenPort,
-		serverConfig.TargetHost,
-		serverConfig.TargetPort,
-	)
-	if req.TLS > 0 {
-		serverURL += fmt.Sprintf("?tls=%d&log=%s&mode=1", req.TLS, req.Log)
-		// 如果是TLS 2且提供了证书路径，添加证书参数
-		if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-			serverURL += fmt.Sprintf("&cert=%s&key=%s", url.QueryEscape(req.CertPath), url.QueryEscape(req.KeyPath))
-		}
-	} else {
-		serverURL += fmt.Sprintf("?log=%s&mode=1", req.Log)
-	}
-
-	// 内网穿透：client端连接到server的IP:listen_port，转发到最终目标
-	clientURL := fmt.Sprintf("client://%s:%d/%s:%d",
-		serverIP,
-		req.ListenPort,
-		clientConfig.TargetHost,
-		clientConfig.TargetPort,
-	)
-	// 添加扩展地址（逗号分隔）
-	if req.ExtendTargetAddress != nil && len(req.ExtendTargetAddress) > 0 {
-		for _, addr := range req.ExtendTargetAddress {
-			clientURL += "," + addr
-		}
-	}
-	clientURL += fmt.Sprintf("?log=%s&mode=2", req.Log)
-
-	// 根据listenType生成notcp和noudp参数
-	if req.ListenType != "" {
-		switch req.ListenType {
-		case "TCP":
-			serverURL += "&notcp=0"
-			serverURL += "&noudp=1"
-			clientURL += "&notcp=0"
-			clientURL += "&noudp=1"
-		case "UDP":
-			serverURL += "&notcp=1"
-			serverURL += "&noudp=0"
-			clientURL += "&notcp=1"
-			clientURL += "&noudp=0"
-		case "ALL":
-			serverURL += "&notcp=0"
-			serverURL += "&noudp=0"
-			clientURL += "&notcp=0"
-			clientURL += "&noudp=0"
-		}
+	serverURL, errs := buildServiceURL(nodepass.TunnelConfig{
+		Type:          "server",
+		TunnelPort:    strconv.Itoa(req.ListenPort),
+		TargetAddress: serverConfig.TargetHost,
+		TargetPort:    strconv.Itoa(serverConfig.TargetPort),
+		ListenType:    req.ListenType,
+		LogLevel:      req.Log,
+		TLSMode:       tlsParam(req.TLS),
+		CertPath:      req.CertPath,
+		KeyPath:       req.KeyPath,
+		Mode:          "1",
+	})
+	if errs != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "server端" + errs.Error(),
+			"errors":  errs,
+		})
+		return
 	}
-	// 添加扩展目标地址（负载均衡）到client端URL
-	if len(req.ExtendTargetAddress) > 0 {
-		clientURL += "&extend_target_address=" + url.QueryEscape(strings.Join(req.ExtendTargetAddress, ","))
+	// 内网穿透：client端连接到server的IP:listen_port，转发到最终目标，扩展地址用于负载均衡
+	clientURL, errs := buildServiceURL(nodepass.TunnelConfig{
+		Type:                  "client",
+		TunnelAddress:         serverIP,
+		TunnelPort:            strconv.Itoa(req.ListenPort),
+		TargetAddress:         clientConfig.TargetHost,
+		TargetPort:            strconv.Itoa(clientConfig.TargetPort),
+		ExtendTargetAddresses: req.ExtendTargetAddress,
+		ListenType:            req.ListenType,
+		LogLevel:              req.Log,
+		Mode:                  "2",
+	})
+	if errs != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "client端" + errs.Error(),
+			"errors":  errs,
+		})
+		return
 	}
 
 	// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
@@ -676,8 +640,80 @@ func (h *ServicesHandler) handleIntranetMode(c *gin.Context, req *ServiceCreateR
 	})
 }
 
+// handleChainMode 处理多跳链路模式：入口监听 listen_port，经 chain 中的主控逐跳转发到 outbounds 的目标
+func (h *ServicesHandler) handleChainMode(c *gin.Context, req *ServiceCreateRequest) {
+	if req.Outbounds == nil || len(req.Chain) == 0 {
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "Chain mode is missing chain or outbounds configuration",
+		})
+		return
+	}
+
+	result, err := h.servicesService.CreateChainService(&services.CreateChainServiceRequest{
+		Name:        req.TunnelName,
+		EndpointIDs: req.Chain,
+		ListenHost:  req.ListenHost,
+		ListenPort:  req.ListenPort,
+		TunnelPort:  req.TunnelPort,
+		RelayPort:   req.RelayPort,
+		Password:    req.Password,
+		TargetHost:  req.Outbounds.TargetHost,
+		TargetPort:  req.Outbounds.TargetPort,
+		ListenType:  req.ListenType,
+		LogLevel:    req.Log,
+		TLSMode:     tlsParam(req.TLS),
+		CertPath:    req.CertPath,
+		KeyPath:     req.KeyPath,
+	})
+	if err != nil {
+		var errs nodepass.ValidationErrors
+		if errors.As(err, &errs) {
+			c.JSON(400, gin.H{
+				"success": false,
+				"error":   errs.Error(),
+				"errors":  errs,
+			})
+			return
+		}
+		log.Errorf("[API] 创建多跳链路服务失败: %v", err)
+		c.JSON(400, gin.H{
+			"success": false,
+			"error":   "Failed to create chain service: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success":    true,
+		"message":    "Chain service created successfully",
+		"sid":        result.Sid,
+		"tunnel_ids": result.TunnelIDs,
+	})
+}
+
 // ============ 辅助函数 ============
 
+// buildServiceURL 校验并生成服务/模板创建使用的隧道 URL，inherit 日志级别视为未设置
+func buildServiceURL(cfg nodepass.TunnelConfig) (string, nodepass.ValidationErrors) {
+	if cfg.LogLevel == "inherit" {
+		cfg.LogLevel = ""
+	}
+	cfg.Normalize()
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return "", errs
+	}
+	return cfg.BuildURL(), nil
+}
+
+// tlsParam 将请求中的 TLS 数值转换为 URL 参数，0 表示不设置
+func tlsParam(tls int) string {
+	if tls <= 0 {
+		return ""
+	}
+	return strconv.Itoa(tls)
+}
+
 // getTunnelIDByName 通过隧道名称获取隧道数据库ID
 func (h *ServicesHandler) getTunnelIDByName(tunnelName string) (int64, error) {
 	var tunnelID int64
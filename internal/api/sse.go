@@ -185,6 +185,9 @@ func (h *SSEHandler) HandleLogCleanupStats(c *gin.Context) {
 	})
 }
 
+// bytesPerMB 日志大小配置以 MB 为单位
+const bytesPerMB = 1024 * 1024
+
 // HandleLogCleanupConfig 管理日志清理配置
 // GET /api/sse/log-cleanup/config - 获取配置
 // POST /api/sse/log-cleanup/config - 更新配置
@@ -202,6 +205,7 @@ func (h *SSEHandler) HandleLogCleanupConfig(c *gin.Context) {
 // getLogCleanupConfig 获取当前日志清理配置
 func (h *SSEHandler) getLogCleanupConfig(c *gin.Context) {
 	stats := h.sseService.GetFileLogger().GetLogCleanupStats()
+	storage := h.sseService.GetFileLogger().GetStorageConfig()
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -210,6 +214,10 @@ func (h *SSEHandler) getLogCleanupConfig(c *gin.Context) {
 			"cleanupInterval":  stats["cleanup_interval"],
 			"maxRecordsPerDay": stats["max_records_per_day"],
 			"cleanupEnabled":   stats["enabled"],
+			"maxFileSizeMB":    storage.MaxFileSize / bytesPerMB,
+			"instanceQuotaMB":  storage.InstanceQuota / bytesPerMB,
+			"totalQuotaMB":     storage.TotalQuota / bytesPerMB,
+			"compressEnabled":  storage.Compress,
 		},
 	})
 }
@@ -221,6 +229,10 @@ func (h *SSEHandler) updateLogCleanupConfig(c *gin.Context) {
 		CleanupInterval  *string `json:"cleanupInterval"` // 格式: "24h", "12h", "6h"
 		MaxRecordsPerDay *int    `json:"maxRecordsPerDay"`
 		CleanupEnabled   *bool   `json:"cleanupEnabled"`
+		MaxFileSizeMB    *int64  `json:"maxFileSizeMB"`   // 单文件轮转大小，0 表示不轮转
+		InstanceQuotaMB  *int64  `json:"instanceQuotaMB"` // 单实例配额，0 表示不限
+		TotalQuotaMB     *int64  `json:"totalQuotaMB"`    // 全部日志配额，0 表示不限
+		CompressEnabled  *bool   `json:"compressEnabled"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -311,7 +323,35 @@ func (h *SSEHandler) updateLogCleanupConfig(c *gin.Context) {
 		return
 	}
 
+	storage := h.sseService.GetFileLogger().GetStorageConfig()
+	for _, p := range []struct {
+		value  *int64
+		target *int64
+	}{{req.MaxFileSizeMB, &storage.MaxFileSize}, {req.InstanceQuotaMB, &storage.InstanceQuota}, {req.TotalQuotaMB, &storage.TotalQuota}} {
+		if p.value == nil {
+			continue
+		}
+		if *p.value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Log size limits cannot be negative",
+			})
+			return
+		}
+		*p.target = *p.value * bytesPerMB
+	}
+	if req.CompressEnabled != nil {
+		storage.Compress = *req.CompressEnabled
+	}
+
 	// 更新配置
+	if err := h.sseService.SetLogStorageConfig(storage); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to save log storage configuration: " + err.Error(),
+		})
+		return
+	}
 	h.sseService.GetFileLogger().SetLogCleanupConfig(retentionDays, cleanupInterval, maxRecordsPerDay, cleanupEnabled)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -322,6 +362,10 @@ func (h *SSEHandler) updateLogCleanupConfig(c *gin.Context) {
 			"cleanupInterval":  cleanupInterval.String(),
 			"maxRecordsPerDay": maxRecordsPerDay,
 			"cleanupEnabled":   cleanupEnabled,
+			"maxFileSizeMB":    storage.MaxFileSize / bytesPerMB,
+			"instanceQuotaMB":  storage.InstanceQuota / bytesPerMB,
+			"totalQuotaMB":     storage.TotalQuota / bytesPerMB,
+			"compressEnabled":  storage.Compress,
 		},
 	})
 }
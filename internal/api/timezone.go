@@ -0,0 +1,75 @@
+package api
+
+import (
+	"NodePassDash/internal/middleware"
+	"NodePassDash/internal/timezone"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimezoneHandler 显示时区处理器
+type TimezoneHandler struct {
+	timezoneService *timezone.Service
+}
+
+// NewTimezoneHandler 创建显示时区处理器
+func NewTimezoneHandler(timezoneService *timezone.Service) *TimezoneHandler {
+	return &TimezoneHandler{timezoneService: timezoneService}
+}
+
+// SetupTimezoneRoutes 设置显示时区相关路由
+func SetupTimezoneRoutes(rg *gin.RouterGroup, timezoneService *timezone.Service) {
+	timezoneHandler := NewTimezoneHandler(timezoneService)
+
+	rg.GET("/settings/timezone", timezoneHandler.HandleGetSettings)
+	rg.PUT("/settings/timezone", timezoneHandler.HandleUpdateSettings)
+}
+
+// HandleGetSettings 获取全局及当前用户的显示时区
+func (h *TimezoneHandler) HandleGetSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "timezone": h.timezoneService.Settings(middleware.GetUsername(c))})
+}
+
+// HandleUpdateSettings 更新显示时区，字段缺省表示不修改，空字符串表示清除
+// 时区支持 IANA 名称（Asia/Shanghai）与固定偏移（+08:00、UTC-5）
+func (h *TimezoneHandler) HandleUpdateSettings(c *gin.Context) {
+	var req struct {
+		Global *string `json:"global"`
+		User   *string `json:"user"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	username := middleware.GetUsername(c)
+	var err error
+	if req.Global != nil {
+		err = h.timezoneService.SetGlobal(*req.Global)
+	}
+	if err == nil && req.User != nil {
+		err = h.timezoneService.SetUser(username, *req.User)
+	}
+	if err != nil {
+		if errors.Is(err, timezone.ErrInvalidTimezone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "时区设置已更新", "timezone": h.timezoneService.Settings(username)})
+}
+
+// resolveTimezone 按 tz 参数、用户设置、全局设置确定请求使用的时区，tz 不合法时直接返回 400
+func resolveTimezone(c *gin.Context, timezoneService *timezone.Service) (*time.Location, bool) {
+	loc, err := timezoneService.Resolve(c.Query("tz"), middleware.GetUsername(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return nil, false
+	}
+	return loc, true
+}
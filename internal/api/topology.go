@@ -0,0 +1,68 @@
+package api
+
+import (
+	"NodePassDash/internal/topology"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TopologyHandler 网络拓扑处理器
+type TopologyHandler struct {
+	topologyService *topology.Service
+}
+
+// NewTopologyHandler 创建网络拓扑处理器
+func NewTopologyHandler(topologyService *topology.Service) *TopologyHandler {
+	return &TopologyHandler{topologyService: topologyService}
+}
+
+// SetupTopologyRoutes 设置网络拓扑相关路由
+func SetupTopologyRoutes(rg *gin.RouterGroup, topologyService *topology.Service) {
+	topologyHandler := NewTopologyHandler(topologyService)
+
+	rg.GET("/topology", topologyHandler.HandleGetTopology)
+}
+
+// HandleGetTopology 获取网络拓扑
+// GET /api/topology?groupId=&sid=&format=json|dot|mermaid
+func (h *TopologyHandler) HandleGetTopology(c *gin.Context) {
+	var filter topology.Filter
+	if v := c.Query("groupId"); v != "" {
+		groupID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || groupID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分组ID"})
+			return
+		}
+		filter.GroupID = groupID
+	}
+	filter.Sid = c.Query("sid")
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "dot" && format != "mermaid" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 仅支持 json、dot、mermaid"})
+		return
+	}
+
+	graph, err := h.topologyService.Build(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch format {
+	case "dot":
+		c.Header("Content-Disposition", `inline; filename="topology.dot"`)
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(topology.ToDOT(graph)))
+	case "mermaid":
+		c.Header("Content-Disposition", `inline; filename="topology.mmd"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(topology.ToMermaid(graph)))
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"nodes":   graph.Nodes,
+			"edges":   graph.Edges,
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"NodePassDash/internal/anomaly"
+	"NodePassDash/internal/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TrafficAnomalyHandler 流量异常检测处理器
+type TrafficAnomalyHandler struct {
+	anomalyService *anomaly.Service
+}
+
+// NewTrafficAnomalyHandler 创建流量异常检测处理器
+func NewTrafficAnomalyHandler(anomalyService *anomaly.Service) *TrafficAnomalyHandler {
+	return &TrafficAnomalyHandler{anomalyService: anomalyService}
+}
+
+// SetupTrafficAnomalyRoutes 设置流量异常检测相关路由
+func SetupTrafficAnomalyRoutes(rg *gin.RouterGroup, anomalyService *anomaly.Service) {
+	trafficAnomalyHandler := NewTrafficAnomalyHandler(anomalyService)
+
+	rg.GET("/traffic-anomalies", trafficAnomalyHandler.HandleListAnomalies)
+	rg.GET("/traffic-anomalies/config", trafficAnomalyHandler.HandleGetConfig)
+	rg.PUT("/traffic-anomalies/config", trafficAnomalyHandler.HandleUpdateConfig)
+	rg.GET("/traffic-anomalies/baseline", trafficAnomalyHandler.HandleGetBaseline)
+	rg.POST("/traffic-anomalies/run", trafficAnomalyHandler.HandleRun)
+	rg.POST("/traffic-anomalies/:id/false-positive", trafficAnomalyHandler.HandleMarkFalsePositive)
+}
+
+// HandleListAnomalies 分页查询流量异常，可按 endpointId、instanceId、tunnelId、kind、severity、falsePositive 筛选
+func (h *TrafficAnomalyHandler) HandleListAnomalies(c *gin.Context) {
+	filter := anomaly.AnomalyFilter{
+		InstanceID: c.Query("instanceId"),
+		Kind:       models.TrafficAnomalyKind(c.Query("kind")),
+		Severity:   models.TrafficAnomalySeverity(c.Query("severity")),
+	}
+	filter.EndpointID, _ = strconv.ParseInt(c.Query("endpointId"), 10, 64)
+	filter.TunnelID, _ = strconv.ParseInt(c.Query("tunnelId"), 10, 64)
+	filter.Page, _ = strconv.Atoi(c.Query("page"))
+	filter.PageSize, _ = strconv.Atoi(c.Query("pageSize"))
+	if v := c.Query("falsePositive"); v != "" {
+		fp := v == "true"
+		filter.FalsePositive = &fp
+	}
+
+	anomalies, total, err := h.anomalyService.ListAnomalies(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "anomalies": anomalies, "total": total})
+}
+
+// HandleGetConfig 获取异常检测配置
+func (h *TrafficAnomalyHandler) HandleGetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "config": h.anomalyService.Config()})
+}
+
+// HandleUpdateConfig 更新异常检测配置
+func (h *TrafficAnomalyHandler) HandleUpdateConfig(c *gin.Context) {
+	cfg := h.anomalyService.Config()
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.anomalyService.SetConfig(cfg); err != nil {
+		if errors.Is(err, anomaly.ErrInvalidConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "异常检测配置已更新", "config": cfg})
+}
+
+// HandleGetBaseline 获取隧道的周内小时基线
+func (h *TrafficAnomalyHandler) HandleGetBaseline(c *gin.Context) {
+	endpointID, err := strconv.ParseInt(c.Query("endpointId"), 10, 64)
+	instanceID := c.Query("instanceId")
+	if err != nil || instanceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 endpointId 或 instanceId"})
+		return
+	}
+
+	view, err := h.anomalyService.Baseline(endpointID, instanceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "state": view.State, "slots": view.Slots})
+}
+
+// HandleRun 立即执行一次异常检测
+func (h *TrafficAnomalyHandler) HandleRun(c *gin.Context) {
+	if err := h.anomalyService.RunOnce(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "异常检测已完成"})
+}
+
+// HandleMarkFalsePositive 将异常标记为误报，用于调整该隧道的基线与阈值
+func (h *TrafficAnomalyHandler) HandleMarkFalsePositive(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的异常ID"})
+		return
+	}
+
+	a, err := h.anomalyService.MarkFalsePositive(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "流量异常不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "已标记为误报", "anomaly": a})
+}
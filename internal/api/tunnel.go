@@ -5,15 +5,17 @@ import (
 	"NodePassDash/internal/metrics"
 	"NodePassDash/internal/models"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/rollup"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/timezone"
 	"NodePassDash/internal/tunnel"
 	"archive/zip"
 	"bytes"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -42,10 +44,10 @@ func NewTunnelHandler(tunnelService *tunnel.Service, sseManager *sse.Manager) *T
 }
 
 // setupTunnelRoutes 设置隧道相关路由
-func SetupTunnelRoutes(rg *gin.RouterGroup, tunnelService *tunnel.Service, sseManager *sse.Manager, sseProcessor *metrics.SSEProcessor) {
+func SetupTunnelRoutes(rg *gin.RouterGroup, tunnelService *tunnel.Service, sseManager *sse.Manager, sseProcessor *metrics.SSEProcessor, rollupService *rollup.Service, timezoneService *timezone.Service) {
 	// 创建TunnelHandler实例
 	tunnelHandler := NewTunnelHandler(tunnelService, sseManager)
-	tunnelMetricsHandler := NewTunnelMetricsHandler(tunnelService, sseProcessor)
+	tunnelMetricsHandler := NewTunnelMetricsHandler(tunnelService, sseProcessor, rollupService, timezoneService)
 
 	// 实例相关路由
 	rg.GET("/endpoints/:id/instances", tunnelHandler.HandleGetInstances)
@@ -63,6 +65,13 @@ func SetupTunnelRoutes(rg *gin.RouterGroup, tunnelService *tunnel.Service, sseMa
 	rg.POST("/tunnels/batch-new", tunnelHandler.HandleNewBatchCreateTunnels)
 	rg.DELETE("/tunnels/batch", tunnelHandler.HandleBatchDeleteTunnels)
 	rg.POST("/tunnels/batch/action", tunnelHandler.HandleBatchActionTunnels)
+	rg.POST("/tunnels/bulk-update", tunnelHandler.HandleBulkUpdateTunnels)
+	rg.POST("/tunnels/validate", tunnelHandler.HandleValidateTunnelURL)
+	rg.POST("/tunnels/:id/clone", tunnelHandler.HandleCloneTunnel)
+	rg.GET("/tunnels/export", tunnelHandler.HandleExportTunnels)
+	rg.GET("/tunnels/queries", tunnelHandler.HandleListSavedQueries)
+	rg.PUT("/tunnels/queries", tunnelHandler.HandleSaveQuery)
+	rg.DELETE("/tunnels/queries/:name", tunnelHandler.HandleDeleteSavedQuery)
 	rg.POST("/tunnels/create_by_url", tunnelHandler.HandleQuickCreateTunnel)
 	rg.POST("/tunnels/quick-batch", tunnelHandler.HandleQuickBatchCreateTunnel)
 	rg.POST("/tunnels/template", tunnelHandler.HandleTemplateCreate)
@@ -87,6 +96,7 @@ func SetupTunnelRoutes(rg *gin.RouterGroup, tunnelService *tunnel.Service, sseMa
 
 	// 新的统一 metrics 趋势接口 - 基于 ServiceHistory 表，使用 instanceId
 	rg.GET("/tunnels/:id/metrics-trend", tunnelMetricsHandler.HandleGetTunnelMetricsTrend)
+	rg.GET("/tunnels/:id/latency-histogram", tunnelMetricsHandler.HandleGetTunnelLatencyHistogram)
 
 	// TCPing 诊断测试接口 - 基于 instanceId
 	rg.POST("/tunnels/:id/tcping", tunnelHandler.HandleTunnelTCPing)
@@ -108,6 +118,7 @@ func (h *TunnelHandler) HandleGetTunnels(c *gin.Context) {
 	endpointGroupFilter := query.Get("endpoint_group_id")
 	portFilter := query.Get("port_filter")
 	groupFilter := query.Get("group_id")
+	queryFilter := strings.TrimSpace(query.Get("q"))
 
 	// 分页参数
 	page := 1
@@ -130,6 +141,14 @@ func (h *TunnelHandler) HandleGetTunnels(c *gin.Context) {
 		sortOrder = "desc" // 默认降序
 	}
 
+	// 查询语句先行校验，语法错误返回 400 而不是 500
+	if queryFilter != "" {
+		if _, _, err := h.tunnelService.CompileQuery(queryFilter, "t"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "查询语句无效: " + err.Error()})
+			return
+		}
+	}
+
 	result, err := h.tunnelService.GetTunnelsWithPagination(tunnel.TunnelQueryParams{
 		Search:          searchFilter,
 		Status:          statusFilter,
@@ -137,6 +156,7 @@ func (h *TunnelHandler) HandleGetTunnels(c *gin.Context) {
 		EndpointGroupID: endpointGroupFilter,
 		PortFilter:      portFilter,
 		GroupID:         groupFilter,
+		Query:           queryFilter,
 		Page:            page,
 		PageSize:        pageSize,
 		SortBy:          sortBy,
@@ -1357,20 +1377,22 @@ func (h *TunnelHandler) HandleTemplateCreate(c *gin.Context) {
 		}
 
 		// 构建单端转发的URL，支持listen_host
-		var listenAddr string
-		if req.ListenHost != "" {
-			listenAddr = fmt.Sprintf("%s:%d", req.ListenHost, req.ListenPort)
-		} else {
-			listenAddr = fmt.Sprintf(":%d", req.ListenPort)
+		tunnelURL, errs := buildServiceURL(nodepass.TunnelConfig{
+			Type:                  "client",
+			TunnelAddress:         req.ListenHost,
+			TunnelPort:            strconv.Itoa(req.ListenPort),
+			TargetAddress:         req.Inbounds.TargetHost,
+			TargetPort:            strconv.Itoa(req.Inbounds.TargetPort),
+			ExtendTargetAddresses: req.ExtendTargetAddress,
+			ListenType:            req.ListenType,
+			LogLevel:              req.Log,
+			Mode:                  "1",
+		})
+		if errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": errs.Error(), "errors": errs})
+			return
 		}
 
-		tunnelURL := fmt.Sprintf("client://%s/%s:%d?log=%s&mode=1",
-			listenAddr,
-			req.Inbounds.TargetHost,
-			req.Inbounds.TargetPort,
-			req.Log,
-		)
-
 		// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
 		var tunnelName string
 		if req.TunnelName != "" {
@@ -1522,29 +1544,35 @@ func (h *TunnelHandler) HandleTemplateCreate(c *gin.Context) {
 		}
 
 		// 双端转发：server端监听listen_port，转发到outbounds的target
-		serverURL := fmt.Sprintf("server://:%d/%s:%d",
-			req.ListenPort,
-			serverConfig.TargetHost,
-			serverConfig.TargetPort,
-		)
-		if req.TLS > 0 {
-			serverURL += fmt.Sprintf("?tls=%d&log=%s", req.TLS, req.Log)
-			// 如果是TLS 2且提供了证书路径，添加证书参数
-			if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-				serverURL += fmt.Sprintf("&cert=%s&key=%s", url.QueryEscape(req.CertPath), url.QueryEscape(req.KeyPath))
-			}
-		} else {
-			serverURL += fmt.Sprintf("?log=%s", req.Log)
+		serverURL, errs := buildServiceURL(nodepass.TunnelConfig{
+			Type:          "server",
+			TunnelPort:    strconv.Itoa(req.ListenPort),
+			TargetAddress: serverConfig.TargetHost,
+			TargetPort:    strconv.Itoa(serverConfig.TargetPort),
+			LogLevel:      req.Log,
+			TLSMode:       tlsParam(req.TLS),
+			CertPath:      req.CertPath,
+			KeyPath:       req.KeyPath,
+		})
+		if errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "server端" + errs.Error(), "errors": errs})
+			return
 		}
 
 		// 双端转发：client端连接到server的IP:listen_port，转发到inbounds的target
-		clientURL := fmt.Sprintf("client://%s:%d/%s:%d?log=%s&mode=2",
-			serverIP,
-			req.ListenPort,
-			clientConfig.TargetHost,
-			clientConfig.TargetPort,
-			req.Log,
-		)
+		clientURL, errs := buildServiceURL(nodepass.TunnelConfig{
+			Type:          "client",
+			TunnelAddress: serverIP,
+			TunnelPort:    strconv.Itoa(req.ListenPort),
+			TargetAddress: clientConfig.TargetHost,
+			TargetPort:    strconv.Itoa(clientConfig.TargetPort),
+			LogLevel:      req.Log,
+			Mode:          "2",
+		})
+		if errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "client端" + errs.Error(), "errors": errs})
+			return
+		}
 
 		// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
 		var serverTunnelName, clientTunnelName string
@@ -1744,29 +1772,35 @@ func (h *TunnelHandler) HandleTemplateCreate(c *gin.Context) {
 		}
 
 		// 内网穿透：server端监听listen_port，目标是用户要访问的地址
-		serverURL := fmt.Sprintf("server://:%d/%s:%d",
-			req.ListenPort,
-			serverConfig.TargetHost,
-			serverConfig.TargetPort,
-		)
-		if req.TLS > 0 {
-			serverURL += fmt.Sprintf("?tls=%d&log=%s", req.TLS, req.Log)
-			// 如果是TLS 2且提供了证书路径，添加证书参数
-			if req.TLS == 2 && req.CertPath != "" && req.KeyPath != "" {
-				serverURL += fmt.Sprintf("&cert=%s&key=%s", url.QueryEscape(req.CertPath), url.QueryEscape(req.KeyPath))
-			}
-		} else {
-			serverURL += fmt.Sprintf("?log=%s", req.Log)
+		serverURL, errs := buildServiceURL(nodepass.TunnelConfig{
+			Type:          "server",
+			TunnelPort:    strconv.Itoa(req.ListenPort),
+			TargetAddress: serverConfig.TargetHost,
+			TargetPort:    strconv.Itoa(serverConfig.TargetPort),
+			LogLevel:      req.Log,
+			TLSMode:       tlsParam(req.TLS),
+			CertPath:      req.CertPath,
+			KeyPath:       req.KeyPath,
+		})
+		if errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "server端" + errs.Error(), "errors": errs})
+			return
 		}
 
 		// 内网穿透：client端连接到server的IP:listen_port，转发到最终目标
-		clientURL := fmt.Sprintf("client://%s:%d/%s:%d?log=%s&mode=2",
-			serverIP,
-			req.ListenPort,
-			clientConfig.TargetHost,
-			clientConfig.TargetPort,
-			req.Log,
-		)
+		clientURL, errs := buildServiceURL(nodepass.TunnelConfig{
+			Type:          "client",
+			TunnelAddress: serverIP,
+			TunnelPort:    strconv.Itoa(req.ListenPort),
+			TargetAddress: clientConfig.TargetHost,
+			TargetPort:    strconv.Itoa(clientConfig.TargetPort),
+			LogLevel:      req.Log,
+			Mode:          "2",
+		})
+		if errs != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "client端" + errs.Error(), "errors": errs})
+			return
+		}
 
 		// 生成隧道名称 - 优先使用用户提供的名称，否则自动生成
 		var serverTunnelName, clientTunnelName string
@@ -2180,6 +2214,183 @@ func (h *TunnelHandler) HandleNewBatchCreateTunnels(c *gin.Context) {
 	}
 }
 
+// HandleBulkUpdateTunnels 按筛选条件批量修改隧道参数 (POST /api/tunnels/bulk-update)
+// 默认 dryRun=true 仅返回差异；确认后传 dryRun=false 并发下发
+func (h *TunnelHandler) HandleBulkUpdateTunnels(c *gin.Context) {
+	var req tunnel.BulkUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, tunnel.TunnelResponse{
+			Success: false,
+			Error:   "无效的请求数据",
+		})
+		return
+	}
+
+	result, err := h.tunnelService.BulkUpdate(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, tunnel.TunnelResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleCloneTunnel 将隧道克隆到一个或多个主控 (POST /api/tunnels/:id/clone)
+func (h *TunnelHandler) HandleCloneTunnel(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的隧道ID"})
+		return
+	}
+
+	var req tunnel.CloneTunnelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的请求数据"})
+		return
+	}
+
+	results, err := h.tunnelService.CloneTunnel(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	successCount := 0
+	for _, r := range results {
+		if r.Success {
+			successCount++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":      successCount > 0,
+		"successCount": successCount,
+		"failCount":    len(results) - successCount,
+		"results":      results,
+	})
+}
+
+// HandleValidateTunnelURL 校验隧道 URL 或配置并返回规范化 URL (POST /api/tunnels/validate)
+// 请求体二选一：{"url": "server://..."} 或 {"config": {...}}，校验失败时 valid=false 并返回逐字段错误
+func (h *TunnelHandler) HandleValidateTunnelURL(c *gin.Context) {
+	var req struct {
+		URL    string                 `json:"url"`
+		Config *nodepass.TunnelConfig `json:"config"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的请求数据"})
+		return
+	}
+
+	var cfg *nodepass.TunnelConfig
+	var errs nodepass.ValidationErrors
+	var unknown []string
+	switch {
+	case strings.TrimSpace(req.URL) != "":
+		cfg, errs = nodepass.ValidateTunnelURL(req.URL)
+		unknown = nodepass.UnknownQueryParams(req.URL)
+	case req.Config != nil:
+		cfg, errs = req.Config, req.Config.Validate()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请提供 url 或 config"})
+		return
+	}
+
+	if errs == nil {
+		errs = nodepass.ValidationErrors{}
+	}
+	// 未知参数仅告警，并原样附加到规范化 URL 末尾
+	warnings := nodepass.ValidationErrors{}
+	for _, kv := range unknown {
+		warnings = append(warnings, nodepass.FieldError{Field: strings.SplitN(kv, "=", 2)[0], Message: "未知参数，将原样透传"})
+	}
+	canonical := nodepass.AppendQueryParams(cfg.BuildURL(), unknown)
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"valid":     len(errs) == 0,
+		"errors":    errs,
+		"warnings":  warnings,
+		"canonical": canonical,
+		"config":    cfg,
+	})
+}
+
+// HandleExportTunnels 按查询语句导出隧道 (GET /api/tunnels/export?q=...&format=json|csv)
+func (h *TunnelHandler) HandleExportTunnels(c *gin.Context) {
+	tunnels, err := h.tunnelService.FindTunnelsByFilter(tunnel.BulkUpdateFilter{Query: c.Query("q")})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("nodepass-tunnels-%s", time.Now().Format("20060102-150405"))
+	if c.DefaultQuery("format", "json") != "csv" {
+		c.Header("Content-Disposition", "attachment; filename="+filename+".json")
+		c.JSON(http.StatusOK, gin.H{
+			"timestamp": time.Now().Format(time.RFC3339),
+			"query":     c.Query("q"),
+			"total":     len(tunnels),
+			"tunnels":   tunnels,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write([]string{"id", "name", "endpoint_id", "type", "status", "tunnel_address", "tunnel_port",
+		"target_address", "target_port", "instance_id", "total_rx", "total_tx", "command_line"})
+	for _, t := range tunnels {
+		instanceID := ""
+		if t.InstanceID != nil {
+			instanceID = *t.InstanceID
+		}
+		_ = w.Write([]string{
+			strconv.FormatInt(t.ID, 10), t.Name, strconv.FormatInt(t.EndpointID, 10), string(t.Type), string(t.Status),
+			t.TunnelAddress, t.TunnelPort, t.TargetAddress, t.TargetPort, instanceID,
+			strconv.FormatInt(t.TCPRx+t.UDPRx, 10), strconv.FormatInt(t.TCPTx+t.UDPTx, 10), t.CommandLine,
+		})
+	}
+	w.Flush()
+
+	c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// HandleListSavedQueries 获取已保存的隧道查询
+func (h *TunnelHandler) HandleListSavedQueries(c *gin.Context) {
+	queries, err := h.tunnelService.ListSavedQueries()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "queries": queries})
+}
+
+// HandleSaveQuery 保存隧道查询（按名称覆盖），之后可在语句中用 @name 引用
+func (h *TunnelHandler) HandleSaveQuery(c *gin.Context) {
+	var req models.TunnelSavedQuery
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的请求数据"})
+		return
+	}
+	if err := h.tunnelService.SaveQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "query": req})
+}
+
+// HandleDeleteSavedQuery 删除已保存的隧道查询
+func (h *TunnelHandler) HandleDeleteSavedQuery(c *gin.Context) {
+	if err := h.tunnelService.DeleteSavedQuery(c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "查询已删除"})
+}
+
 // HandleBatchActionTunnels 批量操作隧道（启动、停止、重启）
 func (h *TunnelHandler) HandleBatchActionTunnels(c *gin.Context) {
 
@@ -2187,6 +2398,8 @@ func (h *TunnelHandler) HandleBatchActionTunnels(c *gin.Context) {
 	type batchActionRequest struct {
 		// 根据数据库 ID 操作
 		IDs []int64 `json:"ids"`
+		// 未提供 ids 时按查询语句选取隧道
+		Query string `json:"query"`
 		// 操作类型: start, stop, restart
 		Action string `json:"action"`
 	}
@@ -2228,6 +2441,21 @@ func (h *TunnelHandler) HandleBatchActionTunnels(c *gin.Context) {
 		return
 	}
 
+	// 按查询语句选取隧道
+	if len(req.IDs) == 0 && strings.TrimSpace(req.Query) != "" {
+		matched, err := h.tunnelService.FindTunnelsByFilter(tunnel.BulkUpdateFilter{Query: req.Query})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, batchActionResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		for _, t := range matched {
+			req.IDs = append(req.IDs, t.ID)
+		}
+	}
+
 	// 验证 ID 列表
 	if len(req.IDs) == 0 {
 		c.JSON(http.StatusBadRequest, batchActionResponse{
@@ -2953,8 +3181,8 @@ func (h *TunnelHandler) HandleExportTunnelLogs(c *gin.Context) {
 					return nil // 忽略错误，继续处理
 				}
 
-				// 只处理.log文件
-				if !info.IsDir() && strings.HasSuffix(info.Name(), ".log") {
+				// 只处理日志文件（含轮转段与压缩文件）
+				if !info.IsDir() && log.IsLogFileName(info.Name()) {
 					// 读取文件内容
 					fileContent, err := os.ReadFile(path)
 					if err != nil {
@@ -3,6 +3,9 @@ package api
 import (
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/metrics"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/rollup"
+	"NodePassDash/internal/timezone"
 	"NodePassDash/internal/tunnel"
 	"database/sql"
 	"net/http"
@@ -15,15 +18,19 @@ import (
 
 // TunnelMetricsHandler 改进版的隧道指标处理器，基于 Nezha 的 avg_delay 机制
 type TunnelMetricsHandler struct {
-	tunnelService *tunnel.Service
-	sseProcessor  *metrics.SSEProcessor
+	tunnelService   *tunnel.Service
+	sseProcessor    *metrics.SSEProcessor
+	rollupService   *rollup.Service
+	timezoneService *timezone.Service
 }
 
 // NewTunnelMetricsHandler 创建隧道指标处理器
-func NewTunnelMetricsHandler(tunnelService *tunnel.Service, sseProcessor *metrics.SSEProcessor) *TunnelMetricsHandler {
+func NewTunnelMetricsHandler(tunnelService *tunnel.Service, sseProcessor *metrics.SSEProcessor, rollupService *rollup.Service, timezoneService *timezone.Service) *TunnelMetricsHandler {
 	return &TunnelMetricsHandler{
-		tunnelService: tunnelService,
-		sseProcessor:  sseProcessor,
+		tunnelService:   tunnelService,
+		sseProcessor:    sseProcessor,
+		rollupService:   rollupService,
+		timezoneService: timezoneService,
 	}
 }
 
@@ -51,6 +58,11 @@ func (h *TunnelMetricsHandler) HandleGetTunnelTrafficTrendV2(c *gin.Context) {
 		}
 	}
 
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
 	db := h.tunnelService.DB()
 
 	// 查询隧道基本信息
@@ -79,7 +91,7 @@ func (h *TunnelMetricsHandler) HandleGetTunnelTrafficTrendV2(c *gin.Context) {
 		}
 
 		// 补充缺失的时间点到当前时间（每分钟一个点）
-		trafficTrend = h.fillMissingTimePoints(trafficTrend, hours, "traffic")
+		trafficTrend = h.fillMissingTimePoints(trafficTrend, hours, "traffic", loc)
 
 		log.Debugf("流量趋势查询完成 [%d_%s]: %d 个数据点", endpointID, instanceID.String, len(trafficTrend))
 	}
@@ -92,6 +104,7 @@ func (h *TunnelMetricsHandler) HandleGetTunnelTrafficTrendV2(c *gin.Context) {
 		"count":        len(trafficTrend),
 		"source":       "aggregated_metrics", // 标识数据来源
 		"timestamp":    time.Now().Unix(),
+		"timezone":     loc.String(),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -121,6 +134,11 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPingTrendV2(c *gin.Context) {
 		}
 	}
 
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
 	db := h.tunnelService.DB()
 
 	// 查询隧道基本信息
@@ -149,7 +167,7 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPingTrendV2(c *gin.Context) {
 		}
 
 		// 补充缺失的时间点到当前时间（每分钟一个点）
-		pingTrend = h.fillMissingTimePoints(pingTrend, hours, "ping")
+		pingTrend = h.fillMissingTimePoints(pingTrend, hours, "ping", loc)
 
 		log.Debugf("延迟趋势查询完成 [%d_%s]: %d 个数据点", endpointID, instanceID.String, len(pingTrend))
 	}
@@ -162,6 +180,7 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPingTrendV2(c *gin.Context) {
 		"count":     len(pingTrend),
 		"source":    "aggregated_metrics", // 标识数据来源
 		"timestamp": time.Now().Unix(),
+		"timezone":  loc.String(),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -191,6 +210,11 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPoolTrendV2(c *gin.Context) {
 		}
 	}
 
+	loc, ok := resolveTimezone(c, h.timezoneService)
+	if !ok {
+		return
+	}
+
 	db := h.tunnelService.DB()
 
 	// 查询隧道基本信息
@@ -219,7 +243,7 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPoolTrendV2(c *gin.Context) {
 		}
 
 		// 补充缺失的时间点到当前时间（每分钟一个点）
-		poolTrend = h.fillMissingTimePoints(poolTrend, hours, "pool")
+		poolTrend = h.fillMissingTimePoints(poolTrend, hours, "pool", loc)
 
 		log.Debugf("连接池趋势查询完成 [%d_%s]: %d 个数据点", endpointID, instanceID.String, len(poolTrend))
 	}
@@ -232,19 +256,21 @@ func (h *TunnelMetricsHandler) HandleGetTunnelPoolTrendV2(c *gin.Context) {
 		"count":     len(poolTrend),
 		"source":    "aggregated_metrics", // 标识数据来源
 		"timestamp": time.Now().Unix(),
+		"timezone":  loc.String(),
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
 // fillMissingTimePoints 补充缺失的时间点，确保每分钟都有数据点
-func (h *TunnelMetricsHandler) fillMissingTimePoints(data []map[string]interface{}, hours int, metricType string) []map[string]interface{} {
+// eventTime 按 loc 时区输出，并附带带时区偏移的 ISO 8601 时间 time
+func (h *TunnelMetricsHandler) fillMissingTimePoints(data []map[string]interface{}, hours int, metricType string, loc *time.Location) []map[string]interface{} {
 	if len(data) == 0 {
 		// 如果没有任何数据，创建全零的时间序列
-		return h.createEmptyTimeSeries(hours, metricType)
+		return h.createEmptyTimeSeries(hours, metricType, loc)
 	}
 
-	// 创建时间索引映射
+	// 创建时间索引映射（聚合数据的 eventTime 为服务器本地时间）
 	timeMap := make(map[string]map[string]interface{})
 	for _, item := range data {
 		if eventTime, ok := item["eventTime"].(string); ok {
@@ -260,34 +286,40 @@ func (h *TunnelMetricsHandler) fillMissingTimePoints(data []map[string]interface
 	for current := startTime.Truncate(time.Minute); current.Before(now); current = current.Add(time.Minute) {
 		timeKey := current.Format("2006-01-02 15:04")
 
-		if existingData, exists := timeMap[timeKey]; exists {
-			// 使用现有数据
-			result = append(result, existingData)
-		} else {
+		point, exists := timeMap[timeKey]
+		if !exists {
 			// 创建缺失时间点的零值数据
-			zeroData := h.createZeroDataPoint(timeKey, metricType)
-			result = append(result, zeroData)
+			point = h.createZeroDataPoint(timeKey, metricType)
 		}
+		setPointTime(point, current, loc)
+		result = append(result, point)
 	}
 
 	return result
 }
 
 // createEmptyTimeSeries 创建空的时间序列
-func (h *TunnelMetricsHandler) createEmptyTimeSeries(hours int, metricType string) []map[string]interface{} {
+func (h *TunnelMetricsHandler) createEmptyTimeSeries(hours int, metricType string, loc *time.Location) []map[string]interface{} {
 	result := make([]map[string]interface{}, 0)
 	now := time.Now()
 	startTime := now.Add(-time.Duration(hours) * time.Hour)
 
 	for current := startTime.Truncate(time.Minute); current.Before(now); current = current.Add(time.Minute) {
-		timeKey := current.Format("2006-01-02 15:04")
-		zeroData := h.createZeroDataPoint(timeKey, metricType)
+		zeroData := h.createZeroDataPoint(current.Format("2006-01-02 15:04"), metricType)
+		setPointTime(zeroData, current, loc)
 		result = append(result, zeroData)
 	}
 
 	return result
 }
 
+// setPointTime 按显示时区设置数据点的时间字段
+func setPointTime(point map[string]interface{}, t time.Time, loc *time.Location) {
+	t = t.In(loc)
+	point["eventTime"] = t.Format("2006-01-02 15:04")
+	point["time"] = t.Format(time.RFC3339)
+}
+
 // createZeroDataPoint 创建零值数据点
 func (h *TunnelMetricsHandler) createZeroDataPoint(timeKey, metricType string) map[string]interface{} {
 	data := map[string]interface{}{
@@ -326,16 +358,31 @@ func (h *TunnelMetricsHandler) HandleGetTunnelMetricsTrend(c *gin.Context) {
 		return
 	}
 
-	// 解析小时数参数，默认24小时
-	// hours := 24
-	// if h := c.Query("hours"); h != "" {
-	// 	if parsedHours, err := strconv.Atoi(h); err == nil && parsedHours > 0 && parsedHours <= 168 { // 最多7天
-	// 		hours = parsedHours
-	// 	}
-	// }
+	// 解析小时数参数，默认24小时；超过分钟数据保留范围时改用降采样数据
+	hours := 24
+	maxHours := int(rollup.RawRetention / time.Hour)
+	if h.rollupService != nil {
+		maxHours = 24 * 365
+	}
+	if hs := c.Query("hours"); hs != "" {
+		if parsedHours, err := strconv.Atoi(hs); err == nil && parsedHours > 0 && parsedHours <= maxHours {
+			hours = parsedHours
+		}
+	}
+
+	var tier models.RollupTier
+	if h.rollupService != nil {
+		tier = h.rollupService.SelectTier(time.Now().Add(-time.Duration(hours) * time.Hour))
+	}
 
 	// 构建统一的趋势数据响应
-	unifiedData, err := h.getUnifiedTrendDataFromServiceHistory(instanceId, 24)
+	var unifiedData map[string]interface{}
+	var err error
+	if tier == "" {
+		unifiedData, err = h.getUnifiedTrendDataFromServiceHistory(instanceId, hours)
+	} else {
+		unifiedData, err = h.getUnifiedTrendDataFromRollup(instanceId, tier, hours)
+	}
 	if err != nil {
 		// 如果数据库已关闭，则不再继续刷日志
 		if strings.Contains(err.Error(), "database is closed") {
@@ -345,7 +392,11 @@ func (h *TunnelMetricsHandler) HandleGetTunnelMetricsTrend(c *gin.Context) {
 		}
 		// 回退到空数据，不阻止响应
 		log.Info("回退到空数据，不阻止响应")
-		unifiedData = h.createEmptyTrendData(24)
+		if tier == "" {
+			unifiedData = h.createEmptyTrendData(hours)
+		} else {
+			unifiedData = buildRollupTrendData(nil)
+		}
 	}
 
 	// 安全地获取数据长度，支持不同的数据类型
@@ -374,15 +425,75 @@ func (h *TunnelMetricsHandler) HandleGetTunnelMetricsTrend(c *gin.Context) {
 	)
 
 	// 返回统一的趋势数据
+	resolution := string(tier)
+	if tier == "" {
+		resolution = "1m"
+	}
 	response := map[string]interface{}{
 		"success":   true,
 		"data":      unifiedData,
+		"hours":     hours,
+		"tier":      resolution,
+		"interval":  int64(rollup.Interval(tier) / time.Second),
 		"timestamp": time.Now().Unix(),
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// HandleGetTunnelLatencyHistogram 获取隧道在时间范围内的延迟分布直方图
+// GET /api/tunnels/{instanceId}/latency-histogram?hours=24&buckets=20
+func (h *TunnelMetricsHandler) HandleGetTunnelLatencyHistogram(c *gin.Context) {
+	instanceId := c.Param("id")
+	if instanceId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少实例ID"})
+		return
+	}
+	if h.rollupService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "历史数据服务未启用"})
+		return
+	}
+
+	hours := 24
+	if hs := c.Query("hours"); hs != "" {
+		if parsedHours, err := strconv.Atoi(hs); err == nil && parsedHours > 0 && parsedHours <= 24*365 {
+			hours = parsedHours
+		}
+	}
+	buckets := 20
+	if bs := c.Query("buckets"); bs != "" {
+		if parsed, err := strconv.Atoi(bs); err == nil && parsed > 0 && parsed <= 200 {
+			buckets = parsed
+		}
+	}
+
+	sketch, tier, err := h.rollupService.PingSketch(instanceId, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		log.Errorf("获取延迟分布失败 [%s]: %v", instanceId, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resolution := string(tier)
+	if tier == "" {
+		resolution = "1m"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"hours":   hours,
+		"tier":    resolution,
+		"count":   sketch.Count,
+		"min":     sketch.Min,
+		"max":     sketch.Max,
+		"mean":    sketch.Mean(),
+		"p50":     sketch.Quantile(0.5),
+		"p90":     sketch.Quantile(0.9),
+		"p99":     sketch.Quantile(0.99),
+		"jitter":  sketch.StdDev(),
+		"buckets": sketch.Histogram(buckets),
+	})
+}
+
 // getUnifiedTrendDataFromServiceHistory 从ServiceHistory表获取统一的趋势数据
 func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID string, hours int) (map[string]interface{}, error) {
 	db := h.tunnelService.DB()
@@ -404,9 +515,15 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 		DeltaUDPOut float64   `json:"delta_udp_out"`
 		AvgSpeedIn  float64   `json:"avg_speed_in"`
 		AvgSpeedOut float64   `json:"avg_speed_out"`
+		P50Ping     float64   `json:"p50_ping"`
+		P90Ping     float64   `json:"p90_ping"`
+		P99Ping     float64   `json:"p99_ping"`
+		MaxPing     float64   `json:"max_ping"`
+		JitterPing  float64   `json:"jitter_ping"`
 	}
 
-	query := h.tunnelService.Rebind(`SELECT record_time, avg_ping, avg_pool, avg_tcps, avg_udps, delta_tcp_in, delta_tcp_out, delta_udp_in, delta_udp_out, avg_speed_in, avg_speed_out
+	query := h.tunnelService.Rebind(`SELECT record_time, avg_ping, avg_pool, avg_tcps, avg_udps, delta_tcp_in, delta_tcp_out, delta_udp_in, delta_udp_out, avg_speed_in, avg_speed_out,
+			  COALESCE(p50_ping, 0), COALESCE(p90_ping, 0), COALESCE(p99_ping, 0), COALESCE(max_ping, 0), COALESCE(jitter_ping, 0)
 			  FROM service_history
 			  WHERE instance_id = ? AND record_time >= ?
 			  ORDER BY record_time ASC`)
@@ -430,9 +547,15 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 			DeltaUDPOut float64   `json:"delta_udp_out"`
 			AvgSpeedIn  float64   `json:"avg_speed_in"`
 			AvgSpeedOut float64   `json:"avg_speed_out"`
+			P50Ping     float64   `json:"p50_ping"`
+			P90Ping     float64   `json:"p90_ping"`
+			P99Ping     float64   `json:"p99_ping"`
+			MaxPing     float64   `json:"max_ping"`
+			JitterPing  float64   `json:"jitter_ping"`
 		}
 
-		if err := rows.Scan(&metric.RecordTime, &metric.AvgPing, &metric.AvgPool, &metric.AvgTCPs, &metric.AvgUDPs, &metric.DeltaTCPIn, &metric.DeltaTCPOut, &metric.DeltaUDPIn, &metric.DeltaUDPOut, &metric.AvgSpeedIn, &metric.AvgSpeedOut); err != nil {
+		if err := rows.Scan(&metric.RecordTime, &metric.AvgPing, &metric.AvgPool, &metric.AvgTCPs, &metric.AvgUDPs, &metric.DeltaTCPIn, &metric.DeltaTCPOut, &metric.DeltaUDPIn, &metric.DeltaUDPOut, &metric.AvgSpeedIn, &metric.AvgSpeedOut,
+			&metric.P50Ping, &metric.P90Ping, &metric.P99Ping, &metric.MaxPing, &metric.JitterPing); err != nil {
 			return nil, err
 		}
 
@@ -462,6 +585,12 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 			tcpOutData []float64
 			udpInData  []float64
 			udpOutData []float64
+			// 延迟分布
+			pingP50    []float64
+			pingP90    []float64
+			pingP99    []float64
+			pingMax    []float64
+			pingJitter []float64
 		)
 
 		// 按时间排序
@@ -485,6 +614,11 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 			tcpOutData = append(tcpOutData, metric.DeltaTCPOut)
 			udpInData = append(udpInData, metric.DeltaUDPIn)
 			udpOutData = append(udpOutData, metric.DeltaUDPOut)
+			pingP50 = append(pingP50, metric.P50Ping)
+			pingP90 = append(pingP90, metric.P90Ping)
+			pingP99 = append(pingP99, metric.P99Ping)
+			pingMax = append(pingMax, metric.MaxPing)
+			pingJitter = append(pingJitter, metric.JitterPing)
 
 		}
 
@@ -497,6 +631,11 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 			"ping": map[string]interface{}{
 				"avg_delay":  pingData,
 				"created_at": timestampsMs,
+				"p50":        pingP50,
+				"p90":        pingP90,
+				"p99":        pingP99,
+				"max":        pingMax,
+				"jitter":     pingJitter,
 			},
 			"pool": map[string]interface{}{
 				"avg_delay":  poolData,
@@ -546,6 +685,78 @@ func (h *TunnelMetricsHandler) getUnifiedTrendDataFromServiceHistory(instanceID
 	return h.createEmptyTrendData(hours), nil
 }
 
+// getUnifiedTrendDataFromRollup 从降采样表获取统一的趋势数据
+func (h *TunnelMetricsHandler) getUnifiedTrendDataFromRollup(instanceID string, tier models.RollupTier, hours int) (map[string]interface{}, error) {
+	rows, err := h.rollupService.Query(instanceID, tier, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[API] 降采样查询结果: instanceID=%s, tier=%s, 找到 %d 条记录", instanceID, tier, len(rows))
+	return buildRollupTrendData(rows), nil
+}
+
+// buildRollupTrendData 将降采样记录转换为与分钟数据一致的趋势结构
+// 流量序列沿用分钟数据的累计值含义，另提供 traffic_delta 表示桶内增量；
+// 延迟、连接池等序列为加权平均值，并附带 min/max，延迟另附分位数与抖动
+func buildRollupTrendData(rows []models.ServiceHistoryRollup) map[string]interface{} {
+	n := len(rows)
+	timestampsMs := make([]int64, n)
+	series := func() []float64 { return make([]float64, n) }
+	var (
+		trafficData, trafficDelta            = series(), series()
+		pingData, pingMin, pingMax           = series(), series(), series()
+		pingP50, pingP90, pingP99            = series(), series(), series()
+		pingJitter                           = series()
+		poolData, poolMin, poolMax           = series(), series(), series()
+		tcpsData, tcpsMax, udpsData, udpsMax = series(), series(), series(), series()
+		speedInData, speedInMax              = series(), series()
+		speedOutData, speedOutMax            = series(), series()
+		tcpInData, tcpOutData                = series(), series()
+		udpInData, udpOutData                = series(), series()
+	)
+	for i, r := range rows {
+		timestampsMs[i] = r.BucketTime.UnixMilli()
+		trafficData[i] = float64(r.LastTCPIn + r.LastTCPOut + r.LastUDPIn + r.LastUDPOut)
+		trafficDelta[i] = float64(r.DeltaTCPIn + r.DeltaTCPOut + r.DeltaUDPIn + r.DeltaUDPOut)
+		pingData[i], pingMin[i], pingMax[i] = r.AvgPing, r.MinPing, r.MaxPing
+		pingP50[i], pingP90[i], pingP99[i], pingJitter[i] = r.P50Ping, r.P90Ping, r.P99Ping, r.JitterPing
+		poolData[i], poolMin[i], poolMax[i] = r.AvgPool, r.MinPool, r.MaxPool
+		tcpsData[i], tcpsMax[i] = r.AvgTCPs, r.MaxTCPs
+		udpsData[i], udpsMax[i] = r.AvgUDPs, r.MaxUDPs
+		speedInData[i], speedInMax[i] = r.AvgSpeedIn, r.MaxSpeedIn
+		speedOutData[i], speedOutMax[i] = r.AvgSpeedOut, r.MaxSpeedOut
+		tcpInData[i], tcpOutData[i] = float64(r.LastTCPIn), float64(r.LastTCPOut)
+		udpInData[i], udpOutData[i] = float64(r.LastUDPIn), float64(r.LastUDPOut)
+	}
+
+	withRange := func(avg, min, max []float64) map[string]interface{} {
+		m := map[string]interface{}{"avg_delay": avg, "created_at": timestampsMs}
+		if min != nil {
+			m["min"] = min
+		}
+		if max != nil {
+			m["max"] = max
+		}
+		return m
+	}
+	ping := withRange(pingData, pingMin, pingMax)
+	ping["p50"], ping["p90"], ping["p99"], ping["jitter"] = pingP50, pingP90, pingP99, pingJitter
+	return map[string]interface{}{
+		"traffic":       withRange(trafficData, nil, nil),
+		"traffic_delta": withRange(trafficDelta, nil, nil),
+		"ping":          ping,
+		"pool":          withRange(poolData, poolMin, poolMax),
+		"tcps":          withRange(tcpsData, nil, tcpsMax),
+		"udps":          withRange(udpsData, nil, udpsMax),
+		"speed_in":      withRange(speedInData, nil, speedInMax),
+		"speed_out":     withRange(speedOutData, nil, speedOutMax),
+		"tcp_in":        withRange(tcpInData, nil, nil),
+		"tcp_out":       withRange(tcpOutData, nil, nil),
+		"udp_in":        withRange(udpInData, nil, nil),
+		"udp_out":       withRange(udpOutData, nil, nil),
+	}
+}
+
 // getUnifiedTrendData 获取统一的趋势数据，确保时间戳对齐（保留原方法用于兼容）
 // func (h *TunnelMetricsHandler) getUnifiedTrendData(endpointID int64, instanceID string, hours int) (map[string]interface{}, error) {
 // 	// 直接从 MinuteMetrics 表查询数据
@@ -723,6 +934,11 @@ func (h *TunnelMetricsHandler) createEmptyTrendData(hours int) map[string]interf
 		"ping": map[string]interface{}{
 			"avg_delay":  emptyData,
 			"created_at": timestampsMs,
+			"p50":        emptyData,
+			"p90":        emptyData,
+			"p99":        emptyData,
+			"max":        emptyData,
+			"jitter":     emptyData,
 		},
 		"pool": map[string]interface{}{
 			"avg_delay":  emptyData,
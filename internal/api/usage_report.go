@@ -0,0 +1,160 @@
+package api
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/report"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UsageReportHandler 用量报表处理器
+type UsageReportHandler struct {
+	reportService *report.Service
+}
+
+// NewUsageReportHandler 创建用量报表处理器
+func NewUsageReportHandler(reportService *report.Service) *UsageReportHandler {
+	return &UsageReportHandler{reportService: reportService}
+}
+
+// SetupUsageReportRoutes 设置用量报表相关路由
+func SetupUsageReportRoutes(rg *gin.RouterGroup, reportService *report.Service) {
+	usageReportHandler := NewUsageReportHandler(reportService)
+
+	rg.GET("/reports/usage", usageReportHandler.HandleGenerateReport)
+	rg.GET("/reports/usage/config", usageReportHandler.HandleGetConfig)
+	rg.PUT("/reports/usage/config", usageReportHandler.HandleUpdateConfig)
+	rg.GET("/reports/usage/monthly", usageReportHandler.HandleListMonthly)
+	rg.POST("/reports/usage/monthly", usageReportHandler.HandleGenerateMonthly)
+	rg.GET("/reports/usage/monthly/:id", usageReportHandler.HandleGetMonthly)
+}
+
+// HandleGenerateReport 按需生成用量报表
+// (GET /api/reports/usage?from=&to=&tz=&groupBy=tunnel|endpoint|group|service|tag&tagKey=&format=json|csv|xlsx)
+func (h *UsageReportHandler) HandleGenerateReport(c *gin.Context) {
+	tz := c.Query("tz")
+	from, to, err := report.ParseRange(c.Query("from"), c.Query("to"), tz)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r, err := h.reportService.Generate(report.Query{
+		From:     from,
+		To:       to,
+		Timezone: tz,
+		GroupBy:  models.UsageReportGroupBy(c.DefaultQuery("groupBy", string(models.UsageGroupByTunnel))),
+		TagKey:   c.Query("tagKey"),
+	})
+	if err != nil {
+		if errors.Is(err, report.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeUsageReport(c, r)
+}
+
+// HandleGetConfig 获取月报配置
+func (h *UsageReportHandler) HandleGetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "config": h.reportService.Config()})
+}
+
+// HandleUpdateConfig 更新月报配置
+func (h *UsageReportHandler) HandleUpdateConfig(c *gin.Context) {
+	cfg := h.reportService.Config()
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	if err := h.reportService.SetConfig(cfg); err != nil {
+		if errors.Is(err, report.ErrInvalidConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "报表配置已更新", "config": cfg})
+}
+
+// HandleListMonthly 列出已生成的月报，可按 period 筛选
+func (h *UsageReportHandler) HandleListMonthly(c *gin.Context) {
+	reports, err := h.reportService.ListMonthly(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "reports": reports})
+}
+
+// HandleGenerateMonthly 立即（重新）生成指定月份的月报
+func (h *UsageReportHandler) HandleGenerateMonthly(c *gin.Context) {
+	var req struct {
+		Period string `json:"period" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+
+	reports, err := h.reportService.GenerateMonthly(req.Period)
+	if err != nil {
+		if errors.Is(err, report.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "月报已生成", "reports": reports})
+}
+
+// HandleGetMonthly 获取或下载单个月报 (format=json|csv|xlsx)
+func (h *UsageReportHandler) HandleGetMonthly(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的报表ID"})
+		return
+	}
+
+	r, err := h.reportService.GetMonthly(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "报表不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeUsageReport(c, r)
+}
+
+// writeUsageReport 按 format 参数输出报表
+func writeUsageReport(c *gin.Context, r *models.UsageReport) {
+	filename := report.Filename(r)
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", report.ToCSV(r))
+	case "xlsx":
+		data, err := report.ToXLSX(r)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename+".xlsx")
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", data)
+	case "json":
+		c.JSON(http.StatusOK, gin.H{"success": true, "report": r})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 仅支持 json、csv、xlsx"})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/sysconfig"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -67,41 +68,23 @@ func (s *Service) GetSystemConfig(key string) (string, error) {
 		return value.(string), nil
 	}
 
-	// 使用GORM查询数据库（用 Find+Limit 避免 First 把 not-found 打成 ERROR 日志）
-	var configs []models.SystemConfig
-	if err := s.db.Where("key = ?", key).Limit(1).Find(&configs).Error; err != nil {
+	value, ok, err := sysconfig.Get(s.db, key)
+	if err != nil {
 		return "", err
 	}
-	if len(configs) == 0 {
+	if !ok {
 		return "", errors.New("configuration does not exist")
 	}
-	config := configs[0]
 
 	// 写入缓存
-	s.configCache.Store(key, config.Value)
-	return config.Value, nil
+	s.configCache.Store(key, value)
+	return value, nil
 }
 
 // SetSystemConfig 设置系统配置
 func (s *Service) SetSystemConfig(key, value string) error {
-	// 使用GORM的Upsert操作 (Create or Update)
-	config := models.SystemConfig{
-		Key:   key,
-		Value: value,
-	}
-
-	// 先尝试更新，如果不存在则创建
-	result := s.db.Where("key = ?", key).Updates(&config)
-	if result.Error != nil {
-		return result.Error
-	}
-
-	// 如果没有更新任何行，则创建新记录
-	if result.RowsAffected == 0 {
-		err := s.db.Create(&config).Error
-		if err != nil {
-			return err
-		}
+	if err := sysconfig.Set(s.db, key, value); err != nil {
+		return err
 	}
 
 	// 更新缓存
@@ -120,9 +103,7 @@ func (s *Service) GetSystemConfigWithDefault(key, defaultValue string) string {
 
 // DeleteSystemConfig 删除系统配置
 func (s *Service) DeleteSystemConfig(key string) error {
-	// 使用GORM删除
-	err := s.db.Where("key = ?", key).Delete(&models.SystemConfig{}).Error
-	if err != nil {
+	if err := sysconfig.Delete(s.db, key); err != nil {
 		return err
 	}
 
@@ -94,6 +94,7 @@ func (m *Manager) initStrategies() {
 		NewMonitoringRecordsCleanupStrategy(), // 优先级4：监控记录清理
 		NewServiceLogsCleanupStrategy(),       // 优先级5：服务日志清理
 		NewDeletedEndpointsCleanupStrategy(),  // 优先级6：已删除端点清理
+		NewAlertHistoryCleanupStrategy(),      // 优先级7：告警历史清理
 	}
 }
 
@@ -429,3 +429,62 @@ func (s *DeletedEndpointsCleanupStrategy) Execute(ctx context.Context, db *gorm.
 
 	return result, nil
 }
+
+// AlertHistoryCleanupStrategy 告警历史清理策略
+type AlertHistoryCleanupStrategy struct{}
+
+func NewAlertHistoryCleanupStrategy() *AlertHistoryCleanupStrategy {
+	return &AlertHistoryCleanupStrategy{}
+}
+
+func (s *AlertHistoryCleanupStrategy) Name() string {
+	return "AlertHistoryCleanup"
+}
+
+func (s *AlertHistoryCleanupStrategy) Priority() int {
+	return 7
+}
+
+func (s *AlertHistoryCleanupStrategy) Execute(ctx context.Context, db *gorm.DB, config *CleanupConfig) (*CleanupResult, error) {
+	startTime := time.Now()
+	result := &CleanupResult{
+		StrategyName:   s.Name(),
+		TablesAffected: []string{"log_alerts"},
+	}
+
+	cutoff := config.GetAlertHistoryCutoff()
+	var totalDeleted int64
+
+	// 分批清理过期的日志告警记录
+	if db.Migrator().HasTable(&models.LogAlert{}) {
+		batchSize := config.BatchConfig.BatchDeleteSize
+		if batchSize <= 0 {
+			batchSize = 500
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+
+			res := db.Exec("DELETE FROM log_alerts WHERE id IN (SELECT id FROM log_alerts WHERE created_at < ? LIMIT ?)",
+				cutoff, batchSize)
+			if res.Error != nil {
+				return nil, fmt.Errorf("删除告警历史失败: %v", res.Error)
+			}
+			totalDeleted += res.RowsAffected
+			if res.RowsAffected < int64(batchSize) {
+				break
+			}
+		}
+		if totalDeleted > 0 {
+			log.Infof("清理了 %d 条过期告警历史", totalDeleted)
+		}
+	}
+
+	result.RecordsDeleted = totalDeleted
+	result.Duration = time.Since(startTime)
+
+	return result, nil
+}
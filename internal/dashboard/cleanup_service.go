@@ -251,6 +251,11 @@ func (s *CleanupService) cleanupOperationLogs() CleanupResult {
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	// 主控状态变化记录与操作日志共用保留时间
+	if err := s.db.Exec("DELETE FROM endpoint_status_events WHERE created_at < ?", cutoffTime).Error; err != nil && result.Error == nil {
+		result.Error = fmt.Errorf("删除主控状态变化记录失败: %v", err)
+	}
+
 	result.DeletedCount = totalDeleted
 	result.Duration = time.Since(start)
 
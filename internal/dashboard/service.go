@@ -3,6 +3,7 @@ package dashboard
 import (
 	"NodePassDash/internal/db"
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/timezone"
 	"fmt"
 	"sort"
 	"strings"
@@ -26,8 +27,8 @@ func (s *Service) DB() *gorm.DB {
 	return s.db
 }
 
-// GetStats 获取仪表盘统计数据
-func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
+// GetStats 获取仪表盘统计数据，"今日"按 loc 时区的零点计算
+func (s *Service) GetStats(timeRange TimeRange, loc *time.Location) (*DashboardStats, error) {
 	stats := &DashboardStats{}
 
 	// 获取时间范围
@@ -35,7 +36,7 @@ func (s *Service) GetStats(timeRange TimeRange) (*DashboardStats, error) {
 	var timeCondition string
 	switch timeRange {
 	case TimeRangeToday:
-		startTime = time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, startTime.Location())
+		startTime = timezone.StartOfDay(startTime, loc).In(time.Local)
 		timeCondition = "created_at >= ?"
 	case TimeRangeWeek:
 		startTime = startTime.AddDate(0, 0, -7)
@@ -300,6 +301,7 @@ func formatTrafficBytes(bytes int64) string {
 type TrafficTrendItem struct {
 	HourTime    int64  `json:"hourTime"`    // Unix时间戳（秒）
 	HourDisplay string `json:"hourDisplay"` // 11:00
+	Time        string `json:"time"`        // 带时区偏移的 ISO 8601 时间，如 2024-01-01T11:00:00+08:00
 	TCPRx       int64  `json:"tcpRx"`
 	TCPTx       int64  `json:"tcpTx"`
 	UDPRx       int64  `json:"udpRx"`
@@ -307,13 +309,13 @@ type TrafficTrendItem struct {
 	RecordCount int    `json:"recordCount"`
 }
 
-// GetTodayTraffic 获取当日(本地零点起)所有实例合计的流量增量。
-func (s *Service) GetTodayTraffic() (TodayTrafficIncrement, error) {
-	return NewTrafficService(s.db).GetTodayTrafficIncrement()
+// GetTodayTraffic 获取当日(loc 时区零点起)所有实例合计的流量增量。
+func (s *Service) GetTodayTraffic(loc *time.Location) (TodayTrafficIncrement, error) {
+	return NewTrafficService(s.db).GetTodayTrafficIncrement(loc)
 }
 
-// GetTrafficTrend 获取流量趋势数据
-func (s *Service) GetTrafficTrend(hours int) ([]TrafficTrendItem, error) {
+// GetTrafficTrend 获取流量趋势数据，时间按 loc 时区输出
+func (s *Service) GetTrafficTrend(hours int, loc *time.Location) ([]TrafficTrendItem, error) {
 	// 使用新的dashboard_traffic_summary表获取流量趋势数据
 	end := time.Now()
 	start := end.Add(-time.Duration(hours) * time.Hour)
@@ -331,9 +333,11 @@ func (s *Service) GetTrafficTrend(hours int) ([]TrafficTrendItem, error) {
 	// 转换为TrafficTrendItem格式
 	var result []TrafficTrendItem
 	for _, summary := range summaries {
+		hourTime := summary.HourTime.In(loc)
 		item := TrafficTrendItem{
-			HourTime:    summary.HourTime.Unix(),
-			HourDisplay: summary.HourTime.Format("15:04"),
+			HourTime:    hourTime.Unix(),
+			HourDisplay: hourTime.Format("15:04"),
+			Time:        hourTime.Format(time.RFC3339),
 			TCPRx:       summary.TCPRxTotal,
 			TCPTx:       summary.TCPTxTotal,
 			UDPRx:       summary.UDPRxTotal,
@@ -551,99 +555,56 @@ func (s *Service) processTrafficRecords(records []struct {
 }
 
 // GetWeeklyStats 获取每周流量统计数据
-func (s *Service) GetWeeklyStats() ([]WeeklyStatsItem, error) {
-	// 获取本周的开始时间（周一）
-	now := time.Now()
-	weekday := now.Weekday()
-	// 如果是周日，调整为7
-	if weekday == 0 {
-		weekday = 7
-	}
-	// 计算本周一的日期
-	startOfWeek := now.AddDate(0, 0, -int(weekday-1))
-	startOfWeek = time.Date(startOfWeek.Year(), startOfWeek.Month(), startOfWeek.Day(), 0, 0, 0, 0, startOfWeek.Location())
-
-	// 计算本周日的结束时间
+// 周一至周日及每天的边界按 loc 时区计算，每日流量为当天各整小时增量之和；
+// 查询只按 hour_time 范围过滤，按天归并在 Go 中完成，SQLite 与 PostgreSQL 无方言差异
+func (s *Service) GetWeeklyStats(loc *time.Location) ([]WeeklyStatsItem, error) {
+	// 获取本周的开始时间（周一）与结束时间
+	startOfWeek := timezone.StartOfWeek(time.Now(), loc)
 	endOfWeek := startOfWeek.AddDate(0, 0, 7)
 
-	// 查询每天的流量统计数据
-	var weeklyStats []WeeklyStatsItem
+	// 按小时汇总所有实例的流量增量
+	var hourly []struct {
+		HourTime time.Time
+		TCPIn    int64
+		TCPOut   int64
+		UDPIn    int64
+		UDPOut   int64
+	}
+	err := s.db.Model(&models.TrafficHourlySummary{}).
+		Select(`hour_time,
+			COALESCE(SUM(tcp_rx_increment), 0) AS tcp_in,
+			COALESCE(SUM(tcp_tx_increment), 0) AS tcp_out,
+			COALESCE(SUM(udp_rx_increment), 0) AS udp_in,
+			COALESCE(SUM(udp_tx_increment), 0) AS udp_out`).
+		Where("hour_time >= ? AND hour_time < ?", startOfWeek.In(time.Local), endOfWeek.In(time.Local)).
+		Group("hour_time").
+		Scan(&hourly).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询每周流量统计失败: %v", err)
+	}
 
 	// 为每一天创建统计记录
-	for i := 0; i < 7; i++ {
+	weeklyStats := make([]WeeklyStatsItem, 7)
+	for i := range weeklyStats {
 		currentDay := startOfWeek.AddDate(0, 0, i)
-
-		// 获取当天的流量数据
-		var dayStats struct {
-			TCPIn  int64 `json:"tcp_in"`
-			TCPOut int64 `json:"tcp_out"`
-			UDPIn  int64 `json:"udp_in"`
-			UDPOut int64 `json:"udp_out"`
+		weeklyStats[i] = WeeklyStatsItem{
+			Weekday:   []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}[currentDay.Weekday()],
+			WeekdayZh: []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}[currentDay.Weekday()],
+			Date:      currentDay.Format("2006-01-02"),
 		}
-
-		// 从dashboard_traffic_summary表查询当天的累计流量
-		// 使用当天最后一条记录减去前一天最后一条记录
-		err := s.db.Raw(`
-			SELECT
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN tcp_rx_total END), 0) -
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN tcp_rx_total END), 0) as tcp_in,
-
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN tcp_tx_total END), 0) -
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN tcp_tx_total END), 0) as tcp_out,
-
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN udp_rx_total END), 0) -
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN udp_rx_total END), 0) as udp_in,
-
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN udp_tx_total END), 0) -
-				COALESCE(MAX(CASE WHEN DATE(hour_time) = DATE(?) THEN udp_tx_total END), 0) as udp_out
-			FROM dashboard_traffic_summary
-			WHERE hour_time >= ? AND hour_time < ?
-		`, currentDay, currentDay.AddDate(0, 0, -1),
-		   currentDay, currentDay.AddDate(0, 0, -1),
-		   currentDay, currentDay.AddDate(0, 0, -1),
-		   currentDay, currentDay.AddDate(0, 0, -1),
-		   startOfWeek, endOfWeek).Scan(&dayStats).Error
-
-		if err != nil {
-			// 如果查询失败，使用简化的查询方式
-			err = s.db.Raw(`
-				SELECT
-					COALESCE(SUM(tcp_rx_total), 0) as tcp_in,
-					COALESCE(SUM(tcp_tx_total), 0) as tcp_out,
-					COALESCE(SUM(udp_rx_total), 0) as udp_in,
-					COALESCE(SUM(udp_tx_total), 0) as udp_out
-				FROM dashboard_traffic_summary
-				WHERE DATE(hour_time) = DATE(?)
-			`, currentDay).Scan(&dayStats).Error
-
-			if err != nil {
-				// 如果仍然失败，设置为0
-				dayStats = struct {
-					TCPIn  int64 `json:"tcp_in"`
-					TCPOut int64 `json:"tcp_out"`
-					UDPIn  int64 `json:"udp_in"`
-					UDPOut int64 `json:"udp_out"`
-				}{0, 0, 0, 0}
-			}
-		}
-
-		// 获取星期几的名称
-		weekdayName := []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}[currentDay.Weekday()]
-		weekdayNameZh := []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}[currentDay.Weekday()]
-
-		// 创建统计项
-		statsItem := WeeklyStatsItem{
-			Weekday:    weekdayName,
-			WeekdayZh:  weekdayNameZh,
-			Date:       currentDay.Format("2006-01-02"),
-			TCPIn:      dayStats.TCPIn,
-			TCPOut:     dayStats.TCPOut,
-			UDPIn:      dayStats.UDPIn,
-			UDPOut:     dayStats.UDPOut,
-			TotalBytes: dayStats.TCPIn + dayStats.TCPOut + dayStats.UDPIn + dayStats.UDPOut,
+	}
+	for _, h := range hourly {
+		hourTime := h.HourTime.In(loc)
+		day := int(timezone.StartOfDay(hourTime, loc).Sub(startOfWeek).Hours()+12) / 24
+		if day < 0 || day >= len(weeklyStats) {
+			continue
 		}
-
-		weeklyStats = append(weeklyStats, statsItem)
+		item := &weeklyStats[day]
+		item.TCPIn += h.TCPIn
+		item.TCPOut += h.TCPOut
+		item.UDPIn += h.UDPIn
+		item.UDPOut += h.UDPOut
+		item.TotalBytes += h.TCPIn + h.TCPOut + h.UDPIn + h.UDPOut
 	}
 
 	return weeklyStats, nil
@@ -0,0 +1,72 @@
+package dashboard
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTimezoneDayBoundaries(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.TrafficHourlySummary{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// 选择一个固定偏移，使当前时间在该时区为凌晨 2 点多：
+	// 1 小时前属于今天，3 小时前属于昨天
+	now := time.Now()
+	offset := 2 - now.UTC().Hour()
+	if offset < -12 {
+		offset += 24
+	}
+	loc := time.FixedZone("test", offset*3600)
+	hour := now.Truncate(time.Hour)
+	for _, r := range []struct {
+		ago   int
+		bytes int64
+	}{{1, 100}, {3, 40}} {
+		db.Create(&models.TrafficHourlySummary{HourTime: hour.Add(-time.Duration(r.ago) * time.Hour),
+			EndpointID: 1, InstanceID: "a", TCPRxIncrement: r.bytes})
+	}
+
+	s := NewService(db)
+	today, err := s.GetTodayTraffic(loc)
+	if err != nil {
+		t.Fatalf("GetTodayTraffic: %v", err)
+	}
+	if today.Total() != 100 {
+		t.Errorf("today total = %d, want 100", today.Total())
+	}
+
+	weekly, err := s.GetWeeklyStats(loc)
+	if err != nil {
+		t.Fatalf("GetWeeklyStats: %v", err)
+	}
+	todayDate := now.In(loc).Format("2006-01-02")
+	yesterdayDate := now.In(loc).AddDate(0, 0, -1).Format("2006-01-02")
+	for _, item := range weekly {
+		switch item.Date {
+		case todayDate:
+			if item.TotalBytes != 100 {
+				t.Errorf("today weekly item = %+v", item)
+			}
+		case yesterdayDate:
+			if item.TotalBytes != 40 {
+				t.Errorf("yesterday weekly item = %+v", item)
+			}
+		default:
+			if item.TotalBytes != 0 {
+				t.Errorf("unexpected traffic on %+v", item)
+			}
+		}
+	}
+	if len(weekly) != 7 || weekly[0].Weekday != "Mon" {
+		t.Errorf("weekly = %+v", weekly)
+	}
+}
@@ -0,0 +1,308 @@
+package dashboard
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/report"
+	"NodePassDash/internal/sse"
+	"NodePassDash/internal/timezone"
+)
+
+// TopMetric 排行榜指标
+type TopMetric string
+
+const (
+	TopMetricTraffic     TopMetric = "traffic"     // 窗口内流量（字节），对比上一个窗口
+	TopMetricRate        TopMetric = "rate"        // 实时速率（字节/秒），对比窗口内平均速率
+	TopMetricConnections TopMetric = "connections" // 实时 TCP+UDP 连接数，对比窗口内平均值
+	TopMetricLatency     TopMetric = "latency"     // 实时延迟（毫秒，分组取平均），对比窗口内平均值
+)
+
+const (
+	// LiveMaxAge 实时数据的有效期，超过该时间未更新的实例视为无实时数据
+	LiveMaxAge = 2 * time.Minute
+
+	topMaxHours      = 180 * 24 // traffic_hourly_summary 保留一年，需容纳两个窗口
+	topMaxGaugeHours = 7 * 24   // service_history 只保留 7 天
+	topMaxLimit      = 100
+)
+
+// ErrInvalidTopQuery 排行榜查询参数不合法
+var ErrInvalidTopQuery = errors.New("无效的排行榜查询")
+
+// TopQuery 排行榜查询参数
+type TopQuery struct {
+	Dimension models.UsageReportGroupBy // tunnel、endpoint、group、service
+	Metric    TopMetric
+	Hours     int
+	Limit     int
+}
+
+// TopItem 排行榜条目
+type TopItem struct {
+	Rank         int      `json:"rank"`
+	Key          string   `json:"key"`
+	Name         string   `json:"name"`
+	Tunnels      int      `json:"tunnels"`
+	Value        float64  `json:"value"`
+	Previous     float64  `json:"previous"`
+	Delta        float64  `json:"delta"`
+	DeltaPercent *float64 `json:"deltaPercent"` // 对比值为 0 时为 null
+	PreviousRank int      `json:"previousRank"` // 按对比值的排名，0 表示对比值为 0
+}
+
+// TopResult 排行榜结果
+type TopResult struct {
+	Dimension   models.UsageReportGroupBy `json:"dimension"`
+	Metric      TopMetric                 `json:"metric"`
+	Unit        string                    `json:"unit"`
+	Comparison  string                    `json:"comparison"` // previous_window 或 window_average
+	Hours       int                       `json:"hours"`
+	WindowStart time.Time                 `json:"windowStart"`
+	WindowEnd   time.Time                 `json:"windowEnd"`
+	Items       []TopItem                 `json:"items"`
+}
+
+// instanceValues 按 endpointID:instanceID 索引的实例指标
+type instanceValues map[string]float64
+
+func instanceKey(endpointID int64, instanceID string) string {
+	return strconv.FormatInt(endpointID, 10) + ":" + instanceID
+}
+
+// GetTop 计算排行榜
+// 流量取自 traffic_hourly_summary 的已完成整小时；速率、连接数、延迟取自内存中的实时数据，
+// 并与窗口内平均值（速率来自整小时汇总，连接数与延迟来自 service_history）对比
+func (s *Service) GetTop(q TopQuery, live []sse.LiveSnapshot) (*TopResult, error) {
+	switch q.Dimension {
+	case models.UsageGroupByTunnel, models.UsageGroupByEndpoint, models.UsageGroupByGroup, models.UsageGroupByService:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的维度 %q", ErrInvalidTopQuery, q.Dimension)
+	}
+	if q.Hours <= 0 {
+		q.Hours = 24
+	}
+	if q.Limit <= 0 {
+		q.Limit = 10
+	}
+	if q.Hours > topMaxHours || q.Limit > topMaxLimit {
+		return nil, fmt.Errorf("%w: hours 不能超过 %d，limit 不能超过 %d", ErrInvalidTopQuery, topMaxHours, topMaxLimit)
+	}
+
+	window := time.Duration(q.Hours) * time.Hour
+	result := &TopResult{Dimension: q.Dimension, Metric: q.Metric, Hours: q.Hours, Comparison: "window_average"}
+	var current, previous instanceValues
+	var err error
+	switch q.Metric {
+	case TopMetricTraffic:
+		result.Unit, result.Comparison = "bytes", "previous_window"
+		// 窗口按本地整点切分，与 traffic_hourly_summary 的 hour_time 对齐
+		result.WindowEnd = timezone.StartOfHour(time.Now(), time.Local)
+		result.WindowStart = result.WindowEnd.Add(-window)
+		if current, err = s.hourlyTraffic(result.WindowStart, result.WindowEnd); err != nil {
+			return nil, err
+		}
+		previous, err = s.hourlyTraffic(result.WindowStart.Add(-window), result.WindowStart)
+	case TopMetricRate:
+		result.Unit = "bytes/s"
+		result.WindowEnd = timezone.StartOfHour(time.Now(), time.Local)
+		result.WindowStart = result.WindowEnd.Add(-window)
+		current = liveValues(live, func(l sse.LiveSnapshot) (float64, bool) { return l.SpeedIn + l.SpeedOut, true })
+		if previous, err = s.hourlyTraffic(result.WindowStart, result.WindowEnd); err == nil {
+			for k, v := range previous {
+				previous[k] = v / window.Seconds()
+			}
+		}
+	case TopMetricConnections:
+		result.Unit = "connections"
+		result.WindowEnd = time.Now()
+		result.WindowStart = result.WindowEnd.Add(-gaugeWindow(q.Hours))
+		current = liveValues(live, func(l sse.LiveSnapshot) (float64, bool) {
+			return float64(derefInt64(l.TCPs) + derefInt64(l.UDPs)), l.TCPs != nil || l.UDPs != nil
+		})
+		previous, err = s.historyAverage("avg_tcps + avg_udps", "", result.WindowStart)
+	case TopMetricLatency:
+		result.Unit = "ms"
+		result.WindowEnd = time.Now()
+		result.WindowStart = result.WindowEnd.Add(-gaugeWindow(q.Hours))
+		current = liveValues(live, func(l sse.LiveSnapshot) (float64, bool) {
+			return float64(derefInt64(l.Ping)), l.Ping != nil && *l.Ping > 0
+		})
+		previous, err = s.historyAverage("avg_ping", "avg_ping > 0", result.WindowStart)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的指标 %q", ErrInvalidTopQuery, q.Metric)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := report.LoadMembers(s.db, q.Dimension, "")
+	if err != nil {
+		return nil, err
+	}
+	result.Items = rankTop(members, current, previous, q.Metric == TopMetricLatency, q.Limit)
+	return result, nil
+}
+
+// gaugeWindow 连接数与延迟的对比窗口受 service_history 保留时间限制
+func gaugeWindow(hours int) time.Duration {
+	if hours > topMaxGaugeHours {
+		hours = topMaxGaugeHours
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// hourlyTraffic 汇总 [start, end) 内各实例的整小时流量增量
+func (s *Service) hourlyTraffic(start, end time.Time) (instanceValues, error) {
+	var rows []struct {
+		EndpointID int64
+		InstanceID string
+		Total      int64
+	}
+	if err := s.db.Model(&models.TrafficHourlySummary{}).
+		Select("endpoint_id, instance_id, SUM(tcp_rx_increment + tcp_tx_increment + udp_rx_increment + udp_tx_increment) AS total").
+		Where("hour_time >= ? AND hour_time < ? AND instance_id <> ''", start, end).
+		Group("endpoint_id, instance_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	values := make(instanceValues, len(rows))
+	for _, r := range rows {
+		values[instanceKey(r.EndpointID, r.InstanceID)] = float64(r.Total)
+	}
+	return values, nil
+}
+
+// historyAverage 计算 service_history 中 since 之后各实例某个表达式的平均值
+func (s *Service) historyAverage(expr, cond string, since time.Time) (instanceValues, error) {
+	var rows []struct {
+		EndpointID int64
+		InstanceID string
+		Value      float64
+	}
+	query := s.db.Model(&models.ServiceHistory{}).
+		Select("endpoint_id, instance_id, AVG("+expr+") AS value").
+		Where("record_time >= ? AND instance_id <> ''", since)
+	if cond != "" {
+		query = query.Where(cond)
+	}
+	if err := query.Group("endpoint_id, instance_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	values := make(instanceValues, len(rows))
+	for _, r := range rows {
+		values[instanceKey(r.EndpointID, r.InstanceID)] = r.Value
+	}
+	return values, nil
+}
+
+func liveValues(live []sse.LiveSnapshot, value func(sse.LiveSnapshot) (float64, bool)) instanceValues {
+	values := make(instanceValues, len(live))
+	for _, l := range live {
+		if v, ok := value(l); ok {
+			values[instanceKey(l.EndpointID, l.InstanceID)] = v
+		}
+	}
+	return values
+}
+
+func derefInt64(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// topGroup 单个分组的累计值
+type topGroup struct {
+	item                    TopItem
+	instances               map[string]bool
+	currentN, previousN     int
+	currentSum, previousSum float64
+}
+
+// rankTop 将实例指标按维度汇总（延迟取平均，其余求和）并排序
+func rankTop(members *report.MemberIndex, current, previous instanceValues, average bool, limit int) []TopItem {
+	groups := make(map[string]*topGroup)
+	collect := func(values instanceValues, isCurrent bool) {
+		for key, v := range values {
+			endpointID, instanceID := splitInstanceKey(key)
+			for _, m := range members.Of(endpointID, instanceID) {
+				g, ok := groups[m.Key]
+				if !ok {
+					g = &topGroup{item: TopItem{Key: m.Key, Name: m.Name}, instances: make(map[string]bool)}
+					groups[m.Key] = g
+				}
+				g.instances[key] = true
+				if isCurrent {
+					g.currentSum += v
+					g.currentN++
+				} else {
+					g.previousSum += v
+					g.previousN++
+				}
+			}
+		}
+	}
+	collect(current, true)
+	collect(previous, false)
+
+	items := make([]TopItem, 0, len(groups))
+	for _, g := range groups {
+		item := g.item
+		item.Tunnels = len(g.instances)
+		item.Value, item.Previous = g.currentSum, g.previousSum
+		if average {
+			if g.currentN > 0 {
+				item.Value /= float64(g.currentN)
+			}
+			if g.previousN > 0 {
+				item.Previous /= float64(g.previousN)
+			}
+		}
+		item.Delta = item.Value - item.Previous
+		if item.Previous != 0 {
+			pct := item.Delta / item.Previous * 100
+			item.DeltaPercent = &pct
+		}
+		items = append(items, item)
+	}
+
+	// 先按对比值排名，再按当前值排名
+	rank := func(value func(TopItem) float64, assign func(*TopItem, int)) {
+		sort.Slice(items, func(i, j int) bool {
+			if value(items[i]) != value(items[j]) {
+				return value(items[i]) > value(items[j])
+			}
+			return items[i].Key < items[j].Key
+		})
+		for i := range items {
+			if value(items[i]) > 0 {
+				assign(&items[i], i+1)
+			}
+		}
+	}
+	rank(func(t TopItem) float64 { return t.Previous }, func(t *TopItem, r int) { t.PreviousRank = r })
+	rank(func(t TopItem) float64 { return t.Value }, func(t *TopItem, r int) { t.Rank = r })
+
+	top := make([]TopItem, 0, limit)
+	for _, item := range items {
+		if item.Rank == 0 || len(top) == limit {
+			break
+		}
+		top = append(top, item)
+	}
+	return top
+}
+
+func splitInstanceKey(key string) (int64, string) {
+	endpoint, instanceID, _ := strings.Cut(key, ":")
+	id, _ := strconv.ParseInt(endpoint, 10, 64)
+	return id, instanceID
+}
@@ -0,0 +1,73 @@
+package dashboard
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/sse"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGetTop(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.Group{}, &models.TunnelGroup{},
+		&models.Services{}, &models.TrafficHourlySummary{}, &models.ServiceHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	a, b, c := "a", "b", "c"
+	db.Create(&models.Tunnel{ID: 1, Name: "web", EndpointID: 1, InstanceID: &a})
+	db.Create(&models.Tunnel{ID: 2, Name: "game", EndpointID: 1, InstanceID: &b})
+	db.Create(&models.Tunnel{ID: 3, Name: "ssh", EndpointID: 2, InstanceID: &c})
+
+	// 当前 24 小时：a=300 b=100 c=50；上一个 24 小时：a=100 b=200
+	end := time.Now().Truncate(time.Hour)
+	for _, r := range []struct {
+		instance string
+		endpoint int64
+		ago      int
+		bytes    int64
+	}{{"a", 1, 1, 300}, {"b", 1, 2, 100}, {"c", 2, 3, 50}, {"a", 1, 30, 100}, {"b", 1, 40, 200}} {
+		db.Create(&models.TrafficHourlySummary{HourTime: end.Add(-time.Duration(r.ago) * time.Hour),
+			EndpointID: r.endpoint, InstanceID: r.instance, TCPRxIncrement: r.bytes})
+	}
+
+	s := NewService(db)
+	top, err := s.GetTop(TopQuery{Dimension: models.UsageGroupByTunnel, Metric: TopMetricTraffic, Limit: 2}, nil)
+	if err != nil {
+		t.Fatalf("GetTop: %v", err)
+	}
+	if len(top.Items) != 2 {
+		t.Fatalf("items = %+v", top.Items)
+	}
+	if first := top.Items[0]; first.Name != "web" || first.Value != 300 || first.Previous != 100 ||
+		first.Rank != 1 || first.PreviousRank != 2 || first.DeltaPercent == nil || *first.DeltaPercent != 200 {
+		t.Errorf("first = %+v", first)
+	}
+	if second := top.Items[1]; second.Name != "game" || second.Delta != -100 || second.PreviousRank != 1 {
+		t.Errorf("second = %+v", second)
+	}
+
+	// 实时速率按主控汇总，对比窗口内平均速率
+	live := []sse.LiveSnapshot{
+		{EndpointID: 1, InstanceID: "a", SpeedIn: 10, SpeedOut: 5},
+		{EndpointID: 1, InstanceID: "b", SpeedIn: 1},
+		{EndpointID: 2, InstanceID: "c", SpeedIn: 100},
+	}
+	top, err = s.GetTop(TopQuery{Dimension: models.UsageGroupByEndpoint, Metric: TopMetricRate}, live)
+	if err != nil {
+		t.Fatalf("GetTop rate: %v", err)
+	}
+	if len(top.Items) != 2 || top.Items[0].Key != "2" || top.Items[1].Value != 16 || top.Items[1].Tunnels != 2 ||
+		top.Items[1].Previous != 400.0/(24*3600) {
+		t.Errorf("rate items = %+v", top.Items)
+	}
+
+	if _, err := s.GetTop(TopQuery{Dimension: "region", Metric: TopMetricTraffic}, nil); err == nil {
+		t.Error("expected unknown dimension to be rejected")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"NodePassDash/internal/db"
 	"NodePassDash/internal/models"
+	"NodePassDash/internal/timezone"
 
 	"gorm.io/gorm"
 )
@@ -32,15 +33,17 @@ func NewTrafficService(db *gorm.DB) *TrafficService {
 
 // AggregateTrafficData 聚合当前小时的流量数据
 func (s *TrafficService) AggregateTrafficData() error {
-	// 获取上一个整点时间
-	now := time.Now()
-	lastHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()-1, 0, 0, 0, now.Location())
+	// 获取上一个整点时间：按服务器本地时区取整点再减一小时，
+	// 减去绝对时长而不是 Hour()-1，夏令时切换时不会重复或跳过小时
+	lastHour := timezone.StartOfHour(time.Now(), time.Local).Add(-time.Hour)
 	return s.AggregateTrafficDataForHour(lastHour)
 }
 
 // AggregateTrafficDataForHour 为指定小时聚合流量数据
 // 从service_history表获取上一小时59分的累计值，并计算与上一小时的差值
 func (s *TrafficService) AggregateTrafficDataForHour(hourStart time.Time) error {
+	// hour_time 统一以服务器本地时区写入，SQLite 按文本比较时间时与其余查询保持一致
+	hourStart = hourStart.In(time.Local)
 	// 小时窗口结束时间
 	hourEnd := hourStart.Add(1 * time.Hour)
 
@@ -644,13 +647,12 @@ func (t TodayTrafficIncrement) Total() int64 {
 	return t.TCPRx + t.TCPTx + t.UDPRx + t.UDPTx
 }
 
-// GetTodayTrafficIncrement 汇总当日(本地零点起)所有实例的每小时增量。
-// hour_time 在 AggregateTrafficDataForHour 中使用 now.Location() 存入,
-// 因此这里同样用 now.Location() 构造零点边界,SQLite 与 PostgreSQL 走
-// 同一段 gorm 参数化查询,无方言差异。
-func (s *TrafficService) GetTodayTrafficIncrement() (TodayTrafficIncrement, error) {
-	now := time.Now()
-	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+// GetTodayTrafficIncrement 汇总当日(loc 时区零点起)所有实例的每小时增量。
+// 零点边界在 Go 中按 loc 计算后转换为服务器本地时区(与 hour_time 写入时一致),
+// SQLite 与 PostgreSQL 走同一段 gorm 参数化查询,无方言差异。
+// 与服务器时区偏移相差不是整小时(如 +05:30)时,以零点后的第一个小时桶为边界。
+func (s *TrafficService) GetTodayTrafficIncrement(loc *time.Location) (TodayTrafficIncrement, error) {
+	todayStart := timezone.StartOfDay(time.Now(), loc).In(time.Local)
 
 	var result TodayTrafficIncrement
 	err := s.db.Model(&models.TrafficHourlySummary{}).
@@ -391,14 +391,48 @@ func QuickInitSchema(db *gorm.DB) error {
 		&models.Tunnel{},
 		&models.TunnelOperationLog{},
 		&models.TunnelGroup{},
+		&models.TunnelSavedQuery{},
 
 		// 流量统计表
 		&models.TrafficHourlySummary{},
 		&models.DashboardTrafficSummary{},
 		&models.ServiceHistory{},
+		&models.ServiceHistoryRollup{},
+
+		// 流量异常检测表
+		&models.TrafficBaseline{},
+		&models.TrafficAnomalyState{},
+		&models.TrafficAnomaly{},
+		// 用量报表表
+		&models.UsageReport{},
+		// 容量预测表
+		&models.CapacityThreshold{},
+		&models.EndpointSystemSample{},
+		// 主控状态变化表
+		&models.EndpointStatusEvent{},
 
 		// 服务管理表
 		&models.Services{},
+		&models.ServiceHop{},
+
+		// 隧道自愈表
+		&models.HealingPolicy{},
+		&models.TunnelHealingState{},
+		&models.HealingAttempt{},
+
+		// 服务故障转移表
+		&models.ServiceFailoverPolicy{},
+		&models.ServiceFailoverEvent{},
+
+		// 日志告警表
+		&models.LogAlertRule{},
+		&models.LogAlert{},
+
+		// 日志外发表
+		&models.LogSink{},
+
+		// 指标推送目标表
+		&models.MetricPushTarget{},
 	)
 }
 
@@ -419,14 +453,48 @@ func StandardMigrate(db *gorm.DB) error {
 		&models.Tunnel{},
 		&models.TunnelOperationLog{},
 		&models.TunnelGroup{},
+		&models.TunnelSavedQuery{},
 
 		// 流量统计表
 		&models.TrafficHourlySummary{},
 		&models.DashboardTrafficSummary{},
 		&models.ServiceHistory{},
+		&models.ServiceHistoryRollup{},
+
+		// 流量异常检测表
+		&models.TrafficBaseline{},
+		&models.TrafficAnomalyState{},
+		&models.TrafficAnomaly{},
+		// 用量报表表
+		&models.UsageReport{},
+		// 容量预测表
+		&models.CapacityThreshold{},
+		&models.EndpointSystemSample{},
+		// 主控状态变化表
+		&models.EndpointStatusEvent{},
 
 		// 服务管理表
 		&models.Services{},
+		&models.ServiceHop{},
+
+		// 隧道自愈表
+		&models.HealingPolicy{},
+		&models.TunnelHealingState{},
+		&models.HealingAttempt{},
+
+		// 服务故障转移表
+		&models.ServiceFailoverPolicy{},
+		&models.ServiceFailoverEvent{},
+
+		// 日志告警表
+		&models.LogAlertRule{},
+		&models.LogAlert{},
+
+		// 日志外发表
+		&models.LogSink{},
+
+		// 指标推送目标表
+		&models.MetricPushTarget{},
 	)
 }
 
@@ -20,6 +20,11 @@ type Dialect interface {
 	//   Postgres -> peer->>'sid'
 	JSONPath(column, key string) string
 
+	// IntCast 把文本列安全地转换为整数表达式,非数字内容得到 0 / NULL 而不是报错。
+	//   SQLite   -> CAST(tunnel_port AS INTEGER)
+	//   Postgres -> (CASE WHEN tunnel_port ~ '^[0-9]+$' THEN CAST(tunnel_port AS BIGINT) END)
+	IntCast(expr string) string
+
 	// TimeAgo 生成一个 "<field> < (当前时间 - duration)" 的 SQL 片段。
 	// duration 用 SQLite 修饰符语法 ("-30 days" / "-7 days" / "-1 year"),
 	// 内部按方言翻译。返回值已包含 < 比较符。
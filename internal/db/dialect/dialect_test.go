@@ -49,6 +49,16 @@ func TestPostgres_JSONPath(t *testing.T) {
 	}
 }
 
+func TestIntCast(t *testing.T) {
+	if got, want := (SQLite{}).IntCast("t.tunnel_port"), `CAST(t.tunnel_port AS INTEGER)`; got != want {
+		t.Errorf("SQLite got %q, want %q", got, want)
+	}
+	want := `(CASE WHEN t.tunnel_port ~ '^[0-9]+$' THEN CAST(t.tunnel_port AS BIGINT) END)`
+	if got := (Postgres{}).IntCast("t.tunnel_port"); got != want {
+		t.Errorf("Postgres got %q, want %q", got, want)
+	}
+}
+
 func TestSQLite_TimeAgo(t *testing.T) {
 	var d Dialect = SQLite{}
 	got := d.TimeAgo("event_time", "-30 days")
@@ -17,6 +17,11 @@ func (Postgres) JSONPath(column, key string) string {
 	return fmt.Sprintf("(%s::json)->>'%s'", column, key)
 }
 
+func (Postgres) IntCast(expr string) string {
+	// PG 的 CAST 遇到非数字文本会直接报错,先用正则过滤,其余返回 NULL。
+	return fmt.Sprintf("(CASE WHEN %s ~ '^[0-9]+$' THEN CAST(%s AS BIGINT) END)", expr, expr)
+}
+
 func (Postgres) TimeAgo(field, duration string) string {
 	// SQLite 风格传入: "-30 days" / "-7 days" / "-1 year"
 	// 转换为 PG 风格的 INTERVAL,丢掉前导负号(NOW() - INTERVAL 表达式自带减法语义)。
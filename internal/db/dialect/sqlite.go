@@ -11,6 +11,10 @@ func (SQLite) JSONPath(column, key string) string {
 	return fmt.Sprintf("%s->>'$.%s'", column, key)
 }
 
+func (SQLite) IntCast(expr string) string {
+	return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+}
+
 func (SQLite) TimeAgo(field, duration string) string {
 	return fmt.Sprintf("%s < datetime('now', '%s')", field, duration)
 }
@@ -0,0 +1,125 @@
+// Package endpointinfo 定期轮询在线主控的系统信息并缓存，供指标导出与容量预测共用
+package endpointinfo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// PollInterval 主控系统信息轮询间隔
+	PollInterval = 30 * time.Second
+	// pollConcurrency 同时轮询的主控数
+	pollConcurrency = 5
+)
+
+// FetchFunc 获取单个主控系统信息
+type FetchFunc func(endpointID int64) (*nodepass.EndpointInfoResult, error)
+
+// Info 缓存的主控系统信息
+type Info struct {
+	*nodepass.EndpointInfoResult
+	FetchedAt time.Time
+}
+
+// Poller 主控系统信息轮询器，每轮只保留在线且拉取成功的主控
+type Poller struct {
+	db    *gorm.DB
+	fetch FetchFunc
+
+	mu    sync.RWMutex
+	infos map[int64]Info
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPoller 创建轮询器，fetch 为空时使用 nodepass.GetInfo
+func NewPoller(db *gorm.DB, fetch FetchFunc) *Poller {
+	if fetch == nil {
+		fetch = nodepass.GetInfo
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Poller{
+		db:     db,
+		fetch:  fetch,
+		infos:  make(map[int64]Info),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start 启动后台轮询
+func (p *Poller) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.Poll()
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.Poll()
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止轮询
+func (p *Poller) Close() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Poll 拉取一轮在线主控的系统信息，离线或拉取失败的主控从缓存中移除
+func (p *Poller) Poll() {
+	var ids []int64
+	if err := p.db.Model(&models.Endpoint{}).Where("status = ?", models.EndpointStatusOnline).Pluck("id", &ids).Error; err != nil {
+		log.Warnf("[EndpointInfo]查询在线主控失败: %v", err)
+		return
+	}
+
+	results := make(map[int64]Info, len(ids))
+	var resMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, pollConcurrency)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			info, err := p.fetch(id)
+			if err != nil {
+				log.Debugf("[EndpointInfo]获取主控 %d 系统信息失败: %v", id, err)
+				return
+			}
+			resMu.Lock()
+			results[id] = Info{EndpointInfoResult: info, FetchedAt: time.Now()}
+			resMu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	p.infos = results
+	p.mu.Unlock()
+}
+
+// Snapshot 返回当前缓存，按主控 ID 索引；返回的 map 不会再被修改
+func (p *Poller) Snapshot() map[int64]Info {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.infos
+}
@@ -0,0 +1,298 @@
+package exporter
+
+import (
+	"NodePassDash/internal/endpointinfo"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/sse"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Config 导出器配置
+type Config struct {
+	TagKeys []string // 作为 tag_<key> 标签输出的隧道标签键
+}
+
+// Exporter Prometheus 指标导出器
+// 隧道计数与端点状态直接读取数据库，端点系统信息读取共享轮询器的缓存
+type Exporter struct {
+	db         *gorm.DB
+	sseManager *sse.Manager
+	infos      *endpointinfo.Poller
+	tagKeys    []string
+}
+
+// NewExporter 创建指标导出器，sseManager 可为空
+func NewExporter(db *gorm.DB, sseManager *sse.Manager, infos *endpointinfo.Poller, cfg Config) *Exporter {
+	var tagKeys []string
+	for _, key := range cfg.TagKeys {
+		if key = strings.TrimSpace(key); key != "" {
+			tagKeys = append(tagKeys, key)
+		}
+	}
+	return &Exporter{
+		db:         db,
+		sseManager: sseManager,
+		infos:      infos,
+		tagKeys:    tagKeys,
+	}
+}
+
+// tunnelRow 隧道指标查询结果
+type tunnelRow struct {
+	models.Tunnel
+	EndpointName string
+}
+
+// Write 以 Prometheus 文本格式输出全部指标
+func (e *Exporter) Write(w io.Writer) error {
+	var out exposition
+	if err := e.writeTunnels(&out); err != nil {
+		return err
+	}
+	if err := e.writeEndpoints(&out); err != nil {
+		return err
+	}
+	e.writeInternal(&out)
+	_, err := w.Write(out.buf.Bytes())
+	return err
+}
+
+// tunnelGroups 查询隧道所属分组名，多个分组以逗号连接
+func (e *Exporter) tunnelGroups() (map[int64]string, error) {
+	var rows []struct {
+		TunnelID int64
+		Name     string
+	}
+	err := e.db.Table("tunnel_groups").
+		Select("tunnel_groups.tunnel_id, groups.name").
+		Joins("JOIN groups ON groups.id = tunnel_groups.group_id").
+		Order("groups.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64][]string)
+	for _, row := range rows {
+		names[row.TunnelID] = append(names[row.TunnelID], row.Name)
+	}
+	groups := make(map[int64]string, len(names))
+	for id, list := range names {
+		groups[id] = strings.Join(list, ",")
+	}
+	return groups, nil
+}
+
+func (e *Exporter) writeTunnels(out *exposition) error {
+	var tunnels []tunnelRow
+	err := e.db.Table("tunnels").
+		Select("tunnels.*, endpoints.name AS endpoint_name").
+		Joins("LEFT JOIN endpoints ON endpoints.id = tunnels.endpoint_id").
+		Order("tunnels.id").
+		Find(&tunnels).Error
+	if err != nil {
+		return err
+	}
+	groups, err := e.tunnelGroups()
+	if err != nil {
+		return err
+	}
+
+	labels := make([][]label, len(tunnels))
+	for i, t := range tunnels {
+		instance := ""
+		if t.InstanceID != nil {
+			instance = *t.InstanceID
+		}
+		ls := []label{
+			{"endpoint", t.EndpointName},
+			{"endpoint_id", strconv.FormatInt(t.EndpointID, 10)},
+			{"tunnel", t.Name},
+			{"tunnel_id", strconv.FormatInt(t.ID, 10)},
+			{"instance", instance},
+			{"type", string(t.Type)},
+			{"group", groups[t.ID]},
+		}
+		for _, key := range e.tagKeys {
+			value := ""
+			if t.Tags != nil {
+				value = (*t.Tags)[key]
+			}
+			ls = append(ls, label{"tag_" + sanitizeLabelName(key), value})
+		}
+		labels[i] = ls
+	}
+
+	counters := []struct {
+		name, help string
+		value      func(t *tunnelRow) int64
+	}{
+		{"nodepass_tunnel_tcp_rx_bytes_total", "Tunnel TCP received bytes.", func(t *tunnelRow) int64 { return t.TCPRx }},
+		{"nodepass_tunnel_tcp_tx_bytes_total", "Tunnel TCP transmitted bytes.", func(t *tunnelRow) int64 { return t.TCPTx }},
+		{"nodepass_tunnel_udp_rx_bytes_total", "Tunnel UDP received bytes.", func(t *tunnelRow) int64 { return t.UDPRx }},
+		{"nodepass_tunnel_udp_tx_bytes_total", "Tunnel UDP transmitted bytes.", func(t *tunnelRow) int64 { return t.UDPTx }},
+	}
+	for _, c := range counters {
+		out.family(c.name, "counter", c.help)
+		for i := range tunnels {
+			out.sample(c.name, labels[i], float64(c.value(&tunnels[i])))
+		}
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(t *tunnelRow) *int64
+	}{
+		{"nodepass_tunnel_tcp_connections", "Tunnel active TCP connections.", func(t *tunnelRow) *int64 { return t.TCPs }},
+		{"nodepass_tunnel_udp_connections", "Tunnel active UDP connections.", func(t *tunnelRow) *int64 { return t.UDPs }},
+		{"nodepass_tunnel_pool_connections", "Tunnel connection pool size.", func(t *tunnelRow) *int64 { return t.Pool }},
+		{"nodepass_tunnel_ping_ms", "Tunnel latency in milliseconds.", func(t *tunnelRow) *int64 { return t.Ping }},
+	}
+	for _, g := range gauges {
+		out.family(g.name, "gauge", g.help)
+		for i := range tunnels {
+			if v := g.value(&tunnels[i]); v != nil {
+				out.sample(g.name, labels[i], float64(*v))
+			}
+		}
+	}
+
+	out.family("nodepass_tunnel_up", "gauge", "Whether the tunnel is running (1) or not (0).")
+	for i, t := range tunnels {
+		out.sample("nodepass_tunnel_up", labels[i], boolValue(t.Status == models.TunnelStatusRunning))
+	}
+	out.family("nodepass_tunnel_status", "gauge", "Tunnel status as a label, always 1.")
+	for i, t := range tunnels {
+		out.sample("nodepass_tunnel_status", withLabel(labels[i][:5], "status", string(t.Status)), 1)
+	}
+	return nil
+}
+
+func (e *Exporter) writeEndpoints(out *exposition) error {
+	var endpoints []models.Endpoint
+	if err := e.db.Order("id").Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	labels := make([][]label, len(endpoints))
+	for i, ep := range endpoints {
+		labels[i] = []label{
+			{"endpoint", ep.Name},
+			{"endpoint_id", strconv.FormatInt(ep.ID, 10)},
+		}
+	}
+
+	out.family("nodepass_endpoint_up", "gauge", "Whether the endpoint is online (1) or not (0).")
+	for i, ep := range endpoints {
+		out.sample("nodepass_endpoint_up", labels[i], boolValue(ep.Status == models.EndpointStatusOnline))
+	}
+	out.family("nodepass_endpoint_status", "gauge", "Endpoint status as a label, always 1.")
+	for i, ep := range endpoints {
+		out.sample("nodepass_endpoint_status", withLabel(labels[i], "status", string(ep.Status)), 1)
+	}
+	out.family("nodepass_endpoint_tunnels", "gauge", "Number of tunnels on the endpoint.")
+	for i, ep := range endpoints {
+		out.sample("nodepass_endpoint_tunnels", labels[i], float64(ep.TunnelCount))
+	}
+	out.family("nodepass_endpoint_info", "gauge", "Endpoint build information, always 1.")
+	for i, ep := range endpoints {
+		ls := append(append([]label{}, labels[i]...),
+			label{"os", derefString(ep.OS)}, label{"arch", derefString(ep.Arch)}, label{"version", derefString(ep.Ver)})
+		out.sample("nodepass_endpoint_info", ls, 1)
+	}
+
+	infos := e.infos.Snapshot()
+
+	systemGauges := []struct {
+		name, typ, help string
+		value           func(info *nodepass.EndpointInfoResult) int64
+	}{
+		{"nodepass_endpoint_cpu_percent", "gauge", "Endpoint CPU usage percent.", func(i *nodepass.EndpointInfoResult) int64 { return int64(i.CPU) }},
+		{"nodepass_endpoint_memory_used_bytes", "gauge", "Endpoint used memory.", func(i *nodepass.EndpointInfoResult) int64 { return i.MemUsed }},
+		{"nodepass_endpoint_memory_total_bytes", "gauge", "Endpoint total memory.", func(i *nodepass.EndpointInfoResult) int64 { return i.MemTotal }},
+		{"nodepass_endpoint_swap_used_bytes", "gauge", "Endpoint used swap.", func(i *nodepass.EndpointInfoResult) int64 { return i.SwapUsed }},
+		{"nodepass_endpoint_swap_total_bytes", "gauge", "Endpoint total swap.", func(i *nodepass.EndpointInfoResult) int64 { return i.SwapTotal }},
+		{"nodepass_endpoint_disk_read_bytes_total", "counter", "Endpoint disk read bytes.", func(i *nodepass.EndpointInfoResult) int64 { return i.DiskRead }},
+		{"nodepass_endpoint_disk_write_bytes_total", "counter", "Endpoint disk written bytes.", func(i *nodepass.EndpointInfoResult) int64 { return i.DiskWrite }},
+		{"nodepass_endpoint_network_rx_bytes_total", "counter", "Endpoint network received bytes.", func(i *nodepass.EndpointInfoResult) int64 { return i.NetRx }},
+		{"nodepass_endpoint_network_tx_bytes_total", "counter", "Endpoint network transmitted bytes.", func(i *nodepass.EndpointInfoResult) int64 { return i.NetTx }},
+		{"nodepass_endpoint_system_uptime_seconds", "gauge", "Endpoint host uptime.", func(i *nodepass.EndpointInfoResult) int64 { return i.SysUptime }},
+		{"nodepass_endpoint_uptime_seconds", "gauge", "NodePass process uptime.", func(i *nodepass.EndpointInfoResult) int64 { return i.Uptime }},
+	}
+	for _, g := range systemGauges {
+		out.family(g.name, g.typ, g.help)
+		for i, ep := range endpoints {
+			if cached, ok := infos[ep.ID]; ok {
+				out.sample(g.name, labels[i], float64(g.value(cached.EndpointInfoResult)))
+			}
+		}
+	}
+	out.family("nodepass_endpoint_info_age_seconds", "gauge", "Seconds since endpoint system information was fetched.")
+	for i, ep := range endpoints {
+		if cached, ok := infos[ep.ID]; ok {
+			out.sample("nodepass_endpoint_info_age_seconds", labels[i], time.Since(cached.FetchedAt).Seconds())
+		}
+	}
+	return nil
+}
+
+// writeInternal 输出面板自身的健康指标
+func (e *Exporter) writeInternal(out *exposition) {
+	if e.sseManager != nil {
+		status := e.sseManager.GetConnectionStatus()
+		ids := make([]int64, 0, len(status))
+		for id := range status {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		out.family("nodepass_sse_connected", "gauge", "Whether the SSE connection to the endpoint is established.")
+		for _, id := range ids {
+			connected, _ := status[id]["connected"].(bool)
+			out.sample("nodepass_sse_connected", []label{{"endpoint_id", strconv.FormatInt(id, 10)}}, boolValue(connected))
+		}
+		out.family("nodepass_sse_reconnect_attempts", "gauge", "Current SSE reconnect attempts for the endpoint.")
+		for _, id := range ids {
+			attempts, _ := status[id]["reconnect_attempts"].(int)
+			out.sample("nodepass_sse_reconnect_attempts", []label{{"endpoint_id", strconv.FormatInt(id, 10)}}, float64(attempts))
+		}
+
+		q := e.sseManager.QueueStats()
+		out.single("nodepass_sse_queue_depth", "gauge", "Events waiting in the SSE job queue.", float64(q.Depth))
+		out.single("nodepass_sse_queue_capacity", "gauge", "Capacity of the SSE job queue.", float64(q.Capacity))
+		out.single("nodepass_sse_events_dropped_total", "counter", "Events dropped because the SSE job queue was full.", float64(q.Dropped))
+		out.family("nodepass_sse_event_processing_seconds", "histogram", "SSE worker event processing latency.")
+		for i, bound := range q.LatencyBuckets {
+			out.sample("nodepass_sse_event_processing_seconds_bucket", []label{{"le", formatValue(bound)}}, float64(q.LatencyCounts[i]))
+		}
+		out.sample("nodepass_sse_event_processing_seconds_bucket", []label{{"le", "+Inf"}}, float64(q.Processed))
+		out.sample("nodepass_sse_event_processing_seconds_sum", nil, q.LatencySum)
+		out.sample("nodepass_sse_event_processing_seconds_count", nil, float64(q.Processed))
+	}
+
+	if sqlDB, err := e.db.DB(); err == nil {
+		s := sqlDB.Stats()
+		out.single("nodepass_db_open_connections", "gauge", "Open database connections.", float64(s.OpenConnections))
+		out.single("nodepass_db_in_use_connections", "gauge", "Database connections in use.", float64(s.InUse))
+		out.single("nodepass_db_idle_connections", "gauge", "Idle database connections.", float64(s.Idle))
+		out.single("nodepass_db_max_open_connections", "gauge", "Maximum open database connections.", float64(s.MaxOpenConnections))
+		out.single("nodepass_db_wait_count_total", "counter", "Connections waited for.", float64(s.WaitCount))
+		out.single("nodepass_db_wait_duration_seconds_total", "counter", "Time spent waiting for connections.", s.WaitDuration.Seconds())
+	}
+
+	out.single("nodepass_dashboard_goroutines", "gauge", "Goroutines in the dashboard process.", float64(runtime.NumGoroutine()))
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
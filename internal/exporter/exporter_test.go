@@ -0,0 +1,69 @@
+package exporter
+
+import (
+	"NodePassDash/internal/endpointinfo"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExporterWrite(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Group{}, &models.Tunnel{}, &models.TunnelGroup{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ver := "v1.2.0"
+	endpoint := models.Endpoint{Name: `edge "1"`, URL: "http://a", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline, Ver: &ver}
+	db.Create(&endpoint)
+	instance := "abc"
+	ping := int64(12)
+	tags := map[string]string{"env": "prod"}
+	tunnel := models.Tunnel{Name: "web", EndpointID: endpoint.ID, Type: models.TunnelType("server"), Status: models.TunnelStatusRunning,
+		InstanceID: &instance, TCPRx: 1024, Ping: &ping, Tags: &tags}
+	db.Create(&tunnel)
+	groupA, groupB := models.Group{Name: "b"}, models.Group{Name: "a"}
+	db.Create(&groupA)
+	db.Create(&groupB)
+	db.Create(&models.TunnelGroup{TunnelID: tunnel.ID, GroupID: groupA.ID})
+	db.Create(&models.TunnelGroup{TunnelID: tunnel.ID, GroupID: groupB.ID})
+
+	infos := endpointinfo.NewPoller(db, func(int64) (*nodepass.EndpointInfoResult, error) {
+		return &nodepass.EndpointInfoResult{CPU: 37, MemTotal: 2048}, nil
+	})
+	infos.Poll()
+	e := NewExporter(db, nil, infos, Config{TagKeys: []string{"env", " team-name "}})
+
+	var out strings.Builder
+	if err := e.Write(&out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	text := out.String()
+
+	tunnelLabels := `endpoint="edge \"1\"",endpoint_id="1",tunnel="web",tunnel_id="1",instance="abc",type="server",group="a,b",tag_env="prod",tag_team_name=""`
+	for _, want := range []string{
+		"# TYPE nodepass_tunnel_tcp_rx_bytes_total counter\n",
+		"nodepass_tunnel_tcp_rx_bytes_total{" + tunnelLabels + "} 1024\n",
+		"nodepass_tunnel_ping_ms{" + tunnelLabels + "} 12\n",
+		"nodepass_tunnel_up{" + tunnelLabels + "} 1\n",
+		`nodepass_endpoint_up{endpoint="edge \"1\"",endpoint_id="1"} 1` + "\n",
+		`nodepass_endpoint_info{endpoint="edge \"1\"",endpoint_id="1",os="",arch="",version="v1.2.0"} 1` + "\n",
+		`nodepass_endpoint_cpu_percent{endpoint="edge \"1\"",endpoint_id="1"} 37` + "\n",
+		`nodepass_endpoint_memory_total_bytes{endpoint="edge \"1\"",endpoint_id="1"} 2048` + "\n",
+		"# TYPE nodepass_db_open_connections gauge\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in output:\n%s", want, text)
+		}
+	}
+	// 未上报的连接数不输出样本
+	if strings.Contains(text, "nodepass_tunnel_tcp_connections{") {
+		t.Error("unexpected sample for nil tcps")
+	}
+}
@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// label 指标标签
+type label struct {
+	name  string
+	value string
+}
+
+// labelNamePattern 标签名中不允许出现的字符
+var labelNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// sanitizeLabelName 将任意字符串转换为合法的标签名
+func sanitizeLabelName(name string) string {
+	name = labelNamePattern.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// labelValueEscaper 标签值转义
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// exposition Prometheus 文本格式（0.0.4）输出
+type exposition struct {
+	buf bytes.Buffer
+}
+
+// family 输出指标族的 HELP 与 TYPE，同一指标族的样本需紧随其后
+func (e *exposition) family(name, typ, help string) {
+	e.buf.WriteString("# HELP " + name + " " + help + "\n")
+	e.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+// sample 输出一个样本
+func (e *exposition) sample(name string, labels []label, value float64) {
+	e.buf.WriteString(name)
+	if len(labels) > 0 {
+		e.buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.buf.WriteString(l.name + `="` + labelValueEscaper.Replace(l.value) + `"`)
+		}
+		e.buf.WriteByte('}')
+	}
+	e.buf.WriteByte(' ')
+	e.buf.WriteString(formatValue(value))
+	e.buf.WriteByte('\n')
+}
+
+// single 输出只有一个样本的指标族
+func (e *exposition) single(name, typ, help string, value float64) {
+	e.family(name, typ, help)
+	e.sample(name, nil, value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// withLabel 复制标签并追加一个
+func withLabel(labels []label, name, value string) []label {
+	out := make([]label, 0, len(labels)+1)
+	out = append(out, labels...)
+	return append(out, label{name, value})
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
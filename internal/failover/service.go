@@ -0,0 +1,511 @@
+package failover
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/tunnel"
+
+	"gorm.io/gorm"
+)
+
+// 未配置策略字段时使用的默认值
+const (
+	defaultFailThreshold    = 3
+	defaultFailbackAfterSec = 300
+	defaultCooldownSec      = 120
+	checkInterval           = 15 * time.Second
+)
+
+// Service 服务故障转移
+// 定期检查服务当前 server 端的健康状况（主控状态、实例状态、SSE 上报的延迟），
+// 连续不健康时在备用主控上启动或创建 server 端，并改写 client 端命令行指向新的 server
+type Service struct {
+	db            *gorm.DB
+	tunnelService *tunnel.Service
+
+	mu           sync.Mutex
+	failures     map[string]int       // sid -> 连续不健康次数
+	primarySince map[string]time.Time // sid -> 主用主控恢复健康的起始时间
+	lastFailure  map[string]time.Time // sid -> 最近一次切换失败时间，同样受冷却限制
+	switching    map[string]bool
+	stopCh       chan struct{}
+	stopOnce     sync.Once
+
+	// activate 将服务的 server 端切到目标主控并改写 client 端，返回目标主控上的 server 实例ID
+	activate func(p *models.ServiceFailoverPolicy, svc *models.Services, target int64) (string, error)
+}
+
+// NewService 创建故障转移服务
+func NewService(db *gorm.DB, tunnelService *tunnel.Service) *Service {
+	s := &Service{
+		db:            db,
+		tunnelService: tunnelService,
+		failures:      make(map[string]int),
+		primarySince:  make(map[string]time.Time),
+		lastFailure:   make(map[string]time.Time),
+		switching:     make(map[string]bool),
+		stopCh:        make(chan struct{}),
+	}
+	s.activate = s.repoint
+	return s
+}
+
+// Start 启动后台健康检查
+func (s *Service) Start() {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.CheckAll()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+	log.Info("服务故障转移检查已启动")
+}
+
+// Close 停止后台健康检查
+func (s *Service) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+		log.Info("服务故障转移检查已关闭")
+	})
+}
+
+// CheckAll 检查全部启用的故障转移策略
+func (s *Service) CheckAll() {
+	var policies []models.ServiceFailoverPolicy
+	if err := s.db.Where("enabled = ?", true).Find(&policies).Error; err != nil {
+		log.Errorf("[Failover]读取故障转移策略失败: %v", err)
+		return
+	}
+	for i := range policies {
+		normalizePolicy(&policies[i])
+		s.checkPolicy(&policies[i])
+	}
+}
+
+// checkPolicy 检查单个服务，必要时执行故障转移或回切
+func (s *Service) checkPolicy(p *models.ServiceFailoverPolicy) {
+	svc, err := s.loadService(p.Sid)
+	if err != nil {
+		return
+	}
+
+	healthy, reason := s.serverHealth(p, svc)
+	s.mu.Lock()
+	if healthy {
+		delete(s.failures, p.Sid)
+	} else {
+		s.failures[p.Sid]++
+	}
+	failures := s.failures[p.Sid]
+	s.mu.Unlock()
+
+	if !healthy {
+		s.clearPrimarySince(p.Sid)
+		if failures < p.FailThreshold || s.inCooldown(p) {
+			return
+		}
+		for _, target := range s.candidates(p) {
+			if err := s.Switch(p.Sid, target, models.FailoverKindFailover, reason); err == nil {
+				return
+			}
+		}
+		return
+	}
+
+	// 当前 server 健康，判断是否回切到主用主控
+	if !p.Failback || p.ActiveEndpointID == p.PrimaryEndpointID || !s.endpointOnline(p.PrimaryEndpointID) {
+		s.clearPrimarySince(p.Sid)
+		return
+	}
+	s.mu.Lock()
+	since, ok := s.primarySince[p.Sid]
+	if !ok {
+		since = time.Now()
+		s.primarySince[p.Sid] = since
+	}
+	s.mu.Unlock()
+	if time.Since(since) < time.Duration(p.FailbackAfterSec)*time.Second || s.inCooldown(p) {
+		return
+	}
+	s.Switch(p.Sid, p.PrimaryEndpointID, models.FailoverKindFailback, "主用主控已恢复")
+}
+
+// serverHealth 判断当前生效的 server 端是否健康，不健康时返回原因
+func (s *Service) serverHealth(p *models.ServiceFailoverPolicy, svc *models.Services) (bool, string) {
+	if !s.endpointOnline(p.ActiveEndpointID) {
+		return false, "server 主控离线"
+	}
+	if svc.ServerInstanceId == nil || svc.ServerEndpointId == nil {
+		return false, "server 实例不存在"
+	}
+	server := s.findTunnel(*svc.ServerEndpointId, *svc.ServerInstanceId)
+	if server == nil {
+		return false, "server 实例不存在"
+	}
+	if server.Status != models.TunnelStatusRunning {
+		return false, fmt.Sprintf("server 实例状态为 %s", server.Status)
+	}
+	if p.MaxPingMs > 0 && svc.ClientInstanceId != nil && svc.ClientEndpointId != nil {
+		if client := s.findTunnel(*svc.ClientEndpointId, *svc.ClientInstanceId); client != nil &&
+			client.Ping != nil && *client.Ping > int64(p.MaxPingMs) {
+			return false, fmt.Sprintf("client 延迟 %dms 超过阈值 %dms", *client.Ping, p.MaxPingMs)
+		}
+	}
+	return true, ""
+}
+
+// candidates 按优先级返回可切换的在线主控：主用优先，其次按备用列表顺序
+func (s *Service) candidates(p *models.ServiceFailoverPolicy) []int64 {
+	ordered := append([]int64{p.PrimaryEndpointID}, p.StandbyEndpointIDs...)
+	seen := map[int64]bool{p.ActiveEndpointID: true}
+	var result []int64
+	for _, id := range ordered {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if s.endpointOnline(id) {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// Switch 将服务的 server 端切换到目标主控，并记录切换结果
+func (s *Service) Switch(sid string, target int64, kind models.FailoverSwitchKind, reason string) error {
+	s.mu.Lock()
+	if s.switching[sid] {
+		s.mu.Unlock()
+		return errors.New("服务正在切换中")
+	}
+	s.switching[sid] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.switching, sid)
+		s.mu.Unlock()
+	}()
+
+	p, err := s.GetPolicy(sid)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return errors.New("服务未配置故障转移策略")
+	}
+	if target == p.ActiveEndpointID {
+		return errors.New("目标主控已是当前生效的 server 主控")
+	}
+	svc, err := s.loadService(sid)
+	if err != nil {
+		return err
+	}
+
+	from := p.ActiveEndpointID
+	instanceID, err := s.activate(p, svc, target)
+	if err != nil {
+		s.mu.Lock()
+		s.lastFailure[sid] = time.Now()
+		s.mu.Unlock()
+		s.recordEvent(sid, kind, from, target, reason, false, err.Error())
+		log.Warnf("[Failover]服务 %s 从主控 %d 切换到 %d 失败: %v", sid, from, target, err)
+		return err
+	}
+
+	if p.Instances == nil {
+		p.Instances = map[string]string{}
+	}
+	p.Instances[strconv.FormatInt(target, 10)] = instanceID
+	p.ActiveEndpointID = target
+	p.LastSwitchAt = models.NullTime{Time: time.Now(), Valid: true}
+	p.LastSwitchKind = kind
+	if err := s.db.Save(p).Error; err != nil {
+		log.Errorf("[Failover]保存服务 %s 故障转移状态失败: %v", sid, err)
+	}
+	if err := s.db.Model(&models.Services{}).
+		Where("sid = ? AND type = ?", svc.Sid, svc.Type).
+		Updates(map[string]interface{}{
+			"server_endpoint_id": target,
+			"server_instance_id": instanceID,
+		}).Error; err != nil {
+		log.Errorf("[Failover]更新服务 %s 的 server 端失败: %v", sid, err)
+	}
+
+	s.mu.Lock()
+	delete(s.failures, sid)
+	delete(s.primarySince, sid)
+	delete(s.lastFailure, sid)
+	s.mu.Unlock()
+
+	s.recordEvent(sid, kind, from, target, reason, true, "")
+	log.Infof("[Failover]服务 %s 已从主控 %d 切换到 %d（%s）：%s", sid, from, target, kind, reason)
+	return nil
+}
+
+// repoint 在目标主控上启动已有的备用 server，或按当前 server 配置创建一个，再改写 client 端
+func (s *Service) repoint(p *models.ServiceFailoverPolicy, svc *models.Services, target int64) (string, error) {
+	if svc.ClientInstanceId == nil || svc.ClientEndpointId == nil {
+		return "", errors.New("服务缺少 client 端")
+	}
+	client := s.findTunnel(*svc.ClientEndpointId, *svc.ClientInstanceId)
+	if client == nil {
+		return "", errors.New("client 实例不存在")
+	}
+
+	var endpoint models.Endpoint
+	if err := s.db.Select("id", "url", "hostname").First(&endpoint, target).Error; err != nil {
+		return "", fmt.Errorf("目标主控不存在: %w", err)
+	}
+
+	var server *models.Tunnel
+	if id := p.Instances[strconv.FormatInt(target, 10)]; id != "" {
+		server = s.findTunnel(target, id)
+	}
+	if server != nil {
+		if server.Status != models.TunnelStatusRunning {
+			if _, err := nodepass.ControlInstance(target, *server.InstanceID, "start"); err != nil {
+				return "", fmt.Errorf("启动备用 server 失败: %w", err)
+			}
+		}
+	} else {
+		template := s.serverTemplate(p, svc)
+		if template == nil {
+			return "", errors.New("找不到可复制的 server 配置")
+		}
+		peer := &models.Peer{SID: &svc.Sid, Type: &svc.Type, Alias: svc.Alias}
+		created, err := s.tunnelService.CloneTunnelTo(*template, target, tunnel.CloneOverrides{}, peer)
+		if err != nil {
+			return "", fmt.Errorf("创建备用 server 失败: %w", err)
+		}
+		server = created
+	}
+
+	// 改写 client 端，使其连接新的 server
+	cfg := nodepass.NewTunnelConfig(*client).Normalize()
+	cfg.TunnelAddress = endpoint.Host()
+	cfg.TunnelPort = server.TunnelPort
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return "", errs
+	}
+	if _, err := nodepass.UpdateInstance(client.EndpointID, *client.InstanceID, cfg.BuildURL()); err != nil {
+		return "", fmt.Errorf("改写 client 端失败: %w", err)
+	}
+
+	// 旧 server 尽量停止，主控离线时忽略
+	if svc.ServerInstanceId != nil && svc.ServerEndpointId != nil && *svc.ServerEndpointId != target {
+		if _, err := nodepass.ControlInstance(*svc.ServerEndpointId, *svc.ServerInstanceId, "stop"); err != nil {
+			log.Warnf("[Failover]停止原 server 实例 %s 失败: %v", *svc.ServerInstanceId, err)
+		}
+	}
+	return *server.InstanceID, nil
+}
+
+// serverTemplate 选取用于复制的 server 配置：优先当前 server，其次任一已知实例
+func (s *Service) serverTemplate(p *models.ServiceFailoverPolicy, svc *models.Services) *models.Tunnel {
+	if svc.ServerInstanceId != nil && svc.ServerEndpointId != nil {
+		if t := s.findTunnel(*svc.ServerEndpointId, *svc.ServerInstanceId); t != nil {
+			return t
+		}
+	}
+	for key, instanceID := range p.Instances {
+		endpointID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := s.findTunnel(endpointID, instanceID); t != nil {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetPolicy 获取服务的故障转移策略，未配置时返回 nil
+func (s *Service) GetPolicy(sid string) (*models.ServiceFailoverPolicy, error) {
+	var policies []models.ServiceFailoverPolicy
+	if err := s.db.Where("sid = ?", sid).Limit(1).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	p := policies[0]
+	normalizePolicy(&p)
+	return &p, nil
+}
+
+// SavePolicy 创建或更新服务的故障转移策略，主用/生效主控与实例映射由服务自身维护
+func (s *Service) SavePolicy(p *models.ServiceFailoverPolicy) error {
+	svc, err := s.loadService(p.Sid)
+	if err != nil {
+		return errors.New("服务不存在")
+	}
+	switch svc.Type {
+	case "1", "2", "3", "4", "6", "7":
+	default:
+		return errors.New("仅内网穿透和隧道转发服务支持故障转移")
+	}
+	if svc.ServerEndpointId == nil || svc.ServerInstanceId == nil {
+		return errors.New("服务缺少 server 端")
+	}
+	if p.FailThreshold < 0 || p.MaxPingMs < 0 || p.FailbackAfterSec < 0 || p.CooldownSec < 0 {
+		return errors.New("策略参数不能为负数")
+	}
+	normalizePolicy(p)
+
+	existing, err := s.GetPolicy(p.Sid)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		p.ID = existing.ID
+		p.CreatedAt = existing.CreatedAt
+		p.PrimaryEndpointID = existing.PrimaryEndpointID
+		p.ActiveEndpointID = existing.ActiveEndpointID
+		p.Instances = existing.Instances
+		p.LastSwitchAt = existing.LastSwitchAt
+		p.LastSwitchKind = existing.LastSwitchKind
+	} else {
+		p.ID = 0
+		p.PrimaryEndpointID = *svc.ServerEndpointId
+		p.ActiveEndpointID = *svc.ServerEndpointId
+		p.Instances = map[string]string{strconv.FormatInt(*svc.ServerEndpointId, 10): *svc.ServerInstanceId}
+		p.LastSwitchAt = models.NullTime{}
+		p.LastSwitchKind = ""
+	}
+
+	standby := make([]int64, 0, len(p.StandbyEndpointIDs))
+	seen := map[int64]bool{p.PrimaryEndpointID: true}
+	for _, id := range p.StandbyEndpointIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		var count int64
+		if err := s.db.Model(&models.Endpoint{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("备用主控 %d 不存在", id)
+		}
+		standby = append(standby, id)
+	}
+	if len(standby) == 0 {
+		return errors.New("请至少配置一个备用主控")
+	}
+	p.StandbyEndpointIDs = standby
+	return s.db.Save(p).Error
+}
+
+// DeletePolicy 删除服务的故障转移策略，已创建的备用实例保留
+func (s *Service) DeletePolicy(sid string) error {
+	result := s.db.Where("sid = ?", sid).Delete(&models.ServiceFailoverPolicy{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("策略不存在")
+	}
+	s.mu.Lock()
+	delete(s.failures, sid)
+	delete(s.primarySince, sid)
+	delete(s.lastFailure, sid)
+	s.mu.Unlock()
+	return nil
+}
+
+// ListEvents 获取切换记录，sid 为空时返回全部服务
+func (s *Service) ListEvents(sid string, limit int) ([]models.ServiceFailoverEvent, error) {
+	var events []models.ServiceFailoverEvent
+	q := s.db.Order("id DESC").Limit(limit)
+	if sid != "" {
+		q = q.Where("sid = ?", sid)
+	}
+	err := q.Find(&events).Error
+	return events, err
+}
+
+// ======================== 内部工具 ============================
+
+func normalizePolicy(p *models.ServiceFailoverPolicy) {
+	if p.FailThreshold == 0 {
+		p.FailThreshold = defaultFailThreshold
+	}
+	if p.FailbackAfterSec == 0 {
+		p.FailbackAfterSec = defaultFailbackAfterSec
+	}
+	if p.CooldownSec == 0 {
+		p.CooldownSec = defaultCooldownSec
+	}
+}
+
+// inCooldown 距离上次切换（含失败的尝试）不足冷却时间
+func (s *Service) inCooldown(p *models.ServiceFailoverPolicy) bool {
+	cooldown := time.Duration(p.CooldownSec) * time.Second
+	if p.LastSwitchAt.Valid && time.Since(p.LastSwitchAt.Time) < cooldown {
+		return true
+	}
+	s.mu.Lock()
+	last, ok := s.lastFailure[p.Sid]
+	s.mu.Unlock()
+	return ok && time.Since(last) < cooldown
+}
+
+func (s *Service) clearPrimarySince(sid string) {
+	s.mu.Lock()
+	delete(s.primarySince, sid)
+	s.mu.Unlock()
+}
+
+func (s *Service) loadService(sid string) (*models.Services, error) {
+	var svc models.Services
+	if err := s.db.Where("sid = ?", sid).First(&svc).Error; err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
+
+func (s *Service) findTunnel(endpointID int64, instanceID string) *models.Tunnel {
+	var rows []models.Tunnel
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).Limit(1).Find(&rows).Error; err != nil || len(rows) == 0 {
+		return nil
+	}
+	return &rows[0]
+}
+
+func (s *Service) endpointOnline(endpointID int64) bool {
+	var ep models.Endpoint
+	if err := s.db.Select("status").Where("id = ?", endpointID).Limit(1).Find(&ep).Error; err != nil {
+		return false
+	}
+	return ep.Status == models.EndpointStatusOnline
+}
+
+func (s *Service) recordEvent(sid string, kind models.FailoverSwitchKind, from, to int64, reason string, success bool, msg string) {
+	evt := models.ServiceFailoverEvent{
+		Sid:            sid,
+		Kind:           kind,
+		FromEndpointID: from,
+		ToEndpointID:   to,
+		Reason:         reason,
+		Success:        success,
+	}
+	if msg != "" {
+		evt.Message = &msg
+	}
+	if err := s.db.Create(&evt).Error; err != nil {
+		log.Warnf("[Failover]记录服务 %s 切换事件失败: %v", sid, err)
+	}
+}
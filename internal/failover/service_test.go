@@ -0,0 +1,95 @@
+package failover
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFailoverAfterThreshold(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.Services{},
+		&models.ServiceFailoverPolicy{}, &models.ServiceFailoverEvent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	primary := models.Endpoint{Name: "primary", URL: "http://10.0.0.1", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline}
+	standbyDown := models.Endpoint{Name: "standby-down", URL: "http://10.0.0.2", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOffline}
+	standby := models.Endpoint{Name: "standby", URL: "http://10.0.0.3", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline}
+	for _, ep := range []*models.Endpoint{&primary, &standbyDown, &standby} {
+		if err := db.Create(ep).Error; err != nil {
+			t.Fatalf("seed endpoint: %v", err)
+		}
+	}
+
+	serverInstance, clientInstance := "srv", "cli"
+	server := models.Tunnel{Name: "s", EndpointID: primary.ID, InstanceID: &serverInstance, Type: models.TunnelModeServer, Status: models.TunnelStatusRunning}
+	if err := db.Create(&server).Error; err != nil {
+		t.Fatalf("seed tunnel: %v", err)
+	}
+	svc := models.Services{Sid: "sid-1", Type: "2", ServerEndpointId: &primary.ID, ServerInstanceId: &serverInstance, ClientInstanceId: &clientInstance}
+	if err := db.Create(&svc).Error; err != nil {
+		t.Fatalf("seed service: %v", err)
+	}
+
+	s := NewService(db, nil)
+	var targets []int64
+	s.activate = func(_ *models.ServiceFailoverPolicy, _ *models.Services, target int64) (string, error) {
+		targets = append(targets, target)
+		return "standby-srv", nil
+	}
+	if err := s.SavePolicy(&models.ServiceFailoverPolicy{Sid: "sid-1", Enabled: true, FailThreshold: 2,
+		StandbyEndpointIDs: []int64{standbyDown.ID, standby.ID, primary.ID}}); err != nil {
+		t.Fatalf("save policy: %v", err)
+	}
+
+	// 健康时不切换
+	s.CheckAll()
+	if len(targets) != 0 {
+		t.Fatalf("switched while healthy: %v", targets)
+	}
+
+	db.Model(&models.Tunnel{}).Where("id = ?", server.ID).Update("status", models.TunnelStatusError)
+	s.CheckAll()
+	if len(targets) != 0 {
+		t.Fatalf("switched before threshold: %v", targets)
+	}
+	s.CheckAll()
+	if len(targets) != 1 || targets[0] != standby.ID {
+		t.Fatalf("targets=%v want [%d] (offline standby skipped)", targets, standby.ID)
+	}
+
+	policy, err := s.GetPolicy("sid-1")
+	if err != nil || policy == nil {
+		t.Fatalf("get policy: %v", err)
+	}
+	if policy.ActiveEndpointID != standby.ID || policy.PrimaryEndpointID != primary.ID {
+		t.Fatalf("active=%d primary=%d", policy.ActiveEndpointID, policy.PrimaryEndpointID)
+	}
+	if len(policy.StandbyEndpointIDs) != 2 {
+		t.Fatalf("standby=%v want primary removed", policy.StandbyEndpointIDs)
+	}
+	var updated models.Services
+	db.Where("sid = ?", "sid-1").First(&updated)
+	if *updated.ServerEndpointId != standby.ID || *updated.ServerInstanceId != "standby-srv" {
+		t.Fatalf("service server=%d/%s", *updated.ServerEndpointId, *updated.ServerInstanceId)
+	}
+	events, _ := s.ListEvents("sid-1", 10)
+	if len(events) != 1 || !events[0].Success || events[0].Kind != models.FailoverKindFailover {
+		t.Fatalf("events=%+v", events)
+	}
+
+	// 冷却期内即使再次不健康也不切换
+	db.Model(&models.Endpoint{}).Where("id = ?", standby.ID).Update("status", models.EndpointStatusOffline)
+	for i := 0; i < 3; i++ {
+		s.CheckAll()
+	}
+	if len(targets) != 1 {
+		t.Fatalf("switched during cooldown: %v", targets)
+	}
+}
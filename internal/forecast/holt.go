@@ -0,0 +1,178 @@
+package forecast
+
+import "math"
+
+// z95 95% 置信区间对应的标准正态分位数
+const z95 = 1.96
+
+// 参数网格：对每个序列选取一步预测误差平方和最小的组合
+var (
+	alphaGrid = []float64{0.1, 0.3, 0.5, 0.8}
+	betaGrid  = []float64{0, 0.05, 0.15}
+	gammaGrid = []float64{0.05, 0.2, 0.4}
+)
+
+// Method 预测方法
+type Method string
+
+const (
+	MethodHoltWinters Method = "holt-winters" // 趋势 + 周期（加法）
+	MethodHolt        Method = "holt"         // 线性趋势
+	MethodMean        Method = "mean"         // 数据过少时按均值外推
+	MethodNone        Method = "none"         // 没有数据
+)
+
+// model Holt-Winters 加法模型，season 为 0 时退化为 Holt 线性趋势
+type model struct {
+	method             Method
+	alpha, beta, gamma float64
+	season             int
+	level, trend       float64
+	seasonal           []float64
+	n                  int
+	sigma              float64 // 一步预测残差标准差
+}
+
+// fit 拟合序列；长度不少于两个周期时启用周期项
+func fit(series []float64, season int) *model {
+	n := len(series)
+	switch {
+	case n == 0:
+		return &model{method: MethodNone}
+	case n < 4:
+		mean, variance := meanVariance(series)
+		return &model{method: MethodMean, level: mean, n: n, sigma: math.Sqrt(variance)}
+	}
+	if n < 2*season {
+		season = 0
+	}
+
+	var best *model
+	bestSSE := math.Inf(1)
+	gammas := gammaGrid
+	if season == 0 {
+		gammas = []float64{0}
+	}
+	for _, alpha := range alphaGrid {
+		for _, beta := range betaGrid {
+			for _, gamma := range gammas {
+				m := &model{alpha: alpha, beta: beta, gamma: gamma, season: season}
+				if sse := m.run(series); sse < bestSSE {
+					best, bestSSE = m, sse
+				}
+			}
+		}
+	}
+	return best
+}
+
+// run 依次更新状态并返回一步预测误差平方和
+func (m *model) run(series []float64) float64 {
+	m.method = MethodHolt
+	start := 1
+	m.level, m.trend = series[0], series[1]-series[0]
+	if m.season > 0 {
+		m.method = MethodHoltWinters
+		s := m.season
+		first, _ := meanVariance(series[:s])
+		second, _ := meanVariance(series[s : 2*s])
+		m.level, m.trend = first, (second-first)/float64(s)
+		m.seasonal = make([]float64, s)
+		for i := 0; i < s; i++ {
+			m.seasonal[i] = series[i] - first - m.trend*(float64(i)-float64(s-1)/2)
+		}
+		// 第一个周期用于初始化，均值对应周期中点，推进到周期末
+		m.level += m.trend * float64(s-1) / 2
+		start = s
+	}
+
+	var sse float64
+	count := 0
+	for t := start; t < len(series); t++ {
+		y := series[t]
+		var s float64
+		if m.season > 0 {
+			s = m.seasonal[t%m.season]
+		}
+		err := y - (m.level + m.trend + s)
+		sse += err * err
+		count++
+
+		prevLevel := m.level
+		m.level = m.alpha*(y-s) + (1-m.alpha)*(m.level+m.trend)
+		m.trend = m.beta*(m.level-prevLevel) + (1-m.beta)*m.trend
+		if m.season > 0 {
+			m.seasonal[t%m.season] = m.gamma*(y-m.level) + (1-m.gamma)*s
+		}
+	}
+	m.n = len(series)
+	if count > 1 {
+		m.sigma = math.Sqrt(sse / float64(count-1))
+	}
+	return sse
+}
+
+// predict 返回第 h 步（h >= 1）的点预测
+func (m *model) predict(h int) float64 {
+	switch m.method {
+	case MethodNone:
+		return 0
+	case MethodMean:
+		return m.level
+	}
+	v := m.level + float64(h)*m.trend
+	if m.season > 0 {
+		v += m.seasonal[(m.n+h-1)%m.season]
+	}
+	return v
+}
+
+// psi 第 j 步之后的误差对预测的传播系数
+func (m *model) psi(j int) float64 {
+	if m.method == MethodMean {
+		return 0
+	}
+	return m.alpha * (1 + float64(j)*m.beta)
+}
+
+// stepStd 第 h 步预测的标准差
+func (m *model) stepStd(h int) float64 {
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		c := m.psi(j)
+		variance += c * c
+	}
+	return m.sigma * math.Sqrt(variance)
+}
+
+// weightedSumStd 加权和 Σ w[h-1]·y(n+h) 的预测标准差，考虑各步误差之间的相关性
+func (m *model) weightedSumStd(weights []float64) float64 {
+	var variance float64
+	for k := range weights {
+		coef := weights[k]
+		for j := 1; k+j < len(weights); j++ {
+			coef += weights[k+j] * m.psi(j)
+		}
+		variance += coef * coef
+	}
+	return m.sigma * math.Sqrt(variance)
+}
+
+func meanVariance(series []float64) (float64, float64) {
+	if len(series) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range series {
+		sum += v
+	}
+	mean := sum / float64(len(series))
+	if len(series) < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, v := range series {
+		ss += (v - mean) * (v - mean)
+	}
+	return mean, ss / float64(len(series)-1)
+}
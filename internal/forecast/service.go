@@ -0,0 +1,759 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/endpointinfo"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/periodic"
+	"NodePassDash/internal/timezone"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	sampleInterval  = 5 * time.Minute
+	sampleRetention = 30 * 24 * time.Hour
+	cleanupInterval = time.Hour
+
+	trafficHistoryDays = 56 // 流量预测使用的历史天数
+	gaugeHistoryDays   = 30 // CPU、内存预测使用的历史天数（不超过采样保留时间）
+	gaugeHorizonDays   = 90 // CPU、内存的预测天数
+	weekSeason         = 7
+
+	defaultCPULimit    = 90
+	defaultMemoryLimit = 90
+)
+
+// ErrInvalidThreshold 容量阈值不合法
+var ErrInvalidThreshold = errors.New("无效的容量阈值")
+
+// Band 预测值及 95% 置信区间
+type Band struct {
+	Mean  float64 `json:"mean"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Point 按天的历史值
+type Point struct {
+	Date  time.Time `json:"date"`
+	Value float64   `json:"value"`
+}
+
+// ForecastPoint 按天的预测值
+type ForecastPoint struct {
+	Date time.Time `json:"date"`
+	Band
+}
+
+// Crossing 阈值越过预测
+type Crossing struct {
+	Metric            models.CapacityMetric `json:"metric"`
+	Limit             float64               `json:"limit"`
+	Exceeded          bool                  `json:"exceeded"`          // 当前已超过阈值
+	At                *time.Time            `json:"at"`                // 按预测均值越过阈值的时间，预测期内不会越过时为 null
+	DaysUntil         *float64              `json:"daysUntil"`         // 距越过阈值的天数
+	EarliestAt        *time.Time            `json:"earliestAt"`        // 按置信区间上界越过阈值的时间
+	EarliestDaysUntil *float64              `json:"earliestDaysUntil"` // 按置信区间上界距越过阈值的天数
+}
+
+// TrafficForecast 自然月流量预测
+type TrafficForecast struct {
+	Method      Method          `json:"method"`
+	MonthStart  time.Time       `json:"monthStart"`
+	MonthEnd    time.Time       `json:"monthEnd"`
+	MonthToDate int64           `json:"monthToDate"` // 本月已完成整小时的流量
+	Projected   Band            `json:"projected"`   // 预计月底累计流量
+	History     []Point         `json:"history,omitempty"`
+	Forecast    []ForecastPoint `json:"forecast,omitempty"`
+	Threshold   *Crossing       `json:"threshold"`
+}
+
+// GaugeForecast CPU 或内存使用率预测，按每日峰值（小时平均的最大值）计算
+type GaugeForecast struct {
+	Method    Method          `json:"method"`
+	Current   float64         `json:"current"`
+	History   []Point         `json:"history,omitempty"`
+	Forecast  []ForecastPoint `json:"forecast,omitempty"`
+	Threshold *Crossing       `json:"threshold"`
+}
+
+// TunnelForecast 隧道容量预测
+type TunnelForecast struct {
+	TunnelID   int64           `json:"tunnelId"`
+	Name       string          `json:"name"`
+	EndpointID int64           `json:"endpointId"`
+	InstanceID string          `json:"instanceId"`
+	Traffic    TrafficForecast `json:"traffic"`
+}
+
+// EndpointForecast 主控容量预测
+type EndpointForecast struct {
+	EndpointID int64           `json:"endpointId"`
+	Name       string          `json:"name"`
+	Traffic    TrafficForecast `json:"traffic"`
+	CPU        GaugeForecast   `json:"cpu"`
+	Memory     GaugeForecast   `json:"memory"`
+}
+
+// Service 容量预测服务
+// 基于 traffic_hourly_summary 预测自然月流量，基于定期采样的主控系统指标预测 CPU、内存使用率，
+// 并按容量阈值估算越过阈值的时间；系统指标取自共享轮询器的缓存，不单独请求主控
+type Service struct {
+	*periodic.Task
+	db          *gorm.DB
+	infos       *endpointinfo.Poller
+	lastCleanup time.Time
+
+	now func() time.Time
+}
+
+// NewService 创建容量预测服务，infos 为空时不采样系统指标
+func NewService(db *gorm.DB, infos *endpointinfo.Poller) *Service {
+	s := &Service{
+		db:    db,
+		infos: infos,
+		now:   time.Now,
+	}
+	s.Task = periodic.New("容量预测服务", sampleInterval, s.run)
+	return s
+}
+
+// run 采样主控系统指标，并按清理间隔删除过期采样
+func (s *Service) run() error {
+	s.sample()
+	if time.Since(s.lastCleanup) >= cleanupInterval {
+		s.cleanup()
+		s.lastCleanup = time.Now()
+	}
+	return nil
+}
+
+// sample 保存轮询器缓存中在线主控的系统信息
+func (s *Service) sample() {
+	if s.infos == nil {
+		return
+	}
+	infos := s.infos.Snapshot()
+	if len(infos) == 0 {
+		return
+	}
+	now := s.now()
+	samples := make([]models.EndpointSystemSample, 0, len(infos))
+	for id, info := range infos {
+		samples = append(samples, models.EndpointSystemSample{
+			EndpointID: id,
+			SampleTime: now,
+			CPU:        float64(info.CPU),
+			MemUsed:    info.MemUsed,
+			MemTotal:   info.MemTotal,
+			NetRx:      info.NetRx,
+			NetTx:      info.NetTx,
+		})
+	}
+	if err := s.db.CreateInBatches(samples, 100).Error; err != nil {
+		log.Warnf("[Forecast]保存主控系统指标失败: %v", err)
+	}
+}
+
+func (s *Service) cleanup() {
+	if err := s.db.Where("sample_time < ?", s.now().Add(-sampleRetention)).
+		Delete(&models.EndpointSystemSample{}).Error; err != nil {
+		log.Warnf("[Forecast]清理主控系统指标失败: %v", err)
+	}
+}
+
+// ListThresholds 列出全部容量阈值
+func (s *Service) ListThresholds() ([]models.CapacityThreshold, error) {
+	thresholds := []models.CapacityThreshold{}
+	err := s.db.Order("scope ASC, target_id ASC, metric ASC").Find(&thresholds).Error
+	return thresholds, err
+}
+
+// SaveThreshold 按 (scope, targetId, metric) 新增或更新容量阈值
+func (s *Service) SaveThreshold(t *models.CapacityThreshold) error {
+	switch {
+	case t.Scope != models.CapacityScopeTunnel && t.Scope != models.CapacityScopeEndpoint:
+		return fmt.Errorf("%w: scope 仅支持 tunnel、endpoint", ErrInvalidThreshold)
+	case t.Metric != models.CapacityMetricMonthlyTraffic && t.Metric != models.CapacityMetricCPU && t.Metric != models.CapacityMetricMemory:
+		return fmt.Errorf("%w: 不支持的指标 %q", ErrInvalidThreshold, t.Metric)
+	case t.Scope == models.CapacityScopeTunnel && t.Metric != models.CapacityMetricMonthlyTraffic:
+		return fmt.Errorf("%w: 隧道仅支持 monthly_traffic 阈值", ErrInvalidThreshold)
+	case t.Limit <= 0:
+		return fmt.Errorf("%w: 阈值需大于 0", ErrInvalidThreshold)
+	case t.Metric != models.CapacityMetricMonthlyTraffic && t.Limit > 100:
+		return fmt.Errorf("%w: 使用率阈值不能超过 100", ErrInvalidThreshold)
+	case t.TargetID < 0:
+		return fmt.Errorf("%w: targetId 不能为负数", ErrInvalidThreshold)
+	}
+	t.ID = 0
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "target_id"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"limit_value", "updated_at"}),
+	}).Create(t).Error; err != nil {
+		return err
+	}
+	return s.db.Where("scope = ? AND target_id = ? AND metric = ?", t.Scope, t.TargetID, t.Metric).First(t).Error
+}
+
+// DeleteThreshold 删除容量阈值
+func (s *Service) DeleteThreshold(id int64) error {
+	result := s.db.Delete(&models.CapacityThreshold{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// thresholds 阈值索引：具体对象优先，其次为该作用对象的默认阈值，最后为内置默认值
+type thresholds map[string]float64
+
+func thresholdKey(scope models.CapacityScope, targetID int64, metric models.CapacityMetric) string {
+	return string(scope) + ":" + strconv.FormatInt(targetID, 10) + ":" + string(metric)
+}
+
+func (s *Service) loadThresholds() (thresholds, error) {
+	var list []models.CapacityThreshold
+	if err := s.db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	index := thresholds{
+		thresholdKey(models.CapacityScopeEndpoint, 0, models.CapacityMetricCPU):    defaultCPULimit,
+		thresholdKey(models.CapacityScopeEndpoint, 0, models.CapacityMetricMemory): defaultMemoryLimit,
+	}
+	for _, t := range list {
+		index[thresholdKey(t.Scope, t.TargetID, t.Metric)] = t.Limit
+	}
+	return index, nil
+}
+
+func (t thresholds) lookup(scope models.CapacityScope, targetID int64, metric models.CapacityMetric) (float64, bool) {
+	if v, ok := t[thresholdKey(scope, targetID, metric)]; ok {
+		return v, true
+	}
+	v, ok := t[thresholdKey(scope, 0, metric)]
+	return v, ok
+}
+
+// calendar 预测所需的时间边界（本地时区）
+type calendar struct {
+	now         time.Time
+	currentHour time.Time // 已完成整小时的结束时间
+	today       time.Time
+	monthStart  time.Time
+	monthEnd    time.Time
+	historyFrom time.Time
+}
+
+func newCalendar(now time.Time) calendar {
+	now = now.In(time.Local)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	return calendar{
+		now:         now,
+		currentHour: timezone.StartOfHour(now, time.Local),
+		today:       today,
+		monthStart:  monthStart,
+		monthEnd:    monthStart.AddDate(0, 1, 0),
+		historyFrom: today.AddDate(0, 0, -trafficHistoryDays),
+	}
+}
+
+// dayIndex 返回 t 所在自然日相对 from 的天数（夏令时安全）
+func dayIndex(from, t time.Time) int {
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	return int(math.Round(day.Sub(from).Hours() / 24))
+}
+
+// trafficData 单个实例（或主控）的每日流量与本月累计
+type trafficData struct {
+	daily    []float64
+	firstDay int // 第一个有数据的日序号，-1 表示没有历史数据
+	mtd      int64
+}
+
+func newTrafficData() *trafficData {
+	return &trafficData{daily: make([]float64, trafficHistoryDays), firstDay: -1}
+}
+
+func (d *trafficData) add(cal calendar, hour time.Time, bytes int64) {
+	if !hour.Before(cal.monthStart) {
+		d.mtd += bytes
+	}
+	if hour.Before(cal.today) && !hour.Before(cal.historyFrom) {
+		i := dayIndex(cal.historyFrom, hour)
+		d.daily[i] += float64(bytes)
+		if d.firstDay < 0 || i < d.firstDay {
+			d.firstDay = i
+		}
+	}
+}
+
+func (d *trafficData) merge(o *trafficData) {
+	for i, v := range o.daily {
+		d.daily[i] += v
+	}
+	if o.firstDay >= 0 && (d.firstDay < 0 || o.firstDay < d.firstDay) {
+		d.firstDay = o.firstDay
+	}
+	d.mtd += o.mtd
+}
+
+// loadTraffic 按实例读取历史与本月的整小时流量，where 为空时读取全部实例
+func (s *Service) loadTraffic(cal calendar, where string, args ...interface{}) (map[string]*trafficData, error) {
+	from := cal.historyFrom
+	if cal.monthStart.Before(from) {
+		from = cal.monthStart
+	}
+	query := s.db.Model(&models.TrafficHourlySummary{}).
+		Select("endpoint_id", "instance_id", "hour_time", "tcp_rx_increment", "tcp_tx_increment", "udp_rx_increment", "udp_tx_increment").
+		Where("hour_time >= ? AND hour_time < ? AND instance_id <> ''", from, cal.currentHour)
+	if where != "" {
+		query = query.Where(where, args...)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := make(map[string]*trafficData)
+	for rows.Next() {
+		var r models.TrafficHourlySummary
+		if err := s.db.ScanRows(rows, &r); err != nil {
+			return nil, err
+		}
+		key := strconv.FormatInt(r.EndpointID, 10) + ":" + r.InstanceID
+		d, ok := data[key]
+		if !ok {
+			d = newTrafficData()
+			data[key] = d
+		}
+		d.add(cal, r.HourTime, r.GetTotalIncrement())
+	}
+	return data, rows.Err()
+}
+
+// forecastTraffic 预测本月剩余流量并估算越过月度阈值的时间
+func forecastTraffic(cal calendar, d *trafficData, limit float64, hasLimit bool, detail bool) TrafficForecast {
+	f := TrafficForecast{MonthStart: cal.monthStart, MonthEnd: cal.monthEnd, MonthToDate: d.mtd}
+	var history []float64
+	if d.firstDay >= 0 {
+		history = d.daily[d.firstDay:]
+	}
+	// 历史窗口内才开始有数据时，第一天通常不完整
+	if d.firstDay > 0 && len(history) > weekSeason {
+		history = history[1:]
+	}
+	m := fit(history, weekSeason)
+	f.Method = m.method
+
+	// 预测步长以天为单位，第一步为今天剩余的部分（权重为剩余比例）
+	days := dayIndex(cal.today, cal.monthEnd.Add(-time.Second)) + 1
+	weights := make([]float64, days)
+	means := make([]float64, days)
+	starts := make([]time.Time, days)
+	for h := range weights {
+		weights[h] = 1
+		starts[h] = cal.today.AddDate(0, 0, h)
+		means[h] = math.Max(m.predict(h+1), 0)
+	}
+	dayEnd := cal.today.AddDate(0, 0, 1)
+	weights[0] = dayEnd.Sub(cal.currentHour).Hours() / dayEnd.Sub(cal.today).Hours()
+	starts[0] = cal.currentHour
+
+	mtd := float64(d.mtd)
+	projected := mtd
+	for h := range weights {
+		projected += weights[h] * means[h]
+	}
+	sd := z95 * m.weightedSumStd(weights)
+	f.Projected = Band{Mean: projected, Lower: math.Max(projected-sd, mtd), Upper: projected + sd}
+
+	if detail {
+		for i := d.firstDay; i >= 0 && i < len(d.daily); i++ {
+			f.History = append(f.History, Point{Date: cal.historyFrom.AddDate(0, 0, i), Value: d.daily[i]})
+		}
+		for h := range weights {
+			step := z95 * m.stepStd(h+1)
+			f.Forecast = append(f.Forecast, ForecastPoint{
+				Date: cal.today.AddDate(0, 0, h),
+				Band: Band{Mean: means[h], Lower: math.Max(means[h]-step, 0), Upper: means[h] + step},
+			})
+		}
+	}
+
+	if !hasLimit {
+		return f
+	}
+	c := &Crossing{Metric: models.CapacityMetricMonthlyTraffic, Limit: limit, Exceeded: mtd >= limit}
+	f.Threshold = c
+	if c.Exceeded || m.method == MethodNone {
+		return f
+	}
+	// 逐日累加，越过阈值的当天按线性插值估算具体时间
+	cumMean, cumUpperPrev := mtd, mtd
+	for h := range weights {
+		dayLen := time.Duration(weights[h] * float64(dayEnd.Sub(cal.today)))
+		add := weights[h] * means[h]
+		if c.At == nil && add > 0 && cumMean+add >= limit {
+			at := starts[h].Add(time.Duration(float64(dayLen) * (limit - cumMean) / add))
+			c.At, c.DaysUntil = &at, daysBetween(cal.now, at)
+		}
+		cumMean += add
+		cumUpper := cumMean + z95*m.weightedSumStd(weights[:h+1])
+		if c.EarliestAt == nil && cumUpper >= limit {
+			frac := 1.0
+			if cumUpper > cumUpperPrev {
+				frac = (limit - cumUpperPrev) / (cumUpper - cumUpperPrev)
+			}
+			at := starts[h].Add(time.Duration(float64(dayLen) * math.Max(frac, 0)))
+			c.EarliestAt, c.EarliestDaysUntil = &at, daysBetween(cal.now, at)
+		}
+		cumUpperPrev = cumUpper
+	}
+	return f
+}
+
+func daysBetween(from, to time.Time) *float64 {
+	days := math.Max(to.Sub(from).Hours()/24, 0)
+	return &days
+}
+
+// loadGauges 读取主控系统指标，按小时平均后取每日峰值，返回 CPU 与内存使用率序列及最新值
+func (s *Service) loadGauges(cal calendar, endpointIDs []int64) (map[int64]*gaugeData, error) {
+	from := cal.today.AddDate(0, 0, -gaugeHistoryDays)
+	query := s.db.Model(&models.EndpointSystemSample{}).Where("sample_time >= ?", from).Order("sample_time ASC")
+	if endpointIDs != nil {
+		query = query.Where("endpoint_id IN ?", endpointIDs)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	data := make(map[int64]*gaugeData)
+	for rows.Next() {
+		var r models.EndpointSystemSample
+		if err := s.db.ScanRows(rows, &r); err != nil {
+			return nil, err
+		}
+		g, ok := data[r.EndpointID]
+		if !ok {
+			g = newGaugeData()
+			data[r.EndpointID] = g
+		}
+		mem := 0.0
+		if r.MemTotal > 0 {
+			mem = float64(r.MemUsed) / float64(r.MemTotal) * 100
+		}
+		g.add(cal, from, r.SampleTime, r.CPU, mem)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, g := range data {
+		g.flush(cal, from)
+	}
+	return data, nil
+}
+
+// gaugeData 单个主控的 CPU、内存每日峰值
+type gaugeData struct {
+	cpu, mem         []float64
+	firstDay         int
+	currentCPU       float64
+	currentMem       float64
+	hour             time.Time
+	hourCPU, hourMem float64
+	hourN            int
+}
+
+func newGaugeData() *gaugeData {
+	return &gaugeData{cpu: make([]float64, gaugeHistoryDays), mem: make([]float64, gaugeHistoryDays), firstDay: -1}
+}
+
+func (g *gaugeData) add(cal calendar, from, t time.Time, cpu, mem float64) {
+	g.currentCPU, g.currentMem = cpu, mem
+	hour := timezone.StartOfHour(t, time.Local)
+	if !hour.Equal(g.hour) {
+		g.flush(cal, from)
+		g.hour = hour
+	}
+	g.hourCPU += cpu
+	g.hourMem += mem
+	g.hourN++
+}
+
+// flush 将当前小时的平均值计入所在日的峰值（只统计今天之前的完整日）
+func (g *gaugeData) flush(cal calendar, from time.Time) {
+	if g.hourN == 0 {
+		return
+	}
+	if g.hour.Before(cal.today) {
+		i := dayIndex(from, g.hour)
+		if i >= 0 && i < gaugeHistoryDays {
+			g.cpu[i] = math.Max(g.cpu[i], g.hourCPU/float64(g.hourN))
+			g.mem[i] = math.Max(g.mem[i], g.hourMem/float64(g.hourN))
+			if g.firstDay < 0 || i < g.firstDay {
+				g.firstDay = i
+			}
+		}
+	}
+	g.hourCPU, g.hourMem, g.hourN = 0, 0, 0
+}
+
+// forecastGauge 预测使用率并估算越过阈值的天数
+func forecastGauge(cal calendar, from time.Time, series []float64, current float64,
+	metric models.CapacityMetric, limit float64, detail bool) GaugeForecast {
+	m := fit(series, weekSeason)
+	f := GaugeForecast{Method: m.method, Current: current}
+	c := &Crossing{Metric: metric, Limit: limit, Exceeded: current >= limit}
+	f.Threshold = c
+
+	if detail {
+		for i, v := range series {
+			f.History = append(f.History, Point{Date: from.AddDate(0, 0, i), Value: v})
+		}
+	}
+	if m.method == MethodNone {
+		return f
+	}
+	for h := 1; h <= gaugeHorizonDays; h++ {
+		mean := m.predict(h)
+		step := z95 * m.stepStd(h)
+		date := cal.today.AddDate(0, 0, h-1)
+		if detail {
+			f.Forecast = append(f.Forecast, ForecastPoint{Date: date, Band: Band{
+				Mean: clampPercent(mean), Lower: clampPercent(mean - step), Upper: clampPercent(mean + step),
+			}})
+		}
+		if c.Exceeded {
+			continue
+		}
+		if c.At == nil && mean >= limit {
+			c.At, c.DaysUntil = &date, daysBetween(cal.today, date)
+		}
+		if c.EarliestAt == nil && mean+step >= limit {
+			c.EarliestAt, c.EarliestDaysUntil = &date, daysBetween(cal.today, date)
+		}
+	}
+	return f
+}
+
+func clampPercent(v float64) float64 {
+	return math.Min(math.Max(v, 0), 100)
+}
+
+func (g *gaugeData) series(values []float64) []float64 {
+	if g.firstDay < 0 {
+		return nil
+	}
+	return values[g.firstDay:]
+}
+
+// TunnelForecast 预测单个隧道的本月流量
+func (s *Service) TunnelForecast(id int64) (*TunnelForecast, error) {
+	var tunnel models.Tunnel
+	if err := s.db.Select("id", "name", "endpoint_id", "instance_id").First(&tunnel, id).Error; err != nil {
+		return nil, err
+	}
+	th, err := s.loadThresholds()
+	if err != nil {
+		return nil, err
+	}
+	cal := newCalendar(s.now())
+	result := &TunnelForecast{TunnelID: tunnel.ID, Name: tunnel.Name, EndpointID: tunnel.EndpointID}
+	d := newTrafficData()
+	if tunnel.InstanceID != nil && *tunnel.InstanceID != "" {
+		result.InstanceID = *tunnel.InstanceID
+		data, err := s.loadTraffic(cal, "endpoint_id = ? AND instance_id = ?", tunnel.EndpointID, *tunnel.InstanceID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range data {
+			d = v
+		}
+	}
+	limit, ok := th.lookup(models.CapacityScopeTunnel, tunnel.ID, models.CapacityMetricMonthlyTraffic)
+	result.Traffic = forecastTraffic(cal, d, limit, ok, true)
+	return result, nil
+}
+
+// EndpointForecast 预测单个主控的本月流量与 CPU、内存使用率
+func (s *Service) EndpointForecast(id int64) (*EndpointForecast, error) {
+	var endpoint models.Endpoint
+	if err := s.db.Select("id", "name").First(&endpoint, id).Error; err != nil {
+		return nil, err
+	}
+	items, err := s.endpointForecasts([]models.Endpoint{endpoint}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+func (s *Service) endpointForecasts(endpoints []models.Endpoint, detail bool) ([]EndpointForecast, error) {
+	th, err := s.loadThresholds()
+	if err != nil {
+		return nil, err
+	}
+	cal := newCalendar(s.now())
+	// 单个主控时只读取该主控的数据，概览读取全部
+	var ids []int64
+	var traffic map[string]*trafficData
+	if detail {
+		for _, e := range endpoints {
+			ids = append(ids, e.ID)
+		}
+		traffic, err = s.loadTraffic(cal, "endpoint_id IN ?", ids)
+	} else {
+		traffic, err = s.loadTraffic(cal, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	perEndpoint := make(map[int64]*trafficData)
+	for key, d := range traffic {
+		endpoint, _, _ := strings.Cut(key, ":")
+		endpointID, _ := strconv.ParseInt(endpoint, 10, 64)
+		total, ok := perEndpoint[endpointID]
+		if !ok {
+			total = newTrafficData()
+			perEndpoint[endpointID] = total
+		}
+		total.merge(d)
+	}
+	gauges, err := s.loadGauges(cal, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	gaugeFrom := cal.today.AddDate(0, 0, -gaugeHistoryDays)
+	items := make([]EndpointForecast, 0, len(endpoints))
+	for _, e := range endpoints {
+		d, ok := perEndpoint[e.ID]
+		if !ok {
+			d = newTrafficData()
+		}
+		item := EndpointForecast{EndpointID: e.ID, Name: e.Name}
+		limit, hasLimit := th.lookup(models.CapacityScopeEndpoint, e.ID, models.CapacityMetricMonthlyTraffic)
+		item.Traffic = forecastTraffic(cal, d, limit, hasLimit, detail)
+
+		g, ok := gauges[e.ID]
+		if !ok {
+			g = newGaugeData()
+		}
+		from := gaugeFrom
+		if g.firstDay > 0 {
+			from = gaugeFrom.AddDate(0, 0, g.firstDay)
+		}
+		cpuLimit, _ := th.lookup(models.CapacityScopeEndpoint, e.ID, models.CapacityMetricCPU)
+		memLimit, _ := th.lookup(models.CapacityScopeEndpoint, e.ID, models.CapacityMetricMemory)
+		item.CPU = forecastGauge(cal, from, g.series(g.cpu), g.currentCPU, models.CapacityMetricCPU, cpuLimit, detail)
+		item.Memory = forecastGauge(cal, from, g.series(g.mem), g.currentMem, models.CapacityMetricMemory, memLimit, detail)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// TunnelOverview 全部隧道的本月流量预测（不含每日明细），按越过阈值的时间排序
+func (s *Service) TunnelOverview() ([]TunnelForecast, error) {
+	th, err := s.loadThresholds()
+	if err != nil {
+		return nil, err
+	}
+	var tunnels []models.Tunnel
+	if err := s.db.Select("id", "name", "endpoint_id", "instance_id").
+		Where("instance_id IS NOT NULL AND instance_id <> ''").Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+	cal := newCalendar(s.now())
+	traffic, err := s.loadTraffic(cal, "")
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]TunnelForecast, 0, len(tunnels))
+	for _, t := range tunnels {
+		d, ok := traffic[strconv.FormatInt(t.EndpointID, 10)+":"+*t.InstanceID]
+		if !ok {
+			d = newTrafficData()
+		}
+		limit, hasLimit := th.lookup(models.CapacityScopeTunnel, t.ID, models.CapacityMetricMonthlyTraffic)
+		items = append(items, TunnelForecast{
+			TunnelID:   t.ID,
+			Name:       t.Name,
+			EndpointID: t.EndpointID,
+			InstanceID: *t.InstanceID,
+			Traffic:    forecastTraffic(cal, d, limit, hasLimit, false),
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return lessCrossing(items[i].Traffic.Threshold, items[j].Traffic.Threshold,
+			items[i].Traffic.Projected.Mean, items[j].Traffic.Projected.Mean)
+	})
+	return items, nil
+}
+
+// EndpointOverview 全部主控的容量预测（不含每日明细），按最早越过任一阈值的时间排序
+func (s *Service) EndpointOverview() ([]EndpointForecast, error) {
+	var endpoints []models.Endpoint
+	if err := s.db.Select("id", "name").Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	items, err := s.endpointForecasts(endpoints, false)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return lessCrossing(firstCrossing(items[i]), firstCrossing(items[j]),
+			items[i].Traffic.Projected.Mean, items[j].Traffic.Projected.Mean)
+	})
+	return items, nil
+}
+
+// firstCrossing 返回主控最早越过的阈值
+func firstCrossing(e EndpointForecast) *Crossing {
+	var first *Crossing
+	for _, c := range []*Crossing{e.Traffic.Threshold, e.CPU.Threshold, e.Memory.Threshold} {
+		if lessCrossing(c, first, 0, 0) {
+			first = c
+		}
+	}
+	return first
+}
+
+// lessCrossing 已超过阈值的排最前，其次按越过阈值的天数，最后按预计流量从大到小
+func lessCrossing(a, b *Crossing, projectedA, projectedB float64) bool {
+	rank := func(c *Crossing) float64 {
+		switch {
+		case c == nil:
+			return math.Inf(1)
+		case c.Exceeded:
+			return -1
+		case c.DaysUntil != nil:
+			return *c.DaysUntil
+		}
+		return math.Inf(1)
+	}
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return projectedA > projectedB
+}
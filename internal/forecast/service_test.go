@@ -0,0 +1,124 @@
+package forecast
+
+import (
+	"NodePassDash/internal/endpointinfo"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/testdb"
+	"math"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestFitSeasonalTrend(t *testing.T) {
+	// 线性增长叠加周末高峰
+	series := make([]float64, 28)
+	for i := range series {
+		series[i] = 100 + 2*float64(i)
+		if i%7 >= 5 {
+			series[i] += 50
+		}
+	}
+	m := fit(series, 7)
+	if m.method != MethodHoltWinters {
+		t.Fatalf("method = %s", m.method)
+	}
+	for h := 1; h <= 7; h++ {
+		i := len(series) + h - 1
+		want := 100 + 2*float64(i)
+		if i%7 >= 5 {
+			want += 50
+		}
+		if got := m.predict(h); math.Abs(got-want) > 1 {
+			t.Errorf("predict(%d) = %.2f, want %.2f", h, got, want)
+		}
+	}
+	if m := fit([]float64{5, 7}, 7); m.method != MethodMean || m.predict(3) != 6 {
+		t.Errorf("short series = %+v", m)
+	}
+}
+
+func TestTunnelAndEndpointForecast(t *testing.T) {
+	db := testdb.Open(t, &models.Endpoint{}, &models.Tunnel{}, &models.TrafficHourlySummary{},
+		&models.CapacityThreshold{}, &models.EndpointSystemSample{})
+	instance := "a"
+	db.Create(&models.Endpoint{ID: 1, Name: "hk", URL: "http://hk", APIPath: "/api", APIKey: "k"})
+	db.Create(&models.Tunnel{ID: 1, Name: "web", EndpointID: 1, InstanceID: &instance})
+
+	// 每小时 1000 字节，持续时间超过历史窗口；当前时间为 1 月 15 日 12:30
+	// 选在 1 月是因为此前 60 天内各地都没有夏令时切换，本月按 744 小时计
+	now := time.Date(2026, 1, 15, 12, 30, 0, 0, time.Local)
+	for hour := time.Date(2026, 1, 15, 11, 0, 0, 0, time.Local); hour.After(now.AddDate(0, 0, -60)); hour = hour.Add(-time.Hour) {
+		db.Create(&models.TrafficHourlySummary{HourTime: hour, EndpointID: 1, InstanceID: instance, TCPRxIncrement: 1000})
+	}
+	// CPU 每日峰值从 50% 起每天增长 1%
+	for day := 30; day >= 1; day-- {
+		at := time.Date(2026, 1, 15-day, 12, 0, 0, 0, time.Local)
+		db.Create(&models.EndpointSystemSample{EndpointID: 1, SampleTime: at, CPU: float64(80 - day), MemUsed: 1, MemTotal: 4})
+	}
+
+	s := NewService(db, nil)
+	s.now = func() time.Time { return now }
+	if err := s.SaveThreshold(&models.CapacityThreshold{Scope: models.CapacityScopeTunnel, Metric: models.CapacityMetricMonthlyTraffic, Limit: 500000}); err != nil {
+		t.Fatalf("save threshold: %v", err)
+	}
+	if err := s.SaveThreshold(&models.CapacityThreshold{Scope: models.CapacityScopeTunnel, Metric: models.CapacityMetricCPU, Limit: 80}); err == nil {
+		t.Error("expected cpu threshold on tunnel to be rejected")
+	}
+
+	f, err := s.TunnelForecast(1)
+	if err != nil {
+		t.Fatalf("TunnelForecast: %v", err)
+	}
+	// 已用 14 天半，剩余 16 天半
+	traffic := f.Traffic
+	if traffic.MonthToDate != 348000 || math.Abs(traffic.Projected.Mean-744000) > 1 || traffic.Projected.Lower < 348000 {
+		t.Fatalf("traffic = %+v", traffic)
+	}
+	c := traffic.Threshold
+	want := time.Date(2026, 1, 21, 20, 0, 0, 0, time.Local)
+	if c == nil || c.Exceeded || c.At == nil || c.At.Sub(want).Abs() > time.Minute {
+		t.Fatalf("crossing = %+v", c)
+	}
+
+	e, err := s.EndpointForecast(1)
+	if err != nil {
+		t.Fatalf("EndpointForecast: %v", err)
+	}
+	if e.Traffic.MonthToDate != 348000 || e.Memory.Current != 25 || e.Memory.Threshold.At != nil {
+		t.Errorf("endpoint = %+v", e)
+	}
+	// 最后一个峰值为 79%（1 月 14 日），约 10 天后越过默认阈值 90%
+	if cpu := e.CPU.Threshold; cpu.DaysUntil == nil || math.Abs(*cpu.DaysUntil-10) > 1 {
+		t.Errorf("cpu crossing = %+v", cpu)
+	}
+
+	if _, err := s.TunnelForecast(2); err != gorm.ErrRecordNotFound {
+		t.Errorf("missing tunnel err = %v", err)
+	}
+}
+
+func TestSampleReadsSharedPoller(t *testing.T) {
+	db := testdb.Open(t, &models.Endpoint{}, &models.EndpointSystemSample{})
+	db.Create(&models.Endpoint{ID: 1, Name: "hk", URL: "http://hk", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline})
+	db.Create(&models.Endpoint{ID: 2, Name: "sg", URL: "http://sg", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOffline})
+
+	calls := 0
+	infos := endpointinfo.NewPoller(db, func(int64) (*nodepass.EndpointInfoResult, error) {
+		calls++
+		return &nodepass.EndpointInfoResult{CPU: 42, MemUsed: 1, MemTotal: 4}, nil
+	})
+	infos.Poll()
+	s := NewService(db, infos)
+	s.sample()
+	s.sample()
+
+	// 采样只读取轮询器缓存，不会再次请求主控
+	var samples []models.EndpointSystemSample
+	db.Find(&samples)
+	if calls != 1 || len(samples) != 2 || samples[0].EndpointID != 1 || samples[0].CPU != 42 {
+		t.Errorf("calls = %d, samples = %+v", calls, samples)
+	}
+}
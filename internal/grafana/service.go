@@ -0,0 +1,573 @@
+package grafana
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/timezone"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidQuery 查询参数不合法
+var ErrInvalidQuery = errors.New("无效的查询参数")
+
+// 单次请求最多返回的注释条数
+const annotationLimit = 1000
+
+// 数据来源表
+const (
+	sourceHistory   = "service_history"
+	sourceHourly    = "traffic_hourly_summary"
+	sourceDashboard = "dashboard_traffic_summary"
+)
+
+// aggregation 分桶聚合方式
+type aggregation int
+
+const (
+	aggAverage aggregation = iota // 取平均：瞬时值
+	aggSum                        // 累加：区间增量
+	aggLast                       // 取桶内最后一个值：累计快照
+)
+
+// sourceAggregations 每个数据表固定一种分桶语义：
+// service_history 为分钟平均值，traffic_hourly_summary 为每小时增量，
+// dashboard_traffic_summary 为整点时全部实例累计值之和（快照，累加或平均都没有意义）
+var sourceAggregations = map[string]aggregation{
+	sourceHistory:   aggAverage,
+	sourceHourly:    aggSum,
+	sourceDashboard: aggLast,
+}
+
+// metric 指标定义：expr 为取值表达式，
+// counter 表示取值为累计计数器，按实例对相邻记录求差得到增量后累加
+type metric struct {
+	source  string
+	expr    string
+	counter bool
+}
+
+// aggregation 返回指标的分桶聚合方式
+func (m metric) aggregation() aggregation {
+	if m.counter {
+		return aggSum
+	}
+	return sourceAggregations[m.source]
+}
+
+// metricNames 按展示顺序排列的指标名
+var metricNames = []string{
+	"tunnel.speed_in", "tunnel.speed_out", "tunnel.ping", "tunnel.p99_ping",
+	"tunnel.pool", "tunnel.tcps", "tunnel.udps", "tunnel.traffic",
+	"tunnel.hourly_rx", "tunnel.hourly_tx", "tunnel.hourly_traffic",
+	"dashboard.tcp_rx_total", "dashboard.tcp_tx_total", "dashboard.udp_rx_total", "dashboard.udp_tx_total",
+	"dashboard.instances",
+}
+
+// metrics 指标定义，service_history 的 delta_* 为分钟末累计值，因此 tunnel.traffic 按计数器求差
+var metrics = map[string]metric{
+	"tunnel.speed_in":        {source: sourceHistory, expr: "avg_speed_in"},
+	"tunnel.speed_out":       {source: sourceHistory, expr: "avg_speed_out"},
+	"tunnel.ping":            {source: sourceHistory, expr: "avg_ping"},
+	"tunnel.p99_ping":        {source: sourceHistory, expr: "p99_ping"},
+	"tunnel.pool":            {source: sourceHistory, expr: "avg_pool"},
+	"tunnel.tcps":            {source: sourceHistory, expr: "avg_tcps"},
+	"tunnel.udps":            {source: sourceHistory, expr: "avg_udps"},
+	"tunnel.traffic":         {source: sourceHistory, expr: "delta_tcp_in + delta_tcp_out + delta_udp_in + delta_udp_out", counter: true},
+	"tunnel.hourly_rx":       {source: sourceHourly, expr: "tcp_rx_increment + udp_rx_increment"},
+	"tunnel.hourly_tx":       {source: sourceHourly, expr: "tcp_tx_increment + udp_tx_increment"},
+	"tunnel.hourly_traffic":  {source: sourceHourly, expr: "tcp_rx_increment + tcp_tx_increment + udp_rx_increment + udp_tx_increment"},
+	"dashboard.tcp_rx_total": {source: sourceDashboard, expr: "tcp_rx_total"},
+	"dashboard.tcp_tx_total": {source: sourceDashboard, expr: "tcp_tx_total"},
+	"dashboard.udp_rx_total": {source: sourceDashboard, expr: "udp_rx_total"},
+	"dashboard.udp_tx_total": {source: sourceDashboard, expr: "udp_tx_total"},
+	"dashboard.instances":    {source: sourceDashboard, expr: "instance_count"},
+}
+
+// TagKeys 支持的 ad-hoc 过滤键
+var TagKeys = []string{"tunnel", "endpoint", "group"}
+
+// Range 查询时间范围
+type Range struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Target 查询目标
+type Target struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+}
+
+// AdhocFilter ad-hoc 过滤条件，operator 支持 =、!=、=~、!~
+type AdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// QueryRequest /query 请求体
+type QueryRequest struct {
+	Range         Range         `json:"range"`
+	IntervalMs    int64         `json:"intervalMs"`
+	MaxDataPoints int           `json:"maxDataPoints"`
+	Targets       []Target      `json:"targets"`
+	AdhocFilters  []AdhocFilter `json:"adhocFilters"`
+}
+
+// Series 时间序列，datapoints 为 [值, 毫秒时间戳]
+type Series struct {
+	Target     string       `json:"target"`
+	RefID      string       `json:"refId,omitempty"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// AnnotationQuery 注释定义，query 取值：空、tunnel、endpoint、tunnel:<名称>、endpoint:<名称>
+type AnnotationQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// AnnotationRequest /annotations 请求体
+type AnnotationRequest struct {
+	Range      Range           `json:"range"`
+	Annotation AnnotationQuery `json:"annotation"`
+}
+
+// Annotation 注释事件
+type Annotation struct {
+	Annotation AnnotationQuery `json:"annotation"`
+	Time       int64           `json:"time"`
+	Title      string          `json:"title"`
+	Text       string          `json:"text"`
+	Tags       []string        `json:"tags"`
+}
+
+// member 实例对应的隧道信息
+type member struct {
+	tunnel   string
+	endpoint string
+	groups   []string
+}
+
+// Service Grafana 数据源服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建 Grafana 数据源服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Search 返回名称包含 keyword 的指标
+func (s *Service) Search(keyword string) []string {
+	result := make([]string, 0, len(metricNames))
+	for _, name := range metricNames {
+		if strings.Contains(name, keyword) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// TagValues 返回过滤键的可选值
+func (s *Service) TagValues(key string) ([]string, error) {
+	var values []string
+	var err error
+	switch key {
+	case "tunnel":
+		err = s.db.Model(&models.Tunnel{}).Distinct().Order("name").Pluck("name", &values).Error
+	case "endpoint":
+		err = s.db.Model(&models.Endpoint{}).Distinct().Order("name").Pluck("name", &values).Error
+	case "group":
+		err = s.db.Model(&models.Group{}).Order("name").Pluck("name", &values).Error
+	default:
+		return nil, fmt.Errorf("%w: 未知的过滤键 %s", ErrInvalidQuery, key)
+	}
+	return values, err
+}
+
+// Query 按 Grafana 请求返回时间序列，tunnel.* 指标每个隧道一条序列
+func (s *Service) Query(req QueryRequest) ([]Series, error) {
+	if !req.Range.To.After(req.Range.From) {
+		return nil, fmt.Errorf("%w: 时间范围不合法", ErrInvalidQuery)
+	}
+	filters, err := compileFilters(req.AdhocFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval <= 0 && req.MaxDataPoints > 0 {
+		interval = req.Range.To.Sub(req.Range.From) / time.Duration(req.MaxDataPoints)
+	}
+
+	var members map[string]member
+	result := make([]Series, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		m, ok := metrics[target.Target]
+		if !ok {
+			return nil, fmt.Errorf("%w: 未知的指标 %s", ErrInvalidQuery, target.Target)
+		}
+		if m.source != sourceDashboard && members == nil {
+			if members, err = s.loadMembers(); err != nil {
+				return nil, err
+			}
+		}
+		series, err := s.querySeries(m, req.Range, interval, members, filters)
+		if err != nil {
+			return nil, err
+		}
+		for i := range series {
+			if m.source == sourceDashboard {
+				series[i].Target = target.Target
+			}
+			series[i].RefID = target.RefID
+		}
+		result = append(result, series...)
+	}
+	return result, nil
+}
+
+// point 查询出的原始数据点
+type point struct {
+	EndpointID int64
+	InstanceID string
+	Time       time.Time
+	Value      float64
+}
+
+// querySeries 查询单个指标并按实例与时间分桶
+func (s *Service) querySeries(m metric, r Range, interval time.Duration, members map[string]member, filters []filter) ([]Series, error) {
+	timeColumn, resolution := "record_time", time.Minute
+	columns := "endpoint_id, instance_id, "
+	switch m.source {
+	case sourceHourly:
+		timeColumn, resolution = "hour_time", time.Hour
+	case sourceDashboard:
+		timeColumn, resolution = "hour_time", time.Hour
+		columns = ""
+	}
+	if interval < resolution {
+		interval = resolution
+	}
+
+	// 计数器指标多取一个周期，作为范围内第一条记录求差的基准
+	from := r.From
+	if m.counter {
+		from = from.Add(-resolution)
+	}
+
+	var points []point
+	err := s.db.Table(m.source).
+		Select(columns+timeColumn+" AS time, "+m.expr+" AS value").
+		Where(timeColumn+" >= ? AND "+timeColumn+" <= ?", from.In(time.Local), r.To.In(time.Local)).
+		Order(timeColumn).
+		Scan(&points).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type bucket struct {
+		sum   float64
+		last  float64
+		count int
+	}
+	// 按实例分桶，同名隧道分属不同主控时各自成线
+	keys := []string{}
+	names := make(map[string]string)
+	buckets := make(map[string]map[int64]*bucket)
+	last := make(map[string]float64)
+	for _, p := range points {
+		key, name := "", ""
+		if m.source != sourceDashboard {
+			info := memberOf(members, p.EndpointID, p.InstanceID)
+			if !matchFilters(info, filters) {
+				continue
+			}
+			key, name = memberKey(p.EndpointID, p.InstanceID), info.tunnel
+		}
+		if m.counter {
+			// 与同一实例上一条记录求差，累计值变小视为计数器重置，增量取当前值；
+			// 每个实例的第一条记录只作为基准
+			prev, ok := last[key]
+			last[key] = p.Value
+			if !ok {
+				continue
+			}
+			if p.Value >= prev {
+				p.Value -= prev
+			}
+			if p.Time.Before(r.From) {
+				continue
+			}
+		}
+		series, ok := buckets[key]
+		if !ok {
+			series = make(map[int64]*bucket)
+			buckets[key] = series
+			names[key] = name
+			keys = append(keys, key)
+		}
+		ts := bucketStart(p.Time, interval).UnixMilli()
+		b, ok := series[ts]
+		if !ok {
+			b = &bucket{}
+			series[ts] = b
+		}
+		b.sum += p.Value
+		b.last = p.Value
+		b.count++
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool { return names[keys[i]] < names[keys[j]] })
+	result := make([]Series, 0, len(keys))
+	for _, key := range keys {
+		stamps := make([]int64, 0, len(buckets[key]))
+		for ts := range buckets[key] {
+			stamps = append(stamps, ts)
+		}
+		sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+
+		datapoints := make([][2]float64, 0, len(stamps))
+		for _, ts := range stamps {
+			b := buckets[key][ts]
+			value := b.sum
+			switch m.aggregation() {
+			case aggAverage:
+				value /= float64(b.count)
+			case aggLast:
+				value = b.last
+			}
+			datapoints = append(datapoints, [2]float64{value, float64(ts)})
+		}
+		result = append(result, Series{Target: names[key], Datapoints: datapoints})
+	}
+	return result, nil
+}
+
+// bucketStart 返回 t 所在分桶的起始时间，与 hour_time 一样按本地时区对齐：
+// 不足一小时的间隔在本地整点内切分，不足一天的在本地零点起切分，一天及以上按本地零点切分
+func bucketStart(t time.Time, interval time.Duration) time.Time {
+	const day = 24 * time.Hour
+	hour := timezone.StartOfHour(t, time.Local)
+	if interval < time.Hour {
+		return hour.Add(t.Sub(hour).Truncate(interval))
+	}
+	dayStart := timezone.StartOfDay(t, time.Local)
+	if interval < day {
+		return dayStart.Add(hour.Sub(dayStart).Truncate(interval))
+	}
+	days := int(interval / day)
+	n := int(time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, 0, 0, 0, time.UTC).Unix() / int64(day/time.Second))
+	return dayStart.AddDate(0, 0, -(n % days))
+}
+
+// loadMembers 加载实例到隧道、主控、分组名称的映射，键为 "endpointID:instanceID"
+func (s *Service) loadMembers() (map[string]member, error) {
+	endpoints, err := s.endpointNames()
+	if err != nil {
+		return nil, err
+	}
+
+	var tunnels []models.Tunnel
+	if err := s.db.Select("id", "name", "endpoint_id", "instance_id").
+		Where("instance_id IS NOT NULL AND instance_id <> ''").Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+
+	var groups []models.Group
+	if err := s.db.Select("id", "name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	groupNames := make(map[int64]string, len(groups))
+	for _, g := range groups {
+		groupNames[g.ID] = g.Name
+	}
+	var links []models.TunnelGroup
+	if err := s.db.Select("tunnel_id", "group_id").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	tunnelGroups := make(map[int64][]string)
+	for _, l := range links {
+		if name, ok := groupNames[l.GroupID]; ok {
+			tunnelGroups[l.TunnelID] = append(tunnelGroups[l.TunnelID], name)
+		}
+	}
+
+	members := make(map[string]member, len(tunnels))
+	for _, t := range tunnels {
+		members[memberKey(t.EndpointID, *t.InstanceID)] = member{
+			tunnel:   t.Name,
+			endpoint: endpoints[t.EndpointID],
+			groups:   tunnelGroups[t.ID],
+		}
+	}
+	return members, nil
+}
+
+// endpointNames 加载主控 ID 到名称的映射
+func (s *Service) endpointNames() (map[int64]string, error) {
+	var endpoints []models.Endpoint
+	if err := s.db.Select("id", "name").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(endpoints))
+	for _, e := range endpoints {
+		names[e.ID] = e.Name
+	}
+	return names, nil
+}
+
+func memberKey(endpointID int64, instanceID string) string {
+	return strconv.FormatInt(endpointID, 10) + ":" + instanceID
+}
+
+// memberOf 查找实例信息，已删除的隧道以实例 ID 命名
+func memberOf(members map[string]member, endpointID int64, instanceID string) member {
+	if info, ok := members[memberKey(endpointID, instanceID)]; ok {
+		return info
+	}
+	return member{tunnel: instanceID, endpoint: strconv.FormatInt(endpointID, 10)}
+}
+
+// filter 编译后的过滤条件
+type filter struct {
+	key    string
+	negate bool
+	value  string
+	re     *regexp.Regexp
+}
+
+func compileFilters(adhoc []AdhocFilter) ([]filter, error) {
+	filters := make([]filter, 0, len(adhoc))
+	for _, f := range adhoc {
+		if f.Key != "tunnel" && f.Key != "endpoint" && f.Key != "group" {
+			return nil, fmt.Errorf("%w: 未知的过滤键 %s", ErrInvalidQuery, f.Key)
+		}
+		compiled := filter{key: f.Key, value: f.Value}
+		switch f.Operator {
+		case "=", "":
+		case "!=":
+			compiled.negate = true
+		case "=~", "!~":
+			re, err := regexp.Compile("^(?:" + f.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+			}
+			compiled.re = re
+			compiled.negate = f.Operator == "!~"
+		default:
+			return nil, fmt.Errorf("%w: 不支持的运算符 %s", ErrInvalidQuery, f.Operator)
+		}
+		filters = append(filters, compiled)
+	}
+	return filters, nil
+}
+
+// matchFilters 判断实例是否满足全部过滤条件，分组按任一所属分组匹配
+func matchFilters(info member, filters []filter) bool {
+	for _, f := range filters {
+		var values []string
+		switch f.key {
+		case "tunnel":
+			values = []string{info.tunnel}
+		case "endpoint":
+			values = []string{info.endpoint}
+		case "group":
+			values = info.groups
+		}
+		matched := false
+		for _, v := range values {
+			if (f.re != nil && f.re.MatchString(v)) || (f.re == nil && v == f.value) {
+				matched = true
+				break
+			}
+		}
+		if matched == f.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Annotations 返回时间范围内的隧道操作日志与主控状态变化
+func (s *Service) Annotations(req AnnotationRequest) ([]Annotation, error) {
+	if !req.Range.To.After(req.Range.From) {
+		return nil, fmt.Errorf("%w: 时间范围不合法", ErrInvalidQuery)
+	}
+	kind, name, _ := strings.Cut(strings.TrimSpace(req.Annotation.Query), ":")
+	if kind != "" && kind != "tunnel" && kind != "endpoint" {
+		return nil, fmt.Errorf("%w: 未知的注释类型 %s", ErrInvalidQuery, kind)
+	}
+	from, to := req.Range.From.In(time.Local), req.Range.To.In(time.Local)
+
+	annotations := []Annotation{}
+	if kind == "" || kind == "tunnel" {
+		query := s.db.Where("created_at >= ? AND created_at <= ?", from, to)
+		if name != "" {
+			query = query.Where("tunnel_name = ?", name)
+		}
+		var logs []models.TunnelOperationLog
+		if err := query.Order("created_at DESC").Limit(annotationLimit).Find(&logs).Error; err != nil {
+			return nil, err
+		}
+		for _, l := range logs {
+			text := l.Status
+			if l.Message != nil && *l.Message != "" {
+				text = *l.Message
+			}
+			annotations = append(annotations, Annotation{
+				Annotation: req.Annotation,
+				Time:       l.CreatedAt.UnixMilli(),
+				Title:      fmt.Sprintf("隧道 %s %s", l.TunnelName, l.Action),
+				Text:       text,
+				Tags:       []string{"tunnel", l.TunnelName, string(l.Action), l.Status},
+			})
+		}
+	}
+
+	if kind == "" || kind == "endpoint" {
+		endpoints, err := s.endpointNames()
+		if err != nil {
+			return nil, err
+		}
+		query := s.db.Where("created_at >= ? AND created_at <= ?", from, to)
+		if name != "" {
+			ids := []int64{}
+			for id, n := range endpoints {
+				if n == name {
+					ids = append(ids, id)
+				}
+			}
+			query = query.Where("endpoint_id IN ?", ids)
+		}
+		var events []models.EndpointStatusEvent
+		if err := query.Order("created_at DESC").Limit(annotationLimit).Find(&events).Error; err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			endpointName, ok := endpoints[e.EndpointID]
+			if !ok {
+				endpointName = strconv.FormatInt(e.EndpointID, 10)
+			}
+			annotations = append(annotations, Annotation{
+				Annotation: req.Annotation,
+				Time:       e.CreatedAt.UnixMilli(),
+				Title:      fmt.Sprintf("主控 %s %s", endpointName, e.Status),
+				Text:       fmt.Sprintf("主控 %s 状态变为 %s", endpointName, e.Status),
+				Tags:       []string{"endpoint", endpointName, string(e.Status)},
+			})
+		}
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool { return annotations[i].Time < annotations[j].Time })
+	return annotations, nil
+}
@@ -0,0 +1,147 @@
+package grafana
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQueryAndAnnotations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.Group{}, &models.TunnelGroup{},
+		&models.ServiceHistory{}, &models.TunnelOperationLog{}, &models.EndpointStatusEvent{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	web, ssh := "a", "b"
+	db.Create(&models.Endpoint{ID: 1, Name: "hk", URL: "http://hk", APIPath: "/api", APIKey: "k"})
+	db.Create(&models.Tunnel{ID: 1, Name: "web", EndpointID: 1, InstanceID: &web})
+	db.Create(&models.Tunnel{ID: 2, Name: "ssh", EndpointID: 1, InstanceID: &ssh})
+	db.Create(&models.Group{ID: 1, Name: "prod"})
+	db.Create(&models.TunnelGroup{TunnelID: 1, GroupID: 1})
+
+	// 每分钟一条记录，共 10 分钟；流量为累计值，web 每分钟增长 100，第 8 分钟实例重启计数器归零
+	start := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: web, RecordTime: start.Add(-time.Minute), AvgPing: 99, DeltaTCPIn: 1000})
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		counter := int64(1100 + 100*i)
+		if i >= 7 {
+			counter = int64(100 * (i - 6))
+		}
+		db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: web, RecordTime: at, AvgPing: float64(10 + i), DeltaTCPIn: counter})
+		db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: ssh, RecordTime: at, AvgPing: 50, DeltaTCPIn: int64(i + 1)})
+	}
+
+	s := NewService(db)
+	r := Range{From: start, To: start.Add(time.Hour)}
+	series, err := s.Query(QueryRequest{
+		Range:        r,
+		IntervalMs:   (5 * time.Minute).Milliseconds(),
+		Targets:      []Target{{Target: "tunnel.ping", RefID: "A"}, {Target: "tunnel.traffic", RefID: "B"}},
+		AdhocFilters: []AdhocFilter{{Key: "group", Operator: "=", Value: "prod"}},
+	})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(series) != 2 || series[0].Target != "web" || series[0].RefID != "A" {
+		t.Fatalf("series = %+v", series)
+	}
+	ping, traffic := series[0].Datapoints, series[1].Datapoints
+	if len(ping) != 2 || ping[0][0] != 12 || ping[1][0] != 17 || ping[0][1] != float64(start.UnixMilli()) {
+		t.Errorf("ping datapoints = %v", ping)
+	}
+	if len(traffic) != 2 || traffic[0][0] != 500 || traffic[1][0] != 500 {
+		t.Errorf("traffic datapoints = %v", traffic)
+	}
+
+	series, err = s.Query(QueryRequest{Range: r, Targets: []Target{{Target: "tunnel.ping"}},
+		AdhocFilters: []AdhocFilter{{Key: "tunnel", Operator: "!=", Value: "web"}}})
+	if err != nil || len(series) != 1 || series[0].Target != "ssh" {
+		t.Errorf("negated filter = %+v, %v", series, err)
+	}
+	if _, err := s.Query(QueryRequest{Range: r, Targets: []Target{{Target: "unknown"}}}); err == nil {
+		t.Error("expected unknown target to be rejected")
+	}
+
+	tunnelID := int64(1)
+	db.Create(&models.TunnelOperationLog{TunnelID: &tunnelID, TunnelName: "web", Action: models.OperationActionRestart, Status: "success", CreatedAt: start.Add(time.Minute)})
+	db.Create(&models.EndpointStatusEvent{EndpointID: 1, Status: models.EndpointStatusOffline, CreatedAt: start.Add(2 * time.Minute)})
+
+	all, err := s.Annotations(AnnotationRequest{Range: r})
+	if err != nil {
+		t.Fatalf("Annotations: %v", err)
+	}
+	if len(all) != 2 || all[0].Tags[0] != "tunnel" || all[1].Tags[1] != "hk" {
+		t.Errorf("annotations = %+v", all)
+	}
+	endpoints, err := s.Annotations(AnnotationRequest{Range: r, Annotation: AnnotationQuery{Query: "endpoint:hk"}})
+	if err != nil || len(endpoints) != 1 || endpoints[0].Time != start.Add(2*time.Minute).UnixMilli() {
+		t.Errorf("endpoint annotations = %+v, %v", endpoints, err)
+	}
+}
+
+func TestBucketStartFollowsLocalZone(t *testing.T) {
+	// +05:30 时区的小时与日分桶应落在本地整点与零点，而不是 UTC 整点
+	local := time.Local
+	time.Local = time.FixedZone("IST", 5*3600+30*60)
+	defer func() { time.Local = local }()
+
+	at := time.Date(2024, 1, 1, 10, 47, 30, 0, time.Local)
+	for interval, want := range map[time.Duration]time.Time{
+		5 * time.Minute: time.Date(2024, 1, 1, 10, 45, 0, 0, time.Local),
+		time.Hour:       time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local),
+		3 * time.Hour:   time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local),
+		24 * time.Hour:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+	} {
+		if got := bucketStart(at, interval); !got.Equal(want) {
+			t.Errorf("bucketStart(%v) = %v, want %v", interval, got, want)
+		}
+	}
+	if week := bucketStart(at, 7*24*time.Hour); week.Hour() != 0 || week.Minute() != 0 || week.After(at) || at.Sub(week) >= 7*24*time.Hour {
+		t.Errorf("weekly bucket = %v", week)
+	}
+}
+
+func TestBucketAggregationPerSource(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.Group{}, &models.TunnelGroup{},
+		&models.TrafficHourlySummary{}, &models.DashboardTrafficSummary{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	web := "a"
+	db.Create(&models.Endpoint{ID: 1, Name: "hk", URL: "http://hk", APIPath: "/api", APIKey: "k"})
+	db.Create(&models.Tunnel{ID: 1, Name: "web", EndpointID: 1, InstanceID: &web})
+
+	// 三个整点：每小时增量 100、200、300；主控汇总为整点累计快照 1000、1200、1500
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for i, total := range []int64{1000, 1200, 1500} {
+		at := start.Add(time.Duration(i) * time.Hour)
+		db.Create(&models.TrafficHourlySummary{HourTime: at, EndpointID: 1, InstanceID: web, TCPRxIncrement: int64(100 * (i + 1))})
+		db.Create(&models.DashboardTrafficSummary{HourTime: at, TCPRxTotal: total, InstanceCount: 1})
+	}
+
+	series, err := NewService(db).Query(QueryRequest{
+		Range:      Range{From: start, To: start.Add(3 * time.Hour)},
+		IntervalMs: (3 * time.Hour).Milliseconds(),
+		Targets:    []Target{{Target: "tunnel.hourly_rx"}, {Target: "dashboard.tcp_rx_total"}},
+	})
+	if err != nil || len(series) != 2 {
+		t.Fatalf("Query = %+v, %v", series, err)
+	}
+	// 增量按桶累加，累计快照取桶内最后一个值
+	if dp := series[0].Datapoints; len(dp) != 1 || dp[0][0] != 600 {
+		t.Errorf("hourly datapoints = %v, want sum 600", dp)
+	}
+	if dp := series[1].Datapoints; len(dp) != 1 || dp[0][0] != 1500 {
+		t.Errorf("dashboard datapoints = %v, want last 1500", dp)
+	}
+}
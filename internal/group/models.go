@@ -8,9 +8,11 @@ import (
 type Group struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
+	ParentID  *int64    `json:"parentId"` // 父分组ID，顶级分组为 null
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	TunnelIDs []int64   `json:"tunnelIds,omitempty"` // 绑定的隧道ID列表
+	Children  []*Group  `json:"children,omitempty"`  // 子分组，仅分组树接口返回
 }
 
 // TunnelGroup 隧道分组关联模型
@@ -23,19 +25,22 @@ type TunnelGroup struct {
 
 // CreateGroupRequest 创建分组请求
 type CreateGroupRequest struct {
-	Name string `json:"name" validate:"required"`
+	Name     string `json:"name" validate:"required"`
+	ParentID *int64 `json:"parentId,omitempty"` // 父分组ID，为空表示顶级分组
 }
 
 // UpdateGroupRequest 更新分组请求
 type UpdateGroupRequest struct {
-	ID   int64  `json:"id" validate:"required"`
-	Name string `json:"name,omitempty"`
+	ID       int64  `json:"id" validate:"required"`
+	Name     string `json:"name,omitempty"`
+	ParentID *int64 `json:"parentId,omitempty"` // 移动到该父分组下，0 表示移动为顶级分组，为空表示不变
 }
 
 // AssignGroupRequest 分配分组请求
 type AssignGroupRequest struct {
-	TunnelId int64 `json:"tunnelId" validate:"required"` // 隧道数据库主键ID
-	GroupID  int64 `json:"groupId,omitempty"`            // 如果为空，则清除分组
+	TunnelId int64   `json:"tunnelId" validate:"required"` // 隧道数据库主键ID
+	GroupID  int64   `json:"groupId,omitempty"`            // 如果为空，则清除分组
+	GroupIDs []int64 `json:"groupIds,omitempty"`           // 同时加入多个分组，非空时优先于 GroupID
 }
 
 // BatchAssignTunnelsRequest 批量分配隧道到分组请求
@@ -51,3 +56,61 @@ type GroupResponse struct {
 	Group   interface{} `json:"group,omitempty"`
 	Groups  interface{} `json:"groups,omitempty"`
 }
+
+// GroupActionRequest 分组批量操作请求
+type GroupActionRequest struct {
+	Action      string `json:"action" binding:"required"` // start / stop / restart
+	Recursive   *bool  `json:"recursive,omitempty"`       // 是否包含子分组，默认 true
+	Concurrency int    `json:"concurrency,omitempty"`     // 并发数，默认 5，最大 20
+}
+
+// GroupActionItem 单个隧道的操作结果
+type GroupActionItem struct {
+	TunnelID   int64  `json:"tunnelId"`
+	Name       string `json:"name"`
+	EndpointID int64  `json:"endpointId"`
+	InstanceID string `json:"instanceId"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
+
+// GroupActionResult 分组批量操作结果
+type GroupActionResult struct {
+	Action       string            `json:"action"`
+	Total        int               `json:"total"`
+	SuccessCount int               `json:"successCount"`
+	FailCount    int               `json:"failCount"`
+	Items        []GroupActionItem `json:"items"`
+}
+
+// GroupStats 分组统计，包含全部子分组中的隧道（同一隧道只计一次）
+type GroupStats struct {
+	GroupID      int64          `json:"groupId"`
+	Name         string         `json:"name"`
+	ParentID     *int64         `json:"parentId"`
+	TunnelCount  int            `json:"tunnelCount"`
+	StatusCounts map[string]int `json:"statusCounts"` // 隧道状态 -> 数量
+	TotalRx      int64          `json:"totalRx"`      // 隧道累计入站流量（TCP+UDP）
+	TotalTx      int64          `json:"totalTx"`      // 隧道累计出站流量（TCP+UDP）
+}
+
+// GroupTrendPoint 分组流量趋势中的单个小时数据点
+type GroupTrendPoint struct {
+	Timestamp int64 `json:"timestamp"` // 小时起始时间（毫秒）
+	Rx        int64 `json:"rx"`
+	Tx        int64 `json:"tx"`
+}
+
+// GroupDashboard 单个分组的仪表盘数据
+type GroupDashboard struct {
+	GroupStats
+	Children []GroupStats      `json:"children"` // 直接子分组的统计
+	Traffic  GroupTrendTotals  `json:"traffic24h"`
+	Trend    []GroupTrendPoint `json:"trend"` // 最近 24 小时按小时汇总
+}
+
+// GroupTrendTotals 分组在趋势区间内的流量合计
+type GroupTrendTotals struct {
+	Rx int64 `json:"rx"`
+	Tx int64 `json:"tx"`
+}
@@ -33,9 +33,18 @@ func (s *Service) CreateGroup(req *CreateGroupRequest) (*Group, error) {
 		return nil, err
 	}
 
+	if req.ParentID != nil && *req.ParentID > 0 {
+		if _, err := s.GetGroupByID(*req.ParentID); err != nil {
+			return nil, errors.New("父分组不存在")
+		}
+	} else {
+		req.ParentID = nil
+	}
+
 	// 创建分组
 	group := models.Group{
 		Name:      req.Name,
+		ParentID:  req.ParentID,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -48,6 +57,7 @@ func (s *Service) CreateGroup(req *CreateGroupRequest) (*Group, error) {
 	return &Group{
 		ID:        group.ID,
 		Name:      group.Name,
+		ParentID:  group.ParentID,
 		CreatedAt: group.CreatedAt,
 		UpdatedAt: group.UpdatedAt,
 	}, nil
@@ -73,6 +83,7 @@ func (s *Service) GetGroups() ([]*Group, error) {
 		groups = append(groups, &Group{
 			ID:        modelGroup.ID,
 			Name:      modelGroup.Name,
+			ParentID:  modelGroup.ParentID,
 			CreatedAt: modelGroup.CreatedAt,
 			UpdatedAt: modelGroup.UpdatedAt,
 			TunnelIDs: tunnelIDs,
@@ -96,6 +107,7 @@ func (s *Service) GetGroupByID(id int64) (*Group, error) {
 	return &Group{
 		ID:        modelGroup.ID,
 		Name:      modelGroup.Name,
+		ParentID:  modelGroup.ParentID,
 		CreatedAt: modelGroup.CreatedAt,
 		UpdatedAt: modelGroup.UpdatedAt,
 	}, nil
@@ -135,6 +147,28 @@ func (s *Service) UpdateGroup(req *UpdateGroupRequest) (*Group, error) {
 		"name":       name,
 		"updated_at": time.Now(),
 	}
+
+	// 移动分组：不能移动到自身或其子分组下
+	parentID := existingGroup.ParentID
+	if req.ParentID != nil {
+		parentID = nil
+		if *req.ParentID > 0 {
+			groups, err := s.loadGroups()
+			if err != nil {
+				return nil, err
+			}
+			if !groupExists(groups, *req.ParentID) {
+				return nil, errors.New("父分组不存在")
+			}
+			for _, id := range subtreeIDs(groups, req.ID) {
+				if id == *req.ParentID {
+					return nil, errors.New("不能将分组移动到自身或其子分组下")
+				}
+			}
+			parentID = req.ParentID
+		}
+		updateData["parent_id"] = parentID
+	}
 	err = s.db.Model(&models.Group{}).Where("id = ?", req.ID).Updates(updateData).Error
 	if err != nil {
 		return nil, err
@@ -143,21 +177,27 @@ func (s *Service) UpdateGroup(req *UpdateGroupRequest) (*Group, error) {
 	return &Group{
 		ID:        req.ID,
 		Name:      name,
+		ParentID:  parentID,
 		CreatedAt: existingGroup.CreatedAt,
 		UpdatedAt: time.Now(),
 	}, nil
 }
 
-// DeleteGroup 删除分组
+// DeleteGroup 删除分组，子分组上移到被删除分组的父分组下
 func (s *Service) DeleteGroup(id int64) error {
 	// 检查分组是否存在
-	_, err := s.GetGroupByID(id)
+	existingGroup, err := s.GetGroupByID(id)
 	if err != nil {
 		return err
 	}
 
 	// 使用事务删除分组和相关联的隧道分组记录
 	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Group{}).Where("parent_id = ?", id).
+			Update("parent_id", existingGroup.ParentID).Error; err != nil {
+			return err
+		}
+
 		// 先删除关联的隧道分组记录
 		if err := tx.Where("group_id = ?", id).Delete(&models.TunnelGroup{}).Error; err != nil {
 			return err
@@ -184,55 +224,81 @@ func (s *Service) AssignGroupToTunnel(req *AssignGroupRequest) error {
 			return err
 		}
 
-		// 如果GroupID为0，表示清除分组，只删除不插入
-		if req.GroupID <= 0 {
-			return nil
+		groupIDs := req.GroupIDs
+		if len(groupIDs) == 0 && req.GroupID > 0 {
+			groupIDs = []int64{req.GroupID}
 		}
 
-		// 验证分组是否存在
-		var group models.Group
-		err := tx.Where("id = ?", req.GroupID).First(&group).Error
-		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				return errors.New("指定的分组不存在")
+		// 没有分组表示清除分组，只删除不插入
+		seen := make(map[int64]bool, len(groupIDs))
+		for _, groupID := range groupIDs {
+			if groupID <= 0 || seen[groupID] {
+				continue
+			}
+			seen[groupID] = true
+
+			// 验证分组是否存在
+			var group models.Group
+			err := tx.Where("id = ?", groupID).First(&group).Error
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("指定的分组不存在")
+				}
+				return err
 			}
-			return err
-		}
 
-		// 添加新的分组关联
-		tunnelGroup := models.TunnelGroup{
-			TunnelID:  req.TunnelId,
-			GroupID:   req.GroupID,
-			CreatedAt: time.Now(),
+			// 添加新的分组关联
+			tunnelGroup := models.TunnelGroup{
+				TunnelID:  req.TunnelId,
+				GroupID:   groupID,
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Create(&tunnelGroup).Error; err != nil {
+				return err
+			}
 		}
-		return tx.Create(&tunnelGroup).Error
+		return nil
 	})
 }
 
-// GetTunnelGroup 获取隧道的分组
+// GetTunnelGroup 获取隧道的分组（隧道属于多个分组时返回最早加入的一个）
 func (s *Service) GetTunnelGroup(tunnelID int64) (*Group, error) {
+	groups, err := s.GetTunnelGroups(tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, errors.New("该隧道没有分配分组")
+	}
+	return groups[0], nil
+}
+
+// GetTunnelGroups 获取隧道所属的全部分组
+func (s *Service) GetTunnelGroups(tunnelID int64) ([]*Group, error) {
 	// 只读 Groups 表上的字段，不需要嵌入 TunnelGroup(会导致 json tag 冲突,且本就没用到)。
-	var result models.Group
+	var results []models.Group
 
-	err := s.db.Table("Groups g").
-		Select("g.id, g.name, g.created_at, g.updated_at").
-		Joins("JOIN TunnelGroups tg ON g.id = tg.group_id").
+	err := s.db.Table("groups g").
+		Select("g.id, g.name, g.parent_id, g.created_at, g.updated_at").
+		Joins("JOIN tunnel_groups tg ON g.id = tg.group_id").
 		Where("tg.tunnel_id = ?", tunnelID).
-		First(&result).Error
-
+		Order("tg.id").
+		Find(&results).Error
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("该隧道没有分配分组")
-		}
 		return nil, err
 	}
 
-	return &Group{
-		ID:        result.ID,
-		Name:      result.Name,
-		CreatedAt: result.CreatedAt,
-		UpdatedAt: result.UpdatedAt,
-	}, nil
+	groups := make([]*Group, 0, len(results))
+	for _, result := range results {
+		groups = append(groups, &Group{
+			ID:        result.ID,
+			Name:      result.Name,
+			ParentID:  result.ParentID,
+			CreatedAt: result.CreatedAt,
+			UpdatedAt: result.UpdatedAt,
+		})
+	}
+	return groups, nil
 }
 
 // GetTunnelsByGroup 根据分组获取隧道列表
@@ -251,14 +317,14 @@ func (s *Service) GetTunnelsByGroup(groupID int64) ([]int64, error) {
 	return tunnelIDs, nil
 }
 
-// GetGroupStats 获取分组统计信息
+// GetGroupStats 获取分组直接绑定的隧道数量
 func (s *Service) GetGroupStats() (map[int64]int, error) {
 	var results []struct {
 		GroupID int64 `json:"group_id"`
 		Count   int   `json:"count"`
 	}
 
-	err := s.db.Table("TunnelGroups").
+	err := s.db.Model(&models.TunnelGroup{}).
 		Select("group_id, COUNT(*) as count").
 		Group("group_id").
 		Find(&results).Error
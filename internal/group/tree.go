@@ -0,0 +1,331 @@
+package group
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+)
+
+const (
+	defaultActionConcurrency = 5
+	maxActionConcurrency     = 20
+)
+
+// loadGroups 读取全部分组
+func (s *Service) loadGroups() ([]models.Group, error) {
+	var groups []models.Group
+	if err := s.db.Order("name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func groupExists(groups []models.Group, id int64) bool {
+	for _, g := range groups {
+		if g.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// subtreeIDs 返回 root 及其全部子孙分组的ID（广度优先，root 在首位）
+func subtreeIDs(groups []models.Group, root int64) []int64 {
+	children := make(map[int64][]int64, len(groups))
+	for _, g := range groups {
+		if g.ParentID != nil {
+			children[*g.ParentID] = append(children[*g.ParentID], g.ID)
+		}
+	}
+
+	ids := []int64{root}
+	visited := map[int64]bool{root: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !visited[child] {
+				visited[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// GetGroupTree 获取分组树，父分组不存在的分组视为顶级分组
+func (s *Service) GetGroupTree() ([]*Group, error) {
+	groups, err := s.GetGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*Group, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+	roots := []*Group{}
+	for _, g := range groups {
+		if g.ParentID != nil {
+			if parent, ok := byID[*g.ParentID]; ok && parent.ID != g.ID {
+				parent.Children = append(parent.Children, g)
+				continue
+			}
+		}
+		roots = append(roots, g)
+	}
+	return roots, nil
+}
+
+// groupTunnels 查询分组（recursive 时包含子分组）中的隧道，同一隧道只返回一次
+func (s *Service) groupTunnels(groupID int64, recursive bool) ([]models.Tunnel, error) {
+	groups, err := s.loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	if !groupExists(groups, groupID) {
+		return nil, errors.New("分组不存在")
+	}
+	groupIDs := []int64{groupID}
+	if recursive {
+		groupIDs = subtreeIDs(groups, groupID)
+	}
+
+	var tunnels []models.Tunnel
+	err = s.db.Where("id IN (?)", s.db.Model(&models.TunnelGroup{}).Select("tunnel_id").Where("group_id IN ?", groupIDs)).
+		Order("id").Find(&tunnels).Error
+	return tunnels, err
+}
+
+// RunGroupAction 对分组内全部隧道执行 start/stop/restart，按并发上限下发
+func (s *Service) RunGroupAction(groupID int64, req *GroupActionRequest) (*GroupActionResult, error) {
+	switch req.Action {
+	case "start", "stop", "restart":
+	default:
+		return nil, errors.New("无效的操作，仅支持 start、stop、restart")
+	}
+	recursive := req.Recursive == nil || *req.Recursive
+
+	tunnels, err := s.groupTunnels(groupID, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultActionConcurrency
+	}
+	if concurrency > maxActionConcurrency {
+		concurrency = maxActionConcurrency
+	}
+
+	result := &GroupActionResult{Action: req.Action, Items: make([]GroupActionItem, 0, len(tunnels))}
+	for _, t := range tunnels {
+		if t.InstanceID == nil || *t.InstanceID == "" {
+			continue
+		}
+		result.Items = append(result.Items, GroupActionItem{TunnelID: t.ID, Name: t.Name, EndpointID: t.EndpointID, InstanceID: *t.InstanceID})
+	}
+	result.Total = len(result.Items)
+
+	log.Infof("[Group] 分组 %d 批量 %s，共 %d 个隧道，并发 %d", groupID, req.Action, result.Total, concurrency)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range result.Items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *GroupActionItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := nodepass.ControlInstance(item.EndpointID, item.InstanceID, req.Action); err != nil {
+				item.Error = err.Error()
+				return
+			}
+			item.Success = true
+		}(&result.Items[i])
+	}
+	wg.Wait()
+
+	for _, item := range result.Items {
+		if item.Success {
+			result.SuccessCount++
+		} else {
+			result.FailCount++
+		}
+	}
+	log.Infof("[Group] 分组 %d 批量 %s 完成：成功 %d，失败 %d", groupID, req.Action, result.SuccessCount, result.FailCount)
+	return result, nil
+}
+
+// groupTunnelStat 统计所需的隧道字段
+type groupTunnelStat struct {
+	Status     string
+	EndpointID int64
+	InstanceID string
+	Rx         int64
+	Tx         int64
+}
+
+// collectStats 汇总 root 子树中的隧道统计
+func collectStats(g models.Group, groups []models.Group, members map[int64][]int64, tunnels map[int64]groupTunnelStat) GroupStats {
+	stats := GroupStats{GroupID: g.ID, Name: g.Name, ParentID: g.ParentID, StatusCounts: map[string]int{}}
+	seen := map[int64]bool{}
+	for _, id := range subtreeIDs(groups, g.ID) {
+		for _, tunnelID := range members[id] {
+			t, ok := tunnels[tunnelID]
+			if !ok || seen[tunnelID] {
+				continue
+			}
+			seen[tunnelID] = true
+			stats.TunnelCount++
+			stats.StatusCounts[t.Status]++
+			stats.TotalRx += t.Rx
+			stats.TotalTx += t.Tx
+		}
+	}
+	return stats
+}
+
+// loadStatsData 读取分组、成员关系与隧道统计字段
+func (s *Service) loadStatsData() ([]models.Group, map[int64][]int64, map[int64]groupTunnelStat, error) {
+	groups, err := s.loadGroups()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var links []models.TunnelGroup
+	if err := s.db.Select("tunnel_id", "group_id").Find(&links).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	members := map[int64][]int64{}
+	for _, link := range links {
+		members[link.GroupID] = append(members[link.GroupID], link.TunnelID)
+	}
+
+	var rows []struct {
+		ID         int64
+		Status     string
+		EndpointID int64
+		InstanceID *string
+		Rx         int64
+		Tx         int64
+	}
+	if err := s.db.Model(&models.Tunnel{}).
+		Select("id, status, endpoint_id, instance_id, tcp_rx + udp_rx AS rx, tcp_tx + udp_tx AS tx").
+		Where("id IN (?)", s.db.Model(&models.TunnelGroup{}).Select("tunnel_id")).
+		Scan(&rows).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	tunnels := make(map[int64]groupTunnelStat, len(rows))
+	for _, r := range rows {
+		stat := groupTunnelStat{Status: r.Status, EndpointID: r.EndpointID, Rx: r.Rx, Tx: r.Tx}
+		if r.InstanceID != nil {
+			stat.InstanceID = *r.InstanceID
+		}
+		tunnels[r.ID] = stat
+	}
+	return groups, members, tunnels, nil
+}
+
+// GetAllGroupStats 获取全部分组的统计（包含子分组）
+func (s *Service) GetAllGroupStats() ([]GroupStats, error) {
+	groups, members, tunnels, err := s.loadStatsData()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]GroupStats, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, collectStats(g, groups, members, tunnels))
+	}
+	return result, nil
+}
+
+// GetGroupDashboard 获取单个分组的仪表盘：状态分布、累计流量、子分组统计与最近 24 小时流量趋势
+func (s *Service) GetGroupDashboard(groupID int64) (*GroupDashboard, error) {
+	groups, members, tunnels, err := s.loadStatsData()
+	if err != nil {
+		return nil, err
+	}
+
+	var root *models.Group
+	for i := range groups {
+		if groups[i].ID == groupID {
+			root = &groups[i]
+		}
+	}
+	if root == nil {
+		return nil, errors.New("分组不存在")
+	}
+
+	dashboard := &GroupDashboard{
+		GroupStats: collectStats(*root, groups, members, tunnels),
+		Children:   []GroupStats{},
+		Trend:      []GroupTrendPoint{},
+	}
+	for _, g := range groups {
+		if g.ParentID != nil && *g.ParentID == groupID {
+			dashboard.Children = append(dashboard.Children, collectStats(g, groups, members, tunnels))
+		}
+	}
+
+	// 实例 ID 仅在主控内唯一，按 endpoint_id:instance_id 匹配成员
+	instanceIDs := []string{}
+	keys := map[string]bool{}
+	for _, id := range subtreeIDs(groups, groupID) {
+		for _, tunnelID := range members[id] {
+			if t, ok := tunnels[tunnelID]; ok && t.InstanceID != "" {
+				key := fmt.Sprintf("%d:%s", t.EndpointID, t.InstanceID)
+				if !keys[key] {
+					keys[key] = true
+					instanceIDs = append(instanceIDs, t.InstanceID)
+				}
+			}
+		}
+	}
+	if len(instanceIDs) == 0 {
+		return dashboard, nil
+	}
+
+	// 使用小时汇总表中的增量，service_history 中的流量为累计值不能直接求和
+	var rows []struct {
+		EndpointID int64
+		InstanceID string
+		HourTime   time.Time
+		Rx         int64
+		Tx         int64
+	}
+	if err := s.db.Raw(`SELECT endpoint_id, instance_id, hour_time,
+			tcp_rx_increment + udp_rx_increment AS rx,
+			tcp_tx_increment + udp_tx_increment AS tx
+		FROM traffic_hourly_summary
+		WHERE instance_id IN ? AND hour_time >= ?`, instanceIDs, time.Now().Add(-24*time.Hour).In(time.Local)).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询分组流量趋势失败: %w", err)
+	}
+
+	buckets := map[int64]*GroupTrendPoint{}
+	for _, r := range rows {
+		if !keys[fmt.Sprintf("%d:%s", r.EndpointID, r.InstanceID)] {
+			continue
+		}
+		hour := r.HourTime.UnixMilli()
+		p, ok := buckets[hour]
+		if !ok {
+			p = &GroupTrendPoint{Timestamp: hour}
+			buckets[hour] = p
+		}
+		p.Rx += r.Rx
+		p.Tx += r.Tx
+		dashboard.Traffic.Rx += r.Rx
+		dashboard.Traffic.Tx += r.Tx
+	}
+	for _, p := range buckets {
+		dashboard.Trend = append(dashboard.Trend, *p)
+	}
+	sort.Slice(dashboard.Trend, func(i, j int) bool { return dashboard.Trend[i].Timestamp < dashboard.Trend[j].Timestamp })
+	return dashboard, nil
+}
@@ -0,0 +1,91 @@
+package group
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHierarchicalGroups(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.Tunnel{}, &models.TunnelGroup{}, &models.TrafficHourlySummary{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	s := NewService(db)
+
+	root, _ := s.CreateGroup(&CreateGroupRequest{Name: "prod"})
+	child, _ := s.CreateGroup(&CreateGroupRequest{Name: "prod-eu", ParentID: &root.ID})
+	leaf, err := s.CreateGroup(&CreateGroupRequest{Name: "prod-eu-db", ParentID: &child.ID})
+	if err != nil {
+		t.Fatalf("create leaf: %v", err)
+	}
+
+	// 不能移动到自身子树下
+	if _, err := s.UpdateGroup(&UpdateGroupRequest{ID: root.ID, ParentID: &leaf.ID}); err == nil {
+		t.Error("expected cycle to be rejected")
+	}
+
+	instance1, instance2 := "i1", "i2"
+	t1 := models.Tunnel{Name: "a", EndpointID: 1, InstanceID: &instance1, Status: models.TunnelStatusRunning, TCPRx: 10, UDPTx: 5}
+	t2 := models.Tunnel{Name: "b", EndpointID: 1, InstanceID: &instance2, Status: models.TunnelStatusStopped, TCPRx: 1}
+	for _, tn := range []*models.Tunnel{&t1, &t2} {
+		if err := db.Create(tn).Error; err != nil {
+			t.Fatalf("seed tunnel: %v", err)
+		}
+	}
+	// t1 同时属于 child 与 leaf，递归统计中只计一次
+	if err := s.AssignGroupToTunnel(&AssignGroupRequest{TunnelId: t1.ID, GroupIDs: []int64{child.ID, leaf.ID}}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if err := s.AssignGroupToTunnel(&AssignGroupRequest{TunnelId: t2.ID, GroupID: leaf.ID}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if groups, _ := s.GetTunnelGroups(t1.ID); len(groups) != 2 {
+		t.Errorf("tunnel groups = %d, want 2", len(groups))
+	}
+
+	// 小时增量：另一主控上的同名实例不属于该分组
+	hour := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for _, h := range []models.TrafficHourlySummary{
+		{HourTime: hour, EndpointID: 1, InstanceID: instance1, TCPRxIncrement: 100, UDPTxIncrement: 7},
+		{HourTime: hour, EndpointID: 1, InstanceID: instance2, UDPRxIncrement: 20},
+		{HourTime: hour, EndpointID: 2, InstanceID: instance1, TCPRxIncrement: 5000},
+	} {
+		if err := db.Create(&h).Error; err != nil {
+			t.Fatalf("seed hourly: %v", err)
+		}
+	}
+
+	dashboard, err := s.GetGroupDashboard(root.ID)
+	if err != nil {
+		t.Fatalf("dashboard: %v", err)
+	}
+	if dashboard.TunnelCount != 2 || dashboard.StatusCounts["running"] != 1 || dashboard.StatusCounts["stopped"] != 1 ||
+		dashboard.TotalRx != 11 || dashboard.TotalTx != 5 {
+		t.Errorf("root stats = %+v", dashboard.GroupStats)
+	}
+	if len(dashboard.Children) != 1 || dashboard.Children[0].TunnelCount != 2 {
+		t.Errorf("children = %+v", dashboard.Children)
+	}
+	if dashboard.Traffic.Rx != 120 || dashboard.Traffic.Tx != 7 || len(dashboard.Trend) != 1 || dashboard.Trend[0].Timestamp != hour.UnixMilli() {
+		t.Errorf("traffic = %+v trend = %+v", dashboard.Traffic, dashboard.Trend)
+	}
+
+	// 删除中间分组后子分组上移
+	if err := s.DeleteGroup(child.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	tree, err := s.GetGroupTree()
+	if err != nil {
+		t.Fatalf("tree: %v", err)
+	}
+	if len(tree) != 1 || len(tree[0].Children) != 1 || tree[0].Children[0].ID != leaf.ID {
+		t.Errorf("tree after delete = %+v", tree)
+	}
+}
@@ -0,0 +1,620 @@
+package healing
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+
+	"gorm.io/gorm"
+)
+
+// 未配置任何策略字段时使用的默认值
+const (
+	defaultMaxAttempts    = 5
+	defaultBaseBackoffSec = 10
+	defaultMaxBackoffSec  = 600
+	defaultCooldownSec    = 3600
+)
+
+// EventNotifier 自愈事件推送回调（通常接到 SSE 隧道订阅推送）
+type EventNotifier func(instanceID string, data interface{})
+
+// Event 推送给前端的自愈事件
+type Event struct {
+	Type          string                  `json:"type"` // 固定为 healing
+	TunnelID      int64                   `json:"tunnelId"`
+	EndpointID    int64                   `json:"endpointId"`
+	InstanceID    string                  `json:"instanceId"`
+	State         models.HealingStateType `json:"state"`
+	Attempt       int                     `json:"attempt"`
+	MaxAttempts   int                     `json:"maxAttempts"`
+	NextAttemptAt *time.Time              `json:"nextAttemptAt,omitempty"`
+	Message       string                  `json:"message,omitempty"`
+	Time          time.Time               `json:"time"`
+}
+
+// statusQueueSize 待处理隧道状态事件的缓冲大小
+const statusQueueSize = 1024
+
+// statusEvent 待处理的隧道状态变化
+type statusEvent struct {
+	endpointID int64
+	instanceID string
+	prev, curr models.TunnelStatus
+}
+
+// Service 隧道自愈服务
+// 监听 SSE 推送的隧道状态，对 error / offline 隧道按退避策略下发 restart
+type Service struct {
+	db       *gorm.DB
+	mu       sync.Mutex
+	timers   map[int64]*time.Timer // tunnelID -> 待执行的重启计时器
+	inflight map[int64]bool        // tunnelID -> 正在执行的重启
+	notifier EventNotifier
+	closed   bool
+
+	// 状态事件由自愈协程处理，避免在 SSE 分发路径上查询数据库
+	events chan statusEvent
+	stopCh chan struct{}
+	done   chan struct{}
+
+	// control 下发实例控制指令，默认走 NodePass API
+	control func(endpointID int64, instanceID, action string) error
+}
+
+// NewService 创建自愈服务
+func NewService(db *gorm.DB) *Service {
+	s := &Service{
+		db:       db,
+		timers:   make(map[int64]*time.Timer),
+		inflight: make(map[int64]bool),
+		events:   make(chan statusEvent, statusQueueSize),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+		control: func(endpointID int64, instanceID, action string) error {
+			_, err := nodepass.ControlInstance(endpointID, instanceID, action)
+			return err
+		},
+	}
+	go s.loop()
+	return s
+}
+
+// loop 依次处理隧道状态事件
+func (s *Service) loop() {
+	defer close(s.done)
+	for {
+		select {
+		case e := <-s.events:
+			s.handleStatus(e.endpointID, e.instanceID, e.prev, e.curr)
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// SetNotifier 设置事件推送回调
+func (s *Service) SetNotifier(notifier EventNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// Close 停止所有待执行的自愈计时器
+func (s *Service) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for id, t := range s.timers {
+		t.Stop()
+		delete(s.timers, id)
+	}
+	s.mu.Unlock()
+
+	close(s.stopCh)
+	<-s.done
+	log.Info("隧道自愈服务已关闭")
+}
+
+// OnTunnelStatus 接收隧道状态（由 SSE 服务在 initial/update 事件后调用），交给自愈协程处理
+// 队列已满时丢弃：异常状态会随后续事件再次上报
+func (s *Service) OnTunnelStatus(endpointID int64, instanceID string, prev, curr models.TunnelStatus) {
+	switch curr {
+	case models.TunnelStatusRunning, models.TunnelStatusError, models.TunnelStatusOffline:
+	default:
+		return
+	}
+	select {
+	case s.events <- statusEvent{endpointID: endpointID, instanceID: instanceID, prev: prev, curr: curr}:
+	default:
+		log.Warnf("[Healing]状态事件队列已满，丢弃隧道 %s 的 %s 事件", instanceID, curr)
+	}
+}
+
+// handleStatus 处理单个隧道状态事件
+func (s *Service) handleStatus(endpointID int64, instanceID string, prev, curr models.TunnelStatus) {
+	switch curr {
+	case models.TunnelStatusRunning:
+		if prev != curr {
+			s.markRecovered(endpointID, instanceID)
+		}
+	case models.TunnelStatusError, models.TunnelStatusOffline:
+		s.onUnhealthy(endpointID, instanceID, curr)
+	}
+}
+
+// onUnhealthy 隧道处于异常状态时安排下一次重启
+func (s *Service) onUnhealthy(endpointID int64, instanceID string, status models.TunnelStatus) {
+	tunnel, err := s.findTunnel(endpointID, instanceID)
+	if err != nil || tunnel == nil {
+		return
+	}
+
+	s.mu.Lock()
+	_, pending := s.timers[tunnel.ID]
+	pending = pending || s.inflight[tunnel.ID]
+	closed := s.closed
+	s.mu.Unlock()
+	if pending || closed {
+		return
+	}
+
+	policy, err := s.EffectivePolicy(tunnel.ID)
+	if err != nil || policy == nil || !policy.Enabled {
+		return
+	}
+	if status == models.TunnelStatusOffline && (!policy.HealOffline || !s.endpointOnline(endpointID)) {
+		return
+	}
+
+	state, err := s.loadState(tunnel)
+	if err != nil {
+		log.Errorf("[Healing]读取隧道 %d 自愈状态失败: %v", tunnel.ID, err)
+		return
+	}
+
+	now := time.Now()
+	// 冷却窗口过期后重新计数
+	if !state.WindowStart.Valid || now.Sub(state.WindowStart.Time) > time.Duration(policy.CooldownSec)*time.Second {
+		state.Attempts = 0
+		state.WindowStart = models.NullTime{Time: now, Valid: true}
+		state.GaveUpAt = models.NullTime{}
+		if state.State == models.HealingStateGaveUp {
+			state.State = models.HealingStateIdle
+		}
+	}
+	if state.State == models.HealingStateGaveUp {
+		return
+	}
+	if state.Attempts >= policy.MaxAttempts {
+		s.giveUp(tunnel, state, policy, status)
+		return
+	}
+
+	delay := Backoff(policy, state.Attempts)
+	next := now.Add(delay)
+	state.State = models.HealingStateHealing
+	state.NextAttemptAt = models.NullTime{Time: next, Valid: true}
+	if err := s.db.Save(state).Error; err != nil {
+		log.Errorf("[Healing]保存隧道 %d 自愈状态失败: %v", tunnel.ID, err)
+		return
+	}
+
+	s.schedule(tunnel.ID, delay)
+	log.Infof("[Healing]隧道 %s 状态为 %s，%v 后执行第 %d 次重启", instanceID, status, delay, state.Attempts+1)
+	s.emit(state, policy, fmt.Sprintf("隧道状态 %s，计划重启", status))
+}
+
+// schedule 登记重启计时器
+func (s *Service) schedule(tunnelID int64, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if t, ok := s.timers[tunnelID]; ok {
+		t.Stop()
+	}
+	s.timers[tunnelID] = time.AfterFunc(delay, func() { s.attempt(tunnelID) })
+}
+
+// cancel 取消待执行的重启计时器
+func (s *Service) cancel(tunnelID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timers[tunnelID]; ok {
+		t.Stop()
+		delete(s.timers, tunnelID)
+	}
+}
+
+// attempt 计时器到期后执行一次重启
+// 执行期间标记为进行中，避免重启过程中到达的状态事件再安排一次重启
+func (s *Service) attempt(tunnelID int64) {
+	s.mu.Lock()
+	delete(s.timers, tunnelID)
+	s.inflight[tunnelID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, tunnelID)
+		s.mu.Unlock()
+	}()
+
+	var tunnel models.Tunnel
+	if err := s.db.Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.db.Where("tunnel_id = ?", tunnelID).Delete(&models.TunnelHealingState{})
+		}
+		return
+	}
+	if tunnel.InstanceID == nil {
+		return
+	}
+
+	state, err := s.loadState(&tunnel)
+	if err != nil {
+		return
+	}
+	policy, err := s.EffectivePolicy(tunnel.ID)
+	if err != nil || policy == nil || !policy.Enabled {
+		state.State = models.HealingStateIdle
+		state.NextAttemptAt = models.NullTime{}
+		s.db.Save(state)
+		return
+	}
+
+	// 期间状态已变化（恢复或被手动停止），无需继续
+	switch tunnel.Status {
+	case models.TunnelStatusRunning:
+		s.markRecovered(tunnel.EndpointID, *tunnel.InstanceID)
+		return
+	case models.TunnelStatusError, models.TunnelStatusOffline:
+	default:
+		state.State = models.HealingStateIdle
+		state.NextAttemptAt = models.NullTime{}
+		s.db.Save(state)
+		return
+	}
+
+	// 主控离线时重启没有意义，等待重连后的 initial 事件重新触发
+	if !s.endpointOnline(tunnel.EndpointID) {
+		state.NextAttemptAt = models.NullTime{}
+		s.db.Save(state)
+		return
+	}
+
+	if state.Attempts >= policy.MaxAttempts {
+		s.giveUp(&tunnel, state, policy, tunnel.Status)
+		return
+	}
+
+	now := time.Now()
+	state.Attempts++
+	state.LastAttemptAt = models.NullTime{Time: now, Valid: true}
+
+	result := models.HealingResultIssued
+	msg := fmt.Sprintf("第 %d/%d 次自动重启", state.Attempts, policy.MaxAttempts)
+	if err := s.control(tunnel.EndpointID, *tunnel.InstanceID, "restart"); err != nil {
+		result = models.HealingResultFailed
+		msg = fmt.Sprintf("%s失败: %v", msg, err)
+		errStr := err.Error()
+		state.LastError = &errStr
+		log.Warnf("[Healing]隧道 %s %s", *tunnel.InstanceID, msg)
+	} else {
+		state.LastError = nil
+		log.Infof("[Healing]隧道 %s %s", *tunnel.InstanceID, msg)
+	}
+	s.recordAttempt(&tunnel, state.Attempts, tunnel.Status, result, msg)
+	s.writeOperationLog(&tunnel, models.OperationActionHeal, string(result), msg)
+
+	// 到期后再次检查：仍异常则进行下一次尝试或放弃
+	delay := Backoff(policy, state.Attempts)
+	state.NextAttemptAt = models.NullTime{Time: now.Add(delay), Valid: true}
+	if err := s.db.Save(state).Error; err != nil {
+		log.Errorf("[Healing]保存隧道 %d 自愈状态失败: %v", tunnel.ID, err)
+	}
+	s.schedule(tunnel.ID, delay)
+	s.emit(state, policy, msg)
+}
+
+// giveUp 超出最大尝试次数，停止自愈
+func (s *Service) giveUp(tunnel *models.Tunnel, state *models.TunnelHealingState, policy *models.HealingPolicy, status models.TunnelStatus) {
+	s.cancel(tunnel.ID)
+
+	now := time.Now()
+	state.State = models.HealingStateGaveUp
+	state.GaveUpAt = models.NullTime{Time: now, Valid: true}
+	state.NextAttemptAt = models.NullTime{}
+	if err := s.db.Save(state).Error; err != nil {
+		log.Errorf("[Healing]保存隧道 %d 自愈状态失败: %v", tunnel.ID, err)
+	}
+
+	msg := fmt.Sprintf("已连续自动重启 %d 次仍未恢复，放弃自愈", state.Attempts)
+	s.recordAttempt(tunnel, state.Attempts, status, models.HealingResultGaveUp, msg)
+	s.writeOperationLog(tunnel, models.OperationActionHealGiveUp, "failed", msg)
+	log.Warnf("[Healing]隧道 %s %s", state.InstanceID, msg)
+	s.emit(state, policy, msg)
+}
+
+// markRecovered 隧道恢复运行，结束本轮自愈
+func (s *Service) markRecovered(endpointID int64, instanceID string) {
+	var state models.TunnelHealingState
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).Limit(1).Find(&state).Error; err != nil || state.TunnelID == 0 {
+		return
+	}
+	s.cancel(state.TunnelID)
+	if state.State != models.HealingStateHealing && state.State != models.HealingStateGaveUp {
+		return
+	}
+
+	state.State = models.HealingStateRecovered
+	state.NextAttemptAt = models.NullTime{}
+	state.LastError = nil
+	if err := s.db.Save(&state).Error; err != nil {
+		log.Errorf("[Healing]保存隧道 %d 自愈状态失败: %v", state.TunnelID, err)
+		return
+	}
+	log.Infof("[Healing]隧道 %s 已恢复运行（本窗口内重启 %d 次）", instanceID, state.Attempts)
+
+	policy, _ := s.EffectivePolicy(state.TunnelID)
+	s.emit(&state, policy, "隧道已恢复运行")
+}
+
+// Reset 手动清除隧道的自愈状态（例如放弃后人工排障完成）
+func (s *Service) Reset(tunnelID int64) error {
+	s.cancel(tunnelID)
+	return s.db.Where("tunnel_id = ?", tunnelID).Delete(&models.TunnelHealingState{}).Error
+}
+
+// Backoff 计算第 attempts+1 次尝试前的等待时间：base * 2^attempts，不超过上限
+func Backoff(policy *models.HealingPolicy, attempts int) time.Duration {
+	base := time.Duration(policy.BaseBackoffSec) * time.Second
+	max := time.Duration(policy.MaxBackoffSec) * time.Second
+	if base <= 0 {
+		base = defaultBaseBackoffSec * time.Second
+	}
+	if max < base {
+		max = base
+	}
+	d := base
+	for i := 0; i < attempts; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
+
+// EffectivePolicy 获取隧道生效的策略：tunnel > group > global，均未配置时返回 nil
+func (s *Service) EffectivePolicy(tunnelID int64) (*models.HealingPolicy, error) {
+	var policies []models.HealingPolicy
+	if err := s.db.Where("scope = ? AND target_id = ?", models.HealingScopeTunnel, tunnelID).Limit(1).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		groupIDs := s.db.Model(&models.TunnelGroup{}).Select("group_id").Where("tunnel_id = ?", tunnelID)
+		if err := s.db.Where("scope = ? AND target_id IN (?)", models.HealingScopeGroup, groupIDs).
+			Order("target_id").Limit(1).Find(&policies).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(policies) == 0 {
+		if err := s.db.Where("scope = ?", models.HealingScopeGlobal).Limit(1).Find(&policies).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	p := policies[0]
+	normalizePolicy(&p)
+	return &p, nil
+}
+
+// ListPolicies 获取全部策略
+func (s *Service) ListPolicies() ([]models.HealingPolicy, error) {
+	var policies []models.HealingPolicy
+	err := s.db.Order("scope, target_id").Find(&policies).Error
+	return policies, err
+}
+
+// SavePolicy 按 (scope, target_id) 创建或更新策略
+func (s *Service) SavePolicy(p *models.HealingPolicy) error {
+	switch p.Scope {
+	case models.HealingScopeGlobal:
+		p.TargetID = 0
+	case models.HealingScopeGroup, models.HealingScopeTunnel:
+		if p.TargetID <= 0 {
+			return errors.New("分组或隧道策略必须指定 targetId")
+		}
+	default:
+		return errors.New("无效的策略范围，支持: global, group, tunnel")
+	}
+	if p.MaxAttempts < 0 || p.BaseBackoffSec < 0 || p.MaxBackoffSec < 0 || p.CooldownSec < 0 {
+		return errors.New("策略参数不能为负数")
+	}
+	normalizePolicy(p)
+
+	var existing models.HealingPolicy
+	err := s.db.Where("scope = ? AND target_id = ?", p.Scope, p.TargetID).Limit(1).Find(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing.ID != 0 {
+		p.ID = existing.ID
+		p.CreatedAt = existing.CreatedAt
+	}
+	return s.db.Save(p).Error
+}
+
+// DeletePolicy 删除策略
+func (s *Service) DeletePolicy(id int64) error {
+	result := s.db.Delete(&models.HealingPolicy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("策略不存在")
+	}
+	return nil
+}
+
+// ListStates 获取自愈状态列表，state 为空时返回全部
+func (s *Service) ListStates(state string) ([]models.TunnelHealingState, error) {
+	var states []models.TunnelHealingState
+	q := s.db.Order("updated_at DESC")
+	if state != "" {
+		q = q.Where("state = ?", state)
+	}
+	err := q.Find(&states).Error
+	return states, err
+}
+
+// GetTunnelHealing 获取单个隧道的自愈状态、生效策略和最近尝试记录
+func (s *Service) GetTunnelHealing(tunnelID int64, limit int) (*models.TunnelHealingState, *models.HealingPolicy, []models.HealingAttempt, error) {
+	var states []models.TunnelHealingState
+	if err := s.db.Where("tunnel_id = ?", tunnelID).Limit(1).Find(&states).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	policy, err := s.EffectivePolicy(tunnelID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var attempts []models.HealingAttempt
+	if err := s.db.Where("tunnel_id = ?", tunnelID).Order("id DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	var state *models.TunnelHealingState
+	if len(states) > 0 {
+		state = &states[0]
+	}
+	return state, policy, attempts, nil
+}
+
+// ======================== 内部工具 ============================
+
+func normalizePolicy(p *models.HealingPolicy) {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = defaultMaxAttempts
+	}
+	if p.BaseBackoffSec == 0 {
+		p.BaseBackoffSec = defaultBaseBackoffSec
+	}
+	if p.MaxBackoffSec == 0 {
+		p.MaxBackoffSec = defaultMaxBackoffSec
+	}
+	if p.CooldownSec == 0 {
+		p.CooldownSec = defaultCooldownSec
+	}
+}
+
+func (s *Service) findTunnel(endpointID int64, instanceID string) (*models.Tunnel, error) {
+	var rows []models.Tunnel
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+func (s *Service) loadState(tunnel *models.Tunnel) (*models.TunnelHealingState, error) {
+	var state models.TunnelHealingState
+	if err := s.db.Where("tunnel_id = ?", tunnel.ID).Limit(1).Find(&state).Error; err != nil {
+		return nil, err
+	}
+	if state.TunnelID == 0 {
+		state = models.TunnelHealingState{
+			TunnelID:   tunnel.ID,
+			EndpointID: tunnel.EndpointID,
+			State:      models.HealingStateIdle,
+		}
+	}
+	if tunnel.InstanceID != nil {
+		state.InstanceID = *tunnel.InstanceID
+	}
+	return &state, nil
+}
+
+func (s *Service) endpointOnline(endpointID int64) bool {
+	var ep models.Endpoint
+	if err := s.db.Select("status").Where("id = ?", endpointID).Limit(1).Find(&ep).Error; err != nil {
+		return false
+	}
+	return ep.Status == models.EndpointStatusOnline
+}
+
+func (s *Service) recordAttempt(tunnel *models.Tunnel, attempt int, status models.TunnelStatus, result models.HealingAttemptResult, msg string) {
+	rec := models.HealingAttempt{
+		TunnelID:      tunnel.ID,
+		EndpointID:    tunnel.EndpointID,
+		InstanceID:    derefStr(tunnel.InstanceID),
+		Attempt:       attempt,
+		TriggerStatus: status,
+		Result:        result,
+		Message:       &msg,
+	}
+	if err := s.db.Create(&rec).Error; err != nil {
+		log.Warnf("[Healing]记录隧道 %d 自愈尝试失败: %v", tunnel.ID, err)
+	}
+}
+
+func (s *Service) writeOperationLog(tunnel *models.Tunnel, action models.OperationAction, status, msg string) {
+	tunnelID := tunnel.ID
+	opLog := models.TunnelOperationLog{
+		TunnelID:   &tunnelID,
+		TunnelName: tunnel.Name,
+		Action:     action,
+		Status:     status,
+		Message:    &msg,
+	}
+	if err := s.db.Create(&opLog).Error; err != nil {
+		log.Warnf("[Healing]写入隧道 %d 操作日志失败: %v", tunnel.ID, err)
+	}
+}
+
+func (s *Service) emit(state *models.TunnelHealingState, policy *models.HealingPolicy, msg string) {
+	s.mu.Lock()
+	notifier := s.notifier
+	s.mu.Unlock()
+	if notifier == nil {
+		return
+	}
+
+	evt := Event{
+		Type:       "healing",
+		TunnelID:   state.TunnelID,
+		EndpointID: state.EndpointID,
+		InstanceID: state.InstanceID,
+		State:      state.State,
+		Attempt:    state.Attempts,
+		Message:    msg,
+		Time:       time.Now(),
+	}
+	if policy != nil {
+		evt.MaxAttempts = policy.MaxAttempts
+	}
+	if state.NextAttemptAt.Valid {
+		next := state.NextAttemptAt.Time
+		evt.NextAttemptAt = &next
+	}
+	notifier(state.InstanceID, evt)
+}
+
+func derefStr(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
@@ -0,0 +1,94 @@
+package healing
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := &models.HealingPolicy{BaseBackoffSec: 10, MaxBackoffSec: 60}
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{3, 60 * time.Second},
+		{10, 60 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := Backoff(policy, tc.attempts); got != tc.want {
+			t.Errorf("Backoff(attempts=%d)=%v want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestAttemptGivesUpAfterMaxAttempts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.TunnelGroup{}, &models.TunnelOperationLog{},
+		&models.HealingPolicy{}, &models.TunnelHealingState{}, &models.HealingAttempt{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	ep := models.Endpoint{Name: "ep", URL: "http://127.0.0.1", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline}
+	if err := db.Create(&ep).Error; err != nil {
+		t.Fatalf("seed endpoint: %v", err)
+	}
+	instanceID := "abc"
+	tunnel := models.Tunnel{Name: "t1", EndpointID: ep.ID, InstanceID: &instanceID, Type: models.TunnelModeServer, Status: models.TunnelStatusError}
+	if err := db.Create(&tunnel).Error; err != nil {
+		t.Fatalf("seed tunnel: %v", err)
+	}
+
+	s := NewService(db)
+	defer s.Close()
+	restarts, duringRestart := 0, 0
+	s.control = func(int64, string, string) error {
+		restarts++
+		// 重启过程中到达的异常事件不应再安排一次重启
+		s.handleStatus(ep.ID, instanceID, models.TunnelStatusError, models.TunnelStatusError)
+		s.mu.Lock()
+		duringRestart += len(s.timers)
+		s.mu.Unlock()
+		return nil
+	}
+	if err := s.SavePolicy(&models.HealingPolicy{Scope: models.HealingScopeGlobal, Enabled: true, MaxAttempts: 2, BaseBackoffSec: 3600}); err != nil {
+		t.Fatalf("save policy: %v", err)
+	}
+
+	s.handleStatus(ep.ID, instanceID, models.TunnelStatusRunning, models.TunnelStatusError)
+	for i := 0; i < 3; i++ {
+		s.attempt(tunnel.ID)
+	}
+
+	if restarts != 2 || duringRestart != 0 {
+		t.Fatalf("restarts=%d timers during restart=%d, want 2 and 0", restarts, duringRestart)
+	}
+	state, _, attempts, err := s.GetTunnelHealing(tunnel.ID, 10)
+	if err != nil {
+		t.Fatalf("get healing: %v", err)
+	}
+	if state == nil || state.State != models.HealingStateGaveUp {
+		t.Fatalf("state=%+v want gave_up", state)
+	}
+	if len(attempts) != 3 || attempts[0].Result != models.HealingResultGaveUp {
+		t.Fatalf("attempts=%+v want 2 issued + gave_up", attempts)
+	}
+
+	// 放弃后同一冷却窗口内不再安排重启
+	s.handleStatus(ep.ID, instanceID, models.TunnelStatusError, models.TunnelStatusError)
+	s.mu.Lock()
+	pending := len(s.timers)
+	s.mu.Unlock()
+	if pending != 0 {
+		t.Fatalf("pending timers=%d want 0 after giving up", pending)
+	}
+}
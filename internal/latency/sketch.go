@@ -0,0 +1,232 @@
+// Package latency 提供延迟分布的流式分位数草图
+package latency
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+const (
+	relativeAccuracy = 0.01 // 分位数相对误差 1%
+	minValue         = 1e-3 // 小于该值（ms）的延迟计入零桶
+	maxBins          = 512  // 桶数上限，超出时合并最低的桶，保证内存有界
+)
+
+var (
+	gamma    = (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	logGamma = math.Log(gamma)
+)
+
+// Sketch 对数分桶的延迟草图（DDSketch 思路）：可合并，分位数具有相对误差保证
+// 同时记录数量、总和、平方和与最值，用于计算平均值与抖动（标准差）
+type Sketch struct {
+	Count uint64         `json:"n"`
+	Sum   float64        `json:"sum"`
+	SumSq float64        `json:"sumSq"`
+	Min   float64        `json:"min"`
+	Max   float64        `json:"max"`
+	Zero  uint64         `json:"zero,omitempty"`
+	Bins  map[int]uint64 `json:"bins,omitempty"`
+}
+
+// New 创建空草图
+func New() *Sketch {
+	return &Sketch{Bins: make(map[int]uint64)}
+}
+
+func index(v float64) int {
+	return int(math.Ceil(math.Log(v) / logGamma))
+}
+
+// value 返回桶的代表值（桶上下界的相对中点）
+func value(i int) float64 {
+	return 2 * math.Pow(gamma, float64(i)) / (gamma + 1)
+}
+
+// Encode 将草图编码为 JSON 文本用于持久化，空草图返回空串
+func Encode(s *Sketch) string {
+	if s == nil || s.Count == 0 {
+		return ""
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Decode 解析 Encode 的结果，空串或 null 返回 nil
+func Decode(data string) (*Sketch, error) {
+	if data == "" || data == "null" {
+		return nil, nil
+	}
+	s := New()
+	if err := json.Unmarshal([]byte(data), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add 记录一次延迟（ms），负值忽略
+func (s *Sketch) Add(v float64) {
+	if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	s.SumSq += v * v
+	if v < minValue {
+		s.Zero++
+		return
+	}
+	if s.Bins == nil {
+		s.Bins = make(map[int]uint64)
+	}
+	s.Bins[index(v)]++
+	s.collapse()
+}
+
+// Merge 合并另一个草图
+func (s *Sketch) Merge(o *Sketch) {
+	if o == nil || o.Count == 0 {
+		return
+	}
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	s.SumSq += o.SumSq
+	s.Zero += o.Zero
+	if s.Bins == nil {
+		s.Bins = make(map[int]uint64, len(o.Bins))
+	}
+	for i, c := range o.Bins {
+		s.Bins[i] += c
+	}
+	s.collapse()
+}
+
+// collapse 桶数超过上限时将最低的桶合并到更高的桶，牺牲低延迟端的精度
+func (s *Sketch) collapse() {
+	if len(s.Bins) <= maxBins {
+		return
+	}
+	keys := s.sortedIndexes()
+	excess := len(keys) - maxBins
+	target := keys[excess]
+	for _, i := range keys[:excess] {
+		s.Bins[target] += s.Bins[i]
+		delete(s.Bins, i)
+	}
+}
+
+func (s *Sketch) sortedIndexes() []int {
+	keys := make([]int, 0, len(s.Bins))
+	for i := range s.Bins {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// Quantile 返回分位数 q（0~1）的估计值，空草图返回 0
+func (s *Sketch) Quantile(q float64) float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.Min
+	}
+	if q >= 1 {
+		return s.Max
+	}
+	rank := uint64(q * float64(s.Count-1))
+	seen := s.Zero
+	if seen > rank {
+		return s.Min
+	}
+	for _, i := range s.sortedIndexes() {
+		seen += s.Bins[i]
+		if seen > rank {
+			return math.Max(s.Min, math.Min(s.Max, value(i)))
+		}
+	}
+	return s.Max
+}
+
+// Mean 返回平均值
+func (s *Sketch) Mean() float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// StdDev 返回标准差，即延迟抖动
+func (s *Sketch) StdDev() float64 {
+	if s == nil || s.Count == 0 {
+		return 0
+	}
+	mean := s.Mean()
+	variance := s.SumSq/float64(s.Count) - mean*mean
+	if variance <= 0 {
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// Bucket 直方图区间 [Lower, Upper)
+type Bucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count uint64  `json:"count"`
+}
+
+// Histogram 将草图转换为最多 n 个对数等宽区间的直方图
+func (s *Sketch) Histogram(n int) []Bucket {
+	if s == nil || s.Count == 0 {
+		return []Bucket{}
+	}
+	if n < 1 {
+		n = 1
+	}
+	lower := math.Max(s.Min, minValue)
+	upper := s.Max
+	if upper <= lower {
+		return []Bucket{{Lower: s.Min, Upper: s.Max, Count: s.Count}}
+	}
+
+	step := math.Log(upper/lower) / float64(n)
+	buckets := make([]Bucket, n)
+	for i := range buckets {
+		buckets[i].Lower = lower * math.Exp(step*float64(i))
+		buckets[i].Upper = lower * math.Exp(step*float64(i+1))
+	}
+	buckets[0].Lower = s.Min
+	buckets[n-1].Upper = s.Max
+
+	buckets[0].Count += s.Zero
+	for i, c := range s.Bins {
+		v := math.Max(lower, math.Min(upper, value(i)))
+		pos := int(math.Log(v/lower) / step)
+		if pos >= n {
+			pos = n - 1
+		}
+		if pos < 0 {
+			pos = 0
+		}
+		buckets[pos].Count += c
+	}
+	return buckets
+}
@@ -0,0 +1,69 @@
+package latency
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSketchQuantiles(t *testing.T) {
+	s := New()
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+	for _, c := range []struct{ q, want float64 }{{0.5, 500}, {0.9, 900}, {0.99, 990}} {
+		if got := s.Quantile(c.q); math.Abs(got-c.want)/c.want > 0.02 {
+			t.Errorf("Quantile(%v) = %v, want ~%v", c.q, got, c.want)
+		}
+	}
+	if s.Max != 1000 || s.Min != 1 {
+		t.Errorf("min/max = %v/%v", s.Min, s.Max)
+	}
+	if got := s.StdDev(); math.Abs(got-288.67) > 0.1 {
+		t.Errorf("StdDev = %v, want ~288.67", got)
+	}
+
+	// 拆分后合并应得到相同的结果，并且能经过编码往返
+	a, b := New(), New()
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	decoded, err := Decode(Encode(b))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	a.Merge(decoded)
+	if a.Count != s.Count || a.Quantile(0.99) != s.Quantile(0.99) {
+		t.Errorf("merged count=%d p99=%v, want %d %v", a.Count, a.Quantile(0.99), s.Count, s.Quantile(0.99))
+	}
+
+	if empty, err := Decode(Encode(New())); empty != nil || err != nil {
+		t.Errorf("empty sketch decoded to %v, %v", empty, err)
+	}
+
+	var total uint64
+	for _, b := range s.Histogram(10) {
+		total += b.Count
+	}
+	if total != s.Count {
+		t.Errorf("histogram total = %d, want %d", total, s.Count)
+	}
+}
+
+func TestSketchBounded(t *testing.T) {
+	s := New()
+	for v := 0.001; v < 1e9; v *= 1.001 {
+		s.Add(v)
+	}
+	if len(s.Bins) > maxBins {
+		t.Errorf("bins = %d, want <= %d", len(s.Bins), maxBins)
+	}
+	// 合并只发生在低延迟端，高分位仍保持精度
+	want := 0.001 * math.Pow(1.001, 0.99*float64(s.Count-1))
+	if got := s.Quantile(0.99); math.Abs(got-want)/want > 0.02 {
+		t.Errorf("p99 = %v, want ~%v", got, want)
+	}
+}
@@ -3,7 +3,6 @@ package log
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,13 +15,20 @@ import (
 type FileLogger struct {
 	baseDir   string              // 日志根目录
 	fileCache map[string]*os.File // 文件句柄缓存
+	fileSizes map[string]int64    // 已打开文件的当前大小
 	mu        sync.RWMutex        // 保护文件缓存的锁
 
 	// 配置选项
-	maxFileSize   int64         // 单个日志文件最大大小（字节）
+	maxFileSize   int64         // 单个日志文件最大大小（字节），超过后轮转
 	retentionDays int           // 日志保留天数
 	flushInterval time.Duration // 自动刷新间隔
 
+	// 压缩与配额
+	compress        bool          // 是否压缩已结束写入的文件
+	instanceQuota   int64         // 单个实例日志占用上限（字节），0 表示不限
+	totalQuota      int64         // 全部日志占用上限（字节），0 表示不限
+	storageInterval time.Duration // 压缩与配额检查间隔
+
 	// 日志清理配置
 	logCleanupInterval  time.Duration // 清理间隔
 	maxLogRecordsPerDay int           // 每天最大日志记录数
@@ -40,7 +46,10 @@ func NewFileLogger(baseDir string) *FileLogger {
 	fl := &FileLogger{
 		baseDir:             baseDir,
 		fileCache:           make(map[string]*os.File),
+		fileSizes:           make(map[string]int64),
 		maxFileSize:         100 * 1024 * 1024, // 默认100MB
+		compress:            true,              // 默认压缩已结束写入的文件
+		storageInterval:     10 * time.Minute,  // 默认10分钟检查一次压缩与配额
 		retentionDays:       7,                 // 默认保留7天
 		flushInterval:       5 * time.Second,   // 默认5秒刷新一次
 		logCleanupInterval:  24 * time.Hour,    // 默认24小时清理一次
@@ -82,19 +91,35 @@ func (fl *FileLogger) WriteLog(endpointID int64, instanceID, logContent string)
 		return fmt.Errorf("创建日志目录失败: %v", err)
 	}
 
-	// 获取或创建文件句柄
-	file, err := fl.getOrCreateFile(filePath)
-	if err != nil {
-		return fmt.Errorf("获取日志文件失败: %v", err)
-	}
-
 	// 写入日志（带时间戳）
 	logLine := fmt.Sprintf("%s\n", logContent)
 	// timestamp := now.Format("2006-01-02 15:04:05")
 	// logLine := fmt.Sprintf("[%s] %s\n", timestamp, logContent)
 
 	fl.mu.Lock()
-	_, err = file.WriteString(logLine)
+	// 在锁内获取或创建文件句柄，避免拿到被并发轮转或清理关闭的句柄
+	file, err := fl.getOrCreateFileLocked(filePath)
+	if err != nil {
+		fl.mu.Unlock()
+		return fmt.Errorf("获取日志文件失败: %v", err)
+	}
+	// 超过单文件大小上限时先轮转
+	if size := fl.fileSizes[filePath]; fl.maxFileSize > 0 && size > 0 && size+int64(len(logLine)) > fl.maxFileSize {
+		if rotated, rerr := fl.rotateLocked(filePath, file); rerr != nil {
+			Warnf("轮转日志文件失败: %s, err: %v", filePath, rerr)
+			if file, err = os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err == nil {
+				fl.fileCache[filePath] = file
+			}
+		} else {
+			file = rotated
+		}
+	}
+	if err == nil {
+		_, err = file.WriteString(logLine)
+	}
+	if err == nil {
+		fl.fileSizes[filePath] += int64(len(logLine))
+	}
 	fl.mu.Unlock()
 
 	if err != nil {
@@ -104,20 +129,8 @@ func (fl *FileLogger) WriteLog(endpointID int64, instanceID, logContent string)
 	return nil
 }
 
-// getOrCreateFile 获取或创建文件句柄
-func (fl *FileLogger) getOrCreateFile(filePath string) (*os.File, error) {
-	fl.mu.RLock()
-	file, exists := fl.fileCache[filePath]
-	fl.mu.RUnlock()
-
-	if exists {
-		return file, nil
-	}
-
-	fl.mu.Lock()
-	defer fl.mu.Unlock()
-
-	// 双重检查
+// getOrCreateFileLocked 获取或创建文件句柄，调用方需持有 fl.mu
+func (fl *FileLogger) getOrCreateFileLocked(filePath string) (*os.File, error) {
 	if file, exists := fl.fileCache[filePath]; exists {
 		return file, nil
 	}
@@ -129,47 +142,21 @@ func (fl *FileLogger) getOrCreateFile(filePath string) (*os.File, error) {
 	}
 
 	fl.fileCache[filePath] = file
+	fl.fileSizes[filePath] = 0
+	if info, err := file.Stat(); err == nil {
+		fl.fileSizes[filePath] = info.Size()
+	}
 	return file, nil
 }
 
-// ReadLogs 读取指定端点和实例的日志
+// ReadLogs 读取指定端点和实例的日志（含当天的轮转段与压缩文件）
 func (fl *FileLogger) ReadLogs(endpointID int64, instanceID string, date time.Time, limit int) ([]string, error) {
-	fileName := fmt.Sprintf("%s.log", date.Format("2006-01-02"))
-	filePath := filepath.Join(fl.baseDir, fmt.Sprintf("endpoint_%d", endpointID), instanceID, fileName)
-
-	// Debug: 添加调试日志
-	fmt.Printf("[DEBUG] ReadLogs - baseDir: %s, endpointID: %d, instanceID: %s, fileName: %s, filePath: %s\n", 
-		fl.baseDir, endpointID, instanceID, fileName, filePath)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Printf("[DEBUG] ReadLogs - 文件不存在: %s\n", filePath)
-		return []string{}, nil
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("打开日志文件失败: %v", err)
-	}
-	defer file.Close()
+	instanceDir := filepath.Join(fl.baseDir, fmt.Sprintf("endpoint_%d", endpointID), instanceID)
 
-	// 读取文件内容
-	content, err := io.ReadAll(file)
+	lines, _, err := readDateLines(instanceDir, date.Format("2006-01-02"), limit)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志文件失败: %v", err)
 	}
-
-	// 按行分割并限制数量
-	lines := []string{}
-	for _, line := range strings.Split(string(content), "\n") {
-		if line != "" {
-			lines = append(lines, line)
-			if limit > 0 && len(lines) >= limit {
-				break
-			}
-		}
-	}
-
 	return lines, nil
 }
 
@@ -207,32 +194,17 @@ type LogEntry struct {
 
 // readLogsByDate 读取指定日期的日志
 func (fl *FileLogger) readLogsByDate(endpointID int64, instanceID string, date time.Time) ([]LogEntry, error) {
-	fileName := fmt.Sprintf("%s.log", date.Format("2006-01-02"))
-	filePath := filepath.Join(fl.baseDir, fmt.Sprintf("endpoint_%d", endpointID), instanceID, fileName)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return []LogEntry{}, nil
-	}
-
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	content, err := io.ReadAll(file)
+	instanceDir := filepath.Join(fl.baseDir, fmt.Sprintf("endpoint_%d", endpointID), instanceID)
+	lines, paths, err := readDateLines(instanceDir, date.Format("2006-01-02"), 0)
 	if err != nil {
 		return nil, err
 	}
 
 	// 解析日志行
 	var entries []LogEntry
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
+	modTimes := map[string]time.Time{}
+	for i, line := range lines {
+		filePath := paths[i]
 
 		// 尝试解析时间戳
 		if len(line) > 20 && line[0] == '[' {
@@ -248,13 +220,20 @@ func (fl *FileLogger) readLogsByDate(endpointID int64, instanceID string, date t
 		}
 
 		// 如果解析失败，使用文件修改时间
-		if stat, err := os.Stat(filePath); err == nil {
-			entries = append(entries, LogEntry{
-				Timestamp: stat.ModTime(),
-				Content:   line,
-				FilePath:  filePath,
-			})
+		modTime, ok := modTimes[filePath]
+		if !ok {
+			if stat, err := os.Stat(filePath); err == nil {
+				modTime = stat.ModTime()
+				modTimes[filePath] = modTime
+			} else {
+				continue
+			}
 		}
+		entries = append(entries, LogEntry{
+			Timestamp: modTime,
+			Content:   line,
+			FilePath:  filePath,
+		})
 	}
 
 	return entries, nil
@@ -265,8 +244,10 @@ func (fl *FileLogger) startPeriodicTasks() {
 	go func() {
 		flushTicker := time.NewTicker(fl.flushInterval)
 		cleanupTicker := time.NewTicker(24 * time.Hour) // 每天清理一次
+		storageTicker := time.NewTicker(fl.storageInterval)
 		defer flushTicker.Stop()
 		defer cleanupTicker.Stop()
+		defer storageTicker.Stop()
 
 		for {
 			select {
@@ -276,6 +257,8 @@ func (fl *FileLogger) startPeriodicTasks() {
 				fl.flushAll()
 			case <-cleanupTicker.C:
 				fl.cleanupOldLogs()
+			case <-storageTicker.C:
+				fl.maintainStorage()
 			}
 		}
 	}()
@@ -303,11 +286,8 @@ func (fl *FileLogger) cleanupOldLogs() {
 			return nil // 忽略错误，继续处理其他文件
 		}
 
-		if !info.IsDir() && filepath.Ext(path) == ".log" {
-			// 从文件名提取日期
-			baseName := filepath.Base(path)
-			dateStr := baseName[:len(baseName)-4] // 去掉.log后缀
-
+		if dateStr, _, _, ok := parseLogFileName(info.Name()); ok && !info.IsDir() {
+			// 从文件名提取日期（含轮转段与压缩文件）
 			if fileDate, err := time.Parse("2006-01-02", dateStr); err == nil {
 				if fileDate.Before(cutoffDate) {
 					// 关闭文件句柄（如果有的话）
@@ -316,6 +296,7 @@ func (fl *FileLogger) cleanupOldLogs() {
 					// 删除文件
 					if err := os.Remove(path); err == nil {
 						deletedCount++
+						os.Remove(path + indexSuffix)
 						Debugf("删除过期日志文件: %s", path)
 					} else {
 						Warnf("删除日志文件失败: %s, err: %v", path, err)
@@ -342,6 +323,7 @@ func (fl *FileLogger) closeFile(filePath string) {
 	if file, exists := fl.fileCache[filePath]; exists {
 		file.Close()
 		delete(fl.fileCache, filePath)
+		delete(fl.fileSizes, filePath)
 	}
 }
 
@@ -371,7 +353,7 @@ func (fl *FileLogger) ClearLogs(endpointID int64, instanceID string) error {
 		}
 	}
 
-	// 删除目录下的所有 .log 文件
+	// 删除目录下的所有日志文件（含轮转段与压缩文件）
 	entries, err := os.ReadDir(instanceDir)
 	if err != nil {
 		return fmt.Errorf("读取日志目录失败: %v", err)
@@ -379,13 +361,15 @@ func (fl *FileLogger) ClearLogs(endpointID int64, instanceID string) error {
 
 	var deletedCount int
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+		if !entry.IsDir() && IsLogFileName(entry.Name()) {
 			logPath := filepath.Join(instanceDir, entry.Name())
 			if err := os.Remove(logPath); err != nil {
 				Warnf("删除日志文件失败: %s, error: %v", logPath, err)
 			} else {
 				deletedCount++
 			}
+		} else if !entry.IsDir() && strings.HasSuffix(entry.Name(), indexSuffix) {
+			os.Remove(filepath.Join(instanceDir, entry.Name()))
 		}
 	}
 
@@ -497,6 +481,9 @@ func (fl *FileLogger) TriggerCleanup() {
 func (fl *FileLogger) GetLogStats() map[string]interface{} {
 	totalFiles := 0
 	totalSize := int64(0)
+	compressedFiles := 0
+	compressedSize := int64(0)
+	rawSize := int64(0)
 	oldestDate := time.Now()
 	newestDate := time.Time{}
 
@@ -505,13 +492,16 @@ func (fl *FileLogger) GetLogStats() map[string]interface{} {
 			return nil
 		}
 
-		if !info.IsDir() && filepath.Ext(path) == ".log" {
+		if dateStr, _, gz, ok := parseLogFileName(info.Name()); ok && !info.IsDir() {
 			totalFiles++
 			totalSize += info.Size()
-
-			// 从文件名提取日期
-			baseName := filepath.Base(path)
-			dateStr := baseName[:len(baseName)-4]
+			if gz {
+				compressedFiles++
+				compressedSize += info.Size()
+				rawSize += gzipRawSize(path, info.Size())
+			} else {
+				rawSize += info.Size()
+			}
 
 			if fileDate, err := time.Parse("2006-01-02", dateStr); err == nil {
 				if fileDate.Before(oldestDate) {
@@ -526,10 +516,15 @@ func (fl *FileLogger) GetLogStats() map[string]interface{} {
 		return nil
 	})
 
+	storage := fl.GetStorageConfig()
 	stats := map[string]interface{}{
-		"totalFiles":    totalFiles,
-		"totalSize":     totalSize,
-		"retentionDays": fl.retentionDays,
+		"totalFiles":      totalFiles,
+		"totalSize":       totalSize,       // 磁盘占用
+		"rawSize":         rawSize,         // 解压后的原始大小
+		"compressedFiles": compressedFiles, // 已压缩文件数
+		"compressedSize":  compressedSize,  // 已压缩文件的磁盘占用
+		"retentionDays":   fl.retentionDays,
+		"storage":         storage,
 	}
 
 	if err == nil && totalFiles > 0 {
@@ -564,10 +559,8 @@ func (fl *FileLogger) cleanupOldLogsAdvanced() {
 	// 首先调用原有的清理逻辑
 	fl.cleanupOldLogs()
 
-	// 可以在这里添加更多高级清理逻辑，比如：
-	// - 按文件大小清理
-	// - 按记录数量清理
-	// - 压缩旧文件等
+	// 压缩已结束写入的文件并按配额清理
+	fl.maintainStorage()
 }
 
 // GetLogCleanupStats 获取日志清理统计信息
@@ -623,6 +616,7 @@ func (fl *FileLogger) GetAvailableLogDates(endpointID int64, instanceID string)
 	}
 
 	var dates []string
+	seen := map[string]bool{}
 
 	// 遍历实例目录下的所有.log文件
 	err := filepath.Walk(instanceDir, func(path string, info os.FileInfo, err error) error {
@@ -630,17 +624,10 @@ func (fl *FileLogger) GetAvailableLogDates(endpointID int64, instanceID string)
 			return nil // 忽略错误，继续处理其他文件
 		}
 
-		// 只处理.log文件
-		if !info.IsDir() && filepath.Ext(path) == ".log" {
-			// 从文件名提取日期 (格式: YYYY-MM-DD.log)
-			fileName := filepath.Base(path)
-			if len(fileName) >= 11 && strings.HasSuffix(fileName, ".log") {
-				dateStr := fileName[:10] // 提取 YYYY-MM-DD 部分
-				// 验证日期格式
-				if _, err := time.Parse("2006-01-02", dateStr); err == nil {
-					dates = append(dates, dateStr)
-				}
-			}
+		// 只处理日志文件 (格式: YYYY-MM-DD[.N].log[.gz])，同一天只记一次
+		if dateStr, _, _, ok := parseLogFileName(info.Name()); ok && !info.IsDir() && !seen[dateStr] {
+			seen[dateStr] = true
+			dates = append(dates, dateStr)
 		}
 		return nil
 	})
@@ -0,0 +1,427 @@
+package log
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志文件命名：
+//
+//	YYYY-MM-DD.log        当天正在写入的文件
+//	YYYY-MM-DD.N.log      当天按大小轮转出的第 N 段（N 从 1 开始，越大越新）
+//	*.log.gz              已结束写入并压缩的文件
+//
+// 同一天的文件按 1..N、当前文件的顺序拼接即为完整日志。
+const gzipSuffix = ".gz"
+
+// StorageConfig 日志文件存储配置
+type StorageConfig struct {
+	MaxFileSize   int64 `json:"maxFileSize"`   // 单个文件超过该大小后轮转，0 表示不轮转
+	InstanceQuota int64 `json:"instanceQuota"` // 单个实例日志占用上限（磁盘字节），0 表示不限
+	TotalQuota    int64 `json:"totalQuota"`    // 全部日志占用上限（磁盘字节），0 表示不限
+	Compress      bool  `json:"compress"`      // 是否压缩已结束写入的文件
+}
+
+// logSegment 磁盘上的单个日志文件
+type logSegment struct {
+	path string
+	date string
+	seq  int  // 0 表示当天文件，>0 为轮转段
+	gz   bool // 是否已压缩
+	size int64
+}
+
+// order 同一天内的先后顺序：轮转段在前，当天文件在最后
+func (s logSegment) order() int {
+	if s.seq == 0 {
+		return math.MaxInt32
+	}
+	return s.seq
+}
+
+// parseLogFileName 解析日志文件名，返回日期、轮转序号与是否压缩
+func parseLogFileName(name string) (date string, seq int, gz bool, ok bool) {
+	if strings.HasSuffix(name, gzipSuffix) {
+		gz = true
+		name = strings.TrimSuffix(name, gzipSuffix)
+	}
+	if !strings.HasSuffix(name, ".log") {
+		return "", 0, false, false
+	}
+	stem := strings.TrimSuffix(name, ".log")
+	if len(stem) < 10 {
+		return "", 0, false, false
+	}
+	date = stem[:10]
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", 0, false, false
+	}
+	if rest := stem[10:]; rest != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(rest, "."))
+		if !strings.HasPrefix(rest, ".") || err != nil || n <= 0 {
+			return "", 0, false, false
+		}
+		seq = n
+	}
+	return date, seq, gz, true
+}
+
+// IsLogFileName 判断文件名是否为日志文件（含轮转段与压缩文件）
+func IsLogFileName(name string) bool {
+	_, _, _, ok := parseLogFileName(name)
+	return ok
+}
+
+// segmentName 生成日志文件名
+func segmentName(date string, seq int) string {
+	if seq == 0 {
+		return date + ".log"
+	}
+	return fmt.Sprintf("%s.%d.log", date, seq)
+}
+
+// openLogFile 打开日志文件，压缩文件透明解压
+func openLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return file, nil
+	}
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, file: file}, nil
+}
+
+// gzipFile 关闭时同时关闭底层文件
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// gzipRawSize 读取压缩文件尾部记录的原始大小（超过 4GB 时取模）
+func gzipRawSize(path string, size int64) int64 {
+	if size < 4 {
+		return 0
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	var buf [4]byte
+	if _, err := file.ReadAt(buf[:], size-4); err != nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint32(buf[:]))
+}
+
+// listSegments 列出目录下的日志文件；同一段同时存在压缩与未压缩文件时（压缩中断），只保留未压缩文件
+func listSegments(dir string) []logSegment {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	plain := map[string]bool{}
+	var segments []logSegment
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		date, seq, gz, ok := parseLogFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if !gz {
+			plain[segmentName(date, seq)] = true
+		}
+		segments = append(segments, logSegment{path: filepath.Join(dir, entry.Name()), date: date, seq: seq, gz: gz, size: info.Size()})
+	}
+	filtered := segments[:0]
+	for _, s := range segments {
+		if s.gz && plain[segmentName(s.date, s.seq)] {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	sortSegments(filtered)
+	return filtered
+}
+
+// sortSegments 按时间从旧到新排序
+func sortSegments(segments []logSegment) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		if segments[i].date != segments[j].date {
+			return segments[i].date < segments[j].date
+		}
+		return segments[i].order() < segments[j].order()
+	})
+}
+
+// dateSegments 指定日期的全部日志文件，按写入顺序排列
+func dateSegments(dir, date string) []logSegment {
+	var result []logSegment
+	for _, s := range listSegments(dir) {
+		if s.date == date {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// readDateLines 读取指定日期的全部非空日志行（依次读取轮转段与压缩文件）
+func readDateLines(dir, date string, limit int) ([]string, []string, error) {
+	lines := []string{}
+	var paths []string
+	for _, seg := range dateSegments(dir, date) {
+		reader, err := openLogFile(seg.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line == "" {
+				continue
+			}
+			lines = append(lines, line)
+			paths = append(paths, seg.path)
+			if limit > 0 && len(lines) >= limit {
+				return lines, paths, nil
+			}
+		}
+	}
+	return lines, paths, nil
+}
+
+// isActive 是否为当天正在写入的文件
+func (s logSegment) isActive(today string) bool {
+	return s.seq == 0 && !s.gz && s.date >= today
+}
+
+// rotateLocked 将当前文件轮转为下一个序号的分段并重新打开，调用方需持有 fl.mu
+func (fl *FileLogger) rotateLocked(filePath string, file *os.File) (*os.File, error) {
+	dir := filepath.Dir(filePath)
+	date, _, _, _ := parseLogFileName(filepath.Base(filePath))
+	next := 1
+	for _, s := range dateSegments(dir, date) {
+		if s.seq >= next {
+			next = s.seq + 1
+		}
+	}
+
+	file.Close()
+	delete(fl.fileCache, filePath)
+	if err := os.Rename(filePath, filepath.Join(dir, segmentName(date, next))); err != nil {
+		return nil, err
+	}
+	os.Remove(filePath + indexSuffix)
+
+	newFile, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fl.fileCache[filePath] = newFile
+	fl.fileSizes[filePath] = 0
+	Debugf("日志文件已轮转: %s -> %s", filePath, segmentName(date, next))
+	return newFile, nil
+}
+
+// compressFile 压缩单个日志文件，成功后删除原文件与索引
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + gzipSuffix + ".tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+gzipSuffix); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	src.Close()
+	os.Remove(path + indexSuffix)
+	return os.Remove(path)
+}
+
+// instanceDirs 列出全部实例日志目录
+func (fl *FileLogger) instanceDirs() []string {
+	var dirs []string
+	endpointDirs, err := os.ReadDir(fl.baseDir)
+	if err != nil {
+		return nil
+	}
+	for _, ep := range endpointDirs {
+		if !ep.IsDir() || !strings.HasPrefix(ep.Name(), "endpoint_") {
+			continue
+		}
+		instances, err := os.ReadDir(filepath.Join(fl.baseDir, ep.Name()))
+		if err != nil {
+			continue
+		}
+		for _, inst := range instances {
+			if inst.IsDir() {
+				dirs = append(dirs, filepath.Join(fl.baseDir, ep.Name(), inst.Name()))
+			}
+		}
+	}
+	return dirs
+}
+
+// removeSegment 删除日志文件及其索引
+func (fl *FileLogger) removeSegment(s logSegment) bool {
+	fl.closeFile(s.path)
+	if err := os.Remove(s.path); err != nil {
+		Warnf("删除日志文件失败: %s, err: %v", s.path, err)
+		return false
+	}
+	os.Remove(s.path + indexSuffix)
+	return true
+}
+
+// maintainStorage 压缩已结束写入的文件，并按配额从最旧的文件开始清理
+func (fl *FileLogger) maintainStorage() {
+	cfg := fl.GetStorageConfig()
+	today := time.Now().Format("2006-01-02")
+
+	compressed, evicted := 0, 0
+	var all []logSegment
+	for _, dir := range fl.instanceDirs() {
+		segments := listSegments(dir)
+		if cfg.Compress {
+			for i, s := range segments {
+				if s.gz || s.isActive(today) {
+					continue
+				}
+				fl.closeFile(s.path)
+				if err := compressFile(s.path); err != nil {
+					Warnf("压缩日志文件失败: %s, err: %v", s.path, err)
+					continue
+				}
+				compressed++
+				s.path += gzipSuffix
+				s.gz = true
+				if info, err := os.Stat(s.path); err == nil {
+					s.size = info.Size()
+				}
+				segments[i] = s
+			}
+		}
+
+		if cfg.InstanceQuota > 0 {
+			var used int64
+			for _, s := range segments {
+				used += s.size
+			}
+			kept := segments[:0]
+			for _, s := range segments {
+				if used > cfg.InstanceQuota && !s.isActive(today) && fl.removeSegment(s) {
+					used -= s.size
+					evicted++
+					continue
+				}
+				kept = append(kept, s)
+			}
+			segments = kept
+		}
+		all = append(all, segments...)
+	}
+
+	if cfg.TotalQuota > 0 {
+		var used int64
+		for _, s := range all {
+			used += s.size
+		}
+		sortSegments(all)
+		for _, s := range all {
+			if used <= cfg.TotalQuota {
+				break
+			}
+			if !s.isActive(today) && fl.removeSegment(s) {
+				used -= s.size
+				evicted++
+			}
+		}
+	}
+
+	if compressed > 0 || evicted > 0 {
+		Infof("日志存储维护完成: 压缩 %d 个文件, 按配额清理 %d 个文件", compressed, evicted)
+	}
+}
+
+// SetStorageConfig 设置日志轮转、压缩与配额
+func (fl *FileLogger) SetStorageConfig(cfg StorageConfig) {
+	fl.mu.Lock()
+	fl.maxFileSize = cfg.MaxFileSize
+	fl.instanceQuota = cfg.InstanceQuota
+	fl.totalQuota = cfg.TotalQuota
+	fl.compress = cfg.Compress
+	fl.mu.Unlock()
+
+	Infof("日志存储配置已更新: 轮转大小=%d, 实例配额=%d, 总配额=%d, 压缩=%v",
+		cfg.MaxFileSize, cfg.InstanceQuota, cfg.TotalQuota, cfg.Compress)
+}
+
+// GetStorageConfig 获取日志轮转、压缩与配额配置
+func (fl *FileLogger) GetStorageConfig() StorageConfig {
+	fl.mu.RLock()
+	defer fl.mu.RUnlock()
+	return StorageConfig{
+		MaxFileSize:   fl.maxFileSize,
+		InstanceQuota: fl.instanceQuota,
+		TotalQuota:    fl.totalQuota,
+		Compress:      fl.compress,
+	}
+}
+
+// TriggerStorageMaintenance 手动触发压缩与配额清理
+func (fl *FileLogger) TriggerStorageMaintenance() {
+	fl.maintainStorage()
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		date string
+		seq  int
+		gz   bool
+		ok   bool
+	}{
+		{"2024-01-01.log", "2024-01-01", 0, false, true},
+		{"2024-01-01.3.log", "2024-01-01", 3, false, true},
+		{"2024-01-01.2.log.gz", "2024-01-01", 2, true, true},
+		{"2024-01-01.log.gz", "2024-01-01", 0, true, true},
+		{"2024-01-01.log.idx", "", 0, false, false},
+		{"2024-01-01.0.log", "", 0, false, false},
+		{"2024-13-01.log", "", 0, false, false},
+		{"notes.log", "", 0, false, false},
+	}
+	for _, tt := range tests {
+		date, seq, gz, ok := parseLogFileName(tt.name)
+		if date != tt.date || seq != tt.seq || gz != tt.gz || ok != tt.ok {
+			t.Errorf("parseLogFileName(%q) = %q %d %v %v", tt.name, date, seq, gz, ok)
+		}
+	}
+}
+
+func TestRotationCompressionAndQuotas(t *testing.T) {
+	dir := t.TempDir()
+	fl := &FileLogger{
+		baseDir:     dir,
+		fileCache:   map[string]*os.File{},
+		fileSizes:   map[string]int64{},
+		maxFileSize: 40,
+		compress:    true,
+	}
+	fl.ctx, fl.cancel = context.WithCancel(context.Background())
+	defer fl.Close()
+
+	for i := 1; i <= 5; i++ {
+		if err := fl.WriteLog(1, "abc", fmt.Sprintf("INFO line %02d padding....", i)); err != nil {
+			t.Fatalf("WriteLog: %v", err)
+		}
+	}
+	instanceDir := filepath.Join(dir, "endpoint_1", "abc")
+	today := time.Now().Format("2006-01-02")
+	if segs := dateSegments(instanceDir, today); len(segs) != 5 {
+		t.Fatalf("segments after rotation = %d, want 5", len(segs))
+	}
+
+	// 旧日期文件，用于压缩与配额
+	old := strings.Repeat("ERROR old day entry\n", 50)
+	for _, name := range []string{"2024-01-01.log", "2024-01-02.log"} {
+		if err := os.WriteFile(filepath.Join(instanceDir, name), []byte(old), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fl.maintainStorage()
+	for _, s := range listSegments(instanceDir) {
+		if s.gz == s.isActive(today) {
+			t.Errorf("segment %s compressed = %v", filepath.Base(s.path), s.gz)
+		}
+	}
+
+	lines, err := fl.ReadLogs(1, "abc", time.Now(), 0)
+	if err != nil || len(lines) != 5 || !strings.Contains(lines[0], "line 01") || !strings.Contains(lines[4], "line 05") {
+		t.Errorf("ReadLogs = %v, err %v", lines, err)
+	}
+	oldLines, _ := fl.ReadLogs(1, "abc", time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local), 0)
+	if len(oldLines) != 50 {
+		t.Errorf("old day lines = %d, want 50", len(oldLines))
+	}
+	if res, err := fl.Search(SearchQuery{Text: "old day", EndpointIDs: []int64{1}}); err != nil || res.Total != 100 {
+		t.Errorf("search compressed total = %+v, err %v", res, err)
+	}
+
+	stats := fl.GetLogStats()
+	if stats["compressedFiles"].(int) != 6 || stats["rawSize"].(int64) <= stats["totalSize"].(int64) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// 实例配额：从最旧的文件开始清理，当天正在写入的文件保留
+	fl.SetStorageConfig(StorageConfig{MaxFileSize: 40, InstanceQuota: 1, Compress: true})
+	fl.maintainStorage()
+	segs := listSegments(instanceDir)
+	if len(segs) != 1 || !segs[0].isActive(today) {
+		t.Errorf("segments after quota = %+v", segs)
+	}
+	if dates, _ := fl.GetAvailableLogDates(1, "abc"); len(dates) != 1 || dates[0] != today {
+		t.Errorf("dates = %v", dates)
+	}
+}
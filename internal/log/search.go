@@ -0,0 +1,363 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+	maxSearchContext   = 10
+)
+
+// errStopSearch 流式检索中由回调提前终止
+var errStopSearch = errors.New("stop search")
+
+// SearchQuery 日志检索条件
+type SearchQuery struct {
+	EndpointIDs   []int64   // 为空表示全部主控
+	InstanceIDs   []string  // 为空表示全部实例
+	From          time.Time // 起始日期（含），零值表示不限
+	To            time.Time // 结束日期（含），零值表示不限
+	Text          string    // 检索内容，为空时只按级别过滤
+	Regex         bool      // Text 是否为正则表达式
+	CaseSensitive bool      // 是否区分大小写
+	Levels        []string  // 日志级别过滤，如 INFO、WARN、ERROR
+	Context       int       // 命中行前后附带的上下文行数，最多 10
+	Offset        int       // 分页偏移
+	Limit         int       // 每页数量，默认 50，最多 500；流式检索时为最大返回数，0 表示不限
+}
+
+// SearchHit 单条命中
+type SearchHit struct {
+	EndpointID int64    `json:"endpointId"`
+	InstanceID string   `json:"instanceId"`
+	Date       string   `json:"date"`
+	File       string   `json:"file"` // 相对于日志根目录的路径
+	Line       int      `json:"line"` // 行号，从 1 开始
+	Level      string   `json:"level,omitempty"`
+	Content    string   `json:"content"` // 去除颜色控制符后的日志内容
+	Before     []string `json:"before,omitempty"`
+	After      []string `json:"after,omitempty"`
+}
+
+// SearchResult 分页检索结果
+type SearchResult struct {
+	Hits         []SearchHit `json:"hits"`
+	Total        int         `json:"total"`
+	Offset       int         `json:"offset"`
+	Limit        int         `json:"limit"`
+	FilesScanned int         `json:"filesScanned"`
+	FilesSkipped int         `json:"filesSkipped"` // 通过索引跳过的文件数
+}
+
+// logFile 待检索的日志文件
+type logFile struct {
+	endpointID int64
+	instanceID string
+	date       string
+	path       string
+	segment    logSegment
+}
+
+// searcher 编译后的检索条件
+type searcher struct {
+	match     func(plain string) bool
+	literal   string // 可用于索引预过滤的字面子串
+	levelMask uint8
+	context   int
+}
+
+func newSearcher(q *SearchQuery) (*searcher, error) {
+	s := &searcher{context: q.Context}
+	if s.context < 0 {
+		s.context = 0
+	}
+	if s.context > maxSearchContext {
+		s.context = maxSearchContext
+	}
+	for _, level := range q.Levels {
+		bit := levelBit(level)
+		if bit == 0 {
+			return nil, fmt.Errorf("未知的日志级别: %s", level)
+		}
+		s.levelMask |= bit
+	}
+
+	switch {
+	case q.Text == "":
+		s.match = func(string) bool { return true }
+	case q.Regex:
+		expr := q.Text
+		if !q.CaseSensitive {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式无效: %v", err)
+		}
+		s.match = re.MatchString
+	case q.CaseSensitive:
+		text := q.Text
+		s.literal = text
+		s.match = func(plain string) bool { return strings.Contains(plain, text) }
+	default:
+		lower := strings.ToLower(q.Text)
+		s.literal = lower
+		s.match = func(plain string) bool { return strings.Contains(strings.ToLower(plain), lower) }
+	}
+	return s, nil
+}
+
+// matchLine 判断一行是否命中，返回去除颜色后的内容与级别
+func (s *searcher) matchLine(raw string) (string, string, bool) {
+	plain := StripANSI(raw)
+	level := DetectLevel(plain)
+	if s.levelMask != 0 && s.levelMask&levelBit(level) == 0 {
+		return "", "", false
+	}
+	return plain, level, s.match(plain)
+}
+
+// listLogFiles 按检索条件列出日志文件（含轮转段与压缩文件），按日期从新到旧、主控、实例、分段排序
+func (fl *FileLogger) listLogFiles(q *SearchQuery) ([]logFile, error) {
+	endpointFilter := map[int64]bool{}
+	for _, id := range q.EndpointIDs {
+		endpointFilter[id] = true
+	}
+	instanceFilter := map[string]bool{}
+	for _, id := range q.InstanceIDs {
+		instanceFilter[id] = true
+	}
+	from, to := "", ""
+	if !q.From.IsZero() {
+		from = q.From.Format("2006-01-02")
+	}
+	if !q.To.IsZero() {
+		to = q.To.Format("2006-01-02")
+	}
+
+	endpointDirs, err := os.ReadDir(fl.baseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取日志根目录失败: %v", err)
+	}
+
+	var files []logFile
+	for _, epDir := range endpointDirs {
+		if !epDir.IsDir() || !strings.HasPrefix(epDir.Name(), "endpoint_") {
+			continue
+		}
+		endpointID, err := strconv.ParseInt(strings.TrimPrefix(epDir.Name(), "endpoint_"), 10, 64)
+		if err != nil || (len(endpointFilter) > 0 && !endpointFilter[endpointID]) {
+			continue
+		}
+		instanceDirs, err := os.ReadDir(filepath.Join(fl.baseDir, epDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, instDir := range instanceDirs {
+			if !instDir.IsDir() || (len(instanceFilter) > 0 && !instanceFilter[instDir.Name()]) {
+				continue
+			}
+			dir := filepath.Join(fl.baseDir, epDir.Name(), instDir.Name())
+			for _, seg := range listSegments(dir) {
+				if (from != "" && seg.date < from) || (to != "" && seg.date > to) {
+					continue
+				}
+				files = append(files, logFile{endpointID: endpointID, instanceID: instDir.Name(), date: seg.date, path: seg.path, segment: seg})
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].date != files[j].date {
+			return files[i].date > files[j].date
+		}
+		if files[i].endpointID != files[j].endpointID {
+			return files[i].endpointID < files[j].endpointID
+		}
+		if files[i].instanceID != files[j].instanceID {
+			return files[i].instanceID < files[j].instanceID
+		}
+		return files[i].segment.order() < files[j].segment.order()
+	})
+	return files, nil
+}
+
+// skipByIndex 通过索引判断文件是否一定不会命中；当天正在写入的文件不使用索引
+func (s *searcher) skipByIndex(f logFile, today string) bool {
+	if f.segment.isActive(today) || (s.literal == "" && s.levelMask == 0) {
+		return false
+	}
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	idx, err := loadOrBuildIndex(f.path, info)
+	if err != nil {
+		return false
+	}
+	if s.levelMask != 0 && idx.levelMask&s.levelMask == 0 {
+		return true
+	}
+	return s.literal != "" && !idx.mayContain(s.literal)
+}
+
+// scanFile 逐行检索单个文件，按行号顺序回调命中
+func (fl *FileLogger) scanFile(f logFile, s *searcher, emit func(SearchHit) error) error {
+	file, err := openLogFile(f.path)
+	if err != nil {
+		return nil // 文件可能已被清理或正在压缩，忽略
+	}
+	defer file.Close()
+
+	rel, err := filepath.Rel(fl.baseDir, f.path)
+	if err != nil {
+		rel = f.path
+	}
+
+	var before []string // 最近的上下文行
+	var pending []*SearchHit
+	flush := func(all bool) error {
+		for len(pending) > 0 && (all || len(pending[0].After) >= s.context) {
+			if err := emit(*pending[0]); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		plain, level, ok := s.matchLine(raw)
+
+		if s.context > 0 {
+			ctxLine := plain
+			if !ok {
+				ctxLine = StripANSI(raw)
+			}
+			for _, hit := range pending {
+				if len(hit.After) < s.context {
+					hit.After = append(hit.After, ctxLine)
+				}
+			}
+			if err := flush(false); err != nil {
+				return err
+			}
+			if ok {
+				pending = append(pending, &SearchHit{
+					EndpointID: f.endpointID, InstanceID: f.instanceID, Date: f.date, File: rel,
+					Line: lineNo, Level: level, Content: plain,
+					Before: append([]string(nil), before...),
+				})
+			}
+			before = append(before, ctxLine)
+			if len(before) > s.context {
+				before = before[1:]
+			}
+			continue
+		}
+
+		if ok {
+			if err := emit(SearchHit{
+				EndpointID: f.endpointID, InstanceID: f.instanceID, Date: f.date, File: rel,
+				Line: lineNo, Level: level, Content: plain,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(true); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+// walkSearch 依次检索全部文件，回调返回错误时停止
+func (fl *FileLogger) walkSearch(q *SearchQuery, emit func(SearchHit) error) (scanned, skipped int, err error) {
+	s, err := newSearcher(q)
+	if err != nil {
+		return 0, 0, err
+	}
+	files, err := fl.listLogFiles(q)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	today := time.Now().Format("2006-01-02")
+	for _, f := range files {
+		if s.skipByIndex(f, today) {
+			skipped++
+			continue
+		}
+		scanned++
+		if err := fl.scanFile(f, s, emit); err != nil {
+			return scanned, skipped, err
+		}
+	}
+	return scanned, skipped, nil
+}
+
+// Search 分页检索文件日志，Total 为全部命中数
+func (fl *FileLogger) Search(q SearchQuery) (*SearchResult, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchLimit
+	}
+	if q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	result := &SearchResult{Hits: []SearchHit{}, Offset: q.Offset, Limit: q.Limit}
+	scanned, skipped, err := fl.walkSearch(&q, func(hit SearchHit) error {
+		if result.Total >= q.Offset && len(result.Hits) < q.Limit {
+			result.Hits = append(result.Hits, hit)
+		}
+		result.Total++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.FilesScanned, result.FilesSkipped = scanned, skipped
+	return result, nil
+}
+
+// SearchStream 流式检索文件日志，逐条回调命中，回调返回错误时停止并返回该错误；
+// q.Limit 大于 0 时最多返回 Limit 条。返回实际回调的命中数
+func (fl *FileLogger) SearchStream(q SearchQuery, fn func(SearchHit) error) (int, error) {
+	count := 0
+	_, _, err := fl.walkSearch(&q, func(hit SearchHit) error {
+		if q.Limit > 0 && count >= q.Limit {
+			return errStopSearch
+		}
+		if err := fn(hit); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if errors.Is(err, errStopSearch) {
+		err = nil
+	}
+	return count, err
+}
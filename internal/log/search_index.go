@@ -0,0 +1,181 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// 日志文件索引：为已结束写入的日志文件生成旁路 .idx 文件，记录文件中出现过的
+// 三字符片段（哈希到固定大小位图）和日志级别，检索时据此跳过不可能命中的文件。
+// 位图只会产生误报不会漏报，命中后仍逐行匹配。
+const (
+	indexSuffix     = ".idx"
+	indexMagic      = "NPLI1"
+	indexBitsetSize = 8192 // 65536 位
+)
+
+// ansiPattern 匹配终端颜色控制序列
+var ansiPattern = regexp.MustCompile("\x1b\\[[0-9;]*[A-Za-z]")
+
+// logLevels 可识别的日志级别，顺序即级别掩码位
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR", "EVENT", "FATAL"}
+
+// StripANSI 去掉终端颜色控制序列
+func StripANSI(line string) string {
+	if !strings.Contains(line, "\x1b[") {
+		return line
+	}
+	return ansiPattern.ReplaceAllString(line, "")
+}
+
+// DetectLevel 识别日志行的级别（只检查行首附近），无法识别时返回空字符串
+func DetectLevel(plain string) string {
+	head := plain
+	if len(head) > 48 {
+		head = head[:48]
+	}
+	for _, field := range strings.Fields(head) {
+		field = strings.Trim(field, "[]:")
+		for _, level := range logLevels {
+			if strings.EqualFold(field, level) {
+				return level
+			}
+		}
+	}
+	return ""
+}
+
+// levelBit 日志级别对应的掩码位，未知级别返回 0
+func levelBit(level string) uint8 {
+	for i, l := range logLevels {
+		if strings.EqualFold(l, level) {
+			return 1 << uint(i)
+		}
+	}
+	return 0
+}
+
+// IsLogLevel 判断是否为可识别的日志级别（不区分大小写）
+func IsLogLevel(level string) bool {
+	return levelBit(level) != 0
+}
+
+// fileIndex 单个日志文件的索引
+type fileIndex struct {
+	size      int64
+	modTime   int64
+	levelMask uint8
+	bitset    [indexBitsetSize]byte
+}
+
+func trigramBit(tri string) (int, byte) {
+	h := fnv.New32a()
+	h.Write([]byte(tri))
+	pos := h.Sum32() % (indexBitsetSize * 8)
+	return int(pos / 8), byte(1) << (pos % 8)
+}
+
+// addLine 将一行（已去除颜色、转小写）的三字符片段加入位图
+func (idx *fileIndex) addLine(lower string) {
+	for i := 0; i+3 <= len(lower); i++ {
+		b, bit := trigramBit(lower[i : i+3])
+		idx.bitset[b] |= bit
+	}
+}
+
+// mayContain 判断文件是否可能包含子串（不区分大小写），少于三个字节的子串无法判断，视为可能包含
+func (idx *fileIndex) mayContain(substr string) bool {
+	lower := strings.ToLower(substr)
+	for i := 0; i+3 <= len(lower); i++ {
+		b, bit := trigramBit(lower[i : i+3])
+		if idx.bitset[b]&bit == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// buildIndex 扫描日志文件生成索引
+func buildIndex(path string, info os.FileInfo) (*fileIndex, error) {
+	file, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := &fileIndex{size: info.Size(), modTime: info.ModTime().UnixNano()}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		plain := StripANSI(scanner.Text())
+		idx.levelMask |= levelBit(DetectLevel(plain))
+		idx.addLine(strings.ToLower(plain))
+	}
+	return idx, scanner.Err()
+}
+
+// writeIndex 写入索引文件
+func writeIndex(path string, idx *fileIndex) error {
+	var buf bytes.Buffer
+	buf.WriteString(indexMagic)
+	binary.Write(&buf, binary.LittleEndian, idx.size)
+	binary.Write(&buf, binary.LittleEndian, idx.modTime)
+	buf.WriteByte(idx.levelMask)
+	buf.Write(idx.bitset[:])
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readIndex 读取索引文件
+func readIndex(path string) (*fileIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(indexMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != indexMagic {
+		return nil, errors.New("invalid log index")
+	}
+	idx := &fileIndex{}
+	if err := binary.Read(r, binary.LittleEndian, &idx.size); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &idx.modTime); err != nil {
+		return nil, err
+	}
+	if idx.levelMask, err = r.ReadByte(); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, idx.bitset[:]); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// loadOrBuildIndex 获取日志文件的索引；索引与文件大小或修改时间不一致时重建
+func loadOrBuildIndex(logPath string, info os.FileInfo) (*fileIndex, error) {
+	indexPath := logPath + indexSuffix
+	if idx, err := readIndex(indexPath); err == nil && idx.size == info.Size() && idx.modTime == info.ModTime().UnixNano() {
+		return idx, nil
+	}
+	idx, err := buildIndex(logPath, info)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeIndex(indexPath, idx); err != nil {
+		Warnf("写入日志索引失败: %s, err: %v", indexPath, err)
+	}
+	return idx, nil
+}
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileLoggerSearch(t *testing.T) {
+	dir := t.TempDir()
+	today := time.Now().Format("2006-01-02")
+	writeLog := func(endpoint, instance, date string, lines ...string) {
+		p := filepath.Join(dir, endpoint, instance, date+".log")
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLog("endpoint_1", "abc", "2024-01-01",
+		"2024-01-01 10:00:00.000 \x1b[32mINFO\x1b[0m Tunnel started",
+		"2024-01-01 10:00:01.000 \x1b[31mERROR\x1b[0m Dial failed: connection refused",
+		"2024-01-01 10:00:02.000 INFO Retrying")
+	writeLog("endpoint_1", "abc", today,
+		"x INFO Connection refused again")
+	writeLog("endpoint_2", "def", "2024-01-01",
+		"2024-01-01 10:00:00.000 WARN pool exhausted")
+
+	fl := &FileLogger{baseDir: dir}
+
+	tests := []struct {
+		name    string
+		q       SearchQuery
+		want    int
+		skipped int
+	}{
+		{name: "case-insensitive substring", q: SearchQuery{Text: "REFUSED"}, want: 2},
+		{name: "case-sensitive substring", q: SearchQuery{Text: "Connection", CaseSensitive: true}, want: 1},
+		{name: "level filter", q: SearchQuery{Levels: []string{"error", "warn"}}, want: 2},
+		{name: "regex", q: SearchQuery{Text: `dial\s+failed`, Regex: true}, want: 1},
+		{name: "endpoint filter", q: SearchQuery{EndpointIDs: []int64{2}}, want: 1},
+		{name: "date range", q: SearchQuery{From: time.Now()}, want: 1},
+		{name: "index skips files without term", q: SearchQuery{Text: "exhausted"}, want: 1, skipped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := fl.Search(tt.q)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if res.Total != tt.want {
+				t.Errorf("total = %d, want %d (%+v)", res.Total, tt.want, res.Hits)
+			}
+			if tt.skipped > 0 && res.FilesSkipped != tt.skipped {
+				t.Errorf("skipped = %d, want %d", res.FilesSkipped, tt.skipped)
+			}
+		})
+	}
+
+	// 上下文与行号
+	res, err := fl.Search(SearchQuery{Text: "dial failed", Context: 1})
+	if err != nil || len(res.Hits) != 1 {
+		t.Fatalf("context search: %v %+v", err, res)
+	}
+	hit := res.Hits[0]
+	if hit.Line != 2 || hit.Level != "ERROR" || strings.Contains(hit.Content, "\x1b") ||
+		len(hit.Before) != 1 || len(hit.After) != 1 || !strings.HasSuffix(hit.After[0], "Retrying") {
+		t.Errorf("hit = %+v", hit)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "endpoint_1", "abc", "2024-01-01.log"+indexSuffix)); err != nil {
+		t.Errorf("index not written: %v", err)
+	}
+
+	// 分页
+	res, _ = fl.Search(SearchQuery{Limit: 2, Offset: 4})
+	if res.Total != 5 || len(res.Hits) != 1 {
+		t.Errorf("page = total %d hits %d", res.Total, len(res.Hits))
+	}
+
+	// 流式检索限制条数
+	count, err := fl.SearchStream(SearchQuery{Limit: 3}, func(SearchHit) error { return nil })
+	if err != nil || count != 3 {
+		t.Errorf("stream count = %d, err = %v", count, err)
+	}
+}
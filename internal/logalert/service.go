@@ -0,0 +1,500 @@
+package logalert
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultThreshold  = 1
+	defaultWindowSec  = 60
+	defaultSampleSize = 5
+	maxSampleSize     = 50
+	maxWindowHits     = 1000             // 单个窗口最多记录的命中时间点
+	tunnelCacheTTL    = time.Minute      // 隧道信息缓存有效期
+	windowGCInterval  = 10 * time.Minute // 闲置窗口清理间隔
+)
+
+// EventNotifier 告警事件推送回调（通常接到 SSE 隧道订阅推送）
+type EventNotifier func(instanceID string, data interface{})
+
+// Event 推送给前端的日志告警事件
+type Event struct {
+	Type  string           `json:"type"` // 固定为 log_alert
+	Alert *models.LogAlert `json:"alert"`
+}
+
+// AlertFilter 告警记录查询条件
+type AlertFilter struct {
+	RuleID       int64
+	TunnelID     int64
+	EndpointID   int64
+	Acknowledged *bool
+	Page         int
+	PageSize     int
+}
+
+// compiledRule 预编译的告警规则
+type compiledRule struct {
+	rule   models.LogAlertRule
+	re     *regexp.Regexp
+	levels map[string]bool
+	scope  map[int64]bool
+}
+
+// tunnelInfo 隧道信息缓存
+type tunnelInfo struct {
+	id       int64
+	name     string
+	groupIDs []int64
+	loadedAt time.Time
+}
+
+// window 单条规则在单个隧道上的滑动窗口
+type window struct {
+	hits      []time.Time
+	samples   []string
+	lastAlert time.Time
+	lastHit   time.Time
+}
+
+// Service 日志告警服务
+// 接收 SSE 推送的隧道日志，按规则在滑动窗口内计数，达到阈值时记录告警并推送
+type Service struct {
+	db       *gorm.DB
+	mu       sync.Mutex
+	rules    []*compiledRule
+	loaded   bool
+	tunnels  map[string]*tunnelInfo // endpointID:instanceID -> 隧道信息
+	windows  map[string]*window     // ruleID:endpointID:instanceID -> 窗口
+	lastGC   time.Time
+	notifier EventNotifier
+
+	now func() time.Time
+}
+
+// NewService 创建日志告警服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:      db,
+		tunnels: make(map[string]*tunnelInfo),
+		windows: make(map[string]*window),
+		now:     time.Now,
+	}
+}
+
+// SetNotifier 设置事件推送回调
+func (s *Service) SetNotifier(notifier EventNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// compileRule 校验并编译规则
+func compileRule(rule models.LogAlertRule) (*compiledRule, error) {
+	c := &compiledRule{rule: rule, levels: map[string]bool{}, scope: map[int64]bool{}}
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式无效: %v", err)
+		}
+		c.re = re
+	}
+	for _, level := range rule.Levels {
+		if !log.IsLogLevel(level) {
+			return nil, fmt.Errorf("未知的日志级别: %s", level)
+		}
+		c.levels[strings.ToUpper(level)] = true
+	}
+	for _, id := range rule.ScopeIDs {
+		c.scope[id] = true
+	}
+	return c, nil
+}
+
+// matchLine 判断日志行是否命中规则
+func (c *compiledRule) matchLine(plain, level string) bool {
+	if len(c.levels) > 0 && !c.levels[level] {
+		return false
+	}
+	return c.re == nil || c.re.MatchString(plain)
+}
+
+// loadRulesLocked 加载启用的规则，调用方需持有锁
+func (s *Service) loadRulesLocked() {
+	if s.loaded {
+		return
+	}
+	var rules []models.LogAlertRule
+	if err := s.db.Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		log.Errorf("[LogAlert]加载日志告警规则失败: %v", err)
+		return
+	}
+	s.rules = s.rules[:0]
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			log.Warnf("[LogAlert]规则 %d 无效，已忽略: %v", rule.ID, err)
+			continue
+		}
+		s.rules = append(s.rules, c)
+	}
+	s.loaded = true
+}
+
+// invalidate 规则变更后重新加载，并丢弃相关窗口
+func (s *Service) invalidate(ruleID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = false
+	prefix := fmt.Sprintf("%d:", ruleID)
+	for key := range s.windows {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.windows, key)
+		}
+	}
+}
+
+// cachedTunnelLocked 返回未过期的隧道信息缓存，未命中时返回 nil，调用方需持有锁
+func (s *Service) cachedTunnelLocked(endpointID int64, instanceID string, now time.Time) *tunnelInfo {
+	if info, ok := s.tunnels[fmt.Sprintf("%d:%s", endpointID, instanceID)]; ok && now.Sub(info.loadedAt) < tunnelCacheTTL {
+		return info
+	}
+	return nil
+}
+
+// loadTunnel 从数据库读取隧道信息，不持有锁调用，避免 SSE 日志路径上阻塞规则读写
+func (s *Service) loadTunnel(endpointID int64, instanceID string, now time.Time) *tunnelInfo {
+	info := &tunnelInfo{loadedAt: now}
+	var tunnel models.Tunnel
+	err := s.db.Select("id", "name").Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).First(&tunnel).Error
+	if err == nil {
+		info.id, info.name = tunnel.ID, tunnel.Name
+		s.db.Model(&models.TunnelGroup{}).Where("tunnel_id = ?", tunnel.ID).Pluck("group_id", &info.groupIDs)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warnf("[LogAlert]查询隧道 %s 失败: %v", instanceID, err)
+	}
+	return info
+}
+
+// inScope 判断隧道是否在规则作用范围内
+func (c *compiledRule) inScope(endpointID int64, tunnel *tunnelInfo) bool {
+	switch c.rule.ScopeType {
+	case models.LogAlertScopeEndpoint:
+		return c.scope[endpointID]
+	case models.LogAlertScopeTunnel:
+		return tunnel.id != 0 && c.scope[tunnel.id]
+	case models.LogAlertScopeGroup:
+		for _, id := range tunnel.groupIDs {
+			if c.scope[id] {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// OnTunnelLog 处理隧道日志（由 SSE 服务在收到 log 事件时调用）
+func (s *Service) OnTunnelLog(endpointID int64, instanceID, logs string) {
+	type line struct{ plain, level string }
+	var lines []line
+	for _, raw := range strings.Split(logs, "\n") {
+		plain := strings.TrimSpace(log.StripANSI(raw))
+		if plain != "" {
+			lines = append(lines, line{plain, log.DetectLevel(plain)})
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	// 先在锁内匹配规则，隧道信息未缓存时在锁外查询数据库，再回到锁内计数
+	type hit struct {
+		rule    *compiledRule
+		matched []string
+	}
+	s.mu.Lock()
+	s.loadRulesLocked()
+	now := s.now()
+	var hits []hit
+	for _, rule := range s.rules {
+		var matched []string
+		for _, l := range lines {
+			if rule.matchLine(l.plain, l.level) {
+				matched = append(matched, l.plain)
+			}
+		}
+		if len(matched) > 0 {
+			hits = append(hits, hit{rule, matched})
+		}
+	}
+	tunnel := s.cachedTunnelLocked(endpointID, instanceID, now)
+	s.mu.Unlock()
+	if len(hits) == 0 {
+		return
+	}
+	if tunnel == nil {
+		tunnel = s.loadTunnel(endpointID, instanceID, now)
+	}
+
+	s.mu.Lock()
+	s.gcWindowsLocked(now)
+	s.tunnels[fmt.Sprintf("%d:%s", endpointID, instanceID)] = tunnel
+	var fired []*models.LogAlert
+	for _, h := range hits {
+		if !h.rule.inScope(endpointID, tunnel) {
+			continue
+		}
+		if alert := s.recordLocked(h.rule, endpointID, instanceID, h.matched, now); alert != nil {
+			alert.TunnelID, alert.TunnelName = tunnel.id, tunnel.name
+			fired = append(fired, alert)
+		}
+	}
+	notifier := s.notifier
+	s.mu.Unlock()
+
+	for _, alert := range fired {
+		if err := s.db.Create(alert).Error; err != nil {
+			log.Errorf("[LogAlert]保存告警记录失败: %v", err)
+			continue
+		}
+		log.Warnf("[LogAlert]规则 %s 触发告警: 隧道 %s %d 秒内匹配 %d 行", alert.RuleName, instanceID, alert.WindowSec, alert.Count)
+		if notifier != nil {
+			notifier(instanceID, Event{Type: "log_alert", Alert: alert})
+		}
+	}
+}
+
+// recordLocked 将命中行计入窗口，达到阈值且不在冷却期时返回待保存的告警
+func (s *Service) recordLocked(rule *compiledRule, endpointID int64, instanceID string, matched []string, now time.Time) *models.LogAlert {
+	r := rule.rule
+	key := fmt.Sprintf("%d:%d:%s", r.ID, endpointID, instanceID)
+	w, ok := s.windows[key]
+	if !ok {
+		w = &window{}
+		s.windows[key] = w
+	}
+
+	windowSec, threshold, sampleSize := r.WindowSec, r.Threshold, r.SampleSize
+	if windowSec <= 0 {
+		windowSec = defaultWindowSec
+	}
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	if sampleSize <= 0 {
+		sampleSize = defaultSampleSize
+	}
+
+	cutoff := now.Add(-time.Duration(windowSec) * time.Second)
+	keep := 0
+	for keep < len(w.hits) && !w.hits[keep].After(cutoff) {
+		keep++
+	}
+	w.hits = w.hits[keep:]
+	if len(w.hits) == 0 {
+		w.samples = nil
+	}
+	for range matched {
+		w.hits = append(w.hits, now)
+	}
+	if len(w.hits) > maxWindowHits {
+		w.hits = w.hits[len(w.hits)-maxWindowHits:]
+	}
+	w.samples = append(w.samples, matched...)
+	if len(w.samples) > sampleSize {
+		w.samples = w.samples[len(w.samples)-sampleSize:]
+	}
+	w.lastHit = now
+
+	if len(w.hits) < threshold {
+		return nil
+	}
+	if !w.lastAlert.IsZero() && now.Sub(w.lastAlert) < time.Duration(r.CooldownSec)*time.Second {
+		return nil
+	}
+
+	alert := &models.LogAlert{
+		RuleID:     r.ID,
+		RuleName:   r.Name,
+		EndpointID: endpointID,
+		InstanceID: instanceID,
+		Count:      len(w.hits),
+		WindowSec:  windowSec,
+		Samples:    append([]string(nil), w.samples...),
+		CreatedAt:  now,
+	}
+	w.lastAlert = now
+	w.hits, w.samples = nil, nil
+	return alert
+}
+
+// gcWindowsLocked 定期清理闲置窗口与过期隧道缓存，调用方需持有锁
+func (s *Service) gcWindowsLocked(now time.Time) {
+	if now.Sub(s.lastGC) < windowGCInterval {
+		return
+	}
+	s.lastGC = now
+	for key, w := range s.windows {
+		if now.Sub(w.lastHit) > windowGCInterval && now.Sub(w.lastAlert) > windowGCInterval {
+			delete(s.windows, key)
+		}
+	}
+	for key, info := range s.tunnels {
+		if now.Sub(info.loadedAt) >= tunnelCacheTTL {
+			delete(s.tunnels, key)
+		}
+	}
+}
+
+// normalizeRule 校验规则并补齐默认值
+func normalizeRule(rule *models.LogAlertRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return errors.New("规则名称不能为空")
+	}
+	if rule.Pattern == "" && len(rule.Levels) == 0 {
+		return errors.New("匹配表达式与日志级别至少填写一项")
+	}
+	switch rule.ScopeType {
+	case "":
+		rule.ScopeType = models.LogAlertScopeAll
+	case models.LogAlertScopeAll:
+	case models.LogAlertScopeTunnel, models.LogAlertScopeGroup, models.LogAlertScopeEndpoint:
+		if len(rule.ScopeIDs) == 0 {
+			return fmt.Errorf("作用范围 %s 需要指定ID", rule.ScopeType)
+		}
+	default:
+		return fmt.Errorf("无效的作用范围: %s", rule.ScopeType)
+	}
+	if rule.ScopeType == models.LogAlertScopeAll {
+		rule.ScopeIDs = nil
+	}
+	if rule.Threshold <= 0 {
+		rule.Threshold = defaultThreshold
+	}
+	if rule.WindowSec <= 0 {
+		rule.WindowSec = defaultWindowSec
+	}
+	if rule.CooldownSec < 0 {
+		rule.CooldownSec = 0
+	}
+	if rule.SampleSize <= 0 {
+		rule.SampleSize = defaultSampleSize
+	}
+	if rule.SampleSize > maxSampleSize {
+		rule.SampleSize = maxSampleSize
+	}
+	for i, level := range rule.Levels {
+		rule.Levels[i] = strings.ToUpper(strings.TrimSpace(level))
+	}
+	_, err := compileRule(*rule)
+	return err
+}
+
+// ListRules 获取全部告警规则
+func (s *Service) ListRules() ([]models.LogAlertRule, error) {
+	var rules []models.LogAlertRule
+	err := s.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// CreateRule 创建告警规则
+func (s *Service) CreateRule(rule *models.LogAlertRule) error {
+	if err := normalizeRule(rule); err != nil {
+		return err
+	}
+	rule.ID = 0
+	if err := s.db.Create(rule).Error; err != nil {
+		return err
+	}
+	s.invalidate(rule.ID)
+	return nil
+}
+
+// UpdateRule 更新告警规则
+func (s *Service) UpdateRule(rule *models.LogAlertRule) error {
+	if err := normalizeRule(rule); err != nil {
+		return err
+	}
+	var existing models.LogAlertRule
+	if err := s.db.First(&existing, rule.ID).Error; err != nil {
+		return err
+	}
+	rule.CreatedAt = existing.CreatedAt
+	if err := s.db.Model(&existing).Select("*").Omit("id", "created_at").Updates(rule).Error; err != nil {
+		return err
+	}
+	s.invalidate(rule.ID)
+	return nil
+}
+
+// DeleteRule 删除告警规则，已产生的告警记录保留
+func (s *Service) DeleteRule(id int64) error {
+	result := s.db.Delete(&models.LogAlertRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	s.invalidate(id)
+	return nil
+}
+
+// ListAlerts 分页查询告警记录，按时间倒序
+func (s *Service) ListAlerts(filter AlertFilter) ([]models.LogAlert, int64, error) {
+	query := s.db.Model(&models.LogAlert{})
+	if filter.RuleID > 0 {
+		query = query.Where("rule_id = ?", filter.RuleID)
+	}
+	if filter.TunnelID > 0 {
+		query = query.Where("tunnel_id = ?", filter.TunnelID)
+	}
+	if filter.EndpointID > 0 {
+		query = query.Where("endpoint_id = ?", filter.EndpointID)
+	}
+	if filter.Acknowledged != nil {
+		query = query.Where("acknowledged = ?", *filter.Acknowledged)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 || filter.PageSize > 500 {
+		filter.PageSize = 50
+	}
+	alerts := []models.LogAlert{}
+	err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).Limit(filter.PageSize).
+		Find(&alerts).Error
+	return alerts, total, err
+}
+
+// Acknowledge 确认告警；ids 为空时确认全部未确认告警，返回确认数量
+func (s *Service) Acknowledge(ids []int64) (int64, error) {
+	query := s.db.Model(&models.LogAlert{}).Where("acknowledged = ?", false)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	result := query.Updates(map[string]interface{}{
+		"acknowledged":    true,
+		"acknowledged_at": models.NullTime{Time: s.now(), Valid: true},
+	})
+	return result.RowsAffected, result.Error
+}
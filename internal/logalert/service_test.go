@@ -0,0 +1,102 @@
+package logalert
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLogAlertRules(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.Tunnel{}, &models.TunnelGroup{}, &models.LogAlertRule{}, &models.LogAlert{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	instance := "abc"
+	tunnel := models.Tunnel{Name: "web", EndpointID: 1, InstanceID: &instance}
+	if err := db.Create(&tunnel).Error; err != nil {
+		t.Fatalf("seed tunnel: %v", err)
+	}
+
+	s := NewService(db)
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	var events []Event
+	s.SetNotifier(func(instanceID string, data interface{}) { events = append(events, data.(Event)) })
+
+	if err := s.CreateRule(&models.LogAlertRule{Name: "bad", Enabled: true, Pattern: "("}); err == nil {
+		t.Error("expected invalid regex to be rejected")
+	}
+	rule := models.LogAlertRule{Name: "dial", Enabled: true, Pattern: `(?i)dial .*failed`, Levels: []string{"error"},
+		ScopeType: models.LogAlertScopeTunnel, ScopeIDs: []int64{tunnel.ID}, Threshold: 2, WindowSec: 60, CooldownSec: 300, SampleSize: 1}
+	if err := s.CreateRule(&rule); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	// 不在作用范围内的分组规则不应触发
+	if err := s.CreateRule(&models.LogAlertRule{Name: "group", Enabled: true, Levels: []string{"ERROR"},
+		ScopeType: models.LogAlertScopeGroup, ScopeIDs: []int64{99}}); err != nil {
+		t.Fatalf("create group rule: %v", err)
+	}
+
+	errLine := "2024-01-01 10:00:00.000 \x1b[31mERROR\x1b[0m Dial tcp 1.2.3.4 failed"
+	s.OnTunnelLog(1, instance, errLine+"\n2024-01-01 10:00:00.000 INFO dial ok failed")
+	if len(events) != 0 {
+		t.Fatalf("alert fired below threshold: %+v", events)
+	}
+
+	// 超出窗口后重新计数
+	now = now.Add(2 * time.Minute)
+	s.OnTunnelLog(1, instance, errLine)
+	if len(events) != 0 {
+		t.Fatalf("alert fired across windows: %+v", events)
+	}
+	now = now.Add(10 * time.Second)
+	s.OnTunnelLog(1, instance, errLine)
+	if len(events) != 1 {
+		t.Fatalf("events = %d, want 1", len(events))
+	}
+	alert := events[0].Alert
+	if alert.Count != 2 || alert.TunnelID != tunnel.ID || alert.TunnelName != "web" ||
+		len(alert.Samples) != 1 || alert.Samples[0] != "2024-01-01 10:00:00.000 ERROR Dial tcp 1.2.3.4 failed" {
+		t.Errorf("alert = %+v", alert)
+	}
+
+	// 冷却期内不重复告警
+	s.OnTunnelLog(1, instance, errLine+"\n"+errLine)
+	if len(events) != 1 {
+		t.Errorf("alert fired during cooldown")
+	}
+	now = now.Add(6 * time.Minute)
+	s.OnTunnelLog(1, instance, errLine+"\n"+errLine)
+	if len(events) != 2 {
+		t.Errorf("events after cooldown = %d, want 2", len(events))
+	}
+
+	unacked := false
+	alerts, total, err := s.ListAlerts(AlertFilter{Acknowledged: &unacked})
+	if err != nil || total != 2 || len(alerts) != 2 {
+		t.Fatalf("list alerts = %d/%d, err %v", len(alerts), total, err)
+	}
+	if n, err := s.Acknowledge([]int64{alerts[0].ID}); err != nil || n != 1 {
+		t.Errorf("ack = %d, err %v", n, err)
+	}
+	if _, total, _ := s.ListAlerts(AlertFilter{Acknowledged: &unacked}); total != 1 {
+		t.Errorf("unacknowledged = %d, want 1", total)
+	}
+
+	// 停用规则后不再匹配
+	rule.Enabled = false
+	if err := s.UpdateRule(&rule); err != nil {
+		t.Fatalf("update rule: %v", err)
+	}
+	now = now.Add(time.Hour)
+	s.OnTunnelLog(1, instance, errLine+"\n"+errLine)
+	if len(events) != 2 {
+		t.Errorf("disabled rule fired")
+	}
+}
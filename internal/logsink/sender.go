@@ -0,0 +1,297 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/models"
+)
+
+const (
+	dialTimeout    = 5 * time.Second
+	requestTimeout = 10 * time.Second
+	syslogAppName  = "nodepassdash"
+	syslogFacility = 16 // local0
+	syslogSDID     = "tunnel@32473"
+	maxSDNameLen   = 32
+	maxErrorBody   = 512
+)
+
+// sender 单个外发目标的推送实现，只在所属 runner 的协程中调用
+type sender interface {
+	Send(ctx context.Context, entries []Entry) error
+	Close() error
+}
+
+// partialSendError 批次中前 sent 条已送达，重试时只需推送剩余部分
+type partialSendError struct {
+	sent int
+	err  error
+}
+
+func (e *partialSendError) Error() string { return e.err.Error() }
+
+func (e *partialSendError) Unwrap() error { return e.err }
+
+// newSender 按外发目标类型创建推送实现
+func newSender(sink models.LogSink) (sender, error) {
+	u, err := url.Parse(sink.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的地址: %s", sink.URL)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: sink.TLSSkipVerify}
+
+	switch sink.Type {
+	case models.LogSinkSyslog:
+		switch u.Scheme {
+		case "udp", "tcp", "tls":
+		default:
+			return nil, fmt.Errorf("syslog 地址协议应为 udp、tcp 或 tls: %s", u.Scheme)
+		}
+		if u.Port() == "" {
+			return nil, fmt.Errorf("syslog 地址缺少端口: %s", sink.URL)
+		}
+		tlsConfig.ServerName = u.Hostname()
+		hostname, _ := os.Hostname()
+		return &syslogSender{network: u.Scheme, addr: u.Host, tlsConfig: tlsConfig, hostname: hostname}, nil
+	case models.LogSinkLoki, models.LogSinkHTTP:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("地址协议应为 http 或 https: %s", u.Scheme)
+		}
+		h := &httpSender{
+			url:     sink.URL,
+			headers: sink.Headers,
+			loki:    sink.Type == models.LogSinkLoki,
+			client: &http.Client{
+				Timeout:   requestTimeout,
+				Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+			},
+		}
+		return h, nil
+	default:
+		return nil, fmt.Errorf("不支持的外发类型: %s", sink.Type)
+	}
+}
+
+// syslogSender RFC 5424 syslog 推送；UDP 每条一个报文，TCP/TLS 使用 RFC 6587 八位组计数分帧
+type syslogSender struct {
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	hostname  string
+	conn      net.Conn
+}
+
+func (s *syslogSender) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.addr)
+}
+
+func (s *syslogSender) Send(ctx context.Context, entries []Entry) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	deadline := time.Now().Add(requestTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.conn.SetWriteDeadline(deadline)
+
+	// 记录每帧结束位置，写入失败时据此计算已完整送达的条数，避免重试时重复发送
+	var buf bytes.Buffer
+	ends := make([]int, 0, len(entries))
+	for i, e := range entries {
+		msg := formatSyslog(e, s.hostname)
+		if s.network == "udp" {
+			if _, err := s.conn.Write([]byte(msg)); err != nil {
+				s.Close()
+				return &partialSendError{sent: i, err: err}
+			}
+			continue
+		}
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+		ends = append(ends, buf.Len())
+	}
+	if buf.Len() > 0 {
+		if n, err := s.conn.Write(buf.Bytes()); err != nil {
+			s.Close()
+			sent := 0
+			for sent < len(ends) && ends[sent] <= n {
+				sent++
+			}
+			return &partialSendError{sent: sent, err: err}
+		}
+	}
+	return nil
+}
+
+func (s *syslogSender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogSeverity 日志级别对应的 syslog 严重程度
+func syslogSeverity(level string) int {
+	switch level {
+	case "FATAL":
+		return 2
+	case "ERROR":
+		return 3
+	case "WARN":
+		return 4
+	case "EVENT":
+		return 5
+	case "DEBUG":
+		return 7
+	default:
+		return 6
+	}
+}
+
+// sdNamePattern 结构化数据参数名中不允许出现的字符
+var sdNamePattern = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// formatSyslog 生成 RFC 5424 消息，标签放入结构化数据
+func formatSyslog(e Entry, hostname string) string {
+	if hostname == "" {
+		hostname = "-"
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	for _, k := range sortedKeys(e.Labels) {
+		name := sdNamePattern.ReplaceAllString(k, "_")
+		if len(name) > maxSDNameLen {
+			name = name[:maxSDNameLen]
+		}
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(e.Labels[k])
+		fmt.Fprintf(&sd, ` %s="%s"`, name, v)
+	}
+	sd.WriteString("]")
+
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		syslogFacility*8+syslogSeverity(e.Level),
+		e.Time.Format(time.RFC3339Nano), hostname, syslogAppName, "tunnel", sd.String(), e.Line)
+}
+
+// httpSender Loki 推送接口与通用 HTTP JSON 推送
+type httpSender struct {
+	url     string
+	headers map[string]string
+	loki    bool
+	client  *http.Client
+}
+
+// lokiStream Loki 推送接口中的单个日志流
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiLabelPattern Loki 标签名中不允许出现的字符
+var lokiLabelPattern = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// lokiPayload 按标签集合分组生成 Loki 推送内容
+func lokiPayload(entries []Entry) map[string][]*lokiStream {
+	streams := map[string]*lokiStream{}
+	var order []string
+	for _, e := range entries {
+		labels := make(map[string]string, len(e.Labels)+1)
+		for k, v := range e.Labels {
+			name := lokiLabelPattern.ReplaceAllString(k, "_")
+			if name == "" || (name[0] >= '0' && name[0] <= '9') {
+				name = "_" + name
+			}
+			labels[name] = v
+		}
+		if e.Level != "" {
+			labels["level"] = strings.ToLower(e.Level)
+		}
+		var key strings.Builder
+		for _, k := range sortedKeys(labels) {
+			key.WriteString(k + "=" + labels[k] + "\x00")
+		}
+		stream, ok := streams[key.String()]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key.String()] = stream
+			order = append(order, key.String())
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+	result := make([]*lokiStream, 0, len(order))
+	for _, key := range order {
+		result = append(result, streams[key])
+	}
+	return map[string][]*lokiStream{"streams": result}
+}
+
+func (h *httpSender) Send(ctx context.Context, entries []Entry) error {
+	var payload interface{} = entries
+	if h.loki {
+		payload = lokiPayload(entries)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (h *httpSender) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,508 @@
+package logsink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBufferSize    = 1000
+	defaultBatchSize     = 100
+	defaultFlushInterval = 2
+	maxBufferSize        = 100000
+	maxRetryBackoff      = 30 * time.Second
+	labelCacheTTL        = time.Minute
+)
+
+// Entry 外发的单条隧道日志
+type Entry struct {
+	Time       time.Time         `json:"time"`
+	EndpointID int64             `json:"endpointId"`
+	InstanceID string            `json:"instanceId"`
+	Level      string            `json:"level,omitempty"`
+	Line       string            `json:"line"` // 去除颜色控制符后的日志内容
+	Labels     map[string]string `json:"labels"`
+}
+
+// SinkStats 单个外发目标的推送统计
+type SinkStats struct {
+	Sent          int64      `json:"sent"`    // 已成功推送的条数
+	Failed        int64      `json:"failed"`  // 重试耗尽后放弃的条数
+	Dropped       int64      `json:"dropped"` // 缓冲已满被丢弃的条数
+	Retries       int64      `json:"retries"` // 重试次数
+	Queued        int        `json:"queued"`  // 当前缓冲中的条数
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+}
+
+// MaskedHeaderValue 返回给前端的请求头掩码，更新时原样回传表示保留原值
+const MaskedHeaderValue = "******"
+
+// MaskHeaders 返回值被隐藏的请求头副本，请求头中通常包含认证令牌
+func MaskHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(headers))
+	for k := range headers {
+		masked[k] = MaskedHeaderValue
+	}
+	return masked
+}
+
+// SinkItem 外发目标及其推送统计
+type SinkItem struct {
+	models.LogSink
+	Stats *SinkStats `json:"stats,omitempty"` // 未启用时为空
+}
+
+// runner 单个外发目标的缓冲队列与推送协程
+type runner struct {
+	sink   models.LogSink
+	out    sender
+	queue  chan Entry
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	stats SinkStats
+}
+
+func newRunner(sink models.LogSink, out sender) *runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &runner{
+		sink:   sink,
+		out:    out,
+		queue:  make(chan Entry, sink.BufferSize),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// enqueue 放入缓冲队列，队列已满时丢弃
+func (r *runner) enqueue(e Entry) {
+	select {
+	case r.queue <- e:
+	default:
+		r.mu.Lock()
+		r.stats.Dropped++
+		r.mu.Unlock()
+	}
+}
+
+// loop 按批次或间隔推送，停止时推送剩余日志
+func (r *runner) loop() {
+	defer close(r.done)
+	defer r.out.Close()
+
+	ticker := time.NewTicker(time.Duration(r.sink.FlushIntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]Entry, 0, r.sink.BatchSize)
+	for {
+		select {
+		case e := <-r.queue:
+			batch = append(batch, e)
+			if len(batch) >= r.sink.BatchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-r.ctx.Done():
+		drain:
+			for {
+				select {
+				case e := <-r.queue:
+					batch = append(batch, e)
+				default:
+					break drain
+				}
+			}
+			if len(batch) > 0 {
+				// 停止时只尝试一次，避免阻塞关闭
+				ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+				batch, err := r.send(ctx, batch)
+				r.record(len(batch), err, true)
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// flush 推送一批日志，失败时按指数退避重试
+func (r *runner) flush(batch []Entry) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(r.ctx, requestTimeout)
+		var err error
+		batch, err = r.send(ctx, batch)
+		cancel()
+		final := err == nil || attempt >= r.sink.MaxRetries || r.ctx.Err() != nil
+		r.record(len(batch), err, final)
+		if final {
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-r.ctx.Done():
+			r.record(len(batch), r.ctx.Err(), true)
+			return
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// send 推送一批日志，返回未送达的部分；部分送达时先计入已发送
+func (r *runner) send(ctx context.Context, batch []Entry) ([]Entry, error) {
+	err := r.out.Send(ctx, batch)
+	var partial *partialSendError
+	if errors.As(err, &partial) && partial.sent > 0 {
+		r.record(partial.sent, nil, false)
+		batch = batch[partial.sent:]
+	}
+	return batch, err
+}
+
+// record 记录一次推送结果
+func (r *runner) record(count int, err error, final bool) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err == nil:
+		r.stats.Sent += int64(count)
+		r.stats.LastSuccessAt = &now
+	case final:
+		r.stats.Failed += int64(count)
+		r.stats.LastError, r.stats.LastErrorAt = err.Error(), &now
+		log.Warnf("[LogSink]外发目标 %s 推送 %d 条日志失败: %v", r.sink.Name, count, err)
+	default:
+		r.stats.Retries++
+		r.stats.LastError, r.stats.LastErrorAt = err.Error(), &now
+	}
+}
+
+// snapshot 获取统计快照
+func (r *runner) snapshot() *SinkStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.Queued = len(r.queue)
+	return &stats
+}
+
+// stop 停止推送协程并等待剩余日志推送完成
+func (r *runner) stop() {
+	r.cancel()
+	<-r.done
+}
+
+// tunnelLabels 隧道标签缓存
+type tunnelLabels struct {
+	labels   map[string]string
+	loadedAt time.Time
+}
+
+// Service 隧道日志外发服务
+// 接收 SSE 推送的隧道日志，附加隧道标签后放入各外发目标的缓冲队列
+type Service struct {
+	db      *gorm.DB
+	mu      sync.RWMutex
+	runners map[int64]*runner
+
+	labelMu sync.Mutex
+	labels  map[string]*tunnelLabels // endpointID:instanceID -> 标签
+}
+
+// NewService 创建日志外发服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:      db,
+		runners: make(map[int64]*runner),
+		labels:  make(map[string]*tunnelLabels),
+	}
+}
+
+// Start 启动全部已启用的外发目标
+func (s *Service) Start() {
+	var sinks []models.LogSink
+	if err := s.db.Where("enabled = ?", true).Find(&sinks).Error; err != nil {
+		log.Errorf("[LogSink]加载日志外发目标失败: %v", err)
+		return
+	}
+	started := 0
+	for _, sink := range sinks {
+		if err := s.startSink(sink); err != nil {
+			log.Warnf("[LogSink]外发目标 %s 启动失败: %v", sink.Name, err)
+			continue
+		}
+		started++
+	}
+	if started > 0 {
+		log.Infof("[LogSink]已启动 %d 个日志外发目标", started)
+	}
+}
+
+// Close 停止全部外发目标
+func (s *Service) Close() {
+	s.mu.Lock()
+	runners := s.runners
+	s.runners = make(map[int64]*runner)
+	s.mu.Unlock()
+	for _, r := range runners {
+		r.stop()
+	}
+}
+
+// startSink 启动单个外发目标，已在运行时先停止
+func (s *Service) startSink(sink models.LogSink) error {
+	applyDefaults(&sink)
+	out, err := newSender(sink)
+	if err != nil {
+		return err
+	}
+	s.stopSink(sink.ID)
+	s.mu.Lock()
+	s.runners[sink.ID] = newRunner(sink, out)
+	s.mu.Unlock()
+	return nil
+}
+
+// stopSink 停止单个外发目标
+func (s *Service) stopSink(id int64) {
+	s.mu.Lock()
+	r, ok := s.runners[id]
+	delete(s.runners, id)
+	s.mu.Unlock()
+	if ok {
+		r.stop()
+	}
+}
+
+// OnTunnelLog 处理隧道日志（由 SSE 服务在收到 log 事件时调用）
+func (s *Service) OnTunnelLog(endpointID int64, instanceID, logs string) {
+	s.mu.RLock()
+	idle := len(s.runners) == 0
+	s.mu.RUnlock()
+	if idle {
+		return
+	}
+
+	// 标签查询可能访问数据库，在锁外进行，避免阻塞外发目标的增删改
+	labels := s.tunnelLabels(endpointID, instanceID)
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, raw := range strings.Split(logs, "\n") {
+		line := strings.TrimRight(log.StripANSI(raw), "\r ")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		level := log.DetectLevel(line)
+		for _, r := range s.runners {
+			e := Entry{Time: now, EndpointID: endpointID, InstanceID: instanceID, Level: level, Line: line, Labels: labels}
+			if len(r.sink.Labels) > 0 {
+				e.Labels = make(map[string]string, len(labels)+len(r.sink.Labels))
+				for k, v := range r.sink.Labels {
+					e.Labels[k] = v
+				}
+				for k, v := range labels {
+					e.Labels[k] = v
+				}
+			}
+			r.enqueue(e)
+		}
+	}
+}
+
+// tunnelLabels 获取隧道标签（带缓存）：endpoint、instance、tunnel、group 以及 tag_ 前缀的隧道标签
+// 返回的 map 会被多条日志共享，不可修改
+func (s *Service) tunnelLabels(endpointID int64, instanceID string) map[string]string {
+	key := fmt.Sprintf("%d:%s", endpointID, instanceID)
+	now := time.Now()
+	s.labelMu.Lock()
+	if cached, ok := s.labels[key]; ok && now.Sub(cached.loadedAt) < labelCacheTTL {
+		s.labelMu.Unlock()
+		return cached.labels
+	}
+	s.labelMu.Unlock()
+
+	labels := map[string]string{
+		"endpoint": strconv.FormatInt(endpointID, 10),
+		"instance": instanceID,
+	}
+	var tunnel models.Tunnel
+	err := s.db.Select("id", "name", "tags").Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).First(&tunnel).Error
+	if err == nil {
+		labels["tunnel"] = tunnel.Name
+		var groups []string
+		s.db.Table("groups").
+			Joins("JOIN tunnel_groups ON tunnel_groups.group_id = groups.id").
+			Where("tunnel_groups.tunnel_id = ?", tunnel.ID).
+			Order("groups.name").Pluck("groups.name", &groups)
+		if len(groups) > 0 {
+			labels["group"] = strings.Join(groups, ",")
+		}
+		if tunnel.Tags != nil {
+			for k, v := range *tunnel.Tags {
+				labels["tag_"+k] = v
+			}
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Warnf("[LogSink]查询隧道 %s 失败: %v", instanceID, err)
+	}
+
+	// 顺带清理过期缓存
+	s.labelMu.Lock()
+	defer s.labelMu.Unlock()
+	for k, cached := range s.labels {
+		if now.Sub(cached.loadedAt) >= labelCacheTTL {
+			delete(s.labels, k)
+		}
+	}
+	s.labels[key] = &tunnelLabels{labels: labels, loadedAt: now}
+	return labels
+}
+
+// applyDefaults 补齐缓冲与重试参数
+func applyDefaults(sink *models.LogSink) {
+	if sink.BufferSize <= 0 {
+		sink.BufferSize = defaultBufferSize
+	}
+	if sink.BufferSize > maxBufferSize {
+		sink.BufferSize = maxBufferSize
+	}
+	if sink.BatchSize <= 0 {
+		sink.BatchSize = defaultBatchSize
+	}
+	if sink.FlushIntervalSec <= 0 {
+		sink.FlushIntervalSec = defaultFlushInterval
+	}
+	if sink.MaxRetries < 0 {
+		sink.MaxRetries = 0
+	}
+}
+
+// normalizeSink 校验外发目标配置
+func normalizeSink(sink *models.LogSink) error {
+	sink.Name = strings.TrimSpace(sink.Name)
+	sink.URL = strings.TrimSpace(sink.URL)
+	if sink.Name == "" {
+		return errors.New("名称不能为空")
+	}
+	applyDefaults(sink)
+	out, err := newSender(*sink)
+	if err != nil {
+		return err
+	}
+	out.Close()
+	return nil
+}
+
+// ListSinks 获取全部外发目标及运行统计
+func (s *Service) ListSinks() ([]SinkItem, error) {
+	var sinks []models.LogSink
+	if err := s.db.Order("id").Find(&sinks).Error; err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]SinkItem, 0, len(sinks))
+	for _, sink := range sinks {
+		sink.Headers = MaskHeaders(sink.Headers)
+		item := SinkItem{LogSink: sink}
+		if r, ok := s.runners[sink.ID]; ok {
+			item.Stats = r.snapshot()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Stats 获取运行中外发目标的统计，按 ID 索引
+func (s *Service) Stats() map[int64]*SinkStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := make(map[int64]*SinkStats, len(s.runners))
+	for id, r := range s.runners {
+		stats[id] = r.snapshot()
+	}
+	return stats
+}
+
+// CreateSink 创建外发目标，启用时立即开始推送
+func (s *Service) CreateSink(sink *models.LogSink) error {
+	if err := normalizeSink(sink); err != nil {
+		return err
+	}
+	sink.ID = 0
+	if err := s.db.Create(sink).Error; err != nil {
+		return err
+	}
+	if sink.Enabled {
+		return s.startSink(*sink)
+	}
+	return nil
+}
+
+// UpdateSink 更新外发目标并按新配置重启推送（统计清零）
+func (s *Service) UpdateSink(sink *models.LogSink) error {
+	if err := normalizeSink(sink); err != nil {
+		return err
+	}
+	var existing models.LogSink
+	if err := s.db.First(&existing, sink.ID).Error; err != nil {
+		return err
+	}
+	sink.CreatedAt = existing.CreatedAt
+	// 前端回传的掩码值表示未修改，沿用原值
+	for k, v := range sink.Headers {
+		if old, ok := existing.Headers[k]; ok && v == MaskedHeaderValue {
+			sink.Headers[k] = old
+		}
+	}
+	if err := s.db.Model(&existing).Select("*").Omit("id", "created_at").Updates(sink).Error; err != nil {
+		return err
+	}
+	if !sink.Enabled {
+		s.stopSink(sink.ID)
+		return nil
+	}
+	return s.startSink(*sink)
+}
+
+// DeleteSink 删除外发目标
+func (s *Service) DeleteSink(id int64) error {
+	result := s.db.Delete(&models.LogSink{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	s.stopSink(id)
+	return nil
+}
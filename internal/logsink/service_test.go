@@ -0,0 +1,143 @@
+package logsink
+
+import (
+	"NodePassDash/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFormatSyslog(t *testing.T) {
+	e := Entry{
+		Time:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:  "ERROR",
+		Line:   "dial failed",
+		Labels: map[string]string{"tunnel": `a"b]`, "tag_env name": "prod"},
+	}
+	want := `<131>1 2024-01-02T03:04:05Z host nodepassdash - tunnel [tunnel@32473 tag_env_name="prod" tunnel="a\"b\]"] dial failed`
+	if got := formatSyslog(e, "host"); got != want {
+		t.Errorf("formatSyslog =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestServiceShipsToLoki(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.Tunnel{}, &models.TunnelGroup{}, &models.LogSink{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	instance := "abc"
+	tags := map[string]string{"env": "prod"}
+	tunnel := models.Tunnel{Name: "web", EndpointID: 1, InstanceID: &instance, Tags: &tags}
+	group := models.Group{Name: "edge"}
+	db.Create(&tunnel)
+	db.Create(&group)
+	db.Create(&models.TunnelGroup{TunnelID: tunnel.ID, GroupID: group.ID})
+
+	var mu sync.Mutex
+	var requests int
+	var pushed map[string][]*lokiStream
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // 首次失败，触发重试
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&pushed)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := NewService(db)
+	defer s.Close()
+	sink := models.LogSink{Name: "loki", Type: models.LogSinkLoki, Enabled: true, URL: server.URL, BatchSize: 2, MaxRetries: 2,
+		Labels: map[string]string{"job": "nodepass"}}
+	if err := s.CreateSink(&sink); err != nil {
+		t.Fatalf("create sink: %v", err)
+	}
+	if err := s.CreateSink(&models.LogSink{Name: "bad", Type: models.LogSinkSyslog, URL: "http://x:1"}); err == nil {
+		t.Error("expected invalid syslog scheme to be rejected")
+	}
+
+	s.OnTunnelLog(1, instance, "\x1b[31mERROR\x1b[0m dial failed\nINFO retrying\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	var stats *SinkStats
+	for time.Now().Before(deadline) {
+		if stats = s.Stats()[sink.ID]; stats != nil && stats.Sent == 2 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if stats == nil || stats.Sent != 2 || stats.Retries != 1 || stats.Failed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	streams := pushed["streams"]
+	if len(streams) != 2 {
+		t.Fatalf("streams = %d, want 2 (one per level)", len(streams))
+	}
+	labels := streams[0].Stream
+	if labels["tunnel"] != "web" || labels["group"] != "edge" || labels["tag_env"] != "prod" ||
+		labels["endpoint"] != "1" || labels["instance"] != instance || labels["job"] != "nodepass" || labels["level"] != "error" {
+		t.Errorf("labels = %+v", labels)
+	}
+	if streams[0].Values[0][1] != "ERROR dial failed" {
+		t.Errorf("line = %q", streams[0].Values[0][1])
+	}
+}
+
+// shortConn 只接受 limit 字节后返回错误的连接
+type shortConn struct {
+	net.Conn
+	limit int
+	data  []byte
+}
+
+func (c *shortConn) Write(p []byte) (int, error) {
+	if len(p) > c.limit {
+		c.data = append(c.data, p[:c.limit]...)
+		return c.limit, errors.New("broken pipe")
+	}
+	c.data = append(c.data, p...)
+	return len(p), nil
+}
+
+func (c *shortConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *shortConn) Close() error { return nil }
+
+func TestSyslogPartialSend(t *testing.T) {
+	entries := []Entry{{Line: "a"}, {Line: "b"}, {Line: "c"}}
+	frame := len(formatSyslog(entries[0], "h"))
+	frameLen := len(strconv.Itoa(frame)) + 1 + frame
+
+	// 第一帧完整写入、第二帧写到一半时连接断开
+	conn := &shortConn{limit: frameLen + 3}
+	s := &syslogSender{network: "tcp", hostname: "h", conn: conn}
+	err := s.Send(context.Background(), entries)
+	var partial *partialSendError
+	if !errors.As(err, &partial) || partial.sent != 1 {
+		t.Fatalf("err = %v, want partial with 1 sent", err)
+	}
+
+	if got := MaskHeaders(map[string]string{"Authorization": "Bearer secret"}); got["Authorization"] != MaskedHeaderValue {
+		t.Errorf("masked headers = %v", got)
+	}
+}
@@ -0,0 +1,251 @@
+package metricpush
+
+import (
+	"NodePassDash/internal/models"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// collectLimit 单次读取的 service_history 记录数上限
+const collectLimit = 5000
+
+// tunnelInfo 生成标签所需的隧道信息
+type tunnelInfo struct {
+	ID         int64
+	Name       string
+	Type       string
+	EndpointID int64
+	InstanceID string
+	Tags       *map[string]string `gorm:"serializer:json"`
+}
+
+// labeler 为 service_history 记录生成标签，每轮采集查询一次隧道与分组
+type labeler struct {
+	tunnels   map[string]*tunnelInfo // endpointID:instanceID -> 隧道
+	endpoints map[int64]string
+	groups    map[int64]string // 隧道 ID -> 分组名（逗号连接）
+}
+
+func newLabeler(db *gorm.DB) (*labeler, error) {
+	l := &labeler{
+		tunnels:   make(map[string]*tunnelInfo),
+		endpoints: make(map[int64]string),
+		groups:    make(map[int64]string),
+	}
+
+	var endpoints []models.Endpoint
+	if err := db.Select("id", "name").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		l.endpoints[ep.ID] = ep.Name
+	}
+
+	var tunnels []tunnelInfo
+	err := db.Table("tunnels").
+		Select("id, name, type, endpoint_id, COALESCE(instance_id, '') AS instance_id, tags").
+		Find(&tunnels).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range tunnels {
+		t := &tunnels[i]
+		l.tunnels[fmt.Sprintf("%d:%s", t.EndpointID, t.InstanceID)] = t
+	}
+
+	var rows []struct {
+		TunnelID int64
+		Name     string
+	}
+	err = db.Table("tunnel_groups").
+		Select("tunnel_groups.tunnel_id, groups.name").
+		Joins("JOIN groups ON groups.id = tunnel_groups.group_id").
+		Order("groups.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if l.groups[row.TunnelID] != "" {
+			l.groups[row.TunnelID] += ","
+		}
+		l.groups[row.TunnelID] += row.Name
+	}
+	return l, nil
+}
+
+// endpointTags 端点标签
+func (l *labeler) endpointTags(endpointID int64) map[string]string {
+	return map[string]string{
+		"endpoint":    l.endpoints[endpointID],
+		"endpoint_id": strconv.FormatInt(endpointID, 10),
+	}
+}
+
+// tunnelTags 隧道标签：endpoint、tunnel、instance、type、group 以及 tag_ 前缀的隧道标签
+func (l *labeler) tunnelTags(endpointID int64, instanceID string) map[string]string {
+	tags := l.endpointTags(endpointID)
+	tags["instance"] = instanceID
+	t, ok := l.tunnels[fmt.Sprintf("%d:%s", endpointID, instanceID)]
+	if !ok {
+		return tags
+	}
+	tags["tunnel"] = t.Name
+	tags["tunnel_id"] = strconv.FormatInt(t.ID, 10)
+	tags["type"] = t.Type
+	tags["group"] = l.groups[t.ID]
+	if t.Tags != nil {
+		for k, v := range *t.Tags {
+			tags["tag_"+k] = v
+		}
+	}
+	return tags
+}
+
+// tunnelPoint service_history 记录对应的隧道数据点
+// delta_* 列保存的是聚合窗口末尾的累计值，按计数器输出
+func tunnelPoint(h *models.ServiceHistory, tags map[string]string) point {
+	return point{
+		measurement: "tunnel",
+		tags:        tags,
+		time:        h.RecordTime,
+		fields: []field{
+			{name: "tcp_in_bytes", value: float64(h.DeltaTCPIn), integer: true, kind: kindCounter},
+			{name: "tcp_out_bytes", value: float64(h.DeltaTCPOut), integer: true, kind: kindCounter},
+			{name: "udp_in_bytes", value: float64(h.DeltaUDPIn), integer: true, kind: kindCounter},
+			{name: "udp_out_bytes", value: float64(h.DeltaUDPOut), integer: true, kind: kindCounter},
+			{name: "ping_ms", value: h.AvgPing},
+			{name: "pool", value: float64(h.AvgPool), integer: true},
+			{name: "tcps", value: float64(h.AvgTCPs), integer: true},
+			{name: "udps", value: float64(h.AvgUDPs), integer: true},
+			{name: "speed_in_bytes_per_second", value: h.AvgSpeedIn},
+			{name: "speed_out_bytes_per_second", value: h.AvgSpeedOut},
+		},
+	}
+}
+
+// endpointAggregate 同一端点同一分钟内各隧道记录的汇总
+type endpointAggregate struct {
+	endpointID int64
+	time       time.Time
+	tunnels    int64
+	pingSum    float64
+	pool       int64
+	tcps       int64
+	udps       int64
+	speedIn    float64
+	speedOut   float64
+}
+
+func (a *endpointAggregate) point(tags map[string]string) point {
+	avgPing := 0.0
+	if a.tunnels > 0 {
+		avgPing = a.pingSum / float64(a.tunnels)
+	}
+	return point{
+		measurement: "endpoint",
+		tags:        tags,
+		time:        a.time,
+		fields: []field{
+			{name: "tunnels", value: float64(a.tunnels), integer: true},
+			{name: "ping_ms", value: avgPing},
+			{name: "pool", value: float64(a.pool), integer: true},
+			{name: "tcps", value: float64(a.tcps), integer: true},
+			{name: "udps", value: float64(a.udps), integer: true},
+			{name: "speed_in_bytes_per_second", value: a.speedIn},
+			{name: "speed_out_bytes_per_second", value: a.speedOut},
+		},
+	}
+}
+
+// tunnelPoints 将 service_history 记录转换为隧道数据点
+func tunnelPoints(histories []models.ServiceHistory, l *labeler) []point {
+	points := make([]point, 0, len(histories))
+	for i := range histories {
+		h := &histories[i]
+		points = append(points, tunnelPoint(h, l.tunnelTags(h.EndpointID, h.InstanceID)))
+	}
+	return points
+}
+
+// endpointPoints 按端点与分钟汇总 service_history 记录
+func endpointPoints(histories []models.ServiceHistory, l *labeler) []point {
+	aggregates := make(map[string]*endpointAggregate)
+	var keys []string
+	for i := range histories {
+		h := &histories[i]
+		key := fmt.Sprintf("%d:%d", h.EndpointID, h.RecordTime.Unix())
+		a, ok := aggregates[key]
+		if !ok {
+			a = &endpointAggregate{endpointID: h.EndpointID, time: h.RecordTime}
+			aggregates[key] = a
+			keys = append(keys, key)
+		}
+		a.tunnels++
+		a.pingSum += h.AvgPing
+		a.pool += h.AvgPool
+		a.tcps += h.AvgTCPs
+		a.udps += h.AvgUDPs
+		a.speedIn += h.AvgSpeedIn
+		a.speedOut += h.AvgSpeedOut
+	}
+	sort.Strings(keys)
+	points := make([]point, 0, len(keys))
+	for _, key := range keys {
+		a := aggregates[key]
+		points = append(points, a.point(l.endpointTags(a.endpointID)))
+	}
+	return points
+}
+
+// collectTunnels 读取 ID 大于 afterID 的 service_history 记录，返回隧道数据点与最后一条记录的 ID
+func collectTunnels(db *gorm.DB, afterID int64) ([]point, int64, error) {
+	var histories []models.ServiceHistory
+	if err := db.Where("id > ?", afterID).Order("id").Limit(collectLimit).Find(&histories).Error; err != nil {
+		return nil, afterID, err
+	}
+	if len(histories) == 0 {
+		return nil, afterID, nil
+	}
+	l, err := newLabeler(db)
+	if err != nil {
+		return nil, afterID, err
+	}
+	return tunnelPoints(histories, l), histories[len(histories)-1].ID, nil
+}
+
+// collectEndpoints 汇总 [from, to) 内各分钟的端点数据点
+// 调用方需保证 to 之前的分钟已写入完成，避免同一分钟被拆成两个同时间戳的数据点
+func collectEndpoints(db *gorm.DB, from, to time.Time) ([]point, error) {
+	if !from.Before(to) {
+		return nil, nil
+	}
+	var histories []models.ServiceHistory
+	err := db.Select("endpoint_id", "record_time", "avg_ping", "avg_pool", "avg_tcps", "avg_udps", "avg_speed_in", "avg_speed_out").
+		Where("record_time >= ? AND record_time < ?", from, to).
+		Find(&histories).Error
+	if err != nil || len(histories) == 0 {
+		return nil, err
+	}
+	l, err := newLabeler(db)
+	if err != nil {
+		return nil, err
+	}
+	return endpointPoints(histories, l), nil
+}
+
+// latestHistoryID 当前 service_history 的最大 ID
+func latestHistoryID(db *gorm.DB) (int64, error) {
+	var id *int64
+	if err := db.Model(&models.ServiceHistory{}).Select("MAX(id)").Scan(&id).Error; err != nil {
+		return 0, err
+	}
+	if id == nil {
+		return 0, nil
+	}
+	return *id, nil
+}
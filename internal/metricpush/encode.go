@@ -0,0 +1,197 @@
+package metricpush
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fieldKind 数据点字段类型
+type fieldKind int
+
+const (
+	kindGauge   fieldKind = iota // 瞬时值
+	kindCounter                  // 单调递增的累计值
+)
+
+// field 数据点字段
+type field struct {
+	name    string
+	value   float64
+	integer bool
+	kind    fieldKind
+}
+
+// point 一个时间点上的隧道或端点测量值
+type point struct {
+	measurement string            // tunnel 或 endpoint
+	tags        map[string]string // 源标签，推送前按目标配置映射
+	fields      []field
+	time        time.Time
+}
+
+// tagSet 按目标配置映射标签：TagMapping 中映射为空的标签被丢弃，ExtraTags 覆盖同名标签
+func tagSet(tags, mapping, extra map[string]string) map[string]string {
+	out := make(map[string]string, len(tags)+len(extra))
+	for k, v := range tags {
+		if mapped, ok := mapping[k]; ok {
+			if mapped == "" {
+				continue
+			}
+			k = mapped
+		}
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// encodeInflux 编码为 InfluxDB 行协议，时间精度为纳秒
+// 行协议不允许空标签值，空值标签被省略
+func encodeInflux(points []point, mapping, extra map[string]string) []byte {
+	var b strings.Builder
+	for _, p := range points {
+		b.WriteString(influxMeasurementEscaper.Replace("nodepass_" + p.measurement))
+		tags := tagSet(p.tags, mapping, extra)
+		for _, k := range sortedKeys(tags) {
+			if tags[k] == "" {
+				continue
+			}
+			b.WriteString("," + influxTagEscaper.Replace(k) + "=" + influxTagEscaper.Replace(tags[k]))
+		}
+		for i, f := range p.fields {
+			if i == 0 {
+				b.WriteByte(' ')
+			} else {
+				b.WriteByte(',')
+			}
+			b.WriteString(influxTagEscaper.Replace(f.name) + "=")
+			if f.integer {
+				b.WriteString(strconv.FormatInt(int64(f.value), 10) + "i")
+			} else {
+				b.WriteString(strconv.FormatFloat(f.value, 'g', -1, 64))
+			}
+		}
+		b.WriteString(" " + strconv.FormatInt(p.time.UnixNano(), 10) + "\n")
+	}
+	return []byte(b.String())
+}
+
+// OTLP/HTTP JSON 结构，字段名遵循 protobuf JSON 映射
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpMetric struct {
+		Name  string     `json:"name"`
+		Gauge *otlpGauge `json:"gauge,omitempty"`
+		Sum   *otlpSum   `json:"sum,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"` // 2 = CUMULATIVE
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+	otlpDataPoint struct {
+		Attributes   []otlpAttribute `json:"attributes"`
+		TimeUnixNano string          `json:"timeUnixNano"`
+		AsInt        *string         `json:"asInt,omitempty"`
+		AsDouble     *float64        `json:"asDouble,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string        `json:"key"`
+		Value otlpAnyString `json:"value"`
+	}
+	otlpAnyString struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+const otlpAggregationCumulative = 2
+
+// encodeOTLP 编码为 OTLP/HTTP JSON 请求，每个字段对应一个 nodepass.<measurement>.<field> 指标
+func encodeOTLP(points []point, mapping, extra map[string]string) ([]byte, error) {
+	metrics := make(map[string]*otlpMetric)
+	var order []string
+	for _, p := range points {
+		tags := tagSet(p.tags, mapping, extra)
+		attrs := make([]otlpAttribute, 0, len(tags))
+		for _, k := range sortedKeys(tags) {
+			attrs = append(attrs, otlpAttribute{Key: k, Value: otlpAnyString{StringValue: tags[k]}})
+		}
+		ts := strconv.FormatInt(p.time.UnixNano(), 10)
+		for _, f := range p.fields {
+			name := "nodepass." + p.measurement + "." + f.name
+			m, ok := metrics[name]
+			if !ok {
+				m = &otlpMetric{Name: name}
+				if f.kind == kindCounter {
+					m.Sum = &otlpSum{AggregationTemporality: otlpAggregationCumulative, IsMonotonic: true}
+				} else {
+					m.Gauge = &otlpGauge{}
+				}
+				metrics[name] = m
+				order = append(order, name)
+			}
+			dp := otlpDataPoint{Attributes: attrs, TimeUnixNano: ts}
+			if f.integer {
+				v := strconv.FormatInt(int64(f.value), 10)
+				dp.AsInt = &v
+			} else {
+				v := f.value
+				dp.AsDouble = &v
+			}
+			if m.Sum != nil {
+				m.Sum.DataPoints = append(m.Sum.DataPoints, dp)
+			} else {
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, dp)
+			}
+		}
+	}
+
+	scope := otlpScopeMetrics{Scope: otlpScope{Name: "nodepassdash"}}
+	for _, name := range order {
+		scope.Metrics = append(scope.Metrics, *metrics[name])
+	}
+	return json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpAnyString{StringValue: "nodepassdash"}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{scope},
+	}}})
+}
@@ -0,0 +1,90 @@
+package metricpush
+
+import (
+	"NodePassDash/internal/models"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	requestTimeout = 15 * time.Second
+	maxErrorBody   = 512
+)
+
+// pusher 向单个目标发送编码后的数据点
+type pusher struct {
+	target models.MetricPushTarget
+	client *http.Client
+}
+
+func newPusher(target models.MetricPushTarget) (*pusher, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的地址: %s", target.URL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("地址协议应为 http 或 https: %s", u.Scheme)
+	}
+	switch target.Format {
+	case models.MetricPushOTLP, models.MetricPushInflux:
+	default:
+		return nil, fmt.Errorf("不支持的推送格式: %s", target.Format)
+	}
+	return &pusher{
+		target: target,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: target.TLSSkipVerify},
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		},
+	}, nil
+}
+
+// encode 按目标格式编码，返回请求体与 Content-Type
+func (p *pusher) encode(points []point) ([]byte, string, error) {
+	if p.target.Format == models.MetricPushInflux {
+		return encodeInflux(points, p.target.TagMapping, p.target.ExtraTags), "text/plain; charset=utf-8", nil
+	}
+	body, err := encodeOTLP(points, p.target.TagMapping, p.target.ExtraTags)
+	return body, "application/json", err
+}
+
+// push 发送一批数据点，非 2xx 响应视为失败
+func (p *pusher) push(ctx context.Context, points []point) error {
+	body, contentType, err := p.encode(points)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range p.target.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (p *pusher) close() {
+	p.client.CloseIdleConnections()
+}
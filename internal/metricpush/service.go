@@ -0,0 +1,490 @@
+package metricpush
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultInterval   = 60
+	minInterval       = 5
+	defaultBufferSize = 10000
+	maxBufferSize     = 1000000
+	pushBatchSize     = 1000 // 单次请求的最大数据点数
+	maxCollectPages   = 10   // 每轮最多读取的 service_history 页数
+	testSampleSize    = 50   // 测试推送使用的最近记录数
+)
+
+// PushStats 单个推送目标的运行统计
+type PushStats struct {
+	Pushed        int64      `json:"pushed"`   // 已成功推送的数据点数
+	Dropped       int64      `json:"dropped"`  // 重试缓冲已满被丢弃的数据点数
+	Failures      int64      `json:"failures"` // 推送失败的请求次数
+	Buffered      int        `json:"buffered"` // 等待推送或重试的数据点数
+	LastHistoryID int64      `json:"lastHistoryId"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"`
+	LastSuccessAt *time.Time `json:"lastSuccessAt,omitempty"`
+}
+
+// TargetItem 推送目标及其运行统计
+type TargetItem struct {
+	models.MetricPushTarget
+	Stats *PushStats `json:"stats,omitempty"` // 未启用时为空
+}
+
+// runner 单个推送目标的采集与推送协程
+// 每轮读取新的 service_history 记录放入缓冲，推送失败的数据点留在缓冲中等下一轮重试；
+// 读取位置在该轮数据点全部推送成功（或因缓冲已满被丢弃）后才持久化，重启后未送达的记录会重新读取
+type runner struct {
+	db     *gorm.DB
+	target models.MetricPushTarget
+	out    *pusher
+	now    func() time.Time
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	endpointFrom time.Time // 端点汇总的起始分钟
+
+	mu     sync.Mutex
+	buffer []point
+	marks  []cursorMark // 尚未持久化的各轮读取位置，按采集顺序排列
+	saved  int64        // 已持久化的读取位置
+	stats  PushStats
+}
+
+// cursorMark 一轮采集结束时的读取位置，pending 为其之前（含本轮）仍在缓冲中的数据点数
+type cursorMark struct {
+	pending int
+	cursor  int64
+}
+
+func newRunner(db *gorm.DB, target models.MetricPushTarget, out *pusher, now func() time.Time) *runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &runner{
+		db:           db,
+		target:       target,
+		out:          out,
+		now:          now,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+		endpointFrom: closedMinute(now()),
+		saved:        target.LastHistoryID,
+		stats:        PushStats{LastHistoryID: target.LastHistoryID},
+	}
+}
+
+// closedMinute 已写入完成的分钟边界：service_history 按事件时间取整到分钟，留出一分钟余量
+func closedMinute(t time.Time) time.Time {
+	return t.Truncate(time.Minute).Add(-time.Minute)
+}
+
+// loop 按间隔执行采集与推送，停止时尝试推送一次缓冲
+func (r *runner) loop() {
+	defer close(r.done)
+	defer r.out.close()
+
+	ticker := time.NewTicker(time.Duration(r.target.IntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.cycle()
+		case <-r.ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			r.flush(ctx)
+			cancel()
+			return
+		}
+	}
+}
+
+// cycle 执行一轮采集与推送
+func (r *runner) cycle() {
+	r.collect()
+	r.flush(r.ctx)
+}
+
+// collect 采集新的隧道记录与已结束分钟的端点汇总，读取位置随数据点送达后持久化
+func (r *runner) collect() {
+	var points []point
+	cursor := r.stats.LastHistoryID
+	for page := 0; page < maxCollectPages; page++ {
+		batch, next, err := collectTunnels(r.db, cursor)
+		if err != nil {
+			r.fail(err)
+			break
+		}
+		points = append(points, batch...)
+		if next == cursor || len(batch) < collectLimit {
+			cursor = next
+			break
+		}
+		cursor = next
+	}
+	closed := closedMinute(r.now())
+	if r.endpointFrom.Before(closed) {
+		batch, err := collectEndpoints(r.db, r.endpointFrom, closed)
+		if err != nil {
+			r.fail(err)
+		} else {
+			points = append(points, batch...)
+			r.endpointFrom = closed
+		}
+	}
+
+	r.mu.Lock()
+	r.stats.LastHistoryID = cursor
+	r.buffer = append(r.buffer, points...)
+	r.marks = append(r.marks, cursorMark{pending: len(r.buffer), cursor: cursor})
+	over := len(r.buffer) - r.target.BufferSize
+	if over > 0 {
+		r.buffer = append([]point(nil), r.buffer[over:]...)
+		r.stats.Dropped += int64(over)
+	} else {
+		over = 0
+	}
+	commit := r.consume(over)
+	r.mu.Unlock()
+	if over > 0 {
+		log.Warnf("[MetricPush]推送目标 %s 重试缓冲已满，丢弃 %d 个最旧的数据点", r.target.Name, over)
+	}
+	r.saveCursor(commit)
+}
+
+// consume 记录缓冲头部 n 个数据点已离开缓冲，返回可持久化的最新读取位置，无变化时返回 0，调用方需持有 mu
+func (r *runner) consume(n int) int64 {
+	var commit int64
+	kept := r.marks[:0]
+	for _, m := range r.marks {
+		if m.pending -= n; m.pending <= 0 {
+			commit = m.cursor
+			continue
+		}
+		kept = append(kept, m)
+	}
+	r.marks = kept
+	if commit == r.saved {
+		return 0
+	}
+	return commit
+}
+
+// saveCursor 持久化读取位置，cursor 为 0 时跳过
+func (r *runner) saveCursor(cursor int64) {
+	if cursor == 0 {
+		return
+	}
+	if err := r.db.Model(&models.MetricPushTarget{}).Where("id = ?", r.target.ID).
+		Update("last_history_id", cursor).Error; err != nil {
+		log.Warnf("[MetricPush]保存推送目标 %s 读取位置失败: %v", r.target.Name, err)
+		return
+	}
+	r.mu.Lock()
+	if cursor > r.saved {
+		r.saved = cursor
+	}
+	r.mu.Unlock()
+}
+
+// flush 分批推送缓冲中的数据点，遇到失败即停止，剩余数据点留待下一轮
+func (r *runner) flush(ctx context.Context) {
+	for {
+		r.mu.Lock()
+		n := len(r.buffer)
+		if n > pushBatchSize {
+			n = pushBatchSize
+		}
+		batch := r.buffer[:n]
+		r.mu.Unlock()
+		if n == 0 {
+			return
+		}
+
+		if err := r.out.push(ctx, batch); err != nil {
+			r.fail(err)
+			return
+		}
+		now := time.Now()
+		r.mu.Lock()
+		r.buffer = r.buffer[n:]
+		r.stats.Pushed += int64(n)
+		r.stats.LastSuccessAt = &now
+		commit := r.consume(n)
+		r.mu.Unlock()
+		r.saveCursor(commit)
+	}
+}
+
+// fail 记录一次失败
+func (r *runner) fail(err error) {
+	now := time.Now()
+	r.mu.Lock()
+	r.stats.Failures++
+	r.stats.LastError, r.stats.LastErrorAt = err.Error(), &now
+	r.mu.Unlock()
+	log.Warnf("[MetricPush]推送目标 %s 推送失败: %v", r.target.Name, err)
+}
+
+// snapshot 获取统计快照
+func (r *runner) snapshot() *PushStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := r.stats
+	stats.Buffered = len(r.buffer)
+	return &stats
+}
+
+// stop 停止推送协程
+func (r *runner) stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Service 指标推送服务
+// 将 service_history 中的隧道聚合数据及端点汇总以 OTLP/HTTP 或 InfluxDB 行协议推送到外部
+type Service struct {
+	db      *gorm.DB
+	now     func() time.Time
+	mu      sync.RWMutex
+	runners map[int64]*runner
+}
+
+// NewService 创建指标推送服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:      db,
+		now:     time.Now,
+		runners: make(map[int64]*runner),
+	}
+}
+
+// Start 启动全部已启用的推送目标
+func (s *Service) Start() {
+	var targets []models.MetricPushTarget
+	if err := s.db.Where("enabled = ?", true).Find(&targets).Error; err != nil {
+		log.Errorf("[MetricPush]加载指标推送目标失败: %v", err)
+		return
+	}
+	started := 0
+	for _, target := range targets {
+		if err := s.startTarget(target); err != nil {
+			log.Warnf("[MetricPush]推送目标 %s 启动失败: %v", target.Name, err)
+			continue
+		}
+		started++
+	}
+	if started > 0 {
+		log.Infof("[MetricPush]已启动 %d 个指标推送目标", started)
+	}
+}
+
+// Close 停止全部推送目标
+func (s *Service) Close() {
+	s.mu.Lock()
+	runners := s.runners
+	s.runners = make(map[int64]*runner)
+	s.mu.Unlock()
+	for _, r := range runners {
+		r.stop()
+	}
+}
+
+// startTarget 启动单个推送目标，已在运行时先停止
+func (s *Service) startTarget(target models.MetricPushTarget) error {
+	applyDefaults(&target)
+	out, err := newPusher(target)
+	if err != nil {
+		return err
+	}
+	s.stopTarget(target.ID)
+	r := newRunner(s.db, target, out, s.now)
+	go r.loop()
+	s.mu.Lock()
+	s.runners[target.ID] = r
+	s.mu.Unlock()
+	return nil
+}
+
+// stopTarget 停止单个推送目标
+func (s *Service) stopTarget(id int64) {
+	s.mu.Lock()
+	r, ok := s.runners[id]
+	delete(s.runners, id)
+	s.mu.Unlock()
+	if ok {
+		r.stop()
+	}
+}
+
+// applyDefaults 补齐推送间隔与缓冲参数
+func applyDefaults(target *models.MetricPushTarget) {
+	if target.IntervalSec <= 0 {
+		target.IntervalSec = defaultInterval
+	}
+	if target.IntervalSec < minInterval {
+		target.IntervalSec = minInterval
+	}
+	if target.BufferSize <= 0 {
+		target.BufferSize = defaultBufferSize
+	}
+	if target.BufferSize > maxBufferSize {
+		target.BufferSize = maxBufferSize
+	}
+}
+
+// normalizeTarget 校验推送目标配置
+func normalizeTarget(target *models.MetricPushTarget) error {
+	target.Name = strings.TrimSpace(target.Name)
+	target.URL = strings.TrimSpace(target.URL)
+	if target.Name == "" {
+		return errors.New("名称不能为空")
+	}
+	applyDefaults(target)
+	out, err := newPusher(*target)
+	if err != nil {
+		return err
+	}
+	out.close()
+	return nil
+}
+
+// ListTargets 获取全部推送目标及运行统计
+func (s *Service) ListTargets() ([]TargetItem, error) {
+	var targets []models.MetricPushTarget
+	if err := s.db.Order("id").Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]TargetItem, 0, len(targets))
+	for _, target := range targets {
+		item := TargetItem{MetricPushTarget: target}
+		if r, ok := s.runners[target.ID]; ok {
+			item.Stats = r.snapshot()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Stats 获取运行中推送目标的统计，按 ID 索引
+func (s *Service) Stats() map[int64]*PushStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stats := make(map[int64]*PushStats, len(s.runners))
+	for id, r := range s.runners {
+		stats[id] = r.snapshot()
+	}
+	return stats
+}
+
+// CreateTarget 创建推送目标，只推送创建之后写入的数据
+func (s *Service) CreateTarget(target *models.MetricPushTarget) error {
+	if err := normalizeTarget(target); err != nil {
+		return err
+	}
+	latest, err := latestHistoryID(s.db)
+	if err != nil {
+		return err
+	}
+	target.ID = 0
+	target.LastHistoryID = latest
+	if err := s.db.Create(target).Error; err != nil {
+		return err
+	}
+	if target.Enabled {
+		return s.startTarget(*target)
+	}
+	return nil
+}
+
+// UpdateTarget 更新推送目标并按新配置重启（统计与重试缓冲清零，读取位置保留）
+func (s *Service) UpdateTarget(target *models.MetricPushTarget) error {
+	if err := normalizeTarget(target); err != nil {
+		return err
+	}
+	s.stopTarget(target.ID)
+	var existing models.MetricPushTarget
+	if err := s.db.First(&existing, target.ID).Error; err != nil {
+		return err
+	}
+	target.CreatedAt = existing.CreatedAt
+	target.LastHistoryID = existing.LastHistoryID
+	if err := s.db.Model(&existing).Select("*").Omit("id", "created_at").Updates(target).Error; err != nil {
+		return err
+	}
+	if !target.Enabled {
+		return nil
+	}
+	return s.startTarget(*target)
+}
+
+// DeleteTarget 删除推送目标
+func (s *Service) DeleteTarget(id int64) error {
+	result := s.db.Delete(&models.MetricPushTarget{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	s.stopTarget(id)
+	return nil
+}
+
+// ErrInvalidTarget 推送目标配置无效
+var ErrInvalidTarget = errors.New("推送目标配置无效")
+
+// TestSend 使用最近的 service_history 记录向目标发送一次测试推送，不影响读取位置
+// 没有历史记录时发送一个空的端点数据点，返回发送的数据点数
+func (s *Service) TestSend(target *models.MetricPushTarget) (int, error) {
+	target.URL = strings.TrimSpace(target.URL)
+	out, err := newPusher(*target)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	defer out.close()
+
+	var histories []models.ServiceHistory
+	if err := s.db.Order("id DESC").Limit(testSampleSize).Find(&histories).Error; err != nil {
+		return 0, err
+	}
+	var points []point
+	if len(histories) > 0 {
+		l, err := newLabeler(s.db)
+		if err != nil {
+			return 0, err
+		}
+		points = append(tunnelPoints(histories, l), endpointPoints(histories, l)...)
+	} else {
+		points = []point{(&endpointAggregate{time: s.now().Truncate(time.Minute)}).point(map[string]string{"endpoint": "test"})}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if err := out.push(ctx, points); err != nil {
+		return 0, err
+	}
+	return len(points), nil
+}
+
+// TestTarget 对已保存的推送目标发送测试推送
+func (s *Service) TestTarget(id int64) (int, error) {
+	var target models.MetricPushTarget
+	if err := s.db.First(&target, id).Error; err != nil {
+		return 0, err
+	}
+	return s.TestSend(&target)
+}
@@ -0,0 +1,156 @@
+package metricpush
+
+import (
+	"NodePassDash/internal/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEncodeInflux(t *testing.T) {
+	p := point{
+		measurement: "tunnel",
+		tags:        map[string]string{"tunnel": "web 1", "endpoint": "a,b", "group": "", "instance": "x"},
+		fields:      []field{{name: "tcp_in_bytes", value: 42, integer: true, kind: kindCounter}, {name: "ping_ms", value: 1.5}},
+		time:        time.Unix(60, 0),
+	}
+	got := string(encodeInflux([]point{p}, map[string]string{"instance": ""}, map[string]string{"site": "hk"}))
+	want := `nodepass_tunnel,endpoint=a\,b,site=hk,tunnel=web\ 1 tcp_in_bytes=42i,ping_ms=1.5 60000000000` + "\n"
+	if got != want {
+		t.Errorf("encodeInflux =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunnerPushesWithRetry(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Group{}, &models.Tunnel{}, &models.TunnelGroup{},
+		&models.ServiceHistory{}, &models.MetricPushTarget{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	endpoint := models.Endpoint{Name: "edge", URL: "http://a", APIPath: "/api", APIKey: "k"}
+	db.Create(&endpoint)
+	instance := "abc"
+	tags := map[string]string{"env": "prod"}
+	db.Create(&models.Tunnel{Name: "web", EndpointID: endpoint.ID, Type: "server", InstanceID: &instance, Tags: &tags})
+
+	now := time.Date(2024, 1, 1, 10, 5, 30, 0, time.UTC)
+	minute := now.Truncate(time.Minute).Add(-2 * time.Minute)
+	db.Create(&models.ServiceHistory{EndpointID: endpoint.ID, InstanceID: instance, DeltaTCPIn: 100, AvgPing: 10, AvgTCPs: 2, RecordTime: minute})
+
+	var mu sync.Mutex
+	var requests int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // 首次失败，数据点留在缓冲中
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Header.Get("Authorization")+"|"+string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := NewService(db)
+	s.now = func() time.Time { return now }
+	target := models.MetricPushTarget{Name: "influx", Format: models.MetricPushInflux, URL: server.URL,
+		Headers: map[string]string{"Authorization": "Token t"}}
+	if err := s.CreateTarget(&target); err != nil {
+		t.Fatalf("create target: %v", err)
+	}
+	if target.LastHistoryID != 1 {
+		t.Fatalf("initial cursor = %d, want 1", target.LastHistoryID)
+	}
+	if err := s.CreateTarget(&models.MetricPushTarget{Name: "bad", Format: "csv", URL: server.URL}); err == nil {
+		t.Error("expected unknown format to be rejected")
+	}
+
+	applyDefaults(&target)
+	out, _ := newPusher(target)
+	r := newRunner(db, target, out, func() time.Time { return now })
+	r.endpointFrom = minute
+	db.Create(&models.ServiceHistory{EndpointID: endpoint.ID, InstanceID: instance, DeltaTCPIn: 200, AvgPing: 20, AvgTCPs: 4, RecordTime: minute})
+
+	r.cycle()
+	if stats := r.snapshot(); stats.Failures != 1 || stats.Buffered != 2 || stats.LastHistoryID != 2 {
+		t.Fatalf("stats after failure = %+v", stats)
+	}
+	var saved models.MetricPushTarget
+	if db.First(&saved, target.ID); saved.LastHistoryID != 1 {
+		t.Errorf("persisted cursor after failure = %d, want 1", saved.LastHistoryID)
+	}
+	r.cycle()
+	if stats := r.snapshot(); stats.Pushed != 2 || stats.Buffered != 0 {
+		t.Fatalf("stats after retry = %+v", stats)
+	}
+	if db.First(&saved, target.ID); saved.LastHistoryID != 2 {
+		t.Errorf("persisted cursor = %d, want 2", saved.LastHistoryID)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("bodies = %d, want 1", len(bodies))
+	}
+	ts := "1704103380000000000"
+	for _, want := range []string{
+		"Token t|",
+		"nodepass_tunnel,endpoint=edge,endpoint_id=1,instance=abc,tag_env=prod,tunnel=web,tunnel_id=1,type=server tcp_in_bytes=200i,",
+		"nodepass_endpoint,endpoint=edge,endpoint_id=1 tunnels=2i,ping_ms=15,pool=0i,tcps=6i,",
+		" " + ts + "\n",
+	} {
+		if !strings.Contains(bodies[0], want) {
+			t.Errorf("missing %q in body:\n%s", want, bodies[0])
+		}
+	}
+}
+
+func TestTestSendOTLP(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Group{}, &models.Tunnel{}, &models.TunnelGroup{},
+		&models.ServiceHistory{}, &models.MetricPushTarget{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: "abc", DeltaTCPIn: 100, AvgPing: 10, RecordTime: time.Unix(60, 0)})
+
+	var got otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	s := NewService(db)
+	points, err := s.TestSend(&models.MetricPushTarget{Format: models.MetricPushOTLP, URL: server.URL})
+	if err != nil || points != 2 {
+		t.Fatalf("TestSend = %d, %v", points, err)
+	}
+	metrics := got.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if metrics[0].Name != "nodepass.tunnel.tcp_in_bytes" || metrics[0].Sum == nil || !metrics[0].Sum.IsMonotonic ||
+		*metrics[0].Sum.DataPoints[0].AsInt != "100" || metrics[0].Sum.DataPoints[0].TimeUnixNano != "60000000000" {
+		t.Errorf("first metric = %+v", metrics[0])
+	}
+	if _, err := s.TestSend(&models.MetricPushTarget{Format: models.MetricPushOTLP, URL: "ftp://x"}); err == nil {
+		t.Error("expected invalid scheme to be rejected")
+	}
+}
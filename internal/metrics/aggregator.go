@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"NodePassDash/internal/latency"
 	log "NodePassDash/internal/log"
 	"context"
 	"fmt"
@@ -36,10 +37,11 @@ type TaskStatus struct {
 	InstanceID string `json:"instance_id"`
 
 	// Ping 延迟统计 - 参考 servicesentinel.go:205-206
-	PingResults  []PingResult `json:"ping_results"`
-	SuccessCount int          `json:"success_count"`
-	FailureCount int          `json:"failure_count"`
-	AvgPing      float64      `json:"avg_ping"` // 当前累积平均延迟
+	PingResults  []PingResult    `json:"ping_results"`
+	SuccessCount int             `json:"success_count"`
+	FailureCount int             `json:"failure_count"`
+	AvgPing      float64         `json:"avg_ping"` // 当前累积平均延迟
+	PingSketch   *latency.Sketch `json:"-"`        // 当前窗口成功延迟的流式草图，内存有界
 
 	// 连接池统计
 	PoolResults []PoolResult `json:"pool_results"`
@@ -89,6 +91,10 @@ type MinuteMetrics struct {
 	AvgPing     float64 `gorm:"default:0" json:"avg_ping"`     // 平均延迟 (ms)
 	MinPing     float64 `gorm:"default:0" json:"min_ping"`     // 最小延迟 (ms)
 	MaxPing     float64 `gorm:"default:0" json:"max_ping"`     // 最大延迟 (ms)
+	P50Ping     float64 `gorm:"default:0" json:"p50_ping"`     // 延迟中位数 (ms)
+	P90Ping     float64 `gorm:"default:0" json:"p90_ping"`     // 延迟 P90 (ms)
+	P99Ping     float64 `gorm:"default:0" json:"p99_ping"`     // 延迟 P99 (ms)
+	JitterPing  float64 `gorm:"default:0" json:"jitter_ping"`  // 延迟抖动，标准差 (ms)
 	PingCount   int     `gorm:"default:0" json:"ping_count"`   // Ping 次数
 	SuccessRate float64 `gorm:"default:0" json:"success_rate"` // 成功率 (%)
 
@@ -194,6 +200,7 @@ func (a *MetricsAggregator) AddPingResult(endpointID int64, instanceID string, l
 	// 更新成功/失败计数
 	if success {
 		status.SuccessCount++
+		status.PingSketch.Add(latency)
 
 		// 计算累积平均延迟 - 使用 Nezha 的加权平均算法
 		// 公式: (旧平均值*成功次数 + 新延迟) / (成功次数+1)
@@ -349,6 +356,7 @@ func (a *MetricsAggregator) triggerAggregation(key string, status *TaskStatus) {
 	copy(poolResults, status.PoolResults)
 	trafficResults := make([]TrafficResult, len(status.TrafficResults))
 	copy(trafficResults, status.TrafficResults)
+	pingSketch := status.PingSketch
 
 	// 重置状态数据 - 类似 servicesentinel.go:501
 	status.PingResults = status.PingResults[:0]
@@ -357,20 +365,21 @@ func (a *MetricsAggregator) triggerAggregation(key string, status *TaskStatus) {
 	status.SuccessCount = 0
 	status.FailureCount = 0
 	status.AvgPing = 0
+	status.PingSketch = latency.New()
 	status.AvgPool = 0
 	status.FirstDataTime = time.Time{}
 
 	status.mu.Unlock()
 
 	// 计算分钟级聚合指标并存储
-	if err := a.calculateAndStoreMetrics(endpointID, instanceID, pingResults, poolResults, trafficResults); err != nil {
+	if err := a.calculateAndStoreMetrics(endpointID, instanceID, pingResults, pingSketch, poolResults, trafficResults); err != nil {
 		log.Errorf("聚合指标计算失败 [%d_%s]: %v", endpointID, instanceID, err)
 	}
 }
 
 // calculateAndStoreMetrics 计算并存储分钟级指标
 func (a *MetricsAggregator) calculateAndStoreMetrics(endpointID int64, instanceID string,
-	pingResults []PingResult, poolResults []PoolResult, trafficResults []TrafficResult) error {
+	pingResults []PingResult, pingSketch *latency.Sketch, poolResults []PoolResult, trafficResults []TrafficResult) error {
 
 	now := time.Now()
 	minuteTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), 0, 0, now.Location())
@@ -409,6 +418,15 @@ func (a *MetricsAggregator) calculateAndStoreMetrics(endpointID int64, instanceI
 		}
 	}
 
+	// 延迟分位数与抖动：基于整个窗口的草图，不受 PingResults 截断影响
+	if pingSketch != nil && pingSketch.Count > 0 {
+		metrics.P50Ping = pingSketch.Quantile(0.5)
+		metrics.P90Ping = pingSketch.Quantile(0.9)
+		metrics.P99Ping = pingSketch.Quantile(0.99)
+		metrics.JitterPing = pingSketch.StdDev()
+		metrics.MaxPing = math.Max(metrics.MaxPing, pingSketch.Max)
+	}
+
 	// 计算连接池指标
 	if len(poolResults) > 0 {
 		metrics.PoolCount = len(poolResults)
@@ -524,6 +542,7 @@ func (a *MetricsAggregator) initTaskStatus(endpointID int64, instanceID string)
 		EndpointID:     endpointID,
 		InstanceID:     instanceID,
 		PingResults:    make([]PingResult, 0, a.maxCurrentStatusSize),
+		PingSketch:     latency.New(),
 		PoolResults:    make([]PoolResult, 0, a.maxCurrentStatusSize),
 		TrafficResults: make([]TrafficResult, 0, a.maxCurrentStatusSize),
 	}
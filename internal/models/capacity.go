@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// CapacityScope 容量阈值的作用对象
+type CapacityScope string
+
+const (
+	CapacityScopeTunnel   CapacityScope = "tunnel"
+	CapacityScopeEndpoint CapacityScope = "endpoint"
+)
+
+// CapacityMetric 容量阈值的指标
+type CapacityMetric string
+
+const (
+	CapacityMetricMonthlyTraffic CapacityMetric = "monthly_traffic" // 自然月累计流量（字节），隧道与主控均适用
+	CapacityMetricCPU            CapacityMetric = "cpu"             // CPU 使用率（%），仅主控
+	CapacityMetricMemory         CapacityMetric = "memory"          // 内存使用率（%），仅主控
+)
+
+// CapacityThreshold 容量阈值 - GORM模型
+// TargetID 为 0 时作为该作用对象的默认阈值，具体对象的阈值优先
+type CapacityThreshold struct {
+	ID        int64          `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Scope     CapacityScope  `json:"scope" gorm:"type:text;not null;uniqueIndex:idx_capacity_threshold,priority:1;column:scope"`
+	TargetID  int64          `json:"targetId" gorm:"not null;default:0;uniqueIndex:idx_capacity_threshold,priority:2;column:target_id"`
+	Metric    CapacityMetric `json:"metric" gorm:"type:text;not null;uniqueIndex:idx_capacity_threshold,priority:3;column:metric"`
+	Limit     float64        `json:"limit" gorm:"not null;column:limit_value"`
+	CreatedAt time.Time      `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt time.Time      `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (CapacityThreshold) TableName() string {
+	return "capacity_thresholds"
+}
+
+// EndpointSystemSample 主控系统指标采样 - GORM模型
+// 由容量预测服务定期拉取主控 /info 写入，用于 CPU、内存趋势预测
+type EndpointSystemSample struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	EndpointID int64     `json:"endpointId" gorm:"not null;index:idx_endpoint_sample,priority:1;column:endpoint_id"`
+	SampleTime time.Time `json:"sampleTime" gorm:"not null;index:idx_endpoint_sample,priority:2;column:sample_time"`
+	CPU        float64   `json:"cpu" gorm:"column:cpu"`            // CPU 使用率（%）
+	MemUsed    int64     `json:"memUsed" gorm:"column:mem_used"`   // 已使用内存（字节）
+	MemTotal   int64     `json:"memTotal" gorm:"column:mem_total"` // 总内存（字节）
+	NetRx      int64     `json:"netRx" gorm:"column:net_rx"`       // 网卡累计接收字节数
+	NetTx      int64     `json:"netTx" gorm:"column:net_tx"`       // 网卡累计发送字节数
+}
+
+// TableName 设置表名
+func (EndpointSystemSample) TableName() string {
+	return "endpoint_system_samples"
+}
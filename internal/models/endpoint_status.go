@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// EndpointStatusEvent 主控状态变化记录 - GORM模型
+// 仅在状态实际发生变化时写入，用于图表注释与排障回溯
+type EndpointStatusEvent struct {
+	ID         int64          `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	EndpointID int64          `json:"endpointId" gorm:"not null;index;column:endpoint_id"`
+	Status     EndpointStatus `json:"status" gorm:"type:text;not null;column:status"`
+	CreatedAt  time.Time      `json:"createdAt" gorm:"autoCreateTime;index;column:created_at"`
+}
+
+// TableName 设置表名
+func (EndpointStatusEvent) TableName() string {
+	return "endpoint_status_events"
+}
@@ -90,4 +90,8 @@ const (
 	OperationActionRenamed      OperationAction = "renamed"
 	OperationActionResetTraffic OperationAction = "reset_traffic"
 	OperationActionError        OperationAction = "error"
+	OperationActionHeal         OperationAction = "heal"
+	OperationActionHealGiveUp   OperationAction = "heal_give_up"
+	OperationActionBulkUpdate   OperationAction = "bulk_update"
+	OperationActionClone        OperationAction = "clone"
 )
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// FailoverSwitchKind 故障转移切换类型
+type FailoverSwitchKind string
+
+const (
+	FailoverKindFailover FailoverSwitchKind = "failover" // 当前 server 不健康，切到备用主控
+	FailoverKindFailback FailoverSwitchKind = "failback" // 主用主控恢复，切回主用
+	FailoverKindManual   FailoverSwitchKind = "manual"   // 手动切换
+)
+
+// ServiceFailoverPolicy 服务故障转移策略表 - GORM模型
+// 每个服务最多一条，监控当前承载 server 端的主控，不健康时把 client 端改指向备用主控
+type ServiceFailoverPolicy struct {
+	ID                 int64              `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Sid                string             `json:"sid" gorm:"type:text;not null;uniqueIndex;column:sid"`
+	Enabled            bool               `json:"enabled" gorm:"column:enabled"`
+	StandbyEndpointIDs []int64            `json:"standbyEndpointIds" gorm:"type:text;serializer:json;column:standby_endpoint_ids"` // 备用 server 主控，按优先级排列
+	PrimaryEndpointID  int64              `json:"primaryEndpointId" gorm:"column:primary_endpoint_id"`                             // 主用 server 主控，回切目标
+	ActiveEndpointID   int64              `json:"activeEndpointId" gorm:"index;column:active_endpoint_id"`                         // 当前承载 server 端的主控
+	Instances          map[string]string  `json:"instances" gorm:"type:text;serializer:json;column:instances"`                     // 主控ID -> 该主控上的 server 实例ID
+	FailThreshold      int                `json:"failThreshold" gorm:"default:3;column:fail_threshold"`                            // 连续不健康检查次数达到后切换
+	MaxPingMs          int                `json:"maxPingMs" gorm:"default:0;column:max_ping_ms"`                                   // client 端延迟上限，0 表示不检查
+	Failback           bool               `json:"failback" gorm:"column:failback"`                                                 // 主用恢复后是否自动回切
+	FailbackAfterSec   int                `json:"failbackAfterSec" gorm:"default:300;column:failback_after_sec"`                   // 主用持续健康多久后回切
+	CooldownSec        int                `json:"cooldownSec" gorm:"default:120;column:cooldown_sec"`                              // 两次切换的最小间隔
+	LastSwitchAt       NullTime           `json:"lastSwitchAt" gorm:"column:last_switch_at"`
+	LastSwitchKind     FailoverSwitchKind `json:"lastSwitchKind,omitempty" gorm:"type:text;column:last_switch_kind"`
+	CreatedAt          time.Time          `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt          time.Time          `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (ServiceFailoverPolicy) TableName() string {
+	return "service_failover_policies"
+}
+
+// ServiceFailoverEvent 故障转移切换记录表 - GORM模型
+type ServiceFailoverEvent struct {
+	ID             int64              `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Sid            string             `json:"sid" gorm:"type:text;not null;index;column:sid"`
+	Kind           FailoverSwitchKind `json:"kind" gorm:"type:text;not null;column:kind"`
+	FromEndpointID int64              `json:"fromEndpointId" gorm:"column:from_endpoint_id"`
+	ToEndpointID   int64              `json:"toEndpointId" gorm:"column:to_endpoint_id"`
+	Reason         string             `json:"reason" gorm:"type:text;column:reason"`
+	Success        bool               `json:"success" gorm:"column:success"`
+	Message        *string            `json:"message,omitempty" gorm:"type:text;column:message"`
+	CreatedAt      time.Time          `json:"createdAt" gorm:"autoCreateTime;index;column:created_at"`
+}
+
+// TableName 设置表名
+func (ServiceFailoverEvent) TableName() string {
+	return "service_failover_events"
+}
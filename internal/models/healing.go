@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// HealingScope 自愈策略作用范围
+type HealingScope string
+
+const (
+	HealingScopeGlobal HealingScope = "global" // 全局默认策略
+	HealingScopeGroup  HealingScope = "group"  // 分组策略
+	HealingScopeTunnel HealingScope = "tunnel" // 单隧道策略
+)
+
+// HealingStateType 隧道自愈状态
+type HealingStateType string
+
+const (
+	HealingStateIdle      HealingStateType = "idle"      // 无需处理
+	HealingStateHealing   HealingStateType = "healing"   // 正在按退避策略重启
+	HealingStateRecovered HealingStateType = "recovered" // 已恢复运行
+	HealingStateGaveUp    HealingStateType = "gave_up"   // 超出最大次数，已放弃
+)
+
+// HealingAttemptResult 单次自愈尝试结果
+type HealingAttemptResult string
+
+const (
+	HealingResultIssued HealingAttemptResult = "issued"  // 已下发重启指令
+	HealingResultFailed HealingAttemptResult = "failed"  // 下发重启指令失败
+	HealingResultGaveUp HealingAttemptResult = "gave_up" // 放弃自愈
+)
+
+// HealingPolicy 隧道自愈策略表 - GORM模型
+// 优先级：tunnel > group > global，同一范围内 (scope, target_id) 唯一
+type HealingPolicy struct {
+	ID             int64        `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Scope          HealingScope `json:"scope" gorm:"type:text;not null;uniqueIndex:idx_healing_policy_target;column:scope"`
+	TargetID       int64        `json:"targetId" gorm:"not null;default:0;uniqueIndex:idx_healing_policy_target;column:target_id"`
+	Enabled        bool         `json:"enabled" gorm:"column:enabled"`
+	MaxAttempts    int          `json:"maxAttempts" gorm:"default:5;column:max_attempts"`         // 单个冷却窗口内最大重启次数
+	BaseBackoffSec int          `json:"baseBackoffSec" gorm:"default:10;column:base_backoff_sec"` // 初始退避秒数，按 2^n 递增
+	MaxBackoffSec  int          `json:"maxBackoffSec" gorm:"default:600;column:max_backoff_sec"`  // 退避上限秒数
+	CooldownSec    int          `json:"cooldownSec" gorm:"default:3600;column:cooldown_sec"`      // 冷却窗口，窗口过后尝试次数清零
+	HealOffline    bool         `json:"healOffline" gorm:"column:heal_offline"`                   // 主控在线但隧道 offline 时是否处理
+	CreatedAt      time.Time    `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt      time.Time    `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (HealingPolicy) TableName() string {
+	return "healing_policies"
+}
+
+// TunnelHealingState 隧道自愈状态表 - GORM模型
+type TunnelHealingState struct {
+	TunnelID      int64            `json:"tunnelId" gorm:"primaryKey;autoIncrement:false;column:tunnel_id"`
+	EndpointID    int64            `json:"endpointId" gorm:"not null;index;column:endpoint_id"`
+	InstanceID    string           `json:"instanceId" gorm:"type:text;not null;index;column:instance_id"`
+	State         HealingStateType `json:"state" gorm:"type:text;not null;index;column:state"`
+	Attempts      int              `json:"attempts" gorm:"default:0;column:attempts"`
+	WindowStart   NullTime         `json:"windowStart" gorm:"column:window_start"`
+	LastAttemptAt NullTime         `json:"lastAttemptAt" gorm:"column:last_attempt_at"`
+	NextAttemptAt NullTime         `json:"nextAttemptAt" gorm:"column:next_attempt_at"`
+	GaveUpAt      NullTime         `json:"gaveUpAt" gorm:"column:gave_up_at"`
+	LastError     *string          `json:"lastError,omitempty" gorm:"type:text;column:last_error"`
+	UpdatedAt     time.Time        `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (TunnelHealingState) TableName() string {
+	return "tunnel_healing_states"
+}
+
+// HealingAttempt 自愈尝试记录表 - GORM模型
+type HealingAttempt struct {
+	ID            int64                `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	TunnelID      int64                `json:"tunnelId" gorm:"not null;index;column:tunnel_id"`
+	EndpointID    int64                `json:"endpointId" gorm:"not null;column:endpoint_id"`
+	InstanceID    string               `json:"instanceId" gorm:"type:text;not null;column:instance_id"`
+	Attempt       int                  `json:"attempt" gorm:"not null;column:attempt"`
+	TriggerStatus TunnelStatus         `json:"triggerStatus" gorm:"type:text;column:trigger_status"`
+	Result        HealingAttemptResult `json:"result" gorm:"type:text;not null;column:result"`
+	Message       *string              `json:"message,omitempty" gorm:"type:text;column:message"`
+	CreatedAt     time.Time            `json:"createdAt" gorm:"autoCreateTime;index;column:created_at"`
+}
+
+// TableName 设置表名
+func (HealingAttempt) TableName() string {
+	return "healing_attempts"
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// RollupTier service_history 降采样层级
+type RollupTier string
+
+const (
+	RollupTier5m RollupTier = "5m" // 5 分钟，由分钟数据汇总
+	RollupTier1h RollupTier = "1h" // 1 小时，由 5 分钟层汇总
+	RollupTier1d RollupTier = "1d" // 1 天（本地时区零点对齐），由 1 小时层汇总
+)
+
+// ServiceHistoryRollup service_history 降采样表 - GORM模型
+// service_history 的 delta_* 列实为累计值：Delta* 为桶内的实际增量（计数器重置时按重置后的值计），
+// Last* 为桶末的累计值，与 service_history 的 delta_* 含义一致
+type ServiceHistoryRollup struct {
+	ID         int64      `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Tier       RollupTier `json:"tier" gorm:"type:text;not null;uniqueIndex:idx_rollup_bucket,priority:1;index:idx_rollup_query,priority:1;column:tier"`
+	EndpointID int64      `json:"endpointId" gorm:"not null;uniqueIndex:idx_rollup_bucket,priority:2;column:endpoint_id"`
+	InstanceID string     `json:"instanceId" gorm:"type:text;not null;uniqueIndex:idx_rollup_bucket,priority:3;index:idx_rollup_query,priority:2;column:instance_id"`
+	BucketTime time.Time  `json:"bucketTime" gorm:"not null;uniqueIndex:idx_rollup_bucket,priority:4;index:idx_rollup_query,priority:3;column:bucket_time"`
+
+	// 流量：桶内增量之和与桶末累计值
+	DeltaTCPIn  int64 `json:"deltaTcpIn" gorm:"default:0;column:delta_tcp_in"`
+	DeltaTCPOut int64 `json:"deltaTcpOut" gorm:"default:0;column:delta_tcp_out"`
+	DeltaUDPIn  int64 `json:"deltaUdpIn" gorm:"default:0;column:delta_udp_in"`
+	DeltaUDPOut int64 `json:"deltaUdpOut" gorm:"default:0;column:delta_udp_out"`
+	LastTCPIn   int64 `json:"lastTcpIn" gorm:"default:0;column:last_tcp_in"`
+	LastTCPOut  int64 `json:"lastTcpOut" gorm:"default:0;column:last_tcp_out"`
+	LastUDPIn   int64 `json:"lastUdpIn" gorm:"default:0;column:last_udp_in"`
+	LastUDPOut  int64 `json:"lastUdpOut" gorm:"default:0;column:last_udp_out"`
+
+	// 按采样点数加权的平均值及最小/最大值
+	AvgPing     float64 `json:"avgPing" gorm:"default:0;column:avg_ping"`
+	MinPing     float64 `json:"minPing" gorm:"default:0;column:min_ping"`
+	MaxPing     float64 `json:"maxPing" gorm:"default:0;column:max_ping"`
+	AvgPool     float64 `json:"avgPool" gorm:"default:0;column:avg_pool"`
+	MinPool     float64 `json:"minPool" gorm:"default:0;column:min_pool"`
+	MaxPool     float64 `json:"maxPool" gorm:"default:0;column:max_pool"`
+	AvgTCPs     float64 `json:"avgTcps" gorm:"default:0;column:avg_tcps"`
+	MaxTCPs     float64 `json:"maxTcps" gorm:"default:0;column:max_tcps"`
+	AvgUDPs     float64 `json:"avgUdps" gorm:"default:0;column:avg_udps"`
+	MaxUDPs     float64 `json:"maxUdps" gorm:"default:0;column:max_udps"`
+	AvgSpeedIn  float64 `json:"avgSpeedIn" gorm:"default:0;column:avg_speed_in"`
+	MaxSpeedIn  float64 `json:"maxSpeedIn" gorm:"default:0;column:max_speed_in"`
+	AvgSpeedOut float64 `json:"avgSpeedOut" gorm:"default:0;column:avg_speed_out"`
+	MaxSpeedOut float64 `json:"maxSpeedOut" gorm:"default:0;column:max_speed_out"`
+
+	// 延迟分布：由各记录的延迟草图合并后计算
+	P50Ping    float64 `json:"p50Ping" gorm:"default:0;column:p50_ping"`
+	P90Ping    float64 `json:"p90Ping" gorm:"default:0;column:p90_ping"`
+	P99Ping    float64 `json:"p99Ping" gorm:"default:0;column:p99_ping"`
+	JitterPing float64 `json:"jitterPing" gorm:"default:0;column:jitter_ping"`
+	PingSketch string  `json:"-" gorm:"type:text;column:ping_sketch"` // 延迟草图的 JSON 编码（latency.Encode）
+
+	// 统计信息
+	RecordCount int       `json:"recordCount" gorm:"default:0;column:record_count"` // 采样点数（加权平均的权重）
+	RowCount    int       `json:"rowCount" gorm:"default:0;column:row_count"`       // 参与汇总的分钟记录数
+	UpCount     int       `json:"upCount" gorm:"default:0;column:up_count"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (ServiceHistoryRollup) TableName() string {
+	return "service_history_rollups"
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// LogAlertScope 日志告警规则作用范围
+type LogAlertScope string
+
+const (
+	LogAlertScopeAll      LogAlertScope = "all"      // 全部隧道
+	LogAlertScopeTunnel   LogAlertScope = "tunnel"   // 指定隧道
+	LogAlertScopeGroup    LogAlertScope = "group"    // 指定分组内的隧道
+	LogAlertScopeEndpoint LogAlertScope = "endpoint" // 指定主控上的隧道
+)
+
+// LogAlertRule 日志告警规则表 - GORM模型
+// 窗口期内匹配的日志行数达到阈值即产生一条告警，同一隧道在冷却期内不重复告警
+type LogAlertRule struct {
+	ID          int64         `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name        string        `json:"name" gorm:"type:text;not null;column:name"`
+	Enabled     bool          `json:"enabled" gorm:"column:enabled"`
+	Pattern     string        `json:"pattern" gorm:"type:text;column:pattern"`               // 正则表达式，为空表示只按级别匹配
+	Levels      []string      `json:"levels" gorm:"type:text;serializer:json;column:levels"` // 日志级别，如 ERROR、WARN，为空表示不限
+	ScopeType   LogAlertScope `json:"scopeType" gorm:"type:text;not null;default:all;column:scope_type"`
+	ScopeIDs    []int64       `json:"scopeIds" gorm:"type:text;serializer:json;column:scope_ids"` // 隧道/分组/主控 ID
+	Threshold   int           `json:"threshold" gorm:"default:1;column:threshold"`                // 窗口期内匹配行数阈值
+	WindowSec   int           `json:"windowSec" gorm:"default:60;column:window_sec"`              // 统计窗口秒数
+	CooldownSec int           `json:"cooldownSec" gorm:"default:300;column:cooldown_sec"`         // 同一隧道两次告警的最小间隔
+	SampleSize  int           `json:"sampleSize" gorm:"default:5;column:sample_size"`             // 告警附带的样例行数
+	CreatedAt   time.Time     `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt   time.Time     `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (LogAlertRule) TableName() string {
+	return "log_alert_rules"
+}
+
+// LogAlert 日志告警记录表 - GORM模型
+type LogAlert struct {
+	ID             int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	RuleID         int64     `json:"ruleId" gorm:"not null;index;column:rule_id"`
+	RuleName       string    `json:"ruleName" gorm:"type:text;column:rule_name"`
+	EndpointID     int64     `json:"endpointId" gorm:"index;column:endpoint_id"`
+	InstanceID     string    `json:"instanceId" gorm:"type:text;column:instance_id"`
+	TunnelID       int64     `json:"tunnelId" gorm:"index;column:tunnel_id"`
+	TunnelName     string    `json:"tunnelName" gorm:"type:text;column:tunnel_name"`
+	Count          int       `json:"count" gorm:"column:count"` // 触发时窗口期内的匹配行数
+	WindowSec      int       `json:"windowSec" gorm:"column:window_sec"`
+	Samples        []string  `json:"samples" gorm:"type:text;serializer:json;column:samples"`
+	Acknowledged   bool      `json:"acknowledged" gorm:"index;column:acknowledged"`
+	AcknowledgedAt NullTime  `json:"acknowledgedAt" gorm:"column:acknowledged_at"`
+	CreatedAt      time.Time `json:"createdAt" gorm:"autoCreateTime;index;column:created_at"`
+}
+
+// TableName 设置表名
+func (LogAlert) TableName() string {
+	return "log_alerts"
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// LogSinkType 日志外发目标类型
+type LogSinkType string
+
+const (
+	LogSinkSyslog LogSinkType = "syslog" // RFC 5424 syslog，URL 形如 udp://host:514、tcp://host:601、tls://host:6514
+	LogSinkLoki   LogSinkType = "loki"   // Loki 推送接口，URL 形如 http://loki:3100/loki/api/v1/push
+	LogSinkHTTP   LogSinkType = "http"   // 通用 HTTP JSON 批量推送
+)
+
+// LogSink 隧道日志外发目标表 - GORM模型
+type LogSink struct {
+	ID               int64             `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name             string            `json:"name" gorm:"type:text;not null;column:name"`
+	Type             LogSinkType       `json:"type" gorm:"type:text;not null;column:type"`
+	Enabled          bool              `json:"enabled" gorm:"column:enabled"`
+	URL              string            `json:"url" gorm:"type:text;not null;column:url"`
+	Headers          map[string]string `json:"headers" gorm:"type:text;serializer:json;column:headers"` // HTTP 请求头，如认证信息
+	Labels           map[string]string `json:"labels" gorm:"type:text;serializer:json;column:labels"`   // 附加的固定标签
+	TLSSkipVerify    bool              `json:"tlsSkipVerify" gorm:"column:tls_skip_verify"`
+	BufferSize       int               `json:"bufferSize" gorm:"default:1000;column:buffer_size"`           // 缓冲队列长度，满后丢弃新日志
+	BatchSize        int               `json:"batchSize" gorm:"default:100;column:batch_size"`              // 单次推送的最大条数
+	FlushIntervalSec int               `json:"flushIntervalSec" gorm:"default:2;column:flush_interval_sec"` // 未满批时的推送间隔
+	MaxRetries       int               `json:"maxRetries" gorm:"default:3;column:max_retries"`              // 推送失败后的重试次数
+	CreatedAt        time.Time         `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt        time.Time         `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (LogSink) TableName() string {
+	return "log_sinks"
+}
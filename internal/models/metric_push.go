@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// MetricPushFormat 指标推送格式
+type MetricPushFormat string
+
+const (
+	MetricPushOTLP   MetricPushFormat = "otlp"   // OTLP/HTTP JSON，URL 形如 http://collector:4318/v1/metrics
+	MetricPushInflux MetricPushFormat = "influx" // InfluxDB 行协议，URL 形如 http://influx:8086/api/v2/write?org=o&bucket=b&precision=ns
+)
+
+// MetricPushTarget 指标推送目标表 - GORM模型
+// 定期将 service_history 中新写入的隧道与端点聚合数据推送到外部时序库
+type MetricPushTarget struct {
+	ID            int64             `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name          string            `json:"name" gorm:"type:text;not null;column:name"`
+	Format        MetricPushFormat  `json:"format" gorm:"type:text;not null;column:format"`
+	Enabled       bool              `json:"enabled" gorm:"column:enabled"`
+	URL           string            `json:"url" gorm:"type:text;not null;column:url"`
+	Headers       map[string]string `json:"headers" gorm:"type:text;serializer:json;column:headers"`        // HTTP 请求头，如 Authorization
+	TagMapping    map[string]string `json:"tagMapping" gorm:"type:text;serializer:json;column:tag_mapping"` // 标签重命名，源标签 -> 目标标签，目标为空表示丢弃
+	ExtraTags     map[string]string `json:"extraTags" gorm:"type:text;serializer:json;column:extra_tags"`   // 附加的固定标签
+	TLSSkipVerify bool              `json:"tlsSkipVerify" gorm:"column:tls_skip_verify"`
+	IntervalSec   int               `json:"intervalSec" gorm:"default:60;column:interval_sec"`     // 推送间隔
+	BufferSize    int               `json:"bufferSize" gorm:"default:10000;column:buffer_size"`    // 推送失败时保留待重试的数据点上限，超出丢弃最旧的
+	LastHistoryID int64             `json:"lastHistoryId" gorm:"default:0;column:last_history_id"` // 已送达（或因缓冲已满丢弃）的 service_history 记录 ID，重启后从此处继续读取
+	CreatedAt     time.Time         `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt     time.Time         `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (MetricPushTarget) TableName() string {
+	return "metric_push_targets"
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -35,6 +36,27 @@ func (Endpoint) TableName() string {
 	return "endpoints"
 }
 
+// Host 主控对外地址，优先使用 hostname，缺失时从 URL 中提取
+func (e *Endpoint) Host() string {
+	if e.Hostname != "" {
+		return e.Hostname
+	}
+	host := strings.TrimPrefix(e.URL, "http://")
+	host = strings.TrimPrefix(host, "https://")
+	if idx := strings.Index(host, "/"); idx != -1 {
+		host = host[:idx]
+	}
+	if strings.HasPrefix(host, "[") {
+		if idx := strings.Index(host, "]"); idx != -1 {
+			return host[1:idx]
+		}
+	}
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return host
+}
+
 // Peer 表示隧道的对端信息
 type Peer struct {
 	SID   *string `json:"sid"`
@@ -150,6 +172,27 @@ func (Services) TableName() string {
 	return "services"
 }
 
+// ServiceTypeChain 多跳链路服务类型，跨越三个及以上主控，由 service_hops 记录每一跳
+const ServiceTypeChain = "8"
+
+// ServiceHop 多跳链路服务中的单跳，每跳由一对 client/server 实例组成
+type ServiceHop struct {
+	ID               int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Sid              string    `json:"sid" gorm:"type:text;not null;index;column:sid"`
+	HopIndex         int       `json:"hopIndex" gorm:"not null;column:hop_index"`
+	ClientEndpointID int64     `json:"clientEndpointId" gorm:"not null;column:client_endpoint_id"`
+	ClientInstanceID string    `json:"clientInstanceId" gorm:"type:text;column:client_instance_id"`
+	ServerEndpointID int64     `json:"serverEndpointId" gorm:"not null;column:server_endpoint_id"`
+	ServerInstanceID string    `json:"serverInstanceId" gorm:"type:text;column:server_instance_id"`
+	TunnelPort       int       `json:"tunnelPort" gorm:"column:tunnel_port"`
+	CreatedAt        time.Time `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+}
+
+// TableName 设置表名
+func (ServiceHop) TableName() string {
+	return "service_hops"
+}
+
 // TunnelOperationLog 操作日志表 - GORM模型
 type TunnelOperationLog struct {
 	ID         int64           `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
@@ -200,6 +243,7 @@ func (UserSession) TableName() string {
 type Group struct {
 	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
 	Name      string    `json:"name" gorm:"type:text;uniqueIndex;not null;column:name"`
+	ParentID  *int64    `json:"parent_id,omitempty" gorm:"index;column:parent_id"` // 父分组，为空表示顶级分组
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime;index;column:created_at"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime;column:updated_at"`
 
@@ -265,6 +309,14 @@ type ServiceHistory struct {
 	AvgSpeedIn  float64 `json:"avgSpeedIn" gorm:"default:0;column:avg_speed_in"`   // 平均入站速度 (TCP+UDP)
 	AvgSpeedOut float64 `json:"avgSpeedOut" gorm:"default:0;column:avg_speed_out"` // 平均出站速度 (TCP+UDP)
 
+	// 延迟分布（基于流式分位数草图）
+	P50Ping    float64         `json:"p50Ping" gorm:"default:0;column:p50_ping"`                // 延迟中位数
+	P90Ping    float64         `json:"p90Ping" gorm:"default:0;column:p90_ping"`                // 延迟 P90
+	P99Ping    float64         `json:"p99Ping" gorm:"default:0;column:p99_ping"`                // 延迟 P99
+	MaxPing    float64         `json:"maxPing" gorm:"default:0;column:max_ping"`                // 最大延迟
+	JitterPing float64         `json:"jitterPing" gorm:"default:0;column:jitter_ping"`          // 延迟抖动（标准差）
+	PingSketch string          `json:"-" gorm:"type:text;column:ping_sketch"`                  // 延迟草图的 JSON 编码（latency.Encode），用于跨记录合并分位数
+
 	// 统计信息
 	RecordCount int       `json:"recordCount" gorm:"default:0;column:record_count"`    // 参与聚合的数据点数量
 	UpCount     int       `json:"upCount" gorm:"default:0;column:up_count"`            // 在线次数（用于加权平均）
@@ -305,3 +357,18 @@ type EndpointSSE struct {
 func (EndpointSSE) TableName() string {
 	return "endpoint_sse_events"
 }
+
+// TunnelSavedQuery 已保存的隧道查询语句 - GORM模型
+type TunnelSavedQuery struct {
+	ID          int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Name        string    `json:"name" gorm:"type:text;uniqueIndex;not null;column:name"`
+	Query       string    `json:"query" gorm:"type:text;not null;column:query"`
+	Description *string   `json:"description,omitempty" gorm:"type:text;column:description"`
+	CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (TunnelSavedQuery) TableName() string {
+	return "tunnel_saved_queries"
+}
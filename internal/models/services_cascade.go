@@ -39,6 +39,9 @@ func CleanupServicesForInstance(db *gorm.DB, endpointID int64, instanceID string
 				Delete(&Services{}).Error; err != nil {
 				return err
 			}
+			if err := db.Where("sid = ?", svc.Sid).Delete(&ServiceHop{}).Error; err != nil {
+				return err
+			}
 			continue
 		}
 
@@ -61,6 +64,18 @@ func CleanupServicesForInstance(db *gorm.DB, endpointID int64, instanceID string
 		}
 	}
 
+	// 多跳链路的中间跳不在 services 行上，单独把 service_hops 中对应的实例置空
+	if err := db.Model(&ServiceHop{}).
+		Where("client_endpoint_id = ? AND client_instance_id = ?", endpointID, instanceID).
+		Update("client_instance_id", "").Error; err != nil {
+		return err
+	}
+	if err := db.Model(&ServiceHop{}).
+		Where("server_endpoint_id = ? AND server_instance_id = ?", endpointID, instanceID).
+		Update("server_instance_id", "").Error; err != nil {
+		return err
+	}
+
 	// 与隧道一起，把 tunnels.service_sid / peer 引用也同步清掉，避免列表里出现指向死服务的隧道
 	_ = db.Model(&Tunnel{}).
 		Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).
@@ -98,6 +113,9 @@ func CleanupServicesForEndpoint(db *gorm.DB, endpointID int64) error {
 				Delete(&Services{}).Error; err != nil {
 				return err
 			}
+			if err := db.Where("sid = ?", svc.Sid).Delete(&ServiceHop{}).Error; err != nil {
+				return err
+			}
 			continue
 		}
 
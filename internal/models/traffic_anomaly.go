@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// TrafficAnomalyKind 流量异常类型
+type TrafficAnomalyKind string
+
+const (
+	TrafficAnomalySpike TrafficAnomalyKind = "spike" // 流量突增（疑似滥用）
+	TrafficAnomalyDrop  TrafficAnomalyKind = "drop"  // 流量骤降（疑似上游故障）
+)
+
+// TrafficAnomalySeverity 流量异常严重程度
+type TrafficAnomalySeverity string
+
+const (
+	TrafficAnomalyInfo     TrafficAnomalySeverity = "info"
+	TrafficAnomalyWarning  TrafficAnomalySeverity = "warning"
+	TrafficAnomalyCritical TrafficAnomalySeverity = "critical"
+)
+
+// TrafficAnomalySource 检测所用的数据来源
+type TrafficAnomalySource string
+
+const (
+	TrafficAnomalyHourly TrafficAnomalySource = "hourly" // traffic_hourly_summary 整小时增量
+	TrafficAnomalyMinute TrafficAnomalySource = "minute" // service_history 最近若干分钟，折算为小时量
+)
+
+// TrafficBaseline 隧道按周内小时（0-167，本地时区，周日 0 点为 0）划分的季节性基线 - GORM模型
+// Mean、Variance 为 log1p(每小时字节数) 的指数加权均值与方差
+type TrafficBaseline struct {
+	ID         int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	EndpointID int64     `json:"endpointId" gorm:"not null;uniqueIndex:idx_traffic_baseline_slot,priority:1;column:endpoint_id"`
+	InstanceID string    `json:"instanceId" gorm:"type:text;not null;uniqueIndex:idx_traffic_baseline_slot,priority:2;column:instance_id"`
+	Slot       int       `json:"slot" gorm:"not null;uniqueIndex:idx_traffic_baseline_slot,priority:3;column:slot"`
+	Mean       float64   `json:"mean" gorm:"default:0;column:mean"`
+	Variance   float64   `json:"variance" gorm:"default:0;column:variance"`
+	Samples    int       `json:"samples" gorm:"default:0;column:samples"`
+	UpdatedAt  time.Time `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (TrafficBaseline) TableName() string {
+	return "traffic_baselines"
+}
+
+// TrafficAnomalyState 单个隧道的检测状态 - GORM模型
+// 包含不分时段的短期 EWMA 基线（季节性样本不足时使用）、整小时检测进度，
+// 以及由误报反馈调整的阈值倍数
+type TrafficAnomalyState struct {
+	ID             int64     `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	EndpointID     int64     `json:"endpointId" gorm:"not null;uniqueIndex:idx_traffic_anomaly_state,priority:1;column:endpoint_id"`
+	InstanceID     string    `json:"instanceId" gorm:"type:text;not null;uniqueIndex:idx_traffic_anomaly_state,priority:2;column:instance_id"`
+	LastHour       NullTime  `json:"lastHour" gorm:"column:last_hour"` // 最后一个已检测的整小时
+	Mean           float64   `json:"mean" gorm:"default:0;column:mean"`
+	Variance       float64   `json:"variance" gorm:"default:0;column:variance"`
+	Samples        int       `json:"samples" gorm:"default:0;column:samples"`
+	SpikeFactor    float64   `json:"spikeFactor" gorm:"default:1;column:spike_factor"` // 突增阈值倍数
+	DropFactor     float64   `json:"dropFactor" gorm:"default:1;column:drop_factor"`   // 骤降阈值倍数
+	FalsePositives int       `json:"falsePositives" gorm:"default:0;column:false_positives"`
+	UpdatedAt      time.Time `json:"updatedAt" gorm:"autoUpdateTime;column:updated_at"`
+}
+
+// TableName 设置表名
+func (TrafficAnomalyState) TableName() string {
+	return "traffic_anomaly_states"
+}
+
+// TrafficAnomaly 流量异常事件 - GORM模型
+type TrafficAnomaly struct {
+	ID            int64                  `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	EndpointID    int64                  `json:"endpointId" gorm:"index;column:endpoint_id"`
+	InstanceID    string                 `json:"instanceId" gorm:"type:text;index;column:instance_id"`
+	TunnelID      int64                  `json:"tunnelId" gorm:"index;column:tunnel_id"`
+	TunnelName    string                 `json:"tunnelName" gorm:"type:text;column:tunnel_name"`
+	Kind          TrafficAnomalyKind     `json:"kind" gorm:"type:text;not null;column:kind"`
+	Severity      TrafficAnomalySeverity `json:"severity" gorm:"type:text;not null;column:severity"`
+	Source        TrafficAnomalySource   `json:"source" gorm:"type:text;not null;column:source"`
+	WindowStart   time.Time              `json:"windowStart" gorm:"column:window_start"`
+	WindowEnd     time.Time              `json:"windowEnd" gorm:"column:window_end"`
+	Observed      float64                `json:"observed" gorm:"column:observed"` // 观测值（字节/小时）
+	Expected      float64                `json:"expected" gorm:"column:expected"` // 基线期望值（字节/小时）
+	Score         float64                `json:"score" gorm:"column:score"`       // 偏离程度（log 空间的标准分数）
+	Threshold     float64                `json:"threshold" gorm:"column:threshold"`
+	Context       map[string]interface{} `json:"context" gorm:"type:text;serializer:json;column:context"`
+	FalsePositive bool                   `json:"falsePositive" gorm:"index;column:false_positive"`
+	FeedbackAt    NullTime               `json:"feedbackAt" gorm:"column:feedback_at"`
+	CreatedAt     time.Time              `json:"createdAt" gorm:"autoCreateTime;index;column:created_at"`
+}
+
+// TableName 设置表名
+func (TrafficAnomaly) TableName() string {
+	return "traffic_anomalies"
+}
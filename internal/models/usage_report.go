@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// UsageReportGroupBy 用量报表的分组维度
+type UsageReportGroupBy string
+
+const (
+	UsageGroupByTunnel   UsageReportGroupBy = "tunnel"
+	UsageGroupByEndpoint UsageReportGroupBy = "endpoint"
+	UsageGroupByGroup    UsageReportGroupBy = "group"   // 隧道计入所属的每个分组及其全部上级分组，各行之和可能大于按实例去重的合计
+	UsageGroupByService  UsageReportGroupBy = "service" // 服务的流量为其各端隧道之和
+	UsageGroupByTag      UsageReportGroupBy = "tag"     // 按指定标签键的取值分组
+)
+
+// UsageReportRow 用量报表中的一行（或合计行）
+type UsageReportRow struct {
+	Key      string    `json:"key"`
+	Name     string    `json:"name"`
+	Tunnels  int       `json:"tunnels"`
+	TCPRx    int64     `json:"tcpRx"`
+	TCPTx    int64     `json:"tcpTx"`
+	UDPRx    int64     `json:"udpRx"`
+	UDPTx    int64     `json:"udpTx"`
+	Rx       int64     `json:"rx"`
+	Tx       int64     `json:"tx"`
+	Total    int64     `json:"total"`
+	PeakRate float64   `json:"peakRate"` // 峰值速率（字节/秒），取流量最大的整小时的平均速率
+	PeakAt   time.Time `json:"peakAt"`   // 峰值所在整小时的开始时间
+}
+
+// UsageReport 用量报表 - GORM模型
+// 按需生成的报表不落库；每月预生成的报表以 Period（如 2024-05）保存
+type UsageReport struct {
+	ID          int64              `json:"id" gorm:"primaryKey;autoIncrement;column:id"`
+	Period      string             `json:"period" gorm:"type:text;not null;uniqueIndex:idx_usage_report_period,priority:1;column:period"`
+	GroupBy     UsageReportGroupBy `json:"groupBy" gorm:"type:text;not null;uniqueIndex:idx_usage_report_period,priority:2;column:group_by"`
+	TagKey      string             `json:"tagKey" gorm:"type:text;uniqueIndex:idx_usage_report_period,priority:3;column:tag_key"`
+	Timezone    string             `json:"timezone" gorm:"type:text;uniqueIndex:idx_usage_report_period,priority:4;column:timezone"`
+	RangeStart  time.Time          `json:"rangeStart" gorm:"column:range_start"`
+	RangeEnd    time.Time          `json:"rangeEnd" gorm:"column:range_end"`
+	Rows        []UsageReportRow   `json:"rows,omitempty" gorm:"type:text;serializer:json;column:rows"`
+	Total       UsageReportRow     `json:"total" gorm:"type:text;serializer:json;column:total"`
+	GeneratedAt time.Time          `json:"generatedAt" gorm:"autoCreateTime;index;column:generated_at"`
+}
+
+// TableName 设置表名
+func (UsageReport) TableName() string {
+	return "usage_reports"
+}
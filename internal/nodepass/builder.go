@@ -0,0 +1,392 @@
+package nodepass
+
+import (
+	"NodePassDash/internal/models"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError 单个字段的校验错误，Field 与 URL 参数名保持一致
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors 配置校验错误列表
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for _, e := range v {
+		parts = append(parts, e.Field+": "+e.Message)
+	}
+	return "隧道配置无效: " + strings.Join(parts, "; ")
+}
+
+func (v *ValidationErrors) add(field, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// knownQueryParams 构建器会输出的全部查询参数
+var knownQueryParams = map[string]bool{
+	"log": true, "tls": true, "crt": true, "key": true, "min": true, "max": true,
+	"mode": true, "read": true, "rate": true, "slot": true, "proxy": true, "type": true,
+	"dial": true, "dns": true, "sni": true, "block": true, "lbs": true,
+	"notcp": true, "noudp": true,
+}
+
+// BuildURL 生成规范化的隧道 URL
+// 参数顺序固定，IPv6 地址自动加方括号，输出可被 ParseTunnelConfig / ParseTunnelURL 无损解析
+func (c *TunnelConfig) BuildURL() string {
+	protocol := c.Type
+	if protocol == "" {
+		protocol = "client" // 默认协议
+	}
+
+	var b strings.Builder
+	b.WriteString(protocol + "://")
+	if c.Password != "" {
+		b.WriteString(c.Password + "@")
+	}
+	b.WriteString(joinAddressPort(c.TunnelAddress, c.TunnelPort))
+
+	if c.TargetAddress != "" || c.TargetPort != "" || len(c.ExtendTargetAddresses) > 0 {
+		b.WriteString("/" + joinAddressPort(c.TargetAddress, c.TargetPort))
+		for _, extend := range c.ExtendTargetAddresses {
+			addr, port := parseAddressPort(extend)
+			b.WriteString("," + joinAddressPort(addr, port))
+		}
+	}
+
+	params := []string{}
+	add := func(key, val string) {
+		if val != "" {
+			params = append(params, key+"="+val)
+		}
+	}
+	add("log", c.LogLevel)
+	if protocol == "server" {
+		add("tls", c.TLSMode)
+	}
+	add("crt", url.QueryEscape(c.CertPath))
+	add("key", url.QueryEscape(c.KeyPath))
+	add("min", c.Min)
+	add("max", c.Max)
+	add("mode", c.Mode)
+	add("read", c.Read)
+	add("rate", c.Rate)
+	add("slot", c.Slot)
+	add("proxy", c.Proxy)
+	add("type", c.PoolType)
+	add("dial", url.QueryEscape(c.Dial))
+	add("dns", c.Dns)
+	add("sni", c.Sni)
+	add("block", c.Block)
+	add("lbs", c.Lbs)
+
+	// 根据listenType生成notcp和noudp参数
+	switch c.ListenType {
+	case "TCP":
+		params = append(params, "notcp=0", "noudp=1")
+	case "UDP":
+		params = append(params, "notcp=1", "noudp=0")
+	case "ALL":
+		params = append(params, "notcp=0", "noudp=0")
+	}
+
+	if len(params) > 0 {
+		b.WriteString("?" + strings.Join(params, "&"))
+	}
+	return b.String()
+}
+
+// joinAddressPort 拼接 addr:port，裸 IPv6 地址补全方括号
+func joinAddressPort(addr, port string) string {
+	if strings.Contains(addr, ":") && !strings.HasPrefix(addr, "[") {
+		addr = "[" + addr + "]"
+	}
+	if port == "" {
+		return addr
+	}
+	return addr + ":" + port
+}
+
+// NewTunnelConfig 从隧道模型生成配置，inherit 视为未设置
+func NewTunnelConfig(tunnel models.Tunnel) *TunnelConfig {
+	cfg := &TunnelConfig{
+		Type:          string(tunnel.Type),
+		TunnelAddress: tunnel.TunnelAddress,
+		TunnelPort:    tunnel.TunnelPort,
+		TargetAddress: tunnel.TargetAddress,
+		TargetPort:    tunnel.TargetPort,
+	}
+	if tunnel.ExtendTargetAddress != nil {
+		cfg.ExtendTargetAddresses = append(cfg.ExtendTargetAddresses, *tunnel.ExtendTargetAddress...)
+	}
+	if tunnel.LogLevel != models.LogLevelInherit && tunnel.LogLevel != "inherit" {
+		cfg.LogLevel = string(tunnel.LogLevel)
+	}
+	if tunnel.TLSMode != models.TLSModeInherit && tunnel.TLSMode != "inherit" {
+		cfg.TLSMode = string(tunnel.TLSMode)
+	}
+
+	str := func(p *string) string {
+		if p == nil {
+			return ""
+		}
+		return *p
+	}
+	i64 := func(p *int64) string {
+		if p == nil {
+			return ""
+		}
+		return strconv.FormatInt(*p, 10)
+	}
+	i := func(p *int) string {
+		if p == nil {
+			return ""
+		}
+		return strconv.Itoa(*p)
+	}
+
+	cfg.Password = str(tunnel.Password)
+	cfg.CertPath = str(tunnel.CertPath)
+	cfg.KeyPath = str(tunnel.KeyPath)
+	cfg.Min = i64(tunnel.Min)
+	cfg.Max = i64(tunnel.Max)
+	if tunnel.Mode != nil {
+		cfg.Mode = strconv.Itoa(int(*tunnel.Mode))
+	}
+	cfg.Read = str(tunnel.Read)
+	cfg.Rate = i64(tunnel.Rate)
+	cfg.Slot = i64(tunnel.Slot)
+	if tunnel.ProxyProtocol != nil {
+		cfg.Proxy = "0"
+		if *tunnel.ProxyProtocol {
+			cfg.Proxy = "1"
+		}
+	}
+	cfg.PoolType = i(tunnel.PoolType)
+	cfg.Dial = str(tunnel.Dial)
+	cfg.Dns = str(tunnel.Dns)
+	cfg.Sni = str(tunnel.Sni)
+	cfg.Block = i(tunnel.Block)
+	cfg.Lbs = i(tunnel.Lbs)
+	cfg.ListenType = str(tunnel.ListenType)
+	return cfg
+}
+
+// Normalize 清除当前角色下不会生效的参数：客户端的 tls，非 tls=2 时的证书，服务端的 min 与 sni
+func (c *TunnelConfig) Normalize() *TunnelConfig {
+	if c.Type != "server" {
+		c.TLSMode = ""
+	}
+	if c.TLSMode != "2" {
+		c.CertPath, c.KeyPath = "", ""
+	}
+	if c.Type == "server" {
+		c.Min, c.Sni = "", ""
+	}
+	return c
+}
+
+// Validate 校验字段取值范围与参数组合，返回逐字段的错误列表
+func (c *TunnelConfig) Validate() ValidationErrors {
+	var errs ValidationErrors
+	isServer := c.Type == "server"
+
+	switch c.Type {
+	case "server", "client":
+	default:
+		errs.add("protocol", "隧道类型必须为 server 或 client")
+	}
+
+	checkAddress(&errs, "tunnel_address", c.TunnelAddress)
+	checkPort(&errs, "tunnel_port", c.TunnelPort, true)
+	checkAddress(&errs, "target_address", c.TargetAddress)
+	checkPort(&errs, "target_port", c.TargetPort, true)
+	for _, extend := range c.ExtendTargetAddresses {
+		addr, port := parseAddressPort(extend)
+		if addr == "" || port == "" {
+			errs.add("extend_target_address", "扩展目标地址 %q 必须为 host:port 格式", extend)
+			continue
+		}
+		checkAddress(&errs, "extend_target_address", addr)
+		checkPort(&errs, "extend_target_address", port, true)
+	}
+
+	if c.Password != "" && strings.ContainsAny(c.Password, "@/?#:& \t") {
+		errs.add("password", "密码不能包含 @ / ? # : & 或空白字符")
+	}
+
+	// TLS 相关：仅服务端可设置，tls=2 需要证书与私钥
+	if c.TLSMode != "" {
+		if !isServer {
+			errs.add("tls", "tls 仅适用于服务端")
+		} else if !oneOf(c.TLSMode, "0", "1", "2") {
+			errs.add("tls", "tls 取值必须为 0、1 或 2")
+		}
+	}
+	if c.TLSMode == "2" && isServer {
+		if c.CertPath == "" {
+			errs.add("crt", "tls=2 时必须提供证书路径")
+		}
+		if c.KeyPath == "" {
+			errs.add("key", "tls=2 时必须提供私钥路径")
+		}
+	} else {
+		if c.CertPath != "" {
+			errs.add("crt", "证书路径仅在服务端 tls=2 时有效")
+		}
+		if c.KeyPath != "" {
+			errs.add("key", "私钥路径仅在服务端 tls=2 时有效")
+		}
+	}
+
+	if c.LogLevel != "" && !oneOf(c.LogLevel, "debug", "info", "warn", "error", "event", "none") {
+		errs.add("log", "日志级别必须为 debug、info、warn、error、event 或 none")
+	}
+
+	// 连接池容量：min 仅客户端有效
+	minVal, minOK := checkInt(&errs, "min", c.Min, 1, 0)
+	maxVal, maxOK := checkInt(&errs, "max", c.Max, 1, 0)
+	if c.Min != "" && isServer {
+		errs.add("min", "min 仅适用于客户端")
+	}
+	if minOK && maxOK && minVal > maxVal {
+		errs.add("min", "min 不能大于 max")
+	}
+
+	if c.Mode != "" && !oneOf(c.Mode, "0", "1", "2") {
+		errs.add("mode", "mode 取值必须为 0、1 或 2")
+	}
+	if c.Read != "" && c.Read != "0" {
+		if d, err := time.ParseDuration(c.Read); err != nil || d < 0 {
+			errs.add("read", "read 必须为有效时长，如 30s、10m、1h")
+		}
+	}
+	checkInt(&errs, "rate", c.Rate, 0, 0)
+	checkInt(&errs, "slot", c.Slot, 0, 0)
+	if c.Proxy != "" && !oneOf(c.Proxy, "0", "1") {
+		errs.add("proxy", "proxy 取值必须为 0 或 1")
+	}
+	checkInt(&errs, "type", c.PoolType, 0, 3)
+	checkInt(&errs, "block", c.Block, 0, 3)
+	checkInt(&errs, "lbs", c.Lbs, 0, 2)
+
+	if c.Dial != "" && c.Dial != "auto" && net.ParseIP(strings.Trim(c.Dial, "[]")) == nil {
+		errs.add("dial", "dial 必须为 auto 或有效的 IP 地址")
+	}
+	if c.Dns != "" {
+		for _, server := range strings.Split(c.Dns, ",") {
+			if server == "" || strings.ContainsAny(server, "&?#/ \t") {
+				errs.add("dns", "DNS 服务器 %q 无效", server)
+			}
+		}
+	}
+	if c.Sni != "" {
+		if isServer {
+			errs.add("sni", "sni 仅适用于客户端")
+		} else if strings.ContainsAny(c.Sni, "&?#/: \t") {
+			errs.add("sni", "sni 必须为有效的主机名")
+		}
+	}
+
+	if c.ListenType != "" && !oneOf(c.ListenType, "ALL", "TCP", "UDP") {
+		errs.add("listen_type", "监听类型必须为 ALL、TCP 或 UDP")
+	}
+
+	return errs
+}
+
+// ValidateTunnelURL 解析并校验隧道 URL，额外报告结构错误
+// 未知参数可能来自更新版本的 NodePass，不视为错误，见 UnknownQueryParams
+func ValidateTunnelURL(rawURL string) (*TunnelConfig, ValidationErrors) {
+	rawURL = strings.TrimSpace(rawURL)
+	cfg := ParseTunnelConfig(rawURL)
+
+	var errs ValidationErrors
+	if !strings.Contains(rawURL, "://") {
+		errs.add("protocol", "URL 必须以 server:// 或 client:// 开头")
+	}
+	return cfg, append(errs, cfg.Validate()...)
+}
+
+// UnknownQueryParams 返回构建器不认识的查询参数（原样的 key=value 片段），调用方应告警并原样透传
+func UnknownQueryParams(rawURL string) []string {
+	rawURL = strings.TrimSpace(rawURL)
+	idx := strings.Index(rawURL, "?")
+	if idx == -1 {
+		return nil
+	}
+	var unknown []string
+	for _, kv := range strings.Split(rawURL[idx+1:], "&") {
+		if kv == "" {
+			continue
+		}
+		if key := strings.SplitN(kv, "=", 2)[0]; !knownQueryParams[key] {
+			unknown = append(unknown, kv)
+		}
+	}
+	return unknown
+}
+
+// AppendQueryParams 将原样的 key=value 片段附加到 URL 末尾
+func AppendQueryParams(rawURL string, params []string) string {
+	for _, kv := range params {
+		if strings.Contains(rawURL, "?") {
+			rawURL += "&" + kv
+		} else {
+			rawURL += "?" + kv
+		}
+	}
+	return rawURL
+}
+
+func checkAddress(errs *ValidationErrors, field, addr string) {
+	if strings.ContainsAny(addr, "/?#&@, \t") {
+		errs.add(field, "地址 %q 包含非法字符", addr)
+	}
+}
+
+func checkPort(errs *ValidationErrors, field, port string, required bool) {
+	if port == "" {
+		if required {
+			errs.add(field, "端口不能为空")
+		}
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		errs.add(field, "端口 %q 必须在 1-65535 之间", port)
+	}
+}
+
+// checkInt 校验整数参数，max 为 0 表示无上限
+func checkInt(errs *ValidationErrors, field, val string, min, max int64) (int64, bool) {
+	if val == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < min || (max > 0 && n > max) {
+		if max > 0 {
+			errs.add(field, "%s 必须为 %d-%d 之间的整数", field, min, max)
+		} else {
+			errs.add(field, "%s 必须为不小于 %d 的整数", field, min)
+		}
+		return 0, false
+	}
+	return n, true
+}
+
+func oneOf(val string, options ...string) bool {
+	for _, o := range options {
+		if val == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package nodepass
+
+import "testing"
+
+func TestBuildURLRoundTrip(t *testing.T) {
+	cases := []string{
+		"server://:10101/127.0.0.1:8080?log=info&tls=2&crt=%2Fetc%2Fcert.pem&key=%2Fetc%2Fkey.pem&max=1024&mode=2",
+		"client://pass@1.2.3.4:10101/127.0.0.1:8080,10.0.0.2:8080?min=64&read=30s&rate=100&dial=auto&sni=example.com&lbs=1&notcp=0&noudp=1",
+		"client://[2001:db8::1]:10101/[::1]:22?log=debug&proxy=1&type=1&dns=1.1.1.1,8.8.8.8",
+		"server://:443/:80",
+	}
+	for _, raw := range cases {
+		built := ParseTunnelConfig(raw).BuildURL()
+		if built != raw {
+			t.Errorf("round trip mismatch\n got %s\nwant %s", built, raw)
+		}
+		if again := ParseTunnelConfig(built).BuildURL(); again != built {
+			t.Errorf("build not idempotent: %s -> %s", built, again)
+		}
+	}
+
+	// 裸 IPv6 地址补全方括号，模型解析结果一致
+	cfg := &TunnelConfig{Type: "client", TunnelAddress: "::1", TunnelPort: "10101", TargetAddress: "fe80::2", TargetPort: "80"}
+	want := "client://[::1]:10101/[fe80::2]:80"
+	if got := cfg.BuildURL(); got != want {
+		t.Errorf("BuildURL()=%s want %s", got, want)
+	}
+	if got := BuildTunnelURLs(*ParseTunnelURL(want)); got != want {
+		t.Errorf("BuildTunnelURLs(ParseTunnelURL())=%s want %s", got, want)
+	}
+}
+
+func TestValidateTunnelURL(t *testing.T) {
+	cases := []struct {
+		url        string
+		wantFields []string
+	}{
+		{"server://:10101/127.0.0.1:8080?tls=1&log=info", nil},
+		{"server://:10101/127.0.0.1:8080?tls=2", []string{"crt", "key"}},
+		{"client://1.2.3.4:10101/127.0.0.1:8080?tls=1", []string{"tls"}},
+		{"server://:10101/127.0.0.1:8080?min=10&sni=a.com", []string{"min", "sni"}},
+		{"client://1.2.3.4:70000/127.0.0.1:8080?min=100&max=10", []string{"tunnel_port", "min"}},
+		{"client://1.2.3.4:10101/127.0.0.1:8080?log=verbose&read=abc&lbs=5&foo=1", []string{"log", "read", "lbs"}},
+		{"1.2.3.4:10101/127.0.0.1:8080", []string{"protocol", "protocol"}},
+	}
+	for _, tc := range cases {
+		_, errs := ValidateTunnelURL(tc.url)
+		got := make([]string, 0, len(errs))
+		for _, e := range errs {
+			got = append(got, e.Field)
+		}
+		if len(got) != len(tc.wantFields) {
+			t.Errorf("%s: fields=%v want %v", tc.url, got, tc.wantFields)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.wantFields[i] {
+				t.Errorf("%s: fields=%v want %v", tc.url, got, tc.wantFields)
+				break
+			}
+		}
+	}
+}
+
+func TestUnknownQueryParams(t *testing.T) {
+	got := UnknownQueryParams("server://:10101/127.0.0.1:8080?log=info&quic=1&foo")
+	if len(got) != 2 || got[0] != "quic=1" || got[1] != "foo" {
+		t.Errorf("unknown=%v want [quic=1 foo]", got)
+	}
+	if got := UnknownQueryParams("server://:10101/127.0.0.1:8080"); len(got) != 0 {
+		t.Errorf("unknown=%v want none", got)
+	}
+}
@@ -3,7 +3,6 @@ package nodepass
 import (
 	"NodePassDash/internal/models"
 	"encoding/json"
-	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
@@ -12,31 +11,31 @@ import (
 
 // TunnelConfig 表示解析后的隧道配置信息
 type TunnelConfig struct {
-	Type                  string // client 或 server
-	TunnelAddress         string
-	TunnelPort            string
-	TargetAddress         string
-	TargetPort            string
-	ExtendTargetAddresses []string // 扩展目标地址列表
-	ListenType            string   // ALL|TCP|UDP
-	TLSMode               string   // 空字符串表示不设置（inherit）
-	LogLevel              string   // 空字符串表示不设置（inherit）
-	CertPath              string
-	KeyPath               string
-	Password              string
-	Min                   string
-	Max                   string
-	Mode                  string
-	Read                  string
-	Rate                  string
-	Slot                  string
-	Proxy                 string // proxy protocol 支持 (0|1)
-	PoolType              string // 池类型 (0-TCP, 1-QUIC, 2-WebSocket, 3-HTTP/2)
-	Dial                  string // 出站源IP地址
-	Dns                   string // DNS服务器地址
-	Sni                   string // SNI服务器名称指示
-	Block                 string // 协议屏蔽 (0-禁用, 1-SOCKS, 2-HTTP, 3-TLS)
-	Lbs                   string // 负载均衡策略 (0-轮询转移, 1-最优延迟, 2-主备回落)
+	Type                  string   `json:"protocol"` // client 或 server
+	TunnelAddress         string   `json:"tunnel_address"`
+	TunnelPort            string   `json:"tunnel_port"`
+	TargetAddress         string   `json:"target_address"`
+	TargetPort            string   `json:"target_port"`
+	ExtendTargetAddresses []string `json:"extend_target_address,omitempty"` // 扩展目标地址列表 (host:port)
+	ListenType            string   `json:"listen_type,omitempty"`           // ALL|TCP|UDP
+	TLSMode               string   `json:"tls,omitempty"`                   // 空字符串表示不设置（inherit）
+	LogLevel              string   `json:"log,omitempty"`                   // 空字符串表示不设置（inherit）
+	CertPath              string   `json:"crt,omitempty"`
+	KeyPath               string   `json:"key,omitempty"`
+	Password              string   `json:"password,omitempty"`
+	Min                   string   `json:"min,omitempty"`
+	Max                   string   `json:"max,omitempty"`
+	Mode                  string   `json:"mode,omitempty"`
+	Read                  string   `json:"read,omitempty"`
+	Rate                  string   `json:"rate,omitempty"`
+	Slot                  string   `json:"slot,omitempty"`
+	Proxy                 string   `json:"proxy,omitempty"` // proxy protocol 支持 (0|1)
+	PoolType              string   `json:"type,omitempty"`  // 池类型 (0-TCP, 1-QUIC, 2-WebSocket, 3-HTTP/2)
+	Dial                  string   `json:"dial,omitempty"`  // 出站源IP地址
+	Dns                   string   `json:"dns,omitempty"`   // DNS服务器地址
+	Sni                   string   `json:"sni,omitempty"`   // SNI服务器名称指示
+	Block                 string   `json:"block,omitempty"` // 协议屏蔽 (0-禁用, 1-SOCKS, 2-HTTP, 3-TLS)
+	Lbs                   string   `json:"lbs,omitempty"`   // 负载均衡策略 (0-轮询转移, 1-最优延迟, 2-主备回落)
 }
 
 // ParseTunnelURL 解析隧道实例 URL 并返回 Tunnel 模型
@@ -406,57 +405,50 @@ func TunnelToMap(tunnel *models.Tunnel) map[string]interface{} {
 }
 
 // ParseTunnelConfig 解析隧道实例 URL 并返回 TunnelConfig
+// 与 ParseTunnelURL 使用相同的地址拆分规则（兼容 IPv6），扩展地址保留端口
 func ParseTunnelConfig(rawURL string) *TunnelConfig {
 	cfg := &TunnelConfig{}
 
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		return cfg
+	rest := strings.TrimSpace(rawURL)
+	if idx := strings.Index(rest, "://"); idx != -1 {
+		cfg.Type = rest[:idx]
+		rest = rest[idx+3:]
 	}
 
-	cfg.Type = u.Scheme
-	if u.User != nil {
-		cfg.Password = u.User.Username()
+	// 分离查询参数
+	var queryPart string
+	if qIdx := strings.Index(rest, "?"); qIdx != -1 {
+		queryPart = rest[qIdx+1:]
+		rest = rest[:qIdx]
 	}
 
-	hostPort := u.Host
-	if hostPort != "" {
-		parts := strings.Split(hostPort, ":")
-		if len(parts) >= 1 {
-			cfg.TunnelAddress = parts[0]
-		}
-		if len(parts) >= 2 {
-			cfg.TunnelPort = parts[1]
-		}
+	// 分离用户认证信息 (password@)
+	if atIdx := strings.Index(rest, "@"); atIdx != -1 {
+		cfg.Password = rest[:atIdx]
+		rest = rest[atIdx+1:]
 	}
 
-	pathParts := strings.Trim(u.Path, "/")
-	if pathParts != "" {
-		// 处理多个逗号分隔的地址
-		addresses := strings.Split(pathParts, ",")
-
-		// 处理第一个地址
-		targetParts := strings.Split(addresses[0], ":")
-		if len(targetParts) >= 1 {
-			cfg.TargetAddress = targetParts[0]
-		}
-		if len(targetParts) >= 2 {
-			cfg.TargetPort = targetParts[1]
-		}
+	// 分离路径
+	hostPart, pathPart := rest, ""
+	if pIdx := strings.Index(rest, "/"); pIdx != -1 {
+		hostPart = rest[:pIdx]
+		pathPart = strings.Trim(rest[pIdx+1:], "/")
+	}
+	cfg.TunnelAddress, cfg.TunnelPort = parseAddressPort(hostPart)
 
-		// 处理剩余的地址
-		if len(addresses) > 1 {
-			for i := 1; i < len(addresses); i++ {
-				extendAddr := strings.Split(addresses[i], ":")
-				if len(extendAddr) >= 1 && extendAddr[0] != "" {
-					cfg.ExtendTargetAddresses = append(cfg.ExtendTargetAddresses, extendAddr[0])
-				}
+	if pathPart != "" {
+		// 处理多个逗号分隔的地址，第一个为主目标
+		addresses := strings.Split(pathPart, ",")
+		cfg.TargetAddress, cfg.TargetPort = parseAddressPort(addresses[0])
+		for _, extend := range addresses[1:] {
+			if strings.TrimSpace(extend) != "" {
+				cfg.ExtendTargetAddresses = append(cfg.ExtendTargetAddresses, strings.TrimSpace(extend))
 			}
 		}
 	}
 
-	// 解析查询参数
-	query := u.Query()
+	// 解析查询参数（crt、key、dial 等由 ParseQuery 统一解码）
+	query, _ := url.ParseQuery(queryPart)
 	cfg.TLSMode = query.Get("tls")
 	cfg.LogLevel = query.Get("log")
 	cfg.CertPath = query.Get("crt")
@@ -469,14 +461,7 @@ func ParseTunnelConfig(rawURL string) *TunnelConfig {
 	cfg.Slot = query.Get("slot")
 	cfg.Proxy = query.Get("proxy")
 	cfg.PoolType = query.Get("type")
-	// dial 参数需要URL解码，因为可能包含IP地址等特殊字符
-	if dialVal := query.Get("dial"); dialVal != "" {
-		if decodedVal, err := url.QueryUnescape(dialVal); err == nil {
-			cfg.Dial = decodedVal
-		} else {
-			cfg.Dial = dialVal // 解码失败时使用原值
-		}
-	}
+	cfg.Dial = query.Get("dial")
 	noTCP := query.Get("notcp")
 	noUDP := query.Get("noudp")
 	cfg.Dns = query.Get("dns")
@@ -511,136 +496,9 @@ func ParseTunnelConfig(rawURL string) *TunnelConfig {
 	return cfg
 }
 
-// BuildTunnelURL 根据配置生成隧道 URL
+// BuildTunnelConfigURL 根据配置生成隧道 URL（等同于 BuildURL）
 func (c *TunnelConfig) BuildTunnelConfigURL() string {
-	protocol := c.Type
-	if protocol == "" {
-		protocol = "client" // 默认协议
-	}
-
-	var urlParts []string
-	urlParts = append(urlParts, protocol+"://")
-
-	// 添加密码
-	if c.Password != "" {
-		urlParts = append(urlParts, c.Password+"@")
-	}
-
-	// 添加隧道地址和端口
-	if c.TunnelAddress != "" || c.TunnelPort != "" {
-		if c.TunnelAddress != "" {
-			urlParts = append(urlParts, c.TunnelAddress)
-		}
-		if c.TunnelPort != "" {
-			urlParts = append(urlParts, ":"+c.TunnelPort)
-		}
-	}
-
-	// 添加目标地址和端口（包括扩展地址）
-	if c.TargetAddress != "" || c.TargetPort != "" || len(c.ExtendTargetAddresses) > 0 {
-		urlParts = append(urlParts, "/")
-		if c.TargetAddress != "" {
-			urlParts = append(urlParts, c.TargetAddress)
-		}
-		if c.TargetPort != "" {
-			urlParts = append(urlParts, ":"+c.TargetPort)
-		}
-
-		// 添加扩展地址（逗号分隔）
-		if len(c.ExtendTargetAddresses) > 0 {
-			for _, addr := range c.ExtendTargetAddresses {
-				urlParts = append(urlParts, ","+addr)
-			}
-		}
-	}
-
-	// 构建查询参数
-	var queryParams []string
-
-	// 只有非空才添加log参数
-	if c.LogLevel != "" {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", c.LogLevel))
-	}
-
-	// 只有server模式且非空才添加tls参数
-	if c.TLSMode != "" && protocol == "server" {
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", c.TLSMode))
-	}
-
-	if c.CertPath != "" {
-		queryParams = append(queryParams, fmt.Sprintf("crt=%s", url.QueryEscape(c.CertPath)))
-	}
-
-	if c.KeyPath != "" {
-		queryParams = append(queryParams, fmt.Sprintf("key=%s", url.QueryEscape(c.KeyPath)))
-	}
-
-	if c.Min != "" {
-		queryParams = append(queryParams, fmt.Sprintf("min=%s", c.Min))
-	}
-
-	if c.Max != "" {
-		queryParams = append(queryParams, fmt.Sprintf("max=%s", c.Max))
-	}
-
-	if c.Mode != "" {
-		queryParams = append(queryParams, fmt.Sprintf("mode=%s", c.Mode))
-	}
-
-	if c.Read != "" {
-		queryParams = append(queryParams, fmt.Sprintf("read=%s", c.Read))
-	}
-
-	if c.Rate != "" {
-		queryParams = append(queryParams, fmt.Sprintf("rate=%s", c.Rate))
-	}
-
-	if c.Slot != "" {
-		queryParams = append(queryParams, fmt.Sprintf("slot=%s", c.Slot))
-	}
-
-	if c.Proxy != "" {
-		queryParams = append(queryParams, fmt.Sprintf("proxy=%s", c.Proxy))
-	}
-	if c.PoolType != "" {
-		queryParams = append(queryParams, fmt.Sprintf("type=%s", c.PoolType))
-	}
-	if c.Dial != "" {
-		queryParams = append(queryParams, fmt.Sprintf("dial=%s", url.QueryEscape(c.Dial)))
-	}
-	if c.Dns != "" {
-		queryParams = append(queryParams, fmt.Sprintf("dns=%s", c.Dns))
-	}
-	if c.Sni != "" {
-		queryParams = append(queryParams, fmt.Sprintf("sni=%s", c.Sni))
-	}
-	if c.Block != "" {
-		queryParams = append(queryParams, fmt.Sprintf("block=%s", c.Block))
-	}
-	if c.Lbs != "" {
-		queryParams = append(queryParams, fmt.Sprintf("lbs=%s", c.Lbs))
-	}
-
-	// 根据listenType生成notcp和noudp参数
-	if c.ListenType != "" {
-		switch c.ListenType {
-		case "TCP":
-			queryParams = append(queryParams, "notcp=0")
-			queryParams = append(queryParams, "noudp=1")
-		case "UDP":
-			queryParams = append(queryParams, "notcp=1")
-			queryParams = append(queryParams, "noudp=0")
-		case "ALL":
-			queryParams = append(queryParams, "notcp=0")
-			queryParams = append(queryParams, "noudp=0")
-		}
-	}
-	// 添加查询参数
-	if len(queryParams) > 0 {
-		urlParts = append(urlParts, "?"+strings.Join(queryParams, "&"))
-	}
-
-	return strings.Join(urlParts, "")
+	return c.BuildURL()
 }
 
 // parseAddressPort 解析 "addr:port" 片段 (兼容 IPv6 字面量，如 [::1]:8080)
@@ -707,138 +565,5 @@ func parseAddressPort(part string) (addr, port string) {
 // BuildTunnelURLs 将 Tunnel 对象转换为 URL 字符串
 // 用于在其他地方方便地获取隧道的URL配置
 func BuildTunnelURLs(tunnel models.Tunnel) string {
-
-	protocol := string(tunnel.Type)
-	if protocol == "" {
-		protocol = "client" // 默认协议
-	}
-
-	var urlParts []string
-	urlParts = append(urlParts, protocol+"://")
-
-	// 添加密码
-	if tunnel.Password != nil && *tunnel.Password != "" {
-		urlParts = append(urlParts, *tunnel.Password+"@")
-	}
-
-	// 添加隧道地址和端口
-	if tunnel.TunnelAddress != "" || tunnel.TunnelPort != "" {
-		if tunnel.TunnelAddress != "" {
-			urlParts = append(urlParts, tunnel.TunnelAddress)
-		}
-		if tunnel.TunnelPort != "" {
-			urlParts = append(urlParts, ":"+tunnel.TunnelPort)
-		}
-	}
-
-	// 添加目标地址和端口（包括扩展地址）
-	if tunnel.TargetAddress != "" || tunnel.TargetPort != "" || (tunnel.ExtendTargetAddress != nil && len(*tunnel.ExtendTargetAddress) > 0) {
-		urlParts = append(urlParts, "/")
-		if tunnel.TargetAddress != "" {
-			urlParts = append(urlParts, tunnel.TargetAddress)
-		}
-		if tunnel.TargetPort != "" {
-			urlParts = append(urlParts, ":"+tunnel.TargetPort)
-		}
-
-		// 添加扩展地址（逗号分隔）
-		if tunnel.ExtendTargetAddress != nil && len(*tunnel.ExtendTargetAddress) > 0 {
-			for _, addr := range *tunnel.ExtendTargetAddress {
-				urlParts = append(urlParts, ","+addr)
-			}
-		}
-	}
-
-	// 构建查询参数
-	var queryParams []string
-
-	// 只有非空且非inherit才添加log参数
-	if tunnel.LogLevel != "" && tunnel.LogLevel != models.LogLevelInherit {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", tunnel.LogLevel))
-	}
-
-	// 只有server模式且非空且非inherit才添加tls参数
-	if tunnel.TLSMode != "" && tunnel.TLSMode != models.TLSModeInherit && protocol == "server" {
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tunnel.TLSMode))
-	}
-
-	if tunnel.CertPath != nil && *tunnel.CertPath != "" {
-		queryParams = append(queryParams, fmt.Sprintf("crt=%s", url.QueryEscape(*tunnel.CertPath)))
-	}
-
-	if tunnel.KeyPath != nil && *tunnel.KeyPath != "" {
-		queryParams = append(queryParams, fmt.Sprintf("key=%s", url.QueryEscape(*tunnel.KeyPath)))
-	}
-
-	if tunnel.Min != nil {
-		queryParams = append(queryParams, fmt.Sprintf("min=%d", *tunnel.Min))
-	}
-
-	if tunnel.Max != nil {
-		queryParams = append(queryParams, fmt.Sprintf("max=%d", *tunnel.Max))
-	}
-
-	if tunnel.Mode != nil {
-		queryParams = append(queryParams, fmt.Sprintf("mode=%d", *tunnel.Mode))
-	}
-
-	if tunnel.Read != nil && *tunnel.Read != "" {
-		queryParams = append(queryParams, fmt.Sprintf("read=%s", *tunnel.Read))
-	}
-
-	if tunnel.Rate != nil {
-		queryParams = append(queryParams, fmt.Sprintf("rate=%d", *tunnel.Rate))
-	}
-
-	if tunnel.Slot != nil {
-		queryParams = append(queryParams, fmt.Sprintf("slot=%d", *tunnel.Slot))
-	}
-	if tunnel.Dial != nil {
-		queryParams = append(queryParams, fmt.Sprintf("dial=%s", url.QueryEscape(*tunnel.Dial)))
-	}
-	if tunnel.Dns != nil {
-		queryParams = append(queryParams, fmt.Sprintf("dns=%s", *tunnel.Dns))
-	}
-	if tunnel.PoolType != nil {
-		queryParams = append(queryParams, fmt.Sprintf("type=%d", *tunnel.PoolType))
-	}
-	if tunnel.Sni != nil && *tunnel.Sni != "" {
-		queryParams = append(queryParams, fmt.Sprintf("sni=%s", *tunnel.Sni))
-	}
-	if tunnel.Block != nil {
-		queryParams = append(queryParams, fmt.Sprintf("block=%d", *tunnel.Block))
-	}
-	if tunnel.Lbs != nil {
-		queryParams = append(queryParams, fmt.Sprintf("lbs=%d", *tunnel.Lbs))
-	}
-
-	if tunnel.ProxyProtocol != nil {
-		proxyVal := "0"
-		if *tunnel.ProxyProtocol {
-			proxyVal = "1"
-		}
-		queryParams = append(queryParams, fmt.Sprintf("proxy=%s", proxyVal))
-	}
-
-	// 根据listenType生成notcp和noudp参数
-	if tunnel.ListenType != nil && *tunnel.ListenType != "" {
-		switch *tunnel.ListenType {
-		case "TCP":
-			queryParams = append(queryParams, "notcp=0")
-			queryParams = append(queryParams, "noudp=1")
-		case "UDP":
-			queryParams = append(queryParams, "notcp=1")
-			queryParams = append(queryParams, "noudp=0")
-		case "ALL":
-			queryParams = append(queryParams, "notcp=0")
-			queryParams = append(queryParams, "noudp=0")
-		}
-	}
-
-	// 添加查询参数
-	if len(queryParams) > 0 {
-		urlParts = append(urlParts, "?"+strings.Join(queryParams, "&"))
-	}
-
-	return strings.Join(urlParts, "")
+	return NewTunnelConfig(tunnel).BuildURL()
 }
@@ -0,0 +1,55 @@
+// Package periodic 提供按固定间隔执行的后台任务
+package periodic
+
+import (
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+)
+
+// Task 后台周期任务：启动后立即执行一次，之后按间隔执行，直到 Close
+type Task struct {
+	name     string
+	interval time.Duration
+	run      func() error
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// New 创建周期任务，name 用于日志
+func New(name string, interval time.Duration, run func() error) *Task {
+	return &Task{name: name, interval: interval, run: run, stopCh: make(chan struct{})}
+}
+
+// Start 启动后台任务
+func (t *Task) Start() {
+	go func() {
+		t.runOnce()
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.runOnce()
+			case <-t.stopCh:
+				return
+			}
+		}
+	}()
+	log.Infof("%s已启动", t.name)
+}
+
+// Close 停止后台任务，可重复调用
+func (t *Task) Close() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		log.Infof("%s已关闭", t.name)
+	})
+}
+
+func (t *Task) runOnce() {
+	if err := t.run(); err != nil {
+		log.Errorf("%s执行失败: %v", t.name, err)
+	}
+}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"NodePassDash/internal/models"
+)
+
+var exportHeader = []string{"key", "name", "tunnels", "tcp_rx", "tcp_tx", "udp_rx", "udp_tx",
+	"rx", "tx", "total", "peak_rate_bps", "peak_at"}
+
+// exportRows 将报表展开为表格行（含表头与合计行），时间按报表时区格式化
+func exportRows(r *models.UsageReport) [][]interface{} {
+	loc := loadLocationOrLocal(r.Timezone)
+	header := make([]interface{}, len(exportHeader))
+	for i, h := range exportHeader {
+		header[i] = h
+	}
+	rows := [][]interface{}{header}
+	line := func(row models.UsageReportRow) []interface{} {
+		peakAt := ""
+		if !row.PeakAt.IsZero() {
+			peakAt = row.PeakAt.In(loc).Format(time.RFC3339)
+		}
+		return []interface{}{row.Key, row.Name, row.Tunnels, row.TCPRx, row.TCPTx, row.UDPRx, row.UDPTx,
+			row.Rx, row.Tx, row.Total, row.PeakRate, peakAt}
+	}
+	for _, row := range r.Rows {
+		rows = append(rows, line(row))
+	}
+	return append(rows, line(r.Total))
+}
+
+// ToCSV 导出 CSV
+func ToCSV(r *models.UsageReport) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, row := range exportRows(r) {
+		record := make([]string, len(row))
+		for i, v := range row {
+			switch v := v.(type) {
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', 2, 64)
+			case string:
+				record[i] = csvSafe(v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// csvSafe 以 = + - @ 等开头的文本会被表格软件当作公式执行，加单引号前缀按纯文本处理
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// ToXLSX 导出 XLSX
+func ToXLSX(r *models.UsageReport) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeXLSX(&buf, "usage", exportRows(r)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Filename 生成不含扩展名的下载文件名
+func Filename(r *models.UsageReport) string {
+	if r.Period != "" {
+		return fmt.Sprintf("nodepass-usage-%s-%s", r.Period, r.GroupBy)
+	}
+	loc := loadLocationOrLocal(r.Timezone)
+	return fmt.Sprintf("nodepass-usage-%s-%s-%s", r.RangeStart.In(loc).Format("20060102"),
+		r.RangeEnd.In(loc).Format("20060102"), r.GroupBy)
+}
@@ -0,0 +1,558 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/periodic"
+	"NodePassDash/internal/sysconfig"
+	"NodePassDash/internal/timezone"
+
+	"gorm.io/gorm"
+)
+
+const (
+	configKey   = "usage_report_config"
+	runInterval = time.Hour
+	settleDelay = 2 * time.Hour // 整小时汇总在下一小时写入，月末留出余量后再生成月报
+	maxRange    = 366 * 24 * time.Hour
+	periodFmt   = "2006-01"
+)
+
+var (
+	// ErrInvalidConfig 报表配置不合法
+	ErrInvalidConfig = errors.New("无效的报表配置")
+	// ErrInvalidQuery 报表查询参数不合法
+	ErrInvalidQuery = errors.New("无效的报表查询")
+)
+
+// Config 月报预生成配置，保存在 system_configs 中
+type Config struct {
+	Enabled         bool                        `json:"enabled"`
+	Timezone        string                      `json:"timezone"` // IANA 时区名，为空表示服务器本地时区
+	GroupBy         []models.UsageReportGroupBy `json:"groupBy"`
+	TagKey          string                      `json:"tagKey"` // GroupBy 包含 tag 时使用的标签键
+	RetentionMonths int                         `json:"retentionMonths"`
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:         true,
+		GroupBy:         []models.UsageReportGroupBy{models.UsageGroupByGroup, models.UsageGroupByTunnel},
+		RetentionMonths: 24,
+	}
+}
+
+func (c Config) validate() error {
+	if _, err := loadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("%w: 未知时区 %q", ErrInvalidConfig, c.Timezone)
+	}
+	if len(c.GroupBy) == 0 {
+		return fmt.Errorf("%w: 至少需要一个分组维度", ErrInvalidConfig)
+	}
+	for _, g := range c.GroupBy {
+		if !validGroupBy(g) {
+			return fmt.Errorf("%w: 不支持的分组维度 %q", ErrInvalidConfig, g)
+		}
+		if g == models.UsageGroupByTag && c.TagKey == "" {
+			return fmt.Errorf("%w: 按标签分组需要指定标签键", ErrInvalidConfig)
+		}
+	}
+	if c.RetentionMonths < 1 {
+		return fmt.Errorf("%w: 保留月数需大于 0", ErrInvalidConfig)
+	}
+	return nil
+}
+
+func validGroupBy(g models.UsageReportGroupBy) bool {
+	switch g {
+	case models.UsageGroupByTunnel, models.UsageGroupByEndpoint, models.UsageGroupByGroup,
+		models.UsageGroupByService, models.UsageGroupByTag:
+		return true
+	}
+	return false
+}
+
+// loadLocation 解析时区，空字符串与 Local 表示服务器本地时区，另支持 +08:00 等固定偏移
+func loadLocation(name string) (*time.Location, error) {
+	return timezone.Load(name)
+}
+
+func loadLocationOrLocal(name string) *time.Location {
+	loc, err := loadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Query 按需生成报表的参数，From 含、To 不含
+type Query struct {
+	From     time.Time
+	To       time.Time
+	Timezone string
+	GroupBy  models.UsageReportGroupBy
+	TagKey   string
+}
+
+// ParseRange 按时区解析起止时间：支持 2006-01-02、2006-01-02T15:04 与 RFC3339；
+// 仅给出日期的结束时间包含当天
+func ParseRange(from, to, timezone string) (time.Time, time.Time, error) {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: 未知时区 %q", ErrInvalidQuery, timezone)
+	}
+	parse := func(s string, end bool) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation("2006-01-02T15:04", s, loc); err == nil {
+			return t, nil
+		}
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			return t, fmt.Errorf("%w: 无法解析时间 %q", ErrInvalidQuery, s)
+		}
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	end := now
+	if from != "" {
+		if start, err = parse(from, false); err != nil {
+			return start, end, err
+		}
+	}
+	if to != "" {
+		if end, err = parse(to, true); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// Service 用量报表服务
+// 基于 traffic_hourly_summary 的整小时增量按维度汇总流量，并在每月初预生成上月报表
+type Service struct {
+	*periodic.Task
+	db    *gorm.DB
+	cfg   *sysconfig.Store[Config]
+	runMu sync.Mutex
+
+	now func() time.Time
+}
+
+// NewService 创建用量报表服务
+func NewService(db *gorm.DB) *Service {
+	s := &Service{
+		db:  db,
+		cfg: sysconfig.NewStore(db, configKey, DefaultConfig(), Config.validate),
+		now: time.Now,
+	}
+	s.Task = periodic.New("用量报表服务", runInterval, s.RunOnce)
+	return s
+}
+
+// Config 返回当前配置
+func (s *Service) Config() Config {
+	return s.cfg.Get()
+}
+
+// SetConfig 校验并保存配置
+func (s *Service) SetConfig(cfg Config) error {
+	return s.cfg.Set(cfg)
+}
+
+// RunOnce 生成尚未生成的上月报表并清理过期月报
+func (s *Service) RunOnce() error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	cfg := s.Config()
+	if !cfg.Enabled {
+		return nil
+	}
+	loc := loadLocationOrLocal(cfg.Timezone)
+	now := s.now().In(loc)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	period := monthStart.AddDate(0, -1, 0)
+	if now.Sub(monthStart) < settleDelay {
+		period = period.AddDate(0, -1, 0)
+	}
+
+	for _, groupBy := range cfg.GroupBy {
+		var count int64
+		if err := s.db.Model(&models.UsageReport{}).
+			Where("period = ? AND group_by = ? AND tag_key = ? AND timezone = ?",
+				period.Format(periodFmt), groupBy, tagKeyFor(groupBy, cfg.TagKey), loc.String()).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := s.generateMonthly(cfg, period, groupBy); err != nil {
+			return err
+		}
+	}
+
+	cutoff := s.now().AddDate(0, -cfg.RetentionMonths, 0)
+	return s.db.Where("generated_at < ?", cutoff).Delete(&models.UsageReport{}).Error
+}
+
+// GenerateMonthly 按当前配置（重新）生成指定月份（如 2024-05）的报表
+func (s *Service) GenerateMonthly(period string) ([]models.UsageReport, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	cfg := s.Config()
+	loc := loadLocationOrLocal(cfg.Timezone)
+	month, err := time.ParseInLocation(periodFmt, period, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 月份格式应为 YYYY-MM", ErrInvalidQuery)
+	}
+	reports := make([]models.UsageReport, 0, len(cfg.GroupBy))
+	for _, groupBy := range cfg.GroupBy {
+		report, err := s.generateMonthly(cfg, month, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+func (s *Service) generateMonthly(cfg Config, month time.Time, groupBy models.UsageReportGroupBy) (*models.UsageReport, error) {
+	report, err := s.Generate(Query{
+		From:     month,
+		To:       month.AddDate(0, 1, 0),
+		Timezone: cfg.Timezone,
+		GroupBy:  groupBy,
+		TagKey:   cfg.TagKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Period = month.Format(periodFmt)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("period = ? AND group_by = ? AND tag_key = ? AND timezone = ?",
+			report.Period, report.GroupBy, report.TagKey, report.Timezone).
+			Delete(&models.UsageReport{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(report).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[Report]已生成 %s 月报（按 %s 分组，%d 行）", report.Period, report.GroupBy, len(report.Rows))
+	return report, nil
+}
+
+// ListMonthly 列出已生成的月报（不含明细行），period 为空时返回全部
+func (s *Service) ListMonthly(period string) ([]models.UsageReport, error) {
+	query := s.db.Omit("rows").Order("period DESC, group_by ASC")
+	if period != "" {
+		query = query.Where("period = ?", period)
+	}
+	reports := []models.UsageReport{}
+	err := query.Find(&reports).Error
+	return reports, err
+}
+
+// GetMonthly 获取单个月报
+func (s *Service) GetMonthly(id int64) (*models.UsageReport, error) {
+	var report models.UsageReport
+	if err := s.db.First(&report, id).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func tagKeyFor(groupBy models.UsageReportGroupBy, tagKey string) string {
+	if groupBy == models.UsageGroupByTag {
+		return tagKey
+	}
+	return ""
+}
+
+// Member 隧道在某一维度下所属的分组
+type Member struct {
+	Key, Name string
+}
+
+// accumulator 单个分组的累计值；按整小时顺序扫描，hourBytes 为当前小时的流量
+type accumulator struct {
+	row       models.UsageReportRow
+	instances map[string]bool
+	hourBytes int64
+	peakBytes int64
+}
+
+func (a *accumulator) add(r *models.TrafficHourlySummary, instance string) {
+	a.row.TCPRx += r.TCPRxIncrement
+	a.row.TCPTx += r.TCPTxIncrement
+	a.row.UDPRx += r.UDPRxIncrement
+	a.row.UDPTx += r.UDPTxIncrement
+	a.hourBytes += r.GetTotalIncrement()
+	a.instances[instance] = true
+}
+
+func (a *accumulator) closeHour(hour time.Time) {
+	if a.hourBytes > a.peakBytes {
+		a.peakBytes, a.row.PeakAt = a.hourBytes, hour
+	}
+	a.hourBytes = 0
+}
+
+func (a *accumulator) finish() models.UsageReportRow {
+	row := a.row
+	row.Rx = row.TCPRx + row.UDPRx
+	row.Tx = row.TCPTx + row.UDPTx
+	row.Total = row.Rx + row.Tx
+	row.Tunnels = len(a.instances)
+	row.PeakRate = float64(a.peakBytes) / 3600
+	return row
+}
+
+// Generate 按需生成报表（不保存）
+// 数据粒度为整小时，起止时间不在整点时按所在小时的开始时间归属
+func (s *Service) Generate(q Query) (*models.UsageReport, error) {
+	if !validGroupBy(q.GroupBy) {
+		return nil, fmt.Errorf("%w: 不支持的分组维度 %q", ErrInvalidQuery, q.GroupBy)
+	}
+	if q.GroupBy == models.UsageGroupByTag && q.TagKey == "" {
+		return nil, fmt.Errorf("%w: 按标签分组需要指定 tagKey", ErrInvalidQuery)
+	}
+	loc, err := loadLocation(q.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 未知时区 %q", ErrInvalidQuery, q.Timezone)
+	}
+	if !q.To.After(q.From) {
+		return nil, fmt.Errorf("%w: 结束时间需晚于开始时间", ErrInvalidQuery)
+	}
+	if q.To.Sub(q.From) > maxRange {
+		return nil, fmt.Errorf("%w: 时间范围不能超过 366 天", ErrInvalidQuery)
+	}
+
+	members, err := LoadMembers(s.db, q.GroupBy, q.TagKey)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*accumulator)
+	total := &accumulator{row: models.UsageReportRow{Key: "total", Name: "合计"}, instances: make(map[string]bool)}
+	touched := make([]*accumulator, 0)
+	var currentHour time.Time
+	closeHour := func() {
+		for _, a := range touched {
+			a.closeHour(currentHour)
+		}
+		total.closeHour(currentHour)
+		touched = touched[:0]
+	}
+
+	// 按小时顺序流式读取，内存占用只与分组数量有关
+	rows, err := s.db.Model(&models.TrafficHourlySummary{}).
+		Where("hour_time >= ? AND hour_time < ? AND instance_id <> ''", q.From.In(time.Local), q.To.In(time.Local)).
+		Order("hour_time ASC").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r models.TrafficHourlySummary
+		if err := s.db.ScanRows(rows, &r); err != nil {
+			return nil, err
+		}
+		if !r.HourTime.Equal(currentHour) {
+			closeHour()
+			currentHour = r.HourTime
+		}
+		instance := strconv.FormatInt(r.EndpointID, 10) + ":" + r.InstanceID
+		total.add(&r, instance)
+		for _, m := range members.Of(r.EndpointID, r.InstanceID) {
+			a, ok := groups[m.Key]
+			if !ok {
+				a = &accumulator{row: models.UsageReportRow{Key: m.Key, Name: m.Name}, instances: make(map[string]bool)}
+				groups[m.Key] = a
+			}
+			if a.hourBytes == 0 {
+				touched = append(touched, a)
+			}
+			a.add(&r, instance)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	closeHour()
+
+	report := &models.UsageReport{
+		GroupBy:     q.GroupBy,
+		TagKey:      tagKeyFor(q.GroupBy, q.TagKey),
+		Timezone:    loc.String(),
+		RangeStart:  q.From.In(loc),
+		RangeEnd:    q.To.In(loc),
+		Rows:        make([]models.UsageReportRow, 0, len(groups)),
+		Total:       total.finish(),
+		GeneratedAt: s.now(),
+	}
+	for _, a := range groups {
+		report.Rows = append(report.Rows, a.finish())
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Total != report.Rows[j].Total {
+			return report.Rows[i].Total > report.Rows[j].Total
+		}
+		return report.Rows[i].Key < report.Rows[j].Key
+	})
+	return report, nil
+}
+
+// MemberIndex 实例到分组的映射；找不到隧道（已删除）的实例归入各维度的默认分组
+type MemberIndex struct {
+	groupBy   models.UsageReportGroupBy
+	instances map[string][]Member
+	endpoints map[int64]string
+}
+
+// Of 返回实例所属的分组
+func (m *MemberIndex) Of(endpointID int64, instanceID string) []Member {
+	if list, ok := m.instances[strconv.FormatInt(endpointID, 10)+":"+instanceID]; ok {
+		return list
+	}
+	switch m.groupBy {
+	case models.UsageGroupByTunnel:
+		return []Member{{Key: "instance:" + strconv.FormatInt(endpointID, 10) + ":" + instanceID, Name: instanceID + "（已删除）"}}
+	case models.UsageGroupByEndpoint:
+		return []Member{endpointMember(endpointID, m.endpoints)}
+	default:
+		return []Member{defaultMember(m.groupBy)}
+	}
+}
+
+func endpointMember(endpointID int64, names map[int64]string) Member {
+	name, ok := names[endpointID]
+	if !ok {
+		name = fmt.Sprintf("主控 #%d", endpointID)
+	}
+	return Member{Key: strconv.FormatInt(endpointID, 10), Name: name}
+}
+
+func defaultMember(groupBy models.UsageReportGroupBy) Member {
+	switch groupBy {
+	case models.UsageGroupByGroup:
+		return Member{Key: "", Name: "未分组"}
+	case models.UsageGroupByService:
+		return Member{Key: "", Name: "未关联服务"}
+	default:
+		return Member{Key: "", Name: "（无标签）"}
+	}
+}
+
+// LoadMembers 加载各实例在指定维度下的分组，tagKey 仅在按标签分组时使用
+func LoadMembers(db *gorm.DB, groupBy models.UsageReportGroupBy, tagKey string) (*MemberIndex, error) {
+	index := &MemberIndex{groupBy: groupBy, instances: make(map[string][]Member), endpoints: make(map[int64]string)}
+
+	var endpoints []models.Endpoint
+	if err := db.Select("id", "name").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range endpoints {
+		index.endpoints[e.ID] = e.Name
+	}
+
+	var tunnels []models.Tunnel
+	if err := db.Select("id", "name", "endpoint_id", "instance_id", "service_sid", "tags").
+		Where("instance_id IS NOT NULL AND instance_id <> ''").Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+
+	groupNames := make(map[int64]string)
+	groupParents := make(map[int64]int64)
+	tunnelGroups := make(map[int64][]int64)
+	serviceNames := make(map[string]string)
+	switch groupBy {
+	case models.UsageGroupByGroup:
+		var groups []models.Group
+		if err := db.Select("id", "name", "parent_id").Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			groupNames[g.ID] = g.Name
+			if g.ParentID != nil {
+				groupParents[g.ID] = *g.ParentID
+			}
+		}
+		var links []models.TunnelGroup
+		if err := db.Select("tunnel_id", "group_id").Find(&links).Error; err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			tunnelGroups[l.TunnelID] = append(tunnelGroups[l.TunnelID], l.GroupID)
+		}
+	case models.UsageGroupByService:
+		var services []models.Services
+		if err := db.Select("sid", "alias").Find(&services).Error; err != nil {
+			return nil, err
+		}
+		for _, svc := range services {
+			if svc.Alias != nil && *svc.Alias != "" {
+				serviceNames[svc.Sid] = *svc.Alias
+			}
+		}
+	}
+
+	for _, t := range tunnels {
+		key := strconv.FormatInt(t.EndpointID, 10) + ":" + *t.InstanceID
+		var list []Member
+		switch groupBy {
+		case models.UsageGroupByTunnel:
+			list = []Member{{Key: strconv.FormatInt(t.ID, 10), Name: t.Name}}
+		case models.UsageGroupByEndpoint:
+			list = []Member{endpointMember(t.EndpointID, index.endpoints)}
+		case models.UsageGroupByGroup:
+			// 子分组的流量同时计入全部上级分组，同一分组只计一次
+			seen := make(map[int64]bool)
+			for _, id := range tunnelGroups[t.ID] {
+				for ; id != 0 && !seen[id]; id = groupParents[id] {
+					seen[id] = true
+					if name, ok := groupNames[id]; ok {
+						list = append(list, Member{Key: strconv.FormatInt(id, 10), Name: name})
+					}
+				}
+			}
+		case models.UsageGroupByService:
+			if t.ServiceSID != nil && *t.ServiceSID != "" {
+				name := serviceNames[*t.ServiceSID]
+				if name == "" {
+					name = *t.ServiceSID
+				}
+				list = []Member{{Key: *t.ServiceSID, Name: name}}
+			}
+		case models.UsageGroupByTag:
+			if t.Tags != nil {
+				if v, ok := (*t.Tags)[tagKey]; ok && v != "" {
+					list = []Member{{Key: v, Name: v}}
+				}
+			}
+		}
+		if len(list) == 0 {
+			list = []Member{defaultMember(groupBy)}
+		}
+		index.instances[key] = list
+	}
+	return index, nil
+}
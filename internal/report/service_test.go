@@ -0,0 +1,126 @@
+package report
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/testdb"
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateAndMonthly(t *testing.T) {
+	db := testdb.Open(t, &models.Endpoint{}, &models.Tunnel{}, &models.Group{}, &models.TunnelGroup{},
+		&models.Services{}, &models.TrafficHourlySummary{}, &models.SystemConfig{}, &models.UsageReport{})
+
+	a, b := "a", "b"
+	db.Create(&models.Tunnel{ID: 1, Name: "web", EndpointID: 1, InstanceID: &a})
+	db.Create(&models.Tunnel{ID: 2, Name: "game", EndpointID: 1, InstanceID: &b})
+	region := int64(12)
+	db.Create(&models.Group{ID: 12, Name: "region"})
+	db.Create(&models.Group{ID: 10, Name: "cust-a", ParentID: &region})
+	db.Create(&models.Group{ID: 11, Name: "cust-b", ParentID: &region})
+	db.Create(&models.TunnelGroup{TunnelID: 1, GroupID: 10})
+	db.Create(&models.TunnelGroup{TunnelID: 2, GroupID: 10})
+	db.Create(&models.TunnelGroup{TunnelID: 2, GroupID: 11})
+
+	// 五月每小时：a 收 100 发 50（TCP），b 收 10（UDP）；5 月 10 日 3 点 a 突增到 3600
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	peak := time.Date(2024, 5, 10, 3, 0, 0, 0, time.Local)
+	for h := start; h.Before(start.AddDate(0, 1, 0)); h = h.Add(time.Hour) {
+		rx := int64(100)
+		if h.Equal(peak) {
+			rx = 3600
+		}
+		db.Create(&models.TrafficHourlySummary{HourTime: h, EndpointID: 1, InstanceID: "a", TCPRxIncrement: rx, TCPTxIncrement: 50})
+		db.Create(&models.TrafficHourlySummary{HourTime: h, EndpointID: 1, InstanceID: "b", UDPRxIncrement: 10})
+	}
+	// 已删除隧道的流量只计入未分组
+	db.Create(&models.TrafficHourlySummary{HourTime: start, EndpointID: 1, InstanceID: "gone", TCPRxIncrement: 7})
+
+	s := NewService(db)
+	hours := int64(31 * 24)
+	r, err := s.Generate(Query{From: start, To: start.AddDate(0, 1, 0), GroupBy: models.UsageGroupByGroup})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(r.Rows) != 4 {
+		t.Fatalf("rows = %+v", r.Rows)
+	}
+	custA, parent, custB, ungrouped := r.Rows[0], r.Rows[1], r.Rows[2], r.Rows[3]
+	if custA.Name != "cust-a" || custA.Tunnels != 2 || custA.TCPRx != hours*100+3500 || custA.UDPRx != hours*10 ||
+		custA.Tx != hours*50 || custA.PeakRate != float64(3600+50+10)/3600 || !custA.PeakAt.Equal(peak) {
+		t.Errorf("cust-a = %+v", custA)
+	}
+	// 上级分组汇总子分组，同时属于两个子分组的隧道只计一次
+	if parent.Name != "region" || parent.Tunnels != 2 || parent.Total != custA.Total {
+		t.Errorf("region = %+v", parent)
+	}
+	if custB.Name != "cust-b" || custB.Total != hours*10 {
+		t.Errorf("cust-b = %+v", custB)
+	}
+	if ungrouped.Name != "未分组" || ungrouped.Total != 7 {
+		t.Errorf("ungrouped = %+v", ungrouped)
+	}
+	// 合计按实例计算，不因多分组重复计入
+	if r.Total.Total != hours*160+3500+7 || r.Total.Tunnels != 3 {
+		t.Errorf("total = %+v", r.Total)
+	}
+
+	data, err := ToXLSX(r)
+	if err != nil {
+		t.Fatalf("ToXLSX: %v", err)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Errorf("xlsx is not a valid zip: %v", err)
+	}
+	if csv := ToCSV(r); !bytes.HasPrefix(csv, []byte("key,name,tunnels")) || bytes.Count(csv, []byte("\n")) != 6 {
+		t.Errorf("csv = %s", csv)
+	}
+
+	// 六月初运行时生成五月的月报，重复运行不会重复生成
+	s.now = func() time.Time { return time.Date(2024, 6, 1, 3, 0, 0, 0, time.Local) }
+	for i := 0; i < 2; i++ {
+		if err := s.RunOnce(); err != nil {
+			t.Fatalf("RunOnce: %v", err)
+		}
+	}
+	reports, err := s.ListMonthly("2024-05")
+	if err != nil || len(reports) != 2 {
+		t.Fatalf("monthly reports = %d, %v", len(reports), err)
+	}
+	stored, err := s.GetMonthly(reports[0].ID)
+	if err != nil || stored.Total.Total != r.Total.Total {
+		t.Errorf("stored report = %+v, %v", stored, err)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	from, to, err := ParseRange("2024-05-01", "2024-05-31", "Asia/Shanghai")
+	if err != nil {
+		t.Fatalf("ParseRange: %v", err)
+	}
+	if from.UTC() != time.Date(2024, 4, 30, 16, 0, 0, 0, time.UTC) || to.UTC() != time.Date(2024, 5, 31, 16, 0, 0, 0, time.UTC) {
+		t.Errorf("range = %v - %v", from.UTC(), to.UTC())
+	}
+	if _, _, err := ParseRange("2024-05-01", "", "Mars/Olympus"); err == nil {
+		t.Error("expected unknown timezone to be rejected")
+	}
+}
+
+func TestToCSVEscapesFormulas(t *testing.T) {
+	r := &models.UsageReport{
+		Rows: []models.UsageReportRow{
+			{Key: "=1+1", Name: "@SUM(A1)", Total: -5},
+			{Key: "web", Name: "-web"},
+		},
+		Total: models.UsageReportRow{Key: "total", Name: "+total"},
+	}
+	csv := string(ToCSV(r))
+	for _, want := range []string{"'=1+1,'@SUM(A1),", ",-5,", "web,'-web,", "total,'+total,"} {
+		if !strings.Contains(csv, want) {
+			t.Errorf("csv missing %q:\n%s", want, csv)
+		}
+	}
+}
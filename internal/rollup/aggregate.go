@@ -0,0 +1,198 @@
+package rollup
+
+import (
+	"NodePassDash/internal/latency"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sample 参与汇总的单条源记录：分钟数据或下一级降采样数据
+type sample struct {
+	endpointID int64
+	instanceID string
+	time       time.Time
+	delta      [4]int64 // tcp_in, tcp_out, udp_in, udp_out 增量
+	last       [4]int64 // 对应的累计值
+	records    int      // 采样点数，作为加权平均的权重
+	rows       int
+	up         int
+
+	avgPing, minPing, maxPing float64
+	avgPool, minPool, maxPool float64
+	avgTCPs, maxTCPs          float64
+	avgUDPs, maxUDPs          float64
+	avgSpeedIn, maxSpeedIn    float64
+	avgSpeedOut, maxSpeedOut  float64
+	pingSketch                *latency.Sketch
+}
+
+// rawSample 将分钟记录转换为 sample，prev 为同一实例上一条记录的累计值
+// 累计值小于上一条时视为计数器重置，增量取当前值
+func rawSample(h *models.ServiceHistory, prev *[4]int64) sample {
+	last := [4]int64{h.DeltaTCPIn, h.DeltaTCPOut, h.DeltaUDPIn, h.DeltaUDPOut}
+	var delta [4]int64
+	if prev != nil {
+		for i := range last {
+			if d := last[i] - prev[i]; d >= 0 {
+				delta[i] = d
+			} else {
+				delta[i] = last[i]
+			}
+		}
+	}
+	records := h.RecordCount
+	if records <= 0 {
+		records = 1
+	}
+	pool, tcps, udps := float64(h.AvgPool), float64(h.AvgTCPs), float64(h.AvgUDPs)
+	sketch := decodeSketch(h.PingSketch)
+	minPing, maxPing := h.AvgPing, h.AvgPing
+	if sketch != nil && sketch.Count > 0 {
+		minPing, maxPing = sketch.Min, sketch.Max
+	}
+	return sample{
+		endpointID: h.EndpointID, instanceID: h.InstanceID, time: h.RecordTime,
+		delta: delta, last: last, records: records, rows: 1, up: h.UpCount,
+		avgPing: h.AvgPing, minPing: minPing, maxPing: maxPing,
+		avgPool: pool, minPool: pool, maxPool: pool,
+		avgTCPs: tcps, maxTCPs: tcps,
+		avgUDPs: udps, maxUDPs: udps,
+		avgSpeedIn: h.AvgSpeedIn, maxSpeedIn: h.AvgSpeedIn,
+		avgSpeedOut: h.AvgSpeedOut, maxSpeedOut: h.AvgSpeedOut,
+		pingSketch: sketch,
+	}
+}
+
+// decodeSketch 解析持久化的延迟草图，损坏的数据按缺失处理
+func decodeSketch(data string) *latency.Sketch {
+	sketch, err := latency.Decode(data)
+	if err != nil {
+		log.Warnf("[Rollup]解析延迟草图失败: %v", err)
+		return nil
+	}
+	return sketch
+}
+
+// rollupSample 将下一级降采样记录转换为 sample
+func rollupSample(r *models.ServiceHistoryRollup) sample {
+	records := r.RecordCount
+	if records <= 0 {
+		records = 1
+	}
+	return sample{
+		endpointID: r.EndpointID, instanceID: r.InstanceID, time: r.BucketTime,
+		delta:   [4]int64{r.DeltaTCPIn, r.DeltaTCPOut, r.DeltaUDPIn, r.DeltaUDPOut},
+		last:    [4]int64{r.LastTCPIn, r.LastTCPOut, r.LastUDPIn, r.LastUDPOut},
+		records: records, rows: r.RowCount, up: r.UpCount,
+		avgPing: r.AvgPing, minPing: r.MinPing, maxPing: r.MaxPing,
+		avgPool: r.AvgPool, minPool: r.MinPool, maxPool: r.MaxPool,
+		avgTCPs: r.AvgTCPs, maxTCPs: r.MaxTCPs,
+		avgUDPs: r.AvgUDPs, maxUDPs: r.MaxUDPs,
+		avgSpeedIn: r.AvgSpeedIn, maxSpeedIn: r.MaxSpeedIn,
+		avgSpeedOut: r.AvgSpeedOut, maxSpeedOut: r.MaxSpeedOut,
+		pingSketch: decodeSketch(r.PingSketch),
+	}
+}
+
+// bucket 单个实例在单个时间桶内的汇总
+type bucket struct {
+	row      models.ServiceHistoryRollup
+	lastTime time.Time
+	sums     [6]float64 // ping, pool, tcps, udps, speed_in, speed_out 的加权和
+	sketch   *latency.Sketch
+}
+
+func newBucket(tier models.RollupTier, s *sample, start time.Time) *bucket {
+	return &bucket{row: models.ServiceHistoryRollup{
+		Tier: tier, EndpointID: s.endpointID, InstanceID: s.instanceID, BucketTime: start,
+		MinPing: math.Inf(1), MinPool: math.Inf(1),
+	}, sketch: latency.New()}
+}
+
+func (b *bucket) add(s *sample) {
+	r := &b.row
+	r.DeltaTCPIn += s.delta[0]
+	r.DeltaTCPOut += s.delta[1]
+	r.DeltaUDPIn += s.delta[2]
+	r.DeltaUDPOut += s.delta[3]
+	if !s.time.Before(b.lastTime) {
+		b.lastTime = s.time
+		r.LastTCPIn, r.LastTCPOut, r.LastUDPIn, r.LastUDPOut = s.last[0], s.last[1], s.last[2], s.last[3]
+	}
+
+	w := float64(s.records)
+	for i, v := range [6]float64{s.avgPing, s.avgPool, s.avgTCPs, s.avgUDPs, s.avgSpeedIn, s.avgSpeedOut} {
+		b.sums[i] += v * w
+	}
+	r.MinPing = math.Min(r.MinPing, s.minPing)
+	r.MaxPing = math.Max(r.MaxPing, s.maxPing)
+	r.MinPool = math.Min(r.MinPool, s.minPool)
+	r.MaxPool = math.Max(r.MaxPool, s.maxPool)
+	r.MaxTCPs = math.Max(r.MaxTCPs, s.maxTCPs)
+	r.MaxUDPs = math.Max(r.MaxUDPs, s.maxUDPs)
+	r.MaxSpeedIn = math.Max(r.MaxSpeedIn, s.maxSpeedIn)
+	r.MaxSpeedOut = math.Max(r.MaxSpeedOut, s.maxSpeedOut)
+	r.RecordCount += s.records
+	r.RowCount += s.rows
+	r.UpCount += s.up
+	b.sketch.Merge(s.pingSketch)
+}
+
+// finish 计算加权平均值
+func (b *bucket) finish() models.ServiceHistoryRollup {
+	r := b.row
+	if w := float64(r.RecordCount); w > 0 {
+		r.AvgPing = b.sums[0] / w
+		r.AvgPool = b.sums[1] / w
+		r.AvgTCPs = b.sums[2] / w
+		r.AvgUDPs = b.sums[3] / w
+		r.AvgSpeedIn = b.sums[4] / w
+		r.AvgSpeedOut = b.sums[5] / w
+	}
+	if math.IsInf(r.MinPing, 1) {
+		r.MinPing = 0
+	}
+	if math.IsInf(r.MinPool, 1) {
+		r.MinPool = 0
+	}
+	if b.sketch.Count > 0 {
+		r.P50Ping = b.sketch.Quantile(0.5)
+		r.P90Ping = b.sketch.Quantile(0.9)
+		r.P99Ping = b.sketch.Quantile(0.99)
+		r.JitterPing = b.sketch.StdDev()
+		r.PingSketch = latency.Encode(b.sketch)
+	}
+	return r
+}
+
+// aggregate 将 sample 按实例与时间桶汇总，结果按实例、时间排序
+func aggregate(spec tierSpec, samples []sample) []models.ServiceHistoryRollup {
+	buckets := make(map[string]*bucket)
+	keys := make([]string, 0)
+	for i := range samples {
+		s := &samples[i]
+		start := spec.bucketStart(s.time)
+		key := instanceKey(s.endpointID, s.instanceID) + "\x00" + start.UTC().Format(time.RFC3339)
+		b, ok := buckets[key]
+		if !ok {
+			b = newBucket(spec.tier, s, start)
+			buckets[key] = b
+			keys = append(keys, key)
+		}
+		b.add(s)
+	}
+	sort.Strings(keys)
+	rows := make([]models.ServiceHistoryRollup, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, buckets[key].finish())
+	}
+	return rows
+}
+
+func instanceKey(endpointID int64, instanceID string) string {
+	return strconv.FormatInt(endpointID, 10) + ":" + instanceID
+}
@@ -0,0 +1,340 @@
+package rollup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"NodePassDash/internal/latency"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/periodic"
+	"NodePassDash/internal/sysconfig"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	configKey     = "history_rollup_config"
+	runInterval   = time.Minute
+	settleDelay   = 2 * time.Minute // 等待 HistoryWorker 写入最后一分钟数据
+	prevLookback  = 24 * time.Hour  // 查找上一个桶累计值的回溯范围
+	saveBatchSize = 500
+)
+
+// 各层级默认保留天数
+const (
+	defaultRetention5mDays = 30
+	defaultRetention1hDays = 365
+	defaultRetention1dDays = 1825
+)
+
+// ErrInvalidConfig 降采样配置不合法
+var ErrInvalidConfig = errors.New("无效的降采样配置")
+
+// Config 降采样配置，保存在 system_configs 中
+type Config struct {
+	Retention5mDays int `json:"retention5mDays"`
+	Retention1hDays int `json:"retention1hDays"`
+	Retention1dDays int `json:"retention1dDays"`
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() Config {
+	return Config{
+		Retention5mDays: defaultRetention5mDays,
+		Retention1hDays: defaultRetention1hDays,
+		Retention1dDays: defaultRetention1dDays,
+	}
+}
+
+// Retention 返回层级的保留时长，空层级表示分钟数据
+func (c Config) Retention(tier models.RollupTier) time.Duration {
+	days := 0
+	switch tier {
+	case models.RollupTier5m:
+		days = c.Retention5mDays
+	case models.RollupTier1h:
+		days = c.Retention1hDays
+	case models.RollupTier1d:
+		days = c.Retention1dDays
+	default:
+		return RawRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (c Config) validate() error {
+	if c.Retention5mDays < 1 || c.Retention1hDays < c.Retention5mDays || c.Retention1dDays < c.Retention1hDays {
+		return fmt.Errorf("%w: 保留天数需大于 0 且 5m <= 1h <= 1d", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Service service_history 降采样服务
+// 定期将已结束的分钟数据汇总为 5 分钟、1 小时、1 天三个层级，并按各层级保留时长清理
+type Service struct {
+	*periodic.Task
+	db  *gorm.DB
+	cfg *sysconfig.Store[Config]
+
+	mu         sync.Mutex
+	watermarks map[models.RollupTier]time.Time // 各层级下一个待处理桶的起始时间
+	runMu      sync.Mutex
+
+	now func() time.Time
+}
+
+// NewService 创建降采样服务
+func NewService(db *gorm.DB) *Service {
+	s := &Service{
+		db:         db,
+		cfg:        sysconfig.NewStore(db, configKey, DefaultConfig(), Config.validate),
+		watermarks: make(map[models.RollupTier]time.Time),
+		now:        time.Now,
+	}
+	s.Task = periodic.New("历史数据降采样任务", runInterval, s.RunOnce)
+	return s
+}
+
+// Config 返回当前配置
+func (s *Service) Config() Config {
+	return s.cfg.Get()
+}
+
+// SetConfig 校验并保存配置
+func (s *Service) SetConfig(cfg Config) error {
+	return s.cfg.Set(cfg)
+}
+
+// RunOnce 汇总全部已结束的桶并清理过期数据
+func (s *Service) RunOnce() error {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	now := s.now()
+	for _, spec := range tiers {
+		var end time.Time
+		if spec.source == "" {
+			end = spec.bucketStart(now.Add(-settleDelay))
+		} else {
+			end = s.watermark(spec.source)
+			if end.IsZero() {
+				continue
+			}
+			end = spec.bucketStart(end)
+		}
+		if err := s.rollupTier(spec, end); err != nil {
+			return fmt.Errorf("汇总 %s 层级失败: %w", spec.tier, err)
+		}
+	}
+
+	cfg := s.Config()
+	for _, spec := range tiers {
+		cutoff := now.Add(-cfg.Retention(spec.tier))
+		if err := s.db.Where("tier = ? AND bucket_time < ?", spec.tier, cutoff).
+			Delete(&models.ServiceHistoryRollup{}).Error; err != nil {
+			return fmt.Errorf("清理 %s 层级失败: %w", spec.tier, err)
+		}
+	}
+	return nil
+}
+
+// rollupTier 逐段汇总 [watermark, end) 内的桶
+func (s *Service) rollupTier(spec tierSpec, end time.Time) error {
+	from := s.watermark(spec.tier)
+	if from.IsZero() {
+		return nil
+	}
+	for from.Before(end) {
+		to := spec.chunkEnd(from, end)
+		samples, err := s.loadSamples(spec, from, to)
+		if err != nil {
+			return err
+		}
+		if rows := aggregate(spec, samples); len(rows) > 0 {
+			if err := s.save(rows); err != nil {
+				return err
+			}
+		}
+		s.mu.Lock()
+		s.watermarks[spec.tier] = to
+		s.mu.Unlock()
+		from = to
+	}
+	return nil
+}
+
+// watermark 返回层级下一个待处理桶的起始时间：首次调用时由已有汇总或最早的源数据推算
+func (s *Service) watermark(tier models.RollupTier) time.Time {
+	s.mu.Lock()
+	wm, ok := s.watermarks[tier]
+	s.mu.Unlock()
+	if ok {
+		return wm
+	}
+
+	spec, _ := specOf(tier)
+	var latest []models.ServiceHistoryRollup
+	if err := s.db.Where("tier = ?", tier).Order("bucket_time DESC").Limit(1).Find(&latest).Error; err != nil {
+		log.Errorf("[Rollup]读取 %s 层级进度失败: %v", tier, err)
+		return time.Time{}
+	}
+	if len(latest) > 0 {
+		wm = spec.next(spec.bucketStart(latest[0].BucketTime))
+	} else if oldest, ok := s.oldestSource(spec); ok {
+		wm = spec.bucketStart(oldest)
+	} else {
+		return time.Time{} // 暂无源数据，下次再推算
+	}
+
+	s.mu.Lock()
+	s.watermarks[tier] = wm
+	s.mu.Unlock()
+	return wm
+}
+
+func (s *Service) oldestSource(spec tierSpec) (time.Time, bool) {
+	if spec.source == "" {
+		var rows []models.ServiceHistory
+		if err := s.db.Select("record_time").Order("record_time ASC").Limit(1).Find(&rows).Error; err != nil || len(rows) == 0 {
+			return time.Time{}, false
+		}
+		return rows[0].RecordTime, true
+	}
+	var rows []models.ServiceHistoryRollup
+	if err := s.db.Select("bucket_time").Where("tier = ?", spec.source).
+		Order("bucket_time ASC").Limit(1).Find(&rows).Error; err != nil || len(rows) == 0 {
+		return time.Time{}, false
+	}
+	return rows[0].BucketTime, true
+}
+
+// loadSamples 读取 [from, to) 内的源数据
+func (s *Service) loadSamples(spec tierSpec, from, to time.Time) ([]sample, error) {
+	if spec.source != "" {
+		var rows []models.ServiceHistoryRollup
+		if err := s.db.Where("tier = ? AND bucket_time >= ? AND bucket_time < ?", spec.source, from, to).
+			Order("bucket_time ASC").Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		samples := make([]sample, 0, len(rows))
+		for i := range rows {
+			samples = append(samples, rollupSample(&rows[i]))
+		}
+		return samples, nil
+	}
+
+	var rows []models.ServiceHistory
+	if err := s.db.Where("record_time >= ? AND record_time < ? AND instance_id <> ''", from, to).
+		Order("record_time ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// 以上一个 5m 桶的桶末累计值作为各实例的起点
+	var prevRows []models.ServiceHistoryRollup
+	if err := s.db.Where("tier = ? AND bucket_time >= ? AND bucket_time < ?", spec.tier, from.Add(-prevLookback), from).
+		Order("bucket_time ASC").Find(&prevRows).Error; err != nil {
+		return nil, err
+	}
+	prev := make(map[string][4]int64)
+	for _, r := range prevRows {
+		prev[instanceKey(r.EndpointID, r.InstanceID)] = [4]int64{r.LastTCPIn, r.LastTCPOut, r.LastUDPIn, r.LastUDPOut}
+	}
+
+	samples := make([]sample, 0, len(rows))
+	for i := range rows {
+		var p *[4]int64
+		key := instanceKey(rows[i].EndpointID, rows[i].InstanceID)
+		if last, ok := prev[key]; ok {
+			p = &last
+		}
+		sm := rawSample(&rows[i], p)
+		prev[key] = sm.last
+		samples = append(samples, sm)
+	}
+	return samples, nil
+}
+
+// save 按唯一键写入汇总结果，重复汇总同一个桶时覆盖
+func (s *Service) save(rows []models.ServiceHistoryRollup) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tier"}, {Name: "endpoint_id"}, {Name: "instance_id"}, {Name: "bucket_time"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"delta_tcp_in", "delta_tcp_out", "delta_udp_in", "delta_udp_out",
+			"last_tcp_in", "last_tcp_out", "last_udp_in", "last_udp_out",
+			"avg_ping", "min_ping", "max_ping", "avg_pool", "min_pool", "max_pool",
+			"avg_tcps", "max_tcps", "avg_udps", "max_udps",
+			"avg_speed_in", "max_speed_in", "avg_speed_out", "max_speed_out",
+			"p50_ping", "p90_ping", "p99_ping", "jitter_ping", "ping_sketch",
+			"record_count", "row_count", "up_count", "updated_at",
+		}),
+	}).CreateInBatches(&rows, saveBatchSize).Error
+}
+
+// SelectTier 按查询起点选择层级：跨度越大层级越粗，所选层级未覆盖起点时继续向上选择
+// 返回空层级表示直接查询分钟数据
+func (s *Service) SelectTier(from time.Time) models.RollupTier {
+	span := s.now().Sub(from)
+	cfg := s.Config()
+
+	candidates := []models.RollupTier{"", models.RollupTier5m, models.RollupTier1h, models.RollupTier1d}
+	start := 3
+	switch {
+	case span <= 24*time.Hour:
+		start = 0
+	case span <= 7*24*time.Hour:
+		start = 1
+	case span <= 90*24*time.Hour:
+		start = 2
+	}
+	for _, tier := range candidates[start:] {
+		if cfg.Retention(tier) >= span {
+			return tier
+		}
+	}
+	return models.RollupTier1d
+}
+
+// Query 查询实例在指定层级自 from 起的汇总数据，按时间升序
+func (s *Service) Query(instanceID string, tier models.RollupTier, from time.Time) ([]models.ServiceHistoryRollup, error) {
+	spec, ok := specOf(tier)
+	if !ok {
+		return nil, fmt.Errorf("未知的降采样层级: %s", tier)
+	}
+	var rows []models.ServiceHistoryRollup
+	err := s.db.Where("tier = ? AND instance_id = ? AND bucket_time >= ?", tier, instanceID, spec.bucketStart(from)).
+		Order("bucket_time ASC").Find(&rows).Error
+	return rows, err
+}
+
+// PingSketch 合并实例自 from 起的延迟草图，数据来源与 SelectTier 一致
+func (s *Service) PingSketch(instanceID string, from time.Time) (*latency.Sketch, models.RollupTier, error) {
+	tier := s.SelectTier(from)
+	merged := latency.New()
+	if tier == "" {
+		var rows []models.ServiceHistory
+		if err := s.db.Select("ping_sketch").Where("instance_id = ? AND record_time >= ?", instanceID, from).
+			Find(&rows).Error; err != nil {
+			return nil, tier, err
+		}
+		for i := range rows {
+			merged.Merge(decodeSketch(rows[i].PingSketch))
+		}
+		return merged, tier, nil
+	}
+
+	rows, err := s.Query(instanceID, tier, from)
+	if err != nil {
+		return nil, tier, err
+	}
+	for i := range rows {
+		merged.Merge(decodeSketch(rows[i].PingSketch))
+	}
+	return merged, tier, nil
+}
@@ -0,0 +1,149 @@
+package rollup
+
+import (
+	"NodePassDash/internal/latency"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/testdb"
+	"math"
+	"testing"
+	"time"
+)
+
+// newTestService 创建使用内存数据库的降采样服务，当前时间固定为 now
+func newTestService(t *testing.T, now time.Time) *Service {
+	s := NewService(testdb.Open(t, &models.ServiceHistory{}, &models.ServiceHistoryRollup{}, &models.SystemConfig{}))
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestRunOnceCascades(t *testing.T) {
+	// 两天的分钟数据：累计流量每分钟 +10，第 30 分钟发生一次计数器重置
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	s := newTestService(t, start.Add(2*24*time.Hour+3*time.Minute))
+	db := s.db
+	var total int64
+	for i := 0; i < 2*24*60; i++ {
+		if i == 30 {
+			total = 0
+		}
+		total += 10
+		ping := float64(i % 60)
+		sketch := latency.New()
+		sketch.Add(ping)
+		db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: "abc", DeltaTCPIn: total, AvgPing: ping,
+			AvgPool: 2, RecordCount: 30, UpCount: 30, PingSketch: latency.Encode(sketch), RecordTime: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	if err := s.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	var count5m, count1h int64
+	db.Model(&models.ServiceHistoryRollup{}).Where("tier = ?", models.RollupTier5m).Count(&count5m)
+	db.Model(&models.ServiceHistoryRollup{}).Where("tier = ?", models.RollupTier1h).Count(&count1h)
+	if count5m != 2*24*12 || count1h != 48 {
+		t.Fatalf("5m=%d 1h=%d, want 576 and 48", count5m, count1h)
+	}
+
+	days, err := s.Query("abc", models.RollupTier1d, start)
+	if err != nil || len(days) != 2 {
+		t.Fatalf("1d rows = %d, %v", len(days), err)
+	}
+	// 首条记录无起点，之后每分钟 +10；重置那一分钟按重置后的值计
+	if d, sketch := days[0], decodeSketch(days[0].PingSketch); d.DeltaTCPIn != 1439*10 || d.RowCount != 1440 || d.RecordCount != 1440*30 ||
+		d.MinPing != 0 || d.MaxPing != 59 || d.AvgPing != 29.5 || d.AvgPool != 2 || math.Abs(d.P99Ping-59) > 0.6 ||
+		sketch == nil || sketch.Count != 1440 {
+		t.Errorf("day 1 = %+v", d)
+	}
+	if d := days[1]; d.DeltaTCPIn != 1440*10 || d.LastTCPIn != total {
+		t.Errorf("day 2 delta=%d last=%d, want 14400 and %d", d.DeltaTCPIn, d.LastTCPIn, total)
+	}
+
+	// 再次运行不应重复汇总
+	if err := s.RunOnce(); err != nil {
+		t.Fatalf("second RunOnce: %v", err)
+	}
+	var again int64
+	db.Model(&models.ServiceHistoryRollup{}).Where("tier = ?", models.RollupTier5m).Count(&again)
+	if again != count5m {
+		t.Errorf("5m rows after rerun = %d, want %d", again, count5m)
+	}
+}
+
+func TestSelectTier(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)
+	s := newTestService(t, now)
+
+	cases := []struct {
+		span time.Duration
+		want models.RollupTier
+	}{
+		{6 * time.Hour, ""},
+		{3 * 24 * time.Hour, models.RollupTier5m},
+		{30 * 24 * time.Hour, models.RollupTier1h},
+		{365 * 24 * time.Hour, models.RollupTier1d},
+	}
+	for _, c := range cases {
+		if got := s.SelectTier(now.Add(-c.span)); got != c.want {
+			t.Errorf("SelectTier(%v) = %q, want %q", c.span, got, c.want)
+		}
+	}
+
+	// 5m 层只保留 2 天时，3 天的查询改用 1h 层
+	cfg := DefaultConfig()
+	cfg.Retention5mDays = 2
+	if err := s.SetConfig(cfg); err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+	if got := s.SelectTier(now.Add(-3 * 24 * time.Hour)); got != models.RollupTier1h {
+		t.Errorf("SelectTier with short 5m retention = %q", got)
+	}
+	if err := (Config{Retention5mDays: 10, Retention1hDays: 5, Retention1dDays: 20}).validate(); err == nil {
+		t.Error("expected decreasing retention to be rejected")
+	}
+}
+
+func TestBucketsFollowHalfHourZone(t *testing.T) {
+	// 服务器位于 +05:30 时区时，小时桶与日桶都应按本地整点与零点对齐
+	local := time.Local
+	time.Local = time.FixedZone("IST", 5*3600+30*60)
+	defer func() { time.Local = local }()
+
+	at := time.Date(2024, 1, 1, 10, 47, 30, 0, time.Local)
+	for tier, want := range map[models.RollupTier]time.Time{
+		models.RollupTier5m: time.Date(2024, 1, 1, 10, 45, 0, 0, time.Local),
+		models.RollupTier1h: time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local),
+		models.RollupTier1d: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local),
+	} {
+		spec, _ := specOf(tier)
+		if got := spec.bucketStart(at); !got.Equal(want) {
+			t.Errorf("%s bucketStart = %v, want %v", tier, got, want)
+		}
+	}
+
+	// 本地时间 1 月 1 日全天的分钟数据，每分钟流量 +10
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	s := newTestService(t, start.Add(24*time.Hour+3*time.Minute))
+	db := s.db
+	for i := 0; i <= 24*60; i++ {
+		db.Create(&models.ServiceHistory{EndpointID: 1, InstanceID: "abc", DeltaTCPIn: int64(10 * (i + 1)),
+			RecordCount: 30, RecordTime: start.Add(time.Duration(i) * time.Minute)})
+	}
+	if err := s.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	hours, err := s.Query("abc", models.RollupTier1h, start)
+	if err != nil || len(hours) != 24 {
+		t.Fatalf("1h rows = %d, %v", len(hours), err)
+	}
+	for _, h := range hours {
+		if local := h.BucketTime.In(time.Local); local.Minute() != 0 || h.RowCount != 60 {
+			t.Errorf("1h bucket %v rows=%d, want local whole hour with 60 rows", local, h.RowCount)
+		}
+	}
+	days, err := s.Query("abc", models.RollupTier1d, start)
+	if err != nil || len(days) != 1 || days[0].RowCount != 1440 || days[0].DeltaTCPIn != 1439*10 {
+		t.Errorf("1d rows = %+v, %v", days, err)
+	}
+}
@@ -0,0 +1,71 @@
+package rollup
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/timezone"
+	"time"
+)
+
+// RawRetention service_history 分钟数据的保留时长（由 dashboard 流量清理任务删除）
+const RawRetention = 7 * 24 * time.Hour
+
+// tierSpec 降采样层级定义
+type tierSpec struct {
+	tier     models.RollupTier
+	interval time.Duration // 桶长度（日层按本地零点对齐，实际长度可能因夏令时不同）
+	chunk    time.Duration // 单次处理的源数据时间跨度
+	source   models.RollupTier
+}
+
+// tiers 按汇总顺序排列：分钟数据 -> 5m -> 1h -> 1d
+var tiers = []tierSpec{
+	{tier: models.RollupTier5m, interval: 5 * time.Minute, chunk: time.Hour},
+	{tier: models.RollupTier1h, interval: time.Hour, chunk: 2 * 24 * time.Hour, source: models.RollupTier5m},
+	{tier: models.RollupTier1d, interval: 24 * time.Hour, chunk: 31 * 24 * time.Hour, source: models.RollupTier1h},
+}
+
+// bucketStart 返回 t 所在桶的起始时间，按本地时区的整点与零点对齐
+func (s tierSpec) bucketStart(t time.Time) time.Time {
+	if s.tier == models.RollupTier1d {
+		return timezone.StartOfDay(t, time.Local)
+	}
+	hour := timezone.StartOfHour(t, time.Local)
+	return hour.Add(t.Sub(hour).Truncate(s.interval))
+}
+
+// next 返回下一个桶的起始时间
+func (s tierSpec) next(start time.Time) time.Time {
+	if s.tier == models.RollupTier1d {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(s.interval)
+}
+
+// chunkEnd 返回从 from 开始的单次处理结束时间（桶对齐且不超过 limit）
+func (s tierSpec) chunkEnd(from, limit time.Time) time.Time {
+	end := s.bucketStart(from.Add(s.chunk))
+	if !end.After(from) {
+		end = s.next(from)
+	}
+	if end.After(limit) {
+		end = limit
+	}
+	return end
+}
+
+func specOf(tier models.RollupTier) (tierSpec, bool) {
+	for _, s := range tiers {
+		if s.tier == tier {
+			return s, true
+		}
+	}
+	return tierSpec{}, false
+}
+
+// Interval 返回层级的桶长度，空层级表示分钟数据
+func Interval(tier models.RollupTier) time.Duration {
+	if s, ok := specOf(tier); ok {
+		return s.interval
+	}
+	return time.Minute
+}
@@ -1,16 +1,29 @@
 package router
 
 import (
+	"NodePassDash/internal/anomaly"
 	"NodePassDash/internal/api"
 	"NodePassDash/internal/auth"
 	"NodePassDash/internal/compliance"
 	"NodePassDash/internal/dashboard"
 	"NodePassDash/internal/endpoint"
+	"NodePassDash/internal/exporter"
+	"NodePassDash/internal/failover"
+	"NodePassDash/internal/forecast"
+	"NodePassDash/internal/grafana"
 	"NodePassDash/internal/group"
+	"NodePassDash/internal/healing"
+	"NodePassDash/internal/logalert"
+	"NodePassDash/internal/logsink"
+	"NodePassDash/internal/metricpush"
 	"NodePassDash/internal/metrics"
 	"NodePassDash/internal/middleware"
+	"NodePassDash/internal/report"
+	"NodePassDash/internal/rollup"
 	"NodePassDash/internal/services"
 	"NodePassDash/internal/sse"
+	"NodePassDash/internal/timezone"
+	"NodePassDash/internal/topology"
 	"NodePassDash/internal/tunnel"
 	"NodePassDash/internal/websocket"
 	"fmt"
@@ -24,7 +37,7 @@ import (
 )
 
 // SetupRouter 创建并配置主路由器
-func SetupRouter(db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager, wsService *websocket.Service, version string) *gin.Engine {
+func SetupRouter(db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager, wsService *websocket.Service, healingService *healing.Service, failoverService *failover.Service, logAlertService *logalert.Service, logSinkService *logsink.Service, metricPushService *metricpush.Service, rollupService *rollup.Service, anomalyService *anomaly.Service, reportService *report.Service, forecastService *forecast.Service, metricsExporter *exporter.Exporter, metricsToken string, grafanaToken string, version string) *gin.Engine {
 	r := gin.Default()
 
 	// 全局中间件
@@ -35,6 +48,11 @@ func SetupRouter(db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager,
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// Prometheus 指标：主端口上仅在配置了访问令牌时开放
+	if metricsExporter != nil && metricsToken != "" {
+		api.SetupMetricsExporterRoutes(r, metricsExporter, metricsToken)
+	}
+
 	// Setup 状态探测(Ready 模式下也响应)
 	// 与 cmd/server/setup.go 中 Setup 模式下的同名路由形成统一约定,
 	// 前端启动时无论后端在哪个模式都能拿到一致的 JSON 形状。
@@ -65,13 +83,13 @@ func SetupRouter(db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager,
 	r.Any("/docs-proxy/*path", docsProxyHandler)
 
 	// API路由
-	setupAPIRoutes(r, db, sseService, sseManager, wsService, version)
+	setupAPIRoutes(r, db, sseService, sseManager, wsService, healingService, failoverService, logAlertService, logSinkService, metricPushService, rollupService, anomalyService, reportService, forecastService, grafanaToken, version)
 
 	return r
 }
 
 // setupAPIRoutes 设置API路由
-func setupAPIRoutes(r *gin.Engine, db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager, wsService *websocket.Service, version string) {
+func setupAPIRoutes(r *gin.Engine, db *gorm.DB, sseService *sse.Service, sseManager *sse.Manager, wsService *websocket.Service, healingService *healing.Service, failoverService *failover.Service, logAlertService *logalert.Service, logSinkService *logsink.Service, metricPushService *metricpush.Service, rollupService *rollup.Service, anomalyService *anomaly.Service, reportService *report.Service, forecastService *forecast.Service, grafanaToken string, version string) {
 	apiGroup := r.Group("/api")
 	{
 		// 创建服务实例
@@ -81,6 +99,8 @@ func setupAPIRoutes(r *gin.Engine, db *gorm.DB, sseService *sse.Service, sseMana
 		groupService := group.NewService(db)
 		servicesService := services.NewService(db, tunnelService, sseManager)
 		dashboardService := dashboard.NewService(db)
+		topologyService := topology.NewService(db)
+		timezoneService := timezone.NewService(db)
 
 		// 创建 Metrics 系统相关的处理器
 		metricsAggregator := metrics.NewMetricsAggregator(db)
@@ -92,19 +112,34 @@ func setupAPIRoutes(r *gin.Engine, db *gorm.DB, sseService *sse.Service, sseMana
 		// 创建认证中间件
 		authMiddleware := middleware.AuthMiddleware(authService)
 
+		// Grafana 数据源路由自带认证，额外接受独立的数据源令牌
+		api.SetupGrafanaRoutes(apiGroup, grafana.NewService(db), authService, grafanaToken)
+
 		// 创建受保护的路由组（所有业务 API 都需要认证）
 		protectedGroup := apiGroup.Group("")
 		protectedGroup.Use(authMiddleware)
 		{
 			// 设置各模块的受保护路由
 			api.SetupEndpointRoutes(protectedGroup, endpointService, sseManager)
-			api.SetupTunnelRoutes(protectedGroup, tunnelService, sseManager, sseProcessor)
+			api.SetupTunnelRoutes(protectedGroup, tunnelService, sseManager, sseProcessor, rollupService, timezoneService)
 			api.SetupSSERoutes(protectedGroup, sseService, sseManager)
 			api.SetupWebSocketRoutes(protectedGroup, wsService)
-			api.SetupDashboardRoutes(protectedGroup, dashboardService)
+			api.SetupDashboardRoutes(protectedGroup, dashboardService, sseService, timezoneService)
 			api.SetupDataRoutes(protectedGroup, db, sseManager, endpointService, tunnelService)
 			api.SetupGroupRoutes(protectedGroup, groupService)
 			api.SetupServicesRoutes(protectedGroup, servicesService, tunnelService)
+			api.SetupHealingRoutes(protectedGroup, healingService)
+			api.SetupFailoverRoutes(protectedGroup, failoverService)
+			api.SetupLogAlertRoutes(protectedGroup, logAlertService)
+			api.SetupLogSinkRoutes(protectedGroup, logSinkService)
+			api.SetupMetricPushRoutes(protectedGroup, metricPushService)
+			api.SetupHistoryRollupRoutes(protectedGroup, rollupService)
+			api.SetupTrafficAnomalyRoutes(protectedGroup, anomalyService)
+			api.SetupUsageReportRoutes(protectedGroup, reportService)
+			api.SetupCapacityForecastRoutes(protectedGroup, forecastService)
+			api.SetupTimezoneRoutes(protectedGroup, timezoneService)
+			api.SetupTopologyRoutes(protectedGroup, topologyService)
+			api.SetupLogSearchRoutes(protectedGroup, sseManager)
 			api.SetupVersionRoutes(protectedGroup, version)
 			api.SetupDebugRoutes(protectedGroup)
 		}
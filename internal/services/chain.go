@@ -0,0 +1,483 @@
+package services
+
+import (
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// minChainEndpoints 多跳链路至少需要的主控数量（两跳）
+const minChainEndpoints = 3
+
+// chainHopPlan 单跳规划：client 位于前一个主控，server 位于后一个主控
+type chainHopPlan struct {
+	Client models.Tunnel
+	Server models.Tunnel
+}
+
+// serviceInstance 服务成员实例，Hop 仅在多跳链路中有意义
+type serviceInstance struct {
+	Hop        int
+	Role       models.TunnelType
+	EndpointID int64
+	InstanceID string
+}
+
+// planChainHops 按主控顺序规划每一跳的隧道配置，hosts[i] 为第 i 个主控的对外地址。
+// 每一跳都是双端转发：server 端统一监听 tunnelPort，中间主控上的 server 出口
+// 指向本机 relayPort，由下一跳的 client 在 relayPort 上接收并继续转发。
+func planChainHops(req *CreateChainServiceRequest, hosts []string) ([]chainHopPlan, error) {
+	n := len(req.EndpointIDs)
+	if n < minChainEndpoints {
+		return nil, fmt.Errorf("chain service requires at least %d endpoints", minChainEndpoints)
+	}
+	if len(hosts) != n {
+		return nil, errors.New("endpoint hosts do not match endpoints")
+	}
+	seen := make(map[int64]bool, n)
+	for _, id := range req.EndpointIDs {
+		if seen[id] {
+			return nil, fmt.Errorf("endpoint %d appears more than once in chain", id)
+		}
+		seen[id] = true
+	}
+	if req.RelayPort == 0 {
+		req.RelayPort = req.TunnelPort + 1
+		if req.RelayPort > 65535 {
+			req.RelayPort = req.TunnelPort - 1
+		}
+	}
+	if req.RelayPort == req.TunnelPort {
+		return nil, errors.New("relay port must differ from tunnel port")
+	}
+
+	mode := models.Mode2
+	password := req.Password
+	var listenType *string
+	if req.ListenType != "" {
+		listenType = &req.ListenType
+	}
+	var certPath, keyPath *string
+	if req.CertPath != "" {
+		certPath = &req.CertPath
+	}
+	if req.KeyPath != "" {
+		keyPath = &req.KeyPath
+	}
+	tunnelPort := strconv.Itoa(req.TunnelPort)
+	relayPort := strconv.Itoa(req.RelayPort)
+
+	plans := make([]chainHopPlan, 0, n-1)
+	var errs nodepass.ValidationErrors
+	for i := 0; i < n-1; i++ {
+		client := models.Tunnel{
+			Name:          fmt.Sprintf("%s-hop%d-c", req.Name, i),
+			EndpointID:    req.EndpointIDs[i],
+			Type:          models.TunnelModeClient,
+			TunnelAddress: hosts[i+1],
+			TunnelPort:    tunnelPort,
+			TargetAddress: "127.0.0.1",
+			TargetPort:    relayPort,
+			ListenType:    listenType,
+			LogLevel:      models.LogLevel(req.LogLevel),
+			Password:      &password,
+			Mode:          &mode,
+		}
+		if i == 0 {
+			client.TargetAddress = req.ListenHost
+			client.TargetPort = strconv.Itoa(req.ListenPort)
+		}
+
+		server := models.Tunnel{
+			Name:          fmt.Sprintf("%s-hop%d-s", req.Name, i),
+			EndpointID:    req.EndpointIDs[i+1],
+			Type:          models.TunnelModeServer,
+			TunnelPort:    tunnelPort,
+			TargetAddress: "127.0.0.1",
+			TargetPort:    relayPort,
+			ListenType:    listenType,
+			LogLevel:      models.LogLevel(req.LogLevel),
+			TLSMode:       models.TLSMode(req.TLSMode),
+			CertPath:      certPath,
+			KeyPath:       keyPath,
+			Password:      &password,
+			Mode:          &mode,
+		}
+		if i == n-2 {
+			server.TargetAddress = req.TargetHost
+			server.TargetPort = strconv.Itoa(req.TargetPort)
+		}
+
+		for _, t := range []models.Tunnel{client, server} {
+			for _, e := range nodepass.NewTunnelConfig(t).Normalize().Validate() {
+				e.Field = fmt.Sprintf("hop%d.%s.%s", i, t.Type, e.Field)
+				errs = append(errs, e)
+			}
+		}
+		plans = append(plans, chainHopPlan{Client: client, Server: server})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return plans, nil
+}
+
+// CreateChainService 按顺序在多个主控之间创建多跳链路，所有跳共用同一个 SID、密码与端口，
+// 任一实例创建失败时回滚已创建的全部实例
+func (s *ServiceImpl) CreateChainService(req *CreateChainServiceRequest) (*CreateChainServiceResult, error) {
+	hosts := make([]string, len(req.EndpointIDs))
+	for i, id := range req.EndpointIDs {
+		host, err := s.endpointHost(id)
+		if err != nil {
+			return nil, err
+		}
+		hosts[i] = host
+	}
+	if req.Password == "" {
+		req.Password = strings.ReplaceAll(uuid.New().String(), "-", "")[:16]
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("chain-%d", time.Now().Unix())
+	}
+
+	plans, err := planChainHops(req, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []*models.Tunnel
+	rollback := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			s.rollbackClone(created[i])
+		}
+	}
+
+	// 从出口往入口创建，保证每一跳 client 启动时上游 server 已就绪
+	hops := make([]models.ServiceHop, len(plans))
+	for i := len(plans) - 1; i >= 0; i-- {
+		server, err := s.tunnelService.NewCreateTunnelAndWait(plans[i].Server, 3*time.Second)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to create hop %d server tunnel: %w", i, err)
+		}
+		created = append(created, server)
+
+		client, err := s.tunnelService.NewCreateTunnelAndWait(plans[i].Client, 3*time.Second)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to create hop %d client tunnel: %w", i, err)
+		}
+		created = append(created, client)
+
+		hops[i] = models.ServiceHop{
+			HopIndex:         i,
+			ClientEndpointID: client.EndpointID,
+			ClientInstanceID: *client.InstanceID,
+			ServerEndpointID: server.EndpointID,
+			ServerInstanceID: *server.InstanceID,
+			TunnelPort:       req.TunnelPort,
+		}
+	}
+
+	sid := uuid.New().String()
+	serviceType := models.ServiceTypeChain
+	alias := req.Name
+	tunnelPort := strconv.Itoa(req.TunnelPort)
+	entrancePort := strconv.Itoa(req.ListenPort)
+	exitPort := strconv.Itoa(req.TargetPort)
+	first, last := hops[0], hops[len(hops)-1]
+	service := models.Services{
+		Sid:              sid,
+		Type:             serviceType,
+		Alias:            &alias,
+		ClientInstanceId: &first.ClientInstanceID,
+		ClientEndpointId: &first.ClientEndpointID,
+		ServerInstanceId: &last.ServerInstanceID,
+		ServerEndpointId: &last.ServerEndpointID,
+		TunnelPort:       &tunnelPort,
+		EntranceHost:     &req.ListenHost,
+		EntrancePort:     &entrancePort,
+		ExitHost:         &req.TargetHost,
+		ExitPort:         &exitPort,
+	}
+	var entrance models.Endpoint
+	if err := s.db.Select("id", "name", "hostname").First(&entrance, first.ClientEndpointID).Error; err == nil {
+		service.TunnelEndpointName = &entrance.Name
+		if req.ListenHost == "" {
+			service.EntranceHost = &entrance.Hostname
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var maxSorts int64
+		tx.Model(&models.Services{}).Select("COALESCE(MAX(sorts), -1)").Scan(&maxSorts)
+		service.Sorts = maxSorts + 1
+		if err := tx.Create(&service).Error; err != nil {
+			return err
+		}
+		for i := range hops {
+			hops[i].Sid = sid
+		}
+		return tx.Create(&hops).Error
+	})
+	if err != nil {
+		rollback()
+		return nil, fmt.Errorf("failed to save chain service: %w", err)
+	}
+
+	// peer 写入失败只记录日志，服务记录已由本包维护，不依赖 SSE 的 upsertService
+	peer := &models.Peer{SID: &sid, Type: &serviceType, Alias: &alias}
+	if err := s.updatePeers(chainInstancesOf(hops, false), peer, false); err != nil {
+		log.Warnf("[Service] 设置链路 peer 失败 sid=%s err=%v", sid, err)
+	}
+
+	result := &CreateChainServiceResult{Sid: sid}
+	for _, t := range created {
+		result.TunnelIDs = append(result.TunnelIDs, t.ID)
+	}
+	log.Infof("[Service] 多跳链路服务 %s 创建完成，共 %d 跳", sid, len(hops))
+	return result, nil
+}
+
+// GetChainHops 返回链路每一跳的实例状态，两端都在运行时视为健康
+func (s *ServiceImpl) GetChainHops(sid string) ([]ChainHopStatus, error) {
+	hops, err := s.chainHops(sid)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[int64]string{}
+	var endpoints []models.Endpoint
+	s.db.Select("id", "name").Find(&endpoints)
+	for _, ep := range endpoints {
+		names[ep.ID] = ep.Name
+	}
+
+	lookup := func(endpointID int64, instanceID string) *models.Tunnel {
+		if instanceID == "" {
+			return nil
+		}
+		var t models.Tunnel
+		if err := s.db.Select("id", "status", "ping", "pool").
+			Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).
+			First(&t).Error; err != nil {
+			return nil
+		}
+		return &t
+	}
+
+	statuses := make([]ChainHopStatus, 0, len(hops))
+	for _, hop := range hops {
+		st := ChainHopStatus{
+			HopIndex:           hop.HopIndex,
+			ClientEndpointID:   hop.ClientEndpointID,
+			ClientEndpointName: names[hop.ClientEndpointID],
+			ClientInstanceID:   hop.ClientInstanceID,
+			ClientStatus:       "missing",
+			ServerEndpointID:   hop.ServerEndpointID,
+			ServerEndpointName: names[hop.ServerEndpointID],
+			ServerInstanceID:   hop.ServerInstanceID,
+			ServerStatus:       "missing",
+			TunnelPort:         hop.TunnelPort,
+		}
+		if client := lookup(hop.ClientEndpointID, hop.ClientInstanceID); client != nil {
+			st.ClientStatus = string(client.Status)
+			st.Ping = client.Ping
+			st.Pool = client.Pool
+		}
+		if server := lookup(hop.ServerEndpointID, hop.ServerInstanceID); server != nil {
+			st.ServerStatus = string(server.Status)
+		}
+		st.Healthy = st.ClientStatus == string(models.TunnelStatusRunning) &&
+			st.ServerStatus == string(models.TunnelStatusRunning)
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// chainHops 按跳序读取链路记录
+func (s *ServiceImpl) chainHops(sid string) ([]models.ServiceHop, error) {
+	var hops []models.ServiceHop
+	if err := s.db.Where("sid = ?", sid).Order("hop_index ASC").Find(&hops).Error; err != nil {
+		return nil, fmt.Errorf("failed to query chain hops: %w", err)
+	}
+	if len(hops) == 0 {
+		return nil, errors.New("chain service has no hops")
+	}
+	return hops, nil
+}
+
+// chainInstancesOf 展开链路中的全部实例；exitFirst 为 true 时从出口往入口排列
+func chainInstancesOf(hops []models.ServiceHop, exitFirst bool) []serviceInstance {
+	refs := make([]serviceInstance, 0, len(hops)*2)
+	for _, hop := range hops {
+		if hop.ClientInstanceID != "" {
+			refs = append(refs, serviceInstance{Hop: hop.HopIndex, Role: models.TunnelModeClient, EndpointID: hop.ClientEndpointID, InstanceID: hop.ClientInstanceID})
+		}
+		if hop.ServerInstanceID != "" {
+			refs = append(refs, serviceInstance{Hop: hop.HopIndex, Role: models.TunnelModeServer, EndpointID: hop.ServerEndpointID, InstanceID: hop.ServerInstanceID})
+		}
+	}
+	if exitFirst {
+		for i, j := 0, len(refs)-1; i < j; i, j = i+1, j-1 {
+			refs[i], refs[j] = refs[j], refs[i]
+		}
+	}
+	return refs
+}
+
+// controlChain 对链路全部实例执行 start/stop/restart；启动从出口开始，停止从入口开始
+func (s *ServiceImpl) controlChain(sid, action string) error {
+	hops, err := s.chainHops(sid)
+	if err != nil {
+		return err
+	}
+	for _, ref := range chainInstancesOf(hops, action != "stop") {
+		if _, err := nodepass.ControlInstance(ref.EndpointID, ref.InstanceID, action); err != nil {
+			return fmt.Errorf("failed to %s hop %d %s instance: %w", action, ref.Hop, ref.Role, err)
+		}
+	}
+	return nil
+}
+
+// deleteChain 删除链路全部实例及服务记录，已不存在的实例直接跳过
+func (s *ServiceImpl) deleteChain(sid string) error {
+	hops, err := s.chainHops(sid)
+	if err != nil {
+		return err
+	}
+	for _, ref := range chainInstancesOf(hops, false) {
+		if err := s.deleteInstance(ref); err != nil {
+			return fmt.Errorf("failed to delete hop %d %s instance: %w", ref.Hop, ref.Role, err)
+		}
+	}
+	return s.removeChainRecords(sid)
+}
+
+// dissolveChain 清空链路全部实例的 peer 并删除服务记录，实例保留
+func (s *ServiceImpl) dissolveChain(sid string) error {
+	hops, err := s.chainHops(sid)
+	if err != nil {
+		return err
+	}
+	empty := ""
+	if err := s.updatePeers(chainInstancesOf(hops, false), &models.Peer{SID: &empty, Type: &empty, Alias: &empty}, true); err != nil {
+		return err
+	}
+	return s.removeChainRecords(sid)
+}
+
+// renameChain 修改链路全部实例的 peer.alias
+func (s *ServiceImpl) renameChain(service *models.Services, newName string) error {
+	hops, err := s.chainHops(service.Sid)
+	if err != nil {
+		return err
+	}
+	peer := &models.Peer{SID: &service.Sid, Type: &service.Type, Alias: &newName}
+	return s.updatePeers(chainInstancesOf(hops, false), peer, false)
+}
+
+// syncChain 校验链路各跳实例仍然存在，并以入口 client 的流量刷新服务统计
+func (s *ServiceImpl) syncChain(service *models.Services) error {
+	hops, err := s.chainHops(service.Sid)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, ref := range chainInstancesOf(hops, false) {
+		var count int64
+		s.db.Model(&models.Tunnel{}).Where("endpoint_id = ? AND instance_id = ?", ref.EndpointID, ref.InstanceID).Count(&count)
+		if count == 0 {
+			missing = append(missing, fmt.Sprintf("hop%d.%s", ref.Hop, ref.Role))
+		}
+	}
+
+	var entrance models.Tunnel
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", hops[0].ClientEndpointID, hops[0].ClientInstanceID).
+		First(&entrance).Error; err == nil {
+		if err := s.db.Model(&models.Services{}).
+			Where("sid = ? AND type = ?", service.Sid, service.Type).
+			Updates(map[string]interface{}{
+				"total_rx": entrance.TCPRx + entrance.UDPRx,
+				"total_tx": entrance.TCPTx + entrance.UDPTx,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update chain traffic: %w", err)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("chain instances missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// updatePeers 将 peer 写入一组实例，并同步隧道表的 peer 与 service_sid；
+// ignoreMissing 为 true 时忽略已被删除的实例
+func (s *ServiceImpl) updatePeers(refs []serviceInstance, peer *models.Peer, ignoreMissing bool) error {
+	peerJSON, err := json.Marshal(peer)
+	if err != nil {
+		return err
+	}
+	var serviceSID interface{}
+	if peer.SID != nil && *peer.SID != "" {
+		serviceSID = *peer.SID
+	}
+
+	for _, ref := range refs {
+		if _, err := nodepass.UpdateInstancePeers(ref.EndpointID, ref.InstanceID, peer); err != nil {
+			if !ignoreMissing || !strings.Contains(err.Error(), "404") {
+				return fmt.Errorf("failed to update %s instance %s peer info: %w", ref.Role, ref.InstanceID, err)
+			}
+			log.Warnf("[Service] 实例不存在，可能已被删除: instanceID=%s, endpointID=%d", ref.InstanceID, ref.EndpointID)
+		}
+		if err := s.db.Model(&models.Tunnel{}).
+			Where("endpoint_id = ? AND instance_id = ?", ref.EndpointID, ref.InstanceID).
+			Updates(map[string]interface{}{
+				"peer":        string(peerJSON),
+				"service_sid": serviceSID,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to update %s tunnel %s peer field: %w", ref.Role, ref.InstanceID, err)
+		}
+	}
+	return nil
+}
+
+// deleteInstance 删除单个成员实例及其分组关系与文件日志，实例已不存在时直接跳过
+func (s *ServiceImpl) deleteInstance(ref serviceInstance) error {
+	var tunnelID int64
+	if err := s.db.Raw(`SELECT id FROM tunnels WHERE endpoint_id = ? AND instance_id = ?`, ref.EndpointID, ref.InstanceID).Scan(&tunnelID).Error; err == nil && tunnelID > 0 {
+		s.db.Exec("DELETE FROM tunnel_groups WHERE tunnel_id = ?", tunnelID)
+	}
+	if err := s.tunnelService.DeleteTunnelIdAndWait(3*time.Second, &tunnelID); err != nil {
+		if err.Error() != "隧道不存在" {
+			return err
+		}
+		log.Warnf("[Service] 实例不存在，可能已被删除: instanceID=%s, endpointID=%d", ref.InstanceID, ref.EndpointID)
+	}
+	if s.sseManager != nil && s.sseManager.GetFileLogger() != nil {
+		s.sseManager.GetFileLogger().ClearLogs(ref.EndpointID, ref.InstanceID)
+	}
+	return nil
+}
+
+// removeChainRecords 删除链路的服务记录与跳记录
+func (s *ServiceImpl) removeChainRecords(sid string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sid = ?", sid).Delete(&models.ServiceHop{}).Error; err != nil {
+			return fmt.Errorf("failed to delete chain hops: %w", err)
+		}
+		if err := tx.Where("sid = ?", sid).Delete(&models.Services{}).Error; err != nil {
+			return fmt.Errorf("failed to delete service record: %w", err)
+		}
+		return nil
+	})
+}
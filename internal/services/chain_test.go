@@ -0,0 +1,68 @@
+package services
+
+import (
+	"NodePassDash/internal/nodepass"
+	"testing"
+)
+
+func TestPlanChainHops(t *testing.T) {
+	req := &CreateChainServiceRequest{
+		Name:        "c",
+		EndpointIDs: []int64{1, 2, 3, 4},
+		ListenPort:  8080,
+		TunnelPort:  10101,
+		Password:    "pw",
+		TargetHost:  "10.0.0.5",
+		TargetPort:  22,
+	}
+	plans, err := planChainHops(req, []string{"a.example", "b.example", "c.example", "d.example"})
+	if err != nil {
+		t.Fatalf("planChainHops: %v", err)
+	}
+
+	want := [][2]string{
+		{"client://b.example:10101/:8080?mode=2", "server://:10101/127.0.0.1:10102?mode=2"},
+		{"client://c.example:10101/127.0.0.1:10102?mode=2", "server://:10101/127.0.0.1:10102?mode=2"},
+		{"client://d.example:10101/127.0.0.1:10102?mode=2", "server://:10101/10.0.0.5:22?mode=2"},
+	}
+	if len(plans) != len(want) {
+		t.Fatalf("got %d hops, want %d", len(plans), len(want))
+	}
+	for i, p := range plans {
+		if p.Client.EndpointID != req.EndpointIDs[i] || p.Server.EndpointID != req.EndpointIDs[i+1] {
+			t.Errorf("hop %d endpoints = %d->%d", i, p.Client.EndpointID, p.Server.EndpointID)
+		}
+		client := nodepass.NewTunnelConfig(p.Client).Normalize()
+		server := nodepass.NewTunnelConfig(p.Server).Normalize()
+		client.Password, server.Password = "", ""
+		if got := client.BuildURL(); got != want[i][0] {
+			t.Errorf("hop %d client = %s, want %s", i, got, want[i][0])
+		}
+		if got := server.BuildURL(); got != want[i][1] {
+			t.Errorf("hop %d server = %s, want %s", i, got, want[i][1])
+		}
+	}
+}
+
+func TestPlanChainHopsRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CreateChainServiceRequest
+	}{
+		{"too few endpoints", CreateChainServiceRequest{EndpointIDs: []int64{1, 2}, ListenPort: 80, TunnelPort: 100, TargetPort: 22}},
+		{"duplicate endpoint", CreateChainServiceRequest{EndpointIDs: []int64{1, 2, 1}, ListenPort: 80, TunnelPort: 100, TargetPort: 22}},
+		{"relay equals tunnel port", CreateChainServiceRequest{EndpointIDs: []int64{1, 2, 3}, ListenPort: 80, TunnelPort: 100, RelayPort: 100, TargetPort: 22}},
+		{"invalid target port", CreateChainServiceRequest{EndpointIDs: []int64{1, 2, 3}, ListenPort: 80, TunnelPort: 100, TargetPort: 70000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := make([]string, len(tt.req.EndpointIDs))
+			for i := range hosts {
+				hosts[i] = "h"
+			}
+			if _, err := planChainHops(&tt.req, hosts); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/tunnel"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CloneService 将服务（client 与可选的 server 两端）复制到新的主控组合上
+// 每个克隆目标都会生成新的 SID 并重写 peer，使新的两端组成一个独立的服务
+func (s *ServiceImpl) CloneService(sid string, req *CloneServiceRequest) ([]CloneServiceResult, error) {
+	service, err := s.GetServiceByID(sid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if service.Type == models.ServiceTypeChain {
+		return nil, errors.New("chain service does not support clone")
+	}
+	if service.ClientInstanceId == nil || service.ClientEndpointId == nil {
+		return nil, errors.New("service has no client instance")
+	}
+
+	var clientTunnel models.Tunnel
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", *service.ClientEndpointId, *service.ClientInstanceId).
+		First(&clientTunnel).Error; err != nil {
+		return nil, fmt.Errorf("client tunnel does not exist: %w", err)
+	}
+
+	var serverTunnel *models.Tunnel
+	if service.ServerInstanceId != nil && *service.ServerInstanceId != "" && service.ServerEndpointId != nil {
+		serverTunnel = &models.Tunnel{}
+		if err := s.db.Where("endpoint_id = ? AND instance_id = ?", *service.ServerEndpointId, *service.ServerInstanceId).
+			First(serverTunnel).Error; err != nil {
+			return nil, fmt.Errorf("server tunnel does not exist: %w", err)
+		}
+	}
+
+	results := make([]CloneServiceResult, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		results = append(results, s.cloneServiceTo(service, &clientTunnel, serverTunnel, target))
+	}
+	return results, nil
+}
+
+// cloneServiceTo 克隆到单个目标，client 端失败时回滚已创建的 server 端
+func (s *ServiceImpl) cloneServiceTo(service *models.Services, clientTunnel, serverTunnel *models.Tunnel, target CloneServiceTarget) CloneServiceResult {
+	name := target.Name
+	if name == "" {
+		name = clientTunnel.Name
+		if service.Alias != nil && *service.Alias != "" {
+			name = *service.Alias
+		}
+		name += "-clone"
+	}
+	result := CloneServiceResult{Name: name}
+
+	newSid := uuid.New().String()
+	serviceType := service.Type
+	alias := name
+	peer := &models.Peer{SID: &newSid, Type: &serviceType, Alias: &alias}
+
+	// 出口目标所在的一端：隧道转发(2/4/7)在 server 端，其余在 client 端
+	exitOnServer := serviceType == "2" || serviceType == "4" || serviceType == "7"
+
+	clientOv := tunnel.CloneOverrides{Name: name}
+	if !exitOnServer {
+		clientOv.TargetAddress, clientOv.TargetPort = target.TargetAddress, target.TargetPort
+	}
+
+	if serverTunnel == nil {
+		clientOv.TunnelPort = target.TunnelPort
+	} else {
+		serverEndpointID := *service.ServerEndpointId
+		if target.ServerEndpointID != nil {
+			serverEndpointID = *target.ServerEndpointID
+		}
+
+		serverOv := tunnel.CloneOverrides{Name: name + "-s", TunnelPort: target.TunnelPort}
+		if exitOnServer {
+			serverOv.TargetAddress, serverOv.TargetPort = target.TargetAddress, target.TargetPort
+		}
+		newServer, err := s.tunnelService.CloneTunnelTo(*serverTunnel, serverEndpointID, serverOv, peer)
+		if err != nil {
+			result.Error = "failed to clone server tunnel: " + err.Error()
+			return result
+		}
+		result.ServerTunnelID = newServer.ID
+
+		// client 端改为连接新的 server 端
+		clientOv.Name = name + "-c"
+		clientOv.TunnelPort = target.TunnelPort
+		if serverEndpointID != *service.ServerEndpointId {
+			host, err := s.endpointHost(serverEndpointID)
+			if err != nil {
+				s.rollbackClone(newServer)
+				result.Error = err.Error()
+				return result
+			}
+			clientOv.TunnelAddress = &host
+		}
+	}
+
+	newClient, err := s.tunnelService.CloneTunnelTo(*clientTunnel, target.ClientEndpointID, clientOv, peer)
+	if err != nil {
+		if result.ServerTunnelID > 0 {
+			s.rollbackClone(&models.Tunnel{ID: result.ServerTunnelID})
+			result.ServerTunnelID = 0
+		}
+		result.Error = "failed to clone client tunnel: " + err.Error()
+		return result
+	}
+
+	result.ClientTunnelID = newClient.ID
+	result.Sid = newSid
+	result.Success = true
+	log.Infof("[Service] 服务 %s 已克隆为 %s", service.Sid, newSid)
+	return result
+}
+
+// endpointHost 获取主控对外地址
+func (s *ServiceImpl) endpointHost(endpointID int64) (string, error) {
+	var endpoint models.Endpoint
+	if err := s.db.Select("id", "url", "hostname").First(&endpoint, endpointID).Error; err != nil {
+		return "", fmt.Errorf("server endpoint does not exist: %w", err)
+	}
+	return endpoint.Host(), nil
+}
+
+// rollbackClone 删除克隆过程中已创建的隧道
+func (s *ServiceImpl) rollbackClone(t *models.Tunnel) {
+	s.db.Exec("DELETE FROM tunnel_groups WHERE tunnel_id = ?", t.ID)
+	if err := s.tunnelService.DeleteTunnelIdAndWait(3*time.Second, &t.ID); err != nil {
+		log.Warnf("[Service] 回滚克隆隧道失败 tunnel=%d err=%v", t.ID, err)
+	}
+}
@@ -0,0 +1,407 @@
+package services
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/sysconfig"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// healthConfigKey 服务健康判定配置在 system_configs 中的键
+const healthConfigKey = "services_health_config"
+
+// ErrInvalidHealthConfig 健康判定配置不合法
+var ErrInvalidHealthConfig = errors.New("无效的健康判定配置")
+
+// HealthConfig 服务健康判定配置，保存在 system_configs 中
+type HealthConfig struct {
+	PingDegradedMs int64 `json:"pingDegradedMs"` // client 端延迟超过该值时服务判定为降级
+}
+
+// DefaultHealthConfig 默认健康判定配置
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{PingDegradedMs: 500}
+}
+
+// HealthConfig 读取健康判定配置，未设置或无效时返回默认值
+func (s *ServiceImpl) HealthConfig() HealthConfig {
+	cfg := DefaultHealthConfig()
+	if ok, err := sysconfig.GetJSON(s.db, healthConfigKey, &cfg); !ok || err != nil || cfg.PingDegradedMs <= 0 {
+		return DefaultHealthConfig()
+	}
+	return cfg
+}
+
+// SetHealthConfig 校验并保存健康判定配置
+func (s *ServiceImpl) SetHealthConfig(cfg HealthConfig) error {
+	if cfg.PingDegradedMs <= 0 {
+		return fmt.Errorf("%w: pingDegradedMs 必须大于 0", ErrInvalidHealthConfig)
+	}
+	return sysconfig.SetJSON(s.db, healthConfigKey, cfg)
+}
+
+// serviceMember 服务的成员实例引用
+type serviceMember struct {
+	Member     string
+	Client     bool
+	EndpointID int64
+	InstanceID string
+}
+
+// healthSnapshot 计算健康状态所需的实例与主控状态
+type healthSnapshot struct {
+	tunnels        map[string]models.Tunnel
+	endpoints      map[int64]models.Endpoint
+	pingDegradedMs int64
+}
+
+func tunnelKey(endpointID int64, instanceID string) string {
+	return fmt.Sprintf("%d/%s", endpointID, instanceID)
+}
+
+// isDualService 是否为包含 server 端的双端服务
+func isDualService(serviceType string) bool {
+	switch serviceType {
+	case "1", "2", "3", "4", "6", "7", models.ServiceTypeChain:
+		return true
+	}
+	return false
+}
+
+// serviceMembers 列出服务的全部成员实例，缺失的实例以空 InstanceID 保留以便判定为 down
+func serviceMembers(service *models.Services, hops []models.ServiceHop) []serviceMember {
+	if service.Type == models.ServiceTypeChain {
+		members := make([]serviceMember, 0, len(hops)*2)
+		for _, hop := range hops {
+			members = append(members,
+				serviceMember{Member: fmt.Sprintf("hop%d.client", hop.HopIndex), Client: true, EndpointID: hop.ClientEndpointID, InstanceID: hop.ClientInstanceID},
+				serviceMember{Member: fmt.Sprintf("hop%d.server", hop.HopIndex), EndpointID: hop.ServerEndpointID, InstanceID: hop.ServerInstanceID},
+			)
+		}
+		return members
+	}
+
+	deref := func(id *int64, instance *string) (int64, string) {
+		var endpointID int64
+		var instanceID string
+		if id != nil {
+			endpointID = *id
+		}
+		if instance != nil {
+			instanceID = *instance
+		}
+		return endpointID, instanceID
+	}
+	client := serviceMember{Member: "client", Client: true}
+	client.EndpointID, client.InstanceID = deref(service.ClientEndpointId, service.ClientInstanceId)
+	members := []serviceMember{client}
+	if isDualService(service.Type) {
+		server := serviceMember{Member: "server"}
+		server.EndpointID, server.InstanceID = deref(service.ServerEndpointId, service.ServerInstanceId)
+		members = append(members, server)
+	}
+	return members
+}
+
+// loadHealthSnapshot 读取实例与主控状态，instanceIDs 为空时读取全部
+func (s *ServiceImpl) loadHealthSnapshot(instanceIDs []string) (*healthSnapshot, error) {
+	snap := &healthSnapshot{tunnels: map[string]models.Tunnel{}, endpoints: map[int64]models.Endpoint{},
+		pingDegradedMs: s.HealthConfig().PingDegradedMs}
+
+	var tunnels []models.Tunnel
+	query := s.db.Select("endpoint_id", "instance_id", "status", "ping", "pool")
+	if instanceIDs != nil {
+		query = query.Where("instance_id IN ?", instanceIDs)
+	}
+	if err := query.Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range tunnels {
+		if t.InstanceID != nil {
+			snap.tunnels[tunnelKey(t.EndpointID, *t.InstanceID)] = t
+		}
+	}
+
+	var endpoints []models.Endpoint
+	if err := s.db.Select("id", "name", "status").Find(&endpoints).Error; err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		snap.endpoints[ep.ID] = ep
+	}
+	return snap, nil
+}
+
+// memberHealth 组装成员实例的当前状态
+func (snap *healthSnapshot) memberHealth(members []serviceMember) []ServiceMemberHealth {
+	result := make([]ServiceMemberHealth, 0, len(members))
+	for _, m := range members {
+		mh := ServiceMemberHealth{Member: m.Member, EndpointID: m.EndpointID, InstanceID: m.InstanceID, Status: "missing"}
+		if ep, ok := snap.endpoints[m.EndpointID]; ok {
+			mh.EndpointName = ep.Name
+			mh.EndpointStatus = string(ep.Status)
+		}
+		if t, ok := snap.tunnels[tunnelKey(m.EndpointID, m.InstanceID)]; ok && m.InstanceID != "" {
+			mh.Status = string(t.Status)
+			if m.Client {
+				mh.Ping, mh.Pool = t.Ping, t.Pool
+			}
+		}
+		result = append(result, mh)
+	}
+	return result
+}
+
+// evaluateHealth 根据成员状态计算服务综合健康状态：
+// 任一成员实例缺失、所在主控离线或未运行时为 down；
+// 双端服务 client 端连接池为空或任一 client 延迟超过 pingDegradedMs 时为 degraded
+func evaluateHealth(dual bool, members []ServiceMemberHealth, pingDegradedMs int64) (string, []string) {
+	state := HealthHealthy
+	reasons := []string{}
+	degrade := func(reason string) {
+		if state == HealthHealthy {
+			state = HealthDegraded
+		}
+		reasons = append(reasons, reason)
+	}
+
+	for _, m := range members {
+		switch {
+		case m.Status == "missing":
+			state = HealthDown
+			reasons = append(reasons, fmt.Sprintf("%s 实例不存在", m.Member))
+		case m.EndpointStatus != string(models.EndpointStatusOnline):
+			state = HealthDown
+			reasons = append(reasons, fmt.Sprintf("%s 所在主控 %s 状态为 %s", m.Member, m.EndpointName, m.EndpointStatus))
+		case m.Status != string(models.TunnelStatusRunning):
+			state = HealthDown
+			reasons = append(reasons, fmt.Sprintf("%s 实例状态为 %s", m.Member, m.Status))
+		default:
+			if dual && m.Pool != nil && *m.Pool == 0 {
+				degrade(fmt.Sprintf("%s 连接池为空", m.Member))
+			}
+			if m.Ping != nil && *m.Ping > pingDegradedMs {
+				degrade(fmt.Sprintf("%s 延迟 %dms 超过 %dms", m.Member, *m.Ping, pingDegradedMs))
+			}
+		}
+	}
+	return state, reasons
+}
+
+// GetServiceHealth 获取服务综合健康状态
+func (s *ServiceImpl) GetServiceHealth(sid string) (*ServiceHealth, error) {
+	service, err := s.GetServiceByID(sid)
+	if err != nil {
+		return nil, err
+	}
+	var hops []models.ServiceHop
+	if service.Type == models.ServiceTypeChain {
+		if hops, err = s.chainHops(sid); err != nil {
+			return nil, err
+		}
+	}
+
+	members := serviceMembers(service, hops)
+	instanceIDs := make([]string, 0, len(members))
+	for _, m := range members {
+		instanceIDs = append(instanceIDs, m.InstanceID)
+	}
+	snap, err := s.loadHealthSnapshot(instanceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instance status: %w", err)
+	}
+	return snap.serviceHealth(service, hops, true), nil
+}
+
+// serviceHealth 计算单个服务的健康状态，withMembers 为 false 时不返回成员明细
+func (snap *healthSnapshot) serviceHealth(service *models.Services, hops []models.ServiceHop, withMembers bool) *ServiceHealth {
+	members := snap.memberHealth(serviceMembers(service, hops))
+	state, reasons := evaluateHealth(isDualService(service.Type), members, snap.pingDegradedMs)
+	health := &ServiceHealth{State: state, Reasons: reasons, CheckedAt: time.Now()}
+	if withMembers {
+		health.Members = members
+	}
+	return health
+}
+
+// GetServicesWithHealth 获取所有服务，并附带健康状态与最近 24 小时流量
+func (s *ServiceImpl) GetServicesWithHealth() ([]*ServiceListItem, error) {
+	serviceList, err := s.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := s.loadHealthSnapshot(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load instance status: %w", err)
+	}
+	var allHops []models.ServiceHop
+	if err := s.db.Order("hop_index ASC").Find(&allHops).Error; err != nil {
+		return nil, fmt.Errorf("failed to query chain hops: %w", err)
+	}
+	hopsBySid := map[string][]models.ServiceHop{}
+	for _, hop := range allHops {
+		hopsBySid[hop.Sid] = append(hopsBySid[hop.Sid], hop)
+	}
+	traffic, err := s.trafficByInstance(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service traffic: %w", err)
+	}
+
+	items := make([]*ServiceListItem, 0, len(serviceList))
+	for _, service := range serviceList {
+		hops := hopsBySid[service.Sid]
+		total := &ServiceTraffic{}
+		for _, m := range trafficMembers(service, hops) {
+			if t, ok := traffic[tunnelKey(m.EndpointID, m.InstanceID)]; ok && m.InstanceID != "" {
+				total.Rx += t.Rx
+				total.Tx += t.Tx
+			}
+		}
+		items = append(items, &ServiceListItem{
+			Services:   service,
+			Health:     snap.serviceHealth(service, hops, false),
+			Traffic24h: total,
+		})
+	}
+	return items, nil
+}
+
+// trafficMembers 计入服务流量的成员实例：多跳链路各跳转发的是同一份流量，只统计入口 client
+func trafficMembers(service *models.Services, hops []models.ServiceHop) []serviceMember {
+	members := serviceMembers(service, hops)
+	if service.Type == models.ServiceTypeChain && len(members) > 0 {
+		return members[:1]
+	}
+	return members
+}
+
+// trafficByInstance 按实例汇总 since 之后整小时的流量增量，键为 tunnelKey
+func (s *ServiceImpl) trafficByInstance(since time.Time) (map[string]ServiceTraffic, error) {
+	var rows []struct {
+		EndpointID int64
+		InstanceID string
+		Rx         int64
+		Tx         int64
+	}
+	err := s.db.Raw(`SELECT endpoint_id, instance_id,
+			COALESCE(SUM(tcp_rx_increment + udp_rx_increment), 0) AS rx,
+			COALESCE(SUM(tcp_tx_increment + udp_tx_increment), 0) AS tx
+		FROM traffic_hourly_summary
+		WHERE hour_time >= ?
+		GROUP BY endpoint_id, instance_id`, since.In(time.Local)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]ServiceTraffic, len(rows))
+	for _, r := range rows {
+		result[tunnelKey(r.EndpointID, r.InstanceID)] = ServiceTraffic{Rx: r.Rx, Tx: r.Tx}
+	}
+	return result, nil
+}
+
+// counterDelta 计算累计计数器相邻两次采样的增量，回退视为计数器重置
+func counterDelta(cur, prev int64) int64 {
+	if d := cur - prev; d >= 0 {
+		return d
+	}
+	return cur
+}
+
+// GetServiceTrend 获取服务最近 hours 小时的分钟级趋势，由成员实例的 service_history 聚合
+// service_history 中的流量为分钟末累计值，按实例对相邻记录求差得到每分钟流量
+func (s *ServiceImpl) GetServiceTrend(sid string, hours int) (*ServiceTrend, error) {
+	service, err := s.GetServiceByID(sid)
+	if err != nil {
+		return nil, err
+	}
+	var hops []models.ServiceHop
+	if service.Type == models.ServiceTypeChain {
+		if hops, err = s.chainHops(sid); err != nil {
+			return nil, err
+		}
+	}
+	members := map[string]bool{}
+	instanceIDs := []string{}
+	// 连接数只取入口客户端，避免客户端与服务端重复计数
+	connKey := ""
+	for i, m := range serviceMembers(service, hops) {
+		if i == 0 {
+			connKey = tunnelKey(m.EndpointID, m.InstanceID)
+		}
+		if m.InstanceID != "" {
+			members[tunnelKey(m.EndpointID, m.InstanceID)] = false
+			instanceIDs = append(instanceIDs, m.InstanceID)
+		}
+	}
+	for _, m := range trafficMembers(service, hops) {
+		if m.InstanceID != "" {
+			members[tunnelKey(m.EndpointID, m.InstanceID)] = true
+		}
+	}
+
+	trend := &ServiceTrend{Sid: sid, Hours: hours, Points: []ServiceTrendPoint{}}
+	if len(instanceIDs) == 0 {
+		return trend, nil
+	}
+
+	// 多取一分钟作为首个点的差值基准
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	var rows []models.ServiceHistory
+	err = s.db.Select("endpoint_id", "instance_id", "record_time", "delta_tcp_in", "delta_tcp_out", "delta_udp_in", "delta_udp_out",
+		"avg_speed_in", "avg_speed_out", "avg_ping", "avg_pool", "avg_tcps", "avg_udps").
+		Where("instance_id IN ? AND record_time >= ?", instanceIDs, since.Add(-time.Minute).In(time.Local)).
+		Order("record_time ASC").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query service history: %w", err)
+	}
+
+	prev := map[string][4]int64{}
+	points := map[int64]*ServiceTrendPoint{}
+	for _, r := range rows {
+		key := tunnelKey(r.EndpointID, r.InstanceID)
+		counted, ok := members[key]
+		if !ok {
+			continue
+		}
+		last := [4]int64{r.DeltaTCPIn, r.DeltaTCPOut, r.DeltaUDPIn, r.DeltaUDPOut}
+		before, hasPrev := prev[key]
+		prev[key] = last
+		if r.RecordTime.Before(since) {
+			continue
+		}
+
+		ts := r.RecordTime.UnixMilli()
+		p, ok := points[ts]
+		if !ok {
+			p = &ServiceTrendPoint{Timestamp: ts}
+			points[ts] = p
+			trend.Points = append(trend.Points, ServiceTrendPoint{Timestamp: ts})
+		}
+		if counted {
+			if hasPrev {
+				p.Rx += counterDelta(last[0], before[0]) + counterDelta(last[2], before[2])
+				p.Tx += counterDelta(last[1], before[1]) + counterDelta(last[3], before[3])
+			}
+			p.SpeedIn += r.AvgSpeedIn
+			p.SpeedOut += r.AvgSpeedOut
+		}
+		p.Ping = math.Max(p.Ping, r.AvgPing)
+		if r.AvgPool > p.Pool {
+			p.Pool = r.AvgPool
+		}
+		if key == connKey {
+			p.TCPs += r.AvgTCPs
+			p.UDPs += r.AvgUDPs
+		}
+	}
+
+	for i := range trend.Points {
+		trend.Points[i] = *points[trend.Points[i].Timestamp]
+		trend.Total.Rx += trend.Points[i].Rx
+		trend.Total.Tx += trend.Points[i].Tx
+	}
+	return trend, nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestServiceHealthAndTrend(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Endpoint{}, &models.Tunnel{}, &models.Services{},
+		&models.ServiceHop{}, &models.ServiceHistory{}, &models.TrafficHourlySummary{}, &models.SystemConfig{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	ep := models.Endpoint{Name: "ep", URL: "http://10.0.0.1", APIPath: "/api", APIKey: "k", Status: models.EndpointStatusOnline}
+	if err := db.Create(&ep).Error; err != nil {
+		t.Fatalf("seed endpoint: %v", err)
+	}
+	serverInstance, clientInstance := "srv", "cli"
+	pool, ping := int64(0), int64(20)
+	server := models.Tunnel{Name: "s", EndpointID: ep.ID, InstanceID: &serverInstance, Type: models.TunnelModeServer, Status: models.TunnelStatusRunning}
+	client := models.Tunnel{Name: "c", EndpointID: ep.ID, InstanceID: &clientInstance, Type: models.TunnelModeClient, Status: models.TunnelStatusRunning, Pool: &pool, Ping: &ping}
+	for _, tn := range []*models.Tunnel{&server, &client} {
+		if err := db.Create(tn).Error; err != nil {
+			t.Fatalf("seed tunnel: %v", err)
+		}
+	}
+	svc := models.Services{Sid: "sid-1", Type: "1", ServerEndpointId: &ep.ID, ServerInstanceId: &serverInstance,
+		ClientEndpointId: &ep.ID, ClientInstanceId: &clientInstance}
+	if err := db.Create(&svc).Error; err != nil {
+		t.Fatalf("seed service: %v", err)
+	}
+
+	// service_history 中的流量为累计值；另一主控上的同名实例不应计入
+	minute := time.Now().Add(-10 * time.Minute).Truncate(time.Minute)
+	for _, h := range []models.ServiceHistory{
+		{EndpointID: ep.ID, InstanceID: serverInstance, DeltaTCPIn: 100, DeltaTCPOut: 10, RecordTime: minute.Add(-time.Minute)},
+		{EndpointID: ep.ID, InstanceID: clientInstance, DeltaTCPIn: 1000, RecordTime: minute.Add(-time.Minute)},
+		{EndpointID: ep.ID, InstanceID: serverInstance, DeltaTCPIn: 150, DeltaTCPOut: 15, AvgTCPs: 4, RecordTime: minute},
+		{EndpointID: ep.ID, InstanceID: clientInstance, DeltaTCPIn: 1020, DeltaUDPOut: 5, AvgPing: 30, AvgTCPs: 4, RecordTime: minute},
+		{EndpointID: ep.ID + 1, InstanceID: clientInstance, DeltaTCPIn: 99999, RecordTime: minute},
+		{EndpointID: ep.ID, InstanceID: serverInstance, DeltaTCPIn: 160, DeltaTCPOut: 15, RecordTime: minute.Add(time.Minute)},
+		{EndpointID: ep.ID, InstanceID: clientInstance, DeltaTCPIn: 5, DeltaUDPOut: 5, RecordTime: minute.Add(time.Minute)}, // 计数器重置
+	} {
+		if err := db.Create(&h).Error; err != nil {
+			t.Fatalf("seed history: %v", err)
+		}
+	}
+	hour := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for _, h := range []models.TrafficHourlySummary{
+		{HourTime: hour, EndpointID: ep.ID, InstanceID: serverInstance, TCPRxIncrement: 100, TCPTxIncrement: 10},
+		{HourTime: hour, EndpointID: ep.ID, InstanceID: clientInstance, UDPRxIncrement: 50},
+		{HourTime: hour, EndpointID: ep.ID + 1, InstanceID: clientInstance, TCPRxIncrement: 1000},
+	} {
+		if err := db.Create(&h).Error; err != nil {
+			t.Fatalf("seed hourly: %v", err)
+		}
+	}
+
+	s := &ServiceImpl{db: db}
+
+	health, err := s.GetServiceHealth("sid-1")
+	if err != nil {
+		t.Fatalf("GetServiceHealth: %v", err)
+	}
+	if health.State != HealthDegraded || len(health.Reasons) != 1 {
+		t.Errorf("health = %s %v, want degraded with pool reason", health.State, health.Reasons)
+	}
+
+	if err := s.SetHealthConfig(HealthConfig{PingDegradedMs: 10}); err != nil {
+		t.Fatalf("SetHealthConfig: %v", err)
+	}
+	if health, _ = s.GetServiceHealth("sid-1"); len(health.Reasons) != 2 {
+		t.Errorf("reasons = %v, want pool and ping", health.Reasons)
+	}
+	if err := s.SetHealthConfig(HealthConfig{}); err == nil {
+		t.Error("expected zero ping threshold to be rejected")
+	}
+
+	db.Model(&models.Tunnel{}).Where("id = ?", server.ID).Update("status", models.TunnelStatusStopped)
+	if health, _ = s.GetServiceHealth("sid-1"); health.State != HealthDown {
+		t.Errorf("health = %s, want down after server stopped", health.State)
+	}
+
+	trend, err := s.GetServiceTrend("sid-1", 1)
+	if err != nil {
+		t.Fatalf("GetServiceTrend: %v", err)
+	}
+	if len(trend.Points) != 3 {
+		t.Fatalf("got %d points, want 3", len(trend.Points))
+	}
+	second := trend.Points[1]
+	if second.Timestamp != minute.UnixMilli() || second.Rx != 70 || second.Tx != 10 || second.Ping != 30 || second.TCPs != 4 {
+		t.Errorf("second point = %+v", second)
+	}
+	if trend.Points[0].Rx != 0 || trend.Total.Rx != 85 || trend.Total.Tx != 10 {
+		t.Errorf("points = %+v total = %+v", trend.Points, trend.Total)
+	}
+
+	items, err := s.GetServicesWithHealth()
+	if err != nil {
+		t.Fatalf("GetServicesWithHealth: %v", err)
+	}
+	if len(items) != 1 || items[0].Health.State != HealthDown || items[0].Traffic24h.Rx != 150 || items[0].Traffic24h.Tx != 10 {
+		t.Errorf("list item = %+v %+v", items[0].Health, items[0].Traffic24h)
+	}
+}
+
+func TestChainTrafficMembers(t *testing.T) {
+	svc := &models.Services{Sid: "chain", Type: models.ServiceTypeChain}
+	hops := []models.ServiceHop{
+		{HopIndex: 0, ClientEndpointID: 1, ClientInstanceID: "a", ServerEndpointID: 2, ServerInstanceID: "b"},
+		{HopIndex: 1, ClientEndpointID: 2, ClientInstanceID: "c", ServerEndpointID: 3, ServerInstanceID: "d"},
+	}
+	members := trafficMembers(svc, hops)
+	if len(members) != 1 || members[0].InstanceID != "a" || members[0].EndpointID != 1 {
+		t.Errorf("traffic members = %+v, want entrance client only", members)
+	}
+}
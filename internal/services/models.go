@@ -2,6 +2,7 @@ package services
 
 import (
 	"NodePassDash/internal/models"
+	"time"
 )
 
 // ServiceResponse API响应
@@ -10,7 +11,14 @@ type ServiceResponse struct {
 	Message  string             `json:"message,omitempty"`
 	Error    string             `json:"error,omitempty"`
 	Service  *models.Services   `json:"service,omitempty"`
-	Services []*models.Services `json:"services,omitempty"`
+	Services []*ServiceListItem `json:"services,omitempty"`
+}
+
+// ServiceListItem 服务列表项，附带当前健康状态与最近 24 小时流量
+type ServiceListItem struct {
+	*models.Services
+	Health     *ServiceHealth  `json:"health"`
+	Traffic24h *ServiceTraffic `json:"traffic24h"`
 }
 
 // AvailableInstance 可用实例（没有peer或peer.sid的实例）
@@ -53,3 +61,157 @@ type ServiceSortItem struct {
 type UpdateServicesSortsRequest struct {
 	Services []ServiceSortItem `json:"services" binding:"required,min=1"`
 }
+
+// CloneServiceTarget 服务克隆目标
+type CloneServiceTarget struct {
+	Name             string  `json:"name,omitempty"`
+	ClientEndpointID int64   `json:"clientEndpointId" binding:"required"`
+	ServerEndpointID *int64  `json:"serverEndpointId,omitempty"` // 双端服务可选，默认沿用原服务端主控
+	TunnelPort       *int    `json:"tunnelPort,omitempty"`       // 双端为服务端监听端口，单端为入口端口
+	TargetAddress    *string `json:"targetAddress,omitempty"`    // 出口目标地址
+	TargetPort       *int    `json:"targetPort,omitempty"`       // 出口目标端口
+}
+
+// CloneServiceRequest 克隆服务请求
+type CloneServiceRequest struct {
+	Targets []CloneServiceTarget `json:"targets" binding:"required,min=1,dive"`
+}
+
+// CloneServiceResult 单个克隆目标的结果
+type CloneServiceResult struct {
+	Sid            string `json:"sid,omitempty"`
+	Name           string `json:"name"`
+	Success        bool   `json:"success"`
+	ServerTunnelID int64  `json:"serverTunnelId,omitempty"`
+	ClientTunnelID int64  `json:"clientTunnelId,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// CreateChainServiceRequest 创建多跳链路服务请求
+type CreateChainServiceRequest struct {
+	Name        string  `json:"name"`
+	EndpointIDs []int64 `json:"endpointIds"` // 按顺序排列的主控，首个为入口，末个为出口
+	ListenHost  string  `json:"listenHost,omitempty"`
+	ListenPort  int     `json:"listenPort"`          // 入口主控监听端口
+	TunnelPort  int     `json:"tunnelPort"`          // 每一跳 server 端统一使用的隧道端口
+	RelayPort   int     `json:"relayPort,omitempty"` // 中间主控上 server 出口与下一跳 client 入口之间的本地端口，默认 tunnelPort+1
+	Password    string  `json:"password,omitempty"`  // 为空时自动生成，所有跳共用
+	TargetHost  string  `json:"targetHost"`          // 出口目标地址
+	TargetPort  int     `json:"targetPort"`          // 出口目标端口
+	ListenType  string  `json:"listenType,omitempty"`
+	LogLevel    string  `json:"logLevel,omitempty"`
+	TLSMode     string  `json:"tlsMode,omitempty"`
+	CertPath    string  `json:"certPath,omitempty"`
+	KeyPath     string  `json:"keyPath,omitempty"`
+}
+
+// CreateChainServiceResult 多跳链路服务创建结果
+type CreateChainServiceResult struct {
+	Sid       string  `json:"sid"`
+	TunnelIDs []int64 `json:"tunnelIds"`
+}
+
+// ChainHopStatus 多跳链路中单跳的健康状态
+type ChainHopStatus struct {
+	HopIndex           int    `json:"hopIndex"`
+	ClientEndpointID   int64  `json:"clientEndpointId"`
+	ClientEndpointName string `json:"clientEndpointName"`
+	ClientInstanceID   string `json:"clientInstanceId"`
+	ClientStatus       string `json:"clientStatus"`
+	ServerEndpointID   int64  `json:"serverEndpointId"`
+	ServerEndpointName string `json:"serverEndpointName"`
+	ServerInstanceID   string `json:"serverInstanceId"`
+	ServerStatus       string `json:"serverStatus"`
+	TunnelPort         int    `json:"tunnelPort"`
+	Ping               *int64 `json:"ping,omitempty"` // client 端到 server 端的延迟
+	Pool               *int64 `json:"pool,omitempty"`
+	Healthy            bool   `json:"healthy"`
+}
+
+// StagedUpdateRequest 服务分阶段（蓝绿）更新请求，未填写的字段沿用当前配置
+type StagedUpdateRequest struct {
+	TunnelPort       *int    `json:"tunnelPort,omitempty"`       // 新的隧道端口，双端服务需与当前端口不同以便新旧并存
+	EntrancePort     *int    `json:"entrancePort,omitempty"`     // 新的入口端口
+	StagingPort      int     `json:"stagingPort,omitempty"`      // 入口端口不变时，新实例验证期间临时监听的入口端口
+	TargetAddress    *string `json:"targetAddress,omitempty"`    // 新的出口目标地址
+	TargetPort       *int    `json:"targetPort,omitempty"`       // 新的出口目标端口
+	TLSMode          *string `json:"tlsMode,omitempty"`          // server 端 TLS 模式
+	CertPath         *string `json:"certPath,omitempty"`         // TLS 证书路径
+	KeyPath          *string `json:"keyPath,omitempty"`          // TLS 私钥路径
+	TCPing           bool    `json:"tcping"`                     // 验证时从出口主控 TCPing 目标
+	VerifyTimeoutSec int     `json:"verifyTimeoutSec,omitempty"` // 验证超时秒数，默认 30
+}
+
+// StagedUpdateStep 分阶段更新的进度记录
+type StagedUpdateStep struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"` // info / success / warning / error
+	Message string    `json:"message"`
+}
+
+// StagedUpdateJob 分阶段更新任务
+type StagedUpdateJob struct {
+	ID                  string             `json:"id"`
+	Sid                 string             `json:"sid"`
+	Status              string             `json:"status"` // running / succeeded / rolled_back / failed
+	Steps               []StagedUpdateStep `json:"steps"`
+	NewClientInstanceID string             `json:"newClientInstanceId,omitempty"`
+	NewServerInstanceID string             `json:"newServerInstanceId,omitempty"`
+	Error               string             `json:"error,omitempty"`
+	StartedAt           time.Time          `json:"startedAt"`
+	FinishedAt          *time.Time         `json:"finishedAt,omitempty"`
+}
+
+// 服务综合健康状态
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// ServiceMemberHealth 服务成员实例的状态
+type ServiceMemberHealth struct {
+	Member         string `json:"member"` // client / server，多跳链路为 hop<N>.client / hop<N>.server
+	EndpointID     int64  `json:"endpointId"`
+	EndpointName   string `json:"endpointName"`
+	EndpointStatus string `json:"endpointStatus"`
+	InstanceID     string `json:"instanceId"`
+	Status         string `json:"status"` // 实例状态，实例不存在时为 missing
+	Ping           *int64 `json:"ping,omitempty"`
+	Pool           *int64 `json:"pool,omitempty"`
+}
+
+// ServiceHealth 服务综合健康状态
+type ServiceHealth struct {
+	State     string                `json:"state"` // healthy / degraded / down
+	Reasons   []string              `json:"reasons"`
+	Members   []ServiceMemberHealth `json:"members,omitempty"`
+	CheckedAt time.Time             `json:"checkedAt"`
+}
+
+// ServiceTraffic 服务在一段时间内的流量（成员实例之和，多跳链路只计入口）
+type ServiceTraffic struct {
+	Rx int64 `json:"rx"`
+	Tx int64 `json:"tx"`
+}
+
+// ServiceTrendPoint 服务趋势中的单个分钟数据点，由成员实例的 service_history 聚合而来
+type ServiceTrendPoint struct {
+	Timestamp int64   `json:"timestamp"` // 毫秒
+	Rx        int64   `json:"rx"`        // 本分钟入站流量（TCP+UDP）
+	Tx        int64   `json:"tx"`        // 本分钟出站流量（TCP+UDP）
+	SpeedIn   float64 `json:"speedIn"`   // 与流量相同，多跳链路只计入口
+	SpeedOut  float64 `json:"speedOut"`  // 与流量相同，多跳链路只计入口
+	Ping      float64 `json:"ping"`      // 成员实例中的最大平均延迟
+	Pool      int64   `json:"pool"`      // 成员实例中的最大平均连接池
+	TCPs      int64   `json:"tcps"`      // 入口客户端的平均 TCP 连接数
+	UDPs      int64   `json:"udps"`      // 入口客户端的平均 UDP 连接数
+}
+
+// ServiceTrend 服务流量趋势
+type ServiceTrend struct {
+	Sid    string              `json:"sid"`
+	Hours  int                 `json:"hours"`
+	Total  ServiceTraffic      `json:"total"`
+	Points []ServiceTrendPoint `json:"points"`
+}
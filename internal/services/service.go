@@ -9,7 +9,9 @@ import (
 	"NodePassDash/internal/tunnel"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -30,6 +32,9 @@ type ServiceImpl struct {
 	db            *gorm.DB
 	tunnelService *tunnel.Service
 	sseManager    *sse.Manager
+
+	jobsMu sync.Mutex
+	jobs   map[string]*StagedUpdateJob // sid -> 最近一次分阶段更新任务
 }
 
 func NewService(db *gorm.DB, tunnelService *tunnel.Service, sseManager *sse.Manager) *ServiceImpl {
@@ -37,6 +42,7 @@ func NewService(db *gorm.DB, tunnelService *tunnel.Service, sseManager *sse.Mana
 		db:            db,
 		tunnelService: tunnelService,
 		sseManager:    sseManager,
+		jobs:          make(map[string]*StagedUpdateJob),
 	}
 }
 
@@ -162,6 +168,9 @@ func (s *ServiceImpl) StartService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.controlChain(sid, "start")
+	}
 
 	// 启动客户端实例
 	if service.ClientInstanceId != nil && service.ClientEndpointId != nil {
@@ -186,6 +195,9 @@ func (s *ServiceImpl) StopService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.controlChain(sid, "stop")
+	}
 
 	// 停止客户端实例
 	if service.ClientInstanceId != nil && service.ClientEndpointId != nil {
@@ -210,6 +222,9 @@ func (s *ServiceImpl) RestartService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.controlChain(sid, "restart")
+	}
 
 	// 重启客户端实例
 	if service.ClientInstanceId != nil && service.ClientEndpointId != nil {
@@ -234,6 +249,9 @@ func (s *ServiceImpl) DeleteService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.deleteChain(sid)
+	}
 
 	// 删除客户端实例
 	if service.ClientInstanceId != nil && service.ClientEndpointId != nil {
@@ -294,6 +312,9 @@ func (s *ServiceImpl) DeleteService(sid string) error {
 		}
 	}
 
+	// 删除故障转移创建的备用 server 实例
+	s.cleanupFailover(service, true)
+
 	// 删除服务记录
 	if err := s.db.Where("sid = ?", sid).Delete(&models.Services{}).Error; err != nil {
 		return fmt.Errorf("failed to delete service record: %w", err)
@@ -309,6 +330,13 @@ func (s *ServiceImpl) RenameService(sid, newName string) error {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
 
+	if service.Type == models.ServiceTypeChain {
+		if err := s.renameChain(service, newName); err != nil {
+			return err
+		}
+		return s.db.Model(&models.Services{}).Where("sid = ?", sid).Update("alias", newName).Error
+	}
+
 	// 创建只包含 alias 的 peer 对象（保持其他字段不变）
 	peer := &models.Peer{
 		SID:   &service.Sid,
@@ -380,6 +408,9 @@ func (s *ServiceImpl) DissolveService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.dissolveChain(sid)
+	}
 
 	// 清空 peer 信息（设置为空对象）
 	empty := ""
@@ -449,6 +480,9 @@ func (s *ServiceImpl) DissolveService(sid string) error {
 		}
 	}
 
+	// 备用 server 实例同样清空 peer
+	s.cleanupFailover(service, false)
+
 	// 删除服务记录（但不删除实例）
 	if err := s.db.Where("sid = ?", sid).Delete(&models.Services{}).Error; err != nil {
 		return fmt.Errorf("failed to delete service record: %w", err)
@@ -457,6 +491,44 @@ func (s *ServiceImpl) DissolveService(sid string) error {
 	return nil
 }
 
+// cleanupFailover 删除服务的故障转移策略与切换记录；备用 server 实例按 deleteStandby 删除或仅清空 peer
+func (s *ServiceImpl) cleanupFailover(service *models.Services, deleteStandby bool) {
+	var policy models.ServiceFailoverPolicy
+	if err := s.db.Where("sid = ?", service.Sid).Limit(1).Find(&policy).Error; err != nil || policy.ID == 0 {
+		return
+	}
+
+	empty := ""
+	emptyPeer := &models.Peer{SID: &empty, Type: &empty, Alias: &empty}
+	peerJSON, _ := json.Marshal(emptyPeer)
+	for key, instanceID := range policy.Instances {
+		endpointID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || (service.ServerInstanceId != nil && *service.ServerInstanceId == instanceID) {
+			continue
+		}
+		if deleteStandby {
+			var tunnelID int64
+			if err := s.db.Raw(`SELECT id FROM tunnels WHERE endpoint_id = ? AND instance_id = ?`, endpointID, instanceID).Scan(&tunnelID).Error; err != nil || tunnelID == 0 {
+				continue
+			}
+			s.db.Exec("DELETE FROM tunnel_groups WHERE tunnel_id = ?", tunnelID)
+			if err := s.tunnelService.DeleteTunnelIdAndWait(3*time.Second, &tunnelID); err != nil {
+				log.Warnf("[Service] 删除备用 server 实例失败: instanceID=%s, endpointID=%d, err=%v", instanceID, endpointID, err)
+			}
+			continue
+		}
+		if _, err := nodepass.UpdateInstancePeers(endpointID, instanceID, emptyPeer); err != nil {
+			log.Warnf("[Service] 清空备用 server 实例 peer 失败: instanceID=%s, endpointID=%d, err=%v", instanceID, endpointID, err)
+		}
+		s.db.Model(&models.Tunnel{}).
+			Where("endpoint_id = ? AND instance_id = ?", endpointID, instanceID).
+			Updates(map[string]interface{}{"peer": string(peerJSON), "service_sid": nil})
+	}
+
+	s.db.Where("sid = ?", service.Sid).Delete(&models.ServiceFailoverEvent{})
+	s.db.Where("sid = ?", service.Sid).Delete(&models.ServiceFailoverPolicy{})
+}
+
 // SyncService 同步服务（更新服务的流量统计等信息）
 func (s *ServiceImpl) SyncService(sid string) error {
 	// 获取服务信息
@@ -464,6 +536,9 @@ func (s *ServiceImpl) SyncService(sid string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get service: %w", err)
 	}
+	if service.Type == models.ServiceTypeChain {
+		return s.syncChain(service)
+	}
 
 	// 根据 service.Type 查询并更新服务信息
 	switch service.Type {
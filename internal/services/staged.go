@@ -0,0 +1,412 @@
+package services
+
+import (
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/tunnel"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 分阶段更新任务状态
+const (
+	stagedStatusRunning    = "running"
+	stagedStatusSucceeded  = "succeeded"
+	stagedStatusRolledBack = "rolled_back"
+	stagedStatusFailed     = "failed"
+)
+
+// defaultVerifyTimeout 新实例验证的默认超时
+const defaultVerifyTimeout = 30 * time.Second
+
+// stagedPlan 分阶段更新规划：新实例的覆盖配置以及入口/出口所在的一端
+type stagedPlan struct {
+	ServerOv         *tunnel.CloneOverrides // nil 表示服务没有 server 端
+	ClientOv         tunnel.CloneOverrides
+	EntranceRole     models.TunnelType // 入口所在一端
+	EntranceOnTarget bool              // 双端模式入口为目标地址，单端转发入口为隧道地址
+	EntrancePort     int               // 最终入口端口
+	StagingPort      int               // 验证期间的临时入口端口，0 表示新实例直接监听最终入口端口
+	ExitRole         models.TunnelType // 出口所在一端
+	ExitTarget       string            // 出口目标，用于 TCPing
+}
+
+// planStagedUpdate 根据服务类型与当前实例规划新实例配置
+func planStagedUpdate(serviceType string, client, server *models.Tunnel, req *StagedUpdateRequest) (*stagedPlan, error) {
+	plan := &stagedPlan{ClientOv: tunnel.CloneOverrides{Name: client.Name}}
+	changesTLS := req.TLSMode != nil || req.CertPath != nil || req.KeyPath != nil
+
+	var entrance, exit *models.Tunnel
+	var entranceOv, exitOv *tunnel.CloneOverrides
+	switch serviceType {
+	case "0", "5":
+		if req.TunnelPort != nil || changesTLS {
+			return nil, errors.New("单端转发没有 server 端，只能修改入口与出口")
+		}
+		entrance, exit = client, client
+		entranceOv, exitOv = &plan.ClientOv, &plan.ClientOv
+	case "1", "3", "6", "2", "4", "7":
+		if server == nil {
+			return nil, errors.New("服务缺少 server 端")
+		}
+		plan.ServerOv = &tunnel.CloneOverrides{Name: server.Name}
+		plan.EntranceOnTarget = true
+		if serviceType == "1" || serviceType == "3" || serviceType == "6" {
+			entrance, exit = server, client
+			entranceOv, exitOv = plan.ServerOv, &plan.ClientOv
+		} else {
+			entrance, exit = client, server
+			entranceOv, exitOv = &plan.ClientOv, plan.ServerOv
+		}
+	default:
+		return nil, errors.New("该服务类型不支持分阶段更新")
+	}
+	plan.EntranceRole, plan.ExitRole = entrance.Type, exit.Type
+
+	// 双端服务新旧 server 同时运行，隧道端口必须错开
+	if plan.ServerOv != nil {
+		if req.TunnelPort == nil || strconv.Itoa(*req.TunnelPort) == server.TunnelPort {
+			return nil, errors.New("双端服务分阶段更新需要指定与当前不同的 tunnelPort，以便新旧实例并存")
+		}
+		plan.ServerOv.TunnelPort = req.TunnelPort
+		plan.ClientOv.TunnelPort = req.TunnelPort
+		plan.ServerOv.TLSMode, plan.ServerOv.CertPath, plan.ServerOv.KeyPath = req.TLSMode, req.CertPath, req.KeyPath
+	}
+
+	exitOv.TargetAddress, exitOv.TargetPort = req.TargetAddress, req.TargetPort
+	exitHost, exitPort := exit.TargetAddress, exit.TargetPort
+	if req.TargetAddress != nil {
+		exitHost = *req.TargetAddress
+	}
+	if req.TargetPort != nil {
+		exitPort = strconv.Itoa(*req.TargetPort)
+	}
+	plan.ExitTarget = net.JoinHostPort(exitHost, exitPort)
+
+	current := entrance.TunnelPort
+	if plan.EntranceOnTarget {
+		current = entrance.TargetPort
+	}
+	currentPort, _ := strconv.Atoi(current)
+	plan.EntrancePort = currentPort
+	if req.EntrancePort != nil {
+		plan.EntrancePort = *req.EntrancePort
+	}
+	listenPort := plan.EntrancePort
+	if plan.EntrancePort == currentPort {
+		if req.StagingPort <= 0 || req.StagingPort > 65535 || req.StagingPort == currentPort {
+			return nil, errors.New("入口端口不变时需要指定与当前不同的 stagingPort 用于验证新实例")
+		}
+		plan.StagingPort = req.StagingPort
+		listenPort = req.StagingPort
+	}
+	if plan.EntranceOnTarget {
+		entranceOv.TargetPort = &listenPort
+	} else {
+		entranceOv.TunnelPort = &listenPort
+	}
+	return plan, nil
+}
+
+// StartStagedUpdate 启动服务的分阶段更新：在旧实例旁创建新实例并验证，通过后切换入口并删除旧实例，
+// 验证或切换失败时自动回滚。任务在后台执行，进度通过 GetStagedUpdate 查询
+func (s *ServiceImpl) StartStagedUpdate(sid string, req *StagedUpdateRequest) (*StagedUpdateJob, error) {
+	service, err := s.GetServiceByID(sid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service: %w", err)
+	}
+	if service.Type == models.ServiceTypeChain {
+		return nil, errors.New("多跳链路服务不支持分阶段更新")
+	}
+	var failoverCount int64
+	s.db.Model(&models.ServiceFailoverPolicy{}).Where("sid = ?", sid).Count(&failoverCount)
+	if failoverCount > 0 {
+		return nil, errors.New("服务已配置故障转移，请先删除故障转移策略")
+	}
+	if service.ClientInstanceId == nil || service.ClientEndpointId == nil {
+		return nil, errors.New("service has no client instance")
+	}
+
+	var client models.Tunnel
+	if err := s.db.Where("endpoint_id = ? AND instance_id = ?", *service.ClientEndpointId, *service.ClientInstanceId).
+		First(&client).Error; err != nil {
+		return nil, fmt.Errorf("client tunnel does not exist: %w", err)
+	}
+	var server *models.Tunnel
+	if service.ServerInstanceId != nil && *service.ServerInstanceId != "" && service.ServerEndpointId != nil {
+		server = &models.Tunnel{}
+		if err := s.db.Where("endpoint_id = ? AND instance_id = ?", *service.ServerEndpointId, *service.ServerInstanceId).
+			First(server).Error; err != nil {
+			return nil, fmt.Errorf("server tunnel does not exist: %w", err)
+		}
+	}
+
+	plan, err := planStagedUpdate(service.Type, &client, server, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.jobsMu.Lock()
+	if job, ok := s.jobs[sid]; ok && job.Status == stagedStatusRunning {
+		s.jobsMu.Unlock()
+		return nil, errors.New("服务已有正在执行的分阶段更新")
+	}
+	job := &StagedUpdateJob{
+		ID:        uuid.New().String(),
+		Sid:       sid,
+		Status:    stagedStatusRunning,
+		StartedAt: time.Now(),
+	}
+	s.jobs[sid] = job
+	s.jobsMu.Unlock()
+
+	timeout := defaultVerifyTimeout
+	if req.VerifyTimeoutSec > 0 {
+		timeout = time.Duration(req.VerifyTimeoutSec) * time.Second
+	}
+	go s.runStagedUpdate(job, service, &client, server, plan, req.TCPing, timeout)
+	return s.GetStagedUpdate(sid), nil
+}
+
+// GetStagedUpdate 获取服务最近一次分阶段更新任务的快照
+func (s *ServiceImpl) GetStagedUpdate(sid string) *StagedUpdateJob {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	job, ok := s.jobs[sid]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	snapshot.Steps = append([]StagedUpdateStep(nil), job.Steps...)
+	return &snapshot
+}
+
+// runStagedUpdate 执行分阶段更新
+func (s *ServiceImpl) runStagedUpdate(job *StagedUpdateJob, service *models.Services, client, server *models.Tunnel, plan *stagedPlan, tcping bool, timeout time.Duration) {
+	var newClient, newServer *models.Tunnel
+	rollback := func(reason string) {
+		s.jobStep(job, "warning", "开始回滚: %s", reason)
+		if newClient != nil {
+			s.rollbackClone(newClient)
+		}
+		if newServer != nil {
+			s.rollbackClone(newServer)
+		}
+		s.jobFinish(job, stagedStatusRolledBack, reason)
+	}
+
+	// 1. 在旧实例旁创建新实例，先 server 后 client
+	var err error
+	if plan.ServerOv != nil {
+		s.jobStep(job, "info", "在主控 %d 上创建新的 server 实例", server.EndpointID)
+		if newServer, err = s.tunnelService.CloneTunnelTo(*server, server.EndpointID, *plan.ServerOv, nil); err != nil {
+			s.jobFinish(job, stagedStatusFailed, "创建新的 server 实例失败: "+err.Error())
+			return
+		}
+		s.setJobInstances(job, "", *newServer.InstanceID)
+	}
+	s.jobStep(job, "info", "在主控 %d 上创建新的 client 实例", client.EndpointID)
+	if newClient, err = s.tunnelService.CloneTunnelTo(*client, client.EndpointID, plan.ClientOv, nil); err != nil {
+		rollback("创建新的 client 实例失败: " + err.Error())
+		return
+	}
+	s.setJobInstances(job, *newClient.InstanceID, "")
+
+	// 2. 验证新实例
+	s.jobStep(job, "info", "验证新实例（超时 %v）", timeout)
+	if err := s.verifyStaged(newClient, newServer, timeout); err != nil {
+		rollback(err.Error())
+		return
+	}
+	if tcping {
+		exitEndpointID := newClient.EndpointID
+		if plan.ExitRole == models.TunnelModeServer {
+			exitEndpointID = newServer.EndpointID
+		}
+		s.jobStep(job, "info", "从主控 %d TCPing 出口目标 %s", exitEndpointID, plan.ExitTarget)
+		result, err := nodepass.TCPing(exitEndpointID, plan.ExitTarget)
+		if err != nil {
+			rollback("TCPing 失败: " + err.Error())
+			return
+		}
+		if result.SuccessfulTests == 0 {
+			rollback(fmt.Sprintf("出口目标 %s 不可达", plan.ExitTarget))
+			return
+		}
+	}
+	s.jobStep(job, "success", "新实例验证通过")
+
+	// 3. 切换入口：停止旧入口实例，新入口实例改为监听正式端口
+	oldEntrance, newEntrance := client, newClient
+	if plan.EntranceRole == models.TunnelModeServer {
+		oldEntrance, newEntrance = server, newServer
+	}
+	if plan.StagingPort > 0 {
+		s.jobStep(job, "info", "停止旧入口实例，新实例从端口 %d 切换到入口端口 %d", plan.StagingPort, plan.EntrancePort)
+		if _, err := nodepass.ControlInstance(oldEntrance.EndpointID, *oldEntrance.InstanceID, "stop"); err != nil {
+			rollback("停止旧入口实例失败: " + err.Error())
+			return
+		}
+		if err := s.switchEntrance(newEntrance, plan, timeout); err != nil {
+			if _, startErr := nodepass.ControlInstance(oldEntrance.EndpointID, *oldEntrance.InstanceID, "start"); startErr != nil {
+				s.jobStep(job, "error", "恢复旧入口实例失败: %v", startErr)
+			}
+			rollback("切换入口失败: " + err.Error())
+			return
+		}
+	}
+
+	// 4. 提交：清空旧实例 peer，服务记录指向新实例后删除旧实例，最后为新实例写入 peer
+	oldRefs := []serviceInstance{{Role: models.TunnelModeClient, EndpointID: client.EndpointID, InstanceID: *client.InstanceID}}
+	newRefs := []serviceInstance{{Role: models.TunnelModeClient, EndpointID: newClient.EndpointID, InstanceID: *newClient.InstanceID}}
+	updates := map[string]interface{}{
+		"client_instance_id": *newClient.InstanceID,
+		"entrance_port":      strconv.Itoa(plan.EntrancePort),
+	}
+	if newServer != nil {
+		oldRefs = append(oldRefs, serviceInstance{Role: models.TunnelModeServer, EndpointID: server.EndpointID, InstanceID: *server.InstanceID})
+		newRefs = append(newRefs, serviceInstance{Role: models.TunnelModeServer, EndpointID: newServer.EndpointID, InstanceID: *newServer.InstanceID})
+		updates["server_instance_id"] = *newServer.InstanceID
+		updates["tunnel_port"] = newServer.TunnelPort
+	}
+	if host, port, err := net.SplitHostPort(plan.ExitTarget); err == nil {
+		updates["exit_host"], updates["exit_port"] = host, port
+	}
+
+	empty := ""
+	if err := s.updatePeers(oldRefs, &models.Peer{SID: &empty, Type: &empty, Alias: &empty}, true); err != nil {
+		s.jobStep(job, "warning", "清空旧实例 peer 失败: %v", err)
+	}
+	if err := s.db.Model(&models.Services{}).Where("sid = ? AND type = ?", service.Sid, service.Type).Updates(updates).Error; err != nil {
+		s.jobStep(job, "error", "更新服务记录失败: %v", err)
+	}
+	for _, ref := range oldRefs {
+		s.jobStep(job, "info", "删除旧的 %s 实例 %s", ref.Role, ref.InstanceID)
+		if err := s.deleteInstance(ref); err != nil {
+			s.jobStep(job, "warning", "删除旧的 %s 实例失败: %v", ref.Role, err)
+		}
+	}
+	peer := &models.Peer{SID: &service.Sid, Type: &service.Type, Alias: service.Alias}
+	if err := s.updatePeers(newRefs, peer, false); err != nil {
+		s.jobStep(job, "warning", "设置新实例 peer 失败: %v", err)
+	}
+
+	s.jobFinish(job, stagedStatusSucceeded, "")
+}
+
+// verifyStaged 等待新实例运行，双端服务还要求连接池已建立
+func (s *ServiceImpl) verifyStaged(newClient, newServer *models.Tunnel, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		reason := s.stagedNotReady(newClient, newServer)
+		if reason == "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("验证超时: " + reason)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// stagedNotReady 返回新实例尚未就绪的原因，就绪时返回空字符串
+func (s *ServiceImpl) stagedNotReady(newClient, newServer *models.Tunnel) string {
+	var client models.Tunnel
+	if err := s.db.Where("id = ?", newClient.ID).First(&client).Error; err != nil {
+		return "新 client 实例不存在"
+	}
+	if client.Status != models.TunnelStatusRunning {
+		return fmt.Sprintf("新 client 实例状态为 %s", client.Status)
+	}
+	if newServer == nil {
+		return ""
+	}
+	var server models.Tunnel
+	if err := s.db.Where("id = ?", newServer.ID).First(&server).Error; err != nil {
+		return "新 server 实例不存在"
+	}
+	if server.Status != models.TunnelStatusRunning {
+		return fmt.Sprintf("新 server 实例状态为 %s", server.Status)
+	}
+	if (client.Pool == nil || *client.Pool == 0) && (server.Pool == nil || *server.Pool == 0) {
+		return "连接池尚未建立"
+	}
+	return ""
+}
+
+// switchEntrance 将新入口实例改为监听正式入口端口，并等待其重新运行
+func (s *ServiceImpl) switchEntrance(entrance *models.Tunnel, plan *stagedPlan, timeout time.Duration) error {
+	var current models.Tunnel
+	if err := s.db.Where("id = ?", entrance.ID).First(&current).Error; err != nil {
+		return err
+	}
+	port := strconv.Itoa(plan.EntrancePort)
+	cfg := nodepass.NewTunnelConfig(current).Normalize()
+	if plan.EntranceOnTarget {
+		cfg.TargetPort = port
+	} else {
+		cfg.TunnelPort = port
+	}
+	if _, err := nodepass.UpdateInstance(current.EndpointID, *current.InstanceID, cfg.BuildURL()); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if err := s.db.Where("id = ?", entrance.ID).First(&current).Error; err != nil {
+			return err
+		}
+		listen := current.TunnelPort
+		if plan.EntranceOnTarget {
+			listen = current.TargetPort
+		}
+		if current.Status == models.TunnelStatusRunning && listen == port {
+			return nil
+		}
+	}
+	return fmt.Errorf("新入口实例未在 %v 内以端口 %s 运行", timeout, port)
+}
+
+// jobStep 记录任务进度
+func (s *ServiceImpl) jobStep(job *StagedUpdateJob, level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	s.jobsMu.Lock()
+	job.Steps = append(job.Steps, StagedUpdateStep{Time: time.Now(), Level: level, Message: msg})
+	s.jobsMu.Unlock()
+	log.Infof("[Service] 分阶段更新 %s: %s", job.Sid, msg)
+}
+
+// setJobInstances 记录新创建的实例
+func (s *ServiceImpl) setJobInstances(job *StagedUpdateJob, clientInstanceID, serverInstanceID string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if clientInstanceID != "" {
+		job.NewClientInstanceID = clientInstanceID
+	}
+	if serverInstanceID != "" {
+		job.NewServerInstanceID = serverInstanceID
+	}
+}
+
+// jobFinish 结束任务
+func (s *ServiceImpl) jobFinish(job *StagedUpdateJob, status, errMsg string) {
+	level, msg := "success", "分阶段更新完成"
+	if status != stagedStatusSucceeded {
+		level, msg = "error", "分阶段更新未完成: "+errMsg
+	}
+	s.jobStep(job, level, "%s", msg)
+
+	now := time.Now()
+	s.jobsMu.Lock()
+	job.Status = status
+	job.Error = errMsg
+	job.FinishedAt = &now
+	s.jobsMu.Unlock()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+)
+
+func TestPlanStagedUpdate(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(v string) *string { return &v }
+
+	client := &models.Tunnel{Name: "c", Type: models.TunnelModeClient, TunnelPort: "10101", TargetAddress: "127.0.0.1", TargetPort: "8080"}
+	server := &models.Tunnel{Name: "s", Type: models.TunnelModeServer, TunnelPort: "10101", TargetAddress: "10.0.0.5", TargetPort: "22"}
+	single := &models.Tunnel{Name: "f", Type: models.TunnelModeClient, TunnelPort: "3000", TargetAddress: "10.0.0.5", TargetPort: "80"}
+
+	tests := []struct {
+		name         string
+		serviceType  string
+		client       *models.Tunnel
+		req          StagedUpdateRequest
+		wantErr      bool
+		entrance     models.TunnelType
+		staging      int
+		exitTarget   string
+		entranceSide string // 入口监听端口所在的覆盖字段
+	}{
+		{name: "single new target via staging", serviceType: "0", client: single,
+			req:      StagedUpdateRequest{TargetAddress: strPtr("10.0.0.6"), StagingPort: 3001},
+			entrance: models.TunnelModeClient, staging: 3001, exitTarget: "10.0.0.6:80", entranceSide: "client.tunnel"},
+		{name: "single new entrance port", serviceType: "5", client: single,
+			req:      StagedUpdateRequest{EntrancePort: intPtr(3002)},
+			entrance: models.TunnelModeClient, exitTarget: "10.0.0.5:80", entranceSide: "client.tunnel"},
+		{name: "single rejects tunnel port", serviceType: "0", client: single,
+			req: StagedUpdateRequest{TunnelPort: intPtr(1), StagingPort: 3001}, wantErr: true},
+		{name: "intranet requires new tunnel port", serviceType: "1", client: client,
+			req: StagedUpdateRequest{StagingPort: 23}, wantErr: true},
+		{name: "intranet requires staging port", serviceType: "1", client: client,
+			req: StagedUpdateRequest{TunnelPort: intPtr(10102)}, wantErr: true},
+		{name: "intranet entrance on server", serviceType: "3", client: client,
+			req:      StagedUpdateRequest{TunnelPort: intPtr(10102), TargetPort: intPtr(9090), StagingPort: 23},
+			entrance: models.TunnelModeServer, staging: 23, exitTarget: "127.0.0.1:9090", entranceSide: "server.target"},
+		{name: "bothway entrance on client", serviceType: "2", client: client,
+			req:      StagedUpdateRequest{TunnelPort: intPtr(10102), EntrancePort: intPtr(8081)},
+			entrance: models.TunnelModeClient, exitTarget: "10.0.0.5:22", entranceSide: "client.target"},
+		{name: "chain unsupported", serviceType: models.ServiceTypeChain, client: client,
+			req: StagedUpdateRequest{TunnelPort: intPtr(10102), StagingPort: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planStagedUpdate(tt.serviceType, tt.client, server, &tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planStagedUpdate: %v", err)
+			}
+			if plan.EntranceRole != tt.entrance || plan.StagingPort != tt.staging || plan.ExitTarget != tt.exitTarget {
+				t.Errorf("plan = %+v", plan)
+			}
+
+			listen := plan.EntrancePort
+			if tt.staging > 0 {
+				listen = tt.staging
+			}
+			var got *int
+			switch tt.entranceSide {
+			case "client.tunnel":
+				got = plan.ClientOv.TunnelPort
+			case "client.target":
+				got = plan.ClientOv.TargetPort
+			case "server.target":
+				got = plan.ServerOv.TargetPort
+			}
+			if got == nil || *got != listen {
+				t.Errorf("entrance listen port = %v, want %d", got, listen)
+			}
+			if plan.ServerOv != nil && (plan.ServerOv.TunnelPort == nil || *plan.ServerOv.TunnelPort != *tt.req.TunnelPort) {
+				t.Errorf("server tunnel port not overridden")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sse
 
 import (
+	"NodePassDash/internal/latency"
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
 	"fmt"
@@ -46,6 +47,7 @@ type TransferData struct {
 // 重要：每个实例（endpoint + instance）都有独立的状态容器
 type ServiceCurrentStatus struct {
 	Result []MonitoringData // 该实例独立的累积数据点数组（最大_CurrentStatusSize个）
+	last   *MonitoringData  // 上一批的最后一个数据点，批次刚清空时用于计算实时速率
 	mu     sync.RWMutex     // 读写锁保护该实例的状态数据
 }
 
@@ -272,6 +274,8 @@ func (hw *HistoryWorker) triggerBatchWrite(key string, currentStatus *ServiceCur
 	copy(dataPoints, currentStatus.Result)
 
 	// 清空该实例的累积数组，重新开始累积下一批30个数据点
+	last := currentStatus.Result[len(currentStatus.Result)-1]
+	currentStatus.last = &last
 	currentStatus.Result = currentStatus.Result[:0]
 	currentStatus.mu.Unlock()
 
@@ -355,19 +359,22 @@ func (hw *HistoryWorker) aggregateAndEnqueueWrite(dataPoints []MonitoringData) {
 		}
 	}
 
-	// 4. Ping延迟计算：使用加权平均算法
-	var pingSum float64
-	var pingCount int
-
+	// 4. Ping延迟计算：平均值之外，用流式草图计算分位数、最大值与抖动
+	pingSketch := latency.New()
 	for _, point := range dataPoints {
 		if point.Ping != nil {
-			pingSum += float64(*point.Ping)
-			pingCount++
+			pingSketch.Add(float64(*point.Ping))
 		}
 	}
 
-	if pingCount > 0 {
-		historyModel.AvgPing = pingSum / float64(pingCount)
+	if pingSketch.Count > 0 {
+		historyModel.AvgPing = pingSketch.Mean()
+		historyModel.P50Ping = pingSketch.Quantile(0.5)
+		historyModel.P90Ping = pingSketch.Quantile(0.9)
+		historyModel.P99Ping = pingSketch.Quantile(0.99)
+		historyModel.MaxPing = pingSketch.Max
+		historyModel.JitterPing = pingSketch.StdDev()
+		historyModel.PingSketch = latency.Encode(pingSketch)
 	} else {
 		historyModel.AvgPing = 0
 	}
@@ -446,6 +453,66 @@ func (hw *HistoryWorker) calculateDelta(current, last int64) int64 {
 
 // GetStats 方法已删除（不需要监控功能）
 
+// LiveSnapshot 实例的实时状态：最近一个数据点的瞬时值与最近一批数据的平均速率
+type LiveSnapshot struct {
+	EndpointID int64
+	InstanceID string
+	SpeedIn    float64 // 入站速率 (TCP+UDP, bytes/s)
+	SpeedOut   float64 // 出站速率 (TCP+UDP, bytes/s)
+	Ping       *int64
+	TCPs       *int64
+	UDPs       *int64
+	Timestamp  time.Time
+}
+
+// LiveSnapshots 返回最近 maxAge 内有数据的实例的实时状态（仅内存计算，不访问数据库）
+func (hw *HistoryWorker) LiveSnapshots(maxAge time.Duration) []LiveSnapshot {
+	hw.mu.RLock()
+	statuses := make([]*ServiceCurrentStatus, 0, len(hw.serviceCurrentStatusData))
+	for _, status := range hw.serviceCurrentStatusData {
+		statuses = append(statuses, status)
+	}
+	hw.mu.RUnlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	snapshots := make([]LiveSnapshot, 0, len(statuses))
+	for _, status := range statuses {
+		status.mu.RLock()
+		points := status.Result
+		var first, latest *MonitoringData
+		if len(points) > 0 {
+			first, latest = &points[0], &points[len(points)-1]
+		}
+		if status.last != nil {
+			if first == nil {
+				latest = status.last
+			}
+			first = status.last
+		}
+		if latest == nil || latest.Timestamp.Before(cutoff) {
+			status.mu.RUnlock()
+			continue
+		}
+		snapshot := LiveSnapshot{
+			EndpointID: latest.EndpointID,
+			InstanceID: latest.InstanceID,
+			Ping:       latest.Ping,
+			TCPs:       latest.TCPs,
+			UDPs:       latest.UDPs,
+			Timestamp:  latest.Timestamp,
+		}
+		if elapsed := latest.Timestamp.Sub(first.Timestamp).Seconds(); elapsed > 0 {
+			in := hw.calculateDelta(latest.TCPIn, first.TCPIn) + hw.calculateDelta(latest.UDPIn, first.UDPIn)
+			out := hw.calculateDelta(latest.TCPOut, first.TCPOut) + hw.calculateDelta(latest.UDPOut, first.UDPOut)
+			snapshot.SpeedIn = float64(in) / elapsed
+			snapshot.SpeedOut = float64(out) / elapsed
+		}
+		status.mu.RUnlock()
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
 // Close 关闭Worker
 func (hw *HistoryWorker) Close() {
 	hw.closeMu.Lock()
@@ -28,7 +28,8 @@ type Manager struct {
 	connections map[int64]*EndpointConnection
 
 	// 事件处理 worker pool
-	jobs chan eventJob // 投递待解析/处理的原始 SSE 事件
+	jobs  chan eventJob // 投递待解析/处理的原始 SSE 事件
+	queue queueMetrics  // 队列与处理耗时统计
 
 	// 守护进程相关
 	daemonCtx    context.Context    // 守护进程上下文
@@ -481,6 +482,7 @@ func (m *Manager) listenSSE(ctx context.Context, conn *EndpointConnection) {
 				// 成功投递到队列
 			default:
 				// 如果队列已满，记录告警，避免阻塞 r3labs 读取协程
+				m.queue.dropped.Add(1)
 				preview := string(ev.Data)
 				if len(preview) > 100 {
 					preview = preview[:100] + "..."
@@ -556,6 +558,7 @@ func (m *Manager) markEndpointFail(endpointID int64) {
 	// 仅当确实修改了行时再打印成功日志
 	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
 		log.Infof("[Master-%d#SSE]更新状态为 FAIL", endpointID)
+		m.recordEndpointStatus(endpointID, EndpointStatusFail)
 
 		// 将该端点下的所有隧道标记为离线
 		if err := m.setTunnelsOfflineForEndpoint(endpointID); err != nil {
@@ -577,6 +580,7 @@ func (m *Manager) markEndpointDisconnect(endpointID int64) {
 	// 仅当确实修改了行时再打印成功日志
 	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
 		log.Infof("[Master-%d#SSE]更新状态为 DISCONNECT", endpointID)
+		m.recordEndpointStatus(endpointID, EndpointStatusDisconnect)
 
 		// 将该端点下的所有隧道标记为离线
 		if err := m.setTunnelsOfflineForEndpoint(endpointID); err != nil {
@@ -620,6 +624,15 @@ func (m *Manager) markEndpointOnline(endpointID int64) {
 	// 仅当确实修改了行时再打印成功日志
 	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
 		log.Infof("[Master-%d#SSE]更新状态为 ONLINE", endpointID)
+		m.recordEndpointStatus(endpointID, EndpointStatusOnline)
+	}
+}
+
+// recordEndpointStatus 记录主控状态变化，供图表注释使用
+func (m *Manager) recordEndpointStatus(endpointID int64, status EndpointStatus) {
+	if _, err := m.db.Exec(m.rebind(`INSERT INTO endpoint_status_events (endpoint_id, status, created_at) VALUES (?, ?, ?)`),
+		endpointID, string(status), time.Now()); err != nil {
+		log.Warnf("[Master-%d#SSE]记录状态变化失败: %v", endpointID, err)
 	}
 }
 
@@ -636,7 +649,9 @@ func (m *Manager) StartWorkers(n int) {
 // workerLoop 持续从 m.jobs 获取事件并处理
 func (m *Manager) workerLoop() {
 	for job := range m.jobs {
+		start := time.Now()
 		m.processPayload(job.endpointID, job.payload)
+		m.queue.observe(time.Since(start))
 	}
 }
 
@@ -0,0 +1,60 @@
+package sse
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets 事件处理耗时直方图的桶上界（秒）
+var latencyBuckets = [...]float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// queueMetrics 事件队列与 worker 处理统计
+type queueMetrics struct {
+	dropped   atomic.Uint64
+	processed atomic.Uint64
+	sumNanos  atomic.Uint64
+	buckets   [len(latencyBuckets)]atomic.Uint64 // 各桶内（非累计）计数，超出最后一个桶的只计入总数
+}
+
+// observe 记录一次事件处理耗时
+func (q *queueMetrics) observe(d time.Duration) {
+	q.processed.Add(1)
+	q.sumNanos.Add(uint64(d.Nanoseconds()))
+	seconds := d.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			q.buckets[i].Add(1)
+			return
+		}
+	}
+}
+
+// QueueStats 事件队列与 worker 统计快照
+type QueueStats struct {
+	Depth          int       // 当前排队的事件数
+	Capacity       int       // 队列容量
+	Dropped        uint64    // 队列已满被丢弃的事件数
+	Processed      uint64    // 已处理的事件数
+	LatencySum     float64   // 处理耗时总和（秒）
+	LatencyBuckets []float64 // 直方图桶上界（秒）
+	LatencyCounts  []uint64  // 各桶累计计数，与 LatencyBuckets 对应
+}
+
+// QueueStats 获取事件队列与 worker 统计
+func (m *Manager) QueueStats() QueueStats {
+	stats := QueueStats{
+		Depth:          len(m.jobs),
+		Capacity:       cap(m.jobs),
+		Dropped:        m.queue.dropped.Load(),
+		Processed:      m.queue.processed.Load(),
+		LatencySum:     float64(m.queue.sumNanos.Load()) / float64(time.Second),
+		LatencyBuckets: latencyBuckets[:],
+		LatencyCounts:  make([]uint64, len(latencyBuckets)),
+	}
+	var cumulative uint64
+	for i := range latencyBuckets {
+		cumulative += m.queue.buckets[i].Load()
+		stats.LatencyCounts[i] = cumulative
+	}
+	return stats
+}
@@ -6,6 +6,7 @@ import (
 	log "NodePassDash/internal/log"
 	"NodePassDash/internal/models"
 	"NodePassDash/internal/nodepass"
+	"NodePassDash/internal/sysconfig"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -51,6 +52,10 @@ type Service struct {
 	// 文件日志管理器
 	fileLogger *log.FileLogger // 文件日志管理器
 
+	// 隧道状态与日志监听器（自愈、日志告警等模块）
+	statusListener TunnelStatusListener
+	logListeners   []TunnelLogListener
+
 	// 配置选项
 	disableLogStore bool // 禁用日志记录到文件
 
@@ -86,6 +91,7 @@ func NewService(db *gorm.DB, endpointService *endpoint.Service, disableLogStore
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	s.loadLogStorageConfig()
 
 	return s
 }
@@ -95,6 +101,26 @@ func (s *Service) SetManager(manager *Manager) {
 	s.manager = manager
 }
 
+// TunnelStatusListener 隧道状态监听器，由自愈等模块实现，避免 sse 反向依赖
+type TunnelStatusListener interface {
+	OnTunnelStatus(endpointID int64, instanceID string, prev, curr models.TunnelStatus)
+}
+
+// SetStatusListener 设置隧道状态监听器
+func (s *Service) SetStatusListener(listener TunnelStatusListener) {
+	s.statusListener = listener
+}
+
+// TunnelLogListener 隧道日志监听器，由日志告警等模块实现
+type TunnelLogListener interface {
+	OnTunnelLog(endpointID int64, instanceID, logs string)
+}
+
+// AddLogListener 添加隧道日志监听器，需在 SSE 启动前调用
+func (s *Service) AddLogListener(listener TunnelLogListener) {
+	s.logListeners = append(s.logListeners, listener)
+}
+
 // Close 关闭服务
 func (s *Service) Close() {
 	log.Info("正在关闭SSE服务")
@@ -230,6 +256,7 @@ func (s *Service) handleInitialEvent(payload SSEResp) {
 		// 隧道已存在（正常情况），更新运行时信息
 		log.Debugf("[Master-%d]隧道 %s 已存在，更新运行时信息", payload.EndpointID, payload.Instance.ID)
 		s.updateTunnelRuntimeInfo(payload)
+		s.notifyTunnelStatus(payload, existing[0].Status)
 		return
 	}
 	// 创建最小化隧道记录，包含从EndpointSSE获取的流量等信息
@@ -332,6 +359,19 @@ func (s *Service) handleUpdateEvent(payload SSEResp) {
 
 	// 更新运行时信息
 	s.updateTunnelRuntimeInfo(payload)
+	s.notifyTunnelStatus(payload, checkRows[0].Status)
+}
+
+// notifyTunnelStatus 通知状态监听器；持续 running 的常规更新直接跳过
+func (s *Service) notifyTunnelStatus(payload SSEResp, prev models.TunnelStatus) {
+	if s.statusListener == nil {
+		return
+	}
+	curr := models.TunnelStatus(payload.Instance.Status)
+	if curr == prev && curr == models.TunnelStatusRunning {
+		return
+	}
+	s.statusListener.OnTunnelStatus(payload.EndpointID, payload.Instance.ID, prev, curr)
 }
 
 func (s *Service) handleDeleteEvent(payload SSEResp) {
@@ -350,6 +390,9 @@ func (s *Service) handleDeleteEvent(payload SSEResp) {
 	if err := s.db.Where("tunnel_id = ?", tunnel.ID).Delete(&models.TunnelOperationLog{}).Error; err != nil {
 		log.Warnf("[Master-%d]删除隧道 %s 操作日志失败: %v", payload.EndpointID, payload.Instance.ID, err)
 	}
+	if err := s.db.Where("tunnel_id = ?", tunnel.ID).Delete(&models.TunnelHealingState{}).Error; err != nil {
+		log.Warnf("[Master-%d]删除隧道 %s 自愈状态失败: %v", payload.EndpointID, payload.Instance.ID, err)
+	}
 
 	// 删除隧道记录
 	err := s.db.Where("endpoint_id = ? AND instance_id = ?", payload.EndpointID, payload.Instance.ID).Delete(&models.Tunnel{}).Error
@@ -372,6 +415,13 @@ func (s *Service) handleLogEvent(payload SSEResp) {
 	// 日志事件需要写入文件日志系统
 	log.Debugf("[Master-%d]处理日志事件: 隧道 %s", payload.EndpointID, payload.Instance.ID)
 
+	// 日志告警、外发不受日志存储开关影响
+	if payload.Logs != nil && *payload.Logs != "" {
+		for _, listener := range s.logListeners {
+			listener.OnTunnelLog(payload.EndpointID, payload.Instance.ID, *payload.Logs)
+		}
+	}
+
 	// 如果禁用了日志存储，只推流不写文件
 	if s.disableLogStore {
 		log.Debugf("[Master-%d]SSE 日志记录已禁用，跳过文件写入", payload.EndpointID)
@@ -416,6 +466,7 @@ func (s *Service) handleShutdownEvent(payload SSEResp) {
 	}
 
 	log.Infof("[Master-%d]端点状态已更新为: %s", payload.EndpointID, models.EndpointStatusOffline)
+	s.manager.recordEndpointStatus(payload.EndpointID, EndpointStatusOffline)
 
 	// 如果端点状态变为离线，设置所有相关隧道为离线状态
 	if err := s.setTunnelsOfflineForEndpoint(payload.EndpointID); err != nil {
@@ -499,8 +550,21 @@ func (s *Service) updateEndpointTunnelCount(endpointID int64) {
 	log.Infof("[Master-%d#SSE]更新端点隧道计数为: %d", endpointID, count)
 }
 
+// PushTunnelEvent 向订阅该实例的前端推送自定义事件（自愈等模块使用）
+func (s *Service) PushTunnelEvent(instanceID string, data interface{}) {
+	s.sendTunnelUpdateByInstanceId(instanceID, data)
+}
+
+// LiveSnapshots 返回各实例的实时速率、连接数与延迟（来自内存中尚未落库的数据点）
+func (s *Service) LiveSnapshots(maxAge time.Duration) []LiveSnapshot {
+	if s.historyWorker == nil {
+		return nil
+	}
+	return s.historyWorker.LiveSnapshots(maxAge)
+}
+
 // sendTunnelUpdateByInstanceId 根据实例ID发送隧道更新
-func (s *Service) sendTunnelUpdateByInstanceId(instanceID string, data SSEResp) {
+func (s *Service) sendTunnelUpdateByInstanceId(instanceID string, data interface{}) {
 	s.mu.RLock()
 	subscribers, exists := s.tunnelSubs[instanceID]
 	if !exists {
@@ -585,6 +649,38 @@ func (s *Service) GetFileLogger() *log.FileLogger {
 	return s.fileLogger
 }
 
+// logStorageConfigKey 日志轮转、压缩与配额配置在 system_configs 中的键
+const logStorageConfigKey = "log_storage_config"
+
+// SetLogStorageConfig 保存并应用日志轮转、压缩与配额配置
+func (s *Service) SetLogStorageConfig(cfg log.StorageConfig) error {
+	if s.fileLogger == nil {
+		return nil
+	}
+	if err := sysconfig.SetJSON(s.db, logStorageConfigKey, cfg); err != nil {
+		return err
+	}
+	s.fileLogger.SetStorageConfig(cfg)
+	return nil
+}
+
+// loadLogStorageConfig 启动时恢复已保存的日志存储配置
+func (s *Service) loadLogStorageConfig() {
+	if s.fileLogger == nil || s.db == nil {
+		return
+	}
+	cfg := s.fileLogger.GetStorageConfig()
+	ok, err := sysconfig.GetJSON(s.db, logStorageConfigKey, &cfg)
+	if !ok {
+		return
+	}
+	if err != nil {
+		log.Warnf("日志存储配置无效，使用默认配置: %v", err)
+		return
+	}
+	s.fileLogger.SetStorageConfig(cfg)
+}
+
 // =============== 服务管理 ===============
 // upsertService 插入或更新服务记录
 func (s *Service) upsertService(instanceID string, tunnel *models.Tunnel) {
@@ -601,6 +697,17 @@ func (s *Service) upsertService(instanceID string, tunnel *models.Tunnel) {
 		return
 	}
 
+	// 配置了故障转移的服务只采用当前生效主控上的 server 端，备用 server 不覆盖服务记录
+	if tunnel.Type == models.TunnelModeServer {
+		var standby int64
+		s.db.Model(&models.ServiceFailoverPolicy{}).
+			Where("sid = ? AND active_endpoint_id <> ?", *peer.SID, tunnel.EndpointID).
+			Count(&standby)
+		if standby > 0 {
+			return
+		}
+	}
+
 	// 构建 service 对象
 	service := models.Services{
 		Sid:   *peer.SID,
@@ -612,6 +719,20 @@ func (s *Service) upsertService(instanceID string, tunnel *models.Tunnel) {
 	var updateColumns []string
 
 	switch *peer.Type {
+	case models.ServiceTypeChain:
+		// 多跳链路由 services 包创建并维护各跳记录，这里只按入口 client 刷新流量
+		if tunnel.Type != models.TunnelModeClient {
+			return
+		}
+		if err := s.db.Model(&models.Services{}).
+			Where("sid = ? AND type = ? AND client_instance_id = ? AND client_endpoint_id = ?", *peer.SID, *peer.Type, instanceID, tunnel.EndpointID).
+			Updates(map[string]interface{}{
+				"total_rx": tunnel.TCPRx + tunnel.UDPRx,
+				"total_tx": tunnel.TCPTx + tunnel.UDPTx,
+			}).Error; err != nil {
+			log.Errorf("更新链路服务流量失败 (SID=%s): %v", *peer.SID, err)
+		}
+		return
 	case "0", "5":
 		if tunnel.Type == models.TunnelModeServer {
 			// 抛错
@@ -0,0 +1,57 @@
+package sysconfig
+
+import (
+	"encoding/json"
+	"sync"
+
+	log "NodePassDash/internal/log"
+
+	"gorm.io/gorm"
+)
+
+// Store 保存在 system_configs 中的 JSON 配置，内存中保留当前值
+type Store[T any] struct {
+	db       *gorm.DB
+	key      string
+	validate func(T) error
+
+	mu  sync.Mutex
+	cur T
+}
+
+// NewStore 创建配置存储并加载已保存的配置，未保存或无效时使用 def
+func NewStore[T any](db *gorm.DB, key string, def T, validate func(T) error) *Store[T] {
+	s := &Store[T]{db: db, key: key, validate: validate, cur: def}
+	value, ok, err := Get(db, key)
+	if err != nil || !ok {
+		return s
+	}
+	cfg := def
+	if err := json.Unmarshal([]byte(value), &cfg); err != nil || validate(cfg) != nil {
+		log.Warnf("[SysConfig]配置 %s 无效，使用默认配置: %s", key, value)
+		return s
+	}
+	s.cur = cfg
+	return s
+}
+
+// Get 返回当前配置
+func (s *Store[T]) Get() T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cur
+}
+
+// Set 校验并保存配置
+func (s *Store[T]) Set(cfg T) error {
+	if err := s.validate(cfg); err != nil {
+		return err
+	}
+	if err := SetJSON(s.db, s.key, cfg); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.cur = cfg
+	s.mu.Unlock()
+	return nil
+}
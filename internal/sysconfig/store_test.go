@@ -0,0 +1,51 @@
+package sysconfig
+
+import (
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/testdb"
+	"errors"
+	"testing"
+)
+
+type testConfig struct {
+	Days int `json:"days"`
+}
+
+func validateTestConfig(c testConfig) error {
+	if c.Days < 1 {
+		return errors.New("days must be positive")
+	}
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	db := testdb.Open(t, &models.SystemConfig{})
+	s := NewStore(db, "test_config", testConfig{Days: 7}, validateTestConfig)
+	if got := s.Get(); got.Days != 7 {
+		t.Fatalf("default = %+v", got)
+	}
+	if err := s.Set(testConfig{}); err == nil {
+		t.Error("expected invalid config to be rejected")
+	}
+	for _, days := range []int{30, 60} { // 第二次写入走更新分支
+		if err := s.Set(testConfig{Days: days}); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	if got := NewStore(db, "test_config", testConfig{Days: 7}, validateTestConfig).Get(); got.Days != 60 {
+		t.Errorf("reloaded = %+v, want 60 days", got)
+	}
+
+	// 已保存的值无效时回退到默认值
+	if err := Set(db, "test_config", `{"days":0}`); err != nil {
+		t.Fatalf("Set raw: %v", err)
+	}
+	if got := NewStore(db, "test_config", testConfig{Days: 7}, validateTestConfig).Get(); got.Days != 7 {
+		t.Errorf("invalid stored config = %+v, want default", got)
+	}
+	var count int64
+	db.Model(&models.SystemConfig{}).Where("key = ?", "test_config").Count(&count)
+	if count != 1 {
+		t.Errorf("rows = %d, want 1", count)
+	}
+}
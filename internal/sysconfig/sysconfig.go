@@ -0,0 +1,58 @@
+// Package sysconfig 提供 system_configs 键值配置的读写
+package sysconfig
+
+import (
+	"encoding/json"
+
+	"NodePassDash/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Get 读取配置值，不存在时 ok 为 false
+func Get(db *gorm.DB, key string) (value string, ok bool, err error) {
+	// 用 Find+Limit 避免 First 把 not-found 打成 ERROR 日志
+	var configs []models.SystemConfig
+	if err := db.Where("key = ?", key).Limit(1).Find(&configs).Error; err != nil {
+		return "", false, err
+	}
+	if len(configs) == 0 {
+		return "", false, nil
+	}
+	return configs[0].Value, true, nil
+}
+
+// Set 写入配置值，不存在时创建
+func Set(db *gorm.DB, key, value string) error {
+	result := db.Model(&models.SystemConfig{}).Where("key = ?", key).Update("value", value)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return db.Create(&models.SystemConfig{Key: key, Value: value}).Error
+	}
+	return nil
+}
+
+// Delete 删除配置
+func Delete(db *gorm.DB, key string) error {
+	return db.Where("key = ?", key).Delete(&models.SystemConfig{}).Error
+}
+
+// GetJSON 读取 JSON 配置到 v，不存在时 ok 为 false 且 v 保持不变
+func GetJSON(db *gorm.DB, key string, v interface{}) (ok bool, err error) {
+	value, ok, err := Get(db, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(value), v)
+}
+
+// SetJSON 将 v 编码为 JSON 后写入配置
+func SetJSON(db *gorm.DB, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Set(db, key, string(data))
+}
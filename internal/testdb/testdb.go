@@ -0,0 +1,22 @@
+// Package testdb 为测试提供迁移好的内存 SQLite 数据库
+package testdb
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open 打开独立的内存数据库并迁移 dst 中的模型
+func Open(t testing.TB, dst ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(dst...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
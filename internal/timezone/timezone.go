@@ -0,0 +1,166 @@
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 精简镜像中可能缺少系统时区数据
+
+	"NodePassDash/internal/sysconfig"
+
+	"gorm.io/gorm"
+)
+
+const (
+	configKeyGlobal     = "display_timezone"       // 全局显示时区
+	configKeyUserPrefix = "display_timezone_user:" // 按用户的显示时区，后接用户名
+)
+
+// ErrInvalidTimezone 时区不合法
+var ErrInvalidTimezone = errors.New("无效的时区")
+
+// offsetPattern 固定偏移写法：+08:00、-0500、UTC+8、GMT-5
+var offsetPattern = regexp.MustCompile(`^(?i:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// Load 解析时区：空字符串与 Local 表示服务器本地时区，支持 IANA 名称与固定偏移
+func Load(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "" || name == "Local":
+		return time.Local, nil
+	case strings.EqualFold(name, "UTC") || strings.EqualFold(name, "GMT") || name == "Z":
+		return time.UTC, nil
+	}
+	if m := offsetPattern.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes := 0
+		if m[3] != "" {
+			minutes, _ = strconv.Atoi(m[3])
+		}
+		if hours > 14 || minutes >= 60 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, name)
+		}
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(fmt.Sprintf("UTC%s%02d:%02d", m[1], hours, minutes), offset), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, name)
+	}
+	return loc, nil
+}
+
+// StartOfDay 返回 t 在 loc 中所在自然日的零点
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// StartOfHour 返回 t 在 loc 中所在小时的整点
+// 按 loc 的分、秒回退而不是 Truncate：Truncate 按绝对时间对齐，在 +05:30 等半小时时区会落到 :30；
+// 也不用 time.Date 重建，夏令时回拨的重复小时里结果才不会有歧义
+func StartOfHour(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return t.Add(-time.Duration(t.Minute())*time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+}
+
+// StartOfWeek 返回 t 在 loc 中所在周（周一开始）的零点
+func StartOfWeek(t time.Time, loc *time.Location) time.Time {
+	day := StartOfDay(t, loc)
+	weekday := int(day.Weekday())
+	if weekday == 0 {
+		weekday = 7
+	}
+	return day.AddDate(0, 0, 1-weekday)
+}
+
+// Settings 显示时区设置，空字符串表示未设置
+type Settings struct {
+	Global    string `json:"global"`    // 全局显示时区，未设置时使用服务器本地时区
+	User      string `json:"user"`      // 当前用户的显示时区，优先于全局设置
+	Effective string `json:"effective"` // 当前生效的时区
+	Server    string `json:"server"`    // 服务器本地时区
+}
+
+// Service 显示时区服务，设置保存在 system_configs 中
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建显示时区服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) get(key string) string {
+	value, _, _ := sysconfig.Get(s.db, key)
+	return value
+}
+
+func (s *Service) set(key, value string) error {
+	if value == "" {
+		return sysconfig.Delete(s.db, key)
+	}
+	return sysconfig.Set(s.db, key, value)
+}
+
+// Settings 返回全局及指定用户的显示时区设置
+func (s *Service) Settings(username string) Settings {
+	settings := Settings{Global: s.get(configKeyGlobal), Server: time.Local.String()}
+	if username != "" {
+		settings.User = s.get(configKeyUserPrefix + username)
+	}
+	settings.Effective = s.Location("", username).String()
+	return settings
+}
+
+// SetGlobal 设置全局显示时区，空字符串恢复为服务器本地时区
+func (s *Service) SetGlobal(name string) error {
+	if _, err := Load(name); err != nil {
+		return err
+	}
+	return s.set(configKeyGlobal, strings.TrimSpace(name))
+}
+
+// SetUser 设置用户的显示时区，空字符串表示跟随全局设置
+func (s *Service) SetUser(username, name string) error {
+	if username == "" {
+		return fmt.Errorf("%w: 未登录用户不能设置个人时区", ErrInvalidTimezone)
+	}
+	if _, err := Load(name); err != nil {
+		return err
+	}
+	return s.set(configKeyUserPrefix+username, strings.TrimSpace(name))
+}
+
+// Resolve 按请求参数、用户设置、全局设置、服务器本地时区的顺序确定时区，请求参数不合法时返回错误
+func (s *Service) Resolve(tz, username string) (*time.Location, error) {
+	if tz != "" {
+		return Load(tz)
+	}
+	return s.Location("", username), nil
+}
+
+// Location 同 Resolve，但忽略无法解析的设置
+func (s *Service) Location(tz, username string) *time.Location {
+	candidates := []string{tz}
+	if username != "" {
+		candidates = append(candidates, s.get(configKeyUserPrefix+username))
+	}
+	candidates = append(candidates, s.get(configKeyGlobal))
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		if loc, err := Load(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
@@ -0,0 +1,91 @@
+package timezone
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLoad(t *testing.T) {
+	for name, offset := range map[string]int{"+08:00": 8 * 3600, "UTC-5": -5 * 3600, "+0530": 5*3600 + 30*60, "UTC": 0} {
+		loc, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load(%q): %v", name, err)
+		}
+		if _, got := time.Date(2024, 1, 1, 0, 0, 0, 0, loc).Zone(); got != offset {
+			t.Errorf("Load(%q) offset = %d, want %d", name, got, offset)
+		}
+	}
+	if _, err := Load("Asia/Shanghai"); err != nil {
+		t.Errorf("Load IANA: %v", err)
+	}
+	for _, name := range []string{"Mars/Olympus", "+15:00", "+08:75"} {
+		if _, err := Load(name); err == nil {
+			t.Errorf("Load(%q) expected error", name)
+		}
+	}
+
+	// 2024-01-07T20:00Z（UTC 周日）在 UTC+8 已是周一 1 月 8 日
+	loc, _ := Load("+08:00")
+	week := StartOfWeek(time.Date(2024, 1, 7, 20, 0, 0, 0, time.UTC), loc)
+	if want := time.Date(2024, 1, 8, 0, 0, 0, 0, loc); !week.Equal(want) {
+		t.Errorf("StartOfWeek = %v, want %v", week, want)
+	}
+
+	// +05:30 时区的整点不在 UTC 整点上
+	ist, _ := Load("+05:30")
+	if hour := StartOfHour(time.Date(2024, 1, 1, 10, 45, 12, 0, ist), ist); !hour.Equal(time.Date(2024, 1, 1, 10, 0, 0, 0, ist)) {
+		t.Errorf("StartOfHour = %v", hour)
+	}
+	// 夏令时回拨的第二个 01:30 应归入第二个 01:00
+	ny, _ := Load("America/New_York")
+	second := time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC)
+	if hour := StartOfHour(second, ny); !hour.Equal(second.Add(-30 * time.Minute)) {
+		t.Errorf("StartOfHour across DST = %v", hour)
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SystemConfig{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	s := NewService(db)
+	if err := s.SetGlobal("Asia/Shanghai"); err != nil {
+		t.Fatalf("SetGlobal: %v", err)
+	}
+	if err := s.SetUser("alice", "America/New_York"); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := s.SetUser("alice", "nowhere"); err == nil {
+		t.Error("expected invalid user timezone to be rejected")
+	}
+
+	for _, c := range []struct{ tz, user, want string }{
+		{"", "alice", "America/New_York"},
+		{"", "bob", "Asia/Shanghai"},
+		{"UTC", "alice", "UTC"},
+	} {
+		loc, err := s.Resolve(c.tz, c.user)
+		if err != nil || loc.String() != c.want {
+			t.Errorf("Resolve(%q, %q) = %v, %v; want %s", c.tz, c.user, loc, err, c.want)
+		}
+	}
+	if _, err := s.Resolve("bogus", "alice"); err == nil {
+		t.Error("expected invalid tz parameter to be rejected")
+	}
+
+	// 清除全局设置后回退到服务器本地时区
+	if err := s.SetGlobal(""); err != nil {
+		t.Fatalf("clear global: %v", err)
+	}
+	if settings := s.Settings("bob"); settings.Global != "" || settings.Effective != time.Local.String() {
+		t.Errorf("settings = %+v", settings)
+	}
+}
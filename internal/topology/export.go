@@ -0,0 +1,120 @@
+package topology
+
+import (
+	"fmt"
+	"strings"
+
+	"NodePassDash/internal/models"
+)
+
+// edgeText 导出时的边标签：隧道名与延迟
+func edgeText(e Edge) string {
+	text := e.Label
+	if e.Ping != nil {
+		text = fmt.Sprintf("%s %dms", text, *e.Ping)
+	}
+	return text
+}
+
+func edgeRunning(e Edge) bool {
+	return e.Status == string(models.TunnelStatusRunning)
+}
+
+func nodeOnline(n Node) bool {
+	return n.Kind != NodeEndpoint || n.Status == string(models.EndpointStatusOnline)
+}
+
+// dotQuote 生成 DOT 双引号字符串
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// ToDOT 导出 Graphviz DOT 格式
+func ToDOT(g *Graph) string {
+	var sb strings.Builder
+	sb.WriteString("digraph topology {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+
+	for _, n := range g.Nodes {
+		attrs := []string{"label=" + dotQuote(n.Label)}
+		switch n.Kind {
+		case NodeEndpoint:
+			attrs = append(attrs, "shape=box", "style=rounded")
+		case NodeEntrance:
+			attrs = append(attrs, "shape=ellipse")
+		case NodeTarget:
+			attrs = append(attrs, "shape=note")
+		}
+		if !nodeOnline(n) {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&sb, "  %s [%s];\n", dotQuote(n.ID), strings.Join(attrs, ", "))
+	}
+
+	for _, e := range g.Edges {
+		attrs := []string{"label=" + dotQuote(edgeText(e))}
+		if e.Kind == EdgeTunnel {
+			attrs = append(attrs, "penwidth=2")
+		}
+		if !edgeRunning(e) {
+			attrs = append(attrs, "color=red", "style=dashed")
+		}
+		fmt.Fprintf(&sb, "  %s -> %s [%s];\n", dotQuote(e.Source), dotQuote(e.Target), strings.Join(attrs, ", "))
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// mermaidText 转义 Mermaid 标签中的双引号
+func mermaidText(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, `"`, "#quot;"), "\n", " ")
+}
+
+// ToMermaid 导出 Mermaid flowchart 格式，节点ID按顺序重新编号以避免特殊字符
+func ToMermaid(g *Graph) string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+
+	ids := make(map[string]string, len(g.Nodes))
+	var offline []string
+	for i, n := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ID] = id
+		label := mermaidText(n.Label)
+		switch n.Kind {
+		case NodeEndpoint:
+			fmt.Fprintf(&sb, "  %s[\"%s\"]\n", id, label)
+		case NodeEntrance:
+			fmt.Fprintf(&sb, "  %s([\"%s\"])\n", id, label)
+		default:
+			fmt.Fprintf(&sb, "  %s[(\"%s\")]\n", id, label)
+		}
+		if !nodeOnline(n) {
+			offline = append(offline, id)
+		}
+	}
+
+	var down []string
+	for i, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind == EdgeTunnel {
+			arrow = "==>"
+		}
+		if !edgeRunning(e) {
+			arrow = "-.->"
+			down = append(down, fmt.Sprint(i))
+		}
+		fmt.Fprintf(&sb, "  %s %s|\"%s\"| %s\n", ids[e.Source], arrow, mermaidText(edgeText(e)), ids[e.Target])
+	}
+
+	if len(offline) > 0 {
+		sb.WriteString("  classDef offline stroke:#d33,stroke-width:2px\n")
+		fmt.Fprintf(&sb, "  class %s offline\n", strings.Join(offline, ","))
+	}
+	if len(down) > 0 {
+		fmt.Fprintf(&sb, "  linkStyle %s stroke:#d33\n", strings.Join(down, ","))
+	}
+	return sb.String()
+}
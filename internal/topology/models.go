@@ -0,0 +1,58 @@
+package topology
+
+// NodeKind 拓扑节点类型
+type NodeKind string
+
+const (
+	NodeEndpoint NodeKind = "endpoint" // 主控
+	NodeEntrance NodeKind = "entrance" // 主控上的监听入口
+	NodeTarget   NodeKind = "target"   // 出口目标地址
+)
+
+// EdgeKind 拓扑边类型
+type EdgeKind string
+
+const (
+	EdgeTunnel   EdgeKind = "tunnel"   // client 端主控 -> server 端主控
+	EdgeEntrance EdgeKind = "entrance" // 监听入口 -> 主控
+	EdgeExit     EdgeKind = "exit"     // 主控 -> 出口目标
+)
+
+// Node 拓扑节点
+type Node struct {
+	ID         string   `json:"id"`
+	Kind       NodeKind `json:"kind"`
+	Label      string   `json:"label"`
+	EndpointID int64    `json:"endpointId,omitempty"`
+	Status     string   `json:"status,omitempty"` // 主控状态
+	Host       string   `json:"host,omitempty"`
+}
+
+// Edge 拓扑边，携带对应隧道的实时状态
+type Edge struct {
+	ID         string   `json:"id"`
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	Kind       EdgeKind `json:"kind"`
+	Label      string   `json:"label"`
+	Sid        string   `json:"sid,omitempty"`
+	TunnelIDs  []int64  `json:"tunnelIds"`
+	Status     string   `json:"status"`               // 边上全部隧道都 running 时为 running，否则为首个异常状态
+	Ping       *int64   `json:"ping,omitempty"`       // 延迟（ms）
+	Pool       *int64   `json:"pool,omitempty"`       // 连接池
+	SpeedIn    float64  `json:"speedIn"`              // 最近 5 分钟平均入站速率（bytes/s）
+	SpeedOut   float64  `json:"speedOut"`             // 最近 5 分钟平均出站速率（bytes/s）
+	ListenPort string   `json:"listenPort,omitempty"` // tunnel 边为隧道端口
+}
+
+// Graph 拓扑图
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Filter 拓扑过滤条件，零值表示不过滤
+type Filter struct {
+	GroupID int64  // 只包含该分组内隧道（及其所属服务的对端隧道）
+	Sid     string // 只包含该服务的隧道
+}
@@ -0,0 +1,381 @@
+package topology
+
+import (
+	"NodePassDash/internal/models"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rateWindow 实时速率取最近该时间窗口内的 service_history 记录
+const rateWindow = 5 * time.Minute
+
+// rate 实例最近 rateWindow（5 分钟）内的平均速率
+type rate struct {
+	In  float64
+	Out float64
+}
+
+// Service 网络拓扑服务
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建网络拓扑服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Build 根据主控、隧道与服务记录构建拓扑图
+func (s *Service) Build(filter Filter) (*Graph, error) {
+	var endpoints []models.Endpoint
+	if err := s.db.Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to query endpoints: %w", err)
+	}
+	var tunnels []models.Tunnel
+	if err := s.db.Order("id ASC").Find(&tunnels).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tunnels: %w", err)
+	}
+	var serviceList []models.Services
+	if err := s.db.Order("sorts DESC").Find(&serviceList).Error; err != nil {
+		return nil, fmt.Errorf("failed to query services: %w", err)
+	}
+	var hops []models.ServiceHop
+	if err := s.db.Order("sid ASC, hop_index ASC").Find(&hops).Error; err != nil {
+		return nil, fmt.Errorf("failed to query service hops: %w", err)
+	}
+
+	var groupTunnels map[int64]bool
+	if filter.GroupID > 0 {
+		var ids []int64
+		if err := s.db.Model(&models.TunnelGroup{}).Where("group_id = ?", filter.GroupID).Pluck("tunnel_id", &ids).Error; err != nil {
+			return nil, fmt.Errorf("failed to query group tunnels: %w", err)
+		}
+		groupTunnels = make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			groupTunnels[id] = true
+		}
+	}
+
+	rates, err := s.latestRates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query traffic rates: %w", err)
+	}
+
+	return buildGraph(endpoints, tunnels, serviceList, hops, rates, filter, groupTunnels), nil
+}
+
+// latestRates 计算每个实例最近 rateWindow 内的平均速率，键为 memberKey（实例 ID 仅在主控内唯一）
+func (s *Service) latestRates() (map[string]rate, error) {
+	var rows []struct {
+		EndpointID  int64
+		InstanceID  string
+		AvgSpeedIn  float64
+		AvgSpeedOut float64
+	}
+	if err := s.db.Model(&models.ServiceHistory{}).
+		Select("endpoint_id", "instance_id", "avg_speed_in", "avg_speed_out").
+		Where("record_time >= ?", time.Now().Add(-rateWindow)).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	sums := make(map[string]rate, len(rows))
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		key := memberKey(r.EndpointID, r.InstanceID)
+		sum := sums[key]
+		sums[key] = rate{In: sum.In + r.AvgSpeedIn, Out: sum.Out + r.AvgSpeedOut}
+		counts[key]++
+	}
+	rates := make(map[string]rate, len(sums))
+	for key, sum := range sums {
+		n := float64(counts[key])
+		rates[key] = rate{In: sum.In / n, Out: sum.Out / n}
+	}
+	return rates, nil
+}
+
+// memberKey 隧道在服务中的定位键
+func memberKey(endpointID int64, instanceID string) string {
+	return fmt.Sprintf("%d/%s", endpointID, instanceID)
+}
+
+// graphBuilder 拓扑图构建器
+type graphBuilder struct {
+	graph     Graph
+	nodes     map[string]bool
+	endpoints map[int64]models.Endpoint
+	rates     map[string]rate
+}
+
+// buildGraph 构建拓扑图。服务记录决定隧道配对关系与入口/出口方向，不属于任何服务的隧道按单独实例处理
+func buildGraph(endpoints []models.Endpoint, tunnels []models.Tunnel, serviceList []models.Services, hops []models.ServiceHop,
+	rates map[string]rate, filter Filter, groupTunnels map[int64]bool) *Graph {
+	b := &graphBuilder{
+		graph:     Graph{Nodes: []Node{}, Edges: []Edge{}},
+		nodes:     map[string]bool{},
+		endpoints: map[int64]models.Endpoint{},
+		rates:     rates,
+	}
+	for _, ep := range endpoints {
+		b.endpoints[ep.ID] = ep
+	}
+
+	byKey := map[string]*models.Tunnel{}
+	for i := range tunnels {
+		if t := &tunnels[i]; t.InstanceID != nil {
+			byKey[memberKey(t.EndpointID, *t.InstanceID)] = t
+		}
+	}
+	lookup := func(endpointID *int64, instanceID *string) *models.Tunnel {
+		if endpointID == nil || instanceID == nil || *instanceID == "" {
+			return nil
+		}
+		return byKey[memberKey(*endpointID, *instanceID)]
+	}
+
+	// 服务成员
+	type member struct {
+		sid         string
+		serviceType string
+		client      *models.Tunnel
+		server      *models.Tunnel
+		entrance    bool // 多跳链路仅首跳有入口
+		exit        bool // 多跳链路仅末跳有出口
+	}
+	var members []member
+	hopsBySid := map[string][]models.ServiceHop{}
+	for _, hop := range hops {
+		hopsBySid[hop.Sid] = append(hopsBySid[hop.Sid], hop)
+	}
+	for i := range serviceList {
+		svc := &serviceList[i]
+		if svc.Type == models.ServiceTypeChain {
+			chain := hopsBySid[svc.Sid]
+			for j, hop := range chain {
+				clientEP, serverEP := hop.ClientEndpointID, hop.ServerEndpointID
+				clientID, serverID := hop.ClientInstanceID, hop.ServerInstanceID
+				members = append(members, member{
+					sid: svc.Sid, serviceType: svc.Type,
+					client: lookup(&clientEP, &clientID), server: lookup(&serverEP, &serverID),
+					entrance: j == 0, exit: j == len(chain)-1,
+				})
+			}
+			continue
+		}
+		members = append(members, member{
+			sid: svc.Sid, serviceType: svc.Type,
+			client: lookup(svc.ClientEndpointId, svc.ClientInstanceId), server: lookup(svc.ServerEndpointId, svc.ServerInstanceId),
+			entrance: true, exit: true,
+		})
+	}
+
+	// 过滤：按服务或分组保留成员，分组命中任一成员时保留整个服务
+	keepSid := map[string]bool{}
+	for _, m := range members {
+		switch {
+		case filter.Sid != "":
+			keepSid[m.sid] = m.sid == filter.Sid
+		case groupTunnels != nil:
+			if (m.client != nil && groupTunnels[m.client.ID]) || (m.server != nil && groupTunnels[m.server.ID]) {
+				keepSid[m.sid] = true
+			}
+		default:
+			keepSid[m.sid] = true
+		}
+	}
+	keepTunnel := func(t *models.Tunnel) bool {
+		switch {
+		case filter.Sid != "":
+			return false
+		case groupTunnels != nil:
+			return groupTunnels[t.ID]
+		}
+		return true
+	}
+
+	if filter.Sid == "" && groupTunnels == nil {
+		for _, ep := range endpoints {
+			b.endpointNode(ep.ID)
+		}
+	}
+
+	used := map[int64]bool{}
+	for _, m := range members {
+		if m.client != nil {
+			used[m.client.ID] = true
+		}
+		if m.server != nil {
+			used[m.server.ID] = true
+		}
+		if !keepSid[m.sid] {
+			continue
+		}
+		switch {
+		case m.client != nil && m.server != nil:
+			intranet := m.serviceType == "1" || m.serviceType == "3" || m.serviceType == "6"
+			b.addPair(m.sid, m.client, m.server, intranet, m.entrance, m.exit)
+		case m.client != nil:
+			b.addSingle(m.sid, m.client)
+		case m.server != nil:
+			b.addServer(m.sid, m.server)
+		}
+	}
+
+	for i := range tunnels {
+		t := &tunnels[i]
+		if used[t.ID] || !keepTunnel(t) {
+			continue
+		}
+		if t.Type == models.TunnelModeServer {
+			b.addServer("", t)
+		} else {
+			b.addSingle("", t)
+		}
+	}
+
+	sort.SliceStable(b.graph.Nodes, func(i, j int) bool {
+		return nodeOrder(b.graph.Nodes[i].Kind) < nodeOrder(b.graph.Nodes[j].Kind)
+	})
+	return &b.graph
+}
+
+func nodeOrder(kind NodeKind) int {
+	switch kind {
+	case NodeEndpoint:
+		return 0
+	case NodeEntrance:
+		return 1
+	}
+	return 2
+}
+
+// endpointNode 确保主控节点存在并返回节点ID
+func (b *graphBuilder) endpointNode(endpointID int64) string {
+	id := fmt.Sprintf("endpoint:%d", endpointID)
+	if b.nodes[id] {
+		return id
+	}
+	b.nodes[id] = true
+	node := Node{ID: id, Kind: NodeEndpoint, Label: fmt.Sprintf("endpoint %d", endpointID), EndpointID: endpointID, Status: "UNKNOWN"}
+	if ep, ok := b.endpoints[endpointID]; ok {
+		node.Label = ep.Name
+		node.Status = string(ep.Status)
+		node.Host = ep.Host()
+	}
+	b.graph.Nodes = append(b.graph.Nodes, node)
+	return id
+}
+
+// entranceNode 主控上的监听入口节点
+func (b *graphBuilder) entranceNode(endpointID int64, host, port string) string {
+	id := fmt.Sprintf("entrance:%d/%s", endpointID, port)
+	if !b.nodes[id] {
+		b.nodes[id] = true
+		b.graph.Nodes = append(b.graph.Nodes, Node{ID: id, Kind: NodeEntrance, Label: net.JoinHostPort(host, port), EndpointID: endpointID})
+	}
+	return id
+}
+
+// targetNode 出口目标节点；本机地址按主控区分，其他地址在主控间共享
+func (b *graphBuilder) targetNode(endpointID int64, addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	local := err != nil || host == "" || host == "localhost" || host == "0.0.0.0" || host == "::"
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		local = true
+	}
+	id := "target:" + addr
+	node := Node{ID: id, Kind: NodeTarget, Label: addr}
+	if local {
+		id = fmt.Sprintf("target:%d/%s", endpointID, addr)
+		node.ID, node.EndpointID = id, endpointID
+	}
+	if !b.nodes[id] {
+		b.nodes[id] = true
+		b.graph.Nodes = append(b.graph.Nodes, node)
+	}
+	return id
+}
+
+// targets 隧道的全部出口目标（含扩展目标地址）
+func targets(t *models.Tunnel) []string {
+	addrs := []string{net.JoinHostPort(t.TargetAddress, t.TargetPort)}
+	if t.ExtendTargetAddress != nil {
+		addrs = append(addrs, *t.ExtendTargetAddress...)
+	}
+	return addrs
+}
+
+// newEdge 以隧道实时状态初始化一条边，status/ping/pool 取自 primary
+func (b *graphBuilder) newEdge(id, source, target string, kind EdgeKind, label, sid string, primary *models.Tunnel, others ...*models.Tunnel) Edge {
+	edge := Edge{
+		ID: id, Source: source, Target: target, Kind: kind, Label: label, Sid: sid,
+		TunnelIDs: []int64{primary.ID},
+		Status:    string(primary.Status),
+		Ping:      primary.Ping,
+		Pool:      primary.Pool,
+	}
+	for _, t := range others {
+		edge.TunnelIDs = append(edge.TunnelIDs, t.ID)
+		if edge.Status == string(models.TunnelStatusRunning) && t.Status != models.TunnelStatusRunning {
+			edge.Status = string(t.Status)
+		}
+	}
+	if primary.InstanceID != nil {
+		if r, ok := b.rates[memberKey(primary.EndpointID, *primary.InstanceID)]; ok {
+			edge.SpeedIn, edge.SpeedOut = r.In, r.Out
+		}
+	}
+	return edge
+}
+
+// addEntrance 添加 监听入口 -> 主控 的边
+func (b *graphBuilder) addEntrance(sid string, t *models.Tunnel, host, port string) {
+	source := b.entranceNode(t.EndpointID, host, port)
+	b.graph.Edges = append(b.graph.Edges, b.newEdge(fmt.Sprintf("entrance:%d", t.ID), source, b.endpointNode(t.EndpointID), EdgeEntrance, t.Name, sid, t))
+}
+
+// addExits 添加 主控 -> 出口目标 的边
+func (b *graphBuilder) addExits(sid string, t *models.Tunnel) {
+	source := b.endpointNode(t.EndpointID)
+	for i, addr := range targets(t) {
+		b.graph.Edges = append(b.graph.Edges, b.newEdge(fmt.Sprintf("exit:%d:%d", t.ID, i), source, b.targetNode(t.EndpointID, addr), EdgeExit, t.Name, sid, t))
+	}
+}
+
+// addPair 添加一对 client/server 隧道；intranet 为内网穿透（server 端监听入口、client 端连接出口）
+func (b *graphBuilder) addPair(sid string, client, server *models.Tunnel, intranet, entrance, exit bool) {
+	edge := b.newEdge(fmt.Sprintf("tunnel:%d:%d", client.ID, server.ID), b.endpointNode(client.EndpointID), b.endpointNode(server.EndpointID),
+		EdgeTunnel, client.Name, sid, client, server)
+	edge.ListenPort = server.TunnelPort
+	b.graph.Edges = append(b.graph.Edges, edge)
+
+	entranceSide, exitSide := client, server
+	if intranet {
+		entranceSide, exitSide = server, client
+	}
+	if entrance {
+		b.addEntrance(sid, entranceSide, entranceSide.TargetAddress, entranceSide.TargetPort)
+	}
+	if exit {
+		b.addExits(sid, exitSide)
+	}
+}
+
+// addSingle 单端转发：client 监听隧道地址并连接目标
+func (b *graphBuilder) addSingle(sid string, t *models.Tunnel) {
+	b.addEntrance(sid, t, t.TunnelAddress, t.TunnelPort)
+	b.addExits(sid, t)
+}
+
+// addServer 未配对的 server：mode 2 主动连接目标，其他模式在目标地址上监听
+func (b *graphBuilder) addServer(sid string, t *models.Tunnel) {
+	if t.Mode != nil && *t.Mode == models.Mode2 {
+		b.addExits(sid, t)
+		return
+	}
+	b.addEntrance(sid, t, t.TargetAddress, t.TargetPort)
+}
@@ -0,0 +1,83 @@
+package topology
+
+import (
+	"NodePassDash/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestBuildGraph(t *testing.T) {
+	str := func(v string) *string { return &v }
+	id := func(v int64) *int64 { return &v }
+	ping := int64(12)
+
+	endpoints := []models.Endpoint{
+		{ID: 1, Name: "edge", URL: "http://1.1.1.1:3000", Status: models.EndpointStatusOnline},
+		{ID: 2, Name: "home", URL: "http://2.2.2.2:3000", Status: models.EndpointStatusOffline},
+		{ID: 3, Name: "idle", URL: "http://3.3.3.3:3000", Status: models.EndpointStatusOnline},
+	}
+	tunnels := []models.Tunnel{
+		// 内网穿透服务：server 在 edge 上监听 8080，client 在 home 上连接 127.0.0.1:80
+		{ID: 10, Name: "web", EndpointID: 1, InstanceID: str("s1"), Type: models.TunnelModeServer, Status: models.TunnelStatusRunning,
+			TunnelPort: "10101", TargetAddress: "0.0.0.0", TargetPort: "8080"},
+		{ID: 11, Name: "web", EndpointID: 2, InstanceID: str("c1"), Type: models.TunnelModeClient, Status: models.TunnelStatusStopped,
+			TunnelAddress: "1.1.1.1", TunnelPort: "10101", TargetAddress: "127.0.0.1", TargetPort: "80", Ping: &ping},
+		// 不属于任何服务的单端转发，带扩展目标
+		{ID: 12, Name: "dns", EndpointID: 3, InstanceID: str("c2"), Type: models.TunnelModeClient, Status: models.TunnelStatusRunning,
+			TunnelAddress: "", TunnelPort: "53", TargetAddress: "8.8.8.8", TargetPort: "53", ExtendTargetAddress: &[]string{"1.1.1.1:53"}},
+	}
+	serviceList := []models.Services{
+		{Sid: "svc", Type: "1", ServerEndpointId: id(1), ServerInstanceId: str("s1"), ClientEndpointId: id(2), ClientInstanceId: str("c1")},
+	}
+	// 另一主控上的同名实例不应串用速率
+	rates := map[string]rate{memberKey(2, "c1"): {In: 100, Out: 200}, memberKey(1, "c1"): {In: 999}}
+
+	g := buildGraph(endpoints, tunnels, serviceList, nil, rates, Filter{}, nil)
+
+	edges := map[string]Edge{}
+	for _, e := range g.Edges {
+		edges[e.ID] = e
+	}
+	tunnelEdge, ok := edges["tunnel:11:10"]
+	if !ok || tunnelEdge.Source != "endpoint:2" || tunnelEdge.Target != "endpoint:1" {
+		t.Fatalf("tunnel edge = %+v", tunnelEdge)
+	}
+	if tunnelEdge.Status != string(models.TunnelStatusStopped) || tunnelEdge.SpeedIn != 100 || tunnelEdge.Ping == nil {
+		t.Errorf("tunnel edge live data = %+v", tunnelEdge)
+	}
+	if e := edges["entrance:10"]; e.Source != "entrance:1/8080" || e.Target != "endpoint:1" {
+		t.Errorf("entrance edge = %+v", e)
+	}
+	if e := edges["exit:11:0"]; e.Target != "target:2/127.0.0.1:80" {
+		t.Errorf("exit edge = %+v", e)
+	}
+	if e := edges["exit:12:1"]; e.Target != "target:1.1.1.1:53" {
+		t.Errorf("extend target edge = %+v", e)
+	}
+	if len(g.Edges) != 6 {
+		t.Errorf("got %d edges, want 6", len(g.Edges))
+	}
+
+	// 按服务过滤只保留该服务的主控与隧道
+	g = buildGraph(endpoints, tunnels, serviceList, nil, rates, Filter{Sid: "svc"}, nil)
+	for _, n := range g.Nodes {
+		if n.EndpointID == 3 {
+			t.Errorf("unexpected node %+v for sid filter", n)
+		}
+	}
+	// 分组命中服务任一成员时保留整个服务
+	g = buildGraph(endpoints, tunnels, serviceList, nil, rates, Filter{GroupID: 1}, map[int64]bool{11: true})
+	if len(g.Edges) != 3 {
+		t.Errorf("group filter got %d edges, want 3", len(g.Edges))
+	}
+
+	dot := ToDOT(g)
+	if !strings.Contains(dot, `"endpoint:2" -> "endpoint:1" [label="web 12ms", penwidth=2, color=red, style=dashed];`) {
+		t.Errorf("unexpected DOT:\n%s", dot)
+	}
+	mermaid := ToMermaid(g)
+	if !strings.HasPrefix(mermaid, "flowchart LR\n") || !strings.Contains(mermaid, `-.->|"web 12ms"|`) ||
+		!strings.Contains(mermaid, "class n0 offline") {
+		t.Errorf("unexpected Mermaid:\n%s", mermaid)
+	}
+}
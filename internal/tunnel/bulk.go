@@ -0,0 +1,451 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/db"
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBulkConcurrency = 5
+	maxBulkConcurrency     = 20
+	maxBulkUpdateSize      = 500
+)
+
+// tagKeyPattern 标签键只允许安全字符，避免拼接进 JSONPath 时产生注入
+// 不允许 "."：SQLite 会将其解析为嵌套路径，而 Postgres 按字面键名读取，两种方言结果不一致
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// bulkPatchFields 参数处理顺序，与 URL 参数名一致
+var bulkPatchFields = []string{"log", "tls", "rate", "read", "slot", "proxy", "dns", "sni", "block", "lbs"}
+
+// BulkUpdate 按筛选条件批量修改隧道参数；dryRun 时只返回差异不下发
+func (s *Service) BulkUpdate(req BulkUpdateRequest) (*BulkUpdateResult, error) {
+	patch := patchValues(req.Patch)
+	if len(patch) == 0 {
+		return nil, errors.New("请至少提供一个需要修改的参数")
+	}
+	if err := validateBulkPatch(patch); err != nil {
+		return nil, err
+	}
+
+	tunnels, err := s.FindTunnelsByFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(tunnels) > maxBulkUpdateSize {
+		return nil, fmt.Errorf("命中 %d 个隧道，超过单次批量修改上限 %d，请缩小筛选范围", len(tunnels), maxBulkUpdateSize)
+	}
+
+	dryRun := req.DryRun == nil || *req.DryRun
+	result := &BulkUpdateResult{
+		Success: true,
+		DryRun:  dryRun,
+		Matched: len(tunnels),
+		Items:   make([]BulkUpdateItem, 0, len(tunnels)),
+	}
+
+	patched := make([]models.Tunnel, 0, len(tunnels))
+	for _, t := range tunnels {
+		item, next := diffBulkPatch(t, patch)
+		if len(item.Changes) == 0 {
+			continue
+		}
+		result.Items = append(result.Items, item)
+		patched = append(patched, next)
+	}
+	result.Changed = len(result.Items)
+
+	if dryRun || result.Changed == 0 {
+		return result, nil
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	}
+	if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	log.Infof("[API] 开始批量修改隧道参数，共 %d 个隧道，并发 %d", result.Changed, concurrency)
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range result.Items {
+		if result.Items[i].Error != "" {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(item *BulkUpdateItem, next *models.Tunnel) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			item.Applied = true
+			if err := s.applyBulkItem(item, next); err != nil {
+				item.Error = err.Error()
+				return
+			}
+			item.Success = true
+		}(&result.Items[i], &patched[i])
+	}
+	wg.Wait()
+
+	for _, item := range result.Items {
+		if item.Success {
+			result.SuccessCount++
+		} else {
+			result.FailCount++
+		}
+	}
+	result.Success = result.FailCount == 0
+	log.Infof("[API] 批量修改隧道参数完成：成功 %d，失败 %d", result.SuccessCount, result.FailCount)
+	return result, nil
+}
+
+// FindTunnelsByFilter 按筛选条件查询隧道
+func (s *Service) FindTunnelsByFilter(f BulkUpdateFilter) ([]models.Tunnel, error) {
+	q := s.db.Model(&models.Tunnel{}).Where("instance_id IS NOT NULL AND instance_id <> ''")
+
+	if len(f.IDs) > 0 {
+		q = q.Where("id IN ?", f.IDs)
+	}
+	if len(f.EndpointIDs) > 0 {
+		q = q.Where("endpoint_id IN ?", f.EndpointIDs)
+	}
+	if f.GroupID > 0 {
+		q = q.Where("id IN (?)", s.db.Model(&models.TunnelGroup{}).Select("tunnel_id").Where("group_id = ?", f.GroupID))
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+	if f.Type != "" {
+		q = q.Where("type = ?", f.Type)
+	}
+	if f.Query != "" {
+		cond, args, err := s.CompileQuery(f.Query, "")
+		if err != nil {
+			return nil, fmt.Errorf("查询语句无效: %v", err)
+		}
+		if cond != "" {
+			q = q.Where(cond, args...)
+		}
+	}
+	if len(f.Tags) > 0 {
+		d := db.Dialect()
+		for k, v := range f.Tags {
+			if !tagKeyPattern.MatchString(k) {
+				return nil, fmt.Errorf("无效的标签键: %s", k)
+			}
+			q = q.Where(d.JSONPath("tags", k)+" = ?", v)
+		}
+	}
+
+	var tunnels []models.Tunnel
+	if err := q.Order("id").Find(&tunnels).Error; err != nil {
+		return nil, err
+	}
+
+	// 端口与名称通配在内存中过滤：tunnel_port 为文本列，直接比较不可靠
+	filtered := tunnels[:0]
+	for _, t := range tunnels {
+		if f.PortFrom > 0 || f.PortTo > 0 {
+			port, err := strconv.Atoi(t.TunnelPort)
+			if err != nil {
+				continue
+			}
+			if f.PortFrom > 0 && port < f.PortFrom {
+				continue
+			}
+			if f.PortTo > 0 && port > f.PortTo {
+				continue
+			}
+		}
+		if f.Name != "" {
+			ok, err := path.Match(strings.ToLower(f.Name), strings.ToLower(t.Name))
+			if err != nil {
+				return nil, fmt.Errorf("无效的名称通配: %v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered, nil
+}
+
+// applyBulkItem 下发单个隧道的新命令行并同步本地数据库
+func (s *Service) applyBulkItem(item *BulkUpdateItem, next *models.Tunnel) error {
+	if _, err := nodepass.UpdateInstance(item.EndpointID, item.InstanceID, item.NewURL); err != nil {
+		log.Warnf("[API] 批量修改隧道 %s 失败: %v", item.InstanceID, err)
+		return err
+	}
+
+	// SSE 会回推最新配置，这里先行写入避免列表短暂显示旧值
+	updates := map[string]interface{}{
+		"command_line":   item.NewURL,
+		"log_level":      next.LogLevel,
+		"tls_mode":       next.TLSMode,
+		"rate":           next.Rate,
+		"read":           next.Read,
+		"slot":           next.Slot,
+		"proxy_protocol": next.ProxyProtocol,
+		"dns":            next.Dns,
+		"sni":            next.Sni,
+		"block":          next.Block,
+		"lbs":            next.Lbs,
+	}
+	if err := s.db.Model(&models.Tunnel{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+		log.Warnf("[API] 批量修改隧道 %s 后更新本地记录失败: %v", item.InstanceID, err)
+	}
+
+	tunnelID := item.ID
+	msg := describeBulkChanges(item.Changes)
+	opLog := models.TunnelOperationLog{
+		TunnelID:   &tunnelID,
+		TunnelName: item.Name,
+		Action:     models.OperationActionBulkUpdate,
+		Status:     "success",
+		Message:    &msg,
+	}
+	if err := s.db.Create(&opLog).Error; err != nil {
+		log.Warnf("[API] 写入批量修改操作日志失败: %v", err)
+	}
+	return nil
+}
+
+// diffBulkPatch 计算单个隧道应用 patch 后的差异，返回预览项和修改后的隧道副本；合并后的配置无效时原因写入 Error
+func diffBulkPatch(t models.Tunnel, patch map[string]string) (BulkUpdateItem, models.Tunnel) {
+	item := BulkUpdateItem{
+		ID:         t.ID,
+		Name:       t.Name,
+		EndpointID: t.EndpointID,
+		OldURL:     nodepass.BuildTunnelURLs(t),
+	}
+	if t.InstanceID != nil {
+		item.InstanceID = *t.InstanceID
+	}
+
+	next := t
+	for _, field := range bulkPatchFields {
+		val, ok := patch[field]
+		if !ok {
+			continue
+		}
+		// tls 只对服务端生效
+		if field == "tls" && t.Type != models.TunnelModeServer {
+			item.Skipped = append(item.Skipped, field)
+			continue
+		}
+		// tls=2 需要证书路径，缺失时跳过避免实例启动失败
+		if field == "tls" && val == string(models.TLS2) && (derefStr(t.CertPath) == "" || derefStr(t.KeyPath) == "") {
+			item.Skipped = append(item.Skipped, field)
+			continue
+		}
+		before := tunnelParam(&t, field)
+		if before == val {
+			continue
+		}
+		setTunnelParam(&next, field, val)
+		item.Changes = append(item.Changes, BulkFieldChange{Field: field, Before: before, After: val})
+	}
+	item.NewURL = nodepass.BuildTunnelURLs(next)
+	// 与单个隧道编辑走同一套校验，合并后的配置无效时不下发
+	if len(item.Changes) > 0 {
+		if errs := nodepass.NewTunnelConfig(next).Normalize().Validate(); len(errs) > 0 {
+			item.Error = errs.Error()
+		}
+	}
+	return item, next
+}
+
+// patchValues 将 patch 展开为 参数名 -> 新值
+func patchValues(p BulkUpdatePatch) map[string]string {
+	values := make(map[string]string)
+	set := func(key string, v *string) {
+		if v != nil {
+			values[key] = strings.TrimSpace(*v)
+		}
+	}
+	set("log", p.Log)
+	set("tls", p.TLS)
+	set("rate", p.Rate)
+	set("read", p.Read)
+	set("slot", p.Slot)
+	set("proxy", p.Proxy)
+	set("dns", p.Dns)
+	set("sni", p.Sni)
+	set("block", p.Block)
+	set("lbs", p.Lbs)
+	return values
+}
+
+// validateBulkPatch 校验 patch 中各参数的取值
+func validateBulkPatch(patch map[string]string) error {
+	oneOf := func(field, val string, allowed ...string) error {
+		for _, a := range allowed {
+			if val == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("参数 %s 的取值无效，支持: %s", field, strings.Join(allowed, ", "))
+	}
+	for field, val := range patch {
+		if val == "" {
+			continue
+		}
+		var err error
+		switch field {
+		case "log":
+			err = oneOf(field, val, "debug", "info", "warn", "error", "event", "none")
+		case "tls":
+			err = oneOf(field, val, "0", "1", "2")
+		case "proxy":
+			err = oneOf(field, val, "0", "1")
+		case "block":
+			err = oneOf(field, val, "0", "1", "2", "3")
+		case "lbs":
+			err = oneOf(field, val, "0", "1", "2")
+		case "rate", "slot":
+			if n, convErr := strconv.ParseInt(val, 10, 64); convErr != nil || n < 0 {
+				err = fmt.Errorf("参数 %s 必须是非负整数", field)
+			}
+		case "read":
+			if d, convErr := time.ParseDuration(val); val != "0" && (convErr != nil || d < 0) {
+				err = fmt.Errorf("参数 %s 必须为有效时长，如 30s、10m、1h", field)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tunnelParam 以 URL 参数形式读取隧道当前值，未设置时返回空字符串
+func tunnelParam(t *models.Tunnel, field string) string {
+	switch field {
+	case "log":
+		if t.LogLevel == "inherit" {
+			return ""
+		}
+		return string(t.LogLevel)
+	case "tls":
+		if t.TLSMode == "inherit" {
+			return ""
+		}
+		return string(t.TLSMode)
+	case "rate":
+		if t.Rate != nil {
+			return strconv.FormatInt(*t.Rate, 10)
+		}
+	case "read":
+		return derefStr(t.Read)
+	case "slot":
+		if t.Slot != nil {
+			return strconv.FormatInt(*t.Slot, 10)
+		}
+	case "proxy":
+		if t.ProxyProtocol != nil {
+			if *t.ProxyProtocol {
+				return "1"
+			}
+			return "0"
+		}
+	case "dns":
+		return derefStr(t.Dns)
+	case "sni":
+		return derefStr(t.Sni)
+	case "block":
+		if t.Block != nil {
+			return strconv.Itoa(*t.Block)
+		}
+	case "lbs":
+		if t.Lbs != nil {
+			return strconv.Itoa(*t.Lbs)
+		}
+	}
+	return ""
+}
+
+// setTunnelParam 按 URL 参数写入隧道字段，空字符串表示清除（值已经过 validateBulkPatch 校验）
+func setTunnelParam(t *models.Tunnel, field, val string) {
+	strPtr := func() *string {
+		if val == "" {
+			return nil
+		}
+		v := val
+		return &v
+	}
+	int64Ptr := func() *int64 {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return &n
+		}
+		return nil
+	}
+	intPtr := func() *int {
+		if n, err := strconv.Atoi(val); err == nil {
+			return &n
+		}
+		return nil
+	}
+
+	switch field {
+	case "log":
+		// 清除时写回继承值，与 log_level 列默认值一致，避免落库空字符串
+		if val == "" {
+			t.LogLevel = "inherit"
+		} else {
+			t.LogLevel = models.LogLevel(val)
+		}
+	case "tls":
+		t.TLSMode = models.TLSMode(val)
+	case "rate":
+		t.Rate = int64Ptr()
+	case "read":
+		t.Read = strPtr()
+	case "slot":
+		t.Slot = int64Ptr()
+	case "proxy":
+		if val == "" {
+			t.ProxyProtocol = nil
+		} else {
+			enabled := val == "1"
+			t.ProxyProtocol = &enabled
+		}
+	case "dns":
+		t.Dns = strPtr()
+	case "sni":
+		t.Sni = strPtr()
+	case "block":
+		t.Block = intPtr()
+	case "lbs":
+		t.Lbs = intPtr()
+	}
+}
+
+// describeBulkChanges 生成操作日志中的变更摘要
+func describeBulkChanges(changes []BulkFieldChange) string {
+	parts := make([]string, 0, len(changes))
+	for _, c := range changes {
+		before, after := c.Before, c.After
+		if before == "" {
+			before = "默认"
+		}
+		if after == "" {
+			after = "默认"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s -> %s", c.Field, before, after))
+	}
+	return "批量修改 " + strings.Join(parts, ", ")
+}
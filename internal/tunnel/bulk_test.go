@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestDiffBulkPatch(t *testing.T) {
+	rate := int64(100)
+	instanceID := "inst"
+	base := models.Tunnel{
+		ID:            1,
+		Type:          models.TunnelModeClient,
+		InstanceID:    &instanceID,
+		TunnelAddress: "1.2.3.4",
+		TunnelPort:    "10101",
+		TargetAddress: "127.0.0.1",
+		TargetPort:    "8080",
+		LogLevel:      models.LogLevelInfo,
+		Rate:          &rate,
+	}
+
+	item, next := diffBulkPatch(base, map[string]string{
+		"log":  "debug",
+		"tls":  "1",
+		"rate": "",
+		"lbs":  "1",
+	})
+
+	if len(item.Skipped) != 1 || item.Skipped[0] != "tls" {
+		t.Errorf("skipped=%v want [tls] for client tunnel", item.Skipped)
+	}
+	if len(item.Changes) != 3 {
+		t.Fatalf("changes=%+v want 3", item.Changes)
+	}
+	if next.Rate != nil || next.LogLevel != models.LogLevelDebug || next.Lbs == nil || *next.Lbs != 1 {
+		t.Errorf("patched tunnel not updated: rate=%v log=%v lbs=%v", next.Rate, next.LogLevel, next.Lbs)
+	}
+	if base.Rate == nil {
+		t.Errorf("original tunnel must not be modified")
+	}
+	if !strings.Contains(item.NewURL, "log=debug") || strings.Contains(item.NewURL, "rate=") || !strings.Contains(item.NewURL, "lbs=1") {
+		t.Errorf("unexpected new url %q", item.NewURL)
+	}
+
+	// 无变化时不产生差异
+	item, _ = diffBulkPatch(base, map[string]string{"log": "info"})
+	if len(item.Changes) != 0 {
+		t.Errorf("changes=%+v want none", item.Changes)
+	}
+
+	// 合并后的配置按单个编辑的规则校验，无效时给出原因
+	item, _ = diffBulkPatch(base, map[string]string{"read": "soon"})
+	if !strings.Contains(item.Error, "read") {
+		t.Errorf("invalid read error=%q", item.Error)
+	}
+	item, _ = diffBulkPatch(base, map[string]string{"read": "30s"})
+	if item.Error != "" {
+		t.Errorf("valid read error=%q", item.Error)
+	}
+
+	// 清除日志级别时回到继承
+	item, next = diffBulkPatch(base, map[string]string{"log": ""})
+	if next.LogLevel != "inherit" || strings.Contains(item.NewURL, "log=") {
+		t.Errorf("cleared log level=%q url=%q", next.LogLevel, item.NewURL)
+	}
+}
+
+func TestValidateBulkPatch(t *testing.T) {
+	cases := []struct {
+		patch   map[string]string
+		wantErr bool
+	}{
+		{map[string]string{"log": "warn", "rate": "10"}, false},
+		{map[string]string{"log": ""}, false},
+		{map[string]string{"log": "verbose"}, true},
+		{map[string]string{"tls": "3"}, true},
+		{map[string]string{"slot": "-1"}, true},
+		{map[string]string{"block": "2"}, false},
+		{map[string]string{"read": "1h"}, false},
+		{map[string]string{"read": "later"}, true},
+	}
+	for _, tc := range cases {
+		if err := validateBulkPatch(tc.patch); (err != nil) != tc.wantErr {
+			t.Errorf("validateBulkPatch(%v) err=%v wantErr=%v", tc.patch, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	log "NodePassDash/internal/log"
+	"NodePassDash/internal/models"
+	"NodePassDash/internal/nodepass"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxCloneTargets 单次克隆的目标主控上限
+const maxCloneTargets = 20
+
+// CloneTunnel 将隧道的完整配置（命令行参数、标签、分组、重启策略）复制到一个或多个目标主控
+func (s *Service) CloneTunnel(id int64, req CloneTunnelRequest) ([]CloneResult, error) {
+	if len(req.EndpointIDs) == 0 {
+		return nil, errors.New("请至少选择一个目标主控")
+	}
+	if len(req.EndpointIDs) > maxCloneTargets {
+		return nil, fmt.Errorf("单次最多克隆到 %d 个主控", maxCloneTargets)
+	}
+
+	var src models.Tunnel
+	if err := s.db.First(&src, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("隧道不存在")
+		}
+		return nil, err
+	}
+
+	results := make([]CloneResult, 0, len(req.EndpointIDs))
+	for _, endpointID := range req.EndpointIDs {
+		result := CloneResult{EndpointID: endpointID}
+		cloned, err := s.CloneTunnelTo(src, endpointID, req.CloneOverrides, nil)
+		if err != nil {
+			result.Name = cloneName(src, endpointID, req.Name)
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			result.TunnelID = cloned.ID
+			result.Name = cloned.Name
+			if cloned.InstanceID != nil {
+				result.InstanceID = *cloned.InstanceID
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// CloneTunnelTo 在目标主控上按源隧道配置创建副本，创建后同步标签、分组与重启策略；
+// peer 非空时写入新的服务信息，用于服务克隆
+func (s *Service) CloneTunnelTo(src models.Tunnel, endpointID int64, ov CloneOverrides, peer *models.Peer) (*models.Tunnel, error) {
+	next := cloneTunnelConfig(src)
+	next.EndpointID = endpointID
+	next.Name = cloneName(src, endpointID, ov.Name)
+	if ov.TunnelAddress != nil {
+		next.TunnelAddress = *ov.TunnelAddress
+	}
+	if ov.TunnelPort != nil {
+		next.TunnelPort = strconv.Itoa(*ov.TunnelPort)
+	}
+	if ov.TargetAddress != nil {
+		next.TargetAddress = *ov.TargetAddress
+	}
+	if ov.TargetPort != nil {
+		next.TargetPort = strconv.Itoa(*ov.TargetPort)
+	}
+	if ov.TLSMode != nil {
+		next.TLSMode = models.TLSMode(*ov.TLSMode)
+	}
+	if ov.CertPath != nil {
+		next.CertPath = ov.CertPath
+	}
+	if ov.KeyPath != nil {
+		next.KeyPath = ov.KeyPath
+	}
+
+	var maxSorts int64
+	s.db.Model(&models.Tunnel{}).Select("COALESCE(MAX(sorts), -1)").Scan(&maxSorts)
+	next.Sorts = maxSorts + 1
+
+	created, err := s.NewCreateTunnelAndWait(next, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if created.InstanceID == nil || created.ID == 0 {
+		return created, nil
+	}
+	instanceID := *created.InstanceID
+
+	// 同步实例附加元数据，失败只记录日志，不影响克隆结果
+	patch := models.Tunnel{Restart: src.Restart, Tags: src.Tags}
+	columns := []string{}
+	if src.Restart != nil {
+		if _, err := nodepass.SetRestartInstance(endpointID, instanceID, *src.Restart); err != nil {
+			log.Warnf("[Clone] 设置 restart 失败 endpoint=%d instance=%s err=%v", endpointID, instanceID, err)
+		} else {
+			columns = append(columns, "restart")
+		}
+	}
+	if src.Tags != nil && len(*src.Tags) > 0 {
+		if _, err := nodepass.UpdateInstanceTags(endpointID, instanceID, *src.Tags); err != nil {
+			log.Warnf("[Clone] 设置 tags 失败 endpoint=%d instance=%s err=%v", endpointID, instanceID, err)
+		} else {
+			columns = append(columns, "tags")
+		}
+	}
+	if peer != nil {
+		if _, err := nodepass.UpdateInstancePeers(endpointID, instanceID, peer); err != nil {
+			log.Warnf("[Clone] 设置 peer 失败 endpoint=%d instance=%s err=%v", endpointID, instanceID, err)
+		} else {
+			patch.Peer = peer
+			patch.ServiceSID = peer.SID
+			columns = append(columns, "peer", "service_sid")
+		}
+	}
+	if len(columns) > 0 {
+		if err := s.db.Model(&models.Tunnel{}).Where("id = ?", created.ID).Select(columns).Updates(&patch).Error; err != nil {
+			log.Warnf("[Clone] 更新隧道元数据失败 tunnel=%d err=%v", created.ID, err)
+		}
+	}
+
+	// 复制分组关系
+	var groups []models.TunnelGroup
+	if err := s.db.Where("tunnel_id = ?", src.ID).Find(&groups).Error; err == nil {
+		for _, g := range groups {
+			if err := s.db.Create(&models.TunnelGroup{TunnelID: created.ID, GroupID: g.GroupID}).Error; err != nil {
+				log.Warnf("[Clone] 复制分组失败 tunnel=%d group=%d err=%v", created.ID, g.GroupID, err)
+			}
+		}
+	}
+
+	message := fmt.Sprintf("从隧道 %s (ID: %d) 克隆", src.Name, src.ID)
+	s.db.Create(&models.TunnelOperationLog{
+		TunnelID:   &created.ID,
+		TunnelName: created.Name,
+		Action:     models.OperationActionClone,
+		Status:     "success",
+		Message:    &message,
+		CreatedAt:  time.Now(),
+	})
+
+	log.Infof("[Clone] 隧道 %d 已克隆到主控 %d，新隧道 %d (%s)", src.ID, endpointID, created.ID, instanceID)
+	return created, nil
+}
+
+// cloneTunnelConfig 只复制配置字段，运行状态、流量与实例信息全部重置
+func cloneTunnelConfig(src models.Tunnel) models.Tunnel {
+	return models.Tunnel{
+		Type:                src.Type,
+		Status:              models.TunnelStatusStopped,
+		TunnelAddress:       src.TunnelAddress,
+		TunnelPort:          src.TunnelPort,
+		TargetAddress:       src.TargetAddress,
+		TargetPort:          src.TargetPort,
+		ListenType:          src.ListenType,
+		ExtendTargetAddress: src.ExtendTargetAddress,
+		TLSMode:             src.TLSMode,
+		CertPath:            src.CertPath,
+		KeyPath:             src.KeyPath,
+		LogLevel:            src.LogLevel,
+		Password:            src.Password,
+		Restart:             src.Restart,
+		Mode:                src.Mode,
+		Rate:                src.Rate,
+		Read:                src.Read,
+		EnableLogStore:      src.EnableLogStore,
+		Min:                 src.Min,
+		Max:                 src.Max,
+		Slot:                src.Slot,
+		ProxyProtocol:       src.ProxyProtocol,
+		Tags:                src.Tags,
+		Dial:                src.Dial,
+		PoolType:            src.PoolType,
+		Dns:                 src.Dns,
+		Sni:                 src.Sni,
+		Block:               src.Block,
+		Lbs:                 src.Lbs,
+	}
+}
+
+// cloneName 未指定名称时，跨主控沿用原名，同主控追加 -clone 后缀
+func cloneName(src models.Tunnel, endpointID int64, name string) string {
+	if name != "" {
+		return name
+	}
+	if endpointID == src.EndpointID {
+		return src.Name + "-clone"
+	}
+	return src.Name
+}
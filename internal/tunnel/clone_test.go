@@ -0,0 +1,55 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/models"
+	"testing"
+)
+
+func TestCloneTunnelConfig(t *testing.T) {
+	instanceID := "abc"
+	sid := "sid-1"
+	restart := true
+	src := models.Tunnel{
+		ID:          7,
+		Name:        "web",
+		EndpointID:  1,
+		Type:        models.TunnelModeServer,
+		Status:      models.TunnelStatusRunning,
+		TunnelPort:  "10101",
+		TargetPort:  "80",
+		InstanceID:  &instanceID,
+		ServiceSID:  &sid,
+		Peer:        &models.Peer{SID: &sid},
+		Restart:     &restart,
+		TCPRx:       100,
+		Tags:        &map[string]string{"env": "prod"},
+		TLSMode:     models.TLS1,
+		CommandLine: "server://:10101/:80?tls=1",
+	}
+
+	next := cloneTunnelConfig(src)
+	if next.ID != 0 || next.InstanceID != nil || next.Peer != nil || next.ServiceSID != nil || next.TCPRx != 0 {
+		t.Errorf("runtime fields must be reset: %+v", next)
+	}
+	if next.Status != models.TunnelStatusStopped {
+		t.Errorf("status=%s want stopped", next.Status)
+	}
+	if next.TLSMode != models.TLS1 || next.Restart == nil || !*next.Restart || (*next.Tags)["env"] != "prod" {
+		t.Errorf("config fields not copied: %+v", next)
+	}
+
+	cases := []struct {
+		endpointID int64
+		name       string
+		want       string
+	}{
+		{1, "", "web-clone"},
+		{2, "", "web"},
+		{1, "custom", "custom"},
+	}
+	for _, tc := range cases {
+		if got := cloneName(src, tc.endpointID, tc.name); got != tc.want {
+			t.Errorf("cloneName(%d, %q)=%q want %q", tc.endpointID, tc.name, got, tc.want)
+		}
+	}
+}
@@ -54,6 +54,7 @@ type TunnelQueryParams struct {
 	EndpointGroupID string `json:"endpoint_group_id"` // 主控组筛选
 	PortFilter      string `json:"port_filter"`       // 端口筛选
 	GroupID         string `json:"group_id"`          // 分组筛选
+	Query           string `json:"query"`             // 查询语言，见 query.go
 	Page            int    `json:"page"`              // 页码
 	PageSize        int    `json:"page_size"`         // 每页大小
 	SortBy          string `json:"sort_by"`           // 排序字段
@@ -112,6 +113,10 @@ type CreateTunnelRequest struct {
 	Tags           []string    `json:"tags,omitempty"`
 	EnableSSEStore bool        `json:"enable_sse_store,omitempty"`
 	EnableLogStore bool        `json:"enable_log_store,omitempty"`
+
+	// 以下仅供按 URL 快速创建使用
+	extraParams []string // 构建器不认识的查询参数，原样附加到命令行
+	lenient     bool     // 校验问题只告警不拒绝，兼容此前可创建的 URL
 }
 
 // BatchCreateTunnelItem 批量创建隧道的单个项目
@@ -237,3 +242,101 @@ type TunnelSortItem struct {
 type UpdateTunnelsSortsRequest struct {
 	Tunnels []TunnelSortItem `json:"tunnels" binding:"required,min=1"`
 }
+
+// BulkUpdateFilter 批量修改的隧道筛选条件，各条件之间为 AND 关系
+type BulkUpdateFilter struct {
+	IDs         []int64           `json:"ids,omitempty"`         // 指定隧道ID
+	EndpointIDs []int64           `json:"endpointIds,omitempty"` // 主控筛选
+	GroupID     int64             `json:"groupId,omitempty"`     // 分组筛选
+	Tags        map[string]string `json:"tags,omitempty"`        // 标签筛选 key=value
+	Status      string            `json:"status,omitempty"`      // 状态筛选
+	Type        string            `json:"type,omitempty"`        // server | client
+	PortFrom    int               `json:"portFrom,omitempty"`    // 隧道端口下限（含）
+	PortTo      int               `json:"portTo,omitempty"`      // 隧道端口上限（含）
+	Name        string            `json:"name,omitempty"`        // 名称通配，如 hk-*
+	Query       string            `json:"query,omitempty"`       // 查询语言，见 query.go
+}
+
+// BulkUpdatePatch 批量修改的配置项，对应 TunnelConfig 的 URL 参数
+// nil 表示不修改，空字符串表示移除该参数（继承主控默认值）
+type BulkUpdatePatch struct {
+	Log   *string `json:"log,omitempty"`
+	TLS   *string `json:"tls,omitempty"`
+	Rate  *string `json:"rate,omitempty"`
+	Read  *string `json:"read,omitempty"`
+	Slot  *string `json:"slot,omitempty"`
+	Proxy *string `json:"proxy,omitempty"`
+	Dns   *string `json:"dns,omitempty"`
+	Sni   *string `json:"sni,omitempty"`
+	Block *string `json:"block,omitempty"`
+	Lbs   *string `json:"lbs,omitempty"`
+}
+
+// BulkUpdateRequest 批量修改请求
+type BulkUpdateRequest struct {
+	Filter      BulkUpdateFilter `json:"filter"`
+	Patch       BulkUpdatePatch  `json:"patch"`
+	DryRun      *bool            `json:"dryRun,omitempty"`      // 默认 true，仅返回差异
+	Concurrency int              `json:"concurrency,omitempty"` // 应用时的并发数，默认 5
+}
+
+// BulkFieldChange 单个参数的变更
+type BulkFieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// BulkUpdateItem 单个隧道的变更预览或执行结果
+type BulkUpdateItem struct {
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	EndpointID int64             `json:"endpointId"`
+	InstanceID string            `json:"instanceId"`
+	Changes    []BulkFieldChange `json:"changes"`
+	Skipped    []string          `json:"skipped,omitempty"` // 不适用于该隧道的参数
+	OldURL     string            `json:"oldUrl"`
+	NewURL     string            `json:"newUrl"`
+	Applied    bool              `json:"applied"`
+	Success    bool              `json:"success"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// BulkUpdateResult 批量修改结果
+type BulkUpdateResult struct {
+	Success      bool             `json:"success"`
+	DryRun       bool             `json:"dryRun"`
+	Matched      int              `json:"matched"` // 命中筛选的隧道数
+	Changed      int              `json:"changed"` // 需要变更的隧道数
+	SuccessCount int              `json:"successCount"`
+	FailCount    int              `json:"failCount"`
+	Items        []BulkUpdateItem `json:"items"`
+}
+
+// CloneOverrides 克隆时覆盖的名称、地址与端口，未设置的字段沿用源隧道
+type CloneOverrides struct {
+	Name          string  `json:"name,omitempty"`
+	TunnelAddress *string `json:"tunnelAddress,omitempty"`
+	TunnelPort    *int    `json:"tunnelPort,omitempty"`
+	TargetAddress *string `json:"targetAddress,omitempty"`
+	TargetPort    *int    `json:"targetPort,omitempty"`
+	TLSMode       *string `json:"tlsMode,omitempty"`
+	CertPath      *string `json:"certPath,omitempty"`
+	KeyPath       *string `json:"keyPath,omitempty"`
+}
+
+// CloneTunnelRequest 克隆隧道请求
+type CloneTunnelRequest struct {
+	EndpointIDs []int64 `json:"endpointIds"`
+	CloneOverrides
+}
+
+// CloneResult 单个目标主控的克隆结果
+type CloneResult struct {
+	EndpointID int64  `json:"endpointId"`
+	Success    bool   `json:"success"`
+	TunnelID   int64  `json:"tunnelId,omitempty"`
+	InstanceID string `json:"instanceId,omitempty"`
+	Name       string `json:"name"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,422 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/db/dialect"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 隧道查询语言（用于列表搜索、批量操作与导出）
+//
+// 语句由空格分隔的条件组成，条件之间为 AND 关系，前缀 - 表示取反：
+//
+//	tag:env=prod status:running,error port:10000-10100 type:server endpoint:"hk-*" rx>10GB -name:test*
+//
+// 支持的字段：
+//
+//	status:running,stopped   type:server|client      name:<glob>       target:<glob>   addr:<glob>
+//	endpoint:<名称glob|ID>    group:<名称glob|ID|none> tag:key[=value]   service:<sid>   instance:<id>
+//	port / tport:N|A-B|>N    rx / tx / total >|>=|<|<=|= 大小（支持 KB/MB/GB/TB）
+//	ping / pool >|>=|<|<=|= N   @<已保存的查询名>
+//
+// 未识别的词按关键字在名称和地址中模糊搜索。
+// 所有取值均以占位符传入，字段名与 JSON 键经白名单校验后才拼接进 SQL。
+
+const maxSavedQueryDepth = 3
+
+// QueryTerm 解析后的单个查询条件
+type QueryTerm struct {
+	Negate bool   // 是否取反
+	Field  string // 字段名，空表示关键字搜索
+	Op     string // : = > >= < <=
+	Value  string // 原始取值（已去除引号）
+}
+
+// SavedQueryResolver 根据名称取出已保存的查询语句
+type SavedQueryResolver func(name string) (string, error)
+
+// ParseTunnelQuery 把查询语句拆分为条件列表
+func ParseTunnelQuery(q string) ([]QueryTerm, error) {
+	tokens, err := tokenizeQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := make([]QueryTerm, 0, len(tokens))
+	for _, tok := range tokens {
+		term := QueryTerm{}
+		if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+			term.Negate = true
+			tok = tok[1:]
+		}
+
+		if strings.HasPrefix(tok, "@") {
+			term.Field = "@"
+			term.Op = ":"
+			term.Value = tok[1:]
+			terms = append(terms, term)
+			continue
+		}
+
+		field, op, value := splitQueryTerm(tok)
+		if field == "" || !isQueryField(field) {
+			term.Value = unquote(tok)
+		} else {
+			term.Field, term.Op, term.Value = field, op, unquote(value)
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// CompileTunnelQuery 把查询语句编译为 WHERE 片段（不含 WHERE 关键字）
+// alias 为 tunnels 表别名，空字符串表示直接使用列名
+func CompileTunnelQuery(q string, d dialect.Dialect, alias string, resolve SavedQueryResolver) (string, []interface{}, error) {
+	return compileTunnelQuery(q, d, alias, resolve, 0)
+}
+
+func compileTunnelQuery(q string, d dialect.Dialect, alias string, resolve SavedQueryResolver, depth int) (string, []interface{}, error) {
+	terms, err := ParseTunnelQuery(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c := &queryCompiler{d: d, alias: alias}
+	var conds []string
+	var args []interface{}
+	for _, term := range terms {
+		var cond string
+		var condArgs []interface{}
+
+		if term.Field == "@" {
+			if resolve == nil {
+				return "", nil, fmt.Errorf("不支持引用已保存的查询: @%s", term.Value)
+			}
+			if depth >= maxSavedQueryDepth {
+				return "", nil, errors.New("已保存的查询嵌套层级过深")
+			}
+			saved, err := resolve(term.Value)
+			if err != nil {
+				return "", nil, err
+			}
+			cond, condArgs, err = compileTunnelQuery(saved, d, alias, resolve, depth+1)
+			if err != nil {
+				return "", nil, fmt.Errorf("@%s: %v", term.Value, err)
+			}
+			if cond == "" {
+				continue
+			}
+			cond = "(" + cond + ")"
+		} else {
+			cond, condArgs, err = c.compileTerm(term)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+
+		if term.Negate {
+			cond = "NOT (" + cond + ")"
+		}
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+type queryCompiler struct {
+	d     dialect.Dialect
+	alias string
+}
+
+func (c *queryCompiler) col(name string) string {
+	if c.alias == "" {
+		return name
+	}
+	return c.alias + "." + name
+}
+
+func (c *queryCompiler) compileTerm(term QueryTerm) (string, []interface{}, error) {
+	v := term.Value
+	if term.Op != "" && term.Op != ":" && term.Op != "=" && !numericQueryFields[term.Field] {
+		return "", nil, fmt.Errorf("字段 %s 不支持比较符 %s", term.Field, term.Op)
+	}
+	switch term.Field {
+	case "":
+		like := "%" + escapeLike(strings.ToLower(v)) + "%"
+		return fmt.Sprintf("(LOWER(%s) LIKE ? ESCAPE '\\' OR LOWER(%s) LIKE ? ESCAPE '\\' OR LOWER(%s) LIKE ? ESCAPE '\\')",
+			c.col("name"), c.col("tunnel_address"), c.col("target_address")), []interface{}{like, like, like}, nil
+
+	case "status":
+		values := splitList(v)
+		for _, s := range values {
+			switch s {
+			case "running", "stopped", "error", "offline":
+			default:
+				return "", nil, fmt.Errorf("无效的状态: %s", s)
+			}
+		}
+		return c.inList("status", values)
+
+	case "type":
+		values := splitList(v)
+		for _, s := range values {
+			if s != "server" && s != "client" {
+				return "", nil, fmt.Errorf("无效的隧道类型: %s", s)
+			}
+		}
+		return c.inList("type", values)
+
+	case "name":
+		return c.globMatch(c.col("name"), v)
+	case "target":
+		return c.globMatch(c.col("target_address"), v)
+	case "addr":
+		return c.globMatch(c.col("tunnel_address"), v)
+	case "service":
+		return c.col("service_sid") + " = ?", []interface{}{v}, nil
+	case "instance":
+		return c.col("instance_id") + " = ?", []interface{}{v}, nil
+
+	case "endpoint":
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return c.col("endpoint_id") + " = ?", []interface{}{id}, nil
+		}
+		sub, args, err := c.globMatch("e.name", v)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s IN (SELECT e.id FROM endpoints e WHERE %s)", c.col("endpoint_id"), sub), args, nil
+
+	case "group":
+		if v == "none" {
+			return fmt.Sprintf("%s NOT IN (SELECT DISTINCT tg.tunnel_id FROM tunnel_groups tg)", c.col("id")), nil, nil
+		}
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return fmt.Sprintf("%s IN (SELECT tg.tunnel_id FROM tunnel_groups tg WHERE tg.group_id = ?)", c.col("id")), []interface{}{id}, nil
+		}
+		sub, args, err := c.globMatch("g.name", v)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s IN (SELECT tg.tunnel_id FROM tunnel_groups tg JOIN \"groups\" g ON g.id = tg.group_id WHERE %s)", c.col("id"), sub), args, nil
+
+	case "tag":
+		key, value, hasValue := strings.Cut(v, "=")
+		if !tagKeyPattern.MatchString(key) {
+			return "", nil, fmt.Errorf("无效的标签键: %s", key)
+		}
+		expr := c.d.JSONPath(c.col("tags"), key)
+		if !hasValue {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", expr, expr), nil, nil
+		}
+		return c.globMatch(expr, value)
+
+	case "port", "tport":
+		column := c.col("tunnel_port")
+		if term.Field == "tport" {
+			column = c.col("target_port")
+		}
+		return c.numeric(c.d.IntCast(column), term.Op, v, false)
+
+	case "rx":
+		return c.numeric(fmt.Sprintf("(%s + %s)", c.col("tcp_rx"), c.col("udp_rx")), term.Op, v, true)
+	case "tx":
+		return c.numeric(fmt.Sprintf("(%s + %s)", c.col("tcp_tx"), c.col("udp_tx")), term.Op, v, true)
+	case "total":
+		return c.numeric(fmt.Sprintf("(%s + %s + %s + %s)", c.col("tcp_rx"), c.col("udp_rx"), c.col("tcp_tx"), c.col("udp_tx")), term.Op, v, true)
+	case "ping":
+		return c.numeric(c.col("ping"), term.Op, v, false)
+	case "pool":
+		return c.numeric(c.col("pool"), term.Op, v, false)
+	}
+	return "", nil, fmt.Errorf("未知字段: %s", term.Field)
+}
+
+// inList 生成 col = ? 或 col IN (?, ?)
+func (c *queryCompiler) inList(column string, values []string) (string, []interface{}, error) {
+	if len(values) == 0 {
+		return "", nil, fmt.Errorf("字段 %s 缺少取值", column)
+	}
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	if len(values) == 1 {
+		return c.col(column) + " = ?", args, nil
+	}
+	return fmt.Sprintf("%s IN (%s)", c.col(column), strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")), args, nil
+}
+
+// globMatch 含 * 或 ? 时按通配匹配，否则精确匹配（均不区分大小写）
+func (c *queryCompiler) globMatch(expr, pattern string) (string, []interface{}, error) {
+	if pattern == "" {
+		return "", nil, errors.New("匹配条件不能为空")
+	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return fmt.Sprintf("LOWER(%s) = ?", expr), []interface{}{strings.ToLower(pattern)}, nil
+	}
+	like := escapeLike(strings.ToLower(pattern))
+	like = strings.NewReplacer("*", "%", "?", "_").Replace(like)
+	return fmt.Sprintf("LOWER(%s) LIKE ? ESCAPE '\\'", expr), []interface{}{like}, nil
+}
+
+// numeric 处理数值比较与区间，size 为 true 时取值可带容量单位
+func (c *queryCompiler) numeric(expr, op, value string, size bool) (string, []interface{}, error) {
+	parse := parseQueryInt
+	if size {
+		parse = ParseByteSize
+	}
+
+	switch op {
+	case ":", "=":
+		if lo, hi, ok := strings.Cut(value, "-"); ok && lo != "" && hi != "" {
+			from, err := parse(lo)
+			if err != nil {
+				return "", nil, err
+			}
+			to, err := parse(hi)
+			if err != nil {
+				return "", nil, err
+			}
+			if from > to {
+				from, to = to, from
+			}
+			return fmt.Sprintf("%s BETWEEN ? AND ?", expr), []interface{}{from, to}, nil
+		}
+		n, err := parse(value)
+		if err != nil {
+			return "", nil, err
+		}
+		return expr + " = ?", []interface{}{n}, nil
+	case ">", ">=", "<", "<=":
+		n, err := parse(value)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s %s ?", expr, op), []interface{}{n}, nil
+	}
+	return "", nil, fmt.Errorf("不支持的比较符: %s", op)
+}
+
+// ParseByteSize 解析 10GB / 1.5T / 512 等容量写法（按 1024 进制）
+func ParseByteSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "IB")
+	str = strings.TrimSuffix(str, "B")
+
+	multiplier := float64(1)
+	if n := len(str); n > 0 {
+		switch str[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			str = str[:n-1]
+		}
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("无效的容量: %s", s)
+	}
+	return int64(f * multiplier), nil
+}
+
+func parseQueryInt(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数字: %s", s)
+	}
+	return n, nil
+}
+
+var queryFields = map[string]bool{
+	"status": true, "type": true, "name": true, "target": true, "addr": true,
+	"endpoint": true, "group": true, "tag": true, "service": true, "instance": true,
+	"port": true, "tport": true, "rx": true, "tx": true, "total": true, "ping": true, "pool": true,
+}
+
+var numericQueryFields = map[string]bool{
+	"port": true, "tport": true, "rx": true, "tx": true, "total": true, "ping": true, "pool": true,
+}
+
+func isQueryField(field string) bool {
+	return queryFields[strings.ToLower(field)]
+}
+
+// tokenizeQuery 按空白切分，双引号内的空白保留
+func tokenizeQuery(q string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, errors.New("查询语句中的引号未闭合")
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+// splitQueryTerm 拆出 字段 / 比较符 / 取值，字段只允许字母
+func splitQueryTerm(tok string) (field, op, value string) {
+	i := 0
+	for i < len(tok) && (tok[i] >= 'a' && tok[i] <= 'z' || tok[i] >= 'A' && tok[i] <= 'Z') {
+		i++
+	}
+	if i == 0 || i == len(tok) {
+		return "", "", ""
+	}
+	rest := tok[i:]
+	for _, candidate := range []string{">=", "<=", ":", "=", ">", "<"} {
+		if strings.HasPrefix(rest, candidate) {
+			return strings.ToLower(tok[:i]), candidate, rest[len(candidate):]
+		}
+	}
+	return "", "", ""
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return strings.ReplaceAll(s, `"`, "")
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '|' }) {
+		if p := strings.ToLower(strings.TrimSpace(part)); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// escapeLike 转义 LIKE 中的特殊字符，配合 ESCAPE '\' 使用
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,81 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/db/dialect"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompileTunnelQuery(t *testing.T) {
+	saved := func(name string) (string, error) {
+		if name == "servers" {
+			return "type:server", nil
+		}
+		return "", errors.New("not found")
+	}
+
+	cases := []struct {
+		q        string
+		wantCond string
+		wantArgs []interface{}
+		wantErr  bool
+	}{
+		{"", "", nil, false},
+		{"tag:env=prod", "LOWER(t.tags->>'$.env') = ?", []interface{}{"prod"}, false},
+		{"status:running,error", "t.status IN (?, ?)", []interface{}{"running", "error"}, false},
+		{"port:10000-10100", "CAST(t.tunnel_port AS INTEGER) BETWEEN ? AND ?", []interface{}{int64(10000), int64(10100)}, false},
+		{`endpoint:"hk-*"`, "t.endpoint_id IN (SELECT e.id FROM endpoints e WHERE LOWER(e.name) LIKE ? ESCAPE '\\')", []interface{}{"hk-%"}, false},
+		{"rx>10GB", "(t.tcp_rx + t.udp_rx) > ?", []interface{}{int64(10737418240)}, false},
+		{"-name:test*", "NOT (LOWER(t.name) LIKE ? ESCAPE '\\')", []interface{}{"test%"}, false},
+		{"@servers", "(t.type = ?)", []interface{}{"server"}, false},
+		{"Edge.Example", "(LOWER(t.name) LIKE ? ESCAPE '\\' OR LOWER(t.tunnel_address) LIKE ? ESCAPE '\\' OR LOWER(t.target_address) LIKE ? ESCAPE '\\')",
+			[]interface{}{"%edge.example%", "%edge.example%", "%edge.example%"}, false},
+		{"status:bogus", "", nil, true},
+		{"name>3", "", nil, true},
+		{"tag:bad-key!", "", nil, true},
+		{"tag:a.b=1", "", nil, true},
+		{`name:"unclosed`, "", nil, true},
+		{"@missing", "", nil, true},
+	}
+
+	for _, tc := range cases {
+		cond, args, err := CompileTunnelQuery(tc.q, dialect.SQLite{}, "t", saved)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: err=%v wantErr=%v", tc.q, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+		if cond != tc.wantCond {
+			t.Errorf("%q: cond=%q want %q", tc.q, cond, tc.wantCond)
+		}
+		if len(args) != 0 || len(tc.wantArgs) != 0 {
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("%q: args=%v want %v", tc.q, args, tc.wantArgs)
+			}
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"1KB", 1024, false},
+		{"1.5MB", 1572864, false},
+		{"10gb", 10737418240, false},
+		{"2T", 2199023255552, false},
+		{"abc", 0, true},
+	}
+	for _, tc := range cases {
+		got, err := ParseByteSize(tc.in)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseByteSize(%q)=%d,%v want %d", tc.in, got, err, tc.want)
+		}
+	}
+}
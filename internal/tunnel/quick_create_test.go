@@ -0,0 +1,30 @@
+package tunnel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildCreateCommandLineLenient(t *testing.T) {
+	// tls=2 缺少证书：严格模式拒绝，快速创建仅告警并透传未知参数
+	req := CreateTunnelRequest{
+		Type:          "server",
+		TunnelPort:    10101,
+		TargetAddress: "127.0.0.1",
+		TargetPort:    80,
+		TLSMode:       TLS2,
+	}
+	if _, err := buildCreateCommandLine(req); err == nil {
+		t.Fatal("strict build should reject tls=2 without cert")
+	}
+
+	req.lenient = true
+	req.extraParams = []string{"foo=1", "bar=x"}
+	url, err := buildCreateCommandLine(req)
+	if err != nil {
+		t.Fatalf("lenient build: %v", err)
+	}
+	if !strings.HasPrefix(url, "server://:10101/127.0.0.1:80?") || !strings.HasSuffix(url, "&foo=1&bar=x") {
+		t.Errorf("url=%s", url)
+	}
+}
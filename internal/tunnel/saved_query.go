@@ -0,0 +1,77 @@
+package tunnel
+
+import (
+	"NodePassDash/internal/db"
+	"NodePassDash/internal/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// savedQueryNamePattern 查询名称在语句中以 @name 引用，只允许安全字符
+var savedQueryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// CompileQuery 使用当前数据库方言编译查询语句，支持 @name 引用已保存的查询
+func (s *Service) CompileQuery(q, alias string) (string, []interface{}, error) {
+	return CompileTunnelQuery(q, db.Dialect(), alias, s.resolveSavedQuery)
+}
+
+// resolveSavedQuery 按名称读取已保存的查询
+func (s *Service) resolveSavedQuery(name string) (string, error) {
+	var rows []models.TunnelSavedQuery
+	if err := s.db.Where("name = ?", name).Limit(1).Find(&rows).Error; err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("未找到已保存的查询: @%s", name)
+	}
+	return rows[0].Query, nil
+}
+
+// ListSavedQueries 获取全部已保存的查询
+func (s *Service) ListSavedQueries() ([]models.TunnelSavedQuery, error) {
+	var queries []models.TunnelSavedQuery
+	err := s.db.Order("name").Find(&queries).Error
+	return queries, err
+}
+
+// SaveQuery 按名称创建或更新查询，保存前先校验语句可编译
+func (s *Service) SaveQuery(q *models.TunnelSavedQuery) error {
+	q.Name = strings.TrimSpace(q.Name)
+	q.Query = strings.TrimSpace(q.Query)
+	if !savedQueryNamePattern.MatchString(q.Name) {
+		return errors.New("查询名称只能包含字母、数字、下划线和短横线，且不超过64个字符")
+	}
+	if q.Query == "" {
+		return errors.New("查询语句不能为空")
+	}
+	if strings.Contains(q.Query, "@"+q.Name) {
+		return errors.New("查询不能引用自身")
+	}
+	if _, _, err := s.CompileQuery(q.Query, "t"); err != nil {
+		return err
+	}
+
+	var existing []models.TunnelSavedQuery
+	if err := s.db.Where("name = ?", q.Name).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		q.ID = existing[0].ID
+		q.CreatedAt = existing[0].CreatedAt
+	}
+	return s.db.Save(q).Error
+}
+
+// DeleteSavedQuery 删除已保存的查询
+func (s *Service) DeleteSavedQuery(name string) error {
+	result := s.db.Where("name = ?", name).Delete(&models.TunnelSavedQuery{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("查询不存在")
+	}
+	return nil
+}
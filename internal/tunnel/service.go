@@ -8,7 +8,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -132,6 +131,60 @@ func (s *Service) GetTunnels() ([]TunnelWithStats, error) {
 	return tunnels, nil
 }
 
+// buildCreateCommandLine 由创建请求生成规范化命令行，校验失败时返回 nodepass.ValidationErrors
+func buildCreateCommandLine(req CreateTunnelRequest) (string, error) {
+	cfg := &nodepass.TunnelConfig{
+		Type:          req.Type,
+		Password:      req.Password,
+		TunnelAddress: req.TunnelAddress,
+		TunnelPort:    strconv.Itoa(req.TunnelPort),
+		TargetAddress: req.TargetAddress,
+		TargetPort:    strconv.Itoa(req.TargetPort),
+	}
+	if req.LogLevel != LogLevelInherit && req.LogLevel != "inherit" {
+		cfg.LogLevel = string(req.LogLevel)
+	}
+	if req.Type == "server" && req.TLSMode != TLSModeInherit && req.TLSMode != "inherit" {
+		cfg.TLSMode = string(req.TLSMode)
+		if req.TLSMode == TLS2 {
+			cfg.CertPath, cfg.KeyPath = req.CertPath, req.KeyPath
+		}
+	}
+	// min 仅对客户端生效，max 对服务端和客户端都适用
+	if req.Type == "client" && req.Min != nil {
+		cfg.Min = strconv.Itoa(*req.Min)
+	}
+	if req.Max != nil {
+		cfg.Max = strconv.Itoa(*req.Max)
+	}
+	if req.Mode != nil {
+		cfg.Mode = strconv.Itoa(int(*req.Mode))
+	}
+	if req.Read != nil {
+		cfg.Read = *req.Read
+	}
+	if req.Rate != nil {
+		cfg.Rate = strconv.Itoa(*req.Rate)
+	}
+	if req.Slot != nil {
+		cfg.Slot = strconv.Itoa(*req.Slot)
+	}
+	if req.ProxyProtocol != nil {
+		cfg.Proxy = "0"
+		if *req.ProxyProtocol {
+			cfg.Proxy = "1"
+		}
+	}
+
+	if errs := cfg.Validate(); len(errs) > 0 {
+		if !req.lenient {
+			return "", errs
+		}
+		log.Warnf("[API] 快速创建的隧道配置未通过校验，按原样创建: %v", errs)
+	}
+	return nodepass.AppendQueryParams(cfg.BuildURL(), req.extraParams), nil
+}
+
 // CreateTunnel 创建新隧道
 func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 	log.Infof("[API] 创建隧道: %v", req.Name)
@@ -145,81 +198,14 @@ func (s *Service) CreateTunnel(req CreateTunnelRequest) (*Tunnel, error) {
 		return nil, err
 	}
 
-	// 2. 构建命令行
-	var commandLine string
-	if req.Password != "" {
-		commandLine = fmt.Sprintf("%s://%s@%s:%d/%s:%d",
-			req.Type, // 修复：使用Type作为隧道类型
-			req.Password,
-			req.TunnelAddress,
-			req.TunnelPort,
-			req.TargetAddress,
-			req.TargetPort,
-		)
-	} else {
-		commandLine = fmt.Sprintf("%s://%s:%d/%s:%d",
-			req.Type, // 修复：使用Type作为隧道类型
-			req.TunnelAddress,
-			req.TunnelPort,
-			req.TargetAddress,
-			req.TargetPort,
-		)
+	// 2. 构建并校验命令行
+	commandLine, err := buildCreateCommandLine(req)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Infof("[API] 构建的命令行: %s", commandLine)
 
-	// 3. 添加查询参数
-	var queryParams []string
-
-	if req.LogLevel != LogLevelInherit && req.LogLevel != "" {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", req.LogLevel))
-	}
-
-	if req.Type == "server" && req.TLSMode != TLSModeInherit && req.TLSMode != "" {
-		var tlsModeNum string
-		switch req.TLSMode {
-		case TLS0:
-			tlsModeNum = "0"
-		case TLS1:
-			tlsModeNum = "1"
-		case TLS2:
-			tlsModeNum = "2"
-		}
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tlsModeNum))
-
-		if req.TLSMode == TLS2 && req.CertPath != "" && req.KeyPath != "" {
-			queryParams = append(queryParams,
-				fmt.Sprintf("crt=%s", url.QueryEscape(req.CertPath)),
-				fmt.Sprintf("key=%s", url.QueryEscape(req.KeyPath)),
-			)
-		}
-	}
-
-	if req.Type == "client" {
-		if req.Min != nil {
-			queryParams = append(queryParams, fmt.Sprintf("min=%d", *req.Min))
-		}
-	}
-	// Max 参数对服务端和客户端都适用
-	if req.Max != nil {
-		queryParams = append(queryParams, fmt.Sprintf("max=%d", *req.Max))
-	}
-
-	// 添加新的字段到命令行
-	if req.Mode != nil {
-		queryParams = append(queryParams, fmt.Sprintf("mode=%d", *req.Mode))
-	}
-	if req.Read != nil {
-		queryParams = append(queryParams, fmt.Sprintf("read=%s", *req.Read))
-	}
-	if req.Rate != nil {
-		queryParams = append(queryParams, fmt.Sprintf("rate=%d", *req.Rate))
-	}
-
-	if len(queryParams) > 0 {
-		commandLine += "?" + strings.Join(queryParams, "&")
-	}
-
 	// 4. 使用 NodePass 客户端创建实例
 	response, err := nodepass.CreateInstance(endpoint.ID, commandLine)
 	if err != nil {
@@ -670,49 +656,12 @@ func (s *Service) UpdateTunnel(req UpdateTunnelRequest) error {
 		updateFields["log_level"] = req.LogLevel
 	}
 
-	// 构建命令行
-	tunnelPortInt, _ := strconv.Atoi(tunnelWithEndpoint.TunnelPort)
-	targetPortInt, _ := strconv.Atoi(tunnelWithEndpoint.TargetPort)
-	commandLine := fmt.Sprintf("%s://%s:%d/%s:%d",
-		tunnelWithEndpoint.Type,
-		tunnelWithEndpoint.TunnelAddress,
-		tunnelPortInt,
-		tunnelWithEndpoint.TargetAddress,
-		targetPortInt,
-	)
-
-	// 添加查询参数
-	var queryParams []string
-
-	if tunnelWithEndpoint.LogLevel != models.LogLevelInherit && tunnelWithEndpoint.LogLevel != "" {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", tunnelWithEndpoint.LogLevel))
-	}
-
-	if tunnelWithEndpoint.Type == models.TunnelModeServer && tunnelWithEndpoint.TLSMode != models.TLSModeInherit && tunnelWithEndpoint.TLSMode != "" {
-		var tlsModeNum string
-		switch tunnelWithEndpoint.TLSMode {
-		case models.TLS0:
-			tlsModeNum = "0"
-		case models.TLS1:
-			tlsModeNum = "1"
-		case models.TLS2:
-			tlsModeNum = "2"
-		}
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tlsModeNum))
-
-		if tunnelWithEndpoint.TLSMode == models.TLS2 &&
-			tunnelWithEndpoint.CertPath != nil && *tunnelWithEndpoint.CertPath != "" &&
-			tunnelWithEndpoint.KeyPath != nil && *tunnelWithEndpoint.KeyPath != "" {
-			queryParams = append(queryParams,
-				fmt.Sprintf("crt=%s", url.QueryEscape(*tunnelWithEndpoint.CertPath)),
-				fmt.Sprintf("key=%s", url.QueryEscape(*tunnelWithEndpoint.KeyPath)),
-			)
-		}
-	}
-
-	if len(queryParams) > 0 {
-		commandLine += "?" + strings.Join(queryParams, "&")
+	// 构建命令行，保留未修改的其余参数
+	cfg := nodepass.NewTunnelConfig(tunnelWithEndpoint).Normalize()
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return errs
 	}
+	commandLine := cfg.BuildURL()
 
 	// 更新commandLine到字段
 	updateFields["command_line"] = commandLine
@@ -1060,83 +1009,10 @@ func (s *Service) CreateTunnelAndWait(req CreateTunnelRequest, timeout time.Dura
 		return nil, err
 	}
 
-	// 构建命令行（复用原有逻辑）
-	var commandLine string
-	if req.Password != "" {
-		commandLine = fmt.Sprintf("%s://%s@%s:%d/%s:%d",
-			req.Type, // 修复：使用Type作为隧道类型
-			req.Password,
-			req.TunnelAddress,
-			req.TunnelPort,
-			req.TargetAddress,
-			req.TargetPort,
-		)
-	} else {
-		commandLine = fmt.Sprintf("%s://%s:%d/%s:%d",
-			req.Type, // 修复：使用Type作为隧道类型
-			req.TunnelAddress,
-			req.TunnelPort,
-			req.TargetAddress,
-			req.TargetPort,
-		)
-	}
-
-	// 添加查询参数
-	var queryParams []string
-	if req.LogLevel != LogLevelInherit && req.LogLevel != "" {
-		queryParams = append(queryParams, fmt.Sprintf("log=%s", req.LogLevel))
-	}
-	if req.Type == "server" && req.TLSMode != TLSModeInherit && req.TLSMode != "" {
-		var tlsModeNum string
-		switch req.TLSMode {
-		case TLS0:
-			tlsModeNum = "0"
-		case TLS1:
-			tlsModeNum = "1"
-		case TLS2:
-			tlsModeNum = "2"
-		}
-		queryParams = append(queryParams, fmt.Sprintf("tls=%s", tlsModeNum))
-
-		if req.TLSMode == TLS2 && req.CertPath != "" && req.KeyPath != "" {
-			queryParams = append(queryParams,
-				fmt.Sprintf("crt=%s", url.QueryEscape(req.CertPath)),
-				fmt.Sprintf("key=%s", url.QueryEscape(req.KeyPath)),
-			)
-		}
-	}
-	if req.Type == "client" {
-		if req.Min != nil {
-			queryParams = append(queryParams, fmt.Sprintf("min=%d", *req.Min))
-		}
-	}
-	// Max 参数对服务端和客户端都适用
-	if req.Max != nil {
-		queryParams = append(queryParams, fmt.Sprintf("max=%d", *req.Max))
-	}
-	// 添加新的字段到命令行
-	if req.Mode != nil {
-		queryParams = append(queryParams, fmt.Sprintf("mode=%d", *req.Mode))
-	}
-	if req.Read != nil {
-		queryParams = append(queryParams, fmt.Sprintf("read=%s", *req.Read))
-	}
-	if req.Rate != nil {
-		queryParams = append(queryParams, fmt.Sprintf("rate=%d", *req.Rate))
-	}
-	if req.Slot != nil {
-		queryParams = append(queryParams, fmt.Sprintf("slot=%d", *req.Slot))
-	}
-	if req.ProxyProtocol != nil {
-		proxyVal := 0
-		if *req.ProxyProtocol {
-			proxyVal = 1
-		}
-		queryParams = append(queryParams, fmt.Sprintf("proxy=%d", proxyVal))
-	}
-
-	if len(queryParams) > 0 {
-		commandLine += "?" + strings.Join(queryParams, "&")
+	// 构建并校验命令行
+	commandLine, err := buildCreateCommandLine(req)
+	if err != nil {
+		return nil, err
 	}
 
 	log.Infof("[API] 构建的命令行: %s", commandLine)
@@ -1430,8 +1306,12 @@ func (s *Service) NewCreateTunnelAndWait(req Tunnel, timeout time.Duration) (*Tu
 		return nil, err
 	}
 
-	// 构建命令行（复用原有逻辑）
-	var commandLine string = nodepass.BuildTunnelURLs(req)
+	// 构建并校验命令行
+	cfg := nodepass.NewTunnelConfig(req).Normalize()
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	commandLine := cfg.BuildURL()
 	log.Infof("[API] 构建的命令行: %s", commandLine)
 
 	// 1. 使用 NodePass 客户端创建实例
@@ -1441,6 +1321,7 @@ func (s *Service) NewCreateTunnelAndWait(req Tunnel, timeout time.Duration) (*Tu
 		return nil, err
 	}
 
+	req.InstanceID = &resp.ID
 	log.Infof("[API] NodePass API 创建成功，instanceID=%s，开始等待SSE通知", resp.ID)
 
 	// 2. 轮询等待数据库中存在该 endpointId+instanceId 记录（通过 SSE 通知）
@@ -1468,6 +1349,8 @@ func (s *Service) NewCreateTunnelAndWait(req Tunnel, timeout time.Duration) (*Tu
 	if waitSuccess {
 		log.Infof("[API] 等待SSE成功，更新隧道名称为: %s", req.Name)
 
+		req.ID = tunnelID
+
 		// 3. 更新隧道字段（包括名称和其他配置字段）
 		updateFields := map[string]interface{}{
 			"name":       req.Name,
@@ -1538,6 +1421,8 @@ func (s *Service) NewCreateTunnelAndWait(req Tunnel, timeout time.Duration) (*Tu
 		}
 	}
 
+	req.ID = existingID
+
 	// 记录操作日志
 	fallbackMessage := "隧道创建成功（超时回退模式）"
 	operationLog := models.TunnelOperationLog{
@@ -1792,6 +1677,10 @@ func (s *Service) QuickCreateTunnel(endpointID int64, rawURL string, name string
 	if parsedTunnel == nil {
 		return errors.New("无效的隧道URL格式")
 	}
+	unknown := nodepass.UnknownQueryParams(rawURL)
+	if len(unknown) > 0 {
+		log.Warnf("[API] 隧道URL包含未知参数 %v，将原样透传", unknown)
+	}
 
 	// 端口转换
 	tp, _ := strconv.Atoi(parsedTunnel.TunnelPort)
@@ -1865,6 +1754,8 @@ func (s *Service) QuickCreateTunnel(endpointID int64, rawURL string, name string
 		ProxyProtocol:  parsedTunnel.ProxyProtocol,
 		EnableSSEStore: true,
 		EnableLogStore: true,
+		extraParams:    unknown,
+		lenient:        true,
 	}
 	_, err := s.CreateTunnelAndWait(req, 3*time.Second)
 	return err
@@ -1877,6 +1768,10 @@ func (s *Service) QuickCreateTunnelAndWait(endpointID int64, rawURL string, name
 	if parsedTunnel == nil {
 		return errors.New("无效的隧道URL格式")
 	}
+	unknown := nodepass.UnknownQueryParams(rawURL)
+	if len(unknown) > 0 {
+		log.Warnf("[API] 隧道URL包含未知参数 %v，将原样透传", unknown)
+	}
 
 	// 端口转换
 	tp, _ := strconv.Atoi(parsedTunnel.TunnelPort)
@@ -1951,6 +1846,8 @@ func (s *Service) QuickCreateTunnelAndWait(endpointID int64, rawURL string, name
 		ProxyProtocol:  parsedTunnel.ProxyProtocol,
 		EnableSSEStore: true,
 		EnableLogStore: true,
+		extraParams:    unknown,
+		lenient:        true,
 	}
 	_, err := s.CreateTunnelAndWait(req, timeout)
 	return err
@@ -2624,6 +2521,18 @@ func (s *Service) GetTunnelsWithPagination(params TunnelQueryParams) (*TunnelLis
 		}
 	}
 
+	// 查询语言筛选
+	if params.Query != "" {
+		cond, queryArgs, err := s.CompileQuery(params.Query, "t")
+		if err != nil {
+			return nil, fmt.Errorf("查询语句无效: %v", err)
+		}
+		if cond != "" {
+			whereConditions = append(whereConditions, "("+cond+")")
+			args = append(args, queryArgs...)
+		}
+	}
+
 	// 构建完整的 WHERE 子句
 	var whereClause string
 	if len(whereConditions) > 0 {
@@ -3081,6 +2990,13 @@ func (s *Service) QuickCreateTunnelDirectURL(endpointID int64, rawURL string, na
 	if parsedTunnel == nil {
 		return errors.New("无效的隧道URL格式")
 	}
+	// 校验问题只告警，保持此前可创建的 URL 仍能创建
+	if _, errs := nodepass.ValidateTunnelURL(rawURL); len(errs) > 0 {
+		log.Warnf("[API] 隧道URL未通过校验，按原样提交: %v", errs)
+	}
+	if unknown := nodepass.UnknownQueryParams(rawURL); len(unknown) > 0 {
+		log.Warnf("[API] 隧道URL包含未知参数 %v，将原样透传", unknown)
+	}
 
 	// 2. 生成隧道名称
 	finalName := name